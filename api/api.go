@@ -6,7 +6,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/github/git-lfs/config"
 	"github.com/github/git-lfs/errors"
@@ -50,6 +52,21 @@ func BatchOrLegacySingle(cfg *config.Configuration, inobj *ObjectResource, opera
 
 // Batch calls the batch API and returns object results
 func Batch(cfg *config.Configuration, objects []*ObjectResource, operation string, transferAdapters []string) (objs []*ObjectResource, transferAdapter string, e error) {
+	return batch(cfg, nil, false, objects, operation, transferAdapters)
+}
+
+// BatchFrom calls the batch API of "endpoint", such as a mirror, rather than
+// the configured endpoint. It is asked over HTTP(S) without SSH
+// authentication. If it answers with a 401, the request is sent again with
+// credentials, without changing the access type of the configured endpoint.
+func BatchFrom(cfg *config.Configuration, endpoint config.Endpoint, objects []*ObjectResource, operation string, transferAdapters []string) (objs []*ObjectResource, transferAdapter string, e error) {
+	return batch(cfg, &endpoint, false, objects, operation, transferAdapters)
+}
+
+// batch calls the batch API of "endpoint", or of the configured endpoint if it
+// is nil, sending credentials if "withCreds" or the configured endpoint needs
+// them.
+func batch(cfg *config.Configuration, endpoint *config.Endpoint, withCreds bool, objects []*ObjectResource, operation string, transferAdapters []string) (objs []*ObjectResource, transferAdapter string, e error) {
 	if len(objects) == 0 {
 		return nil, "", nil
 	}
@@ -60,13 +77,23 @@ func Batch(cfg *config.Configuration, objects []*ObjectResource, operation strin
 		transferAdapters = nil
 	}
 
-	o := &batchRequest{Operation: operation, Objects: objects, TransferAdapterNames: transferAdapters}
+	reqObjects, err := batchRequestObjects(objects)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "batch request")
+	}
+
+	o := &batchRequest{Operation: operation, Objects: reqObjects, TransferAdapterNames: transferAdapters}
 	by, err := json.Marshal(o)
 	if err != nil {
 		return nil, "", errors.Wrap(err, "batch request")
 	}
 
-	req, err := NewBatchRequest(cfg, operation)
+	var req *http.Request
+	if endpoint == nil {
+		req, err = NewBatchRequest(cfg, operation)
+	} else {
+		req, err = newBatchRequestTo(*endpoint, nil)
+	}
 	if err != nil {
 		return nil, "", errors.Wrap(err, "batch request")
 	}
@@ -78,20 +105,37 @@ func Batch(cfg *config.Configuration, objects []*ObjectResource, operation strin
 
 	tracerx.Printf("api: batch %d files", len(objects))
 
-	res, bresp, err := DoBatchRequest(cfg, req)
+	// Measure relative expiry times from before the request was sent, in
+	// case the server took a while to respond.
+	sent := time.Now()
+	var res *http.Response
+	var bresp *batchResponse
+	if withCreds {
+		res, bresp, err = doBatchRequest(cfg, req, true)
+	} else {
+		res, bresp, err = DoBatchRequest(cfg, req)
+	}
 
 	if err != nil {
+		// The batch API only exchanges metadata, so it is safe to
+		// retry for uploads as well as downloads.
 		if res == nil {
-			return nil, "", errors.NewRetriableError(err)
+			return nil, "", errors.NewRetriableNetworkError(err, true)
 		}
 
 		if res.StatusCode == 0 {
-			return nil, "", errors.NewRetriableError(err)
+			return nil, "", errors.NewRetriableNetworkError(err, true)
 		}
 
 		if errors.IsAuthError(err) {
-			httputil.SetAuthType(cfg, req, res)
-			return Batch(cfg, objects, operation, transferAdapters)
+			if endpoint == nil {
+				httputil.SetAuthType(cfg, req, res)
+				return Batch(cfg, objects, operation, transferAdapters)
+			}
+			if !withCreds {
+				tracerx.Printf("api: %s requires authentication. Resubmitting with credentials...", config.RedactURL(endpoint.Url))
+				return batch(cfg, endpoint, true, objects, operation, transferAdapters)
+			}
 		}
 
 		switch res.StatusCode {
@@ -105,12 +149,70 @@ func Batch(cfg *config.Configuration, objects []*ObjectResource, operation strin
 	httputil.LogTransfer(cfg, "lfs.batch", res)
 
 	if res.StatusCode != 200 {
-		return nil, "", errors.Errorf("Invalid status for %s: %d", httputil.TraceHttpReq(req), res.StatusCode)
+		err = errors.Errorf("Invalid status for %s: %d", httputil.TraceHttpReq(req), res.StatusCode)
+		return nil, "", errors.NewStatusError(err, res.StatusCode)
+	}
+
+	for _, o := range bresp.Objects {
+		o.setExpiresAt(sent)
 	}
 
 	return bresp.Objects, bresp.TransferAdapterName, nil
 }
 
+// batchRequestObjects returns the objects of a batch API request as they are
+// sent, with the Metadata of each merged into its fields. Metadata can't
+// replace the fields of the object itself, such as "oid" and "size".
+func batchRequestObjects(objects []*ObjectResource) ([]interface{}, error) {
+	reqObjects := make([]interface{}, 0, len(objects))
+	for _, obj := range objects {
+		if len(obj.Metadata) == 0 {
+			reqObjects = append(reqObjects, obj)
+			continue
+		}
+
+		by, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		fields := make(map[string]interface{})
+		if err := json.Unmarshal(by, &fields); err != nil {
+			return nil, err
+		}
+
+		for key, value := range obj.Metadata {
+			if _, ok := fields[key]; !ok {
+				fields[key] = value
+			}
+		}
+		reqObjects = append(reqObjects, fields)
+	}
+	return reqObjects, nil
+}
+
+// RefreshObject requests fresh actions for "obj" with a single object batch
+// API request, for when the ones it has have expired or are about to. It
+// returns the object from the response, which has no actions for "operation"
+// if the server no longer needs it to be transferred.
+func RefreshObject(cfg *config.Configuration, obj *ObjectResource, operation string, transferAdapters []string) (*ObjectResource, error) {
+	objs, _, err := Batch(cfg, []*ObjectResource{{Oid: obj.Oid, Size: obj.Size, Metadata: obj.Metadata}}, operation, transferAdapters)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range objs {
+		if o.Oid != obj.Oid {
+			continue
+		}
+		if o.Error != nil {
+			return nil, errors.Wrapf(o.Error, "[%v] %v", o.Oid, o.Error.Message)
+		}
+		return o, nil
+	}
+	return nil, errors.Errorf("api: batch response did not include %q", obj.Oid)
+}
+
 // Legacy calls the legacy API serially and returns ObjectResources
 // TODO LEGACY API: remove when legacy API removed
 func Legacy(cfg *config.Configuration, objects []*ObjectResource, operation string) ([]*ObjectResource, error) {
@@ -187,7 +289,7 @@ func UploadCheck(cfg *config.Configuration, oid string, size int64) (*ObjectReso
 			return UploadCheck(cfg, oid, size)
 		}
 
-		return nil, errors.NewRetriableError(err)
+		return nil, errors.NewRetriableNetworkError(err, true)
 	}
 	httputil.LogTransfer(cfg, "lfs.upload", res)
 
@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/github/git-lfs/api"
 	"github.com/github/git-lfs/auth"
@@ -390,3 +391,274 @@ func SetupTestCredentialsFunc() {
 func RestoreCredentialsFunc() {
 	auth.SetCredentialsFunc(origCredentialsFunc)
 }
+
+func TestRefreshObject(t *testing.T) {
+	SetupTestCredentialsFunc()
+	defer func() {
+		RestoreCredentialsFunc()
+	}()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/media/objects/batch", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Objects []*api.ObjectResource `json:"objects"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if len(req.Objects) != 1 || req.Objects[0].Oid != "oid" || req.Objects[0].Actions != nil {
+			t.Errorf("unexpected objects: %v", req.Objects)
+		}
+
+		by, err := json.Marshal(map[string]interface{}{
+			"objects": []*api.ObjectResource{{
+				Oid:  "oid",
+				Size: 4,
+				Actions: map[string]*api.LinkRelation{
+					"download": &api.LinkRelation{
+						Href:      server.URL + "/download",
+						ExpiresIn: 60,
+					},
+				},
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		head := w.Header()
+		head.Set("Content-Type", api.MediaType)
+		head.Set("Content-Length", strconv.Itoa(len(by)))
+		w.WriteHeader(200)
+		w.Write(by)
+	})
+
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.url": server.URL + "/media",
+		},
+	})
+
+	expired := &api.ObjectResource{
+		Oid:  "oid",
+		Size: 4,
+		Actions: map[string]*api.LinkRelation{
+			"download": &api.LinkRelation{
+				Href:      server.URL + "/download",
+				ExpiresAt: time.Now().Add(-time.Minute),
+			},
+		},
+	}
+
+	start := time.Now()
+	obj, err := api.RefreshObject(cfg, expired, "download", []string{"basic"})
+	if err != nil {
+		if isDockerConnectionError(err) {
+			return
+		}
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rel, ok := obj.Rel("download")
+	if !ok {
+		t.Fatal("expected a download action")
+	}
+	// expires_in is converted to an absolute expiry time
+	if rel.ExpiresAt.Before(start.Add(60*time.Second)) || rel.ExpiresAt.After(time.Now().Add(60*time.Second)) {
+		t.Errorf("unexpected expiry: %v", rel.ExpiresAt)
+	}
+	if obj.IsExpired(time.Now()) {
+		t.Error("refreshed object should not be expired")
+	}
+}
+
+func TestBatchSendsObjectMetadata(t *testing.T) {
+	SetupTestCredentialsFunc()
+	defer func() {
+		RestoreCredentialsFunc()
+	}()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/media/objects/batch", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Objects []map[string]interface{} `json:"objects"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if len(req.Objects) != 2 {
+			t.Fatalf("unexpected objects: %v", req.Objects)
+		}
+
+		// Metadata is merged into the object, but can't replace its
+		// own fields.
+		a := req.Objects[0]
+		if a["oid"] != "a" || a["size"] != float64(1) || a["ref"] != "refs/heads/master" {
+			t.Errorf("unexpected object with metadata: %v", a)
+		}
+
+		b := req.Objects[1]
+		if b["oid"] != "b" || len(b) != 2 {
+			t.Errorf("unexpected object without metadata: %v", b)
+		}
+
+		by, err := json.Marshal(map[string]interface{}{
+			"objects": []*api.ObjectResource{{Oid: "a", Size: 1}, {Oid: "b", Size: 2}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		head := w.Header()
+		head.Set("Content-Type", api.MediaType)
+		head.Set("Content-Length", strconv.Itoa(len(by)))
+		w.WriteHeader(200)
+		w.Write(by)
+	})
+
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.url": server.URL + "/media",
+		},
+	})
+
+	objects := []*api.ObjectResource{
+		{Oid: "a", Size: 1, Metadata: map[string]interface{}{"ref": "refs/heads/master", "oid": "other"}},
+		{Oid: "b", Size: 2},
+	}
+
+	objs, _, err := api.Batch(cfg, objects, "download", []string{"basic"})
+	if err != nil {
+		if isDockerConnectionError(err) {
+			return
+		}
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(objs) != 2 || objs[0].Metadata != nil {
+		t.Errorf("unexpected response objects: %v", objs)
+	}
+}
+
+func TestBatchFromAsksTheGivenEndpoint(t *testing.T) {
+	SetupTestCredentialsFunc()
+	defer func() {
+		RestoreCredentialsFunc()
+	}()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/media/objects/batch", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected the configured endpoint not to be asked")
+		w.WriteHeader(500)
+	})
+
+	mux.HandleFunc("/mirror/objects/batch", func(w http.ResponseWriter, r *http.Request) {
+		by, err := json.Marshal(map[string]interface{}{
+			"objects": []*api.ObjectResource{{
+				Oid:  "a",
+				Size: 1,
+				Actions: map[string]*api.LinkRelation{
+					"download": &api.LinkRelation{Href: server.URL + "/mirror/a"},
+				},
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		head := w.Header()
+		head.Set("Content-Type", api.MediaType)
+		head.Set("Content-Length", strconv.Itoa(len(by)))
+		w.WriteHeader(200)
+		w.Write(by)
+	})
+
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.url": server.URL + "/media",
+		},
+	})
+
+	mirror := config.NewEndpointWithConfig(server.URL+"/mirror", cfg)
+	objs, _, err := api.BatchFrom(cfg, mirror, []*api.ObjectResource{{Oid: "a", Size: 1}}, "download", []string{"basic"})
+	if err != nil {
+		if isDockerConnectionError(err) {
+			return
+		}
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(objs) != 1 {
+		t.Fatalf("unexpected response objects: %v", objs)
+	}
+	if rel, ok := objs[0].Rel("download"); !ok || rel.Href != server.URL+"/mirror/a" {
+		t.Errorf("expected the mirror's download action, got %v", objs[0].Actions)
+	}
+}
+
+func TestBatchFromSendsCredentialsAfter401(t *testing.T) {
+	SetupTestCredentialsFunc()
+	defer func() {
+		RestoreCredentialsFunc()
+	}()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var requests int
+	mux.HandleFunc("/mirror/objects/batch", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if len(r.Header.Get("Authorization")) == 0 {
+			w.WriteHeader(401)
+			return
+		}
+
+		by, err := json.Marshal(map[string]interface{}{
+			"objects": []*api.ObjectResource{{Oid: "a", Size: 1}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		head := w.Header()
+		head.Set("Content-Type", api.MediaType)
+		head.Set("Content-Length", strconv.Itoa(len(by)))
+		w.WriteHeader(200)
+		w.Write(by)
+	})
+
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.url": "https://lfs.example.com/media",
+		},
+	})
+
+	mirror := config.NewEndpointWithConfig(server.URL+"/mirror", cfg)
+	objs, _, err := api.BatchFrom(cfg, mirror, []*api.ObjectResource{{Oid: "a", Size: 1}}, "download", []string{"basic"})
+	if err != nil {
+		if isDockerConnectionError(err) {
+			return
+		}
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(objs) != 1 {
+		t.Errorf("unexpected response objects: %v", objs)
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+	if cfg.PrivateAccess("download") {
+		t.Error("expected the configured endpoint's access to be unchanged")
+	}
+}
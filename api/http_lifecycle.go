@@ -4,7 +4,6 @@ package api
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -12,6 +11,7 @@ import (
 
 	"github.com/github/git-lfs/auth"
 	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/errors"
 	"github.com/github/git-lfs/httputil"
 )
 
@@ -99,11 +99,22 @@ func (l *HttpLifecycle) Build(schema *RequestSchema) (*http.Request, error) {
 // original RequestSchema. If an error occured while decoding, then that error
 // is returned.
 //
+// If the server responded that it doesn't implement the requested method, with
+// a 404, 410 or 501 status, the returned error satisfies
+// errors.IsNotImplementedError, so that callers can tell older servers apart
+// from failed requests.
+//
 // Otherwise, the api.Response is returned, along with no error, signaling that
 // the request completed successfully.
 func (l *HttpLifecycle) Execute(req *http.Request, into interface{}) (Response, error) {
 	resp, err := httputil.DoHttpRequestWithRedirects(config.Config, req, []*http.Request{}, true)
 	if err != nil {
+		if resp != nil {
+			switch resp.StatusCode {
+			case 404, 410, 501:
+				return nil, errors.NewNotImplementedError(err)
+			}
+		}
 		return nil, err
 	}
 
@@ -8,6 +8,7 @@ import (
 
 	"github.com/github/git-lfs/api"
 	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -146,3 +147,21 @@ func TestHttpLifecycleExecutesRequestWithBody(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "bar", resp.Foo)
 }
+
+func TestHttpLifecycleReportsUnimplementedMethods(t *testing.T) {
+	SetupTestCredentialsFunc()
+	defer RestoreCredentialsFunc()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/path", nil)
+
+	l := api.NewHttpLifecycle(source)
+	_, err := l.Execute(req, nil)
+
+	assert.NotNil(t, err)
+	assert.True(t, errors.IsNotImplementedError(err))
+}
@@ -81,6 +81,25 @@ func (s *LockService) Search(req *LockSearchRequest) (*RequestSchema, *LockList)
 	}, &resp
 }
 
+// Verify generates a *RequestSchema that is used to preform the "verify locks"
+// API method, which lists the locks that apply to a push of the given ref,
+// split into those held by the caller ("ours") and by anyone else ("theirs").
+//
+// Like Search, the response may be paginated, in which case its NextCursor is
+// sent as the Cursor of the next request. Servers which don't implement this
+// method respond with an error which satisfies errors.IsNotImplementedError.
+func (s *LockService) Verify(req *VerifiableLockRequest) (*RequestSchema, *VerifiableLockList) {
+	var resp VerifiableLockList
+
+	return &RequestSchema{
+		Method:    "POST",
+		Path:      "/locks/verify",
+		Operation: UploadOperation,
+		Body:      req,
+		Into:      &resp,
+	}, &resp
+}
+
 // Unlock generates a *RequestSchema that is used to preform the "unlock" API
 // method, against a particular lock potentially with --force.
 //
@@ -254,3 +273,37 @@ type LockList struct {
 	// of nil will be passed here.
 	Err string `json:"error,omitempty"`
 }
+
+// Ref names the Git ref that a request applies to.
+type Ref struct {
+	// Name is the full name of the ref, for instance "refs/heads/master".
+	Name string `json:"name"`
+}
+
+// VerifiableLockRequest encapsulates the request sent to the server when the
+// client would like to know which locks apply to a push, before sending it.
+type VerifiableLockRequest struct {
+	// Ref is the ref being pushed, if it is known.
+	Ref *Ref `json:"ref,omitempty"`
+	// Cursor is an optional field used to tell the server which lock was
+	// seen last, as in LockSearchRequest.
+	Cursor string `json:"cursor,omitempty"`
+	// Limit is the maximum number of locks to return in a single page.
+	Limit int `json:"limit,omitempty"`
+}
+
+// VerifiableLockList encapsulates the locks returned by the "verify locks" API
+// method.
+type VerifiableLockList struct {
+	// Ours is the set of locks held by the user who made the request.
+	Ours []Lock `json:"ours"`
+	// Theirs is the set of locks held by anyone else, which the user may
+	// not push changes to.
+	Theirs []Lock `json:"theirs"`
+	// NextCursor returns the Id of the Lock the client should update its
+	// cursor to, if there are multiple pages of results.
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Err populates any error that was encountered while verifying the
+	// locks.
+	Err string `json:"error,omitempty"`
+}
@@ -89,6 +89,22 @@ func TestUnlockingALock(t *testing.T) {
 	}, got)
 }
 
+func TestVerifyingLocks(t *testing.T) {
+	req := &api.VerifiableLockRequest{
+		Ref:    &api.Ref{Name: "refs/heads/master"},
+		Cursor: "some-lock-id",
+	}
+	got, body := LockService.Verify(req)
+
+	AssertRequestSchema(t, &api.RequestSchema{
+		Method:    "POST",
+		Path:      "/locks/verify",
+		Operation: api.UploadOperation,
+		Body:      req,
+		Into:      body,
+	}, got)
+}
+
 func TestLockRequest(t *testing.T) {
 	schema.Validate(t, schema.LockRequestSchema, &api.LockRequest{
 		Path:               "/path/to/lock",
@@ -218,3 +234,28 @@ func TestLockListWithErrorAndLocks(t *testing.T) {
 		Err: "this isn't possible!",
 	})
 }
+
+func TestVerifiableLockRequest(t *testing.T) {
+	schema.Validate(t, schema.LockVerifyRequestSchema, &api.VerifiableLockRequest{
+		Ref:   &api.Ref{Name: "refs/heads/master"},
+		Limit: 100,
+	})
+}
+
+func TestVerifiableLockListWithLocks(t *testing.T) {
+	schema.Validate(t, schema.LockVerifyResponseSchema, &api.VerifiableLockList{
+		Ours: []api.Lock{
+			api.Lock{Id: "foo"},
+		},
+		Theirs: []api.Lock{
+			api.Lock{Id: "bar"},
+		},
+		NextCursor: "baz",
+	})
+}
+
+func TestVerifiableLockListWithError(t *testing.T) {
+	schema.Validate(t, schema.LockVerifyResponseSchema, &api.VerifiableLockList{
+		Err: "some error",
+	})
+}
@@ -25,6 +25,13 @@ type ObjectResource struct {
 	Actions       map[string]*LinkRelation `json:"actions,omitempty"`
 	Links         map[string]*LinkRelation `json:"_links,omitempty"`
 	Error         *ObjectError             `json:"error,omitempty"`
+	// DeltaBase is the OID of an object the server has, which it will
+	// accept a patch against through the "delta" action.
+	DeltaBase string `json:"delta_base,omitempty"`
+	// Metadata holds extra fields for the object in batch API requests,
+	// such as the ref or commit it belongs to, for servers whose
+	// authorization policy needs them. It is never read from responses.
+	Metadata map[string]interface{} `json:"-"`
 }
 
 // TODO LEGACY API: remove when legacy API removed
@@ -74,6 +81,16 @@ func (o *ObjectResource) IsExpired(now time.Time) bool {
 	return false
 }
 
+// setExpiresAt sets the ExpiresAt field of each action with an ExpiresIn field
+// to that many seconds after "received".
+func (o *ObjectResource) setExpiresAt(received time.Time) {
+	for _, a := range o.Actions {
+		if a.ExpiresIn != 0 {
+			a.ExpiresAt = received.Add(time.Duration(a.ExpiresIn) * time.Second)
+		}
+	}
+}
+
 func (o *ObjectResource) NeedsAuth() bool {
 	return !o.Authenticated
 }
@@ -82,4 +99,8 @@ type LinkRelation struct {
 	Href      string            `json:"href"`
 	Header    map[string]string `json:"header,omitempty"`
 	ExpiresAt time.Time         `json:"expires_at,omitempty"`
+	// ExpiresIn is the number of seconds after the batch response for which
+	// the action is valid. It takes precedence over ExpiresAt, and is
+	// converted to it when the response is received; see setExpiresAt.
+	ExpiresIn int `json:"expires_in,omitempty"`
 }
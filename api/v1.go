@@ -37,9 +37,9 @@ func DoLegacyRequest(cfg *config.Configuration, req *http.Request) (*http.Respon
 }
 
 type batchRequest struct {
-	TransferAdapterNames []string          `json:"transfers,omitempty"`
-	Operation            string            `json:"operation"`
-	Objects              []*ObjectResource `json:"objects"`
+	TransferAdapterNames []string      `json:"transfers,omitempty"`
+	Operation            string        `json:"operation"`
+	Objects              []interface{} `json:"objects"`
 }
 type batchResponse struct {
 	TransferAdapterName string            `json:"transfer"`
@@ -51,7 +51,13 @@ type batchResponse struct {
 // re-run. When the repo is marked as having private access, credentials will
 // be retrieved.
 func DoBatchRequest(cfg *config.Configuration, req *http.Request) (*http.Response, *batchResponse, error) {
-	res, err := DoRequest(req, cfg.PrivateAccess(auth.GetOperationForRequest(req)))
+	return doBatchRequest(cfg, req, cfg.PrivateAccess(auth.GetOperationForRequest(req)))
+}
+
+// doBatchRequest runs a batch API request, sending credentials with it if
+// "useCreds".
+func doBatchRequest(cfg *config.Configuration, req *http.Request, useCreds bool) (*http.Response, *batchResponse, error) {
+	res, err := DoRequest(req, useCreds)
 
 	if err != nil {
 		if res != nil && res.StatusCode == 401 {
@@ -128,6 +134,12 @@ func NewBatchRequest(cfg *config.Configuration, operation string) (*http.Request
 		endpoint.Url = res.Href
 	}
 
+	return newBatchRequestTo(endpoint, res.Header)
+}
+
+// newBatchRequestTo builds a batch API request to "endpoint", with the given
+// extra headers, such as those from SSH authentication.
+func newBatchRequestTo(endpoint config.Endpoint, header map[string]string) (*http.Request, error) {
 	u, err := ObjectUrl(endpoint, "batch")
 	if err != nil {
 		return nil, err
@@ -139,10 +151,8 @@ func NewBatchRequest(cfg *config.Configuration, operation string) (*http.Request
 	}
 
 	req.Header.Set("Accept", MediaType)
-	if res.Header != nil {
-		for key, value := range res.Header {
-			req.Header.Set(key, value)
-		}
+	for key, value := range header {
+		req.Header.Set(key, value)
 	}
 
 	return req, nil
@@ -0,0 +1,192 @@
+package commands
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/git"
+	"github.com/github/git-lfs/lfs"
+	"github.com/github/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+)
+
+// findAttributeFiles returns the attributes files in the repository: its
+// info/attributes file and the .gitattributes files in the working tree, other
+// than those in ignored directories, submodules or lfs.attributesexclude.
+func findAttributeFiles() []string {
+	paths := make([]string, 0)
+
+	if info, err := os.Stat(repoAttributesPath()); err == nil && !info.IsDir() {
+		paths = append(paths, repoAttributesPath())
+	}
+
+	excluded := config.Config.AttributesExcludePaths()
+
+	files, err := git.GetAttributesFiles(config.LocalWorkingDir)
+	if err != nil {
+		tracerx.Printf("track: %s, searching the whole working tree instead", err)
+		return append(paths, walkAttributeFiles(config.LocalWorkingDir, config.LocalGitDir, excluded)...)
+	}
+
+	for _, f := range files {
+		if lfs.FilenamePassesIncludeExcludeFilter(filepath.Dir(f), nil, excluded) {
+			paths = append(paths, filepath.Join(config.LocalWorkingDir, f))
+		}
+	}
+	return paths
+}
+
+var (
+	repoAttributesOnce sync.Once
+	repoAttributes     string
+)
+
+// repoAttributesPath returns the path of the repository's info/attributes
+// file, which isn't committed. Git reads it from the directory which is shared
+// by all of the repository's worktrees, rather than from the git directory of
+// each, so it is found with git rev-parse --git-common-dir, which also follows
+// GIT_COMMON_DIR.
+func repoAttributesPath() string {
+	repoAttributesOnce.Do(func() {
+		dir, err := git.GitCommonDir()
+		if err != nil || len(dir) == 0 {
+			tracerx.Printf("track: unable to find the common git directory, using %s: %v", config.LocalGitStorageDir, err)
+			dir = config.LocalGitStorageDir
+		}
+		repoAttributes = filepath.Join(tools.ResolveSymlinks(dir), "info", "attributes")
+	})
+	return repoAttributes
+}
+
+// isRepoAttributes returns whether "relfile", relative to the root of the
+// working tree, is the repository's info/attributes file.
+func isRepoAttributes(relfile string) bool {
+	return filepath.Join(config.LocalWorkingDir, relfile) == repoAttributesPath()
+}
+
+// attributesDir returns the directory, relative to the root of the working
+// tree, from which the patterns in the attributes file "relfile" are matched:
+// its own, or the root for info/attributes.
+func attributesDir(relfile string) string {
+	if isRepoAttributes(relfile) {
+		return "."
+	}
+	return filepath.Dir(relfile)
+}
+
+// walkAttributeFiles finds the .gitattributes files in the working tree at
+// "root" by walking it, for when Git can't list them. It doesn't descend into
+// "gitDir", the .git directories and checkouts of any submodules, directories
+// ignored by .gitignore files, or the directories in "excluded".
+//
+// Only simple .gitignore patterns are understood: those using "**" may not
+// match, and negated patterns are not applied. This can only make the walk
+// slower, since a directory which isn't pruned is still searched.
+func walkAttributeFiles(root, gitDir string, excluded []string) []string {
+	paths := make([]string, 0)
+	ignores := make(map[string][]ignorePattern)
+
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			if info.Name() == ".gitattributes" {
+				paths = append(paths, path)
+			}
+			return nil
+		}
+
+		if path != root {
+			rel, _ := filepath.Rel(root, path)
+			if path == gitDir || info.Name() == ".git" ||
+				isSubmoduleCheckout(path) ||
+				isIgnoredDir(ignores, root, rel) ||
+				!lfs.FilenamePassesIncludeExcludeFilter(rel, nil, excluded) {
+				return filepath.SkipDir
+			}
+		}
+
+		if patterns := readIgnorePatterns(filepath.Join(path, ".gitignore")); len(patterns) > 0 {
+			rel, _ := filepath.Rel(root, path)
+			ignores[rel] = patterns
+		}
+		return nil
+	})
+
+	return paths
+}
+
+// isSubmoduleCheckout returns whether the directory "path" is the root of
+// another repository, such as a submodule, which has a .git file or directory.
+func isSubmoduleCheckout(path string) bool {
+	_, err := os.Lstat(filepath.Join(path, ".git"))
+	return err == nil
+}
+
+// ignorePattern is a pattern from a .gitignore file.
+type ignorePattern struct {
+	pattern string
+	// anchored patterns contain a slash, so are matched against the path
+	// relative to the .gitignore file, rather than against the name.
+	anchored bool
+}
+
+// readIgnorePatterns reads the patterns in the .gitignore file at "path",
+// leaving out negated ones. It returns none if the file doesn't exist.
+func readIgnorePatterns(path string) []ignorePattern {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var patterns []ignorePattern
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		line = strings.TrimSuffix(line, "/")
+		anchored := strings.Contains(line, "/")
+		patterns = append(patterns, ignorePattern{
+			pattern:  strings.TrimPrefix(line, "/"),
+			anchored: anchored,
+		})
+	}
+
+	return patterns
+}
+
+// isIgnoredDir returns whether the directory "rel", relative to "root",
+// matches any of the "ignores" read from the .gitignore files in the
+// directories above it, which are keyed by their paths relative to "root".
+func isIgnoredDir(ignores map[string][]ignorePattern, root, rel string) bool {
+	name := filepath.Base(rel)
+
+	for dir := filepath.Dir(rel); ; dir = filepath.Dir(dir) {
+		for _, p := range ignores[dir] {
+			target := name
+			if p.anchored {
+				target, _ = filepath.Rel(filepath.Join(root, dir), filepath.Join(root, rel))
+				target = filepath.ToSlash(target)
+			}
+
+			if matched, _ := filepath.Match(p.pattern, target); matched {
+				return true
+			}
+		}
+
+		if dir == "." {
+			return false
+		}
+	}
+}
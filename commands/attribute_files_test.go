@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/github/git-lfs/git"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeAttributesTree writes the files in "files", keyed by their paths
+// relative to a new temporary directory, which it returns.
+func writeAttributesTree(t testing.TB, files map[string]string) string {
+	root, err := ioutil.TempDir("", "attribute-files")
+	require.Nil(t, err)
+
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.Nil(t, ioutil.WriteFile(path, []byte(data), 0644))
+	}
+	return root
+}
+
+// relativePaths returns "paths" relative to "root", with forward slashes,
+// sorted.
+func relativePaths(root string, paths []string) []string {
+	rel := make([]string, 0, len(paths))
+	for _, path := range paths {
+		r, _ := filepath.Rel(root, path)
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	sort.Strings(rel)
+	return rel
+}
+
+func TestWalkAttributeFiles(t *testing.T) {
+	root := writeAttributesTree(t, map[string]string{
+		".gitattributes":                   "*.dat filter=lfs\n",
+		".gitignore":                       "# dependencies\nnode_modules/\n/build\n!keep\n",
+		"a/.gitattributes":                 "*.bin filter=lfs\n",
+		"a/.gitignore":                     "out/\nlib/generated\n",
+		"a/out/.gitattributes":             "*.out filter=lfs\n",
+		"a/lib/generated/.gitattributes":   "*.gen filter=lfs\n",
+		"a/lib/.gitattributes":             "*.lib filter=lfs\n",
+		"a/build/.gitattributes":           "*.build filter=lfs\n",
+		"build/.gitattributes":             "*.build filter=lfs\n",
+		"node_modules/pkg/.gitattributes":  "*.js filter=lfs\n",
+		"vendor/pkg/.gitattributes":        "*.go filter=lfs\n",
+		"sub/.git":                         "gitdir: ../.git/modules/sub\n",
+		"sub/.gitattributes":               "*.sub filter=lfs\n",
+		".git/info/attributes":             "*.info filter=lfs\n",
+		".git/modules/sub/.gitattributes":  "*.mod filter=lfs\n",
+		"a/b/c/d/e/.gitattributes":         "*.deep filter=lfs\n",
+		"a/b/not-attributes/.gitignore":    "",
+		"a/b/not-attributes/gitattributes": "*.no filter=lfs\n",
+	})
+	defer os.RemoveAll(root)
+
+	found := walkAttributeFiles(root, filepath.Join(root, ".git"), []string{"vendor"})
+
+	assert.Equal(t, []string{
+		".gitattributes",
+		"a/.gitattributes",
+		"a/b/c/d/e/.gitattributes",
+		"a/build/.gitattributes",
+		"a/lib/.gitattributes",
+	}, relativePaths(root, found))
+}
+
+func TestIsIgnoredDir(t *testing.T) {
+	ignores := map[string][]ignorePattern{
+		".": {{pattern: "node_modules"}, {pattern: "build", anchored: true}, {pattern: "*.tmp"}},
+		"a": {{pattern: "lib/generated", anchored: true}},
+	}
+
+	for rel, ignored := range map[string]bool{
+		"node_modules":         true,
+		"a/b/node_modules":     true,
+		"build":                true,
+		"a/build":              false,
+		"x.tmp":                true,
+		"a/x.tmp":              true,
+		"a/lib/generated":      true,
+		"lib/generated":        false,
+		"a/lib":                false,
+		"a":                    false,
+		"a/lib/generated/more": false,
+	} {
+		assert.Equal(t, ignored, isIgnoredDir(ignores, "/root", filepath.FromSlash(rel)), rel)
+	}
+}
+
+// writeDeepAttributesTree writes a repository with a few .gitattributes files,
+// and a large ignored node_modules directory, for the benchmarks.
+func writeDeepAttributesTree(b *testing.B) string {
+	files := map[string]string{
+		".gitattributes":     "*.dat filter=lfs\n",
+		".gitignore":         "node_modules/\n",
+		"a/b/.gitattributes": "*.bin filter=lfs\n",
+	}
+	for i := 0; i < 200; i++ {
+		for j := 0; j < 10; j++ {
+			files[fmt.Sprintf("node_modules/pkg%d/lib/dir%d/index.js", i, j)] = ""
+		}
+	}
+
+	root := writeAttributesTree(b, files)
+	require.Nil(b, exec.Command("git", "init", "-q", root).Run())
+	return root
+}
+
+func BenchmarkFindAttributeFilesWithGit(b *testing.B) {
+	root := writeDeepAttributesTree(b)
+	defer os.RemoveAll(root)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := git.GetAttributesFiles(root); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFindAttributeFilesByWalking(b *testing.B) {
+	root := writeDeepAttributesTree(b)
+	defer os.RemoveAll(root)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		walkAttributeFiles(root, filepath.Join(root, ".git"), nil)
+	}
+}
+
+func BenchmarkFindAttributeFilesByWalkingEverything(b *testing.B) {
+	root := writeDeepAttributesTree(b)
+	defer os.RemoveAll(root)
+	os.Remove(filepath.Join(root, ".gitignore"))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		walkAttributeFiles(root, filepath.Join(root, ".git"), nil)
+	}
+}
@@ -0,0 +1,9 @@
+// +build !windows
+
+package commands
+
+// fileIsBusy returns whether filename can't be written because another
+// program has it open or locked, which doesn't stop writes outside of Windows.
+func fileIsBusy(filename string) bool {
+	return false
+}
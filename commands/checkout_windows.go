@@ -0,0 +1,28 @@
+// +build windows
+
+package commands
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+// fileIsBusy returns whether filename can't be written because another
+// program has it open or locked.
+func fileIsBusy(filename string) bool {
+	f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err == nil {
+		f.Close()
+		return false
+	}
+
+	if perr, ok := err.(*os.PathError); ok {
+		return perr.Err == errorSharingViolation || perr.Err == errorLockViolation
+	}
+	return false
+}
@@ -5,12 +5,18 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/github/git-lfs/config"
 	"github.com/github/git-lfs/errors"
 	"github.com/github/git-lfs/git"
 	"github.com/github/git-lfs/lfs"
+	"github.com/github/git-lfs/metrics"
 	"github.com/github/git-lfs/progress"
+	"github.com/github/git-lfs/transfer"
 	"github.com/rubyist/tracerx"
 	"github.com/spf13/cobra"
 )
@@ -29,12 +35,23 @@ func checkoutCommand(cmd *cobra.Command, args []string) {
 	}
 	for _, arg := range args {
 		inchan <- arg
-		rootedpaths = append(rootedpaths, <-outchan)
+		rootedpaths = append(rootedpaths, rootedPattern(<-outchan))
 	}
 	close(inchan)
 	checkoutWithIncludeExclude(rootedpaths, nil)
 }
 
+// rootedPattern returns a pattern for the path "p", relative to the root of
+// the repository, which matches it and everything under it, but not files or
+// directories of the same name elsewhere.
+func rootedPattern(p string) string {
+	p = filepath.ToSlash(filepath.Clean(p))
+	if p == "." {
+		return p
+	}
+	return "/" + p
+}
+
 // Checkout from items reported from the fetch process (in parallel)
 func checkoutAllFromFetchChan(c chan *lfs.WrappedPointer) {
 	tracerx.Printf("starting fetch/parallel checkout")
@@ -53,9 +70,10 @@ func checkoutFromFetchChan(include []string, exclude []string, in chan *lfs.Wrap
 	}
 
 	// Map oid to multiple pointers
+	filter := fetchFilter(include, exclude)
 	mapping := make(map[string][]*lfs.WrappedPointer)
 	for _, pointer := range pointers {
-		if lfs.FilenamePassesIncludeExcludeFilter(pointer.Name, include, exclude) {
+		if filter(lfs.NewDownloadable(pointer)) {
 			mapping[pointer.Oid] = append(mapping[pointer.Oid], pointer)
 		}
 	}
@@ -67,7 +85,7 @@ func checkoutFromFetchChan(include []string, exclude []string, in chan *lfs.Wrap
 	wait.Add(1)
 
 	go func() {
-		checkoutWithChan(c)
+		checkoutWithChan(c, nil)
 		wait.Done()
 	}()
 
@@ -93,42 +111,41 @@ func checkoutWithIncludeExclude(include []string, exclude []string) {
 		Panic(err, "Could not scan for Git LFS files")
 	}
 
+	// Count bytes for progress
+	var totalBytes int64
+	for _, pointer := range pointers {
+		totalBytes += pointer.Size
+	}
+
+	logPath, _ := cfg.Os.Get("GIT_LFS_PROGRESS")
+	meter := progress.NewProgressMeter(len(pointers), totalBytes, false, quietProgress(), logPath)
+	meter.SetShowRate(true)
+	meter.Start()
+
 	var wait sync.WaitGroup
 	wait.Add(1)
 
 	c := make(chan *lfs.WrappedPointer, 1)
 
 	go func() {
-		checkoutWithChan(c)
+		checkoutWithChan(c, meter)
 		wait.Done()
 	}()
 
-	// Count bytes for progress
-	var totalBytes int64
-	for _, pointer := range pointers {
-		totalBytes += pointer.Size
-	}
-
-	logPath, _ := cfg.Os.Get("GIT_LFS_PROGRESS")
-	progress := progress.NewProgressMeter(len(pointers), totalBytes, false, logPath)
-	progress.Start()
-	totalBytes = 0
+	// Objects over lfs.fetchmaxsize are still checked out if they are
+	// local, so only the paths are filtered, as fetch filters them.
+	filter := lfs.NewPathFilter(include, exclude)
 	for _, pointer := range pointers {
-		totalBytes += pointer.Size
-		if lfs.FilenamePassesIncludeExcludeFilter(pointer.Name, include, exclude) {
-			progress.Add(pointer.Name)
+		if filter(lfs.NewDownloadable(pointer)) {
+			meter.Add(pointer.Name)
 			c <- pointer
-			// not strictly correct (parallel) but we don't have a callback & it's just local
-			// plus only 1 slot in channel so it'll block & be close
-			progress.TransferBytes("checkout", pointer.Name, pointer.Size, totalBytes, int(pointer.Size))
-			progress.FinishTransfer(pointer.Name)
 		} else {
-			progress.Skip(pointer.Size)
+			meter.Skip(pointer.Size)
 		}
 	}
 	close(c)
 	wait.Wait()
-	progress.Finish()
+	meter.Finish()
 
 }
 
@@ -136,14 +153,32 @@ func checkoutAll() {
 	checkoutWithIncludeExclude(nil, nil)
 }
 
+// checkoutJob is a pointer to check out, along with the path of its file
+// relative to the current directory.
+type checkoutJob struct {
+	pointer *lfs.WrappedPointer
+	cwdpath string
+	// incomplete is whether the file is listed as incomplete, and so may
+	// hold a placeholder to be replaced; see lfs.smudge.onerror.
+	incomplete bool
+	// completed is set once the object's content has been written to the
+	// file.
+	completed bool
+}
+
 // Populate the working copy with the real content of objects where the file is
 // either missing, or contains a matching pointer placeholder, from a list of pointers.
 // If the file exists but has other content it is left alone
+// Files are written by lfs.concurrentcheckouts workers at once, while the
+// index is updated for each written file by a single git update-index.
+// If meter is not nil, each file is finished in it as it is checked out.
 // Callers of this function MUST NOT Panic or otherwise exit the process
 // without waiting for this function to shut down.  If the process exits while
 // update-index is in the middle of processing a file the git index can be left
 // in a locked state.
-func checkoutWithChan(in <-chan *lfs.WrappedPointer) {
+func checkoutWithChan(in <-chan *lfs.WrappedPointer, meter *progress.ProgressMeter) {
+	defer metrics.Since(metrics.Checkout, time.Now())
+
 	// Get a converter from repo-relative to cwd-relative
 	// Since writing data & calling git update-index must be relative to cwd
 	repopathchan := make(chan string, 1)
@@ -152,6 +187,57 @@ func checkoutWithChan(in <-chan *lfs.WrappedPointer) {
 		Panic(err, "Could not convert file paths")
 	}
 
+	incomplete, err := loadIncompleteFiles(incompleteFilesPath())
+	if err != nil {
+		LoggedError(err, "Unable to read the list of incomplete files")
+	}
+
+	// Paths are converted one at a time, so do that before handing out the
+	// files to the workers. A file given twice is only written once, so
+	// that two workers never write the same file.
+	jobs := make(chan *checkoutJob)
+	go func() {
+		seen := make(map[string]bool)
+		for pointer := range in {
+			if seen[pointer.Name] {
+				continue
+			}
+			seen[pointer.Name] = true
+
+			repopathchan <- pointer.Name
+			f := incomplete[filepath.ToSlash(pointer.Name)]
+			jobs <- &checkoutJob{
+				pointer:    pointer,
+				cwdpath:    <-cwdpathchan,
+				incomplete: f != nil && f.Oid == pointer.Oid,
+			}
+		}
+		close(repopathchan)
+		close(jobs)
+	}()
+
+	manifest := TransferManifest()
+	locks := newOidLocks()
+	written := make(chan *checkoutJob)
+
+	var workers sync.WaitGroup
+	for i := 0; i < cfg.ConcurrentCheckouts(); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				if checkoutFile(job, manifest, locks, meter) {
+					written <- job
+				}
+			}
+		}()
+	}
+
+	go func() {
+		workers.Wait()
+		close(written)
+	}()
+
 	// Don't fire up the update-index command until we have at least one file to
 	// give it. Otherwise git interprets the lack of arguments to mean param-less update-index
 	// which can trigger entire working copy to be re-examined, which triggers clean filters
@@ -165,41 +251,11 @@ func checkoutWithChan(in <-chan *lfs.WrappedPointer) {
 	// while update-index is in the middle of updating, the index can remain in a
 	// locked state.
 
-	// As files come in, write them to the wd and update the index
-
-	manifest := TransferManifest()
-
-	for pointer := range in {
-
-		// Check the content - either missing or still this pointer (not exist is ok)
-		filepointer, err := lfs.DecodePointerFromFile(pointer.Name)
-		if err != nil && !os.IsNotExist(err) {
-			if errors.IsNotAPointerError(err) {
-				// File has non-pointer content, leave it alone
-				continue
-			}
-			LoggedError(err, "Problem accessing %v", pointer.Name)
-			continue
-		}
-
-		if filepointer != nil && filepointer.Oid != pointer.Oid {
-			// User has probably manually reset a file to another commit
-			// while leaving it a pointer; don't mess with this
-			continue
-		}
-
-		repopathchan <- pointer.Name
-		cwdfilepath := <-cwdpathchan
-
-		err = lfs.PointerSmudgeToFile(cwdfilepath, pointer.Pointer, false, manifest, nil)
-		if err != nil {
-			if errors.IsDownloadDeclinedError(err) {
-				// acceptable error, data not local (fetch not run or include/exclude)
-				LoggedError(err, "Skipped checkout for %v, content not local. Use fetch to download.", pointer.Name)
-			} else {
-				LoggedError(err, "Could not checkout file")
-				continue
-			}
+	// As files are written to the wd, update the index
+	var completed []string
+	for job := range written {
+		if job.completed && job.incomplete {
+			completed = append(completed, job.pointer.Name)
 		}
 
 		if cmd == nil {
@@ -218,9 +274,8 @@ func checkoutWithChan(in <-chan *lfs.WrappedPointer) {
 
 		}
 
-		updateIdxStdin.Write([]byte(cwdfilepath + "\n"))
+		updateIdxStdin.Write([]byte(job.cwdpath + "\n"))
 	}
-	close(repopathchan)
 
 	if cmd != nil && updateIdxStdin != nil {
 		updateIdxStdin.Close()
@@ -228,6 +283,163 @@ func checkoutWithChan(in <-chan *lfs.WrappedPointer) {
 			LoggedError(err, "Error updating the git index:\n%s", updateIdxOut.String())
 		}
 	}
+
+	forgetIncompleteFiles(completed)
+
+	updateLockablePermissions(nil)
+}
+
+// checkoutFile writes the content of a job's object to its file, if the file
+// is missing or still holds the pointer, or the placeholder smudge left if
+// the file is incomplete. It returns whether the file was written, and so
+// needs its index entry refreshing.
+func checkoutFile(job *checkoutJob, manifest *transfer.Manifest, locks *oidLocks, meter *progress.ProgressMeter) bool {
+	pointer := job.pointer
+	if meter != nil {
+		defer meter.FinishTransfer(pointer.Name)
+	}
+
+	if beyondSymlink(pointer.Name) {
+		// Git doesn't write through symbolic links either
+		Error("Skipped checkout for %v, its path is beyond a symbolic link.", pointer.Name)
+		return false
+	}
+
+	// Check the content - either missing or still this pointer (not exist is ok)
+	filepointer, err := lfs.DecodePointerFromFile(job.cwdpath)
+	if err != nil && !os.IsNotExist(err) {
+		if !errors.IsNotAPointerError(err) {
+			LoggedError(err, "Problem accessing %v", pointer.Name)
+			return false
+		}
+		if !job.incomplete || !isIncomplete(job.cwdpath, pointer.Pointer) {
+			// File has non-pointer content, leave it alone
+			return false
+		}
+		filepointer = nil
+	}
+
+	if filepointer != nil && filepointer.Oid != pointer.Oid {
+		// User has probably manually reset a file to another commit
+		// while leaving it a pointer; don't mess with this
+		return false
+	}
+
+	// Files with the same object may both be copied into the object store
+	// from a reference repository, so only write one at a time.
+	locks.Lock(pointer.Oid)
+	err = smudgeCheckoutFile(job.cwdpath, pointer.Pointer, manifest)
+	locks.Unlock(pointer.Oid)
+
+	if err != nil {
+		if errors.IsDownloadDeclinedError(err) {
+			// acceptable error, data not local (fetch not run or include/exclude)
+			LoggedError(err, "Skipped checkout for %v, content not local. Use fetch to download.", pointer.Name)
+		} else {
+			LoggedError(err, "Could not checkout file")
+			return false
+		}
+	} else {
+		job.completed = true
+		if meter != nil {
+			meter.TransferBytes("checkout", pointer.Name, pointer.Size, pointer.Size, int(pointer.Size))
+		}
+	}
+
+	return true
+}
+
+const (
+	// checkoutRetries is how many more times a file which is busy is
+	// written, starting checkoutRetryWait after the first attempt and
+	// doubling the wait each time.
+	checkoutRetries   = 5
+	checkoutRetryWait = 100 * time.Millisecond
+)
+
+// smudgeCheckoutFile writes the object of ptr to filename. A file which is
+// already there keeps its mode, even if it has been made read-only, and a file
+// which is busy, as files open in other programs can be on Windows, is retried.
+func smudgeCheckoutFile(filename string, ptr *lfs.Pointer, manifest *transfer.Manifest) error {
+	if fi, err := os.Stat(filename); err == nil && fi.Mode().Perm()&0200 == 0 {
+		mode := fi.Mode().Perm()
+		if err := os.Chmod(filename, mode|0200); err != nil {
+			return err
+		}
+
+		// Hard linked files share their mode with the object, and are
+		// kept read-only anyway.
+		if !cfg.HardLinkCheckout() {
+			defer os.Chmod(filename, mode)
+		}
+	}
+
+	wait := checkoutRetryWait
+	for attempt := 0; ; attempt++ {
+		err := lfs.PointerSmudgeToFile(filename, ptr, false, manifest, nil)
+		if err == nil || attempt == checkoutRetries || !fileIsBusy(filename) {
+			return err
+		}
+
+		tracerx.Printf("checkout: %s is busy, retrying in %s", filename, wait)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// beyondSymlink returns whether any of the directories leading to the
+// repo-relative path name are symbolic links.
+func beyondSymlink(name string) bool {
+	dir := config.LocalWorkingDir
+	parts := strings.Split(filepath.ToSlash(filepath.Dir(name)), "/")
+	for _, part := range parts {
+		if part == "." || len(part) == 0 {
+			continue
+		}
+
+		dir = filepath.Join(dir, part)
+		fi, err := os.Lstat(dir)
+		if err != nil {
+			return false
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// oidLocks holds a lock for each object, so that files with the same object
+// are checked out one at a time.
+type oidLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func newOidLocks() *oidLocks {
+	return &oidLocks{locks: make(map[string]*sync.Mutex)}
+}
+
+func (l *oidLocks) lock(oid string) *sync.Mutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m, ok := l.locks[oid]
+	if !ok {
+		m = &sync.Mutex{}
+		l.locks[oid] = m
+	}
+	return m
+}
+
+// Lock waits until no other file with the object oid is being checked out.
+func (l *oidLocks) Lock(oid string) {
+	l.lock(oid).Lock()
+}
+
+// Unlock lets the next file with the object oid be checked out.
+func (l *oidLocks) Unlock(oid string) {
+	l.lock(oid).Unlock()
 }
 
 func init() {
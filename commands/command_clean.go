@@ -1,9 +1,13 @@
 package commands
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
 	"os"
 
 	"github.com/github/git-lfs/errors"
+	"github.com/github/git-lfs/git"
 	"github.com/github/git-lfs/lfs"
 	"github.com/github/git-lfs/progress"
 	"github.com/spf13/cobra"
@@ -13,6 +17,23 @@ func cleanCommand(cmd *cobra.Command, args []string) {
 	requireStdin("This command should be run by the Git 'clean' filter")
 	lfs.InstallHooks(false)
 
+	// A file which smudge left as a placeholder cleans back to the pointer
+	// it stands for, rather than to a new object holding the placeholder.
+	// Read as much as lfs.PointerClean checks for a pointer, so that it
+	// still sees all of it in one read.
+	head, err := ioutil.ReadAll(io.LimitReader(os.Stdin, 1024))
+	if err != nil {
+		Panic(err, "Error cleaning asset.")
+	}
+	if ptr := placeholderPointer(head); ptr != nil {
+		var fileName string
+		if len(args) > 0 {
+			fileName = args[0]
+		}
+		os.Stdout.Write(placeholderPointerBytes(fileName, ptr))
+		return
+	}
+
 	var fileName string
 	var cb progress.CopyCallback
 	var file *os.File
@@ -34,7 +55,8 @@ func cleanCommand(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	cleaned, err := lfs.PointerClean(os.Stdin, fileName, fileSize, cb)
+	stdin := io.MultiReader(bytes.NewReader(head), os.Stdin)
+	cleaned, err := lfs.PointerClean(stdin, fileName, fileSize, cb)
 	if file != nil {
 		file.Close()
 	}
@@ -74,6 +96,22 @@ func cleanCommand(cmd *cobra.Command, args []string) {
 	lfs.EncodePointer(os.Stdout, cleaned.Pointer)
 }
 
+// placeholderPointerBytes returns the pointer which the placeholder of "ptr"
+// in "fileName" stands for: the one staged for the file if it has the same
+// object, so that its extensions are kept, and "ptr" otherwise.
+func placeholderPointerBytes(fileName string, ptr *lfs.Pointer) []byte {
+	if len(fileName) > 0 {
+		if by, err := git.StagedBlob(fileName, 1024); err == nil && by != nil {
+			staged, err := lfs.DecodePointer(bytes.NewReader(by))
+			if err == nil && staged.Oid == ptr.Oid && staged.Size == ptr.Size {
+				return by
+			}
+		}
+	}
+
+	return []byte(ptr.Encoded())
+}
+
 func init() {
 	RegisterCommand("clean", cleanCommand, nil)
 }
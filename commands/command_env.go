@@ -1,12 +1,67 @@
 package commands
 
 import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+
 	"github.com/github/git-lfs/config"
 	"github.com/github/git-lfs/git"
 	"github.com/github/git-lfs/lfs"
+	"github.com/github/git-lfs/transfer"
 	"github.com/spf13/cobra"
 )
 
+var (
+	envJSONFlag = false
+)
+
+// envEndpoint is an endpoint listed by `git lfs env --json`. Its URL has had
+// any credentials redacted.
+type envEndpoint struct {
+	Remote string `json:"remote,omitempty"`
+	Url    string `json:"url"`
+	Auth   string `json:"auth"`
+	SSH    string `json:"ssh,omitempty"`
+}
+
+// envInfo is the environment written by `git lfs env --json`.
+type envInfo struct {
+	Version    string        `json:"version"`
+	GitVersion string        `json:"git_version"`
+	Endpoint   *envEndpoint  `json:"endpoint,omitempty"`
+	Remotes    []envEndpoint `json:"remotes"`
+
+	LocalWorkingDir    string `json:"local_working_dir"`
+	LocalGitDir        string `json:"local_git_dir"`
+	LocalGitStorageDir string `json:"local_git_storage_dir"`
+	LocalMediaDir      string `json:"local_media_dir"`
+	LocalReferenceDir  string `json:"local_reference_dir"`
+	TempDir            string `json:"temp_dir"`
+
+	ConcurrentTransfers    int `json:"concurrent_transfers"`
+	ConcurrentDownloads    int `json:"concurrent_downloads"`
+	ConcurrentUploads      int `json:"concurrent_uploads"`
+	TransferAPIConcurrency int `json:"transfer_api_concurrency"`
+
+	// DownloadTransfers and UploadTransfers are the names of the transfer
+	// adapters registered for each direction, including custom ones.
+	DownloadTransfers []string `json:"download_transfers"`
+	UploadTransfers   []string `json:"upload_transfers"`
+
+	FetchInclude []string `json:"fetch_include"`
+	FetchExclude []string `json:"fetch_exclude"`
+	// SkipSmudge is whether objects aren't downloaded when files are
+	// checked out, because of GIT_LFS_SKIP_SMUDGE or
+	// `git lfs install --skip-smudge`.
+	SkipSmudge bool `json:"skip_smudge"`
+
+	GitConfig map[string]string `json:"git_config"`
+	// GitEnv holds the environment variables which configure Git.
+	GitEnv map[string]string `json:"git_env"`
+}
+
 func envCommand(cmd *cobra.Command, args []string) {
 	config.ShowConfigWarnings = true
 	endpoint := cfg.Endpoint("download")
@@ -16,12 +71,20 @@ func envCommand(cmd *cobra.Command, args []string) {
 		gitV = "Error getting git version: " + err.Error()
 	}
 
+	if envJSONFlag {
+		info := newEnvInfo(gitV, TransferManifest())
+		if err := json.NewEncoder(os.Stdout).Encode(info); err != nil {
+			ExitWithError(err)
+		}
+		return
+	}
+
 	Print(config.VersionDesc)
 	Print(gitV)
 	Print("")
 
 	if len(endpoint.Url) > 0 {
-		Print("Endpoint=%s (auth=%s)", endpoint.Url, cfg.EndpointAccess(endpoint))
+		Print("Endpoint=%s (auth=%s)", config.RedactURL(endpoint.Url), cfg.EndpointAccess(endpoint))
 		if len(endpoint.SshUserAndHost) > 0 {
 			Print("  SSH=%s:%s", endpoint.SshUserAndHost, endpoint.SshPath)
 		}
@@ -29,7 +92,7 @@ func envCommand(cmd *cobra.Command, args []string) {
 
 	for _, remote := range cfg.Remotes() {
 		remoteEndpoint := cfg.RemoteEndpoint(remote, "download")
-		Print("Endpoint (%s)=%s (auth=%s)", remote, remoteEndpoint.Url, cfg.EndpointAccess(remoteEndpoint))
+		Print("Endpoint (%s)=%s (auth=%s)", remote, config.RedactURL(remoteEndpoint.Url), cfg.EndpointAccess(remoteEndpoint))
 		if len(remoteEndpoint.SshUserAndHost) > 0 {
 			Print("  SSH=%s:%s", remoteEndpoint.SshUserAndHost, remoteEndpoint.SshPath)
 		}
@@ -45,6 +108,87 @@ func envCommand(cmd *cobra.Command, args []string) {
 	}
 }
 
+// newEnvInfo gathers the environment for `git lfs env --json`, listing the
+// adapters registered with "manifest".
+func newEnvInfo(gitVersion string, manifest *transfer.Manifest) *envInfo {
+	info := &envInfo{
+		Version:                config.VersionDesc,
+		GitVersion:             gitVersion,
+		Remotes:                make([]envEndpoint, 0),
+		LocalWorkingDir:        config.LocalWorkingDir,
+		LocalGitDir:            config.LocalGitDir,
+		LocalGitStorageDir:     config.LocalGitStorageDir,
+		LocalMediaDir:          lfs.LocalMediaDir(),
+		LocalReferenceDir:      config.LocalReferenceDir,
+		TempDir:                lfs.TempDir(),
+		ConcurrentTransfers:    cfg.ConcurrentTransfers(),
+		ConcurrentDownloads:    cfg.DirectionalConcurrentTransfers("download"),
+		ConcurrentUploads:      cfg.DirectionalConcurrentTransfers("upload"),
+		TransferAPIConcurrency: cfg.TransferAPIConcurrency(),
+		DownloadTransfers:      sortedAdapterNames(manifest, transfer.Download),
+		UploadTransfers:        sortedAdapterNames(manifest, transfer.Upload),
+		FetchInclude:           nonNilStrings(cfg.FetchIncludePaths()),
+		FetchExclude:           nonNilStrings(cfg.FetchExcludePaths()),
+		GitConfig:              make(map[string]string),
+		GitEnv:                 make(map[string]string),
+	}
+
+	if e := cfg.Endpoint("download"); len(e.Url) > 0 {
+		endpoint := newEnvEndpoint("", e)
+		info.Endpoint = &endpoint
+	}
+	for _, remote := range cfg.Remotes() {
+		info.Remotes = append(info.Remotes, newEnvEndpoint(remote, cfg.RemoteEndpoint(remote, "download")))
+	}
+
+	for _, key := range []string{"filter.lfs.smudge", "filter.lfs.clean"} {
+		info.GitConfig[key], _ = cfg.Git.Get(key)
+	}
+	info.SkipSmudge = cfg.Os.Bool("GIT_LFS_SKIP_SMUDGE", false) ||
+		strings.Contains(info.GitConfig["filter.lfs.smudge"], "--skip")
+
+	for _, e := range os.Environ() {
+		if parts := strings.SplitN(e, "=", 2); len(parts) == 2 && strings.Contains(parts[0], "GIT_") {
+			info.GitEnv[parts[0]] = parts[1]
+		}
+	}
+
+	return info
+}
+
+// newEnvEndpoint describes the endpoint "e" of "remote", which is empty for the
+// default endpoint, redacting any credentials in its URL.
+func newEnvEndpoint(remote string, e config.Endpoint) envEndpoint {
+	endpoint := envEndpoint{
+		Remote: remote,
+		Url:    config.RedactURL(e.Url),
+		Auth:   cfg.EndpointAccess(e),
+	}
+	if len(e.SshUserAndHost) > 0 {
+		endpoint.SSH = e.SshUserAndHost + ":" + e.SshPath
+	}
+	return endpoint
+}
+
+// sortedAdapterNames returns the names of the adapters registered with
+// "manifest" for the direction "dir", sorted.
+func sortedAdapterNames(manifest *transfer.Manifest, dir transfer.Direction) []string {
+	names := nonNilStrings(manifest.GetAdapterNames(dir))
+	sort.Strings(names)
+	return names
+}
+
+// nonNilStrings returns "s", or an empty slice if it is nil, so that it is
+// written to JSON as an empty array rather than null.
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
 func init() {
-	RegisterCommand("env", envCommand, nil)
+	RegisterCommand("env", envCommand, func(cmd *cobra.Command) {
+		cmd.Flags().BoolVarP(&envJSONFlag, "json", "j", false, "print the environment as JSON")
+	})
 }
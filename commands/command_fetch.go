@@ -2,11 +2,15 @@ package commands
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/github/git-lfs/config"
 	"github.com/github/git-lfs/git"
 	"github.com/github/git-lfs/lfs"
 	"github.com/github/git-lfs/progress"
+	"github.com/github/git-lfs/tools"
 	"github.com/rubyist/tracerx"
 	"github.com/spf13/cobra"
 )
@@ -15,6 +19,14 @@ var (
 	fetchRecentArg bool
 	fetchAllArg    bool
 	fetchPruneArg  bool
+	fetchDryRunArg bool
+	fetchJSONArg   bool
+	fetchSinceArg  string
+
+	fetchRecentRefsDaysArg int
+
+	// fetchReport collects the objects a --dry-run would have fetched
+	fetchReport *dryRunReport
 )
 
 func getIncludeExcludeArgs(cmd *cobra.Command) (include, exclude *string) {
@@ -45,6 +57,10 @@ func fetchCommand(cmd *cobra.Command, args []string) {
 		cfg.CurrentRemote = ""
 	}
 
+	if err := setEndpointOverride(cfg, endpointArg); err != nil {
+		Exit(err.Error())
+	}
+
 	if len(args) > 1 {
 		resolvedrefs, err := git.ResolveRefs(args[1:])
 		if err != nil {
@@ -59,18 +75,22 @@ func fetchCommand(cmd *cobra.Command, args []string) {
 		refs = []*git.Ref{ref}
 	}
 
+	if fetchDryRunArg {
+		fetchReport = newDryRunReport("fetch")
+	}
+
 	success := true
 	include, exclude := getIncludeExcludeArgs(cmd)
 
 	if fetchAllArg {
-		if fetchRecentArg || len(args) > 1 {
+		if fetchRecentArg || len(args) > 1 || len(fetchSinceArg) > 0 || cmd.Flag("recent-refs-days").Changed {
 			Exit("Cannot combine --all with ref arguments or --recent")
 		}
 		if include != nil || exclude != nil {
 			Exit("Cannot combine --all with --include or --exclude")
 		}
 		if len(cfg.FetchIncludePaths()) > 0 || len(cfg.FetchExcludePaths()) > 0 {
-			Print("Ignoring global include / exclude paths to fulfil --all")
+			fetchStatus("Ignoring global include / exclude paths to fulfil --all")
 		}
 		success = fetchAll()
 
@@ -79,13 +99,29 @@ func fetchCommand(cmd *cobra.Command, args []string) {
 
 		// Fetch refs sequentially per arg order; duplicates in later refs will be ignored
 		for _, ref := range refs {
-			Print("Fetching %v", ref.Name)
+			fetchStatus("Fetching %v", ref.Name)
 			s := fetchRef(ref.Sha, includePaths, excludePaths)
 			success = success && s
 		}
 
-		if fetchRecentArg || cfg.FetchPruneConfig().FetchRecentAlways {
-			s := fetchRecent(refs, includePaths, excludePaths)
+		fetchconf := cfg.FetchPruneConfig()
+		if cmd.Flag("recent-refs-days").Changed {
+			fetchconf.FetchRecentRefsDays = fetchRecentRefsDaysArg
+		}
+
+		// Previous versions are fetched back to --since, if it is given,
+		// rather than for the configured number of days.
+		var since time.Time
+		if len(fetchSinceArg) > 0 {
+			t, err := git.ParseApproxDate(fetchSinceArg)
+			if err != nil {
+				Exit("Invalid --since date %q: %v", fetchSinceArg, err)
+			}
+			since = t
+		}
+
+		if fetchRecentArg || fetchconf.FetchRecentAlways || !since.IsZero() || cmd.Flag("recent-refs-days").Changed {
+			s := fetchRecent(fetchconf, since, refs, includePaths, excludePaths)
 			success = success && s
 		}
 	}
@@ -93,8 +129,14 @@ func fetchCommand(cmd *cobra.Command, args []string) {
 	if fetchPruneArg {
 		fetchconf := cfg.FetchPruneConfig()
 		verify := fetchconf.PruneVerifyRemoteAlways
-		// no dry-run or verbose options in fetch, assume false
-		prune(fetchconf, verify, false, false)
+		// no verbose option in fetch, assume false
+		prune(fetchconf, verify, fetchDryRunArg, false, false, nil)
+	}
+
+	if fetchReport != nil {
+		if err := fetchReport.Write(OutputWriter, fetchJSONArg); err != nil {
+			ExitWithError(err)
+		}
 	}
 
 	if !success {
@@ -141,23 +183,19 @@ func fetchPreviousVersions(ref string, since time.Time, include, exclude []strin
 	return fetchPointers(pointers, include, exclude)
 }
 
-// Fetch recent objects based on config
-func fetchRecent(alreadyFetchedRefs []*git.Ref, include, exclude []string) bool {
-	fetchconf := cfg.FetchPruneConfig()
-
-	if fetchconf.FetchRecentRefsDays == 0 && fetchconf.FetchRecentCommitsDays == 0 {
-		return true
-	}
-
+// Fetch recent objects based on config. Previous versions of objects are
+// fetched back to "since" if it isn't zero, or otherwise for the number of days
+// configured for each ref.
+func fetchRecent(fetchconf config.FetchPruneConfig, since time.Time, alreadyFetchedRefs []*git.Ref, include, exclude []string) bool {
 	ok := true
 	// Make a list of what unique commits we've already fetched for to avoid duplicating work
-	uniqueRefShas := make(map[string]string, len(alreadyFetchedRefs))
+	uniqueRefShas := make(map[string]*git.Ref, len(alreadyFetchedRefs))
 	for _, ref := range alreadyFetchedRefs {
-		uniqueRefShas[ref.Sha] = ref.Name
+		uniqueRefShas[ref.Sha] = ref
 	}
 	// First find any other recent refs
 	if fetchconf.FetchRecentRefsDays > 0 {
-		Print("Fetching recent branches within %v days", fetchconf.FetchRecentRefsDays)
+		fetchStatus("Fetching recent branches within %v days", fetchconf.FetchRecentRefsDays)
 		refsSince := time.Now().AddDate(0, 0, -fetchconf.FetchRecentRefsDays)
 		refs, err := git.RecentBranches(refsSince, fetchconf.FetchRecentRefsIncludeRemotes, cfg.CurrentRemote)
 		if err != nil {
@@ -165,40 +203,63 @@ func fetchRecent(alreadyFetchedRefs []*git.Ref, include, exclude []string) bool
 		}
 		for _, ref := range refs {
 			// Don't fetch for the same SHA twice
-			if prevRefName, ok := uniqueRefShas[ref.Sha]; ok {
-				if ref.Name != prevRefName {
-					tracerx.Printf("Skipping fetch for %v, already fetched via %v", ref.Name, prevRefName)
+			if prevRef, ok := uniqueRefShas[ref.Sha]; ok {
+				if ref.Name != prevRef.Name {
+					tracerx.Printf("Skipping fetch for %v, already fetched via %v", ref.Name, prevRef.Name)
 				}
 			} else {
-				uniqueRefShas[ref.Sha] = ref.Name
-				Print("Fetching %v", ref.Name)
+				uniqueRefShas[ref.Sha] = ref
+				fetchStatus("Fetching %v", ref.Name)
 				k := fetchRef(ref.Sha, include, exclude)
 				ok = ok && k
 			}
 		}
 	}
 	// For every unique commit we've fetched, check recent commits too
-	if fetchconf.FetchRecentCommitsDays > 0 {
-		for commit, refName := range uniqueRefShas {
-			// We measure from the last commit at the ref
-			summ, err := git.GetCommitSummary(commit)
-			if err != nil {
-				Error("Couldn't scan commits at %v: %v", refName, err)
-				continue
-			}
-			Print("Fetching changes within %v days of %v", fetchconf.FetchRecentCommitsDays, refName)
-			commitsSince := summ.CommitDate.AddDate(0, 0, -fetchconf.FetchRecentCommitsDays)
-			k := fetchPreviousVersions(commit, commitsSince, include, exclude)
+	for commit, ref := range uniqueRefShas {
+		if !since.IsZero() {
+			fetchStatus("Fetching changes since %v on %v", since.Format("2006-01-02 15:04:05"), ref.Name)
+			k := fetchPreviousVersions(commit, since, include, exclude)
 			ok = ok && k
+			continue
 		}
 
+		days := recentCommitsDays(ref)
+		if days == 0 {
+			continue
+		}
+
+		// We measure from the last commit at the ref
+		summ, err := git.GetCommitSummary(commit)
+		if err != nil {
+			Error("Couldn't scan commits at %v: %v", ref.Name, err)
+			continue
+		}
+		fetchStatus("Fetching changes within %v days of %v", days, ref.Name)
+		commitsSince := summ.CommitDate.AddDate(0, 0, -days)
+		k := fetchPreviousVersions(commit, commitsSince, include, exclude)
+		ok = ok && k
 	}
 	return ok
 }
 
+// recentCommitsDays returns the number of days before the latest commit on
+// "ref" for which previous versions of objects are fetched and kept, from the
+// lfs.fetchrecent.<pattern>.days that matches its branch name, if any.
+// Remote branches are matched without the name of their remote.
+func recentCommitsDays(ref *git.Ref) int {
+	name := ref.Name
+	if ref.Type == git.RefTypeRemoteBranch {
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[i+1:]
+		}
+	}
+	return cfg.FetchRecentCommitsDaysFor(name)
+}
+
 func fetchAll() bool {
 	pointers := scanAll()
-	Print("Fetching objects...")
+	fetchStatus("Fetching objects...")
 	return fetchPointers(pointers, nil, nil)
 }
 
@@ -210,7 +271,7 @@ func scanAll() []*lfs.WrappedPointer {
 	opts.SkipDeletedBlobs = false
 
 	// This could be a long process so use the chan version & report progress
-	Print("Scanning for all objects ever referenced...")
+	fetchStatus("Scanning for all objects ever referenced...")
 	spinner := progress.NewSpinner()
 	var numObjs int64
 	pointerchan, err := lfs.ScanRefsToChan("", "", opts)
@@ -219,10 +280,19 @@ func scanAll() []*lfs.WrappedPointer {
 	}
 
 	pointers := make([]*lfs.WrappedPointer, 0)
+	// rev-list lists each blob once, but different pointer blobs can still
+	// refer to the same object, e.g. with other extensions; fetch it once
+	seen := tools.NewStringSet()
 
+	quiet := quietProgress()
 	for p := range pointerchan.Results {
+		if !seen.Add(p.Oid) {
+			continue
+		}
 		numObjs++
-		spinner.Print(OutputWriter, fmt.Sprintf("%d objects found", numObjs))
+		if !quiet {
+			spinner.Print(OutputWriter, fmt.Sprintf("%d objects found", numObjs))
+		}
 		pointers = append(pointers, p)
 	}
 	err = pointerchan.Wait()
@@ -230,10 +300,24 @@ func scanAll() []*lfs.WrappedPointer {
 		Panic(err, "Could not scan for Git LFS files")
 	}
 
-	spinner.Finish(OutputWriter, fmt.Sprintf("%d objects found", numObjs))
+	if quiet {
+		fetchStatus("%d objects found", numObjs)
+	} else {
+		spinner.Finish(OutputWriter, fmt.Sprintf("%d objects found", numObjs))
+	}
 	return pointers
 }
 
+// fetchStatus prints a status message. During a dry run these are written to
+// stderr, so that stdout only contains the report.
+func fetchStatus(format string, args ...interface{}) {
+	if fetchDryRunArg {
+		Error(format, args...)
+		return
+	}
+	Print(format, args...)
+}
+
 func fetchPointers(pointers []*lfs.WrappedPointer, include, exclude []string) bool {
 	return fetchAndReportToChan(pointers, include, exclude, nil)
 }
@@ -251,8 +335,18 @@ func fetchAndReportToChan(allpointers []*lfs.WrappedPointer, include, exclude []
 		cfg.CurrentRemote = defaultRemote
 	}
 
-	ready, pointers, totalSize := readyAndMissingPointers(allpointers, include, exclude)
-	q := lfs.NewDownloadQueue(len(pointers), totalSize, false)
+	filter := fetchFilter(include, exclude)
+	ready, pointers, totalSize := readyAndMissingPointers(allpointers, filter)
+	q := lfs.NewDownloadQueue(len(pointers), totalSize, fetchReport != nil)
+	if quietArg {
+		q.SetQuiet()
+	}
+	q.SetFilter(filter)
+	if fetchReport != nil {
+		q.SetDryRunCallback(fetchReport.Add)
+	} else {
+		setFetchJournal(q)
+	}
 
 	if out != nil {
 		// If we already have it, or it won't be fetched
@@ -293,6 +387,7 @@ func fetchAndReportToChan(allpointers []*lfs.WrappedPointer, include, exclude []
 	processQueue := time.Now()
 	q.Wait()
 	tracerx.PerformanceSince("process queue", processQueue)
+	warnIfLegacyFallback(q)
 
 	ok := true
 	for _, err := range q.Errors() {
@@ -302,32 +397,73 @@ func fetchAndReportToChan(allpointers []*lfs.WrappedPointer, include, exclude []
 	return ok
 }
 
-func readyAndMissingPointers(allpointers []*lfs.WrappedPointer, include, exclude []string) ([]*lfs.WrappedPointer, []*lfs.WrappedPointer, int64) {
+// setFetchJournal gives "q" the journal kept in lfs.transfer.statefile, if it
+// is set, so that if this fetch is interrupted, the next can skip the objects
+// which it downloaded. A relative path is taken from the .git directory.
+func setFetchJournal(q *lfs.TransferQueue) {
+	path := cfg.TransferStateFile()
+	if len(path) == 0 {
+		return
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(config.LocalGitStorageDir, path)
+	}
+
+	j, err := lfs.OpenTransferJournal(path)
+	if err != nil {
+		Error("Not resuming from %s: %s", path, err)
+		return
+	}
+	q.SetJournal(j)
+}
+
+// readyAndMissingPointers splits "allpointers" into those whose objects are
+// already present locally and those which need to be downloaded, reporting
+// each object only once. Pointers which are ready but rejected by "filter" are
+// dropped; missing ones are left for the transfer queue to skip.
+// fetchFilter returns the filter deciding which objects are fetched for the
+// given include and exclude patterns, which smudge and checkout use too, so
+// that they write out the same files as fetch downloads.
+func fetchFilter(include, exclude []string) lfs.TransferFilter {
+	return lfs.NewFetchFilter(include, exclude, cfg.FetchMaxSize())
+}
+
+func readyAndMissingPointers(allpointers []*lfs.WrappedPointer, filter lfs.TransferFilter) ([]*lfs.WrappedPointer, []*lfs.WrappedPointer, int64) {
 	size := int64(0)
 	seen := make(map[string]bool, len(allpointers))
+	missingIdx := make(map[string]int, len(allpointers))
 	missing := make([]*lfs.WrappedPointer, 0, len(allpointers))
 	ready := make([]*lfs.WrappedPointer, 0, len(allpointers))
 
 	for _, p := range allpointers {
-		// Filtered out by --include or --exclude
-		if !lfs.FilenamePassesIncludeExcludeFilter(p.Name, include, exclude) {
+		passes := filter(lfs.NewDownloadable(p))
+
+		// no need to download the same object multiple times, but prefer
+		// a path which passes the filter so it is fetched if any of the
+		// files referencing it are wanted
+		if idx, ok := missingIdx[p.Oid]; ok {
+			if passes && !filter(lfs.NewDownloadable(missing[idx])) {
+				missing[idx] = p
+			}
 			continue
 		}
 
-		// no need to download the same object multiple times
 		if seen[p.Oid] {
 			continue
 		}
 
-		seen[p.Oid] = true
-
 		// no need to download objects that exist locally already
 		lfs.LinkOrCopyFromReference(p.Oid, p.Size)
 		if lfs.ObjectExistsOfSize(p.Oid, p.Size) {
-			ready = append(ready, p)
+			if passes {
+				seen[p.Oid] = true
+				ready = append(ready, p)
+			}
 			continue
 		}
 
+		seen[p.Oid] = true
+		missingIdx[p.Oid] = len(missing)
 		missing = append(missing, p)
 		size += p.Size
 	}
@@ -340,7 +476,13 @@ func init() {
 		cmd.Flags().StringVarP(&includeArg, "include", "I", "", "Include a list of paths")
 		cmd.Flags().StringVarP(&excludeArg, "exclude", "X", "", "Exclude a list of paths")
 		cmd.Flags().BoolVarP(&fetchRecentArg, "recent", "r", false, "Fetch recent refs & commits")
+		cmd.Flags().StringVar(&fetchSinceArg, "since", "", "With --recent, fetch previous versions of objects back to this date")
+		cmd.Flags().IntVar(&fetchRecentRefsDaysArg, "recent-refs-days", 0, "With --recent, fetch refs with commits within this many days")
 		cmd.Flags().BoolVarP(&fetchAllArg, "all", "a", false, "Fetch all LFS files ever referenced")
 		cmd.Flags().BoolVarP(&fetchPruneArg, "prune", "p", false, "After fetching, prune old data")
+		cmd.Flags().BoolVarP(&fetchDryRunArg, "dry-run", "d", false, "Report which objects would be fetched without downloading them")
+		cmd.Flags().BoolVarP(&fetchJSONArg, "json", "j", false, "Print the --dry-run report as JSON")
+		cmd.Flags().BoolVarP(&quietArg, "quiet", "q", false, "Print a summary instead of a progress bar")
+		cmd.Flags().StringVar(&endpointArg, "endpoint", "", endpointArgHelp)
 	})
 }
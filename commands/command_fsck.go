@@ -6,116 +6,339 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
 
 	"github.com/github/git-lfs/config"
 	"github.com/github/git-lfs/git"
 	"github.com/github/git-lfs/lfs"
+	"github.com/github/git-lfs/progress"
 	"github.com/spf13/cobra"
 )
 
 var (
-	fsckDryRun bool
+	fsckDryRun       bool
+	fsckFix          bool
+	fsckObjectsOnly  bool
+	fsckPointersOnly bool
 )
 
-func doFsck() (bool, error) {
+// fsckIssue is an object which fsck found to be missing or corrupt.
+type fsckIssue struct {
+	Oid  string
+	Name string // the name of a file in HEAD or the index with the object, if any
+	// Actual is the OID of a corrupt object's content, and empty if the
+	// object is missing.
+	Actual string
+}
+
+// fsckObject is an object in the local media directory to re-hash.
+type fsckObject struct {
+	Oid  string
+	Size int64
+}
+
+func doFsck() ([]*fsckIssue, error) {
 	requireInRepo()
 
-	ref, err := git.CurrentRef()
-	if err != nil {
-		return false, err
+	// The names of files in HEAD and the index, by OID, for messages.
+	pointerIndex := make(map[string]string)
+	if !fsckObjectsOnly {
+		ref, err := git.CurrentRef()
+		if err != nil {
+			return nil, err
+		}
+
+		pointers, err := lfs.ScanRefs(ref.Sha, "", nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range pointers {
+			pointerIndex[p.Oid] = p.Name
+		}
+
+		// TODO(zeroshirts): do we want to look for LFS stuff in past commits?
+		p2, err := lfs.ScanIndex()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range p2 {
+			pointerIndex[p.Oid] = p.Name
+		}
 	}
 
-	// The LFS scanner methods return unexported *lfs.wrappedPointer objects.
-	// All we care about is the pointer OID and file name
-	pointerIndex := make(map[string]string)
+	var issues []*fsckIssue
+	var objects []*fsckObject
 
-	pointers, err := lfs.ScanRefs(ref.Sha, "", nil)
+	if fsckPointersOnly {
+		for oid, name := range pointerIndex {
+			Debug("Examining %v (%v)", name, lfs.LocalMediaPathReadOnly(oid))
+
+			fi, err := os.Stat(lfs.LocalMediaPathReadOnly(oid))
+			if err != nil {
+				if pErr, ok := err.(*os.PathError); ok {
+					Print("Object %s (%s) could not be checked: %s", name, oid, pErr.Err)
+					issues = append(issues, &fsckIssue{Oid: oid, Name: name})
+					continue
+				}
+				return nil, err
+			}
+			objects = append(objects, &fsckObject{Oid: oid, Size: fi.Size()})
+		}
+	} else {
+		for obj := range lfs.ScanObjectsChan() {
+			objects = append(objects, &fsckObject{Oid: obj.Oid, Size: obj.Size})
+		}
+
+		for oid, name := range pointerIndex {
+			if !objectExists(oid) {
+				Print("Object %s (%s) could not be checked: %s", name, oid, os.ErrNotExist)
+				issues = append(issues, &fsckIssue{Oid: oid, Name: name})
+			}
+		}
+	}
+
+	corrupt, err := fsckHashObjects(objects)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	for _, issue := range corrupt {
+		issue.Name = pointerIndex[issue.Oid]
+		if len(issue.Name) > 0 {
+			Print("Object %s (%s) is corrupt, its content has OID %s", issue.Name, issue.Oid, issue.Actual)
+		} else {
+			Print("Object %s is corrupt, its content has OID %s", issue.Oid, issue.Actual)
+		}
+		issues = append(issues, issue)
+
+		if fsckDryRun {
+			continue
+		}
+
+		badDir := filepath.Join(config.LocalGitStorageDir, "lfs", "bad")
+		if err := os.MkdirAll(badDir, 0755); err != nil {
+			return nil, err
+		}
+
+		badFile := filepath.Join(badDir, issue.Oid)
+		if err := os.Rename(lfs.LocalMediaPathReadOnly(issue.Oid), badFile); err != nil {
+			return nil, err
+		}
+		Print("  moved to %s", badFile)
+	}
+
+	return issues, nil
+}
+
+// objectExists returns whether the object with the given OID is in the local
+// media directory, whatever its size.
+func objectExists(oid string) bool {
+	_, err := os.Stat(lfs.LocalMediaPathReadOnly(oid))
+	return err == nil
+}
+
+// fsckHashObjects re-hashes the given objects, with a worker for each CPU, and
+// returns those whose content doesn't match their OID, sorted by OID.
+func fsckHashObjects(objects []*fsckObject) ([]*fsckIssue, error) {
+	var meter *progress.ProgressMeter
+	if !quietProgress() {
+		var totalSize int64
+		for _, obj := range objects {
+			totalSize += obj.Size
+		}
+		meter = progress.NewProgressMeter(len(objects), totalSize, false, false, "")
+		meter.Start()
 	}
 
-	for _, p := range pointers {
-		pointerIndex[p.Oid] = p.Name
+	objc := make(chan *fsckObject)
+	go func() {
+		for _, obj := range objects {
+			objc <- obj
+		}
+		close(objc)
+	}()
+
+	var mu sync.Mutex
+	var corrupt []*fsckIssue
+	var firstErr error
+
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range objc {
+				if meter != nil {
+					meter.Add(obj.Oid)
+				}
+
+				actual, err := hashObject(lfs.LocalMediaPathReadOnly(obj.Oid))
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				} else if err == nil && actual != obj.Oid {
+					corrupt = append(corrupt, &fsckIssue{Oid: obj.Oid, Actual: actual})
+				}
+				mu.Unlock()
+
+				if meter != nil {
+					meter.TransferBytes("fsck", obj.Oid, obj.Size, obj.Size, int(obj.Size))
+					meter.FinishTransfer(obj.Oid)
+				}
+			}
+		}()
 	}
+	wg.Wait()
 
-	// TODO(zeroshirts): do we want to look for LFS stuff in past commits?
-	p2, err := lfs.ScanIndex()
+	if meter != nil {
+		meter.Finish()
+	}
+
+	sort.Sort(fsckIssuesByOid(corrupt))
+	return corrupt, firstErr
+}
+
+// hashObject returns the OID of the content of the file at path.
+func hashObject(path string) (string, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return false, err
+		return "", err
 	}
+	defer f.Close()
 
-	for _, p := range p2 {
-		pointerIndex[p.Oid] = p.Name
+	oidHash := sha256.New()
+	if _, err := io.Copy(oidHash, f); err != nil {
+		return "", err
 	}
+	return hex.EncodeToString(oidHash.Sum(nil)), nil
+}
 
-	ok := true
+type fsckIssuesByOid []*fsckIssue
 
-	for oid, name := range pointerIndex {
-		path := lfs.LocalMediaPathReadOnly(oid)
+func (s fsckIssuesByOid) Len() int           { return len(s) }
+func (s fsckIssuesByOid) Less(i, j int) bool { return s[i].Oid < s[j].Oid }
+func (s fsckIssuesByOid) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
-		Debug("Examining %v (%v)", name, path)
+// fsckRepair downloads the objects of the given issues which are referenced by
+// any commit reachable from a ref, and returns whether every issue has been
+// repaired. Corrupt objects which nothing references have been moved aside,
+// which is all they need.
+func fsckRepair(issues []*fsckIssue) bool {
+	opts := lfs.NewScanRefsOptions()
+	opts.ScanMode = lfs.ScanAllMode
+	opts.SkipDeletedBlobs = false
 
-		f, err := os.Open(path)
-		if pErr, pOk := err.(*os.PathError); pOk {
-			Print("Object %s (%s) could not be checked: %s", name, oid, pErr.Err)
-			ok = false
-			continue
-		}
-		if err != nil {
-			return false, err
-		}
+	pointerchan, err := lfs.ScanRefsToChan("", "", opts)
+	if err != nil {
+		Panic(err, "Could not scan for Git LFS files")
+	}
 
-		oidHash := sha256.New()
-		_, err = io.Copy(oidHash, f)
-		f.Close()
-		if err != nil {
-			return false, err
+	wanted := make(map[string]bool, len(issues))
+	for _, issue := range issues {
+		wanted[issue.Oid] = true
+	}
+
+	referenced := make(map[string]*lfs.WrappedPointer)
+	for p := range pointerchan.Results {
+		if wanted[p.Oid] {
+			referenced[p.Oid] = p
 		}
+	}
+	if err := pointerchan.Wait(); err != nil {
+		Panic(err, "Could not scan for Git LFS files")
+	}
 
-		recalculatedOid := hex.EncodeToString(oidHash.Sum(nil))
-		if recalculatedOid != oid {
-			ok = false
-			Print("Object %s (%s) is corrupt", name, oid)
-			if fsckDryRun {
-				continue
+	repaired := true
+	var download []*lfs.WrappedPointer
+	var totalSize int64
+	for _, issue := range issues {
+		p, ok := referenced[issue.Oid]
+		if !ok {
+			if len(issue.Actual) == 0 {
+				// A missing object which nothing references
+				// can't be downloaded, but isn't needed.
+				Print("Object %s is not referenced by any commit, so it was not downloaded", issue.Oid)
 			}
+			continue
+		}
+		download = append(download, p)
+		totalSize += p.Size
+	}
 
-			badDir := filepath.Join(config.LocalGitStorageDir, "lfs", "bad")
-			if err := os.MkdirAll(badDir, 0755); err != nil {
-				return false, err
-			}
+	if len(download) == 0 {
+		return repaired
+	}
+
+	q := lfs.NewDownloadQueue(len(download), totalSize, false)
+	results := q.WatchResults()
+	for _, p := range download {
+		q.Add(lfs.NewDownloadable(p))
+	}
 
-			badFile := filepath.Join(badDir, oid)
-			if err := os.Rename(path, badFile); err != nil {
-				return false, err
+	done := make(chan struct{})
+	go func() {
+		for res := range results {
+			if res.Success {
+				Print("Object %s was downloaded again", res.Oid)
+			} else {
+				repaired = false
 			}
-			Print("  moved to %s", badFile)
 		}
+		close(done)
+	}()
+
+	q.Wait()
+	<-done
+
+	for _, err := range q.Errors() {
+		repaired = false
+		FullError(err)
 	}
-	return ok, nil
+	return repaired
 }
 
-// TODO(zeroshirts): 'git fsck' reports status (percentage, current#/total) as
-// it checks... we should do the same, as we are rehashing potentially gigs and
-// gigs of content.
+// fsckCommand exits with status 0 if there were no issues, 1 if there were
+// and --fix repaired all of them, and 2 if any are left unrepaired, whether
+// because --fix wasn't given or because it couldn't repair them.
 //
 // NOTE(zeroshirts): Ideally git would have hooks for fsck such that we could
 // chain a lfs-fsck, but I don't think it does.
 func fsckCommand(cmd *cobra.Command, args []string) {
+	if fsckFix && fsckDryRun {
+		Exit("Cannot use --fix with --dry-run.")
+	}
+	if fsckObjectsOnly && fsckPointersOnly {
+		Exit("Cannot use --objects-only with --pointers-only.")
+	}
+
 	lfs.InstallHooks(false)
 
-	ok, err := doFsck()
+	issues, err := doFsck()
 	if err != nil {
 		Panic(err, "Error checking Git LFS files")
 	}
 
-	if ok {
+	if len(issues) == 0 {
 		Print("Git LFS fsck OK")
+		return
+	}
+
+	if fsckFix && fsckRepair(issues) {
+		exit(1)
 	}
+	exit(2)
 }
 
 func init() {
 	RegisterCommand("fsck", fsckCommand, func(cmd *cobra.Command) {
 		cmd.Flags().BoolVarP(&fsckDryRun, "dry-run", "d", false, "List corrupt objects without deleting them.")
+		cmd.Flags().BoolVarP(&fsckFix, "fix", "", false, "Download corrupt and missing objects again.")
+		cmd.Flags().BoolVarP(&fsckObjectsOnly, "objects-only", "", false, "Only check the objects in .git/lfs/objects.")
+		cmd.Flags().BoolVarP(&fsckPointersOnly, "pointers-only", "", false, "Only check the objects of files in HEAD and the index.")
 	})
 }
@@ -8,13 +8,17 @@ import (
 
 	"github.com/github/git-lfs/api"
 	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/errors"
 	"github.com/github/git-lfs/git"
+	"github.com/github/git-lfs/lfs"
 	"github.com/spf13/cobra"
 )
 
 var (
 	lockRemote     string
 	lockRemoteHelp = "specify which remote to use when interacting with locks"
+	lockGlob       string
+	lockGlobHelp   = "also use the tracked files matching a pattern"
 
 	// TODO(taylor): consider making this (and the above flag) a property of
 	// some parent-command, or another similarly less ugly way of handling
@@ -27,8 +31,13 @@ var (
 func lockCommand(cmd *cobra.Command, args []string) {
 	setLockRemoteFor(cfg)
 
-	if len(args) == 0 {
-		Print("Usage: git lfs lock <path>")
+	paths, err := lockPathArgs(args, lockGlob)
+	if err != nil {
+		Exit(err.Error())
+	}
+
+	if len(paths) == 0 {
+		Print("Usage: git lfs lock (<path>... | --glob <pattern>)")
 		return
 	}
 
@@ -38,28 +47,49 @@ func lockCommand(cmd *cobra.Command, args []string) {
 		Exit("Unable to determine lastest remote ref for branch.")
 	}
 
-	path, err := lockPath(args[0])
+	committer := api.CurrentCommitter()
+	results := forEachLockPath(paths, cfg.TransferAPIConcurrency(), func(file string) (string, error) {
+		return lockFile(file, committer, latest.Sha)
+	})
+
+	ok := reportLockResults(results, "lock")
+	cacheLockResults(results, true)
+
+	if !ok {
+		exit(2)
+	}
+}
+
+// lockFile asks the server to lock "file", and returns the ID of the new lock.
+func lockFile(file string, committer api.Committer, latestRemoteCommit string) (string, error) {
+	path, err := lockPath(file)
 	if err != nil {
-		Exit(err.Error())
+		return "", err
 	}
 
 	s, resp := API.Locks.Lock(&api.LockRequest{
 		Path:               path,
-		Committer:          api.CurrentCommitter(),
-		LatestRemoteCommit: latest.Sha,
+		Committer:          committer,
+		LatestRemoteCommit: latestRemoteCommit,
 	})
 
 	if _, err := API.Do(s); err != nil {
-		Error(err.Error())
-		Exit("Error communicating with LFS API.")
+		return "", errors.Wrap(err, "Error communicating with LFS API")
 	}
 
 	if len(resp.Err) > 0 {
-		Error(resp.Err)
-		Exit("Server unable to create lock.")
+		return "", errors.New(resp.Err)
+	}
+
+	if cfg.HardLinkCheckout() {
+		// The file is locked so that it can be edited, which must not
+		// modify the object it was checked out from.
+		if err := lfs.BreakHardLink(file); err != nil {
+			Error("Unable to make %q writable: %s", file, err)
+		}
 	}
 
-	Print("\n'%s' was locked (%s)", args[0], resp.Lock.Id)
+	return resp.Lock.Id, nil
 }
 
 // lockPaths relativizes the given filepath such that it is relative to the root
@@ -108,5 +138,6 @@ func init() {
 
 	RegisterCommand("lock", lockCommand, func(cmd *cobra.Command) {
 		cmd.Flags().StringVarP(&lockRemote, "remote", "r", cfg.CurrentRemote, lockRemoteHelp)
+		cmd.Flags().StringVarP(&lockGlob, "glob", "g", "", lockGlobHelp)
 	})
 }
@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"github.com/github/git-lfs/config"
+	"github.com/spf13/cobra"
+)
+
+// lockableStatusCommand lists the lockable files whose permissions don't match
+// whether they are locked by the current user: writable files which aren't
+// locked by them, and read-only files which are.
+func lockableStatusCommand(cmd *cobra.Command, args []string) {
+	requireInRepo()
+
+	files, owned, err := lockableFiles(nil)
+	if err != nil {
+		Exit("Unable to find lockable files: %s", err)
+	}
+
+	mismatches, err := findLockableMismatches(config.LocalWorkingDir, files, owned)
+	if err != nil {
+		Exit("Unable to check lockable files: %s", err)
+	}
+
+	if len(mismatches) == 0 {
+		Print("All %d lockable file(s) have the expected permissions.", len(files))
+		return
+	}
+
+	Print("Lockable files with unexpected permissions:")
+	for _, m := range mismatches {
+		if m.Writable {
+			Print("\t%s: writable, but not locked by you", m.Path)
+		} else {
+			Print("\t%s: read-only, but locked by you", m.Path)
+		}
+	}
+	Print("\nRun `git lfs checkout` to fix them.")
+}
+
+func init() {
+	if !isCommandEnabled(cfg, "locks") {
+		return
+	}
+
+	RegisterCommand("lockable-status", lockableStatusCommand, nil)
+}
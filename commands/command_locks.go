@@ -1,7 +1,13 @@
 package commands
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/github/git-lfs/api"
+	"github.com/github/git-lfs/git"
 	"github.com/spf13/cobra"
 )
 
@@ -9,31 +15,52 @@ var (
 	locksCmdFlags = new(locksFlags)
 )
 
+// locksPageSize is the number of locks asked for in each request, unless
+// --limit asks for fewer. Servers may return fewer, with a cursor for the
+// next page.
+const locksPageSize = 100
+
 func locksCommand(cmd *cobra.Command, args []string) {
 	setLockRemoteFor(cfg)
 
 	filters, err := locksCmdFlags.Filters()
 	if err != nil {
-		Error(err.Error())
+		Exit(err.Error())
 	}
 
-	var locks []api.Lock
+	locks := make([]api.Lock, 0)
+	pages := 0
 
 	query := &api.LockSearchRequest{Filters: filters}
 	for {
+		query.Limit = locksPageSize
+		if remaining := locksCmdFlags.Limit - len(locks); locksCmdFlags.Limit > 0 && remaining < query.Limit {
+			query.Limit = remaining
+		}
+
 		s, resp := API.Locks.Search(query)
 		if _, err := API.Do(s); err != nil {
 			Error(err.Error())
+			if pages > 0 {
+				Exit("Error communicating with LFS API after fetching %d page(s) of locks.", pages)
+			}
 			Exit("Error communicating with LFS API.")
 		}
+		pages++
 
 		if resp.Err != "" {
-			Error(resp.Err)
+			Exit(resp.Err)
 		}
 
-		locks = append(locks, resp.Locks...)
+		// Servers which don't support a filter ignore it, so the
+		// filters are applied here too.
+		for _, lock := range resp.Locks {
+			if locksCmdFlags.Matches(lock) {
+				locks = append(locks, lock)
+			}
+		}
 
-		if locksCmdFlags.Limit > 0 && len(locks) > locksCmdFlags.Limit {
+		if locksCmdFlags.Limit > 0 && len(locks) >= locksCmdFlags.Limit {
 			locks = locks[:locksCmdFlags.Limit]
 			break
 		}
@@ -45,6 +72,13 @@ func locksCommand(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	if locksCmdFlags.JSON {
+		if err := json.NewEncoder(os.Stdout).Encode(locks); err != nil {
+			Error(err.Error())
+		}
+		return
+	}
+
 	Print("\n%d lock(s) matched query:", len(locks))
 	for _, lock := range locks {
 		Print("%s\t%s <%s>", lock.Path, lock.Committer.Name, lock.Committer.Email)
@@ -55,7 +89,8 @@ func locksCommand(cmd *cobra.Command, args []string) {
 // `git lfs locks` command.
 type locksFlags struct {
 	// Path is an optional filter parameter to filter against the lock's
-	// path
+	// path. Locks whose path starts with it, relative to the root of the
+	// repository, match.
 	Path string
 	// Id is an optional filter parameter used to filtere against the lock's
 	// ID.
@@ -63,21 +98,34 @@ type locksFlags struct {
 	// limit is an optional request parameter sent to the server used to
 	// limit the
 	Limit int
+	// JSON is whether to print the locks as a JSON array, rather than for
+	// people to read.
+	JSON bool
+
+	// pathPrefix is Path relative to the root of the repository, set by
+	// Filters.
+	pathPrefix string
 }
 
 // Filters produces a slice of api.Filter instances based on the internal state
 // of this locksFlags instance. The return value of this method is capable (and
 // recommend to be used with) the api.LockSearchRequest type.
+//
+// A Path naming a file is sent to the server, which only returns locks on that
+// file. Any other Path is a prefix, which is only matched by Matches.
 func (l *locksFlags) Filters() ([]api.Filter, error) {
 	filters := make([]api.Filter, 0)
 
 	if l.Path != "" {
-		path, err := lockPath(l.Path)
+		prefix, err := lockPathPrefix(l.Path)
 		if err != nil {
 			return nil, err
 		}
+		l.pathPrefix = prefix
 
-		filters = append(filters, api.Filter{"path", path})
+		if path, err := lockPath(l.Path); err == nil {
+			filters = append(filters, api.Filter{"path", path})
+		}
 	}
 	if l.Id != "" {
 		filters = append(filters, api.Filter{"id", l.Id})
@@ -86,6 +134,43 @@ func (l *locksFlags) Filters() ([]api.Filter, error) {
 	return filters, nil
 }
 
+// Matches returns whether "lock" matches the --path and --id filters.
+func (l *locksFlags) Matches(lock api.Lock) bool {
+	if l.Id != "" && lock.Id != l.Id {
+		return false
+	}
+	return strings.HasPrefix(lock.Path, l.pathPrefix)
+}
+
+// lockPathPrefix returns "file" relative to the root of the repository, with
+// forward slashes, like the paths of locks. Unlike lockPath, "file" doesn't
+// need to exist, and a trailing slash is kept.
+func lockPathPrefix(file string) (string, error) {
+	repo, err := git.RootDir()
+	if err != nil {
+		return "", err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(repo, filepath.Join(wd, file))
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return "", nil
+	}
+
+	prefix := filepath.ToSlash(rel)
+	if strings.HasSuffix(file, "/") || strings.HasSuffix(file, string(filepath.Separator)) {
+		prefix += "/"
+	}
+	return prefix, nil
+}
+
 func init() {
 	if !isCommandEnabled(cfg, "locks") {
 		return
@@ -93,8 +178,9 @@ func init() {
 
 	RegisterCommand("locks", locksCommand, func(cmd *cobra.Command) {
 		cmd.Flags().StringVarP(&lockRemote, "remote", "r", cfg.CurrentRemote, lockRemoteHelp)
-		cmd.Flags().StringVarP(&locksCmdFlags.Path, "path", "p", "", "filter locks results matching a particular path")
+		cmd.Flags().StringVarP(&locksCmdFlags.Path, "path", "p", "", "filter locks results by path, or path prefix")
 		cmd.Flags().StringVarP(&locksCmdFlags.Id, "id", "i", "", "filter locks results matching a particular ID")
 		cmd.Flags().IntVarP(&locksCmdFlags.Limit, "limit", "l", 0, "optional limit for number of results to return")
+		cmd.Flags().BoolVarP(&locksCmdFlags.JSON, "json", "j", false, "print the locks as JSON")
 	})
 }
@@ -0,0 +1,29 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/github/git-lfs/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocksFlagsMatches(t *testing.T) {
+	a := api.Lock{Id: "1", Path: "assets/a.dat"}
+	b := api.Lock{Id: "2", Path: "assets2/b.dat"}
+
+	all := &locksFlags{}
+	assert.True(t, all.Matches(a))
+	assert.True(t, all.Matches(b))
+
+	dir := &locksFlags{pathPrefix: "assets/"}
+	assert.True(t, dir.Matches(a))
+	assert.False(t, dir.Matches(b))
+
+	prefix := &locksFlags{pathPrefix: "assets"}
+	assert.True(t, prefix.Matches(a))
+	assert.True(t, prefix.Matches(b))
+
+	id := &locksFlags{Id: "2", pathPrefix: "assets"}
+	assert.False(t, id.Matches(a))
+	assert.True(t, id.Matches(b))
+}
@@ -1,15 +1,31 @@
 package commands
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
 
 	"github.com/github/git-lfs/git"
 	"github.com/github/git-lfs/lfs"
+	"github.com/github/git-lfs/tools"
 	"github.com/spf13/cobra"
 )
 
 var (
-	longOIDs = false
+	longOIDs             = false
+	lsFilesSizeArg       = false
+	lsFilesJSONArg       = false
+	lsFilesIncludeArg    string
+	lsFilesExcludeArg    string
+	lsFilesLargerThanArg string
+	lsFilesSortArg       string
 )
 
 func lsFilesCommand(cmd *cobra.Command, args []string) {
@@ -28,19 +44,189 @@ func lsFilesCommand(cmd *cobra.Command, args []string) {
 		ref = fullref.Sha
 	}
 
-	showOidLen := 10
-	if longOIDs {
-		showOidLen = 64
+	filter, err := lsFilesFilter()
+	if err != nil {
+		Exit(err.Error())
+	}
+
+	var less func(a, b *lfs.WrappedPointer) bool
+	switch lsFilesSortArg {
+	case "":
+	case "name":
+		less = lsFilesByName
+	case "size":
+		less = lsFilesBySize
+	default:
+		Exit("Invalid --sort value %q: must be \"name\" or \"size\"", lsFilesSortArg)
 	}
 
-	files, err := lfs.ScanTree(ref)
+	pointers, err := lfs.ScanTreeToChan(ref)
 	if err != nil {
 		Panic(err, "Could not scan for Git LFS tree: %s", err)
 	}
 
-	for _, p := range files {
-		Print("%s %s %s", p.Oid[0:showOidLen], lsFilesMarker(p), p.Name)
+	w := newLsFilesWriter(OutputWriter)
+
+	// Print each file as soon as the scanner finds it, so that large trees
+	// start producing output straight away, unless they have to be sorted.
+	var sorted []*lfs.WrappedPointer
+	for p := range pointers.Results {
+		if !filter(lfs.NewDownloadable(p)) {
+			continue
+		}
+		if less != nil {
+			sorted = append(sorted, p)
+			continue
+		}
+		exitIfOutputClosed(w.Write(p))
+	}
+
+	if err := pointers.Wait(); err != nil {
+		Panic(err, "Could not scan for Git LFS tree: %s", err)
+	}
+
+	if less != nil {
+		sort.Sort(&lsFilesSorter{sorted, less})
+		for _, p := range sorted {
+			exitIfOutputClosed(w.Write(p))
+		}
+	}
+	exitIfOutputClosed(w.Close())
+}
+
+// lsFilesFilter returns the filter for the files to list, from --include,
+// --exclude and --larger-than.
+func lsFilesFilter() (lfs.TransferFilter, error) {
+	filter := lfs.NewPathFilter(
+		tools.CleanPaths(lsFilesIncludeArg, ","),
+		tools.CleanPaths(lsFilesExcludeArg, ","),
+	)
+
+	if len(lsFilesLargerThanArg) == 0 {
+		return filter, nil
+	}
+
+	size, err := parseByteSize(lsFilesLargerThanArg)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid --larger-than value: %s", err)
+	}
+	return lfs.AllFilters(filter, lfs.NewSizeFilter(size+1, 0)), nil
+}
+
+// lsFilesByName orders files by path.
+func lsFilesByName(a, b *lfs.WrappedPointer) bool {
+	return a.Name < b.Name
+}
+
+// lsFilesBySize orders files from the largest to the smallest, and then by
+// path.
+func lsFilesBySize(a, b *lfs.WrappedPointer) bool {
+	if a.Size != b.Size {
+		return a.Size > b.Size
+	}
+	return a.Name < b.Name
+}
+
+type lsFilesSorter struct {
+	pointers []*lfs.WrappedPointer
+	less     func(a, b *lfs.WrappedPointer) bool
+}
+
+func (s *lsFilesSorter) Len() int           { return len(s.pointers) }
+func (s *lsFilesSorter) Less(i, j int) bool { return s.less(s.pointers[i], s.pointers[j]) }
+func (s *lsFilesSorter) Swap(i, j int)      { s.pointers[i], s.pointers[j] = s.pointers[j], s.pointers[i] }
+
+// lsFilesEntry is a file listed by ls-files --json.
+type lsFilesEntry struct {
+	Name        string `json:"name"`
+	Oid         string `json:"oid"`
+	Size        int64  `json:"size"`
+	PointerPath string `json:"pointer_path"`
+}
+
+// lsFilesWriter writes the files listed by ls-files as they are found, either
+// as lines for people to read or, with --json, as the elements of a JSON array.
+type lsFilesWriter struct {
+	w       io.Writer
+	written bool
+}
+
+func newLsFilesWriter(w io.Writer) *lsFilesWriter {
+	return &lsFilesWriter{w: w}
+}
+
+func (w *lsFilesWriter) Write(p *lfs.WrappedPointer) error {
+	if !lsFilesJSONArg {
+		showOidLen := 10
+		if longOIDs {
+			showOidLen = 64
+		}
+
+		line := fmt.Sprintf("%s %s %s", p.Oid[0:showOidLen], lsFilesMarker(p), p.Name)
+		if lsFilesSizeArg {
+			line = fmt.Sprintf("%s (%s)", line, humanizeBytes(p.Size))
+		}
+		_, err := fmt.Fprintln(w.w, line)
+		return err
+	}
+
+	by, err := json.Marshal(&lsFilesEntry{
+		Name:        filepath.Base(p.Name),
+		Oid:         p.Oid,
+		Size:        p.Size,
+		PointerPath: p.Name,
+	})
+	if err != nil {
+		return err
+	}
+
+	sep := ","
+	if !w.written {
+		sep = "["
+		w.written = true
+	}
+	_, err = fmt.Fprintf(w.w, "%s%s", sep, by)
+	return err
+}
+
+// Close finishes the JSON array for --json.
+func (w *lsFilesWriter) Close() error {
+	if !lsFilesJSONArg {
+		return nil
+	}
+
+	end := "]\n"
+	if !w.written {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(w.w, end)
+	return err
+}
+
+// parseByteSize parses a size such as "500", "10KB" or "1.5GB", with the
+// units printed by humanizeBytes, which are powers of 1024. The unit's "B" may
+// be left off, and case doesn't matter.
+func parseByteSize(s string) (int64, error) {
+	num := strings.TrimSpace(s)
+	unit := ""
+	if i := strings.IndexFunc(num, unicode.IsLetter); i >= 0 {
+		num, unit = strings.TrimSpace(num[:i]), strings.ToUpper(num[i:])
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a size", s)
+	}
+
+	if len(unit) > 0 && unit != "B" && !strings.HasSuffix(unit, "B") {
+		unit += "B"
+	}
+	for i, u := range byteUnits {
+		if unit == u || (len(unit) == 0 && i == 0) {
+			return int64(n * math.Pow(1024, float64(i))), nil
+		}
 	}
+	return 0, fmt.Errorf("%q is not a size: unknown unit %q", s, unit)
 }
 
 func lsFilesMarker(p *lfs.WrappedPointer) string {
@@ -55,5 +241,11 @@ func lsFilesMarker(p *lfs.WrappedPointer) string {
 func init() {
 	RegisterCommand("ls-files", lsFilesCommand, func(cmd *cobra.Command) {
 		cmd.Flags().BoolVarP(&longOIDs, "long", "l", false, "")
+		cmd.Flags().BoolVarP(&lsFilesSizeArg, "size", "s", false, "Show the size of each file")
+		cmd.Flags().BoolVarP(&lsFilesJSONArg, "json", "j", false, "List the files as JSON")
+		cmd.Flags().StringVarP(&lsFilesIncludeArg, "include", "I", "", "Include a list of paths")
+		cmd.Flags().StringVarP(&lsFilesExcludeArg, "exclude", "X", "", "Exclude a list of paths")
+		cmd.Flags().StringVar(&lsFilesLargerThanArg, "larger-than", "", "Only list files larger than the given size")
+		cmd.Flags().StringVar(&lsFilesSortArg, "sort", "", "Sort the files by \"name\" or \"size\"")
 	})
 }
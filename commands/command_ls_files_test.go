@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/github/git-lfs/lfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for s, expected := range map[string]int64{
+		"0":      0,
+		"500":    500,
+		"500B":   500,
+		"10KB":   10 * 1024,
+		"10k":    10 * 1024,
+		"1.5 MB": 1536 * 1024,
+		"1gb":    1024 * 1024 * 1024,
+		"2T":     2 * 1024 * 1024 * 1024 * 1024,
+	} {
+		n, err := parseByteSize(s)
+		if assert.Nil(t, err, s) {
+			assert.Equal(t, expected, n, s)
+		}
+	}
+
+	for _, s := range []string{"", "KB", "-1", "ten", "10XB", "1.2.3MB"} {
+		_, err := parseByteSize(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func lsFilesTestPointer(name string, size int64) *lfs.WrappedPointer {
+	return &lfs.WrappedPointer{Name: name, Size: size, Pointer: lfs.NewPointer(name+"-oid", size, nil)}
+}
+
+func TestLsFilesSortsBySize(t *testing.T) {
+	pointers := []*lfs.WrappedPointer{
+		lsFilesTestPointer("b.dat", 1),
+		lsFilesTestPointer("c.dat", 3),
+		lsFilesTestPointer("a.dat", 1),
+	}
+	sort.Sort(&lsFilesSorter{pointers, lsFilesBySize})
+
+	var names []string
+	for _, p := range pointers {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"c.dat", "a.dat", "b.dat"}, names)
+}
+
+func TestLsFilesWriterJSON(t *testing.T) {
+	lsFilesJSONArg = true
+	defer func() { lsFilesJSONArg = false }()
+
+	var buf bytes.Buffer
+	w := newLsFilesWriter(&buf)
+	assert.Nil(t, w.Write(lsFilesTestPointer("dir/a.dat", 1)))
+	assert.Nil(t, w.Write(lsFilesTestPointer("b.dat", 2)))
+	assert.Nil(t, w.Close())
+
+	assert.Equal(t, `[{"name":"a.dat","oid":"dir/a.dat-oid","size":1,"pointer_path":"dir/a.dat"},`+
+		`{"name":"b.dat","oid":"b.dat-oid","size":2,"pointer_path":"b.dat"}]`+"\n", buf.String())
+
+	buf.Reset()
+	w = newLsFilesWriter(&buf)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, "[]\n", buf.String())
+}
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"strings"
 
 	"github.com/github/git-lfs/lfs"
 	"github.com/spf13/cobra"
@@ -18,9 +21,22 @@ var (
 	pointerFile    string
 	pointerCompare string
 	pointerStdin   bool
+	pointerCheck   bool
+	pointerStrict  bool
+	pointerJSON    bool
 )
 
 func pointerCommand(cmd *cobra.Command, args []string) {
+	if pointerCheck {
+		if len(pointerFile) > 0 || len(pointerCompare) > 0 {
+			Error("Cannot use --check with --file or --pointer.")
+			exit(1)
+		}
+
+		checkPointers(args)
+		return
+	}
+
 	comparing := false
 	something := false
 	buildOid := ""
@@ -35,7 +51,7 @@ func pointerCommand(cmd *cobra.Command, args []string) {
 		buildFile, err := os.Open(pointerFile)
 		if err != nil {
 			Error(err.Error())
-			os.Exit(1)
+			exit(1)
 		}
 
 		oidHash := sha256.New()
@@ -44,7 +60,7 @@ func pointerCommand(cmd *cobra.Command, args []string) {
 
 		if err != nil {
 			Error(err.Error())
-			os.Exit(1)
+			exit(1)
 		}
 
 		ptr := lfs.NewPointer(hex.EncodeToString(oidHash.Sum(nil)), size, nil)
@@ -65,7 +81,7 @@ func pointerCommand(cmd *cobra.Command, args []string) {
 		compFile, err := pointerReader()
 		if err != nil {
 			Error(err.Error())
-			os.Exit(1)
+			exit(1)
 		}
 
 		buf := &bytes.Buffer{}
@@ -81,7 +97,7 @@ func pointerCommand(cmd *cobra.Command, args []string) {
 
 		if err != nil {
 			Error(err.Error())
-			os.Exit(1)
+			exit(1)
 		}
 
 		fmt.Fprintf(os.Stderr, buf.String())
@@ -93,12 +109,12 @@ func pointerCommand(cmd *cobra.Command, args []string) {
 
 	if comparing && buildOid != compareOid {
 		fmt.Fprintf(os.Stderr, "\nPointers do not match\n")
-		os.Exit(1)
+		exit(1)
 	}
 
 	if !something {
 		Error("Nothing to do!")
-		os.Exit(1)
+		exit(1)
 	}
 }
 
@@ -116,13 +132,98 @@ func pointerReader() (io.ReadCloser, error) {
 	return os.Stdin, nil
 }
 
+// pointerCheckResult is the result of checking one file with --check.
+type pointerCheckResult struct {
+	Path  string `json:"path"`
+	Valid bool   `json:"valid"`
+	Oid   string `json:"oid,omitempty"`
+	Size  int64  `json:"size"`
+	Error string `json:"error,omitempty"`
+}
+
+// checkPointers checks that each of the files in "paths", and those listed on
+// STDIN with --stdin, are valid pointers. It exits with status 1 if any
+// aren't.
+func checkPointers(paths []string) {
+	if pointerStdin {
+		requireStdin("The --check --stdin flags expect a list of paths from STDIN.")
+
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			Error(err.Error())
+			exit(1)
+		}
+		paths = append(paths, splitCheckPaths(data)...)
+	} else if len(paths) == 0 {
+		Error("Nothing to do!")
+		exit(1)
+	}
+
+	results := make([]*pointerCheckResult, 0, len(paths))
+	invalid := 0
+	for _, path := range paths {
+		res := &pointerCheckResult{Path: path}
+		if p, err := lfs.CheckPointerFile(path, pointerStrict); err != nil {
+			res.Error = err.Error()
+			invalid++
+		} else {
+			res.Valid = true
+			res.Oid = p.Oid
+			res.Size = p.Size
+		}
+		results = append(results, res)
+	}
+
+	if pointerJSON {
+		err := json.NewEncoder(os.Stdout).Encode(struct {
+			Files   []*pointerCheckResult `json:"files"`
+			Checked int                   `json:"checked"`
+			Invalid int                   `json:"invalid"`
+		}{results, len(results), invalid})
+		if err != nil {
+			Error(err.Error())
+			exit(1)
+		}
+	} else {
+		for _, res := range results {
+			if res.Valid {
+				Print("ok %s", res.Path)
+			} else {
+				Print("invalid %s: %s", res.Path, res.Error)
+			}
+		}
+		Error("%d checked, %d invalid", len(results), invalid)
+	}
+
+	if invalid > 0 {
+		exit(1)
+	}
+}
+
+// splitCheckPaths splits the paths given to --check --stdin, which are
+// separated by NUL characters if there are any, and otherwise by newlines.
+func splitCheckPaths(data []byte) []string {
+	sep := "\n"
+	if bytes.IndexByte(data, 0) >= 0 {
+		sep = "\x00"
+	}
+
+	var paths []string
+	for _, path := range strings.Split(string(data), sep) {
+		if len(path) > 0 {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
 func gitHashObject(by []byte) string {
 	cmd := exec.Command("git", "hash-object", "--stdin")
 	cmd.Stdin = bytes.NewReader(by)
 	out, err := cmd.Output()
 	if err != nil {
 		Error("Error building Git blob OID: %s", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	return string(bytes.TrimSpace(out))
@@ -133,5 +234,8 @@ func init() {
 		cmd.Flags().StringVarP(&pointerFile, "file", "f", "", "Path to a local file to generate the pointer from.")
 		cmd.Flags().StringVarP(&pointerCompare, "pointer", "p", "", "Path to a local file containing a pointer built by another Git LFS implementation.")
 		cmd.Flags().BoolVarP(&pointerStdin, "stdin", "", false, "Read a pointer built by another Git LFS implementation through STDIN.")
+		cmd.Flags().BoolVarP(&pointerCheck, "check", "", false, "Check that the given files are valid pointers.")
+		cmd.Flags().BoolVarP(&pointerStrict, "strict", "", false, "With --check, reject pointers with Windows line endings or no final newline.")
+		cmd.Flags().BoolVarP(&pointerJSON, "json", "", false, "With --check, print the results as JSON.")
 	})
 }
@@ -0,0 +1,15 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCheckPathsByNewline(t *testing.T) {
+	assert.Equal(t, []string{"a.dat", "dir/b c.dat"}, splitCheckPaths([]byte("a.dat\n\ndir/b c.dat\n")))
+}
+
+func TestSplitCheckPathsByNul(t *testing.T) {
+	assert.Equal(t, []string{"a\n.dat", "b.dat"}, splitCheckPaths([]byte("a\n.dat\x00b.dat\x00")))
+}
@@ -12,6 +12,7 @@ import (
 
 var (
 	prePushDryRun       = false
+	prePushForceLocked  = false
 	prePushDeleteBranch = strings.Repeat("0", 40)
 )
 
@@ -40,7 +41,7 @@ var (
 func prePushCommand(cmd *cobra.Command, args []string) {
 	if len(args) == 0 {
 		Print("This should be run through Git's pre-push hook.  Run `git lfs update` to install it.")
-		os.Exit(1)
+		exit(1)
 	}
 
 	requireGitVersion()
@@ -52,6 +53,7 @@ func prePushCommand(cmd *cobra.Command, args []string) {
 
 	cfg.CurrentRemote = args[0]
 	ctx := newUploadContext(prePushDryRun)
+	ctx.ForcePushLocked = prePushForceLocked
 
 	scanOpt := lfs.NewScanRefsOptions()
 	scanOpt.ScanMode = lfs.ScanLeftToRemoteMode
@@ -76,8 +78,12 @@ func prePushCommand(cmd *cobra.Command, args []string) {
 			Panic(err, "Error scanning for Git LFS files")
 		}
 
-		upload(ctx, pointers)
+		upload(ctx, left, pointers)
 	}
+
+	ctx.ReportDryRun(false)
+	ctx.ReportAlreadyPresent()
+	ctx.ReportMissing()
 }
 
 // decodeRefs pulls the sha1s out of the line read from the pre-push
@@ -100,5 +106,6 @@ func decodeRefs(input string) (string, string) {
 func init() {
 	RegisterCommand("pre-push", prePushCommand, func(cmd *cobra.Command) {
 		cmd.Flags().BoolVarP(&prePushDryRun, "dry-run", "d", false, "Do everything except actually send the updates")
+		cmd.Flags().BoolVarP(&prePushForceLocked, "force-push-locked", "", false, "Push files even if someone else has locked them")
 	})
 }
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,10 +20,12 @@ import (
 )
 
 var (
-	pruneDryRunArg      bool
-	pruneVerboseArg     bool
-	pruneVerifyArg      bool
-	pruneDoNotVerifyArg bool
+	pruneDryRunArg        bool
+	pruneDryRunVerboseArg bool
+	pruneVerboseArg       bool
+	pruneVerifyArg        bool
+	pruneDoNotVerifyArg   bool
+	pruneKeepPatternArg   []string
 )
 
 func pruneCommand(cmd *cobra.Command, args []string) {
@@ -33,7 +37,10 @@ func pruneCommand(cmd *cobra.Command, args []string) {
 	fetchPruneConfig := cfg.FetchPruneConfig()
 	verify := !pruneDoNotVerifyArg &&
 		(fetchPruneConfig.PruneVerifyRemoteAlways || pruneVerifyArg)
-	prune(fetchPruneConfig, verify, pruneDryRunArg, pruneVerboseArg)
+	// --dry-run-verbose is a dry run which also explains what is retained
+	dryRun := pruneDryRunArg || pruneDryRunVerboseArg
+	verbose := pruneVerboseArg || pruneDryRunVerboseArg
+	prune(fetchPruneConfig, verify, dryRun, verbose, pruneDryRunVerboseArg, pruneKeepPatternArg)
 }
 
 type PruneProgressType int
@@ -51,18 +58,34 @@ type PruneProgress struct {
 }
 type PruneProgressChan chan PruneProgress
 
-func prune(fetchPruneConfig config.FetchPruneConfig, verifyRemote, dryRun, verbose bool) {
+// An object to be retained, and why
+type pruneRetained struct {
+	Oid    string
+	Reason string
+}
+
+// prune deletes the local objects which aren't retained. With "explain", it
+// also lists why each retained object is kept and the last commit to add each
+// prunable one. Objects at paths matching "keepPatterns" in any commit are
+// always retained.
+func prune(fetchPruneConfig config.FetchPruneConfig, verifyRemote, dryRun, verbose, explain bool, keepPatterns []string) {
 	localObjects := make([]localstorage.Object, 0, 100)
 	retainedObjects := tools.NewStringSetWithCapacity(100)
+	var retainReasons map[string][]string
+	var lastCommits map[string]string
 	var reachableObjects tools.StringSet
 	var taskwait sync.WaitGroup
 
 	// Add all the base funcs to the waitgroup before starting them, in case
 	// one completes really fast & hits 0 unexpectedly
 	// each main process can Add() to the wg itself if it subdivides the task
-	taskwait.Add(4) // 1..4: localObjects, current & recent refs, unpushed, worktree
+	taskwait.Add(5) // 1..5: localObjects, current & recent refs, unpushed, worktree, stashed
 	if verifyRemote {
-		taskwait.Add(1) // 5
+		taskwait.Add(1) // 6
+	}
+	scanHistory := explain || len(keepPatterns) > 0
+	if scanHistory {
+		taskwait.Add(1) // 7
 	}
 
 	progressChan := make(PruneProgressChan, 100)
@@ -78,20 +101,29 @@ func prune(fetchPruneConfig config.FetchPruneConfig, verifyRemote, dryRun, verbo
 	go pruneTaskGetLocalObjects(&localObjects, progressChan, &taskwait)
 
 	// Now find files to be retained from many sources
-	retainChan := make(chan string, 100)
+	retainChan := make(chan pruneRetained, 100)
 
 	go pruneTaskGetRetainedCurrentAndRecentRefs(fetchPruneConfig, retainChan, errorChan, &taskwait)
 	go pruneTaskGetRetainedUnpushed(fetchPruneConfig, retainChan, errorChan, &taskwait)
 	go pruneTaskGetRetainedWorktree(retainChan, errorChan, &taskwait)
+	go pruneTaskGetRetainedStashed(retainChan, errorChan, &taskwait)
 	if verifyRemote {
 		reachableObjects = tools.NewStringSetWithCapacity(100)
 		go pruneTaskGetReachableObjects(&reachableObjects, errorChan, &taskwait)
 	}
+	if scanHistory {
+		// One pass over the history serves every object
+		lastCommits = make(map[string]string)
+		go pruneTaskGetHistory(keepPatterns, lastCommits, retainChan, errorChan, &taskwait)
+	}
+	if explain {
+		retainReasons = make(map[string][]string)
+	}
 
 	// Now collect all the retained objects, on separate wait
 	var retainwait sync.WaitGroup
 	retainwait.Add(1)
-	go pruneTaskCollectRetained(&retainedObjects, retainChan, progressChan, &retainwait)
+	go pruneTaskCollectRetained(&retainedObjects, retainReasons, retainChan, progressChan, &retainwait)
 
 	// Report progress
 	var progresswait sync.WaitGroup
@@ -129,7 +161,9 @@ func prune(fetchPruneConfig config.FetchPruneConfig, verifyRemote, dryRun, verbo
 		if !retainedObjects.Contains(file.Oid) {
 			prunableObjects = append(prunableObjects, file.Oid)
 			totalSize += file.Size
-			if verbose {
+			if explain {
+				verboseOutput.WriteString(fmt.Sprintf(" * %v (%v), %v\n", file.Oid, humanizeBytes(file.Size), pruneLastCommit(lastCommits, file.Oid)))
+			} else if verbose {
 				// Save up verbose output for the end, spinner still going
 				verboseOutput.WriteString(fmt.Sprintf(" * %v (%v)\n", file.Oid, humanizeBytes(file.Size)))
 			}
@@ -165,9 +199,7 @@ func prune(fetchPruneConfig config.FetchPruneConfig, verifyRemote, dryRun, verbo
 
 	if len(prunableObjects) == 0 {
 		Print("Nothing to prune")
-		return
-	}
-	if dryRun {
+	} else if dryRun {
 		Print("%d files would be pruned (%v)", len(prunableObjects), humanizeBytes(totalSize))
 		if verbose {
 			Print(verboseOutput.String())
@@ -180,6 +212,50 @@ func prune(fetchPruneConfig config.FetchPruneConfig, verifyRemote, dryRun, verbo
 		pruneDeleteFiles(prunableObjects)
 	}
 
+	if explain {
+		pruneExplainRetained(localObjects, retainReasons)
+	}
+}
+
+// pruneExplainRetained lists the local objects which are retained, with the
+// reasons for each.
+func pruneExplainRetained(localObjects []localstorage.Object, retainReasons map[string][]string) {
+	var output bytes.Buffer
+	var count int
+	var size int64
+	for _, file := range localObjects {
+		reasons, ok := retainReasons[file.Oid]
+		if !ok {
+			continue
+		}
+		count++
+		size += file.Size
+		sort.Strings(reasons)
+		output.WriteString(fmt.Sprintf(" * %v (%v): %v\n", file.Oid, humanizeBytes(file.Size), strings.Join(reasons, "; ")))
+	}
+
+	if count == 0 {
+		Print("Nothing retained")
+		return
+	}
+	Print("%d files would be retained (%v)", count, humanizeBytes(size))
+	Print(output.String())
+}
+
+// pruneLastCommit describes the last commit to add the object "oid", from
+// "lastCommits".
+func pruneLastCommit(lastCommits map[string]string, oid string) string {
+	if commit, ok := lastCommits[oid]; ok {
+		return fmt.Sprintf("last added in commit %v", pruneShortSha(commit))
+	}
+	return "not added in any commit"
+}
+
+func pruneShortSha(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
 }
 
 func pruneCheckVerified(prunableObjects []string, reachableObjects, verifiedObjects tools.StringSet) {
@@ -240,19 +316,33 @@ func pruneTaskDisplayProgress(progressChan PruneProgressChan, waitg *sync.WaitGr
 	spinner.Finish(OutputWriter, msg)
 }
 
-func pruneTaskCollectRetained(outRetainedObjects *tools.StringSet, retainChan chan string,
-	progressChan PruneProgressChan, retainwait *sync.WaitGroup) {
+// Collects retained objects, and why each is retained if outRetainReasons
+// isn't nil
+func pruneTaskCollectRetained(outRetainedObjects *tools.StringSet, outRetainReasons map[string][]string,
+	retainChan chan pruneRetained, progressChan PruneProgressChan, retainwait *sync.WaitGroup) {
 
 	defer retainwait.Done()
 
-	for oid := range retainChan {
-		if outRetainedObjects.Add(oid) {
+	for r := range retainChan {
+		if outRetainedObjects.Add(r.Oid) {
 			progressChan <- PruneProgress{PruneProgressTypeRetain, 1}
 		}
+		if outRetainReasons != nil && !pruneHasReason(outRetainReasons[r.Oid], r.Reason) {
+			outRetainReasons[r.Oid] = append(outRetainReasons[r.Oid], r.Reason)
+		}
 	}
 
 }
 
+func pruneHasReason(reasons []string, reason string) bool {
+	for _, r := range reasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
 func pruneTaskCollectErrors(outtaskErrors *[]error, errorChan chan error, errorwait *sync.WaitGroup) {
 	defer errorwait.Done()
 
@@ -299,7 +389,7 @@ func pruneTaskGetLocalObjects(outLocalObjects *[]localstorage.Object, progChan P
 }
 
 // Background task, must call waitg.Done() once at end
-func pruneTaskGetRetainedAtRef(ref string, retainChan chan string, errorChan chan error, waitg *sync.WaitGroup) {
+func pruneTaskGetRetainedAtRef(ref, reason string, retainChan chan pruneRetained, errorChan chan error, waitg *sync.WaitGroup) {
 	defer waitg.Done()
 
 	// Only files AT ref, recent is checked in pruneTaskGetRetainedRecentRefs
@@ -312,7 +402,7 @@ func pruneTaskGetRetainedAtRef(ref string, retainChan chan string, errorChan cha
 		return
 	}
 	for wp := range refchan.Results {
-		retainChan <- wp.Pointer.Oid
+		retainChan <- pruneRetained{wp.Pointer.Oid, reason}
 		tracerx.Printf("RETAIN: %v via ref %v", wp.Pointer.Oid, ref)
 	}
 	err = refchan.Wait()
@@ -322,7 +412,7 @@ func pruneTaskGetRetainedAtRef(ref string, retainChan chan string, errorChan cha
 }
 
 // Background task, must call waitg.Done() once at end
-func pruneTaskGetPreviousVersionsOfRef(ref string, since time.Time, retainChan chan string, errorChan chan error, waitg *sync.WaitGroup) {
+func pruneTaskGetPreviousVersionsOfRef(ref string, since time.Time, retainChan chan pruneRetained, errorChan chan error, waitg *sync.WaitGroup) {
 	defer waitg.Done()
 
 	refchan, err := lfs.ScanPreviousVersionsToChan(ref, since)
@@ -331,7 +421,7 @@ func pruneTaskGetPreviousVersionsOfRef(ref string, since time.Time, retainChan c
 		return
 	}
 	for wp := range refchan.Results {
-		retainChan <- wp.Pointer.Oid
+		retainChan <- pruneRetained{wp.Pointer.Oid, fmt.Sprintf("recent commit %v", pruneShortSha(wp.Commit))}
 		tracerx.Printf("RETAIN: %v via ref %v >= %v", wp.Pointer.Oid, ref, since)
 	}
 	err = refchan.Wait()
@@ -341,12 +431,14 @@ func pruneTaskGetPreviousVersionsOfRef(ref string, since time.Time, retainChan c
 }
 
 // Background task, must call waitg.Done() once at end
-func pruneTaskGetRetainedCurrentAndRecentRefs(fetchconf config.FetchPruneConfig, retainChan chan string, errorChan chan error, waitg *sync.WaitGroup) {
+func pruneTaskGetRetainedCurrentAndRecentRefs(fetchconf config.FetchPruneConfig, retainChan chan pruneRetained, errorChan chan error, waitg *sync.WaitGroup) {
 	defer waitg.Done()
 
 	// We actually increment the waitg in this func since we kick off sub-goroutines
 	// Make a list of what unique commits to keep, & search backward from
 	commits := tools.NewStringSet()
+	// The ref each commit was found from, for its lfs.fetchrecent.*.days
+	commitRefs := make(map[string]*git.Ref)
 	// Do current first
 	ref, err := git.CurrentRef()
 	if err != nil {
@@ -354,8 +446,9 @@ func pruneTaskGetRetainedCurrentAndRecentRefs(fetchconf config.FetchPruneConfig,
 		return
 	}
 	commits.Add(ref.Sha)
+	commitRefs[ref.Sha] = ref
 	waitg.Add(1)
-	go pruneTaskGetRetainedAtRef(ref.Sha, retainChan, errorChan, waitg)
+	go pruneTaskGetRetainedAtRef(ref.Sha, fmt.Sprintf("current checkout (%v)", pruneShortSha(ref.Sha)), retainChan, errorChan, waitg)
 
 	// Now recent
 	if fetchconf.FetchRecentRefsDays > 0 {
@@ -370,32 +463,36 @@ func pruneTaskGetRetainedCurrentAndRecentRefs(fetchconf config.FetchPruneConfig,
 		for _, ref := range refs {
 			if commits.Add(ref.Sha) {
 				// A new commit
+				commitRefs[ref.Sha] = ref
 				waitg.Add(1)
-				go pruneTaskGetRetainedAtRef(ref.Sha, retainChan, errorChan, waitg)
+				go pruneTaskGetRetainedAtRef(ref.Sha, fmt.Sprintf("recent branch %v (%v)", ref.Name, pruneShortSha(ref.Sha)), retainChan, errorChan, waitg)
 			}
 		}
 	}
 
 	// For every unique commit we've fetched, check recent commits too
 	// Only if we're fetching recent commits, otherwise only keep at refs
-	if fetchconf.FetchRecentCommitsDays > 0 {
-		pruneCommitDays := fetchconf.FetchRecentCommitsDays + fetchconf.PruneOffsetDays
-		for commit := range commits.Iter() {
-			// We measure from the last commit at the ref
-			summ, err := git.GetCommitSummary(commit)
-			if err != nil {
-				errorChan <- fmt.Errorf("Couldn't scan commits at %v: %v", commit, err)
-				continue
-			}
-			commitsSince := summ.CommitDate.AddDate(0, 0, -pruneCommitDays)
-			waitg.Add(1)
-			go pruneTaskGetPreviousVersionsOfRef(commit, commitsSince, retainChan, errorChan, waitg)
+	for commit := range commits.Iter() {
+		commitDays := recentCommitsDays(commitRefs[commit])
+		if commitDays == 0 {
+			continue
 		}
+		pruneCommitDays := commitDays + fetchconf.PruneOffsetDays
+
+		// We measure from the last commit at the ref
+		summ, err := git.GetCommitSummary(commit)
+		if err != nil {
+			errorChan <- fmt.Errorf("Couldn't scan commits at %v: %v", commit, err)
+			continue
+		}
+		commitsSince := summ.CommitDate.AddDate(0, 0, -pruneCommitDays)
+		waitg.Add(1)
+		go pruneTaskGetPreviousVersionsOfRef(commit, commitsSince, retainChan, errorChan, waitg)
 	}
 }
 
 // Background task, must call waitg.Done() once at end
-func pruneTaskGetRetainedUnpushed(fetchconf config.FetchPruneConfig, retainChan chan string, errorChan chan error, waitg *sync.WaitGroup) {
+func pruneTaskGetRetainedUnpushed(fetchconf config.FetchPruneConfig, retainChan chan pruneRetained, errorChan chan error, waitg *sync.WaitGroup) {
 	defer waitg.Done()
 
 	remoteName := fetchconf.PruneRemoteName
@@ -406,7 +503,7 @@ func pruneTaskGetRetainedUnpushed(fetchconf config.FetchPruneConfig, retainChan
 		return
 	}
 	for wp := range refchan.Results {
-		retainChan <- wp.Pointer.Oid
+		retainChan <- pruneRetained{wp.Pointer.Oid, fmt.Sprintf("unpushed commit %v", pruneShortSha(wp.Commit))}
 		tracerx.Printf("RETAIN: %v unpushed", wp.Pointer.Oid)
 	}
 	err = refchan.Wait()
@@ -416,7 +513,7 @@ func pruneTaskGetRetainedUnpushed(fetchconf config.FetchPruneConfig, retainChan
 }
 
 // Background task, must call waitg.Done() once at end
-func pruneTaskGetRetainedWorktree(retainChan chan string, errorChan chan error, waitg *sync.WaitGroup) {
+func pruneTaskGetRetainedWorktree(retainChan chan pruneRetained, errorChan chan error, waitg *sync.WaitGroup) {
 	defer waitg.Done()
 
 	// Retain other worktree HEADs too
@@ -441,12 +538,62 @@ func pruneTaskGetRetainedWorktree(retainChan chan string, errorChan chan error,
 			// Worktree is on a different commit
 			waitg.Add(1)
 			// Don't need to 'cd' to worktree since we share same repo
-			go pruneTaskGetRetainedAtRef(ref.Sha, retainChan, errorChan, waitg)
+			go pruneTaskGetRetainedAtRef(ref.Sha, fmt.Sprintf("worktree (%v)", pruneShortSha(ref.Sha)), retainChan, errorChan, waitg)
 		}
 	}
 
 }
 
+// Background task, must call waitg.Done() once at end
+func pruneTaskGetRetainedStashed(retainChan chan pruneRetained, errorChan chan error, waitg *sync.WaitGroup) {
+	defer waitg.Done()
+
+	stashes, err := git.StashCommits()
+	if err != nil {
+		errorChan <- err
+		return
+	}
+	for i, sha := range stashes {
+		reason := fmt.Sprintf("stashed in stash@{%d} (%v)", i, pruneShortSha(sha))
+		// The stash commit has the working copy, and its second parent the
+		// index
+		waitg.Add(2)
+		go pruneTaskGetRetainedAtRef(sha, reason, retainChan, errorChan, waitg)
+		go pruneTaskGetRetainedAtRef(sha+"^2", reason, retainChan, errorChan, waitg)
+	}
+}
+
+// Background task, must call waitg.Done() once at end
+// Scans the history of every ref once, noting the last commit to add each
+// object in outLastCommits and retaining objects at paths matching keepPatterns
+func pruneTaskGetHistory(keepPatterns []string, outLastCommits map[string]string,
+	retainChan chan pruneRetained, errorChan chan error, waitg *sync.WaitGroup) {
+
+	defer waitg.Done()
+
+	pointerchan, err := lfs.ScanHistoryToChan()
+	if err != nil {
+		errorChan <- fmt.Errorf("Error scanning history: %v", err)
+		return
+	}
+
+	keep := lfs.NewPathFilter(keepPatterns, nil)
+	for wp := range pointerchan.Results {
+		// Most recent first
+		if _, ok := outLastCommits[wp.Oid]; !ok {
+			outLastCommits[wp.Oid] = wp.Commit
+		}
+		if len(keepPatterns) > 0 && keep(lfs.NewDownloadable(wp)) {
+			retainChan <- pruneRetained{wp.Oid, fmt.Sprintf("--keep-pattern matches %v", wp.Name)}
+			tracerx.Printf("RETAIN: %v via keep pattern at %v", wp.Oid, wp.Name)
+		}
+	}
+	err = pointerchan.Wait()
+	if err != nil {
+		errorChan <- err
+	}
+}
+
 // Background task, must call waitg.Done() once at end
 func pruneTaskGetReachableObjects(outObjectSet *tools.StringSet, errorChan chan error, waitg *sync.WaitGroup) {
 	defer waitg.Done()
@@ -476,8 +623,10 @@ func pruneTaskGetReachableObjects(outObjectSet *tools.StringSet, errorChan chan
 func init() {
 	RegisterCommand("prune", pruneCommand, func(cmd *cobra.Command) {
 		cmd.Flags().BoolVarP(&pruneDryRunArg, "dry-run", "d", false, "Don't delete anything, just report")
+		cmd.Flags().BoolVar(&pruneDryRunVerboseArg, "dry-run-verbose", false, "Don't delete anything, and report why each file is or isn't retained")
 		cmd.Flags().BoolVarP(&pruneVerboseArg, "verbose", "v", false, "Print full details of what is/would be deleted")
 		cmd.Flags().BoolVarP(&pruneVerifyArg, "verify-remote", "c", false, "Verify that remote has LFS files before deleting")
 		cmd.Flags().BoolVar(&pruneDoNotVerifyArg, "no-verify-remote", false, "Override lfs.pruneverifyremotealways and don't verify")
+		cmd.Flags().StringSliceVar(&pruneKeepPatternArg, "keep-pattern", nil, "Never prune files at paths matching these patterns")
 	})
 }
@@ -26,6 +26,10 @@ func pullCommand(cmd *cobra.Command, args []string) {
 		cfg.CurrentRemote = defaultRemote
 	}
 
+	if err := setEndpointOverride(cfg, endpointArg); err != nil {
+		Exit(err.Error())
+	}
+
 	includeArg, excludeArg := getIncludeExcludeArgs(cmd)
 	pull(determineIncludeExcludePaths(cfg, includeArg, excludeArg))
 
@@ -47,5 +51,7 @@ func init() {
 	RegisterCommand("pull", pullCommand, func(cmd *cobra.Command) {
 		cmd.Flags().StringVarP(&includeArg, "include", "I", "", "Include a list of paths")
 		cmd.Flags().StringVarP(&excludeArg, "exclude", "X", "", "Exclude a list of paths")
+		cmd.Flags().BoolVarP(&quietArg, "quiet", "q", false, "Print a summary instead of a progress bar")
+		cmd.Flags().StringVar(&endpointArg, "endpoint", "", endpointArgHelp)
 	})
 }
@@ -1,8 +1,13 @@
 package commands
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/github/git-lfs/git"
 	"github.com/github/git-lfs/lfs"
@@ -11,10 +16,13 @@ import (
 )
 
 var (
-	pushDryRun    = false
-	pushObjectIDs = false
-	pushAll       = false
-	useStdin      = false
+	pushDryRun      = false
+	pushJSON        = false
+	pushObjectIDs   = false
+	pushAll         = false
+	useStdin        = false
+	pushNoResume    = false
+	pushForceLocked = false
 
 	// shares some global vars and functions with command_pre_push.go
 )
@@ -31,7 +39,7 @@ func uploadsBetweenRefs(ctx *uploadContext, left string, right string) {
 		Panic(err, "Error scanning for Git LFS files")
 	}
 
-	upload(ctx, pointers)
+	upload(ctx, left, pointers)
 }
 
 func uploadsBetweenRefAndRemote(ctx *uploadContext, refnames []string) {
@@ -57,18 +65,63 @@ func uploadsBetweenRefAndRemote(ctx *uploadContext, refnames []string) {
 			Panic(err, "Error scanning for Git LFS files in the %q ref", ref.Name)
 		}
 
-		upload(ctx, pointers)
+		upload(ctx, ref.Name, pointers)
 	}
 }
 
 func uploadsWithObjectIDs(ctx *uploadContext, oids []string) {
-	pointers := make([]*lfs.WrappedPointer, len(oids))
+	pointers := make([]*lfs.WrappedPointer, 0, len(oids))
+
+	for _, oid := range oids {
+		if oid == "-" {
+			read, err := readObjectIDs(os.Stdin)
+			if err != nil {
+				Exit("Error reading object IDs from stdin: %s", err)
+			}
+			pointers = append(pointers, read...)
+			continue
+		}
 
-	for idx, oid := range oids {
-		pointers[idx] = &lfs.WrappedPointer{Pointer: &lfs.Pointer{Oid: oid}}
+		pointers = append(pointers, &lfs.WrappedPointer{Pointer: &lfs.Pointer{Oid: oid}})
 	}
 
-	upload(ctx, pointers)
+	upload(ctx, "", pointers)
+}
+
+// readObjectIDs parses the objects given to `push --object-id -`. Each
+// non-blank line holds an OID, optionally followed by the object's size and
+// the name of the file it was pushed from, separated by spaces.
+func readObjectIDs(r io.Reader) ([]*lfs.WrappedPointer, error) {
+	var pointers []*lfs.WrappedPointer
+
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 3)
+		if !lfs.ValidOid(fields[0]) {
+			return nil, fmt.Errorf("invalid object ID on line %d: %q", lineno, fields[0])
+		}
+
+		p := &lfs.WrappedPointer{Pointer: &lfs.Pointer{Oid: fields[0]}}
+		if len(fields) > 1 {
+			size, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("invalid size on line %d: %q", lineno, fields[1])
+			}
+			p.Size = size
+		}
+		if len(fields) > 2 {
+			p.Name = fields[2]
+		}
+
+		pointers = append(pointers, p)
+	}
+
+	return pointers, scanner.Err()
 }
 
 func refsByNames(refnames []string) ([]*git.Ref, error) {
@@ -110,7 +163,7 @@ func refsByNames(refnames []string) ([]*git.Ref, error) {
 func pushCommand(cmd *cobra.Command, args []string) {
 	if len(args) == 0 {
 		Print("Specify a remote and a remote branch name (`git lfs push origin master`)")
-		os.Exit(1)
+		exit(1)
 	}
 
 	requireGitVersion()
@@ -121,7 +174,14 @@ func pushCommand(cmd *cobra.Command, args []string) {
 	}
 
 	cfg.CurrentRemote = args[0]
+	if err := setEndpointOverride(cfg, endpointArg); err != nil {
+		Exit(err.Error())
+	}
+
 	ctx := newUploadContext(pushDryRun)
+	ctx.Quiet = quietArg
+	ctx.NoResume = pushNoResume
+	ctx.ForcePushLocked = pushForceLocked
 
 	if useStdin {
 		requireStdin("Run this command from the Git pre-push hook, or leave the --stdin flag off.")
@@ -147,7 +207,7 @@ func pushCommand(cmd *cobra.Command, args []string) {
 		uploadsBetweenRefs(ctx, left, right)
 	} else if pushObjectIDs {
 		if len(args) < 2 {
-			Print("Usage: git lfs push --object-id <remote> <lfs-object-id> [lfs-object-id] ...")
+			Print("Usage: git lfs push --object-id <remote> <lfs-object-id|-> [lfs-object-id] ...")
 			return
 		}
 
@@ -160,13 +220,22 @@ func pushCommand(cmd *cobra.Command, args []string) {
 
 		uploadsBetweenRefAndRemote(ctx, args[1:])
 	}
+
+	ctx.ReportDryRun(pushJSON)
+	ctx.ReportAlreadyPresent()
+	ctx.ReportMissing()
 }
 
 func init() {
 	RegisterCommand("push", pushCommand, func(cmd *cobra.Command) {
 		cmd.Flags().BoolVarP(&pushDryRun, "dry-run", "d", false, "Do everything except actually send the updates")
+		cmd.Flags().BoolVarP(&pushJSON, "json", "j", false, "Print the --dry-run report as JSON")
 		cmd.Flags().BoolVarP(&useStdin, "stdin", "s", false, "Take refs on stdin (for pre-push hook)")
+		cmd.Flags().BoolVarP(&quietArg, "quiet", "q", false, "Print a summary instead of a progress bar")
+		cmd.Flags().BoolVarP(&pushNoResume, "no-resume", "", false, "Push every object, even those an interrupted push already uploaded")
+		cmd.Flags().BoolVarP(&pushForceLocked, "force-push-locked", "", false, "Push files even if someone else has locked them")
 		cmd.Flags().BoolVarP(&pushObjectIDs, "object-id", "o", false, "Push LFS object ID(s)")
 		cmd.Flags().BoolVarP(&pushAll, "all", "a", false, "Push all objects for the current ref to the remote.")
+		cmd.Flags().StringVar(&endpointArg, "endpoint", "", endpointArgHelp)
 	})
 }
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	pushTestOidA = "4c48d2a6991c9895bcddcf027e1e4907280bcf21975492b1afbade396d6a3340"
+	pushTestOidB = "82be50ad35070a4ef3467a0a650c52d5b637035e7ad02c36652e59d01ba282b7"
+)
+
+func TestReadObjectIDs(t *testing.T) {
+	pointers, err := readObjectIDs(strings.NewReader(
+		pushTestOidA + "\n\n" +
+			pushTestOidB + " 7 dir/b file.dat\n"))
+
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(pointers)) {
+		assert.Equal(t, pushTestOidA, pointers[0].Oid)
+		assert.Equal(t, int64(0), pointers[0].Size)
+		assert.Equal(t, "", pointers[0].Name)
+
+		assert.Equal(t, pushTestOidB, pointers[1].Oid)
+		assert.Equal(t, int64(7), pointers[1].Size)
+		assert.Equal(t, "dir/b file.dat", pointers[1].Name)
+	}
+}
+
+func TestReadObjectIDsRejectsInvalidOid(t *testing.T) {
+	_, err := readObjectIDs(strings.NewReader(pushTestOidA + "\nabc\n"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, `invalid object ID on line 2: "abc"`, err.Error())
+	}
+}
+
+func TestReadObjectIDsRejectsInvalidSize(t *testing.T) {
+	_, err := readObjectIDs(strings.NewReader(pushTestOidA + " big a.dat\n"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, `invalid size on line 1: "big"`, err.Error())
+	}
+}
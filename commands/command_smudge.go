@@ -57,7 +57,8 @@ func smudgeCommand(cmd *cobra.Command, args []string) {
 		Error(err.Error())
 	}
 
-	download := lfs.FilenamePassesIncludeExcludeFilter(filename, cfg.FetchIncludePaths(), cfg.FetchExcludePaths())
+	filter := fetchFilter(cfg.FetchIncludePaths(), cfg.FetchExcludePaths())
+	download := filter(lfs.NewDownloadable(&lfs.WrappedPointer{Name: filename, Size: ptr.Size, Pointer: ptr}))
 
 	if smudgeSkip || cfg.Os.Bool("GIT_LFS_SKIP_SMUDGE", false) {
 		download = false
@@ -69,12 +70,28 @@ func smudgeCommand(cmd *cobra.Command, args []string) {
 	}
 
 	if err != nil {
-		ptr.Encode(os.Stdout)
 		// Download declined error is ok to skip if we weren't requesting download
-		if !(errors.IsDownloadDeclinedError(err) && !download) {
-			LoggedError(err, "Error downloading object: %s (%s)", filename, ptr.Oid)
-			if !cfg.SkipDownloadErrors() {
-				os.Exit(2)
+		if errors.IsDownloadDeclinedError(err) && !download {
+			ptr.Encode(os.Stdout)
+			return
+		}
+
+		onError := cfg.SmudgeOnError()
+		if onError == "placeholder" {
+			os.Stdout.Write(smudgePlaceholder(ptr))
+		} else {
+			ptr.Encode(os.Stdout)
+		}
+
+		LoggedError(err, "Error downloading object: %s (%s)", filename, ptr.Oid)
+		if onError == "error" {
+			exit(2)
+		}
+
+		if len(args) > 0 {
+			f := &incompleteFile{Name: args[0], Oid: ptr.Oid, Size: ptr.Size}
+			if err := recordIncompleteFile(incompleteFilesPath(), f); err != nil {
+				Error("Unable to record %s as incomplete: %s", args[0], err)
 			}
 		}
 	}
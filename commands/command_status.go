@@ -1,20 +1,68 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 
+	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/errors"
 	"github.com/github/git-lfs/git"
 	"github.com/github/git-lfs/lfs"
 	"github.com/spf13/cobra"
 )
 
 var (
-	porcelain = false
+	porcelain        = false
+	statusJSONFlag   = false
+	statusRemoteFlag = false
 )
 
+// Transfer states of the objects listed by status.
+const (
+	// statusMissing means that the object isn't in the local media
+	// directory.
+	statusMissing = "missing"
+	// statusLocal means that the object is in the local media directory,
+	// and --remote wasn't given to check whether the server has it too.
+	statusLocal = "local"
+	// statusLocalOnly means that the object is in the local media
+	// directory, but the server doesn't have it.
+	statusLocalOnly = "local-only"
+	// statusUploaded means that the object is in the local media directory
+	// and on the server.
+	statusUploaded = "uploaded"
+)
+
+// statusEntry is a file listed by status.
+type statusEntry struct {
+	// Section is where the file is listed: "head" for files in the
+	// current commit, "push" for objects to be pushed, "staged" for those
+	// to be committed, "unstaged" for files not staged for commit, or
+	// "incomplete" for files which smudge left holding their pointer or a
+	// placeholder, since their objects couldn't be downloaded.
+	Section string `json:"section"`
+	// Status is the status letter given by git diff-index, if any.
+	Status  string `json:"status,omitempty"`
+	Name    string `json:"name"`
+	SrcName string `json:"src_name,omitempty"`
+	Oid     string `json:"oid,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	// State is the transfer state of the object. For files not staged
+	// for commit, the object is the one their content in the working tree
+	// would be stored as; those which can't be read have none.
+	State string `json:"state,omitempty"`
+}
+
 func statusCommand(cmd *cobra.Command, args []string) {
 	requireInRepo()
 
+	if porcelain && statusJSONFlag {
+		Exit("Cannot use --porcelain and --json together.")
+	}
+
 	ref, err := git.CurrentRef()
 	if err != nil {
 		Panic(err, "Could not get the current ref")
@@ -39,41 +87,255 @@ func statusCommand(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	Print("On branch %s", ref.Name)
+	headPointers, err := lfs.ScanTree(ref.Sha)
+	if err != nil {
+		Panic(err, "Could not scan for Git LFS files")
+	}
 
+	var pushPointers []*lfs.WrappedPointer
 	remoteRef, err := git.CurrentRemoteRef()
 	if err == nil {
-
-		pointers, err := lfs.ScanRefs(ref.Sha, "^"+remoteRef.Sha, nil)
+		pushPointers, err = lfs.ScanRefs(ref.Sha, "^"+remoteRef.Sha, nil)
 		if err != nil {
 			Panic(err, "Could not scan for Git LFS objects")
 		}
+	}
+
+	entries := statusEntries(headPointers, pushPointers, stagedPointers)
+	entries = append(entries, incompleteStatusEntries()...)
+	if statusRemoteFlag {
+		checkStatusRemote(entries)
+	}
+
+	if statusJSONFlag {
+		if entries == nil {
+			entries = []*statusEntry{}
+		}
+		if err := json.NewEncoder(os.Stdout).Encode(entries); err != nil {
+			ExitWithError(err)
+		}
+		return
+	}
+
+	Print("On branch %s", ref.Name)
 
-		Print("Git LFS objects to be pushed to %s:\n", remoteRef.Name)
-		for _, p := range pointers {
-			Print("\t%s (%s)", p.Name, humanizeBytes(p.Size))
+	Print("\nGit LFS objects in %s:\n", ref.Name)
+	for _, e := range entries {
+		if e.Section == "head" {
+			Print("\t%s (%s)", e.Name, statusDetails(e))
+		}
+	}
+
+	if remoteRef != nil {
+		Print("\nGit LFS objects to be pushed to %s:\n", remoteRef.Name)
+		for _, e := range entries {
+			if e.Section == "push" {
+				Print("\t%s (%s)", e.Name, statusDetails(e))
+			}
 		}
 	}
 
 	Print("\nGit LFS objects to be committed:\n")
-	for _, p := range stagedPointers {
-		switch p.Status {
+	for _, e := range entries {
+		if e.Section != "staged" {
+			continue
+		}
+		switch e.Status {
 		case "R", "C":
-			Print("\t%s -> %s (%s)", p.SrcName, p.Name, humanizeBytes(p.Size))
-		case "M":
+			Print("\t%s -> %s (%s)", e.SrcName, e.Name, statusDetails(e))
 		default:
-			Print("\t%s (%s)", p.Name, humanizeBytes(p.Size))
+			Print("\t%s (%s)", e.Name, statusDetails(e))
 		}
 	}
 
 	Print("\nGit LFS objects not staged for commit:\n")
+	for _, e := range entries {
+		if e.Section != "unstaged" {
+			continue
+		}
+		if e.State == "" {
+			Print("\t%s", e.Name)
+		} else {
+			Print("\t%s (%s)", e.Name, statusDetails(e))
+		}
+	}
+
+	var incomplete []*statusEntry
+	for _, e := range entries {
+		if e.Section == "incomplete" {
+			incomplete = append(incomplete, e)
+		}
+	}
+	if len(incomplete) > 0 {
+		Print("\nGit LFS files not downloaded:")
+		Print("  (use \"git lfs pull\" to download them)\n")
+		for _, e := range incomplete {
+			Print("\t%s (%s)", e.Name, statusDetails(e))
+		}
+	}
+
+	Print("")
+}
+
+// statusEntries lists the files of "headPointers", which are in the current
+// commit, the objects of "pushPointers", which are to be pushed, and the files
+// of "stagedPointers", from lfs.ScanIndex, in the order status prints them,
+// with the state of each object in the local media directory.
+func statusEntries(headPointers, pushPointers, stagedPointers []*lfs.WrappedPointer) []*statusEntry {
+	var entries []*statusEntry
+	for _, p := range headPointers {
+		entries = append(entries, &statusEntry{
+			Section: "head",
+			Name:    p.Name,
+			Oid:     p.Oid,
+			Size:    p.Size,
+			State:   localStatusState(p),
+		})
+	}
+
+	for _, p := range pushPointers {
+		entries = append(entries, &statusEntry{
+			Section: "push",
+			Name:    p.Name,
+			Oid:     p.Oid,
+			Size:    p.Size,
+			State:   localStatusState(p),
+		})
+	}
+
+	for _, p := range stagedPointers {
+		if p.Status == "M" {
+			continue
+		}
+		e := &statusEntry{
+			Section: "staged",
+			Status:  p.Status,
+			Name:    p.Name,
+			Oid:     p.Oid,
+			Size:    p.Size,
+			State:   localStatusState(p),
+		}
+		if p.Status == "R" || p.Status == "C" {
+			e.SrcName = p.SrcName
+		}
+		entries = append(entries, e)
+	}
+
 	for _, p := range stagedPointers {
 		if p.Status == "M" {
-			Print("\t%s", p.Name)
+			entries = append(entries, unstagedStatusEntry(p))
 		}
 	}
 
-	Print("")
+	return entries
+}
+
+// unstagedStatusEntry lists the file of "p", which has changes not staged for
+// commit, with the object its content in the working tree would be stored as,
+// or the object of its pointer if it holds one. A file which can't be read is
+// listed without an object.
+func unstagedStatusEntry(p *lfs.WrappedPointer) *statusEntry {
+	e := &statusEntry{Section: "unstaged", Status: p.Status, Name: p.Name}
+
+	filename := filepath.Join(config.LocalWorkingDir, filepath.FromSlash(p.Name))
+	fi, err := os.Stat(filename)
+	if err != nil || !fi.Mode().IsRegular() {
+		return e
+	}
+
+	if ptr, err := lfs.DecodePointerFromFile(filename); err == nil {
+		e.Oid, e.Size = ptr.Oid, ptr.Size
+	} else if oid, err := hashObject(filename); err == nil {
+		e.Oid, e.Size = oid, fi.Size()
+	} else {
+		return e
+	}
+
+	e.State = localStatusState(&lfs.WrappedPointer{Size: e.Size, Pointer: lfs.NewPointer(e.Oid, e.Size, nil)})
+	return e
+}
+
+// incompleteStatusEntries lists the files which smudge left incomplete, and
+// which still hold their pointer or placeholder, sorted by name.
+func incompleteStatusEntries() []*statusEntry {
+	files, err := loadIncompleteFiles(incompleteFilesPath())
+	if err != nil {
+		LoggedError(err, "Unable to read the list of incomplete files")
+		return nil
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var entries []*statusEntry
+	for _, name := range names {
+		f := files[name]
+		p := &lfs.WrappedPointer{Name: name, Size: f.Size, Pointer: lfs.NewPointer(f.Oid, f.Size, nil)}
+		if !isIncomplete(filepath.Join(config.LocalWorkingDir, filepath.FromSlash(name)), p.Pointer) {
+			continue
+		}
+
+		entries = append(entries, &statusEntry{
+			Section: "incomplete",
+			Name:    name,
+			Oid:     f.Oid,
+			Size:    f.Size,
+			State:   localStatusState(p),
+		})
+	}
+	return entries
+}
+
+func localStatusState(p *lfs.WrappedPointer) string {
+	if lfs.ObjectExistsOfSize(p.Oid, p.Size) {
+		return statusLocal
+	}
+	return statusMissing
+}
+
+// checkStatusRemote asks the server of the remote that the current branch
+// tracks which of the local objects in "entries" it has, and updates their
+// state to match.
+func checkStatusRemote(entries []*statusEntry) {
+	var pointers []*lfs.WrappedPointer
+	for _, e := range entries {
+		if e.State == statusLocal {
+			pointers = append(pointers, &lfs.WrappedPointer{Name: e.Name, Size: e.Size, Pointer: lfs.NewPointer(e.Oid, e.Size, nil)})
+		}
+	}
+
+	// Check the remote which the objects would be pushed to.
+	if remote, err := git.RemoteForCurrentBranch(); err == nil && len(remote) > 0 {
+		cfg.CurrentRemote = remote
+	}
+
+	uploaded, err := lfs.RemoteObjects(cfg, pointers)
+	if err != nil {
+		ExitWithError(errors.Wrapf(err, "Could not check %s for Git LFS objects", cfg.CurrentRemote))
+	}
+
+	for _, e := range entries {
+		if e.State != statusLocal {
+			continue
+		}
+		if uploaded.Contains(e.Oid) {
+			e.State = statusUploaded
+		} else {
+			e.State = statusLocalOnly
+		}
+	}
+}
+
+// statusDetails describes the object of "e" for people to read: its size,
+// and its state unless that's the unremarkable "local".
+func statusDetails(e *statusEntry) string {
+	if e.State == statusLocal {
+		return humanizeBytes(e.Size)
+	}
+	return fmt.Sprintf("%s, %s", humanizeBytes(e.Size), e.State)
 }
 
 var byteUnits = []string{"B", "KB", "MB", "GB", "TB"}
@@ -99,5 +361,7 @@ func humanizeBytes(bytes int64) string {
 func init() {
 	RegisterCommand("status", statusCommand, func(cmd *cobra.Command) {
 		cmd.Flags().BoolVarP(&porcelain, "porcelain", "p", false, "Give the output in an easy-to-parse format for scripts.")
+		cmd.Flags().BoolVarP(&statusJSONFlag, "json", "j", false, "Give the output as JSON, with the transfer state of each object.")
+		cmd.Flags().BoolVarP(&statusRemoteFlag, "remote", "r", false, "Check which objects the server already has.")
 	})
 }
@@ -2,86 +2,202 @@ package commands
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
-	"time"
 
 	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/errors"
 	"github.com/github/git-lfs/git"
 
 	"github.com/github/git-lfs/lfs"
+	"github.com/github/git-lfs/tools"
 	"github.com/spf13/cobra"
 )
 
 var (
-	prefixBlocklist = []string{
-		".git", ".lfs",
+	// reservedFiles are the files which git and Git LFS read themselves,
+	// and so can't be stored in Git LFS.
+	reservedFiles = []string{
+		".gitattributes", ".gitignore", ".gitmodules", ".lfsconfig",
 	}
 
 	trackVerboseLoggingFlag bool
 	trackDryRunFlag         bool
+	trackLockableFlag       bool
+	trackNotLockableFlag    bool
+	trackFilenameFlag       bool
+	trackStdinFlag          bool
+	trackFromFileFlag       string
+	trackPatternsFromFlag   string
+	trackJSONFlag           bool
+	trackPorcelainFlag      bool
+	trackLocalFlag          bool
+	trackInfoFlag           bool
+	trackTouchFlag          bool
+	trackNoTouchFlag        bool
 )
 
+// lockableAttribute is the attribute which marks files as lockable, so that
+// they are checked out read-only until they are locked.
+const lockableAttribute = "lockable"
+
 func trackCommand(cmd *cobra.Command, args []string) {
 	requireGitVersion()
 
 	if config.LocalGitDir == "" {
 		Print("Not a git repository.")
-		os.Exit(128)
+		exit(128)
 	}
 
 	if config.LocalWorkingDir == "" {
 		Print("This operation must be run in a work tree.")
-		os.Exit(128)
+		exit(128)
 	}
 
-	lfs.InstallHooks(false)
-	knownPaths := findPaths()
+	if trackLockableFlag && trackNotLockableFlag {
+		Exit("Cannot use --lockable and --not-lockable together.")
+	}
+
+	if trackTouchFlag && trackNoTouchFlag {
+		Exit("Cannot use --touch and --no-touch together.")
+	}
+
+	if trackLocalFlag && trackInfoFlag {
+		Exit("Cannot use --local and --info together.")
+	}
 
-	if len(args) == 0 {
-		Print("Listing tracked paths")
-		for _, t := range knownPaths {
-			Print("    %s (%s)", t.Path, t.Source)
+	// --patterns-from is another name for --from-file.
+	if len(trackPatternsFromFlag) > 0 {
+		if len(trackFromFileFlag) > 0 && trackFromFileFlag != trackPatternsFromFlag {
+			Exit("Cannot use --from-file and --patterns-from with different files.")
 		}
-		return
+		trackFromFileFlag = trackPatternsFromFlag
 	}
 
-	addTrailingLinebreak := needsTrailingLinebreak(".gitattributes")
-	attributesFile, err := os.OpenFile(".gitattributes", os.O_RDWR|os.O_APPEND|os.O_CREATE, 0660)
-	if err != nil {
-		Print("Error opening .gitattributes file")
-		return
+	readPatterns := trackStdinFlag || len(trackFromFileFlag) > 0
+	if readPatterns {
+		patterns, err := trackPatternsFromFlags()
+		if err != nil {
+			Exit(err.Error())
+		}
+		args = append(args, patterns...)
 	}
-	defer attributesFile.Close()
 
-	if addTrailingLinebreak {
-		if _, err := attributesFile.WriteString("\n"); err != nil {
-			Print("Error writing to .gitattributes")
+	lfs.InstallHooks(false)
+	knownPaths := findPaths()
+
+	if len(args) == 0 && !readPatterns {
+		if err := listTrackedPaths(os.Stdout, knownPaths); err != nil {
+			Exit(err.Error())
 		}
+		return
 	}
 
 	wd, _ := os.Getwd()
+	wd = tools.ResolveSymlinks(wd)
 	relpath, err := filepath.Rel(config.LocalWorkingDir, wd)
 	if err != nil {
 		Exit("Current directory %q outside of git working directory %q.", wd, config.LocalWorkingDir)
 	}
 
+	// Check all of the patterns before any are added, so that none are if
+	// one is invalid.
+	for i, pattern := range args {
+		normalized, notes, err := normalizeTrackPattern(pattern, relpath, config.LocalWorkingDir, trackLocalFlag, runtime.GOOS == "windows")
+		if err != nil {
+			Exit(err.Error())
+		}
+		for _, note := range notes {
+			Error(note)
+		}
+		args[i] = normalized
+	}
+
+	// Patterns go in the .gitattributes file at the root of the working
+	// tree, unless --local asks for the one in the current directory, or
+	// --info for the repository's info/attributes file, which isn't
+	// committed.
+	attributesPath := filepath.Join(config.LocalWorkingDir, ".gitattributes")
+	switch {
+	case trackLocalFlag:
+		attributesPath = ".gitattributes"
+	case trackInfoFlag:
+		attributesPath = repoAttributesPath()
+		if !trackDryRunFlag {
+			if err := os.MkdirAll(filepath.Dir(attributesPath), 0755); err != nil {
+				Exit("Error creating %s: %s", filepath.Dir(attributesPath), err)
+			}
+		}
+	}
+
+	// Lines are added with the same line endings as the rest of the file.
+	eol := "\n"
+
+	var attributesFile *os.File
+	if !trackDryRunFlag {
+		eol = attributesLineEnding(attributesPath)
+		linebreak := trailingLinebreak(attributesPath, eol)
+		f, err := os.OpenFile(attributesPath, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0660)
+		if err != nil {
+			Print("Error opening .gitattributes file")
+			return
+		}
+		defer f.Close()
+		attributesFile = f
+
+		if len(linebreak) > 0 {
+			if _, err := attributesFile.WriteString(linebreak); err != nil {
+				Print("Error writing to .gitattributes")
+			}
+		}
+	}
+
+	// The patterns which are added, to look for files which were already
+	// committed without Git LFS once they all have been.
+	var added []*addedPattern
+
 ArgsLoop:
 	for _, pattern := range args {
+		if trackFilenameFlag {
+			pattern = escapeGlobCharacters(pattern)
+		}
+
 		for _, known := range knownPaths {
-			if known.Path == filepath.Join(relpath, pattern) {
-				Print("%s already supported", pattern)
+			if known.Path == filepath.Join(relpath, encodeAttributesPattern(pattern)) {
+				updateTrackedLockable(known, pattern)
 				continue ArgsLoop
 			}
 		}
 
+		// The pattern as it is written to the .gitattributes file, and
+		// the pathspec which finds the files it matches. Outside of the
+		// root, the pathspec is given from the top of the working tree,
+		// with "*" not matching slashes, so that it matches the same
+		// files as the written pattern.
+		linePattern, lookup := pattern, pattern
+		if !trackLocalFlag && relpath != "." {
+			linePattern = rootRelativePattern(relpath, pattern)
+			lookup = ":(top,glob)" + linePattern
+		}
+
+		if known, ok := coveringPath(knownPaths, newAddedPattern(relpath, pattern, linePattern)); ok {
+			Print("%s already supported by %s (%s)", pattern, known.pattern, known.Source)
+			continue
+		}
+
 		// Make sure any existing git tracked files have their timestamp updated
 		// so they will now show as modifed
-		// note this is relative to current dir which is how we write .gitattributes
-		// deliberately not done in parallel as a chan because we'll be marking modified
+		// note this is relative to current dir, as are the paths from ls-files
+		// (unless --no-touch is given)
 		//
 		// NOTE: `git ls-files` does not do well with leading slashes.
 		// Since all `git-lfs track` calls are relative to the root of
@@ -90,7 +206,7 @@ ArgsLoop:
 		if trackVerboseLoggingFlag {
 			Print("Searching for files matching pattern: %s", pattern)
 		}
-		gittracked, err := git.GetTrackedFiles(pattern)
+		gittracked, err := git.GetTrackedFiles(lookup)
 		if err != nil {
 			LoggedError(err, "Error getting git tracked files")
 			continue
@@ -98,73 +214,511 @@ ArgsLoop:
 		if trackVerboseLoggingFlag {
 			Print("Found %d files previously added to Git matching pattern: %s", len(gittracked), pattern)
 		}
-		now := time.Now()
 
-		var matchedBlocklist bool
+		// Forbidden files are excluded from a pattern which matches
+		// others, but a pattern which only matches forbidden files isn't
+		// tracked at all.
+		var allowed, blocked []string
 		for _, f := range gittracked {
 			if forbidden := blocklistItem(f); forbidden != "" {
-				Print("Pattern %s matches forbidden file %s. If you would like to track %s, modify .gitattributes manually.", pattern, f, f)
-				matchedBlocklist = true
+				blocked = append(blocked, f)
+			} else {
+				allowed = append(allowed, f)
 			}
-
 		}
-		if matchedBlocklist {
+		onlyBlocked := len(blocked) > 0 && len(allowed) == 0
+		blocked = withOwnAttributesFile(blocked, relpath, pattern, linePattern)
+
+		if trackDryRunFlag {
+			var lines []string
+			if !onlyBlocked {
+				lines = trackLines(relpath, linePattern, blocked)
+			}
+			touched := allowed
+			if trackNoTouchFlag {
+				touched = nil
+			}
+			printTrackDryRun(pattern, newTrackedPath(relpath, pattern, linePattern).Source, lines, touched, blocked)
+			if !onlyBlocked {
+				knownPaths = append(knownPaths, newTrackedPath(relpath, pattern, linePattern))
+				added = append(added, newAddedPattern(relpath, pattern, linePattern))
+				if len(allowed) == 0 {
+					warnIgnoredDirectory(relpath, pattern)
+				}
+			}
 			continue
 		}
 
-		if !trackDryRunFlag {
-			encodedArg := strings.Replace(pattern, " ", "[[:space:]]", -1)
-			_, err := attributesFile.WriteString(fmt.Sprintf("%s filter=lfs diff=lfs merge=lfs -text\n", encodedArg))
-			if err != nil {
-				Print("Error adding path %s", pattern)
-				continue
+		if onlyBlocked {
+			for _, f := range blocked {
+				Print("Pattern %s matches forbidden file %s. If you would like to track %s, modify .gitattributes manually.", pattern, f, f)
 			}
+			continue
+		}
+
+		_, err = attributesFile.WriteString(strings.Join(trackLines(relpath, linePattern, blocked), eol) + eol)
+		if err != nil {
+			Print("Error adding path %s", pattern)
+			continue
 		}
 		Print("Tracking %s", pattern)
+		for _, f := range blocked {
+			Print("  Excluded forbidden file %s, which can't be stored in Git LFS", f)
+		}
+		// Patterns may be given more than once, especially when they
+		// are read with --stdin or --from-file.
+		knownPaths = append(knownPaths, newTrackedPath(relpath, pattern, linePattern))
+		added = append(added, newAddedPattern(relpath, pattern, linePattern))
 
-		for _, f := range gittracked {
-			if trackVerboseLoggingFlag || trackDryRunFlag {
-				Print("Git LFS: touching %s", f)
+		if !trackNoTouchFlag {
+			touchTrackedFiles(allowed)
+		}
+
+		if len(allowed) == 0 {
+			warnIgnoredDirectory(relpath, pattern)
+		}
+	}
+
+	warnCommittedFiles(added)
+}
+
+// warnIgnoredDirectory warns when "pattern", given in the directory "relpath",
+// only matches files in a directory which git ignores. Files there are never
+// added, so tracking them does nothing, unless they were added before they
+// were ignored, which is why only patterns without any such files are checked.
+func warnIgnoredDirectory(relpath, pattern string) {
+	dir := patternDirectory(rootRelativePattern(relpath, pattern))
+	if len(dir) == 0 {
+		return
+	}
+
+	// git check-ignore takes paths relative to the current directory, and
+	// checks them as directories with a trailing slash.
+	name, err := filepath.Rel(relpath, filepath.FromSlash(dir))
+	if err != nil {
+		return
+	}
+
+	ignore, source, err := git.IgnoredBy(filepath.ToSlash(name) + "/")
+	if err != nil {
+		LoggedError(err, "Error checking whether %s is ignored", dir)
+		return
+	}
+	if len(ignore) == 0 {
+		return
+	}
+
+	Error("Warning: %s/ is ignored by %s (%s), so files matching %s won't be added to Git, or stored in Git LFS.", dir, source, ignore, pattern)
+}
+
+// newTrackedPath returns the mediaPath for "pattern", given in the directory
+// "relpath", once it has been added as "linePattern" to the root .gitattributes
+// file, the one in "relpath" with --local, or info/attributes with --info.
+func newTrackedPath(relpath, pattern, linePattern string) mediaPath {
+	p := newAddedPattern(relpath, pattern, linePattern)
+
+	source := filepath.Join(p.dir, ".gitattributes")
+	if trackInfoFlag {
+		source, _ = filepath.Rel(config.LocalWorkingDir, repoAttributesPath())
+	}
+
+	return mediaPath{
+		Path:     filepath.Join(relpath, encodeAttributesPattern(pattern)),
+		Source:   source,
+		Lockable: trackLockableFlag,
+		dir:      p.dir,
+		pattern:  p.pattern,
+	}
+}
+
+// coveringPath returns the tracked path in "paths" which already covers "p",
+// if there is one. Paths which aren't lockable don't cover patterns tracked
+// with --lockable.
+func coveringPath(paths []mediaPath, p *addedPattern) (mediaPath, bool) {
+	for _, m := range paths {
+		if trackLockableFlag && !m.Lockable {
+			continue
+		}
+		if (&addedPattern{dir: m.dir, pattern: m.pattern}).covers(p) {
+			return m, true
+		}
+	}
+	return mediaPath{}, false
+}
+
+// newAddedPattern returns the addedPattern for "pattern", given in
+// the directory "relpath", and written to .gitattributes as "linePattern".
+func newAddedPattern(relpath, pattern, linePattern string) *addedPattern {
+	dir := "."
+	if trackLocalFlag {
+		dir = relpath
+	}
+	return &addedPattern{dir: dir, pattern: linePattern, arg: pattern}
+}
+
+// rootRelativePattern returns "pattern", given in the directory "relpath",
+// relative to the root of the working tree. Since it then contains a slash,
+// git matches it from the root rather than against the basename, as it would
+// for a pattern without one in the .gitattributes file in "relpath".
+func rootRelativePattern(relpath, pattern string) string {
+	if relpath == "." {
+		return pattern
+	}
+	return path.Join(filepath.ToSlash(relpath), pattern)
+}
+
+// trackPatternsFromFlags reads the patterns to track from STDIN for --stdin,
+// or from the file given with --from-file.
+func trackPatternsFromFlags() ([]string, error) {
+	if trackStdinFlag {
+		if len(trackFromFileFlag) > 0 {
+			return nil, errors.New("Cannot use --stdin and --from-file together.")
+		}
+
+		requireStdin("The --stdin flag expects patterns from STDIN.")
+		return readTrackPatterns(os.Stdin)
+	}
+
+	f, err := os.Open(trackFromFileFlag)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error opening %s", trackFromFileFlag)
+	}
+	defer f.Close()
+
+	return readTrackPatterns(f)
+}
+
+// readTrackPatterns reads patterns to track from "r", one per line. Blank
+// lines, and comments starting with "#", are ignored.
+func readTrackPatterns(r io.Reader) ([]string, error) {
+	var patterns []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		pattern := strings.TrimSpace(scanner.Text())
+		if len(pattern) == 0 || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, scanner.Err()
+}
+
+// trackAttributesLine returns the line which is added to .gitattributes to
+// track the given pattern, marking it lockable if "lockable" is set.
+func trackAttributesLine(pattern string, lockable bool) string {
+	attrs := []string{"filter=lfs", "diff=lfs", "merge=lfs", "-text"}
+	if lockable {
+		attrs = withLockable(attrs)
+	}
+	return encodeAttributesPattern(pattern) + " " + strings.Join(attrs, " ")
+}
+
+// withLockable returns "attrs" with the lockable attribute added before -text,
+// where track writes it, or at the end if there's no -text.
+func withLockable(attrs []string) []string {
+	for i, attr := range attrs {
+		if attr == "-text" {
+			lockable := append([]string{}, attrs[:i]...)
+			lockable = append(lockable, lockableAttribute)
+			return append(lockable, attrs[i:]...)
+		}
+	}
+	return append(attrs, lockableAttribute)
+}
+
+// withOwnAttributesFile adds the .gitattributes file which "pattern", given in
+// the directory "relpath", is added to as "linePattern" to the forbidden files
+// "blocked", relative to "relpath", if the pattern matches it and it isn't
+// there already. It isn't found with the other files until it is committed.
+func withOwnAttributesFile(blocked []string, relpath, pattern, linePattern string) []string {
+	if trackInfoFlag {
+		return blocked
+	}
+
+	own := filepath.ToSlash(newTrackedPath(relpath, pattern, linePattern).Source)
+	if !newAddedPattern(relpath, pattern, linePattern).matches(own, false) {
+		return blocked
+	}
+
+	for _, f := range blocked {
+		if path.Join(filepath.ToSlash(relpath), filepath.ToSlash(f)) == own {
+			return blocked
+		}
+	}
+
+	name, err := filepath.Rel(relpath, filepath.FromSlash(own))
+	if err != nil {
+		return blocked
+	}
+	return append(blocked, name)
+}
+
+// trackLines returns the lines which are added to the attributes file to track
+// "linePattern": its own, followed by one for each of the forbidden files in
+// "blocked", relative to the current directory "relpath", which it matches,
+// so that they aren't stored in Git LFS.
+func trackLines(relpath, linePattern string, blocked []string) []string {
+	lines := []string{trackAttributesLine(linePattern, trackLockableFlag)}
+	for _, f := range blocked {
+		lines = append(lines, excludedAttributesLine(relpath, f))
+	}
+	return lines
+}
+
+// excludedAttributesLine returns the line which stops the patterns before it
+// from applying the Git LFS attributes to the file "name", relative to the
+// current directory "relpath". Its pattern is anchored, so that it only
+// matches that file.
+func excludedAttributesLine(relpath, name string) string {
+	p := filepath.ToSlash(name)
+	if !trackLocalFlag {
+		p = path.Join(filepath.ToSlash(relpath), p)
+	}
+	return fmt.Sprintf("%s !filter !diff !merge !text", encodeAttributesPattern(escapeGlobCharacters("/"+p)))
+}
+
+// encodeAttributesPattern encodes the spaces in "pattern", which would
+// otherwise end it, as it is written to .gitattributes.
+func encodeAttributesPattern(pattern string) string {
+	return strings.Replace(pattern, " ", "[[:space:]]", -1)
+}
+
+// escapeGlobCharacters escapes the characters in "filename" which Git would
+// treat as wildcards, or as a comment or negation at its start, so that it
+// matches only the file with that name, for --filename.
+func escapeGlobCharacters(filename string) string {
+	var escaped bytes.Buffer
+	for i, c := range filename {
+		switch c {
+		case '[', ']', '*', '?':
+			escaped.WriteRune('\\')
+		case '#', '!':
+			if i == 0 {
+				escaped.WriteRune('\\')
 			}
+		}
+		escaped.WriteRune(c)
+	}
+	return escaped.String()
+}
 
-			if !trackDryRunFlag {
-				err := os.Chtimes(f, now, now)
-				if err != nil {
-					LoggedError(err, "Error marking %q modified", f)
-					continue
-				}
+// updateTrackedLockable handles tracking a pattern which is already tracked
+// by "known". If --lockable or --not-lockable asks for it to be changed, the
+// line tracking it is rewritten in place, otherwise there is nothing to do.
+func updateTrackedLockable(known mediaPath, pattern string) {
+	lockable := known.Lockable
+	switch {
+	case trackLockableFlag:
+		lockable = true
+	case trackNotLockableFlag:
+		lockable = false
+	}
+
+	if lockable == known.Lockable {
+		Print("%s already supported", pattern)
+		return
+	}
+
+	verb := "lockable"
+	if !lockable {
+		verb = "not lockable"
+	}
+
+	if trackDryRunFlag {
+		Print("Would make %s %s in %s", pattern, verb, known.Source)
+		return
+	}
+
+	if err := setLockable(known, lockable); err != nil {
+		LoggedError(err, "Error updating %s", known.Source)
+		return
+	}
+	Print("Made %s %s", pattern, verb)
+}
+
+// setLockable rewrites the attributes file which tracks "known", adding the
+// lockable attribute to the line for its pattern, or removing it, according
+// to "lockable". All other lines are left as they are.
+func setLockable(known mediaPath, lockable bool) error {
+	return rewriteAttributesFile(known.Source, func(pattern string, fields []string) []string {
+		if pattern != known.Path {
+			return fields
+		}
+
+		attrs := make([]string, 0, len(fields))
+		for _, f := range fields {
+			if f != lockableAttribute {
+				attrs = append(attrs, f)
 			}
 		}
+		if lockable {
+			attrs = withLockable(attrs)
+		}
+		return attrs
+	})
+}
+
+// rewriteAttributesFile rewrites the attributes file "relfile", relative to
+// the root of the working tree. Each line which tracks a pattern through Git
+// LFS is split into fields, and replaced by the fields "rewrite" returns for
+// it, or removed if they leave the pattern without any attributes. "rewrite"
+// is also given the line's
+// pattern, relative to the root of the working tree, as findPaths reports it.
+// Other lines, the file's line endings and any byte order mark are kept.
+func rewriteAttributesFile(relfile string, rewrite func(pattern string, fields []string) []string) error {
+	path := filepath.Join(config.LocalWorkingDir, relfile)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	lines, bom := splitAttributesLines(data)
+	rewritten := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if !strings.Contains(line, "filter=lfs") {
+			rewritten = append(rewritten, line)
+			continue
+		}
+
+		fields := strings.Fields(line)
+		fields = rewrite(attributesPattern(relfile, fields[0]), fields)
+		if len(fields) > 1 {
+			rewritten = append(rewritten, strings.Join(fields, " "))
+		}
+	}
+
+	out := strings.Join(rewritten, detectLineEnding(data))
+	if bom {
+		out = utf8BOM + out
+	}
+	return ioutil.WriteFile(path, []byte(out), 0660)
+}
+
+// printTrackDryRun previews what tracking the given pattern would do: either
+// the lines it would add to the attributes file "source", the forbidden files
+// they exclude, and the files it would mark as modified, or, if there are no
+// lines because it only matches forbidden files, those files.
+func printTrackDryRun(pattern, source string, lines, matched, blocked []string) {
+	if len(lines) == 0 {
+		Print("Would not track %s, it matches forbidden files:", pattern)
+		for _, f := range blocked {
+			Print("    %s", f)
+		}
+		Print("  To track these files, modify .gitattributes manually.")
+		return
+	}
+
+	Print("Would track %s", pattern)
+	Print("  Add to %s:", source)
+	for _, line := range lines {
+		Print("    %s", line)
+	}
+
+	if len(blocked) > 0 {
+		Print("  Exclude forbidden files:")
+		for _, f := range blocked {
+			Print("    %s", f)
+		}
+	}
+
+	if len(matched) == 0 {
+		Print("  No files to mark as modified.")
+		return
+	}
+
+	Print("  Mark as modified:")
+	for _, f := range matched {
+		Print("    %s", f)
 	}
 }
 
 type mediaPath struct {
-	Path   string
-	Source string
+	Path     string `json:"pattern"`
+	Source   string `json:"source"`
+	Line     int    `json:"line"`
+	Lockable bool   `json:"lockable"`
+
+	// dir is the directory, relative to the root of the working tree,
+	// which the pattern is matched from, and pattern is as it is written
+	// in the attributes file.
+	dir     string
+	pattern string
+}
+
+// listTrackedPaths writes "paths" to "w", sorted by source and then pattern,
+// as a JSON array for --json, as tab-separated columns of the pattern, source,
+// line and lockable status for --porcelain, or otherwise as a list for people
+// to read.
+func listTrackedPaths(w io.Writer, paths []mediaPath) error {
+	if trackJSONFlag && trackPorcelainFlag {
+		return errors.New("Cannot use --json and --porcelain together.")
+	}
+
+	sorted := make([]mediaPath, len(paths))
+	copy(sorted, paths)
+	sort.Sort(mediaPathsBySource(sorted))
+
+	if trackJSONFlag {
+		return json.NewEncoder(w).Encode(sorted)
+	}
+
+	lines := make([]string, 0, len(sorted)+1)
+	if !trackPorcelainFlag {
+		lines = append(lines, "Listing tracked paths")
+	}
+	for _, t := range sorted {
+		switch {
+		case trackPorcelainFlag:
+			lines = append(lines, fmt.Sprintf("%s\t%s\t%d\t%t", t.Path, t.Source, t.Line, t.Lockable))
+		case t.Lockable:
+			lines = append(lines, fmt.Sprintf("    %s [lockable] (%s)", t.Path, t.Source))
+		default:
+			lines = append(lines, fmt.Sprintf("    %s (%s)", t.Path, t.Source))
+		}
+	}
+
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+type mediaPathsBySource []mediaPath
+
+func (m mediaPathsBySource) Len() int      { return len(m) }
+func (m mediaPathsBySource) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m mediaPathsBySource) Less(i, j int) bool {
+	if m[i].Source != m[j].Source {
+		return m[i].Source < m[j].Source
+	}
+	return m[i].Path < m[j].Path
 }
 
 func findPaths() []mediaPath {
 	paths := make([]mediaPath, 0)
 
 	for _, path := range findAttributeFiles() {
-		attributes, err := os.Open(path)
+		data, err := ioutil.ReadFile(path)
 		if err != nil {
 			continue
 		}
 
-		scanner := bufio.NewScanner(attributes)
+		relfile, _ := filepath.Rel(config.LocalWorkingDir, path)
+		dir := attributesDir(relfile)
 
-		for scanner.Scan() {
-			line := scanner.Text()
+		lines, _ := splitAttributesLines(data)
+		for i, line := range lines {
 			if strings.Contains(line, "filter=lfs") {
 				fields := strings.Fields(line)
-				relfile, _ := filepath.Rel(config.LocalWorkingDir, path)
-				pattern := fields[0]
-				if reldir := filepath.Dir(relfile); len(reldir) > 0 {
-					pattern = filepath.Join(reldir, pattern)
-				}
 
-				paths = append(paths, mediaPath{Path: pattern, Source: relfile})
+				paths = append(paths, mediaPath{
+					Path:     attributesPattern(relfile, fields[0]),
+					Source:   relfile,
+					Line:     i + 1,
+					Lockable: hasAttribute(fields[1:], lockableAttribute),
+					dir:      dir,
+					pattern:  fields[0],
+				})
 			}
 		}
 	}
@@ -172,58 +726,116 @@ func findPaths() []mediaPath {
 	return paths
 }
 
-func findAttributeFiles() []string {
-	paths := make([]string, 0)
-
-	repoAttributes := filepath.Join(config.LocalGitDir, "info", "attributes")
-	if info, err := os.Stat(repoAttributes); err == nil && !info.IsDir() {
-		paths = append(paths, repoAttributes)
+// attributesPattern returns "pattern", from the attributes file "relfile",
+// relative to the root of the working tree.
+func attributesPattern(relfile, pattern string) string {
+	if reldir := attributesDir(relfile); len(reldir) > 0 {
+		return filepath.Join(reldir, pattern)
 	}
+	return pattern
+}
 
-	filepath.Walk(config.LocalWorkingDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+// hasAttribute returns whether "attr" is set in the given attributes.
+func hasAttribute(attrs []string, attr string) bool {
+	for _, a := range attrs {
+		if a == attr {
+			return true
 		}
+	}
+	return false
+}
 
-		if !info.IsDir() && (filepath.Base(path) == ".gitattributes") {
-			paths = append(paths, path)
-		}
-		return nil
-	})
+// utf8BOM is the byte order mark which some editors, on Windows especially,
+// write at the start of UTF-8 files.
+const utf8BOM = "\ufeff"
+
+// splitAttributesLines splits the contents of an attributes file into lines,
+// without their line endings. A byte order mark at the start is not part of the
+// first line, and "bom" returns whether there was one. If the file ends with a
+// line ending, the last line is empty.
+func splitAttributesLines(data []byte) (lines []string, bom bool) {
+	s := string(data)
+	if strings.HasPrefix(s, utf8BOM) {
+		s = s[len(utf8BOM):]
+		bom = true
+	}
 
-	return paths
+	lines = strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines, bom
+}
+
+// detectLineEnding returns "\r\n" if most of the lines in "data" end with
+// it, or "\n" otherwise, including when there are no line endings at all.
+func detectLineEnding(data []byte) string {
+	lf := bytes.Count(data, []byte("\n"))
+	crlf := bytes.Count(data, []byte("\r\n"))
+	if crlf > lf-crlf {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// attributesLineEnding returns the line ending used by most of the lines in
+// the file "filename", or "\n" if it doesn't exist yet.
+func attributesLineEnding(filename string) string {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "\n"
+	}
+	return detectLineEnding(data)
 }
 
-func needsTrailingLinebreak(filename string) bool {
+// trailingLinebreak returns what has to be written to the end of the file
+// "filename" to finish its last line with the line ending "eol", so that a
+// line appended to it isn't joined to its last line. It is empty if the file
+// is empty or already ends with a line ending, and "\n" if it ends with half of
+// a "\r\n".
+func trailingLinebreak(filename, eol string) string {
 	file, err := os.Open(filename)
 	if err != nil {
-		return false
+		return ""
 	}
 	defer file.Close()
 
-	buf := make([]byte, 16384)
-	bytesRead := 0
-	for {
-		n, err := file.Read(buf)
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return false
-		}
-		bytesRead = n
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return ""
+	}
+
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return ""
 	}
 
-	return !strings.HasSuffix(string(buf[0:bytesRead]), "\n")
+	switch {
+	case last[0] == '\n':
+		return ""
+	case last[0] == '\r' && eol == "\r\n":
+		return "\n"
+	}
+	return eol
 }
 
 // blocklistItem returns the name of the blocklist item preventing the given
-// file-name from being tracked, or an empty string, if there is none.
+// file-name from being tracked, or an empty string, if there is none: either
+// one of the reservedFiles, or ".git" for a path inside a .git directory.
+// Other files whose names only start with one of these, such as
+// ".gitbook.yaml", may be tracked.
 func blocklistItem(name string) string {
-	base := filepath.Base(name)
+	parts := strings.Split(filepath.ToSlash(name), "/")
+	for _, part := range parts {
+		if part == ".git" {
+			return part
+		}
+	}
 
-	for _, p := range prefixBlocklist {
-		if strings.HasPrefix(base, p) {
-			return p
+	base := parts[len(parts)-1]
+	for _, reserved := range reservedFiles {
+		if base == reserved {
+			return reserved
 		}
 	}
 
@@ -234,5 +846,17 @@ func init() {
 	RegisterCommand("track", trackCommand, func(cmd *cobra.Command) {
 		cmd.Flags().BoolVarP(&trackVerboseLoggingFlag, "verbose", "v", false, "log which files are being tracked and modified")
 		cmd.Flags().BoolVarP(&trackDryRunFlag, "dry-run", "d", false, "preview results of running `git lfs track`")
+		cmd.Flags().BoolVarP(&trackLockableFlag, "lockable", "l", false, "make the tracked paths lockable")
+		cmd.Flags().BoolVarP(&trackNotLockableFlag, "not-lockable", "", false, "make the tracked paths not lockable")
+		cmd.Flags().BoolVarP(&trackFilenameFlag, "filename", "", false, "treat the arguments as literal filenames, not as patterns")
+		cmd.Flags().BoolVarP(&trackStdinFlag, "stdin", "", false, "read patterns to track from STDIN, one per line")
+		cmd.Flags().StringVarP(&trackFromFileFlag, "from-file", "", "", "read patterns to track from the given file, one per line")
+		cmd.Flags().StringVarP(&trackPatternsFromFlag, "patterns-from", "", "", "same as --from-file")
+		cmd.Flags().BoolVarP(&trackJSONFlag, "json", "j", false, "list the tracked paths as JSON")
+		cmd.Flags().BoolVarP(&trackPorcelainFlag, "porcelain", "p", false, "list the tracked paths in an easy-to-parse format for scripts")
+		cmd.Flags().BoolVarP(&trackLocalFlag, "local", "", false, "add patterns to the .gitattributes file in the current directory")
+		cmd.Flags().BoolVarP(&trackInfoFlag, "info", "", false, "add patterns to the repository's info/attributes file, which isn't committed")
+		cmd.Flags().BoolVarP(&trackTouchFlag, "touch", "", false, "mark files which already match the paths as modified (the default)")
+		cmd.Flags().BoolVarP(&trackNoTouchFlag, "no-touch", "", false, "do not mark files which already match the paths as modified")
 	})
 }
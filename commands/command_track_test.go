@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitAttributesLinesWithCRLF(t *testing.T) {
+	lines, bom := splitAttributesLines([]byte("*.jpg filter=lfs\r\n*.png filter=lfs\r\n"))
+
+	assert.False(t, bom)
+	assert.Equal(t, []string{"*.jpg filter=lfs", "*.png filter=lfs", ""}, lines)
+}
+
+func TestSplitAttributesLinesSkipsBOM(t *testing.T) {
+	lines, bom := splitAttributesLines([]byte(utf8BOM + "*.jpg filter=lfs\n*.png filter=lfs"))
+
+	assert.True(t, bom)
+	assert.Equal(t, []string{"*.jpg filter=lfs", "*.png filter=lfs"}, lines)
+	assert.Equal(t, "*.jpg", strings.Fields(lines[0])[0])
+}
+
+func TestSplitAttributesLinesOfLargeFile(t *testing.T) {
+	data := strings.Repeat("# padding the attributes file out\r\n", 1000) + "*.jpg filter=lfs\r\n"
+	require.True(t, len(data) > 16384)
+
+	lines, _ := splitAttributesLines([]byte(data))
+	assert.Len(t, lines, 1002)
+	assert.Equal(t, "*.jpg filter=lfs", lines[1000])
+}
+
+func TestDetectLineEnding(t *testing.T) {
+	for desc, c := range map[string]struct {
+		data string
+		eol  string
+	}{
+		"lf":           {"a\nb\n", "\n"},
+		"crlf":         {"a\r\nb\r\n", "\r\n"},
+		"mostly crlf":  {"a\r\nb\r\nc\n", "\r\n"},
+		"mostly lf":    {"a\r\nb\nc\n", "\n"},
+		"no endings":   {"a", "\n"},
+		"empty":        {"", "\n"},
+		"crlf and bom": {utf8BOM + "a\r\n", "\r\n"},
+	} {
+		assert.Equal(t, c.eol, detectLineEnding([]byte(c.data)), desc)
+	}
+}
+
+func TestTrailingLinebreak(t *testing.T) {
+	for desc, c := range map[string]struct {
+		data      string
+		eol       string
+		linebreak string
+	}{
+		"empty":                      {"", "\n", ""},
+		"with linebreak":             {"*.jpg filter=lfs\n", "\n", ""},
+		"with crlf":                  {"*.jpg filter=lfs\r\n", "\r\n", ""},
+		"without linebreak":          {"*.jpg filter=lfs", "\n", "\n"},
+		"crlf without linebreak":     {"*.jpg filter=lfs\r\n*.png filter=lfs", "\r\n", "\r\n"},
+		"crlf with half a linebreak": {"*.jpg filter=lfs\r\n*.png filter=lfs\r", "\r\n", "\n"},
+		"lf ending with cr":          {"*.jpg filter=lfs\n*.png filter=lfs\r", "\n", "\n"},
+		"16KB with linebreak":        {strings.Repeat("a", 16383) + "\n", "\n", ""},
+		"16KB without linebreak":     {strings.Repeat("a", 16384), "\n", "\n"},
+		"32KB with linebreak":        {strings.Repeat("a", 32767) + "\n", "\n", ""},
+		"over 16KB with linebreak":   {strings.Repeat("a", 20000) + "\n", "\n", ""},
+		"over 16KB without":          {strings.Repeat("a\n", 10000) + "a", "\n", "\n"},
+		"linebreak 16KB from end":    {"a\n" + strings.Repeat("a", 16384), "\n", "\n"},
+		"linebreak at 16KB and end":  {strings.Repeat("a", 16383) + "\n" + strings.Repeat("a", 100) + "\n", "\n", ""},
+	} {
+		f, err := ioutil.TempFile("", "gitattributes")
+		require.Nil(t, err)
+		_, err = f.WriteString(c.data)
+		require.Nil(t, err)
+		f.Close()
+
+		assert.Equal(t, c.linebreak, trailingLinebreak(f.Name(), c.eol), desc)
+		os.Remove(f.Name())
+	}
+
+	assert.Equal(t, "", trailingLinebreak("does-not-exist", "\n"))
+}
+
+func TestReadTrackPatterns(t *testing.T) {
+	patterns, err := readTrackPatterns(strings.NewReader("*.jpg\n\n# images\n  *.png  \r\n\t\na b.bin\n*.gif"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"*.jpg", "*.png", "a b.bin", "*.gif"}, patterns)
+}
+
+var trackedPathsFixture = []mediaPath{
+	{Path: "a/*.gif", Source: "a/.gitattributes", Line: 2},
+	{Path: "*.psd", Source: ".gitattributes", Line: 3, Lockable: true},
+	{Path: "*.jpg", Source: ".gitattributes", Line: 1},
+}
+
+func TestRootRelativePattern(t *testing.T) {
+	assert.Equal(t, "*.bin", rootRelativePattern(".", "*.bin"))
+	assert.Equal(t, "/images", rootRelativePattern(".", "/images"))
+	assert.Equal(t, "a/b/*.bin", rootRelativePattern(filepath.Join("a", "b"), "*.bin"))
+	assert.Equal(t, "a/images", rootRelativePattern("a", "/images"))
+	assert.Equal(t, "a/*.bin", rootRelativePattern(filepath.Join("a", "b"), "../*.bin"))
+}
+
+func TestListTrackedPaths(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, listTrackedPaths(&buf, trackedPathsFixture))
+
+	assert.Equal(t, "Listing tracked paths\n"+
+		"    *.jpg (.gitattributes)\n"+
+		"    *.psd [lockable] (.gitattributes)\n"+
+		"    a/*.gif (a/.gitattributes)\n", buf.String())
+}
+
+func TestListTrackedPathsPorcelain(t *testing.T) {
+	trackPorcelainFlag = true
+	defer func() { trackPorcelainFlag = false }()
+
+	var buf bytes.Buffer
+	assert.Nil(t, listTrackedPaths(&buf, trackedPathsFixture))
+
+	assert.Equal(t, "*.jpg\t.gitattributes\t1\tfalse\n"+
+		"*.psd\t.gitattributes\t3\ttrue\n"+
+		"a/*.gif\ta/.gitattributes\t2\tfalse\n", buf.String())
+}
+
+func TestListTrackedPathsJSON(t *testing.T) {
+	trackJSONFlag = true
+	defer func() { trackJSONFlag = false }()
+
+	var buf bytes.Buffer
+	assert.Nil(t, listTrackedPaths(&buf, trackedPathsFixture))
+
+	assert.Equal(t, `[{"pattern":"*.jpg","source":".gitattributes","line":1,"lockable":false},`+
+		`{"pattern":"*.psd","source":".gitattributes","line":3,"lockable":true},`+
+		`{"pattern":"a/*.gif","source":"a/.gitattributes","line":2,"lockable":false}]`+"\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, listTrackedPaths(&buf, nil))
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestBlocklistItem(t *testing.T) {
+	for name, expected := range map[string]string{
+		".gitattributes":         ".gitattributes",
+		"a/b/.gitattributes":     ".gitattributes",
+		".gitignore":             ".gitignore",
+		".gitmodules":            ".gitmodules",
+		".lfsconfig":             ".lfsconfig",
+		".git/config":            ".git",
+		"sub/.git/info/exclude":  ".git",
+		".gitbook.yaml":          "",
+		".lfsconfig-sample":      "",
+		".github/workflow.yaml":  "",
+		"docs/.gitattributes.md": "",
+		"a.gitattributes":        "",
+		"foo.dat":                "",
+	} {
+		assert.Equal(t, expected, blocklistItem(name), name)
+	}
+}
+
+func TestExcludedAttributesLine(t *testing.T) {
+	assert.Equal(t, "/.gitattributes !filter !diff !merge !text", excludedAttributesLine(".", ".gitattributes"))
+	assert.Equal(t, "/a/b/.gitignore !filter !diff !merge !text", excludedAttributesLine("a", "b/.gitignore"))
+	assert.Equal(t, "/.lfsconfig !filter !diff !merge !text", excludedAttributesLine("a", "../.lfsconfig"))
+	assert.Equal(t, "/odd[[:space:]]\\[dir\\]/.gitignore !filter !diff !merge !text", excludedAttributesLine(".", "odd [dir]/.gitignore"))
+
+	assert.Equal(t, []string{
+		"* filter=lfs diff=lfs merge=lfs -text",
+		"/.gitignore !filter !diff !merge !text",
+	}, trackLines(".", "*", []string{".gitignore"}))
+}
+
+func TestTrackAttributesLine(t *testing.T) {
+	assert.Equal(t, "*.psd filter=lfs diff=lfs merge=lfs -text", trackAttributesLine("*.psd", false))
+	assert.Equal(t, "*.psd filter=lfs diff=lfs merge=lfs lockable -text", trackAttributesLine("*.psd", true))
+}
+
+func TestWithLockable(t *testing.T) {
+	assert.Equal(t, []string{"filter=lfs", "lockable", "-text"}, withLockable([]string{"filter=lfs", "-text"}))
+	assert.Equal(t, []string{"filter=lfs", "lockable"}, withLockable([]string{"filter=lfs"}))
+}
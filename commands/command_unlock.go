@@ -1,9 +1,8 @@
 package commands
 
 import (
-	"errors"
-
 	"github.com/github/git-lfs/api"
+	"github.com/github/git-lfs/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -31,35 +30,71 @@ type unlockFlags struct {
 func unlockCommand(cmd *cobra.Command, args []string) {
 	setLockRemoteFor(cfg)
 
-	var id string
-	if len(args) != 0 {
-		path, err := lockPath(args[0])
+	if unlockCmdFlags.Id != "" {
+		if len(args) > 0 || len(lockGlob) > 0 {
+			Exit("Usage: git lfs unlock (--id my-lock-id | <path>... | --glob <pattern>)")
+		}
+
+		lock, err := unlockId(unlockCmdFlags.Id)
 		if err != nil {
 			Error(err.Error())
+			Exit("Unable to unlock %s.", unlockCmdFlags.Id)
 		}
 
-		if id, err = lockIdFromPath(path); err != nil {
-			Error(err.Error())
+		Print("'%s' was unlocked (%s)", lock.Path, lock.Id)
+		cacheLocks(map[string]string{lock.Path: lock.Id}, false)
+		return
+	}
+
+	paths, err := lockPathArgs(args, lockGlob)
+	if err != nil {
+		Exit(err.Error())
+	}
+
+	if len(paths) == 0 {
+		Exit("Usage: git lfs unlock (--id my-lock-id | <path>... | --glob <pattern>)")
+	}
+
+	results := forEachLockPath(paths, cfg.TransferAPIConcurrency(), func(file string) (string, error) {
+		path, err := lockPath(file)
+		if err != nil {
+			return "", err
+		}
+
+		id, err := lockIdFromPath(path)
+		if err != nil {
+			return "", err
 		}
-	} else if unlockCmdFlags.Id != "" {
-		id = unlockCmdFlags.Id
-	} else {
-		Error("Usage: git lfs unlock (--id my-lock-id | <path>)")
+
+		lock, err := unlockId(id)
+		if err != nil {
+			return "", err
+		}
+		return lock.Id, nil
+	})
+
+	ok := reportLockResults(results, "unlock")
+	cacheLockResults(results, false)
+
+	if !ok {
+		exit(2)
 	}
+}
 
+// unlockId asks the server to remove the lock with the given ID, breaking it
+// if --force was given, and returns the lock that was removed.
+func unlockId(id string) (*api.Lock, error) {
 	s, resp := API.Locks.Unlock(id, unlockCmdFlags.Force)
 
 	if _, err := API.Do(s); err != nil {
-		Error(err.Error())
-		Exit("Error communicating with LFS API.")
+		return nil, errors.Wrap(err, "Error communicating with LFS API")
 	}
 
 	if len(resp.Err) > 0 {
-		Error(resp.Err)
-		Exit("Server unable to unlock lock.")
+		return nil, errors.New(resp.Err)
 	}
 
-	Print("'%s' was unlocked (%s)", args[0], resp.Lock.Id)
+	return resp.Lock, nil
 }
 
 // lockIdFromPath makes a call to the LFS API and resolves the ID for the locked
@@ -100,6 +135,7 @@ func init() {
 	RegisterCommand("unlock", unlockCommand, func(cmd *cobra.Command) {
 		cmd.Flags().StringVarP(&lockRemote, "remote", "r", cfg.CurrentRemote, lockRemoteHelp)
 		cmd.Flags().StringVarP(&unlockCmdFlags.Id, "id", "i", "", "unlock a lock by its ID")
+		cmd.Flags().StringVarP(&lockGlob, "glob", "g", "", lockGlobHelp)
 		cmd.Flags().BoolVarP(&unlockCmdFlags.Force, "force", "f", false, "forcibly break another user's lock(s)")
 	})
 }
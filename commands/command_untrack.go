@@ -1,26 +1,36 @@
 package commands
 
 import (
-	"bufio"
-	"io/ioutil"
 	"os"
-	"strings"
+	"path/filepath"
+	"time"
 
 	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/git"
 	"github.com/github/git-lfs/lfs"
+	"github.com/github/git-lfs/tools"
 	"github.com/spf13/cobra"
 )
 
-// untrackCommand takes a list of paths as an argument, and removes each path from the
-// default attributes file (.gitattributes), if it exists.
+var (
+	untrackDryRunFlag bool
+
+	// lfsAttributes are the attributes which `git lfs track` writes, and
+	// which untracking a pattern removes.
+	lfsAttributes = []string{"filter=lfs", "diff=lfs", "merge=lfs", lockableAttribute}
+)
+
+// untrackCommand takes a list of paths as an argument, and removes each path
+// from the attributes file which tracks it, marking the files it matched as
+// modified.
 func untrackCommand(cmd *cobra.Command, args []string) {
 	if config.LocalGitDir == "" {
 		Print("Not a git repository.")
-		os.Exit(128)
+		exit(128)
 	}
 	if config.LocalWorkingDir == "" {
 		Print("This operation must be run in a work tree.")
-		os.Exit(128)
+		exit(128)
 	}
 
 	lfs.InstallHooks(false)
@@ -30,50 +40,104 @@ func untrackCommand(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	data, err := ioutil.ReadFile(".gitattributes")
+	wd, _ := os.Getwd()
+	wd = tools.ResolveSymlinks(wd)
+	relpath, err := filepath.Rel(config.LocalWorkingDir, wd)
 	if err != nil {
-		return
+		Exit("Current directory %q outside of git working directory %q.", wd, config.LocalWorkingDir)
 	}
 
-	attributes := strings.NewReader(string(data))
+	knownPaths := findPaths()
 
-	attributesFile, err := os.Create(".gitattributes")
-	if err != nil {
-		Print("Error opening .gitattributes for writing")
-		return
-	}
-	defer attributesFile.Close()
+	for _, pattern := range args {
+		target := filepath.Join(relpath, encodeAttributesPattern(pattern))
+
+		var sources []string
+		for _, known := range knownPaths {
+			if known.Path == target {
+				sources = append(sources, known.Source)
+			}
+		}
+		if len(sources) == 0 {
+			continue
+		}
 
-	scanner := bufio.NewScanner(attributes)
+		gittracked, err := git.GetTrackedFiles(pattern)
+		if err != nil {
+			LoggedError(err, "Error getting git tracked files")
+			continue
+		}
 
-	// Iterate through each line of the attributes file and rewrite it,
-	// if the path was meant to be untracked, omit it, and print a message instead.
-	for scanner.Scan() {
-		line := scanner.Text()
-		if !strings.Contains(line, "filter=lfs") {
-			attributesFile.WriteString(line + "\n")
+		if untrackDryRunFlag {
+			printUntrackDryRun(pattern, sources, gittracked)
 			continue
 		}
 
-		path := strings.Fields(line)[0]
-		if removePath(path, args) {
-			Print("Untracking %s", path)
-		} else {
-			attributesFile.WriteString(line + "\n")
+		for _, source := range sources {
+			err := rewriteAttributesFile(source, func(p string, fields []string) []string {
+				if p != target {
+					return fields
+				}
+				return untrackedAttributes(fields)
+			})
+			if err != nil {
+				LoggedError(err, "Error updating %s", source)
+				continue
+			}
+		}
+		Print("Untracking %s", pattern)
+
+		// Mark the files which the pattern matched as modified, so that
+		// Git cleans them again without the LFS filter.
+		now := time.Now()
+		for _, f := range gittracked {
+			if err := os.Chtimes(f, now, now); err != nil {
+				LoggedError(err, "Error marking %q modified", f)
+			}
 		}
 	}
 }
 
-func removePath(path string, args []string) bool {
-	for _, t := range args {
-		if path == t {
-			return true
+// untrackedAttributes returns "fields", the pattern and attributes of a line
+// which tracks it, without the attributes which `git lfs track` writes.
+// Others, which have nothing to do with Git LFS, are kept. "-text" is only
+// removed from lines which `git lfs track` wrote in full, since it may have
+// been set by hand.
+func untrackedAttributes(fields []string) []string {
+	written := hasAttribute(fields, "diff=lfs") && hasAttribute(fields, "merge=lfs")
+
+	attrs := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if hasAttribute(lfsAttributes, f) || (written && f == "-text") {
+			continue
 		}
+		attrs = append(attrs, f)
+	}
+	return attrs
+}
+
+// printUntrackDryRun previews what untracking the given pattern would do: the
+// attributes files it would be removed from and the files it would mark as
+// modified.
+func printUntrackDryRun(pattern string, sources, matched []string) {
+	Print("Would untrack %s", pattern)
+	for _, source := range sources {
+		Print("  Remove from %s", source)
+	}
+
+	if len(matched) == 0 {
+		Print("  No files to mark as modified.")
+		return
 	}
 
-	return false
+	Print("  Mark as modified:")
+	for _, f := range matched {
+		Print("    %s", f)
+	}
 }
 
 func init() {
-	RegisterCommand("untrack", untrackCommand, nil)
+	RegisterCommand("untrack", untrackCommand, func(cmd *cobra.Command) {
+		cmd.Flags().BoolVarP(&untrackDryRunFlag, "dry-run", "d", false, "preview results of running `git lfs untrack`")
+	})
 }
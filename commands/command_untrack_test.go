@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUntrackedAttributes(t *testing.T) {
+	for desc, c := range map[string]struct {
+		fields   []string
+		expected []string
+	}{
+		"written by track": {
+			[]string{"*.jpg", "filter=lfs", "diff=lfs", "merge=lfs", "-text"},
+			[]string{"*.jpg"},
+		},
+		"lockable": {
+			[]string{"*.psd", "filter=lfs", "diff=lfs", "merge=lfs", "-text", "lockable"},
+			[]string{"*.psd"},
+		},
+		"written by hand": {
+			[]string{"*.png", "filter=lfs", "-text"},
+			[]string{"*.png", "-text"},
+		},
+		"other attributes": {
+			[]string{"*.bin", "filter=lfs", "diff=lfs", "merge=lfs", "-text", "eol=lf", "-delta"},
+			[]string{"*.bin", "eol=lf", "-delta"},
+		},
+	} {
+		assert.Equal(t, c.expected, untrackedAttributes(c.fields), desc)
+	}
+}
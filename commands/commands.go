@@ -9,6 +9,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/github/git-lfs/api"
@@ -16,6 +17,7 @@ import (
 	"github.com/github/git-lfs/errors"
 	"github.com/github/git-lfs/git"
 	"github.com/github/git-lfs/lfs"
+	"github.com/github/git-lfs/progress"
 	"github.com/github/git-lfs/tools"
 	"github.com/github/git-lfs/transfer"
 )
@@ -37,8 +39,26 @@ var (
 
 	includeArg string
 	excludeArg string
+	// quietArg is set by --quiet on commands which transfer objects
+	quietArg bool
 )
 
+// quietProgress returns whether progress should be reported without the
+// control characters used to redraw it, because --quiet was given, lfs.quiet is
+// set, or stderr is not a terminal.
+func quietProgress() bool {
+	return quietArg || cfg.ProgressQuiet() || !progress.IsTerminal(os.Stderr)
+}
+
+// warnIfLegacyFallback warns that the server is using the deprecated legacy
+// API if the given queue had to fall back to it.
+func warnIfLegacyFallback(q *lfs.TransferQueue) {
+	if q.UsedLegacyFallback() {
+		Error("warning: the Git LFS server does not support the batch API, so the deprecated")
+		Error("legacy API was used. Please ask the server's operator to upgrade it.")
+	}
+}
+
 // TransferManifest builds a transfer.Manifest from the commands package global
 // cfg var.
 func TransferManifest() *transfer.Manifest {
@@ -65,10 +85,26 @@ func Print(format string, args ...interface{}) {
 	fmt.Fprintf(OutputWriter, format+"\n", args...)
 }
 
+// exitIfOutputClosed exits quietly if err shows that Stdout has been closed,
+// for example because the output was piped to a command like head(1) that has
+// read all it wants. There's no point carrying on with a scan whose results
+// nobody will read. Any other error writing the output is reported with
+// ExitWithError, since carrying on would leave the output incomplete.
+func exitIfOutputClosed(err error) {
+	if err == nil {
+		return
+	}
+
+	if perr, ok := err.(*os.PathError); ok && perr.Err == syscall.EPIPE {
+		exit(0)
+	}
+	ExitWithError(errors.Wrap(err, "Error writing output"))
+}
+
 // Exit prints a formatted message and exits.
 func Exit(format string, args ...interface{}) {
 	Error(format, args...)
-	os.Exit(2)
+	exit(2)
 }
 
 // ExitWithError either panics with a full stack trace for fatal errors, or
@@ -122,7 +158,7 @@ func LoggedError(err error, format string, args ...interface{}) {
 // a log file before exiting.
 func Panic(err error, format string, args ...interface{}) {
 	LoggedError(err, format, args...)
-	os.Exit(2)
+	exit(2)
 }
 
 func Cleanup() {
@@ -155,14 +191,14 @@ func requireStdin(msg string) {
 
 	if len(out) > 0 {
 		Error(out)
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 func requireInRepo() {
 	if !lfs.InRepo() {
 		Print("Not in a git repository.")
-		os.Exit(128)
+		exit(128)
 	}
 }
 
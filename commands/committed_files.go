@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/github/git-lfs/git"
+	"github.com/github/git-lfs/lfs"
+	"github.com/github/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+)
+
+// committedFilesListed is the most files named in the note about each pattern
+// which matches files already committed to Git.
+const committedFilesListed = 3
+
+// addedPattern is a pattern added to the .gitattributes file in the
+// directory "dir", relative to the root of the working tree.
+type addedPattern struct {
+	dir     string
+	pattern string
+	// arg is the pattern as it was given to track.
+	arg string
+}
+
+// matches reports whether the pattern applies to the file at "name", relative
+// to the root of the working tree, in the same way as git matches patterns in
+// .gitattributes files: a pattern without a slash matches the file's basename,
+// and any other pattern its path from the directory of the .gitattributes
+// file.
+func (p *addedPattern) matches(name string, ignoreCase bool) bool {
+	dir, pattern := filepath.ToSlash(p.dir), p.pattern
+	if ignoreCase {
+		dir, pattern, name = strings.ToLower(dir), strings.ToLower(pattern), strings.ToLower(name)
+	}
+
+	if dir != "." && dir != "" {
+		if !strings.HasPrefix(name, dir+"/") {
+			return false
+		}
+		name = name[len(dir)+1:]
+	}
+
+	if !strings.Contains(pattern, "/") {
+		return tools.Wildmatch(pattern, path.Base(name))
+	}
+	return tools.Wildmatch(strings.TrimPrefix(pattern, "/"), name)
+}
+
+// committedFiles returns the files in HEAD which match each of "patterns",
+// but were committed as regular files rather than Git LFS pointers. Since
+// this looks at the paths committed in HEAD, it finds files which have since
+// been renamed, and follows core.ignorecase as git does for attributes.
+func committedFiles(patterns []*addedPattern) map[*addedPattern][]string {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	if _, err := git.ResolveRef("HEAD"); err != nil {
+		// There are no commits yet.
+		return nil
+	}
+
+	ignoreCase := cfg.Git.Bool("core.ignorecase", false)
+	matched := make(map[*addedPattern][]string)
+
+	blobs, err := lfs.ScanTreeForNonPointers("HEAD", func(name string) bool {
+		found := false
+		for _, p := range patterns {
+			if p.matches(name, ignoreCase) {
+				matched[p] = append(matched[p], name)
+				found = true
+			}
+		}
+		return found
+	})
+	if err != nil {
+		tracerx.Printf("track: unable to look for committed files: %s", err)
+		return nil
+	}
+
+	// Only keep the files which aren't pointers.
+	nonPointers := tools.NewStringSetWithCapacity(len(blobs))
+	for _, blob := range blobs {
+		nonPointers.Add(blob.Filename)
+	}
+
+	for p, names := range matched {
+		var committed []string
+		for _, name := range names {
+			if nonPointers.Contains(name) {
+				committed = append(committed, name)
+			}
+		}
+
+		if len(committed) > 0 {
+			matched[p] = committed
+		} else {
+			delete(matched, p)
+		}
+	}
+
+	return matched
+}
+
+// warnCommittedFiles prints a note for each of "patterns" which matches files
+// already committed to Git as regular files, since tracking them doesn't
+// change the versions which were committed.
+func warnCommittedFiles(patterns []*addedPattern) {
+	committed := committedFiles(patterns)
+
+	for _, p := range patterns {
+		names := committed[p]
+		if len(names) == 0 {
+			continue
+		}
+
+		noun := "files"
+		if len(names) == 1 {
+			noun = "file"
+		}
+
+		Error("Note: %s matches %d %s already committed to Git without Git LFS:", p.arg, len(names), noun)
+		for i, name := range names {
+			if i == committedFilesListed {
+				Error("    ... and %d more", len(names)-i)
+				break
+			}
+			Error("    %s", name)
+		}
+	}
+
+	if len(committed) > 0 {
+		Error("Their changes from now on are stored in Git LFS, but the versions already")
+		Error("committed stay in the repository's history, and keep it the same size.")
+	}
+}
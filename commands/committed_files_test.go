@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddedPatternMatches(t *testing.T) {
+	for desc, c := range map[string]struct {
+		dir, pattern, name string
+		ignoreCase         bool
+		expected           bool
+	}{
+		"basename":               {".", "*.mp4", "videos/a.mp4", false, true},
+		"other extension":        {".", "*.mp4", "videos/a.mov", false, false},
+		"path":                   {".", "videos/*.mp4", "videos/a.mp4", false, true},
+		"path in subdirectory":   {".", "videos/*.mp4", "videos/old/a.mp4", false, false},
+		"anchored":               {".", "/a.mp4", "a.mp4", false, true},
+		"anchored in directory":  {".", "/a.mp4", "videos/a.mp4", false, false},
+		"local basename":         {"videos", "*.mp4", "videos/old/a.mp4", false, true},
+		"outside local dir":      {"videos", "*.mp4", "a.mp4", false, false},
+		"local path":             {"videos", "old/*.mp4", "videos/old/a.mp4", false, true},
+		"different case":         {".", "*.mp4", "videos/A.MP4", false, false},
+		"ignored case":           {".", "*.mp4", "videos/A.MP4", true, true},
+		"ignored case in dir":    {"Videos", "*.mp4", "videos/a.MP4", true, true},
+		"ignored case, no match": {".", "*.mp4", "videos/a.mov", true, false},
+	} {
+		p := &addedPattern{dir: c.dir, pattern: c.pattern}
+		assert.Equal(t, c.expected, p.matches(c.name, c.ignoreCase), desc)
+	}
+}
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/github/git-lfs/lfs"
+)
+
+// dryRunReport collects the objects processed by a dry run TransferQueue, so
+// that they can be printed in a stable order once the queue has finished.
+type dryRunReport struct {
+	// verb prefixes each line of the text report, e.g. "push" or "fetch"
+	verb    string
+	entries []*lfs.DryRunEntry
+	mu      sync.Mutex
+}
+
+func newDryRunReport(verb string) *dryRunReport {
+	return &dryRunReport{verb: verb}
+}
+
+// Add records an entry. It is an lfs.DryRunCallback, so is safe to call from
+// multiple goroutines.
+func (r *dryRunReport) Add(e *lfs.DryRunEntry) {
+	r.mu.Lock()
+	r.entries = append(r.entries, e)
+	r.mu.Unlock()
+}
+
+// Write writes the report to "w", sorted by name and then OID, either as one
+// line per object:
+//
+//   push <oid> => <name> (<size> bytes, <action>)
+//
+// or, if asJSON is true, as a JSON array of lfs.DryRunEntry objects.
+func (r *dryRunReport) Write(w io.Writer, asJSON bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sort.Sort(dryRunEntriesByName(r.entries))
+
+	if asJSON {
+		entries := r.entries
+		if entries == nil {
+			entries = []*lfs.DryRunEntry{}
+		}
+		return json.NewEncoder(w).Encode(entries)
+	}
+
+	for _, e := range r.entries {
+		if _, err := fmt.Fprintf(w, "%s %s => %s (%d bytes, %s)\n", r.verb, e.Oid, e.Name, e.Size, e.Action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type dryRunEntriesByName []*lfs.DryRunEntry
+
+func (s dryRunEntriesByName) Len() int      { return len(s) }
+func (s dryRunEntriesByName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s dryRunEntriesByName) Less(i, j int) bool {
+	if s[i].Name != s[j].Name {
+		return s[i].Name < s[j].Name
+	}
+	return s[i].Oid < s[j].Oid
+}
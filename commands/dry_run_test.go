@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/github/git-lfs/lfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDryRunReport() *dryRunReport {
+	r := newDryRunReport("push")
+	r.Add(&lfs.DryRunEntry{Name: "b.dat", Oid: "bbbb", Size: 2, Direction: "upload", Action: "upload"})
+	r.Add(&lfs.DryRunEntry{Name: "a.dat", Oid: "aaaa", Size: 10, Direction: "upload", Action: "skip"})
+	r.Add(&lfs.DryRunEntry{Name: "a.dat", Oid: "0000", Size: 1, Direction: "upload", Action: "upload"})
+	return r
+}
+
+func TestDryRunReportTextIsSorted(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, newTestDryRunReport().Write(&buf, false))
+
+	assert.Equal(t, "push 0000 => a.dat (1 bytes, upload)\n"+
+		"push aaaa => a.dat (10 bytes, skip)\n"+
+		"push bbbb => b.dat (2 bytes, upload)\n", buf.String())
+}
+
+func TestDryRunReportJSON(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, newTestDryRunReport().Write(&buf, true))
+
+	assert.Equal(t, `[{"name":"a.dat","oid":"0000","size":1,"direction":"upload","action":"upload"},`+
+		`{"name":"a.dat","oid":"aaaa","size":10,"direction":"upload","action":"skip"},`+
+		`{"name":"b.dat","oid":"bbbb","size":2,"direction":"upload","action":"upload"}]`+"\n", buf.String())
+}
+
+func TestDryRunReportEmptyJSON(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, newDryRunReport("fetch").Write(&buf, true))
+
+	assert.Equal(t, "[]\n", buf.String())
+}
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/github/git-lfs/config"
+	"github.com/rubyist/tracerx"
+)
+
+var (
+	// endpointArg is the LFS server given by --endpoint, which is used
+	// instead of the one configured for the remote.
+	endpointArg     string
+	endpointArgHelp = "use this LFS server URL instead of the remote's, for this command only"
+)
+
+// setEndpointOverride makes "rawurl", if it isn't empty, the LFS endpoint of
+// every operation which "c" is used for, instead of the one given by lfs.url,
+// remote.<name>.lfsurl or the remote's URL. Since it is used for credentials
+// too, they are asked for the host of "rawurl", rather than the remote's.
+func setEndpointOverride(c *config.Configuration, rawurl string) error {
+	if len(rawurl) == 0 {
+		return nil
+	}
+
+	e, err := endpointOverride(c, rawurl)
+	if err != nil {
+		return err
+	}
+
+	tracerx.Printf("using endpoint %s instead of the one for %q", config.RedactURL(e.Url), c.CurrentRemote)
+	c.SetManualEndpoint(e)
+	return nil
+}
+
+// endpointOverride returns the endpoint for "rawurl", after applying any
+// url.<base>.insteadOf aliases, as long as it can be reached: the transfer
+// adapters only speak HTTP and HTTPS, and SSH is only used to authenticate
+// before using HTTPS.
+func endpointOverride(c *config.Configuration, rawurl string) (config.Endpoint, error) {
+	u, err := url.Parse(c.ReplaceUrlAlias(rawurl))
+	if err != nil {
+		return config.Endpoint{}, fmt.Errorf("Invalid endpoint %q: %s", rawurl, err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "ssh":
+		return config.NewEndpointWithConfig(rawurl, c), nil
+	}
+	return config.Endpoint{}, fmt.Errorf("Invalid endpoint %q: only http, https and ssh URLs are supported", rawurl)
+}
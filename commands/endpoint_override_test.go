@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/github/git-lfs/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetEndpointOverride(t *testing.T) {
+	cfg := config.NewFrom(config.Values{Git: map[string]string{
+		"lfs.url": "https://lfs-server.com/repo",
+	}})
+	cfg.CurrentRemote = "origin"
+
+	assert.Nil(t, setEndpointOverride(cfg, ""))
+	assert.Equal(t, "https://lfs-server.com/repo", cfg.Endpoint("download").Url)
+
+	assert.Nil(t, setEndpointOverride(cfg, "https://mirror.com/repo"))
+	assert.Equal(t, "https://mirror.com/repo", cfg.Endpoint("download").Url)
+	assert.Equal(t, "https://mirror.com/repo", cfg.Endpoint("upload").Url)
+}
+
+func TestEndpointOverrideAcceptsSSH(t *testing.T) {
+	e, err := endpointOverride(config.NewFrom(config.Values{}), "ssh://git@mirror.com/repo")
+	assert.Nil(t, err)
+	assert.Equal(t, "git@mirror.com", e.SshUserAndHost)
+	assert.Equal(t, "repo", e.SshPath)
+	assert.Equal(t, "https://mirror.com/repo", e.Url)
+}
+
+func TestEndpointOverrideAppliesAliases(t *testing.T) {
+	cfg := config.NewFrom(config.Values{Git: map[string]string{
+		"url.https://mirror.com/.insteadof": "mirror:",
+	}})
+
+	e, err := endpointOverride(cfg, "mirror:repo")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://mirror.com/repo", e.Url)
+}
+
+func TestEndpointOverrideRejectsUnsupportedURLs(t *testing.T) {
+	cfg := config.NewFrom(config.Values{})
+
+	for _, rawurl := range []string{"file:///tmp/lfs", "git://mirror.com/repo", "mirror.com/repo", "ftp://mirror.com/repo"} {
+		_, err := endpointOverride(cfg, rawurl)
+		if assert.NotNil(t, err, rawurl) {
+			assert.Contains(t, err.Error(), "only http, https and ssh URLs are supported")
+		}
+	}
+}
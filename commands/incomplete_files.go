@@ -0,0 +1,217 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/lfs"
+)
+
+// incompleteFile is a file which smudge left holding its pointer or a
+// placeholder, since its object couldn't be downloaded.
+type incompleteFile struct {
+	// Name is the path of the file relative to the root of the repository,
+	// with forward slashes.
+	Name string
+	Oid  string
+	Size int64
+}
+
+// incompleteFilesPath returns the file which the incomplete files of the
+// current repository are listed in.
+func incompleteFilesPath() string {
+	return filepath.Join(config.LocalGitStorageDir, "lfs", "incomplete")
+}
+
+// recordIncompleteFile appends "f" to the list in "filename". Each file is a
+// single write to a file opened with O_APPEND, so that smudge filters run at
+// once don't lose each other's files.
+func recordIncompleteFile(filename string, f *incompleteFile) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(file, "%s %d %s\n", f.Oid, f.Size, filepath.ToSlash(f.Name))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// loadIncompleteFiles reads the list in "filename", by file name, which is
+// empty if the list doesn't exist yet. A file listed more than once has its
+// last object, and lines which weren't written whole are skipped.
+func loadIncompleteFiles(filename string) (map[string]*incompleteFile, error) {
+	files := make(map[string]*incompleteFile)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return files, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 3)
+		if len(parts) < 3 || !lfs.ValidOid(parts[0]) || len(parts[2]) == 0 {
+			continue
+		}
+
+		size, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || size < 0 {
+			continue
+		}
+
+		files[parts[2]] = &incompleteFile{Name: parts[2], Oid: parts[0], Size: size}
+	}
+	return files, scanner.Err()
+}
+
+// saveIncompleteFiles replaces the list in "filename" with "files", removing
+// it if there are none.
+func saveIncompleteFiles(filename string, files map[string]*incompleteFile) error {
+	if len(files) == 0 {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		f := files[name]
+		fmt.Fprintf(&buf, "%s %d %s\n", f.Oid, f.Size, f.Name)
+	}
+
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "incomplete")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// forgetIncompleteFiles removes the files named in "names", relative to the
+// root of the repository, from the list of incomplete files.
+func forgetIncompleteFiles(names []string) {
+	if len(names) == 0 {
+		return
+	}
+
+	filename := incompleteFilesPath()
+	files, err := loadIncompleteFiles(filename)
+	if err != nil {
+		Error("Unable to update the list of incomplete files: %s", err)
+		return
+	}
+
+	n := len(files)
+	for _, name := range names {
+		delete(files, filepath.ToSlash(name))
+	}
+	if len(files) == n {
+		return
+	}
+
+	if err := saveIncompleteFiles(filename, files); err != nil {
+		Error("Unable to update the list of incomplete files: %s", err)
+	}
+}
+
+// smudgePlaceholder returns what smudge writes, with lfs.smudge.onerror set
+// to "placeholder", for a file whose object "ptr" couldn't be downloaded.
+func smudgePlaceholder(ptr *lfs.Pointer) []byte {
+	return []byte(fmt.Sprintf("This file is a placeholder for a Git LFS object which couldn't be downloaded.\n"+
+		"Run `git lfs pull` to download it and replace this file.\n\n"+
+		"oid sha256:%s\nsize %d\n", ptr.Oid, ptr.Size))
+}
+
+// maxSmudgePlaceholderSize is the size of the longest placeholder which
+// smudgePlaceholder can return.
+var maxSmudgePlaceholderSize = len(smudgePlaceholder(&lfs.Pointer{
+	Oid:  strings.Repeat("0", 64),
+	Size: math.MaxInt64,
+}))
+
+// placeholderPointer returns the pointer whose placeholder is exactly "data",
+// or nil if "data" isn't one.
+func placeholderPointer(data []byte) *lfs.Pointer {
+	if len(data) > maxSmudgePlaceholderSize {
+		return nil
+	}
+
+	lines := strings.Split(string(data), "\n")
+	if len(lines) < 3 {
+		return nil
+	}
+
+	oid := strings.TrimPrefix(lines[len(lines)-3], "oid sha256:")
+	size, err := strconv.ParseInt(strings.TrimPrefix(lines[len(lines)-2], "size "), 10, 64)
+	if err != nil || !lfs.ValidOid(oid) {
+		return nil
+	}
+
+	ptr := lfs.NewPointer(oid, size, nil)
+	if !bytes.Equal(smudgePlaceholder(ptr), data) {
+		return nil
+	}
+	return ptr
+}
+
+// isIncomplete returns whether the working tree file "filename" still holds
+// the pointer "ptr", or its placeholder.
+func isIncomplete(filename string, ptr *lfs.Pointer) bool {
+	if filePtr, err := lfs.DecodePointerFromFile(filename); err == nil {
+		return filePtr.Oid == ptr.Oid
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	// Read one more byte than the placeholder, so that longer files don't
+	// match.
+	placeholder := smudgePlaceholder(ptr)
+	data, err := ioutil.ReadAll(io.LimitReader(file, int64(len(placeholder))+1))
+	return err == nil && bytes.Equal(data, placeholder)
+}
@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/github/git-lfs/lfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	incompleteOidA = "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+	incompleteOidB = "fcf5015df7a9089a7aa7fe74139d4b8f7d62e52d5a34f9a87aeffc8e8c668254"
+)
+
+func TestIncompleteFilesRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "incomplete-files")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "lfs", "incomplete")
+
+	files, err := loadIncompleteFiles(filename)
+	require.Nil(t, err)
+	assert.Empty(t, files)
+
+	require.Nil(t, recordIncompleteFile(filename, &incompleteFile{Name: "a b.dat", Oid: incompleteOidA, Size: 1}))
+	require.Nil(t, recordIncompleteFile(filename, &incompleteFile{Name: "dir/b.dat", Oid: incompleteOidA, Size: 1}))
+	require.Nil(t, recordIncompleteFile(filename, &incompleteFile{Name: "dir/b.dat", Oid: incompleteOidB, Size: 9}))
+
+	files, err = loadIncompleteFiles(filename)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]*incompleteFile{
+		"a b.dat":   {Name: "a b.dat", Oid: incompleteOidA, Size: 1},
+		"dir/b.dat": {Name: "dir/b.dat", Oid: incompleteOidB, Size: 9},
+	}, files)
+
+	delete(files, "a b.dat")
+	require.Nil(t, saveIncompleteFiles(filename, files))
+
+	data, err := ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	assert.Equal(t, incompleteOidB+" 9 dir/b.dat\n", string(data))
+
+	require.Nil(t, saveIncompleteFiles(filename, nil))
+	_, err = os.Stat(filename)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestIncompleteFilesSkipsPartialLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "incomplete-files")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "incomplete")
+	require.Nil(t, ioutil.WriteFile(filename, []byte(strings.Join([]string{
+		incompleteOidA + " 1 a.dat",
+		incompleteOidB + " x b.dat",
+		incompleteOidB + " 9",
+		incompleteOidB[:20],
+	}, "\n")), 0644))
+
+	files, err := loadIncompleteFiles(filename)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]*incompleteFile{
+		"a.dat": {Name: "a.dat", Oid: incompleteOidA, Size: 1},
+	}, files)
+}
+
+func TestIsIncomplete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "incomplete-files")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ptr := lfs.NewPointer(incompleteOidA, 1, nil)
+	other := lfs.NewPointer(incompleteOidB, 9, nil)
+
+	for content, expected := range map[string]bool{
+		ptr.Encoded():                         true,
+		string(smudgePlaceholder(ptr)):        true,
+		other.Encoded():                       false,
+		string(smudgePlaceholder(other)):      false,
+		string(smudgePlaceholder(ptr)) + "\n": false,
+		"a":                                   false,
+	} {
+		filename := filepath.Join(dir, "a.dat")
+		require.Nil(t, ioutil.WriteFile(filename, []byte(content), 0644))
+		assert.Equal(t, expected, isIncomplete(filename, ptr), content)
+	}
+
+	assert.False(t, isIncomplete(filepath.Join(dir, "missing.dat"), ptr))
+}
+
+func TestPlaceholderPointer(t *testing.T) {
+	ptr := lfs.NewPointer(incompleteOidA, 1, nil)
+	large := lfs.NewPointer(incompleteOidB, math.MaxInt64, nil)
+	placeholder := string(smudgePlaceholder(ptr))
+
+	assert.Equal(t, ptr, placeholderPointer([]byte(placeholder)))
+	assert.Equal(t, large, placeholderPointer(smudgePlaceholder(large)))
+
+	for _, content := range []string{
+		placeholder + "\n",
+		"x" + placeholder,
+		strings.Replace(placeholder, "size 1", "size 01", 1),
+		strings.Replace(placeholder, incompleteOidA, strings.ToUpper(incompleteOidA), 1),
+		ptr.Encoded(),
+		"",
+	} {
+		assert.Nil(t, placeholderPointer([]byte(content)), content)
+	}
+}
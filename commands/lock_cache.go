@@ -0,0 +1,143 @@
+package commands
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/github/git-lfs/config"
+)
+
+// lockCache records the locks held by the current user, so that which lockable
+// files should be writable is known without asking the server. It is updated
+// by `git lfs lock` and `git lfs unlock`.
+type lockCache struct {
+	// Locks holds the ID of each lock, by the path of its file relative
+	// to the root of the repository, with forward slashes.
+	Locks map[string]string `json:"locks"`
+
+	filename string
+}
+
+// lockCacheFile returns the file which the lock cache of the current
+// repository is kept in.
+func lockCacheFile() string {
+	return filepath.Join(config.LocalGitStorageDir, "lfs", "lockcache.json")
+}
+
+// loadLockCache reads the lock cache kept in "filename", which is empty if the
+// file doesn't exist yet.
+func loadLockCache(filename string) (*lockCache, error) {
+	c := &lockCache{filename: filename}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Locks == nil {
+		c.Locks = make(map[string]string)
+	}
+	return c, nil
+}
+
+// Add records that the current user holds the lock "id" on "path".
+func (c *lockCache) Add(path, id string) {
+	c.Locks[filepath.ToSlash(path)] = id
+}
+
+// Remove records that the current user no longer holds a lock on "path".
+func (c *lockCache) Remove(path string) {
+	delete(c.Locks, filepath.ToSlash(path))
+}
+
+// Owns returns whether the current user holds a lock on "path".
+func (c *lockCache) Owns(path string) bool {
+	_, ok := c.Locks[filepath.ToSlash(path)]
+	return ok
+}
+
+// Save writes the cache back to the file it was loaded from, replacing it
+// whole, so that it's never left half written.
+func (c *lockCache) Save() error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(c.filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "lockcache")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.filename)
+}
+
+// cacheLockResults records the files which were locked by "results", if
+// "held", or unlocked otherwise, in the lock cache; see cacheLocks.
+func cacheLockResults(results []*lockResult, held bool) {
+	locks := make(map[string]string, len(results))
+	for _, res := range results {
+		if res.Err != nil {
+			continue
+		}
+
+		if path, err := lockPath(res.Path); err == nil {
+			locks[path] = res.Id
+		}
+	}
+	cacheLocks(locks, held)
+}
+
+// cacheLocks records that the current user holds the given locks, by the path
+// of their files relative to the root of the repository, if "held", or that
+// they were unlocked otherwise. The files which are lockable are then made
+// writable or read-only to match.
+func cacheLocks(locks map[string]string, held bool) {
+	if len(locks) == 0 {
+		return
+	}
+
+	cache, err := loadLockCache(lockCacheFile())
+	if err != nil {
+		Error("Unable to update the lock cache: %s", err)
+		return
+	}
+
+	paths := make([]string, 0, len(locks))
+	for path, id := range locks {
+		if held {
+			cache.Add(path, id)
+		} else {
+			cache.Remove(path)
+		}
+		paths = append(paths, path)
+	}
+
+	if err := cache.Save(); err != nil {
+		Error("Unable to update the lock cache: %s", err)
+		return
+	}
+
+	updateLockablePermissions(paths)
+}
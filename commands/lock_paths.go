@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"sync"
+
+	"github.com/github/git-lfs/git"
+)
+
+// lockResult is the outcome of locking or unlocking a single path.
+type lockResult struct {
+	Path string // the path as it was given
+	Id   string // the ID of the lock, if it succeeded
+	Err  error
+}
+
+// lockPathArgs returns the paths given to `lock` or `unlock`, followed by the
+// files tracked by Git which match "glob", if it is given, without duplicates.
+// Like the paths, the glob is relative to the working directory.
+func lockPathArgs(args []string, glob string) ([]string, error) {
+	paths := make([]string, 0, len(args))
+	seen := make(map[string]bool, len(args))
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, arg := range args {
+		add(arg)
+	}
+
+	if len(glob) > 0 {
+		files, err := git.GetTrackedFiles(glob)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			add(file)
+		}
+	}
+
+	return paths, nil
+}
+
+// forEachLockPath calls "fn" for each path, up to "workers" at once, and
+// returns the results in the same order as the paths. The first path is done
+// on its own, so that credentials are asked for once, rather than by every
+// worker. A failure doesn't stop the remaining paths.
+func forEachLockPath(paths []string, workers int, fn func(path string) (string, error)) []*lockResult {
+	results := make([]*lockResult, len(paths))
+	do := func(i int) {
+		id, err := fn(paths[i])
+		results[i] = &lockResult{Path: paths[i], Id: id, Err: err}
+	}
+
+	if len(paths) == 0 {
+		return results
+	}
+	do(0)
+
+	indexes := make(chan int)
+	go func() {
+		for i := 1; i < len(paths); i++ {
+			indexes <- i
+		}
+		close(indexes)
+	}()
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				do(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// reportLockResults prints whether each path was locked or unlocked, as given
+// by "verb", and returns whether all of them were.
+func reportLockResults(results []*lockResult, verb string) bool {
+	ok := true
+	for _, res := range results {
+		if res.Err != nil {
+			Error("Unable to %s '%s': %s", verb, res.Path, res.Err)
+			ok = false
+			continue
+		}
+		Print("'%s' was %sed (%s)", res.Path, verb, res.Id)
+	}
+	return ok
+}
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEachLockPathKeepsOrderAfterFailures(t *testing.T) {
+	paths := []string{"a.dat", "b.dat", "c.dat", "d.dat", "e.dat"}
+
+	var mu sync.Mutex
+	var running, most int
+	results := forEachLockPath(paths, 2, func(path string) (string, error) {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+
+		if path == "b.dat" {
+			return "", errors.New("lock already created")
+		}
+		return "id-" + path, nil
+	})
+
+	assert.True(t, most <= 2, "ran %d at once", most)
+	assert.Len(t, results, len(paths))
+	for i, res := range results {
+		assert.Equal(t, paths[i], res.Path)
+		if res.Path == "b.dat" {
+			assert.EqualError(t, res.Err, "lock already created")
+		} else {
+			assert.Nil(t, res.Err)
+			assert.Equal(t, "id-"+res.Path, res.Id)
+		}
+	}
+}
+
+func TestForEachLockPathWithoutPaths(t *testing.T) {
+	results := forEachLockPath(nil, 2, func(path string) (string, error) {
+		t.Fatalf("unexpected call for %q", path)
+		return "", nil
+	})
+	assert.Empty(t, results)
+}
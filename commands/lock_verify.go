@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/github/git-lfs/api"
+	"github.com/github/git-lfs/errors"
+	"github.com/github/git-lfs/lfs"
+	"github.com/rubyist/tracerx"
+)
+
+// commitShaRe matches the SHA-1 of a commit, which pushes from the pre-push
+// hook are named by, rather than by a ref.
+var commitShaRe = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// lockVerification is the result of asking a remote which locks apply to a
+// push.
+type lockVerification struct {
+	// Supported is false if the remote doesn't implement lock
+	// verification, in which case there is nothing to check.
+	Supported bool
+	// Theirs holds the locks held by anyone else, by path.
+	Theirs map[string]api.Lock
+}
+
+// verifyLocks exits, before anything is uploaded, if any of the given pointers
+// is of a file which someone else has locked on the current remote, unless
+// --force-push-locked was given. The remote is only asked once per push, so
+// pushes of several refs reuse the locks found for the first.
+func (c *uploadContext) verifyLocks(ref string, pointers []*lfs.WrappedPointer) {
+	if !isCommandEnabled(cfg, "locks") {
+		return
+	}
+
+	v, ok := c.lockVerifications[cfg.CurrentRemote]
+	if !ok {
+		var err error
+		v, err = fetchLockVerification(ref)
+		if err != nil {
+			Error(err.Error())
+			Exit("Unable to verify locks on %q before pushing.", cfg.CurrentRemote)
+		}
+		c.lockVerifications[cfg.CurrentRemote] = v
+	}
+
+	if !v.Supported {
+		return
+	}
+
+	var conflicts []api.Lock
+	seen := make(map[string]bool)
+	for _, p := range pointers {
+		if seen[p.Name] {
+			continue
+		}
+		seen[p.Name] = true
+
+		if lock, ok := v.Theirs[p.Name]; ok {
+			conflicts = append(conflicts, lock)
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return
+	}
+
+	writeLockConflicts(ErrorWriter, conflicts, time.Now())
+	if c.ForcePushLocked {
+		Error("Pushing anyway, because of --force-push-locked.")
+		return
+	}
+	Exit("Ask the owners to unlock these files, or push again with --force-push-locked.")
+}
+
+// fetchLockVerification asks the current remote which locks apply to a push of
+// "ref", following every page of results. Remotes which don't implement lock
+// verification give an unsupported lockVerification, rather than an error.
+func fetchLockVerification(ref string) (*lockVerification, error) {
+	v := &lockVerification{Supported: true, Theirs: make(map[string]api.Lock)}
+
+	req := &api.VerifiableLockRequest{Limit: locksPageSize}
+	if len(ref) > 0 && !commitShaRe.MatchString(ref) {
+		req.Ref = &api.Ref{Name: ref}
+	}
+
+	for {
+		s, resp := API.Locks.Verify(req)
+		if _, err := API.Do(s); err != nil {
+			if errors.IsNotImplementedError(err) {
+				tracerx.Printf("push: %q doesn't support lock verification, skipping it: %s", cfg.CurrentRemote, err)
+				v.Supported = false
+				return v, nil
+			}
+			return nil, err
+		}
+
+		if resp.Err != "" {
+			return nil, errors.New(resp.Err)
+		}
+
+		for _, lock := range resp.Theirs {
+			v.Theirs[lock.Path] = lock
+		}
+
+		if resp.NextCursor == "" {
+			return v, nil
+		}
+		req.Cursor = resp.NextCursor
+	}
+}
+
+// writeLockConflicts writes a table of the given locks, which are held by
+// someone else on files being pushed, sorted by path, to "w". Their ages are
+// relative to "now".
+func writeLockConflicts(w io.Writer, locks []api.Lock, now time.Time) error {
+	sort.Sort(locksByPath(locks))
+
+	noun := "files"
+	if len(locks) == 1 {
+		noun = "file"
+	}
+
+	if _, err := fmt.Fprintf(w, "Unable to push %d %s locked by other users:\n", len(locks), noun); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "  PATH\tOWNER\tLOCKED")
+	for _, lock := range locks {
+		owner := lock.Committer.Name
+		if len(lock.Committer.Email) > 0 {
+			owner = strings.TrimSpace(fmt.Sprintf("%s <%s>", owner, lock.Committer.Email))
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", lock.Path, owner, humanizeAge(now.Sub(lock.LockedAt)))
+	}
+	return tw.Flush()
+}
+
+// humanizeAge describes how long ago something happened, to the largest whole
+// unit, like "3 hours ago".
+func humanizeAge(d time.Duration) string {
+	var n int64
+	var unit string
+
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		n, unit = int64(d/time.Minute), "minute"
+	case d < 24*time.Hour:
+		n, unit = int64(d/time.Hour), "hour"
+	default:
+		n, unit = int64(d/(24*time.Hour)), "day"
+	}
+
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s ago", n, unit)
+}
+
+type locksByPath []api.Lock
+
+func (l locksByPath) Len() int           { return len(l) }
+func (l locksByPath) Less(i, j int) bool { return l[i].Path < l[j].Path }
+func (l locksByPath) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
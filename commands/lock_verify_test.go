@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/github/git-lfs/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteLockConflicts(t *testing.T) {
+	now := time.Now()
+
+	var buf bytes.Buffer
+	assert.Nil(t, writeLockConflicts(&buf, []api.Lock{
+		{Path: "dir/b.dat", Committer: api.Committer{Name: "Jane Doe", Email: "jane@example.com"}, LockedAt: now.Add(-3 * time.Hour)},
+		{Path: "a.dat", Committer: api.Committer{Name: "John Doe"}, LockedAt: now.Add(-time.Minute)},
+	}, now))
+
+	assert.Equal(t, "Unable to push 2 files locked by other users:\n"+
+		"  PATH       OWNER                        LOCKED\n"+
+		"  a.dat      John Doe                     1 minute ago\n"+
+		"  dir/b.dat  Jane Doe <jane@example.com>  3 hours ago\n", buf.String())
+}
+
+func TestHumanizeAge(t *testing.T) {
+	assert.Equal(t, "just now", humanizeAge(30*time.Second))
+	assert.Equal(t, "5 minutes ago", humanizeAge(5*time.Minute+10*time.Second))
+	assert.Equal(t, "1 hour ago", humanizeAge(time.Hour))
+	assert.Equal(t, "2 days ago", humanizeAge(50*time.Hour))
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/git"
+	"github.com/github/git-lfs/lfs"
+	"github.com/github/git-lfs/tools"
+)
+
+// lockableMismatch is a lockable file whose permissions don't match whether it
+// is locked by the current user.
+type lockableMismatch struct {
+	// Path is relative to the root of the repository.
+	Path string
+	// Writable is whether the file is writable, which it should only be if
+	// it's locked by the current user.
+	Writable bool
+}
+
+// updateLockablePermissions makes the lockable files in the working tree
+// read-only, unless they are locked by the current user, in which case they are
+// made writable, so that they aren't edited without being locked first. If
+// "only" is not nil, just the lockable files among those paths, relative to the
+// root of the repository, are updated. Nothing is done unless locking is
+// enabled, since the files could never be locked otherwise.
+func updateLockablePermissions(only []string) {
+	if !isCommandEnabled(cfg, "locks") {
+		return
+	}
+
+	files, owned, err := lockableFiles(only)
+	if err != nil {
+		Error("Unable to update the permissions of lockable files: %s", err)
+		return
+	}
+
+	for _, err := range setLockablePermissions(config.LocalWorkingDir, files, owned) {
+		Error(err.Error())
+	}
+}
+
+// lockableFiles returns the tracked files which are lockable, limited to those
+// in "only" if it is not nil, and a func which returns whether the current
+// user holds the lock on one of them.
+func lockableFiles(only []string) ([]string, func(string) bool, error) {
+	files, err := git.GetFilesWithAttribute(config.LocalWorkingDir, lockableAttribute)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if only != nil {
+		wanted := make(map[string]bool, len(only))
+		for _, path := range only {
+			wanted[filepath.ToSlash(path)] = true
+		}
+
+		filtered := make([]string, 0, len(only))
+		for _, file := range files {
+			if wanted[file] {
+				filtered = append(filtered, file)
+			}
+		}
+		files = filtered
+	}
+
+	cache, err := loadLockCache(lockCacheFile())
+	if err != nil {
+		return nil, nil, err
+	}
+	return files, cache.Owns, nil
+}
+
+// setLockablePermissions makes each of the lockable "files", relative to
+// "root", writable if "owned" returns true for it, or read-only otherwise.
+// Files which are tracked but missing from the working tree are skipped. It
+// returns an error for each file which couldn't be updated.
+func setLockablePermissions(root string, files []string, owned func(string) bool) []error {
+	var errs []error
+	for _, file := range files {
+		filename := filepath.Join(root, file)
+		writable := owned(file)
+
+		if writable && cfg.HardLinkCheckout() {
+			// A read-only file may be hard linked to its object, which
+			// mustn't be made writable along with it.
+			if fi, err := os.Stat(filename); err == nil && fi.Mode().Perm()&0200 == 0 {
+				if err := lfs.BreakHardLink(filename); err != nil {
+					errs = append(errs, fmt.Errorf("Unable to make %q writable: %s", file, err))
+				}
+				continue
+			}
+		}
+
+		if _, err := tools.SetFileWriteFlag(filename, writable); err != nil && !os.IsNotExist(err) {
+			state := "read-only"
+			if writable {
+				state = "writable"
+			}
+			errs = append(errs, fmt.Errorf("Unable to make %q %s: %s", file, state, err))
+		}
+	}
+	return errs
+}
+
+// findLockableMismatches returns the lockable "files", relative to "root",
+// which are writable without "owned" returning true for them, or read-only
+// although it does. Files which are missing from the working tree are skipped.
+func findLockableMismatches(root string, files []string, owned func(string) bool) ([]lockableMismatch, error) {
+	var mismatches []lockableMismatch
+	for _, file := range files {
+		fi, err := os.Stat(filepath.Join(root, file))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		writable := fi.Mode().Perm()&0200 != 0
+		if writable != owned(file) {
+			mismatches = append(mismatches, lockableMismatch{Path: file, Writable: writable})
+		}
+	}
+	return mismatches, nil
+}
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeLockableFiles(t *testing.T, dir string, mode os.FileMode, names ...string) {
+	for _, name := range names {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		require.Nil(t, os.MkdirAll(filepath.Dir(filename), 0755))
+		require.Nil(t, ioutil.WriteFile(filename, []byte(name), mode))
+		require.Nil(t, os.Chmod(filename, mode))
+	}
+}
+
+func isWritable(t *testing.T, filename string) bool {
+	fi, err := os.Stat(filename)
+	require.Nil(t, err)
+	return fi.Mode().Perm()&0200 != 0
+}
+
+func TestSetLockablePermissions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lockable")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeLockableFiles(t, dir, 0644, "a.dat", "sub/b.dat")
+	writeLockableFiles(t, dir, 0444, "c.dat")
+
+	owned := func(path string) bool { return path == "c.dat" }
+
+	// d.dat is tracked, but has been deleted from the working tree.
+	errs := setLockablePermissions(dir, []string{"a.dat", "sub/b.dat", "c.dat", "d.dat"}, owned)
+	assert.Empty(t, errs)
+
+	assert.False(t, isWritable(t, filepath.Join(dir, "a.dat")))
+	assert.False(t, isWritable(t, filepath.Join(dir, "sub", "b.dat")))
+	assert.True(t, isWritable(t, filepath.Join(dir, "c.dat")))
+	_, err = os.Stat(filepath.Join(dir, "d.dat"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFindLockableMismatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lockable")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeLockableFiles(t, dir, 0644, "a.dat", "b.dat")
+	writeLockableFiles(t, dir, 0444, "c.dat", "d.dat")
+
+	owned := func(path string) bool { return path == "b.dat" || path == "c.dat" }
+
+	mismatches, err := findLockableMismatches(dir, []string{"a.dat", "b.dat", "c.dat", "d.dat", "missing.dat"}, owned)
+	assert.Nil(t, err)
+	assert.Equal(t, []lockableMismatch{
+		{Path: "a.dat", Writable: true},
+		{Path: "c.dat", Writable: false},
+	}, mismatches)
+}
+
+func TestLockCacheRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lockcache")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "lfs", "lockcache.json")
+
+	cache, err := loadLockCache(filename)
+	require.Nil(t, err)
+	assert.False(t, cache.Owns("a.dat"))
+
+	cache.Add("a.dat", "1")
+	cache.Add(filepath.Join("sub", "b.dat"), "2")
+	cache.Add("c.dat", "3")
+	cache.Remove("c.dat")
+	require.Nil(t, cache.Save())
+
+	cache, err = loadLockCache(filename)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]string{"a.dat": "1", "sub/b.dat": "2"}, cache.Locks)
+	assert.True(t, cache.Owns("sub/b.dat"))
+	assert.False(t, cache.Owns("c.dat"))
+}
@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/github/git-lfs/errors"
+	"github.com/github/git-lfs/git"
+	"github.com/github/git-lfs/lfs"
+	"github.com/rubyist/tracerx"
+)
+
+// maxMissingObjectCommits is the most commits listed for each missing object.
+const maxMissingObjectCommits = 3
+
+// missingObject is an object which couldn't be pushed, because it isn't in
+// .git/lfs/objects and couldn't be recreated from the working tree.
+type missingObject struct {
+	Name    string   // path of the pointer, empty if it was pushed by OID
+	Oid     string   // OID of the object
+	Reason  string   // what went wrong recreating it, if worth saying
+	Commits []string // commits which added the pointer
+}
+
+// newMissingObject describes the object of pointer "p", found from "ref",
+// which NewUploadable failed to find with the error "err". It looks up the
+// commits which added the pointer, so that users can tell where it came from.
+func newMissingObject(ref string, p *lfs.WrappedPointer, err error) *missingObject {
+	m := &missingObject{Name: p.Name, Oid: p.Oid}
+
+	if errors.IsCleanPointerError(err) {
+		m.Reason = fmt.Sprintf(uploadMissingErr, p.Oid, p.Name, errors.GetContext(err, "pointer").(*lfs.Pointer).Oid)
+	}
+
+	if len(p.Name) > 0 && len(p.Sha1) > 0 {
+		commits, err := git.CommitsWithBlob(ref, p.Name, p.Sha1, maxMissingObjectCommits)
+		if err != nil {
+			tracerx.Printf("push: finding commits for missing object %s: %s", p.Oid, err)
+		}
+		m.Commits = commits
+	}
+
+	return m
+}
+
+// writeMissingObjects writes a summary of the objects in "missing", sorted by
+// name and then OID, to "w", followed by a hint on how to get them.
+func writeMissingObjects(w io.Writer, missing []*missingObject) error {
+	sort.Sort(missingObjectsByName(missing))
+
+	noun := "objects"
+	if len(missing) == 1 {
+		noun = "object"
+	}
+
+	lines := []string{fmt.Sprintf("Unable to push %d %s missing from .git/lfs/objects:", len(missing), noun)}
+	for _, m := range missing {
+		if len(m.Name) > 0 {
+			lines = append(lines, fmt.Sprintf("  %s (%s)", m.Name, m.Oid))
+		} else {
+			lines = append(lines, fmt.Sprintf("  %s", m.Oid))
+		}
+
+		if len(m.Reason) > 0 {
+			lines = append(lines, "    "+m.Reason)
+		}
+		if len(m.Commits) > 0 {
+			lines = append(lines, "    referenced by commit "+strings.Join(m.Commits, ", "))
+		}
+	}
+	lines = append(lines,
+		"Run `git lfs fetch --all <remote>` with a remote which has these objects to",
+		"download them, and then push again.")
+
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+type missingObjectsByName []*missingObject
+
+func (m missingObjectsByName) Len() int      { return len(m) }
+func (m missingObjectsByName) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m missingObjectsByName) Less(i, j int) bool {
+	if m[i].Name != m[j].Name {
+		return m[i].Name < m[j].Name
+	}
+	return m[i].Oid < m[j].Oid
+}
@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteMissingObjects(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, writeMissingObjects(&buf, []*missingObject{
+		{Name: "b.dat", Oid: "bbbb", Commits: []string{"c2", "c1"}},
+		{Oid: "0000"},
+		{Name: "a.dat", Oid: "aaaa", Reason: "aaaa does not exist in .git/lfs/objects."},
+	}))
+
+	assert.Equal(t, "Unable to push 3 objects missing from .git/lfs/objects:\n"+
+		"  0000\n"+
+		"  a.dat (aaaa)\n"+
+		"    aaaa does not exist in .git/lfs/objects.\n"+
+		"  b.dat (bbbb)\n"+
+		"    referenced by commit c2, c1\n"+
+		"Run `git lfs fetch --all <remote>` with a remote which has these objects to\n"+
+		"download them, and then push again.\n", buf.String())
+}
+
+func TestWriteMissingObject(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, writeMissingObjects(&buf, []*missingObject{{Name: "a.dat", Oid: "aaaa"}}))
+
+	assert.Contains(t, buf.String(), "Unable to push 1 object missing from .git/lfs/objects:\n")
+}
@@ -6,8 +6,10 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/github/git-lfs/config"
 	"github.com/github/git-lfs/httputil"
 	"github.com/github/git-lfs/localstorage"
+	"github.com/github/git-lfs/metrics"
 	"github.com/spf13/cobra"
 )
 
@@ -62,8 +64,51 @@ func Run() {
 		}
 	}
 
+	startMetrics(root)
 	root.Execute()
 	httputil.LogHttpStats(cfg)
+	finishMetrics()
+}
+
+// startMetrics begins recording metrics for the command about to be run, if
+// GIT_LFS_METRICS_FILE is set.
+func startMetrics(root *cobra.Command) {
+	path, _ := cfg.Os.Get("GIT_LFS_METRICS_FILE")
+	if len(path) == 0 {
+		return
+	}
+
+	name := root.Name()
+	if cmd, _, err := root.Find(os.Args[1:]); err == nil {
+		name = cmd.Name()
+	}
+
+	metrics.Start(path, name, config.Version)
+}
+
+// exit writes the metrics recorded for this command, if GIT_LFS_METRICS_FILE
+// is set, and exits with the given status. Commands which exit before Run
+// returns use it instead of os.Exit, so that the metrics are written however
+// they exit.
+func exit(code int) {
+	finishMetrics()
+	os.Exit(code)
+}
+
+// finishMetrics writes the metrics recorded for this command, along with the
+// settings which affect its performance.
+func finishMetrics() {
+	if !metrics.Enabled() {
+		return
+	}
+
+	metrics.Set("concurrent_transfers", cfg.ConcurrentTransfers())
+	metrics.Set("batch_transfer", cfg.BatchTransfer())
+	metrics.Set("max_bandwidth", cfg.TransferMaxBandwidth())
+
+	if err := metrics.Finish(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing metrics: %s\n", err)
+	}
 }
 
 func gitlfsCommand(cmd *cobra.Command, args []string) {
@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/github/git-lfs/progress"
+)
+
+const (
+	// touchWorkers is the most files whose times are updated at once.
+	touchWorkers = 8
+
+	// touchSummaryThreshold is the number of matching files above which
+	// track shows its progress while touching them, and --verbose prints a
+	// summary rather than a line for each file.
+	touchSummaryThreshold = 1000
+
+	// touchProgressInterval is how many files are touched between updates
+	// of the progress spinner.
+	touchProgressInterval = 100
+)
+
+// touchFiles sets the access and modification times of "files" to "now", so
+// that git sees them as modified, using up to "workers" goroutines. It calls
+// "touched" from a single goroutine as each file is done, with the error from
+// os.Chtimes, if any.
+func touchFiles(files []string, now time.Time, workers int, touched func(name string, err error)) {
+	type touchResult struct {
+		name string
+		err  error
+	}
+
+	names := make(chan string, workers)
+	results := make(chan touchResult, workers)
+
+	var wait sync.WaitGroup
+	wait.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wait.Done()
+			for name := range names {
+				results <- touchResult{name, os.Chtimes(name, now, now)}
+			}
+		}()
+	}
+
+	go func() {
+		for _, name := range files {
+			names <- name
+		}
+		close(names)
+		wait.Wait()
+		close(results)
+	}()
+
+	for r := range results {
+		touched(r.name, r.err)
+	}
+}
+
+// touchTrackedFiles marks the files which match a newly tracked pattern as
+// modified. For many files, it shows its progress, and with --verbose prints
+// how long it took rather than each file's name.
+func touchTrackedFiles(files []string) {
+	many := len(files) > touchSummaryThreshold
+
+	var spinner *progress.Spinner
+	if many && !quietProgress() {
+		spinner = progress.NewSpinner()
+	}
+
+	start := time.Now()
+	count := 0
+	touchFiles(files, start, touchWorkers, func(name string, err error) {
+		if err != nil {
+			LoggedError(err, "Error marking %q modified", name)
+			return
+		}
+
+		count++
+		if trackVerboseLoggingFlag && !many {
+			Print("Git LFS: touching %s", name)
+		}
+		if spinner != nil && count%touchProgressInterval == 0 {
+			spinner.Print(OutputWriter, fmt.Sprintf("Touching files: %d of %d", count, len(files)))
+		}
+	})
+
+	if spinner != nil {
+		spinner.Finish(OutputWriter, fmt.Sprintf("Touching files: %d of %d, done", count, len(files)))
+	}
+	if trackVerboseLoggingFlag && many {
+		elapsed := time.Since(start)
+		Print("Git LFS: touched %s files in %s", formatCount(count), elapsed-elapsed%time.Millisecond)
+	}
+}
+
+// formatCount formats "n" with commas between each group of three digits, so
+// that large counts are easier to read.
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return sign + s
+}
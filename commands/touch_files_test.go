@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTouchFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "touch-files")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	var files []string
+	for _, name := range []string{"a.bin", "b.bin", "c.bin", "d.bin", "e.bin"} {
+		path := filepath.Join(dir, name)
+		require.Nil(t, ioutil.WriteFile(path, []byte(name), 0644))
+		files = append(files, path)
+	}
+	missing := filepath.Join(dir, "missing.bin")
+
+	now := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	var touched, failed []string
+	touchFiles(append(files, missing), now, 2, func(name string, err error) {
+		if err != nil {
+			failed = append(failed, name)
+		} else {
+			touched = append(touched, name)
+		}
+	})
+
+	sort.Strings(touched)
+	assert.Equal(t, files, touched)
+	assert.Equal(t, []string{missing}, failed)
+
+	for _, path := range files {
+		info, err := os.Stat(path)
+		require.Nil(t, err)
+		assert.True(t, now.Equal(info.ModTime()), "%s modified at %s", path, info.ModTime())
+	}
+}
+
+func TestTouchFilesWithoutFiles(t *testing.T) {
+	touchFiles(nil, time.Now(), touchWorkers, func(name string, err error) {
+		t.Errorf("unexpected file %q", name)
+	})
+}
+
+func TestFormatCount(t *testing.T) {
+	for n, expected := range map[int]string{
+		0:        "0",
+		999:      "999",
+		1000:     "1,000",
+		182334:   "182,334",
+		1234567:  "1,234,567",
+		-1234567: "-1,234,567",
+	} {
+		assert.Equal(t, expected, formatCount(n))
+	}
+}
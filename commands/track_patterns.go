@@ -0,0 +1,147 @@
+package commands
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/github/git-lfs/errors"
+	"github.com/github/git-lfs/tools"
+)
+
+// windowsVolume matches the drive letter or UNC server at the start of an
+// absolute Windows path, once its backslashes have been replaced.
+var windowsVolume = regexp.MustCompile(`^([A-Za-z]:|//[^/])`)
+
+// normalizeTrackPattern checks "pattern", given to track in the directory
+// "relpath" of the working tree at "root", and returns it ready to be added
+// to .gitattributes, with notes about anything surprising in it. On Windows,
+// given by "windows", backslashes are taken to separate directories, rather
+// than to escape the next character as git does. Patterns which are absolute
+// paths, or which are outside the repository, are rejected.
+func normalizeTrackPattern(pattern, relpath, root string, local, windows bool) (string, []string, error) {
+	var notes []string
+
+	if windows && strings.Contains(pattern, `\`) {
+		given := pattern
+		pattern = strings.Replace(pattern, `\`, "/", -1)
+		notes = append(notes, fmt.Sprintf("Note: using %s for %s, since .gitattributes separates directories with slashes.", pattern, given))
+	}
+
+	if slashRoot := filepath.ToSlash(root); len(slashRoot) > 1 && hasPathPrefix(pattern, slashRoot, windows) {
+		suggestion := strings.TrimPrefix(pattern[len(slashRoot):], "/")
+		if len(suggestion) == 0 {
+			suggestion = "."
+		}
+		return "", nil, errors.Errorf("%s is an absolute path. Give paths relative to the repository instead, such as %s.", pattern, suggestion)
+	}
+	if windows && windowsVolume.MatchString(pattern) {
+		return "", nil, errors.Errorf("%s is an absolute path. Give paths relative to the repository instead.", pattern)
+	}
+
+	// "." and ".." never match anything in .gitattributes, so they are
+	// resolved here. path.Clean keeps the leading slash of an anchored
+	// pattern.
+	if hasDotComponent(pattern) {
+		pattern = path.Clean(pattern)
+	}
+
+	if local {
+		if pattern == ".." || strings.HasPrefix(pattern, "../") {
+			return "", nil, errors.Errorf("%s is outside of the current directory, so it can't be added to its .gitattributes file.", pattern)
+		}
+	} else if fromRoot := path.Join(filepath.ToSlash(relpath), pattern); fromRoot == ".." || strings.HasPrefix(fromRoot, "../") {
+		return "", nil, errors.Errorf("%s is outside of the repository.", pattern)
+	}
+
+	if strings.HasPrefix(pattern, "/") {
+		where := "the root of the repository"
+		if relpath != "." {
+			where = filepath.ToSlash(relpath) + "/"
+		}
+		notes = append(notes, fmt.Sprintf("Note: the leading slash in %s anchors it to %s, so it only matches files there, not in subdirectories.", pattern, where))
+	}
+
+	return pattern, notes, nil
+}
+
+// hasPathPrefix returns whether "p" is the directory "dir", or a path in it,
+// ignoring case if "fold" is set.
+func hasPathPrefix(p, dir string, fold bool) bool {
+	if len(p) < len(dir) || (len(p) > len(dir) && p[len(dir)] != '/') {
+		return false
+	}
+	if fold {
+		return strings.EqualFold(p[:len(dir)], dir)
+	}
+	return p[:len(dir)] == dir
+}
+
+// hasDotComponent returns whether "pattern" has a "." or ".." component.
+func hasDotComponent(pattern string) bool {
+	for _, part := range strings.Split(pattern, "/") {
+		if part == "." || part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// hasGlob returns whether "pattern" contains any wildcards.
+func hasGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// patternDirectory returns the directory which "pattern", relative to the
+// root of the working tree, only matches files in: the part of its path before
+// any wildcards. It is empty if the pattern can match files anywhere, since it
+// has no slash, or starts with a wildcard.
+func patternDirectory(pattern string) string {
+	pattern = strings.TrimPrefix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		return ""
+	}
+
+	parts := strings.Split(pattern, "/")
+	dir := make([]string, 0, len(parts)-1)
+	for _, part := range parts[:len(parts)-1] {
+		if hasGlob(part) {
+			break
+		}
+		dir = append(dir, part)
+	}
+	return strings.Join(dir, "/")
+}
+
+// covers reports whether every file matched by "other" is also matched by
+// this pattern, such as "images/*.png" by "*.png". Only the cases which are
+// simple to tell are recognized, so some patterns which are covered may not
+// be reported as such.
+func (p *addedPattern) covers(other *addedPattern) bool {
+	if strings.Contains(p.pattern, "/") {
+		// An anchored pattern can only cover a single file.
+		if !strings.Contains(other.pattern, "/") || hasGlob(other.pattern) {
+			return false
+		}
+		return p.matches(path.Join(filepath.ToSlash(other.dir), strings.TrimPrefix(other.pattern, "/")), false)
+	}
+
+	// This pattern matches basenames anywhere under its directory, so the
+	// other has to be under it too.
+	dir := filepath.ToSlash(p.dir)
+	scope := filepath.ToSlash(other.dir)
+	if strings.Contains(other.pattern, "/") {
+		scope = path.Join(scope, path.Dir(strings.TrimPrefix(other.pattern, "/")))
+	}
+	if dir != "." && dir != "" && scope != dir && !strings.HasPrefix(scope, dir+"/") {
+		return false
+	}
+
+	base := path.Base(other.pattern)
+	if hasGlob(base) {
+		return p.pattern == base || p.pattern == "*"
+	}
+	return tools.Wildmatch(p.pattern, base)
+}
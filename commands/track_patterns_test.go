@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeTrackPattern(t *testing.T) {
+	for desc, c := range map[string]struct {
+		pattern, relpath string
+		local, windows   bool
+		expected         string
+		notes            int
+		err              bool
+	}{
+		"basename":                 {"*.png", ".", false, false, "*.png", 0, false},
+		"path":                     {"images/*.png", ".", false, false, "images/*.png", 0, false},
+		"backslash on windows":     {`images\*.png`, ".", false, true, "images/*.png", 1, false},
+		"escape elsewhere":         {`\*.png`, ".", false, false, `\*.png`, 0, false},
+		"absolute in repo":         {"/repo/images/*.png", ".", false, false, "", 0, true},
+		"the repo itself":          {"/repo", ".", false, false, "", 0, true},
+		"absolute on windows":      {`C:\repo\*.png`, ".", false, true, "", 0, true},
+		"other drive on windows":   {`D:\other\*.png`, ".", false, true, "", 0, true},
+		"unc path on windows":      {`\\server\share\*.png`, ".", false, true, "", 0, true},
+		"case folded on windows":   {`c:\REPO\*.png`, ".", false, true, "", 0, true},
+		"similar prefix":           {"/repository/*.png", ".", false, false, "/repository/*.png", 1, false},
+		"leading slash":            {"/*.png", ".", false, false, "/*.png", 1, false},
+		"leading slash in subdir":  {"/*.png", "images", false, false, "/*.png", 1, false},
+		"dot":                      {"./*.png", ".", false, false, "*.png", 0, false},
+		"dot dot inside":           {"images/../*.png", ".", false, false, "*.png", 0, false},
+		"parent from subdirectory": {"../*.png", "images", false, false, "../*.png", 0, false},
+		"outside the repository":   {"../*.png", ".", false, false, "", 0, true},
+		"far outside":              {"../../*.png", "images", false, false, "", 0, true},
+		"parent with --local":      {"../*.png", "images", true, false, "", 0, true},
+		"inside with --local":      {"a/../*.png", "images", true, false, "*.png", 0, false},
+	} {
+		root := "/repo"
+		if c.windows {
+			root = `C:\repo`
+		}
+
+		pattern, notes, err := normalizeTrackPattern(c.pattern, c.relpath, root, c.local, c.windows)
+		if c.err {
+			assert.NotNil(t, err, desc)
+			continue
+		}
+		assert.Nil(t, err, desc)
+		assert.Equal(t, c.expected, pattern, desc)
+		assert.Len(t, notes, c.notes, desc)
+	}
+}
+
+func TestAddedPatternCovers(t *testing.T) {
+	for desc, c := range map[string]struct {
+		dir, pattern           string
+		otherDir, otherPattern string
+		expected               bool
+	}{
+		"same pattern":             {".", "*.png", ".", "*.png", true},
+		"pattern in directory":     {".", "*.png", ".", "images/*.png", true},
+		"pattern in subdirectory":  {".", "*.png", "images", "*.png", true},
+		"file":                     {".", "*.png", ".", "images/a.png", true},
+		"anchored file":            {".", "*.png", ".", "/a.png", true},
+		"other extension":          {".", "*.png", ".", "images/*.jpg", false},
+		"narrower glob":            {".", "*.png", ".", "a*.png", false},
+		"everything":               {".", "*", ".", "images/*.jpg", true},
+		"outside local directory":  {"images", "*.png", ".", "*.png", false},
+		"inside local directory":   {"images", "*.png", ".", "images/old/*.png", true},
+		"sibling local directory":  {"images", "*.png", "imagesold", "*.png", false},
+		"broader pattern":          {".", "images/*.png", ".", "*.png", false},
+		"file under path":          {".", "images/*.png", ".", "images/a.png", true},
+		"file under path deeper":   {".", "images/*.png", ".", "images/old/a.png", false},
+		"glob under path":          {".", "images/*.png", ".", "images/a*.png", false},
+		"file under local pattern": {"images", "/*.png", ".", "images/a.png", true},
+	} {
+		p := &addedPattern{dir: c.dir, pattern: c.pattern}
+		other := &addedPattern{dir: c.otherDir, pattern: c.otherPattern}
+		assert.Equal(t, c.expected, p.covers(other), desc)
+	}
+}
+
+func TestPatternDirectory(t *testing.T) {
+	for pattern, expected := range map[string]string{
+		"*.bin":                "",
+		"/*.bin":               "",
+		"build/*.bin":          "build",
+		"/build/*.bin":         "build",
+		"build/out/a.bin":      "build/out",
+		"build/*/a.bin":        "build",
+		"**/build/*.bin":       "",
+		`build/\*.bin`:         "build",
+		`build\[1\]/a.bin`:     "",
+		"build/[ab]/*.bin":     "build",
+		"build with space/*.a": "build with space",
+	} {
+		assert.Equal(t, expected, patternDirectory(pattern), pattern)
+	}
+}
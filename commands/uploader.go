@@ -1,25 +1,99 @@
 package commands
 
 import (
-	"os"
-
-	"github.com/github/git-lfs/errors"
 	"github.com/github/git-lfs/lfs"
 	"github.com/github/git-lfs/tools"
+	"github.com/github/git-lfs/transfer"
+	"github.com/rubyist/tracerx"
 )
 
 var uploadMissingErr = "%s does not exist in .git/lfs/objects. Tried %s, which matches %s."
 
 type uploadContext struct {
-	DryRun       bool
-	uploadedOids tools.StringSet
+	DryRun          bool
+	Quiet           bool // print only a progress summary
+	NoResume        bool // don't skip objects an interrupted push uploaded
+	ForcePushLocked bool // push files which someone else has locked
+	uploadedOids    tools.StringSet
+	dryRunReport    *dryRunReport
+
+	// presentCount and presentSize total up the objects which were not
+	// pushed because the server already had them.
+	presentCount int
+	presentSize  int64
+
+	// missing holds the objects which couldn't be pushed because they
+	// aren't in .git/lfs/objects.
+	missing []*missingObject
+
+	// lockVerifications caches the locks found on each remote, by name.
+	lockVerifications map[string]*lockVerification
 }
 
 func newUploadContext(dryRun bool) *uploadContext {
-	return &uploadContext{
-		DryRun:       dryRun,
-		uploadedOids: tools.NewStringSet(),
+	c := &uploadContext{
+		DryRun:            dryRun,
+		uploadedOids:      tools.NewStringSet(),
+		lockVerifications: make(map[string]*lockVerification),
+	}
+	if dryRun {
+		c.dryRunReport = newDryRunReport("push")
+	}
+	return c
+}
+
+// ReportDryRun prints the objects which a dry run would have pushed, along
+// with whether the server already has them. It does nothing unless this is a
+// dry run.
+func (c *uploadContext) ReportDryRun(asJSON bool) {
+	if !c.DryRun {
+		return
+	}
+
+	if err := c.dryRunReport.Write(OutputWriter, asJSON); err != nil {
+		ExitWithError(err)
+	}
+}
+
+// ReportAlreadyPresent prints how many objects were skipped because the server
+// already had them. Dry runs list these objects in their own report instead.
+func (c *uploadContext) ReportAlreadyPresent() {
+	if c.DryRun || c.presentCount == 0 {
+		return
+	}
+
+	Print("%d objects already on server (%s) skipped", c.presentCount, humanizeBytes(c.presentSize))
+}
+
+// ReportMissing prints a summary of the objects which couldn't be pushed
+// because they are missing from .git/lfs/objects, if there are any, and exits.
+func (c *uploadContext) ReportMissing() {
+	if len(c.missing) == 0 {
+		return
+	}
+
+	writeMissingObjects(ErrorWriter, c.missing)
+	exit(2)
+}
+
+// setJournal gives "q" the journal for uploads of "ref" to the current remote,
+// so that if this push is interrupted, the next can skip the objects which it
+// uploaded. Without a journal, everything is pushed as usual.
+func (c *uploadContext) setJournal(q *lfs.TransferQueue, ref string) {
+	j, err := lfs.NewTransferJournal(transfer.Upload, cfg.CurrentRemote, ref)
+	if err != nil {
+		tracerx.Printf("push: not using a transfer journal: %s", err)
+		return
+	}
+
+	if c.NoResume {
+		if err := j.Discard(); err != nil {
+			tracerx.Printf("push: not using a transfer journal: %s", err)
+			j.Close()
+			return
+		}
 	}
+	q.SetJournal(j)
 }
 
 // AddUpload adds the given oid to the set of oids that have been uploaded in
@@ -69,9 +143,23 @@ func (c *uploadContext) prepareUpload(unfiltered []*lfs.WrappedPointer) (*lfs.Tr
 	// build the TransferQueue, automatically skipping any missing objects that
 	// the server already has.
 	uploadQueue := lfs.NewUploadQueue(numObjects, totalSize, c.DryRun)
+	if c.Quiet {
+		uploadQueue.SetQuiet()
+	}
 	for _, p := range missingLocalObjects {
 		if c.HasUploaded(p.Oid) {
 			uploadQueue.Skip(p.Size)
+			c.presentCount++
+			c.presentSize += p.Size
+			if c.DryRun {
+				c.dryRunReport.Add(&lfs.DryRunEntry{
+					Name:      p.Name,
+					Oid:       p.Oid,
+					Size:      p.Size,
+					Direction: "upload",
+					Action:    "skip",
+				})
+			}
 		} else {
 			uploadables = append(uploadables, p)
 		}
@@ -111,29 +199,30 @@ func (c *uploadContext) checkMissing(missing []*lfs.WrappedPointer, missingSize
 	<-done
 }
 
-func upload(c *uploadContext, unfiltered []*lfs.WrappedPointer) {
-	if c.DryRun {
-		for _, p := range unfiltered {
-			if c.HasUploaded(p.Oid) {
-				continue
-			}
-
-			Print("push %s => %s", p.Oid, p.Name)
-			c.SetUploaded(p.Oid)
-		}
+// upload pushes the objects of the given pointers, which were found from "ref",
+// to the current remote.
+func upload(c *uploadContext, ref string, unfiltered []*lfs.WrappedPointer) {
+	c.verifyLocks(ref, unfiltered)
 
-		return
+	q, pointers := c.prepareUpload(unfiltered)
+	if c.DryRun {
+		q.SetDryRunCallback(c.dryRunReport.Add)
+	} else {
+		c.setJournal(q, ref)
 	}
 
-	q, pointers := c.prepareUpload(unfiltered)
 	for _, p := range pointers {
 		u, err := lfs.NewUploadable(p.Oid, p.Name)
 		if err != nil {
-			if errors.IsCleanPointerError(err) {
-				Exit(uploadMissingErr, p.Oid, p.Name, errors.GetContext(err, "pointer").(*lfs.Pointer).Oid)
-			} else {
+			if lfs.ObjectExistsOfSize(p.Oid, p.Size) {
 				ExitWithError(err)
 			}
+
+			// Carry on pushing everything else, and report all of
+			// the missing objects together at the end.
+			c.missing = append(c.missing, newMissingObject(ref, p, err))
+			c.SetUploaded(p.Oid)
+			continue
 		}
 
 		q.Add(u)
@@ -141,12 +230,18 @@ func upload(c *uploadContext, unfiltered []*lfs.WrappedPointer) {
 	}
 
 	q.Wait()
+	warnIfLegacyFallback(q)
+
+	count, size := q.AlreadyPresent()
+	c.presentCount += count
+	c.presentSize += size
 
 	for _, err := range q.Errors() {
 		FullError(err)
 	}
 
 	if len(q.Errors()) > 0 {
-		os.Exit(2)
+		c.ReportMissing()
+		exit(2)
 	}
 }
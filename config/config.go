@@ -6,10 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ThomsonReutersEikon/go-ntlm/ntlm"
 	"github.com/bgentry/go-netrc/netrc"
@@ -269,6 +271,85 @@ func (c *Configuration) ConcurrentTransfers() int {
 	return uploads
 }
 
+// DirectionalConcurrentTransfers returns the number of objects transferred at
+// once in the given direction, "download" or "upload". It is given by
+// lfs.transfer.concurrentdownloads or lfs.transfer.concurrentuploads, and
+// defaults to ConcurrentTransfers(), including if the value is invalid.
+func (c *Configuration) DirectionalConcurrentTransfers(operation string) int {
+	if c.NtlmAccess("download") {
+		return 1
+	}
+
+	key := "lfs.transfer.concurrentuploads"
+	if operation == "download" {
+		key = "lfs.transfer.concurrentdownloads"
+	}
+
+	if v, ok := c.Git.Get(key); ok {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			return n
+		}
+	}
+
+	return c.ConcurrentTransfers()
+}
+
+// TransferAPIConcurrency returns the number of API requests for object metadata
+// which may be made at once, which is only done concurrently with the legacy
+// API. It is given by lfs.transfer.apiconcurrency, and defaults to
+// ConcurrentTransfers(), including if the value is invalid.
+func (c *Configuration) TransferAPIConcurrency() int {
+	if c.NtlmAccess("download") {
+		return 1
+	}
+
+	if v, ok := c.Git.Get("lfs.transfer.apiconcurrency"); ok {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			return n
+		}
+	}
+	return c.ConcurrentTransfers()
+}
+
+// ConcurrentCheckouts returns the number of files `git lfs checkout` writes at
+// once. It is given by lfs.concurrentcheckouts, and defaults to
+// ConcurrentTransfers(), including if the value is invalid.
+func (c *Configuration) ConcurrentCheckouts() int {
+	if v, ok := c.Git.Get("lfs.concurrentcheckouts"); ok {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			return n
+		}
+	}
+	return c.ConcurrentTransfers()
+}
+
+// HTTP2Enabled returns whether connections to Git LFS servers may use HTTP/2,
+// if the server supports it. It is given by lfs.http2, and defaults to false.
+func (c *Configuration) HTTP2Enabled() bool {
+	return c.Git.Bool("lfs.http2", false)
+}
+
+// TransferHTTP2Concurrency returns the number of objects transferred at once
+// with a host which answers over HTTP/2, where they are all multiplexed over a
+// single connection. It is given by lfs.transfer.http2concurrency, and
+// defaults to ConcurrentTransfers(), including if the value is invalid.
+func (c *Configuration) TransferHTTP2Concurrency() int {
+	if c.NtlmAccess("download") {
+		return 1
+	}
+
+	if v, ok := c.Git.Get("lfs.transfer.http2concurrency"); ok {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			return n
+		}
+	}
+	return c.ConcurrentTransfers()
+}
+
 // BasicTransfersOnly returns whether to only allow "basic" HTTP transfers.
 // Default is false, including if the lfs.basictransfersonly is invalid
 func (c *Configuration) BasicTransfersOnly() bool {
@@ -281,10 +362,250 @@ func (c *Configuration) TusTransfersAllowed() bool {
 	return c.Git.Bool("lfs.tustransfers", false)
 }
 
+// ProgressQuiet returns whether to only print a summary of progress when
+// transfers finish, rather than drawing a progress bar as they run. Default is
+// false, including if the lfs.quiet is invalid
+func (c *Configuration) ProgressQuiet() bool {
+	return c.Git.Bool("lfs.quiet", false)
+}
+
+// TransferVerifyUploads returns whether to hash each object before uploading
+// it, to check that its content still matches its OID. Default is false,
+// including if the lfs.transfer.verifyupload is invalid
+func (c *Configuration) TransferVerifyUploads() bool {
+	return c.Git.Bool("lfs.transfer.verifyupload", false)
+}
+
+// DeltaTransfersAllowed returns whether to offer the "delta" transfer method,
+// which uploads objects as patches against older objects. Default is false,
+// including if the lfs.deltatransfers is invalid
+func (c *Configuration) DeltaTransfersAllowed() bool {
+	return c.Git.Bool("lfs.deltatransfers", false)
+}
+
+// DeltaTransferMaxRatio returns the largest size a patch may be, as a fraction
+// of the object it produces, for it to be uploaded instead of the whole
+// object. It is given by lfs.transfer.deltamaxratio, which must be greater
+// than 0 and at most 1. Default is 0.5.
+func (c *Configuration) DeltaTransferMaxRatio() float64 {
+	if v, ok := c.Git.Get("lfs.transfer.deltamaxratio"); ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err == nil && f > 0 && f <= 1 {
+			return f
+		}
+	}
+	return 0.5
+}
+
+// TransferMaxBandwidth returns the maximum combined rate, in bytes per second,
+// at which objects are transferred, as given by lfs.transfer.maxbandwidth.
+// Zero, the default, means unlimited.
+func (c *Configuration) TransferMaxBandwidth() int64 {
+	if v, ok := c.Git.Get("lfs.transfer.maxbandwidth"); ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// TransferMaxFailures returns the number of failed transfers after which the
+// remaining transfers are abandoned, as given by lfs.transfer.maxfailures.
+// Zero, the default, means there is no limit.
+func (c *Configuration) TransferMaxFailures() int {
+	if v, ok := c.Git.Get("lfs.transfer.maxfailures"); ok {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// TransferMaxPending returns the number of unfinished objects at which adding
+// more to a transfer queue blocks, as given by lfs.transfer.maxpending. Zero,
+// the default, means there is no limit.
+func (c *Configuration) TransferMaxPending() int {
+	if v, ok := c.Git.Get("lfs.transfer.maxpending"); ok {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// TransferMaxPerHost returns the number of objects which may be transferred
+// to or from any one host at once, as given by lfs.transfer.maxperhost. Zero,
+// the default, means there is no limit besides lfs.concurrenttransfers.
+func (c *Configuration) TransferMaxPerHost() int {
+	if v, ok := c.Git.Get("lfs.transfer.maxperhost"); ok {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// TransferMaxRetries returns the number of times an object may be retried
+// after errors other than network errors, such as 5xx responses, as given by
+// lfs.transfer.maxretries. It defaults to 2, including if the value is invalid.
+func (c *Configuration) TransferMaxRetries() int {
+	return c.transferRetries("lfs.transfer.maxretries", 2)
+}
+
+// TransferMaxNetworkRetries returns the number of times an object may be
+// retried after network errors, such as failed connections and timeouts, as
+// given by lfs.transfer.maxnetworkretries. These are counted separately from
+// the retries allowed by TransferMaxRetries. It defaults to 3, including if the
+// value is invalid.
+func (c *Configuration) TransferMaxNetworkRetries() int {
+	return c.transferRetries("lfs.transfer.maxnetworkretries", 3)
+}
+
+// TransferRetryAllErrors returns whether objects may be retried after any
+// error, up to TransferMaxRetries times, including client errors and errors
+// which aren't otherwise retriable, as given by lfs.transfer.retryallerrors. It
+// is meant for servers or proxies which fail transiently in ways which look
+// permanent. Default is false, including if the value is invalid.
+func (c *Configuration) TransferRetryAllErrors() bool {
+	return c.Git.Bool("lfs.transfer.retryallerrors", false)
+}
+
+func (c *Configuration) transferRetries(key string, def int) int {
+	if v, ok := c.Git.Get(key); ok {
+		n, err := strconv.Atoi(v)
+		if err == nil && n >= 0 {
+			return n
+		}
+	}
+	return def
+}
+
+// TransferTimeout returns how long a transfer queue may run before it gives up
+// on the objects which haven't been transferred yet, as given by
+// lfs.transfer.timeout in a form accepted by time.ParseDuration, such as
+// "30m". Zero, the default, means there is no time limit.
+func (c *Configuration) TransferTimeout() time.Duration {
+	if v, ok := c.Git.Get("lfs.transfer.timeout"); ok {
+		d, err := time.ParseDuration(v)
+		if err == nil && d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// TransferExpiryMargin returns how long before the actions given for an
+// object by the batch API expire that they are refreshed, before starting to
+// transfer it, as given by lfs.transfer.expirymargin in a form accepted by
+// time.ParseDuration. Default is 5s, including if the value is invalid.
+func (c *Configuration) TransferExpiryMargin() time.Duration {
+	if v, ok := c.Git.Get("lfs.transfer.expirymargin"); ok {
+		d, err := time.ParseDuration(v)
+		if err == nil && d >= 0 {
+			return d
+		}
+	}
+	return 5 * time.Second
+}
+
+// TransferCompression returns the content encoding used to compress objects
+// in transfers with servers which support it, as given by
+// lfs.transfer.compression. The only encoding supported is "gzip". An empty
+// string, the default, means that objects are not compressed.
+func (c *Configuration) TransferCompression() string {
+	if v, ok := c.Git.Get("lfs.transfer.compression"); ok {
+		if v = strings.ToLower(v); v == "gzip" {
+			return v
+		}
+	}
+	return ""
+}
+
+// TransferOrder returns the order in which queued objects are transferred, as
+// given by lfs.transfer.order: "size-asc" for the smallest first, "size-desc"
+// for the largest first, or "fifo", the default, for the order they are queued
+// in, including if the value is invalid.
+func (c *Configuration) TransferOrder() string {
+	if v, ok := c.Git.Get("lfs.transfer.order"); ok {
+		switch v = strings.ToLower(v); v {
+		case "size-asc", "size-desc", "fifo":
+			return v
+		}
+	}
+	return "fifo"
+}
+
+// TransferLogPath returns the file to which a line is appended for each object
+// which finishes transferring, fails or is retried, as given by the
+// GIT_LFS_TRANSFER_LOG environment variable, or lfs.transfer.log, or "" if
+// neither is set.
+func (c *Configuration) TransferLogPath() string {
+	if v, ok := c.Os.Get("GIT_LFS_TRANSFER_LOG"); ok && len(v) > 0 {
+		return v
+	}
+	v, _ := c.Git.Get("lfs.transfer.log")
+	return v
+}
+
+// TransferRetriableStatuses returns the HTTP status codes after which
+// transfers are retried, as given by lfs.transfer.retriablestatuses, a comma
+// separated list such as "429,500,502,503,504", which replaces the built-in
+// classification of statuses. It returns nil if the option isn't set, along
+// with any entries which aren't status codes, which are ignored.
+func (c *Configuration) TransferRetriableStatuses() (codes []int, invalid []string) {
+	v, ok := c.Git.Get("lfs.transfer.retriablestatuses")
+	if !ok {
+		return nil, nil
+	}
+
+	codes = make([]int, 0)
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		code, err := strconv.Atoi(entry)
+		if err != nil || code < 100 || code > 599 {
+			invalid = append(invalid, entry)
+			continue
+		}
+		codes = append(codes, code)
+	}
+	return codes, invalid
+}
+
+// TransferStateFile returns the file in which fetches record the objects they
+// have downloaded, so that an interrupted fetch can be resumed, as given by
+// lfs.transfer.statefile, or "" if it isn't set.
+func (c *Configuration) TransferStateFile() string {
+	v, _ := c.Git.Get("lfs.transfer.statefile")
+	return v
+}
+
 func (c *Configuration) BatchTransfer() bool {
 	return c.Git.Bool("lfs.batch", true)
 }
 
+// BatchFlushInterval returns how long a partially filled batch of objects
+// waits for more to be added before it is sent to the batch API anyway, as
+// given by lfs.batchflushinterval in a form accepted by time.ParseDuration.
+// Zero means partial batches wait until there are no more objects to add.
+// Default is 250ms, including if the value is invalid.
+func (c *Configuration) BatchFlushInterval() time.Duration {
+	if v, ok := c.Git.Get("lfs.batchflushinterval"); ok {
+		d, err := time.ParseDuration(v)
+		if err == nil && d >= 0 {
+			return d
+		}
+	}
+	return 250 * time.Millisecond
+}
+
 func (c *Configuration) NtlmAccess(operation string) bool {
 	return c.Access(operation) == "ntlm"
 }
@@ -372,6 +693,26 @@ func (c *Configuration) FetchExcludePaths() []string {
 	return tools.CleanPaths(patterns, ",")
 }
 
+// AttributesExcludePaths returns the directories, from lfs.attributesexclude,
+// which are not searched for .gitattributes files when listing the patterns
+// tracked by Git LFS.
+func (c *Configuration) AttributesExcludePaths() []string {
+	paths, _ := c.Git.Get("lfs.attributesexclude")
+	return tools.CleanPaths(paths, ",")
+}
+
+// FetchMaxSize returns the size in bytes of the largest object that will be
+// fetched, as given by lfs.fetchmaxsize. Zero, the default, means no limit.
+func (c *Configuration) FetchMaxSize() int64 {
+	if v, ok := c.Git.Get("lfs.fetchmaxsize"); ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
 func (c *Configuration) RemoteEndpoint(remote, operation string) Endpoint {
 	if len(remote) == 0 {
 		remote = defaultRemote
@@ -485,10 +826,68 @@ func (c *Configuration) FetchPruneConfig() FetchPruneConfig {
 	return *f
 }
 
+// FetchRecentCommitsDaysFor returns the number of days before the latest
+// commit on the branch "name" within which `git lfs fetch --recent` fetches
+// previous versions of objects, and `git lfs prune` keeps them. It is given by
+// lfs.fetchrecent.<pattern>.days for the longest <pattern> which matches
+// "name", such as "release/*", or by lfs.fetchrecentcommitsdays if none do.
+// Patterns are matched as by path.Match, and, like the rest of the key,
+// regardless of case.
+func (c *Configuration) FetchRecentCommitsDaysFor(name string) int {
+	days := c.FetchPruneConfig().FetchRecentCommitsDays
+
+	prefix := "lfs.fetchrecent."
+	suffix := ".days"
+	name = strings.ToLower(name)
+	var longest string
+	for gitkey, gitval := range c.AllGitConfig() {
+		if len(gitkey) <= len(prefix)+len(suffix) || !strings.HasPrefix(gitkey, prefix) || !strings.HasSuffix(gitkey, suffix) {
+			continue
+		}
+
+		pattern := gitkey[len(prefix) : len(gitkey)-len(suffix)]
+		if len(pattern) < len(longest) || (len(pattern) == len(longest) && pattern > longest) {
+			continue
+		}
+		if matched, _ := path.Match(pattern, name); !matched {
+			continue
+		}
+		if n, err := strconv.Atoi(gitval); err == nil && n >= 0 {
+			longest, days = pattern, n
+		}
+	}
+
+	return days
+}
+
 func (c *Configuration) SkipDownloadErrors() bool {
 	return c.Os.Bool("GIT_LFS_SKIP_DOWNLOAD_ERRORS", false) || c.Git.Bool("lfs.skipdownloaderrors", false)
 }
 
+// SmudgeOnError returns what the smudge filter writes for a file whose object
+// can't be downloaded, as given by lfs.smudge.onerror: "error" to fail, the
+// default, or "pointer" or "placeholder" to write the pointer or a short note
+// naming the object and carry on. It's "pointer" if the value is unset or
+// invalid and download errors are skipped (see SkipDownloadErrors).
+func (c *Configuration) SmudgeOnError() string {
+	if v, ok := c.Git.Get("lfs.smudge.onerror"); ok {
+		switch v = strings.ToLower(v); v {
+		case "error", "pointer", "placeholder":
+			return v
+		}
+	}
+	if c.SkipDownloadErrors() {
+		return "pointer"
+	}
+	return "error"
+}
+
+// HardLinkCheckout returns whether checkout should hard link working tree
+// files to the local object store instead of copying them. Default is false.
+func (c *Configuration) HardLinkCheckout() bool {
+	return c.Git.Bool("lfs.hardlinkcheckout", false)
+}
+
 // loadGitConfig is a temporary measure to support legacy behavior dependent on
 // accessing properties set by ReadGitConfig, namely:
 //  - `c.extensions`
@@ -318,6 +318,102 @@ func TestConcurrentTransfersNegativeValue(t *testing.T) {
 	assert.Equal(t, 3, n)
 }
 
+func TestDirectionalConcurrentTransfers(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.concurrenttransfers":          "5",
+			"lfs.transfer.concurrentdownloads": "8",
+			"lfs.transfer.concurrentuploads":   "2",
+		},
+	})
+
+	assert.Equal(t, 8, cfg.DirectionalConcurrentTransfers("download"))
+	assert.Equal(t, 2, cfg.DirectionalConcurrentTransfers("upload"))
+}
+
+func TestDirectionalConcurrentTransfersDefault(t *testing.T) {
+	for _, v := range []string{"", "0", "-1", "elephant"} {
+		cfg := NewFrom(Values{
+			Git: map[string]string{
+				"lfs.concurrenttransfers":          "5",
+				"lfs.transfer.concurrentdownloads": v,
+			},
+		})
+
+		assert.Equal(t, 5, cfg.DirectionalConcurrentTransfers("download"), v)
+		assert.Equal(t, 5, cfg.DirectionalConcurrentTransfers("upload"), v)
+	}
+}
+
+func TestConcurrentCheckoutsSetValue(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.concurrentcheckouts": "8",
+		},
+	})
+
+	assert.Equal(t, 8, cfg.ConcurrentCheckouts())
+}
+
+func TestConcurrentCheckoutsDefaultsToConcurrentTransfers(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.concurrenttransfers": "5",
+			"lfs.concurrentcheckouts": "0",
+		},
+	})
+
+	assert.Equal(t, 5, cfg.ConcurrentCheckouts())
+}
+
+func TestTransferHTTP2ConcurrencySetValue(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.transfer.http2concurrency": "16",
+		},
+	})
+
+	assert.Equal(t, 16, cfg.TransferHTTP2Concurrency())
+}
+
+func TestTransferHTTP2ConcurrencyDefaultsToConcurrentTransfers(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.concurrenttransfers":       "5",
+			"lfs.transfer.http2concurrency": "elephant",
+		},
+	})
+
+	assert.Equal(t, 5, cfg.TransferHTTP2Concurrency())
+}
+
+func TestTransferAPIConcurrencySetValue(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.concurrenttransfers":     "5",
+			"lfs.transfer.apiconcurrency": "10",
+		},
+	})
+
+	assert.Equal(t, 10, cfg.TransferAPIConcurrency())
+	assert.Equal(t, 5, cfg.ConcurrentTransfers())
+}
+
+func TestTransferAPIConcurrencyDefaultsToConcurrentTransfers(t *testing.T) {
+	for _, v := range []string{"", "0", "-5", "elephant"} {
+		cfg := NewFrom(Values{
+			Git: map[string]string{
+				"lfs.concurrenttransfers":     "5",
+				"lfs.transfer.apiconcurrency": v,
+			},
+		})
+
+		assert.Equal(t, 5, cfg.TransferAPIConcurrency(), v)
+	}
+
+	assert.Equal(t, 3, NewFrom(Values{}).TransferAPIConcurrency())
+}
+
 func TestBasicTransfersOnlySetValue(t *testing.T) {
 	cfg := NewFrom(Values{
 		Git: map[string]string{
@@ -376,6 +472,50 @@ func TestTusTransfersAllowedInvalidValue(t *testing.T) {
 	assert.Equal(t, false, b)
 }
 
+func TestTransferVerifyUploads(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.transfer.verifyupload": "true",
+		},
+	})
+	assert.Equal(t, true, cfg.TransferVerifyUploads())
+
+	for _, v := range []string{"", "false", "wat"} {
+		cfg = NewFrom(Values{
+			Git: map[string]string{
+				"lfs.transfer.verifyupload": v,
+			},
+		})
+		assert.Equal(t, false, cfg.TransferVerifyUploads(), v)
+	}
+}
+
+func TestProgressQuietSetValue(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.quiet": "true",
+		},
+	})
+
+	assert.Equal(t, true, cfg.ProgressQuiet())
+}
+
+func TestProgressQuietDefault(t *testing.T) {
+	cfg := NewFrom(Values{})
+
+	assert.Equal(t, false, cfg.ProgressQuiet())
+}
+
+func TestProgressQuietInvalidValue(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.quiet": "wat",
+		},
+	})
+
+	assert.Equal(t, false, cfg.ProgressQuiet())
+}
+
 func TestBatch(t *testing.T) {
 	tests := map[string]bool{
 		"":         true,
@@ -405,6 +545,25 @@ func TestBatchAbsentIsTrue(t *testing.T) {
 	assert.True(t, v)
 }
 
+func TestBatchFlushInterval(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{"lfs.batchflushinterval": "1s"},
+	})
+	assert.Equal(t, time.Second, cfg.BatchFlushInterval())
+
+	cfg = NewFrom(Values{
+		Git: map[string]string{"lfs.batchflushinterval": "0"},
+	})
+	assert.Equal(t, time.Duration(0), cfg.BatchFlushInterval())
+
+	for _, v := range []string{"", "-1s", "250"} {
+		cfg = NewFrom(Values{
+			Git: map[string]string{"lfs.batchflushinterval": v},
+		})
+		assert.Equal(t, 250*time.Millisecond, cfg.BatchFlushInterval(), v)
+	}
+}
+
 func TestAccessConfig(t *testing.T) {
 	type accessTest struct {
 		Access        string
@@ -547,6 +706,29 @@ func TestFetchPruneConfigCustom(t *testing.T) {
 	assert.True(t, fp.PruneVerifyRemoteAlways)
 }
 
+func TestFetchRecentCommitsDaysFor(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.fetchrecentcommitsdays":        "3",
+			"lfs.fetchrecent.release/*.days":    "30",
+			"lfs.fetchrecent.release/1.x.days":  "90",
+			"lfs.fetchrecent.*.days":            "5",
+			"lfs.fetchrecent.hotfix/*.days":     "not a number",
+			"lfs.fetchrecent.experimental.days": "0",
+		},
+	})
+
+	assert.Equal(t, 30, cfg.FetchRecentCommitsDaysFor("release/2.0"))
+	assert.Equal(t, 30, cfg.FetchRecentCommitsDaysFor("Release/2.0"))
+	assert.Equal(t, 90, cfg.FetchRecentCommitsDaysFor("release/1.x"))
+	assert.Equal(t, 5, cfg.FetchRecentCommitsDaysFor("master"))
+	assert.Equal(t, 0, cfg.FetchRecentCommitsDaysFor("experimental"))
+	assert.Equal(t, 3, cfg.FetchRecentCommitsDaysFor("hotfix/bug"))
+	assert.Equal(t, 3, cfg.FetchRecentCommitsDaysFor("topic/a/b"))
+
+	assert.Equal(t, 0, NewFrom(Values{}).FetchRecentCommitsDaysFor("master"))
+}
+
 func TestFetchIncludeExcludesAreCleaned(t *testing.T) {
 	cfg := NewFrom(Values{
 		Git: map[string]string{
@@ -559,6 +741,262 @@ func TestFetchIncludeExcludesAreCleaned(t *testing.T) {
 	assert.Equal(t, []string{"/other/path/to/clean"}, cfg.FetchExcludePaths())
 }
 
+func TestAttributesExcludePathsAreCleaned(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.attributesexclude": "node_modules/, build/output/",
+		},
+	})
+
+	assert.Equal(t, []string{"node_modules", "build/output"}, cfg.AttributesExcludePaths())
+	assert.Empty(t, NewFrom(Values{}).AttributesExcludePaths())
+}
+
+func TestFetchMaxSize(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{"lfs.fetchmaxsize": "1024"},
+	})
+	assert.Equal(t, int64(1024), cfg.FetchMaxSize())
+}
+
+func TestTransferMaxBandwidth(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{"lfs.transfer.maxbandwidth": "1048576"},
+	})
+	assert.Equal(t, int64(1048576), cfg.TransferMaxBandwidth())
+
+	cfg = NewFrom(Values{Git: map[string]string{}})
+	assert.Equal(t, int64(0), cfg.TransferMaxBandwidth())
+}
+
+func TestTransferMaxFailures(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{"lfs.transfer.maxfailures": "50"},
+	})
+	assert.Equal(t, 50, cfg.TransferMaxFailures())
+
+	for _, v := range []string{"", "0", "-1", "abc"} {
+		cfg = NewFrom(Values{
+			Git: map[string]string{"lfs.transfer.maxfailures": v},
+		})
+		assert.Equal(t, 0, cfg.TransferMaxFailures(), v)
+	}
+}
+
+func TestTransferMaxPending(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{"lfs.transfer.maxpending": "1000"},
+	})
+	assert.Equal(t, 1000, cfg.TransferMaxPending())
+
+	for _, v := range []string{"", "0", "-1", "abc"} {
+		cfg = NewFrom(Values{
+			Git: map[string]string{"lfs.transfer.maxpending": v},
+		})
+		assert.Equal(t, 0, cfg.TransferMaxPending(), v)
+	}
+}
+
+func TestTransferMaxRetries(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.transfer.maxretries":        "5",
+			"lfs.transfer.maxnetworkretries": "0",
+		},
+	})
+	assert.Equal(t, 5, cfg.TransferMaxRetries())
+	assert.Equal(t, 0, cfg.TransferMaxNetworkRetries())
+
+	for _, v := range []string{"", "-1", "abc"} {
+		cfg = NewFrom(Values{
+			Git: map[string]string{
+				"lfs.transfer.maxretries":        v,
+				"lfs.transfer.maxnetworkretries": v,
+			},
+		})
+		assert.Equal(t, 2, cfg.TransferMaxRetries(), v)
+		assert.Equal(t, 3, cfg.TransferMaxNetworkRetries(), v)
+	}
+}
+
+func TestTransferRetryAllErrors(t *testing.T) {
+	assert.False(t, NewFrom(Values{}).TransferRetryAllErrors())
+
+	cfg := NewFrom(Values{
+		Git: map[string]string{"lfs.transfer.retryallerrors": "true"},
+	})
+	assert.True(t, cfg.TransferRetryAllErrors())
+}
+
+func TestDeltaTransfersAllowed(t *testing.T) {
+	assert.False(t, NewFrom(Values{}).DeltaTransfersAllowed())
+
+	cfg := NewFrom(Values{
+		Git: map[string]string{"lfs.deltatransfers": "true"},
+	})
+	assert.True(t, cfg.DeltaTransfersAllowed())
+}
+
+func TestDeltaTransferMaxRatio(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{"lfs.transfer.deltamaxratio": "0.25"},
+	})
+	assert.Equal(t, 0.25, cfg.DeltaTransferMaxRatio())
+
+	for _, v := range []string{"", "0", "-0.5", "1.5", "half"} {
+		cfg = NewFrom(Values{
+			Git: map[string]string{"lfs.transfer.deltamaxratio": v},
+		})
+		assert.Equal(t, 0.5, cfg.DeltaTransferMaxRatio(), v)
+	}
+}
+
+func TestTransferCompression(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{"lfs.transfer.compression": "gzip"},
+	})
+	assert.Equal(t, "gzip", cfg.TransferCompression())
+
+	for _, v := range []string{"", "none", "zip"} {
+		cfg = NewFrom(Values{
+			Git: map[string]string{"lfs.transfer.compression": v},
+		})
+		assert.Equal(t, "", cfg.TransferCompression(), v)
+	}
+}
+
+func TestTransferOrder(t *testing.T) {
+	for v, expected := range map[string]string{
+		"size-asc":  "size-asc",
+		"Size-Desc": "size-desc",
+		"fifo":      "fifo",
+		"":          "fifo",
+		"size":      "fifo",
+	} {
+		cfg := NewFrom(Values{
+			Git: map[string]string{"lfs.transfer.order": v},
+		})
+		assert.Equal(t, expected, cfg.TransferOrder(), v)
+	}
+
+	assert.Equal(t, "fifo", NewFrom(Values{}).TransferOrder())
+}
+
+func TestTransferRetriableStatuses(t *testing.T) {
+	codes, invalid := NewFrom(Values{}).TransferRetriableStatuses()
+	assert.Nil(t, codes)
+	assert.Nil(t, invalid)
+
+	cfg := NewFrom(Values{
+		Git: map[string]string{"lfs.transfer.retriablestatuses": "429, 500,,503,5xx,404 ,42,600"},
+	})
+	codes, invalid = cfg.TransferRetriableStatuses()
+	assert.Equal(t, []int{429, 500, 503, 404}, codes)
+	assert.Equal(t, []string{"5xx", "42", "600"}, invalid)
+
+	cfg = NewFrom(Values{
+		Git: map[string]string{"lfs.transfer.retriablestatuses": ""},
+	})
+	codes, invalid = cfg.TransferRetriableStatuses()
+	assert.Equal(t, []int{}, codes)
+	assert.Nil(t, invalid)
+}
+
+func TestTransferStateFile(t *testing.T) {
+	assert.Equal(t, "", NewFrom(Values{}).TransferStateFile())
+
+	cfg := NewFrom(Values{
+		Git: map[string]string{"lfs.transfer.statefile": "lfs/fetch-state"},
+	})
+	assert.Equal(t, "lfs/fetch-state", cfg.TransferStateFile())
+}
+
+func TestSmudgeOnError(t *testing.T) {
+	for v, expected := range map[string]string{
+		"error":       "error",
+		"Pointer":     "pointer",
+		"placeholder": "placeholder",
+		"stub":        "error",
+	} {
+		cfg := NewFrom(Values{
+			Git: map[string]string{"lfs.smudge.onerror": v},
+		})
+		assert.Equal(t, expected, cfg.SmudgeOnError(), v)
+	}
+
+	assert.Equal(t, "error", NewFrom(Values{}).SmudgeOnError())
+
+	cfg := NewFrom(Values{
+		Git: map[string]string{"lfs.skipdownloaderrors": "true"},
+	})
+	assert.Equal(t, "pointer", cfg.SmudgeOnError())
+
+	cfg = NewFrom(Values{
+		Git: map[string]string{
+			"lfs.skipdownloaderrors": "true",
+			"lfs.smudge.onerror":     "placeholder",
+		},
+	})
+	assert.Equal(t, "placeholder", cfg.SmudgeOnError())
+}
+
+func TestTransferLogPath(t *testing.T) {
+	assert.Equal(t, "", NewFrom(Values{}).TransferLogPath())
+
+	cfg := NewFrom(Values{
+		Git: map[string]string{"lfs.transfer.log": "/tmp/git.log"},
+	})
+	assert.Equal(t, "/tmp/git.log", cfg.TransferLogPath())
+
+	cfg = NewFrom(Values{
+		Os:  map[string]string{"GIT_LFS_TRANSFER_LOG": "/tmp/env.log"},
+		Git: map[string]string{"lfs.transfer.log": "/tmp/git.log"},
+	})
+	assert.Equal(t, "/tmp/env.log", cfg.TransferLogPath())
+}
+
+func TestTransferTimeout(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{"lfs.transfer.timeout": "30m"},
+	})
+	assert.Equal(t, 30*time.Minute, cfg.TransferTimeout())
+
+	for _, v := range []string{"", "0", "-5s", "30"} {
+		cfg = NewFrom(Values{
+			Git: map[string]string{"lfs.transfer.timeout": v},
+		})
+		assert.Equal(t, time.Duration(0), cfg.TransferTimeout(), v)
+	}
+}
+
+func TestTransferExpiryMargin(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{"lfs.transfer.expirymargin": "2m"},
+	})
+	assert.Equal(t, 2*time.Minute, cfg.TransferExpiryMargin())
+
+	cfg = NewFrom(Values{
+		Git: map[string]string{"lfs.transfer.expirymargin": "0"},
+	})
+	assert.Equal(t, time.Duration(0), cfg.TransferExpiryMargin())
+
+	for _, v := range []string{"", "-5s", "30"} {
+		cfg = NewFrom(Values{
+			Git: map[string]string{"lfs.transfer.expirymargin": v},
+		})
+		assert.Equal(t, 5*time.Second, cfg.TransferExpiryMargin(), v)
+	}
+}
+
+func TestFetchMaxSizeDefaultsToUnlimited(t *testing.T) {
+	for _, v := range []string{"", "-1", "abc"} {
+		cfg := NewFrom(Values{
+			Git: map[string]string{"lfs.fetchmaxsize": v},
+		})
+		assert.Equal(t, int64(0), cfg.FetchMaxSize(), v)
+	}
+}
+
 func TestUnmarshalMultipleTypes(t *testing.T) {
 	cfg := NewFrom(Values{
 		Git: map[string]string{
@@ -149,3 +149,55 @@ func endpointFromGitUrl(u *url.URL, c *Configuration) Endpoint {
 	u.Scheme = c.GitProtocol()
 	return Endpoint{Url: u.String()}
 }
+
+// redactedQueryParams are the query parameters which hold credentials in
+// endpoint URLs, and so are redacted by RedactURL. They are matched regardless
+// of case.
+var redactedQueryParams = map[string]bool{
+	"access_token":         true,
+	"auth":                 true,
+	"password":             true,
+	"private_token":        true,
+	"sig":                  true,
+	"signature":            true,
+	"token":                true,
+	"x-amz-credential":     true,
+	"x-amz-security-token": true,
+	"x-amz-signature":      true,
+}
+
+// redactedValue replaces the credentials removed by RedactURL.
+const redactedValue = "REDACTED"
+
+// RedactURL returns "rawurl" with any user info, and the values of query
+// parameters which are known to hold tokens, replaced by "REDACTED", so that
+// it can be shown without giving away credentials. The order of the query
+// parameters is kept. Strings which aren't URLs are returned unchanged.
+func RedactURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || len(u.Scheme) == 0 {
+		return rawurl
+	}
+
+	if u.User != nil {
+		u.User = url.User(redactedValue)
+	}
+
+	if len(u.RawQuery) > 0 {
+		params := strings.Split(u.RawQuery, "&")
+		for i, param := range params {
+			parts := strings.SplitN(param, "=", 2)
+			name, err := url.QueryUnescape(parts[0])
+			if err != nil {
+				name = parts[0]
+			}
+
+			if len(parts) == 2 && redactedQueryParams[strings.ToLower(name)] {
+				params[i] = parts[0] + "=" + redactedValue
+			}
+		}
+		u.RawQuery = strings.Join(params, "&")
+	}
+
+	return u.String()
+}
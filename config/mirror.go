@@ -0,0 +1,103 @@
+package config
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MirrorDownload, MirrorUpload and MirrorBoth are the roles a mirror
+	// can have, given by lfs.mirror.<name>.role: which operations it is
+	// asked for.
+	MirrorDownload = "download"
+	MirrorUpload   = "upload"
+	MirrorBoth     = "both"
+
+	// EndpointPriority is the priority of the configured LFS endpoint
+	// among the mirrors. Mirrors with a lower priority are asked before
+	// it, and the rest after it.
+	EndpointPriority = 0
+	// defaultMirrorPriority makes mirrors fall back from the configured
+	// endpoint unless they're given a priority.
+	defaultMirrorPriority = 1
+)
+
+// A Mirror is another LFS server which holds the same objects as the configured
+// endpoint, and which batch API requests fail over to, or from. Mirrors are
+// given by lfs.mirror.<name>.url, .role and .priority.
+type Mirror struct {
+	Name     string
+	Endpoint Endpoint
+	Role     string
+	Priority int
+}
+
+// Serves returns whether the mirror is asked for the given operation,
+// "download" or "upload".
+func (m Mirror) Serves(operation string) bool {
+	return m.Role == MirrorBoth || m.Role == operation
+}
+
+// Mirrors returns the mirrors which serve the given operation, lowest priority
+// first, with ties in order of name. Mirrors without a URL, or with a role
+// other than "download", "upload" or "both", are left out.
+func (c *Configuration) Mirrors(operation string) []Mirror {
+	prefix := "lfs.mirror."
+	byName := make(map[string]*Mirror)
+	for gitkey, gitval := range c.AllGitConfig() {
+		if !strings.HasPrefix(gitkey, prefix) {
+			continue
+		}
+
+		i := strings.LastIndex(gitkey, ".")
+		if i <= len(prefix) {
+			continue
+		}
+		name, prop := gitkey[len(prefix):i], gitkey[i+1:]
+
+		m, ok := byName[name]
+		if !ok {
+			m = &Mirror{Name: name, Role: MirrorBoth, Priority: defaultMirrorPriority}
+			byName[name] = m
+		}
+
+		switch prop {
+		case "url":
+			m.Endpoint = NewEndpointWithConfig(gitval, c)
+		case "role":
+			m.Role = strings.ToLower(gitval)
+		case "priority":
+			if p, err := strconv.Atoi(gitval); err == nil {
+				m.Priority = p
+			}
+		}
+	}
+
+	mirrors := make([]Mirror, 0, len(byName))
+	for _, m := range byName {
+		switch m.Role {
+		case MirrorDownload, MirrorUpload, MirrorBoth:
+		default:
+			continue
+		}
+		if len(m.Endpoint.Url) == 0 || !m.Serves(operation) {
+			continue
+		}
+		mirrors = append(mirrors, *m)
+	}
+
+	sort.Sort(mirrorsByPriority(mirrors))
+	return mirrors
+}
+
+type mirrorsByPriority []Mirror
+
+func (m mirrorsByPriority) Len() int      { return len(m) }
+func (m mirrorsByPriority) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m mirrorsByPriority) Less(i, j int) bool {
+	if m[i].Priority != m[j].Priority {
+		return m[i].Priority < m[j].Priority
+	}
+	return m[i].Name < m[j].Name
+}
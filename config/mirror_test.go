@@ -0,0 +1,68 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorsSortedByPriorityThenName(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.mirror.cdn.url":         "https://cdn.example.com/repo",
+			"lfs.mirror.cdn.role":        "Download",
+			"lfs.mirror.cdn.priority":    "-1",
+			"lfs.mirror.west.url":        "https://west.example.com/repo",
+			"lfs.mirror.east.url":        "https://east.example.com/repo",
+			"lfs.mirror.backup.url":      "https://backup.example.com/repo",
+			"lfs.mirror.backup.role":     "upload",
+			"lfs.mirror.backup.priority": "5",
+		},
+	})
+
+	var names []string
+	for _, m := range cfg.Mirrors("download") {
+		names = append(names, m.Name)
+	}
+	assert.Equal(t, []string{"cdn", "east", "west"}, names)
+
+	names = nil
+	for _, m := range cfg.Mirrors("upload") {
+		names = append(names, m.Name)
+	}
+	assert.Equal(t, []string{"east", "west", "backup"}, names)
+}
+
+func TestMirrorDefaults(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.mirror.eu.url": "https://eu.example.com/repo",
+		},
+	})
+
+	mirrors := cfg.Mirrors("upload")
+	if assert.Len(t, mirrors, 1) {
+		assert.Equal(t, "eu", mirrors[0].Name)
+		assert.Equal(t, "https://eu.example.com/repo", mirrors[0].Endpoint.Url)
+		assert.Equal(t, MirrorBoth, mirrors[0].Role)
+		assert.Equal(t, 1, mirrors[0].Priority)
+	}
+}
+
+func TestMirrorsSkipInvalidEntries(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.mirror.nourl.role":       "download",
+			"lfs.mirror.badrole.url":      "https://bad.example.com/repo",
+			"lfs.mirror.badrole.role":     "sideways",
+			"lfs.mirror.badprio.url":      "https://prio.example.com/repo",
+			"lfs.mirror.badprio.priority": "high",
+		},
+	})
+
+	mirrors := cfg.Mirrors("download")
+	if assert.Len(t, mirrors, 1) {
+		assert.Equal(t, "badprio", mirrors[0].Name)
+		assert.Equal(t, 1, mirrors[0].Priority)
+	}
+}
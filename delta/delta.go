@@ -0,0 +1,337 @@
+// Package delta computes and applies binary patches between two versions of a
+// file, so that an object which changed slightly can be uploaded as a patch
+// against an older object the server already has.
+//
+// Patches are computed with the rsync algorithm: the base is split into
+// blocks, which are indexed by a weak rolling checksum and a strong hash. The
+// target is then scanned a byte at a time for blocks which appear in the base,
+// so matches are found wherever they are in the target, not only at block
+// boundaries.
+//
+// NOTE: Subject to change, do not rely on this package from outside git-lfs source
+package delta
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/github/git-lfs/errors"
+)
+
+// Magic starts every patch written by Diff.
+const Magic = "git-lfs-delta-1\n"
+
+// Operations in a patch. Each is a single byte followed by its arguments.
+const (
+	// opCopy copies bytes from the base. Arguments: uvarint offset,
+	// uvarint length.
+	opCopy = 'c'
+	// opData inserts literal bytes. Arguments: uvarint length, followed by
+	// that many bytes.
+	opData = 'd'
+	// opEnd ends the patch. Arguments: uvarint size of the target.
+	opEnd = 'e'
+)
+
+const (
+	minBlockSize = 64
+	maxBlockSize = 64 * 1024
+	// maxDataSize limits the literal bytes held in memory before they are
+	// written out as an opData.
+	maxDataSize = 1024 * 1024
+)
+
+// Diff writes a patch to "patch" which turns the "baseSize" bytes read from
+// "base" into the contents of "target". It returns the size of the patch.
+func Diff(base io.ReaderAt, baseSize int64, target io.Reader, patch io.Writer) (int64, error) {
+	blockSize := blockSizeFor(baseSize)
+	idx, err := indexBlocks(base, baseSize, blockSize)
+	if err != nil {
+		return 0, errors.Wrap(err, "delta: index base")
+	}
+
+	w := &patchWriter{w: bufio.NewWriter(patch)}
+	w.writeString(Magic)
+
+	r := bufio.NewReaderSize(target, 2*blockSize)
+	var size int64
+	var win []byte // the bytes currently being matched against the base
+	var weak rollingChecksum
+	var data []byte // literal bytes waiting to be written
+
+	fill := func() error {
+		for len(win) < blockSize {
+			c, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			size++
+			win = append(win, c)
+		}
+		weak = newRollingChecksum(win)
+		return nil
+	}
+
+	err = fill()
+	for err == nil {
+		if off, ok := idx.find(weak.sum(), win); ok {
+			w.data(data)
+			data = data[:0]
+			w.copy(off, int64(len(win)))
+			win = win[:0]
+			err = fill()
+			continue
+		}
+
+		c, rerr := r.ReadByte()
+		if rerr != nil {
+			err = rerr
+			break
+		}
+		size++
+
+		out := win[0]
+		data = append(data, out)
+		if len(data) >= maxDataSize {
+			w.data(data)
+			data = data[:0]
+		}
+		// Slide the window along by one byte, moving it back to the start
+		// of a new buffer whenever it reaches the end of the current one.
+		if cap(win) == len(win) {
+			win = append(make([]byte, 0, 2*blockSize), win...)
+		}
+		win = append(win[1:], c)
+		weak.roll(out, c, len(win))
+	}
+	if err != io.EOF {
+		return 0, errors.Wrap(err, "delta: read target")
+	}
+
+	data = append(data, win...)
+	w.data(data)
+	w.end(size)
+	if err := w.flush(); err != nil {
+		return 0, errors.Wrap(err, "delta: write patch")
+	}
+	return w.n, nil
+}
+
+// Apply reads a patch written by Diff from "patch", and writes the result of
+// applying it to "base" to "target".
+func Apply(base io.ReaderAt, patch io.Reader, target io.Writer) error {
+	r := bufio.NewReader(patch)
+
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != Magic {
+		return errors.New("delta: not a git-lfs patch")
+	}
+
+	var written int64
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return errors.New("delta: patch is truncated")
+		}
+
+		switch op {
+		case opCopy:
+			off, err1 := binary.ReadUvarint(r)
+			n, err2 := binary.ReadUvarint(r)
+			if err1 != nil || err2 != nil {
+				return errors.New("delta: patch is truncated")
+			}
+			if _, err := io.Copy(target, io.NewSectionReader(base, int64(off), int64(n))); err != nil {
+				return errors.Wrap(err, "delta: copy from base")
+			}
+			written += int64(n)
+		case opData:
+			n, err := binary.ReadUvarint(r)
+			if err != nil {
+				return errors.New("delta: patch is truncated")
+			}
+			copied, err := io.CopyN(target, r, int64(n))
+			written += copied
+			if err != nil {
+				return errors.Wrap(err, "delta: copy from patch")
+			}
+		case opEnd:
+			size, err := binary.ReadUvarint(r)
+			if err != nil {
+				return errors.New("delta: patch is truncated")
+			}
+			if int64(size) != written {
+				return errors.Errorf("delta: expected %d bytes from patch, wrote %d", size, written)
+			}
+			return nil
+		default:
+			return errors.Errorf("delta: unknown patch operation %q", op)
+		}
+	}
+}
+
+// blockSizeFor returns the block size to index a base of the given size with.
+// As with rsync, this is around the square root of the size, which balances
+// the size of the index against the bytes sent for blocks which don't match.
+func blockSizeFor(size int64) int {
+	n := int(math.Sqrt(float64(size)))
+	if n < minBlockSize {
+		return minBlockSize
+	}
+	if n > maxBlockSize {
+		return maxBlockSize
+	}
+	return n
+}
+
+type block struct {
+	offset int64
+	strong [sha256.Size]byte
+}
+
+type blockIndex struct {
+	blockSize int
+	blocks    map[uint32][]block
+}
+
+func indexBlocks(base io.ReaderAt, size int64, blockSize int) (*blockIndex, error) {
+	idx := &blockIndex{
+		blockSize: blockSize,
+		blocks:    make(map[uint32][]block, size/int64(blockSize)),
+	}
+
+	r := bufio.NewReaderSize(io.NewSectionReader(base, 0, size), 64*1024)
+	buf := make([]byte, blockSize)
+	for off := int64(0); off+int64(blockSize) <= size; off += int64(blockSize) {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+
+		weak := newRollingChecksum(buf).sum()
+		idx.blocks[weak] = append(idx.blocks[weak], block{
+			offset: off,
+			strong: sha256.Sum256(buf),
+		})
+	}
+	return idx, nil
+}
+
+// find returns the offset of a block in the base with the contents "win",
+// which has the weak checksum "weak".
+func (idx *blockIndex) find(weak uint32, win []byte) (int64, bool) {
+	candidates := idx.blocks[weak]
+	if len(candidates) == 0 || len(win) != idx.blockSize {
+		return 0, false
+	}
+
+	strong := sha256.Sum256(win)
+	for _, b := range candidates {
+		if b.strong == strong {
+			return b.offset, true
+		}
+	}
+	return 0, false
+}
+
+// rollingChecksum is the weak checksum from rsync, which can be updated in
+// constant time as the window it covers moves along by one byte.
+type rollingChecksum struct {
+	a, b uint32
+}
+
+func newRollingChecksum(p []byte) rollingChecksum {
+	var c rollingChecksum
+	for i, x := range p {
+		c.a += uint32(x)
+		c.b += uint32(len(p)-i) * uint32(x)
+	}
+	return c
+}
+
+// roll removes "out" from the start of a window of length "n", and adds "in"
+// to the end of it.
+func (c *rollingChecksum) roll(out, in byte, n int) {
+	c.a += uint32(in) - uint32(out)
+	c.b += c.a - uint32(n)*uint32(out)
+}
+
+func (c rollingChecksum) sum() uint32 {
+	return c.a&0xffff | c.b<<16
+}
+
+// patchWriter writes patch operations, merging adjacent copies, and keeps
+// the first error it encounters.
+type patchWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+
+	copyOff, copyLen int64 // a copy which hasn't been written yet
+}
+
+func (w *patchWriter) copy(off, n int64) {
+	if w.copyLen > 0 && w.copyOff+w.copyLen == off {
+		w.copyLen += n
+		return
+	}
+	w.flushCopy()
+	w.copyOff, w.copyLen = off, n
+}
+
+func (w *patchWriter) data(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	w.flushCopy()
+	w.writeByte(opData)
+	w.writeUvarint(uint64(len(p)))
+	w.write(p)
+}
+
+func (w *patchWriter) end(size int64) {
+	w.flushCopy()
+	w.writeByte(opEnd)
+	w.writeUvarint(uint64(size))
+}
+
+func (w *patchWriter) flushCopy() {
+	if w.copyLen == 0 {
+		return
+	}
+	w.writeByte(opCopy)
+	w.writeUvarint(uint64(w.copyOff))
+	w.writeUvarint(uint64(w.copyLen))
+	w.copyLen = 0
+}
+
+func (w *patchWriter) writeByte(c byte) {
+	w.write([]byte{c})
+}
+
+func (w *patchWriter) writeUvarint(x uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	w.write(buf[:binary.PutUvarint(buf, x)])
+}
+
+func (w *patchWriter) writeString(s string) {
+	w.write([]byte(s))
+}
+
+func (w *patchWriter) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *patchWriter) flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
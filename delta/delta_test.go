@@ -0,0 +1,84 @@
+package delta
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func randomBytes(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func diffAndApply(t *testing.T, base, target []byte) int64 {
+	var patch bytes.Buffer
+	n, err := Diff(bytes.NewReader(base), int64(len(base)), bytes.NewReader(target), &patch)
+	require.Nil(t, err)
+	assert.Equal(t, int64(patch.Len()), n)
+
+	var out bytes.Buffer
+	require.Nil(t, Apply(bytes.NewReader(base), &patch, &out))
+	assert.Equal(t, target, out.Bytes())
+
+	return n
+}
+
+func TestDiffSmallChanges(t *testing.T) {
+	base := randomBytes(1, 1024*1024)
+
+	modified := append([]byte{}, base...)
+	copy(modified[500000:], "changed")
+
+	inserted := append(append(append([]byte{}, base[:300001]...), "inserted"...), base[300001:]...)
+	deleted := append(append([]byte{}, base[:700003]...), base[700100:]...)
+	appended := append(append([]byte{}, base...), "appended"...)
+
+	for desc, target := range map[string][]byte{
+		"unchanged": base,
+		"modified":  modified,
+		"inserted":  inserted,
+		"deleted":   deleted,
+		"appended":  appended,
+	} {
+		n := diffAndApply(t, base, target)
+		assert.True(t, n < int64(len(target))/100, "%s: patch is %d bytes", desc, n)
+	}
+}
+
+func TestDiffUnrelatedFiles(t *testing.T) {
+	base := randomBytes(1, 64*1024)
+	target := randomBytes(2, 64*1024)
+
+	n := diffAndApply(t, base, target)
+	assert.True(t, n > int64(len(target)), "patch is %d bytes", n)
+}
+
+func TestDiffEmptyFiles(t *testing.T) {
+	diffAndApply(t, nil, []byte("new content"))
+	diffAndApply(t, []byte("old content"), nil)
+	diffAndApply(t, nil, nil)
+	diffAndApply(t, []byte("short"), []byte("shorter"))
+}
+
+func TestApplyRejectsBadPatches(t *testing.T) {
+	base := randomBytes(1, 64*1024)
+	target := append(append([]byte{}, base...), "more"...)
+
+	var patch bytes.Buffer
+	_, err := Diff(bytes.NewReader(base), int64(len(base)), bytes.NewReader(target), &patch)
+	require.Nil(t, err)
+
+	var out bytes.Buffer
+	err = Apply(bytes.NewReader(base), bytes.NewReader(patch.Bytes()[:patch.Len()-1]), &out)
+	assert.NotNil(t, err)
+
+	err = Apply(bytes.NewReader(base), bytes.NewReader([]byte("not a patch")), &out)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "delta: not a git-lfs patch", err.Error())
+	}
+}
@@ -0,0 +1,145 @@
+package errors
+
+import (
+	"fmt"
+	"io"
+)
+
+// Category describes what kind of failure an error represents, so that
+// callers can apply a separate retry policy to each kind.
+type Category int
+
+const (
+	// UnknownCategory is the category of errors which have not been tagged
+	// with one.
+	UnknownCategory Category = iota
+	// NetworkCategory is for errors which happened on the way to or from
+	// the server, such as failed DNS lookups, refused connections and
+	// timeouts, rather than being reported by it.
+	NetworkCategory
+	// ServerCategory is for errors reported by the server which may go
+	// away by themselves: 5xx responses, 401 (credentials may be retried)
+	// and 429 (too many requests).
+	ServerCategory
+	// ClientCategory is for the other 4xx responses, which report a problem
+	// with the request itself, so repeating it will fail in the same way.
+	ClientCategory
+)
+
+func (c Category) String() string {
+	switch c {
+	case NetworkCategory:
+		return "network"
+	case ServerCategory:
+		return "server"
+	case ClientCategory:
+		return "client"
+	}
+	return "unknown"
+}
+
+// StatusCategory returns the category of an error caused by an HTTP response
+// with the given status code, or UnknownCategory if it is not an error status.
+func StatusCategory(code int) Category {
+	switch {
+	case code == 401 || code == 429 || code > 499:
+		return ServerCategory
+	case code > 399:
+		return ClientCategory
+	}
+	return UnknownCategory
+}
+
+// CategoryOf returns the category that "err" or the closest of its causes was
+// tagged with, or UnknownCategory if there is none.
+func CategoryOf(err error) Category {
+	if e, ok := err.(interface {
+		Category() Category
+	}); ok {
+		return e.Category()
+	}
+	if parent := parentOf(err); parent != nil {
+		return CategoryOf(parent)
+	}
+	return UnknownCategory
+}
+
+// Definitions for CategoryOf()
+
+type categorizedError struct {
+	*wrappedError
+	cause    error
+	category Category
+}
+
+func (e categorizedError) Category() Category {
+	return e.category
+}
+
+// Cause returns the tagged error itself, rather than its cause, so that the
+// Is*Error checks still find any behavior it has.
+func (e categorizedError) Cause() error {
+	return e.cause
+}
+
+// Error returns the message of the tagged error, unchanged.
+func (e categorizedError) Error() string {
+	return e.cause.Error()
+}
+
+// Format formats the tagged error, unchanged.
+func (e categorizedError) Format(s fmt.State, verb rune) {
+	if f, ok := e.cause.(fmt.Formatter); ok {
+		f.Format(s, verb)
+		return
+	}
+	io.WriteString(s, e.cause.Error())
+}
+
+// NewCategorizedError tags "err" with the given category. Since wrapping an
+// error with any of the other New*Error functions hides its category, this
+// should be done last.
+func NewCategorizedError(err error, category Category) error {
+	return categorizedError{newWrappedError(err, ""), err, category}
+}
+
+// NewStatusError tags "err", which was caused by an HTTP response with the
+// given status code, with the category for that status (see StatusCategory),
+// and with the code itself (see StatusCodeOf).
+func NewStatusError(err error, code int) error {
+	return newStatusError(err, StatusCategory(code), code)
+}
+
+// newStatusError tags "err" with "category" and, unless it is 0, the status
+// code "code".
+func newStatusError(err error, category Category, code int) error {
+	if code == 0 {
+		return NewCategorizedError(err, category)
+	}
+	return statusError{categorizedError{newWrappedError(err, ""), err, category}, code}
+}
+
+// StatusCodeOf returns the HTTP status code that "err" or the closest of its
+// causes was tagged with by NewStatusError, or 0 if there is none.
+func StatusCodeOf(err error) int {
+	if e, ok := err.(interface {
+		StatusCode() int
+	}); ok {
+		return e.StatusCode()
+	}
+	if parent := parentOf(err); parent != nil {
+		return StatusCodeOf(parent)
+	}
+	return 0
+}
+
+// Definitions for StatusCodeOf()
+
+type statusError struct {
+	categorizedError
+	code int
+}
+
+func (e statusError) StatusCode() int {
+	return e.code
+}
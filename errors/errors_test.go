@@ -1,7 +1,10 @@
 package errors
 
 import (
+	"crypto/x509"
 	"errors"
+	"net"
+	"net/url"
 	"testing"
 )
 
@@ -42,6 +45,149 @@ func TestBehaviorWraps(t *testing.T) {
 	}
 }
 
+func TestSafeRetriableErrorsAreRetriable(t *testing.T) {
+	err := NewSafeRetriableError(errors.New("Go error"))
+
+	if !IsSafeRetriableError(err) {
+		t.Error("expected error to be safe to retry")
+	}
+
+	if !IsRetriableError(err) {
+		t.Error("expected safe retriable error to also be retriable")
+	}
+}
+
+func TestCancelledErrors(t *testing.T) {
+	err := Wrap(NewCancelledError(errors.New("transfer cancelled")), "download")
+
+	if !IsCancelledError(err) {
+		t.Error("expected wrapped error to be cancelled")
+	}
+
+	if IsRetriableError(err) {
+		t.Error("expected cancelled error to not be retriable")
+	}
+
+	if IsCancelledError(errors.New("Go error")) {
+		t.Error("expected Go error to not be cancelled")
+	}
+}
+
+func TestRetriableErrorsAreNotSafeRetriable(t *testing.T) {
+	err := NewRetriableError(errors.New("Go error"))
+
+	if IsSafeRetriableError(err) {
+		t.Error("expected retriable error to not be safe to retry")
+	}
+}
+
+func TestNetworkErrorsBeforeRequestAreSafeRetriable(t *testing.T) {
+	for desc, err := range map[string]error{
+		"dns lookup": &url.Error{Op: "Post", URL: "https://example.com", Err: &net.OpError{
+			Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "example.com"},
+		}},
+		"tls handshake timeout": &url.Error{Op: "Post", URL: "https://example.com", Err: handshakeTimeout{}},
+	} {
+		wrapped := NewRetriableNetworkError(Wrap(err, "http"), false)
+		if !IsSafeRetriableError(wrapped) {
+			t.Errorf("expected %s to be safe to retry", desc)
+		}
+	}
+}
+
+func TestNetworkErrorsAfterRequestAreRetriable(t *testing.T) {
+	err := &url.Error{Op: "Put", URL: "https://example.com", Err: &net.OpError{
+		Op: "read", Net: "tcp", Err: errors.New("connection reset by peer"),
+	}}
+
+	if wrapped := NewRetriableNetworkError(err, false); !IsRetriableError(wrapped) || IsSafeRetriableError(wrapped) {
+		t.Error("expected mid-request error to be retriable, but not safe to retry")
+	}
+	if wrapped := NewRetriableNetworkError(err, true); !IsSafeRetriableError(wrapped) {
+		t.Error("expected error to be safe to retry when requested")
+	}
+}
+
+func TestCertificateErrorsAreNotRetriable(t *testing.T) {
+	for desc, err := range map[string]error{
+		"unknown authority": x509.UnknownAuthorityError{},
+		"invalid":           x509.CertificateInvalidError{Reason: x509.Expired},
+		"hostname":          x509.HostnameError{Certificate: &x509.Certificate{}, Host: "example.com"},
+	} {
+		wrapped := NewRetriableNetworkError(Wrap(&url.Error{Op: "Post", URL: "https://example.com", Err: err}, "http"), true)
+		if IsRetriableError(wrapped) {
+			t.Errorf("expected %s certificate error to not be retriable", desc)
+		}
+		if !IsCertificateError(wrapped) {
+			t.Errorf("expected %s to be a certificate error", desc)
+		}
+	}
+}
+
+type handshakeTimeout struct{}
+
+func (handshakeTimeout) Error() string   { return "net/http: TLS handshake timeout" }
+func (handshakeTimeout) Timeout() bool   { return true }
+func (handshakeTimeout) Temporary() bool { return true }
+
+func TestStatusCategories(t *testing.T) {
+	for code, category := range map[int]Category{
+		200: UnknownCategory,
+		400: ClientCategory,
+		401: ServerCategory,
+		403: ClientCategory,
+		404: ClientCategory,
+		429: ServerCategory,
+		500: ServerCategory,
+		503: ServerCategory,
+	} {
+		if c := CategoryOf(NewStatusError(errors.New("Go error"), code)); c != category {
+			t.Errorf("expected status %d to be a %s error, got %s", code, category, c)
+		}
+	}
+}
+
+func TestStatusCodes(t *testing.T) {
+	err := NewStatusError(errors.New("Go error"), 503)
+	if code := StatusCodeOf(err); code != 503 {
+		t.Errorf("expected status 503, got %d", code)
+	}
+	if code := StatusCodeOf(NewRetriableNetworkError(Wrap(err, "http"), true)); code != 503 {
+		t.Errorf("expected wrapped error to keep status 503, got %d", code)
+	}
+	if code := StatusCodeOf(NewRetriableNetworkError(err, false)); code != 503 {
+		t.Errorf("expected retriable error to keep status 503, got %d", code)
+	}
+	if code := StatusCodeOf(NewCategorizedError(errors.New("Go error"), ServerCategory)); code != 0 {
+		t.Errorf("expected categorized error to have no status, got %d", code)
+	}
+	if code := StatusCodeOf(errors.New("Go error")); code != 0 {
+		t.Errorf("expected go error to have no status, got %d", code)
+	}
+}
+
+func TestCategoriesKeepBehaviors(t *testing.T) {
+	err := NewStatusError(NewAuthError(errors.New("Go error")), 401)
+	if !IsAuthError(err) {
+		t.Error("expected categorized error to still be an auth error")
+	}
+
+	retriable := NewRetriableNetworkError(Wrap(err, "http"), true)
+	if c := CategoryOf(retriable); c != ServerCategory {
+		t.Errorf("expected retriable error to keep its category, got %s", c)
+	}
+	if !IsSafeRetriableError(retriable) {
+		t.Error("expected categorized error to be safe to retry")
+	}
+
+	if c := CategoryOf(NewRetriableNetworkError(errors.New("connection reset"), false)); c != NetworkCategory {
+		t.Errorf("expected uncategorized error to become a network error, got %s", c)
+	}
+	if c := CategoryOf(errors.New("Go error")); c != UnknownCategory {
+		t.Errorf("expected go error to have no category, got %s", c)
+	}
+}
+
 func TestContextOnGoErrors(t *testing.T) {
 	err := errors.New("Go error")
 
@@ -0,0 +1,117 @@
+package errors
+
+import (
+	"crypto/x509"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// NewRetriableNetworkError wraps an error returned while making an HTTP
+// request, marking it as retriable according to what went wrong:
+//
+//   - Certificate validation failures are returned unchanged, and are not
+//     retriable, since they will fail in exactly the same way next time.
+//   - Failed DNS lookups, failed connection attempts and TLS handshake
+//     timeouts happen before the request is sent, so they are always safe to
+//     retry.
+//   - Any other error is retriable, and is also safe to retry if "safe" is
+//     true, e.g. when no content was sent before it happened.
+//
+// The result keeps the category of "err", such as that of an HTTP error status,
+// or is in NetworkCategory if it had none, and any status code it was tagged
+// with.
+func NewRetriableNetworkError(err error, safe bool) error {
+	if err == nil {
+		return nil
+	}
+	if IsCertificateError(err) {
+		return err
+	}
+
+	category := CategoryOf(err)
+	if category == UnknownCategory {
+		category = NetworkCategory
+	}
+	code := StatusCodeOf(err)
+	// Tag the result instead, so that the message is the same as it would
+	// be without a category.
+	switch c := err.(type) {
+	case categorizedError:
+		err = c.cause
+	case statusError:
+		err = c.cause
+	}
+
+	if safe || isConnectError(err) {
+		return newStatusError(NewSafeRetriableError(err), category, code)
+	}
+	return newStatusError(NewRetriableError(err), category, code)
+}
+
+// IsCertificateError indicates that the error was caused by the server's TLS
+// certificate failing validation.
+func IsCertificateError(err error) bool {
+	return anyCause(err, func(err error) bool {
+		switch err.(type) {
+		case x509.UnknownAuthorityError, *x509.UnknownAuthorityError,
+			x509.CertificateInvalidError, *x509.CertificateInvalidError,
+			x509.HostnameError, *x509.HostnameError,
+			x509.SystemRootsError, *x509.SystemRootsError:
+			return true
+		}
+		return false
+	})
+}
+
+// isConnectError indicates that the error happened before an HTTP request
+// could be sent: a failed DNS lookup, a failed dial or a TLS handshake
+// timeout.
+func isConnectError(err error) bool {
+	return anyCause(err, func(err error) bool {
+		switch e := err.(type) {
+		case *net.DNSError:
+			return true
+		case *net.OpError:
+			return e.Op == "dial"
+		}
+		return strings.Contains(err.Error(), "TLS handshake timeout")
+	})
+}
+
+// anyCause returns whether "fn" holds for "err" or any of its causes, looking
+// through LFS wrapped errors as well as the url and net package wrappers.
+func anyCause(err error, fn func(error) bool) bool {
+	for err != nil {
+		if fn(err) {
+			return true
+		}
+
+		switch e := err.(type) {
+		case *url.Error:
+			err = e.Err
+		case *net.OpError:
+			err = e.Err
+		default:
+			err = causeOf(err)
+		}
+	}
+	return false
+}
+
+func causeOf(err error) error {
+	if parent := parentOf(err); parent != nil {
+		return parent
+	}
+	if c, ok := err.(interface {
+		Cause() error
+	}); ok && c.Cause() != err {
+		return c.Cause()
+	}
+	if u, ok := err.(interface {
+		Unwrap() error
+	}); ok {
+		return u.Unwrap()
+	}
+	return nil
+}
@@ -140,6 +140,36 @@ func IsRetriableError(err error) bool {
 	return false
 }
 
+// IsSafeRetriableError indicates that the operation failed in a way which
+// cannot have left partial data at the remote end, such as before any content
+// was sent, so it may be retried even if it is not idempotent (e.g. an upload).
+// Every safe retriable error is also a retriable error.
+func IsSafeRetriableError(err error) bool {
+	if e, ok := err.(interface {
+		SafeRetriableError() bool
+	}); ok {
+		return e.SafeRetriableError()
+	}
+	if parent := parentOf(err); parent != nil {
+		return IsSafeRetriableError(parent)
+	}
+	return false
+}
+
+// IsCancelledError indicates that a transfer was stopped because the object
+// was cancelled, rather than because it failed.
+func IsCancelledError(err error) bool {
+	if e, ok := err.(interface {
+		Cancelled() bool
+	}); ok {
+		return e.Cancelled()
+	}
+	if parent := parentOf(err); parent != nil {
+		return IsCancelledError(parent)
+	}
+	return false
+}
+
 type errorWithCause interface {
 	Cause() error
 	StackTrace() errors.StackTrace
@@ -331,6 +361,38 @@ func NewRetriableError(err error) error {
 	return retriableError{newWrappedError(err, "")}
 }
 
+// Definitions for IsSafeRetriableError()
+
+type safeRetriableError struct {
+	*wrappedError
+}
+
+func (e safeRetriableError) RetriableError() bool {
+	return true
+}
+
+func (e safeRetriableError) SafeRetriableError() bool {
+	return true
+}
+
+func NewSafeRetriableError(err error) error {
+	return safeRetriableError{newWrappedError(err, "")}
+}
+
+// Definitions for IsCancelledError()
+
+type cancelledError struct {
+	*wrappedError
+}
+
+func (e cancelledError) Cancelled() bool {
+	return true
+}
+
+func NewCancelledError(err error) error {
+	return cancelledError{newWrappedError(err, "")}
+}
+
 func parentOf(err error) error {
 	if c, ok := err.(errorWithCause); ok {
 		return c.Cause()
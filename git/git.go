@@ -533,6 +533,86 @@ func FormatGitDate(tm time.Time) string {
 	return tm.Format("Mon Jan 2 15:04:05 2006 -0700")
 }
 
+// ParseApproxDate returns the time which Git takes "date" to mean, in the
+// same way as `git log --since`, so that it can be anything from an ISO 8601
+// date to "2 weeks ago" or "2.weeks.ago". Like Git, it doesn't reject dates
+// which it can't make sense of, but takes them to be the current time.
+func ParseApproxDate(date string) (time.Time, error) {
+	cmd := subprocess.ExecCommand("git", "rev-parse", "--since="+date)
+	out, err := cmd.Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Failed to call git rev-parse --since: %v %v", err, string(out))
+	}
+
+	// Git prints the date as a Unix time in the option `git rev-list` uses.
+	field := strings.TrimSpace(string(out))
+	secs, err := strconv.ParseInt(strings.TrimPrefix(field, "--max-age="), 10, 64)
+	if err != nil || !strings.HasPrefix(field, "--max-age=") {
+		return time.Time{}, fmt.Errorf("Unable to parse date %q: git rev-parse gave %q", date, field)
+	}
+	return time.Unix(secs, 0), nil
+}
+
+// StashCommits returns the commits of the entries in the stash, most recent
+// first.
+func StashCommits() ([]string, error) {
+	out, err := subprocess.SimpleExec("git", "stash", "list", "--format=%H")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list stash entries: %v", err)
+	}
+	return strings.Fields(out), nil
+}
+
+// CommitsWithBlob returns up to "max" commits reachable from "ref", or from any
+// ref if it is empty, which changed the file at "path" to the blob "blob", most
+// recent first.
+func CommitsWithBlob(ref, path, blob string, max int) ([]string, error) {
+	if ref == "" {
+		ref = "--all"
+	}
+
+	out, err := subprocess.SimpleExec("git", "rev-list", ref, "--", path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to call git rev-list: %v", err)
+	}
+
+	var commits []string
+	for _, commit := range strings.Fields(out) {
+		sha, err := subprocess.SimpleExec("git", "rev-parse", "--verify", "-q", commit+":"+path)
+		if err != nil || sha != blob {
+			// The file was deleted or changed to something else.
+			continue
+		}
+
+		commits = append(commits, commit)
+		if len(commits) == max {
+			break
+		}
+	}
+	return commits, nil
+}
+
+// StagedBlob returns the content of the blob staged in the index for "path",
+// relative to the root of the repository, or nil if it is larger than "max"
+// bytes.
+func StagedBlob(path string, max int64) ([]byte, error) {
+	name := ":" + filepath.ToSlash(path)
+	out, err := subprocess.SimpleExec("git", "cat-file", "-s", name)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to call git cat-file: %v", err)
+	}
+
+	size, err := strconv.ParseInt(out, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid size of %s from git cat-file: %q", name, out)
+	}
+	if size > max {
+		return nil, nil
+	}
+
+	return subprocess.ExecCommand("git", "cat-file", "blob", name).Output()
+}
+
 // Get summary information about a commit
 func GetCommitSummary(commit string) (*CommitSummary, error) {
 	cmd := subprocess.ExecCommand("git", "show", "-s",
@@ -628,6 +708,27 @@ func GitDir() (string, error) {
 	return "", nil
 }
 
+// GitCommonDir returns the absolute path of the directory which the current
+// repository shares with any other worktrees of it, such as the one holding
+// its objects and info/attributes. It is the same as GitDir outside of
+// worktrees.
+func GitCommonDir() (string, error) {
+	cmd := subprocess.ExecCommand("git", "rev-parse", "--git-common-dir")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Failed to call git rev-parse --git-common-dir: %v %v", err, string(out))
+	}
+	path := strings.TrimSpace(string(out))
+	if path == "--git-common-dir" {
+		// Versions of Git before 2.5 echo options they don't know.
+		return "", fmt.Errorf("git rev-parse --git-common-dir is not supported by this version of Git")
+	}
+	if len(path) > 0 {
+		return filepath.Abs(path)
+	}
+	return "", nil
+}
+
 // GetAllWorkTreeHEADs returns the refs that all worktrees are using as HEADs
 // This returns all worktrees plus the master working copy, and works even if
 // working dir is actually in a worktree right now
@@ -1005,6 +1106,112 @@ func GetTrackedFiles(pattern string) ([]string, error) {
 
 }
 
+// IgnoredBy returns the pattern which makes git ignore "path", relative to the
+// current directory, and where it comes from, as "file:line", or empty strings
+// if it isn't ignored. A trailing slash checks "path" as a directory, whether
+// it exists or not.
+func IgnoredBy(path string) (pattern, source string, err error) {
+	cmd := subprocess.ExecCommand("git",
+		"check-ignore",
+		"--stdin",
+		"-z",             // NUL-separated, so that names aren't quoted
+		"--verbose",      // give the pattern which matched
+		"--non-matching") // and say so when none did
+	cmd.Stdin = strings.NewReader(path + "\x00")
+
+	// check-ignore exits with 1 when the path isn't ignored, which
+	// --non-matching still reports.
+	out, err := cmd.Output()
+	if err != nil && len(out) == 0 {
+		return "", "", fmt.Errorf("Failed to call git check-ignore: %v", err)
+	}
+
+	// The fields are the file, line number and pattern which matched,
+	// which are empty if none did, and then the path.
+	fields := strings.Split(string(out), "\x00")
+	if len(fields) < 4 {
+		return "", "", fmt.Errorf("Invalid output from git check-ignore: %q", out)
+	}
+
+	// A negated pattern matching means the path isn't ignored.
+	if len(fields[0]) == 0 || strings.HasPrefix(fields[2], "!") {
+		return "", "", nil
+	}
+	return fields[2], fields[0] + ":" + fields[1], nil
+}
+
+// GetAttributesFiles returns the .gitattributes files in the working tree at
+// "root", relative to it, which are either tracked, or untracked but not
+// ignored. Git doesn't descend into ignored directories, or the .git
+// directory, to find them, so this is much faster than walking the whole tree.
+func GetAttributesFiles(root string) ([]string, error) {
+	cmd := subprocess.ExecCommand("git",
+		"ls-files",
+		"-z",                 // NUL-separated, so that names aren't quoted
+		"--cached",           // include tracked files
+		"--others",           // and untracked ones
+		"--exclude-standard", // which aren't ignored
+		"--",
+		".gitattributes", "*/.gitattributes")
+	cmd.Dir = root
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to call git ls-files: %v", err)
+	}
+
+	var ret []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(string(out), "\x00") {
+		// Unmerged files are listed once for each stage.
+		if len(name) == 0 || seen[name] {
+			continue
+		}
+		seen[name] = true
+		ret = append(ret, name)
+	}
+	return ret, nil
+}
+
+// GetFilesWithAttribute returns the files tracked in the repository at "root",
+// relative to it, which have the attribute "attr" set, according to the
+// .gitattributes files in the working tree. Files which are tracked but have
+// been deleted from the working tree are included.
+func GetFilesWithAttribute(root, attr string) ([]string, error) {
+	ls := subprocess.ExecCommand("git", "ls-files", "-z", "--cached")
+	ls.Dir = root
+
+	files, err := ls.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to call git ls-files: %v", err)
+	}
+
+	check := subprocess.ExecCommand("git", "check-attr", "-z", "--stdin", attr)
+	check.Dir = root
+	check.Stdin = bytes.NewReader(files)
+
+	out, err := check.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to call git check-attr: %v", err)
+	}
+
+	// Each file is given as its name, the attribute and its value.
+	var ret []string
+	seen := make(map[string]bool)
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		name, value := fields[i], fields[i+2]
+
+		// Unmerged files are listed once for each stage.
+		if value != "set" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		ret = append(ret, name)
+	}
+	return ret, nil
+}
+
 func sanitizePattern(pattern string) string {
 	if strings.HasPrefix(pattern, "/") {
 		return pattern[1:]
@@ -5,12 +5,15 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	. "github.com/github/git-lfs/git"
+	"github.com/github/git-lfs/subprocess"
 	"github.com/github/git-lfs/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCurrentRefAndCurrentRemoteRef(t *testing.T) {
@@ -77,6 +80,85 @@ func TestCurrentRefAndCurrentRemoteRef(t *testing.T) {
 	assert.Equal(t, &Ref{outputs[2].Sha, RefTypeOther, outputs[2].Sha}, ref)
 }
 
+func TestCommitsWithBlob(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	outputs := repo.AddCommits([]*test.CommitInput{
+		{Files: []*test.FileInput{{Filename: "file1.txt", Size: 20}}},
+		{Files: []*test.FileInput{{Filename: "file2.txt", Size: 25}}},
+		{Files: []*test.FileInput{{Filename: "file1.txt", Size: 30}}},
+	})
+
+	blob, err := subprocess.SimpleExec("git", "rev-parse", outputs[0].Sha+":file1.txt")
+	assert.Nil(t, err)
+
+	commits, err := CommitsWithBlob("", "file1.txt", blob, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{outputs[0].Sha}, commits)
+
+	commits, err = CommitsWithBlob("master", "file2.txt", blob, 5)
+	assert.Nil(t, err)
+	assert.Empty(t, commits)
+}
+
+func TestStagedBlob(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	require.Nil(t, os.MkdirAll("folder", 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join("folder", "file1.txt"), []byte("staged"), 0644))
+	_, err := subprocess.SimpleExec("git", "add", "folder/file1.txt")
+	require.Nil(t, err)
+
+	blob, err := StagedBlob("folder/file1.txt", 6)
+	assert.Nil(t, err)
+	assert.Equal(t, "staged", string(blob))
+
+	blob, err = StagedBlob("folder/file1.txt", 5)
+	assert.Nil(t, err)
+	assert.Nil(t, blob)
+
+	_, err = StagedBlob("missing.txt", 5)
+	assert.NotNil(t, err)
+}
+
+func TestIgnoredBy(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	require.Nil(t, ioutil.WriteFile(".gitignore", []byte("*.log\n!keep.log\nbuild/\n"), 0644))
+
+	pattern, source, err := IgnoredBy("build/")
+	assert.Nil(t, err)
+	assert.Equal(t, "build/", pattern)
+	assert.Equal(t, ".gitignore:3", source)
+
+	pattern, source, err = IgnoredBy("a b.log")
+	assert.Nil(t, err)
+	assert.Equal(t, "*.log", pattern)
+	assert.Equal(t, ".gitignore:1", source)
+
+	for _, path := range []string{"build", "src/", "keep.log"} {
+		pattern, source, err = IgnoredBy(path)
+		assert.Nil(t, err, path)
+		assert.Empty(t, pattern, path)
+		assert.Empty(t, source, path)
+	}
+}
+
 func TestRecentBranches(t *testing.T) {
 	repo := test.NewRepo(t)
 	repo.Pushd()
@@ -406,6 +488,74 @@ func TestGetTrackedFiles(t *testing.T) {
 
 }
 
+func TestGetAttributesFiles(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	files := map[string]string{
+		".gitattributes":           "*.dat filter=lfs\n",
+		".gitignore":               "ignored/\n",
+		"a/.gitattributes":         "*.bin filter=lfs\n",
+		"b/c/.gitattributes":       "*.png filter=lfs\n",
+		"b/not.gitattributes":      "*.jpg filter=lfs\n",
+		"ignored/d/.gitattributes": "*.gif filter=lfs\n",
+	}
+	for name, data := range files {
+		require.Nil(t, os.MkdirAll(filepath.Dir(name), 0755))
+		require.Nil(t, ioutil.WriteFile(name, []byte(data), 0644))
+	}
+	test.RunGitCommand(t, true, "add", ".gitattributes", ".gitignore", "a/.gitattributes")
+
+	// The results are relative to the root, wherever it's run from.
+	os.Chdir("a")
+	found, err := GetAttributesFiles(repo.Path)
+	os.Chdir("..")
+
+	assert.Nil(t, err)
+	sort.Strings(found)
+	assert.Equal(t, []string{".gitattributes", "a/.gitattributes", "b/c/.gitattributes"}, found)
+}
+
+func TestGetFilesWithAttribute(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	files := map[string]string{
+		".gitattributes":   "*.dat filter=lfs lockable\n*.bin filter=lfs\n",
+		"a/.gitattributes": "*.bin lockable\n",
+		"a.dat":            "a",
+		"b.bin":            "b",
+		"a/c.bin":          "c",
+		"a/d.dat":          "d",
+		"a/e.txt":          "e",
+		"untracked.dat":    "u",
+	}
+	for name, data := range files {
+		require.Nil(t, os.MkdirAll(filepath.Dir(name), 0755))
+		require.Nil(t, ioutil.WriteFile(name, []byte(data), 0644))
+	}
+	test.RunGitCommand(t, true, "add", ".gitattributes", "a.dat", "b.bin", "a")
+
+	// Deleted files are still tracked.
+	require.Nil(t, os.Remove("a/d.dat"))
+
+	os.Chdir("a")
+	found, err := GetFilesWithAttribute(repo.Path, "lockable")
+	os.Chdir("..")
+
+	assert.Nil(t, err)
+	sort.Strings(found)
+	assert.Equal(t, []string{"a.dat", "a/c.bin", "a/d.dat"}, found)
+}
+
 func TestLocalRefs(t *testing.T) {
 	repo := test.NewRepo(t)
 	repo.Pushd()
@@ -465,3 +615,51 @@ func TestLocalRefs(t *testing.T) {
 		t.Errorf("Unexpected local refs: %v", actual)
 	}
 }
+
+func TestParseApproxDate(t *testing.T) {
+	d, err := ParseApproxDate("2016-01-02T10:00:00Z")
+	if assert.Nil(t, err) {
+		assert.Equal(t, time.Date(2016, 1, 2, 10, 0, 0, 0, time.UTC), d.UTC())
+	}
+
+	for _, date := range []string{"2 weeks ago", "2.weeks.ago"} {
+		d, err := ParseApproxDate(date)
+		if assert.Nil(t, err, date) {
+			expected := time.Now().AddDate(0, 0, -14)
+			assert.WithinDuration(t, expected, d, time.Minute, date)
+		}
+	}
+}
+
+func TestStashCommits(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	repo.AddCommits([]*test.CommitInput{
+		{
+			Files: []*test.FileInput{
+				{Filename: "file1.txt", Size: 20},
+			},
+		},
+	})
+
+	stashes, err := StashCommits()
+	assert.Nil(t, err)
+	assert.Empty(t, stashes)
+
+	for _, content := range []string{"first", "second"} {
+		assert.Nil(t, ioutil.WriteFile("file1.txt", []byte(content), 0644))
+		test.RunGitCommand(t, true, "stash")
+	}
+
+	stashes, err = StashCommits()
+	assert.Nil(t, err)
+	if assert.Len(t, stashes, 2) {
+		assert.Equal(t, strings.TrimSpace(test.RunGitCommand(t, true, "rev-parse", "stash@{0}")), stashes[0])
+		assert.Equal(t, strings.TrimSpace(test.RunGitCommand(t, true, "rev-parse", "stash@{1}")), stashes[1])
+	}
+}
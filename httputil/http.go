@@ -42,6 +42,8 @@ var (
 	httpTransferBucketsLock sync.Mutex
 	httpClients             map[string]*HttpClient
 	httpClientsMutex        sync.Mutex
+	http2Hosts              = make(map[string]bool) // hosts which have answered over HTTP/2
+	http2HostsMutex         sync.Mutex
 	UserAgent               string
 )
 
@@ -76,6 +78,12 @@ func (c *HttpClient) Do(req *http.Request) (*http.Response, error) {
 
 	traceHttpResponse(c.Config, res)
 
+	if res.ProtoMajor == 2 {
+		http2HostsMutex.Lock()
+		http2Hosts[strings.ToLower(req.URL.Hostname())] = true
+		http2HostsMutex.Unlock()
+	}
+
 	cresp := countingResponse(c.Config, res)
 	res.Body = cresp
 
@@ -105,6 +113,14 @@ func (c *HttpClient) Do(req *http.Request) (*http.Response, error) {
 	return res, err
 }
 
+// UsedHTTP2 returns whether the host, a host name without a port, has answered
+// a request over HTTP/2.
+func UsedHTTP2(host string) bool {
+	http2HostsMutex.Lock()
+	defer http2HostsMutex.Unlock()
+	return http2Hosts[strings.ToLower(host)]
+}
+
 // NewHttpClient returns a new HttpClient for the given host (which may be "host:port")
 func NewHttpClient(c *config.Configuration, host string) *HttpClient {
 	httpClientsMutex.Lock()
@@ -129,6 +145,9 @@ func NewHttpClient(c *config.Configuration, host string) *HttpClient {
 		}).Dial,
 		TLSHandshakeTimeout: time.Duration(tlstime) * time.Second,
 		MaxIdleConnsPerHost: c.ConcurrentTransfers(),
+		// HTTP/2 is only negotiated automatically by transports
+		// without their own Dial and TLSClientConfig.
+		ForceAttemptHTTP2: c.HTTP2Enabled(),
 	}
 
 	tr.TLSClientConfig = &tls.Config{}
@@ -2,8 +2,11 @@ package httputil
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 
+	"github.com/github/git-lfs/config"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -43,3 +46,33 @@ func TestGetAuthType(t *testing.T) {
 		c.Assert(t)
 	}
 }
+
+func TestHttpClientRecordsHTTP2Hosts(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	assert.Nil(t, err)
+
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"http.sslverify": "false",
+			"lfs.http2":      "true",
+		},
+	})
+
+	assert.False(t, UsedHTTP2(u.Hostname()))
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	assert.Nil(t, err)
+	res, err := NewHttpClient(cfg, u.Host).Do(req)
+	if assert.Nil(t, err) {
+		res.Body.Close()
+		assert.Equal(t, 2, res.ProtoMajor)
+	}
+
+	assert.True(t, UsedHTTP2(u.Hostname()))
+	assert.False(t, UsedHTTP2("example.com"))
+}
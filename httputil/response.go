@@ -85,17 +85,17 @@ func handleResponse(cfg *config.Configuration, res *http.Response, creds auth.Cr
 		if err == nil {
 			err = errors.New("api: received status 401")
 		}
-		return errors.NewAuthError(err)
+		return errors.NewStatusError(errors.NewAuthError(err), res.StatusCode)
 	}
 
 	if res.StatusCode > 499 && res.StatusCode != 501 && res.StatusCode != 507 && res.StatusCode != 509 {
 		if err == nil {
 			err = errors.Errorf("api: received status %d", res.StatusCode)
 		}
-		return errors.NewFatalError(err)
+		return errors.NewStatusError(errors.NewFatalError(err), res.StatusCode)
 	}
 
-	return err
+	return errors.NewStatusError(err, res.StatusCode)
 }
 
 func defaultError(res *http.Response) error {
@@ -1,6 +1,9 @@
 package lfs
 
-import "sync/atomic"
+import (
+	"sync"
+	"time"
+)
 
 // Batcher provides a way to process a set of items in groups of n. Items can
 // be added to the batcher from multiple goroutines and pulled off in groups
@@ -8,92 +11,190 @@ import "sync/atomic"
 //   * The batch size is reached
 //   * Flush() is called, forcing the batch to be returned immediately, as-is
 //   * Exit() is called
-// When an Exit() or Flush() occurs, the group may be smaller than the batch
-// size.
+//   * The flush interval passes without any items being added to a batch
+//     which already has some
+// When an Exit() or Flush() occurs, or the flush interval passes, the group may
+// be smaller than the batch size.
 type Batcher struct {
-	exited     uint32
-	batchSize  int
-	input      chan interface{}
-	batchReady chan []interface{}
-	flush      chan interface{}
+	// mu guards exited, and the input and flush channels which Exit closes
+	// and Add replaces. Sends hold it for reading, so that the channels
+	// aren't closed under them.
+	mu            sync.RWMutex
+	exited        bool
+	batchSize     int
+	flushInterval time.Duration
+	input         chan interface{}
+	batchReady    chan []interface{}
+	flush         chan interface{}
+	done          chan struct{}
 }
 
-// NewBatcher creates a Batcher with the batchSize.
-func NewBatcher(batchSize int) *Batcher {
+// NewBatcher creates a Batcher with the batchSize. If flushInterval is greater
+// than zero, a partial batch is returned once that long has passed since the
+// last item was added to it, so that slowly added items are not held back
+// until the batch is full.
+func NewBatcher(batchSize int, flushInterval time.Duration) *Batcher {
 	b := &Batcher{
-		batchSize:  batchSize,
-		input:      make(chan interface{}),
-		batchReady: make(chan []interface{}),
-		flush:      make(chan interface{}),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		input:         make(chan interface{}),
+		batchReady:    make(chan []interface{}),
+		flush:         make(chan interface{}),
+		done:          make(chan struct{}),
 	}
 
-	go b.acceptInput()
+	go b.acceptInput(b.input, b.flush)
 	return b
 }
 
 // Add adds one or more items to the batcher. Add is safe to call from multiple
 // goroutines.
 func (b *Batcher) Add(ts ...interface{}) {
-	if atomic.CompareAndSwapUint32(&b.exited, 1, 0) {
-		b.input = make(chan interface{})
-		b.flush = make(chan interface{})
-		go b.acceptInput()
+	b.mu.RLock()
+	for b.exited {
+		b.mu.RUnlock()
+		b.reset()
+		b.mu.RLock()
 	}
+	defer b.mu.RUnlock()
 
 	for _, t := range ts {
 		b.input <- t
 	}
 }
 
+// reset starts accepting input again after Exit.
+func (b *Batcher) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.exited {
+		b.exited = false
+		b.input = make(chan interface{})
+		b.flush = make(chan interface{})
+		go b.acceptInput(b.input, b.flush)
+	}
+}
+
 // Next will wait for the one of the above batch triggers to occur and return
-// the accumulated batch.
+// the accumulated batch. Batches are never empty: Next returns nil only once the
+// batcher has been closed.
 func (b *Batcher) Next() []interface{} {
-	return <-b.batchReady
+	select {
+	case batch := <-b.batchReady:
+		return batch
+	case <-b.done:
+		return nil
+	}
 }
 
 // Flush causes the current batch to halt accumulation and return
-// immediately, even if it is smaller than the given batch size.
+// immediately, even if it is smaller than the given batch size. After Exit,
+// which returns the last batch itself, there is nothing to flush.
 func (b *Batcher) Flush() {
-	b.flush <- struct{}{}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.exited {
+		b.flush <- struct{}{}
+	}
 }
 
 // Exit stops all batching and allows Next() to return. Calling Add() after
 // calling Exit() will reset the batcher.
 func (b *Batcher) Exit() {
-	atomic.StoreUint32(&b.exited, 1)
-	close(b.input)
-	close(b.flush)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.exited {
+		b.exited = true
+		close(b.input)
+		close(b.flush)
+	}
+}
+
+// Close stops the batcher for good, so that Next returns nil, rather than
+// waiting for the batcher to be reset by Add. Items which haven't been returned
+// by Next yet may be discarded, and Add must not be called afterwards.
+func (b *Batcher) Close() {
+	b.Exit()
+	close(b.done)
 }
 
 // acceptInput runs in its own goroutine and accepts input from external
 // clients. Without flushing, the batch is filled completely in a sequential
 // order, and then dispensed. If, while filling a batch, it is flushed part-way
 // through, the batch will be dispensed with its current contents, and all
-// subsequent Add()s will be placed in the next batch.
-func (b *Batcher) acceptInput() {
+// subsequent Add()s will be placed in the next batch. The same happens if the
+// flush interval passes without anything being added to a partial batch.
+func (b *Batcher) acceptInput(input <-chan interface{}, flush <-chan interface{}) {
 	var exit bool
 
+	// idle fires once the flush interval has passed since the last item
+	// was added. It is only running while the batch has items in it.
+	var idle *time.Timer
+	if b.flushInterval > 0 {
+		idle = time.NewTimer(b.flushInterval)
+		idle.Stop()
+	}
+
 	for {
+		var idlec <-chan time.Time
 		batch := make([]interface{}, 0, b.batchSize)
 	Acc:
 		for len(batch) < b.batchSize {
 			select {
-			case t, ok := <-b.input:
+			case t, ok := <-input:
 				if !ok {
 					exit = true // input channel was closed by Exit()
 					break Acc
 				}
 
 				batch = append(batch, t)
-			case <-b.flush:
+				if idle != nil {
+					resetTimer(idle, b.flushInterval)
+					idlec = idle.C
+				}
+			case <-flush:
+				break Acc
+			case <-idlec:
 				break Acc
 			}
 		}
 
-		b.batchReady <- batch
+		if idle != nil {
+			stopTimer(idle)
+		}
+
+		// Flushing or exiting with nothing in the batch doesn't make
+		// one, so that Next never returns an empty batch.
+		if len(batch) > 0 {
+			select {
+			case b.batchReady <- batch:
+			case <-b.done:
+				return
+			}
+		}
 
 		if exit {
 			return
 		}
 	}
 }
+
+// stopTimer stops "t", discarding the time it sent if it had already fired, so
+// that it will not be received later.
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
+
+// resetTimer restarts "t" to fire after "d".
+func resetTimer(t *time.Timer, d time.Duration) {
+	stopTimer(t)
+	t.Reset(d)
+}
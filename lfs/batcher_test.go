@@ -2,7 +2,9 @@ package lfs
 
 import (
 	"math"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -27,7 +29,7 @@ func TestBatcherReturnsIncompleteBatchesWhenExiting(t *testing.T) {
 func TestBatcherFlushesPartialBatches(t *testing.T) {
 	first, second := "first", "second"
 
-	b := NewBatcher(3)
+	b := NewBatcher(3, 0)
 	b.Add(first)
 	b.Add(second)
 	b.Flush()
@@ -39,6 +41,138 @@ func TestBatcherFlushesPartialBatches(t *testing.T) {
 	assert.Equal(t, second, batch[1])
 }
 
+func TestBatcherFlushesPartialBatchesWhenIdle(t *testing.T) {
+	b := NewBatcher(10, 500*time.Millisecond)
+
+	// Items added faster than the flush interval are batched together.
+	for i := 0; i < 3; i++ {
+		b.Add(i)
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, []interface{}{0, 1, 2}, b.Next())
+
+	time.Sleep(100 * time.Millisecond)
+	b.Add(3)
+	b.Add(4)
+	assert.Equal(t, []interface{}{3, 4}, b.Next())
+
+	b.Exit()
+	b.Close()
+	assert.Nil(t, b.Next())
+}
+
+func TestBatcherIdleFlushesStillFillBatches(t *testing.T) {
+	b := NewBatcher(2, 50*time.Millisecond)
+	go b.Add(0, 1, 2)
+
+	assert.Equal(t, []interface{}{0, 1}, b.Next())
+	assert.Equal(t, []interface{}{2}, b.Next())
+}
+
+func TestBatcherSkipsEmptyFlushes(t *testing.T) {
+	b := NewBatcher(3, 0)
+	b.Add("first")
+	b.Flush()
+	assert.Equal(t, []interface{}{"first"}, b.Next())
+
+	// Flushing, and then exiting, with nothing in the batch doesn't make
+	// an empty one.
+	b.Flush()
+	b.Exit()
+
+	select {
+	case batch := <-b.batchReady:
+		t.Fatalf("unexpected empty batch: %v", batch)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.Add("second")
+	b.Exit()
+	assert.Equal(t, []interface{}{"second"}, b.Next())
+}
+
+func TestBatcherAddAndFlushRaceWithExit(t *testing.T) {
+	b := NewBatcher(100, 0)
+
+	// Receive every batch, so that Add and Flush are never left waiting.
+	received := make(chan int)
+	go func() {
+		n := 0
+		for batch := b.Next(); batch != nil; batch = b.Next() {
+			n += len(batch)
+		}
+		received <- n
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			b.Add(i)
+			b.Flush()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			b.Exit()
+		}
+	}()
+	wg.Wait()
+
+	b.Exit()
+	time.Sleep(50 * time.Millisecond)
+	b.Close()
+	assert.Equal(t, 100, <-received)
+}
+
+func TestBatcherFlushesWithIdleInterval(t *testing.T) {
+	b := NewBatcher(10, time.Hour)
+	b.Add("first")
+	b.Flush()
+
+	assert.Equal(t, []interface{}{"first"}, b.Next())
+}
+
+func TestBatcherDoesNotFlushIdleBatchesAfterExit(t *testing.T) {
+	b := NewBatcher(10, 10*time.Millisecond)
+	b.Add("first")
+	b.Exit()
+
+	assert.Equal(t, []interface{}{"first"}, b.Next())
+
+	select {
+	case batch := <-b.batchReady:
+		t.Fatalf("unexpected batch after exit: %v", batch)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBatcherCloseStopsNext(t *testing.T) {
+	for desc, exit := range map[string]bool{"running": false, "exited": true} {
+		b := NewBatcher(10, 0)
+		b.Add("first")
+		if exit {
+			b.Exit()
+			assert.Equal(t, []interface{}{"first"}, b.Next(), desc)
+		}
+		b.Close()
+
+		next := make(chan []interface{})
+		go func() { next <- b.Next() }()
+
+		select {
+		case batch := <-next:
+			if exit {
+				assert.Nil(t, batch, desc)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: Next did not return after Close", desc)
+		}
+	}
+}
+
 // batcherTestCase specifies information about how to run a particular test
 // around the type lfs.Batcher.
 type batcherTestCase struct {
@@ -61,7 +195,7 @@ type batcherTestCase struct {
 // batcher is not instructed to exit, we should see an item count equal to the
 // number of full batches received * the batch size.
 func (b batcherTestCase) Assert(t *testing.T) {
-	batcher := NewBatcher(b.BatchSize)
+	batcher := NewBatcher(b.BatchSize, 0)
 
 	var remaining = b.ItemCount
 	for remaining > 0 {
@@ -0,0 +1,76 @@
+package lfs
+
+import (
+	"sync"
+	"time"
+)
+
+// clock tells the time, and waits for it to pass. The transfer queue uses one,
+// rather than the time package directly, so that tests can replace it with a
+// clock which they move forward themselves, instead of sleeping.
+type clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel which receives the time once "d" has
+	// passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the clock given by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// clockTimer calls a function once some time has passed on a clock, unless it
+// is stopped first, like a time.Timer made by time.AfterFunc.
+type clockTimer struct {
+	mu    sync.Mutex
+	done  bool // set once the function is called, or the timer is stopped
+	stopc chan struct{}
+}
+
+// afterFunc calls "f" in its own goroutine once "d" has passed on "c", unless
+// the returned timer is stopped first.
+func afterFunc(c clock, d time.Duration, f func()) *clockTimer {
+	t := &clockTimer{stopc: make(chan struct{})}
+
+	// Ask for the channel now, rather than in the goroutine, so that the
+	// time is measured from when afterFunc was called.
+	after := c.After(d)
+	go func() {
+		select {
+		case <-after:
+			if t.finish() {
+				f()
+			}
+		case <-t.stopc:
+		}
+	}()
+
+	return t
+}
+
+// Stop prevents the function from being called, if it hasn't been already. It
+// returns false if the function has been called, or the timer was already
+// stopped.
+func (t *clockTimer) Stop() bool {
+	if !t.finish() {
+		return false
+	}
+
+	close(t.stopc)
+	return true
+}
+
+// finish marks the timer as done, returning false if it already was.
+func (t *clockTimer) finish() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.done {
+		return false
+	}
+	t.done = true
+	return true
+}
@@ -0,0 +1,113 @@
+package lfs
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a clock which only moves forward when Advance is called.
+type fakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	c := &fakeClock{now: time.Date(2016, 11, 1, 12, 0, 0, 0, time.UTC)}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := &fakeWaiter{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.c <- c.now
+		return w.c
+	}
+
+	c.waiters = append(c.waiters, w)
+	c.cond.Broadcast()
+	return w.c
+}
+
+// Advance moves the clock forward by "d", firing the channels of those waiting
+// for a time which has now passed.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiting = append(waiting, w)
+		} else {
+			w.c <- c.now
+		}
+	}
+	c.waiters = waiting
+}
+
+// BlockUntilWaiting blocks until at least "n" channels from After are waiting
+// for a time which hasn't passed yet.
+func (c *fakeClock) BlockUntilWaiting(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+func TestAfterFuncCallsFuncOnceTimePasses(t *testing.T) {
+	c := newFakeClock()
+	called := make(chan struct{})
+	timer := afterFunc(c, time.Minute, func() { close(called) })
+
+	c.Advance(59 * time.Second)
+	select {
+	case <-called:
+		t.Fatal("expected the func to wait for a minute to pass")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	c.Advance(time.Second)
+	<-called
+	assert.False(t, timer.Stop())
+}
+
+func TestAfterFuncStop(t *testing.T) {
+	c := newFakeClock()
+	called := make(chan struct{})
+	timer := afterFunc(c, time.Minute, func() { close(called) })
+
+	assert.True(t, timer.Stop())
+	assert.False(t, timer.Stop())
+
+	c.Advance(time.Hour)
+	select {
+	case <-called:
+		t.Fatal("expected the func not to be called after Stop")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
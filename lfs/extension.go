@@ -9,9 +9,11 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
 
 	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/errors"
 )
 
 type pipeRequest struct {
@@ -40,7 +42,89 @@ type extCommand struct {
 	result *pipeExtResult
 }
 
+// cleanExtensions pipes the content of "reader" through the clean commands of
+// "exts", in the order given, which is ascending priority. It returns the temp
+// file holding the final content, its oid and size, and the pointer
+// extensions of the commands which changed the content, numbered in the order
+// they ran. Commands which pass the content through unchanged are left out of
+// the pointer, so they don't have to run on smudge.
+func cleanExtensions(reader io.Reader, fileName string, exts []config.Extension) (oid string, size int64, tmp *os.File, pexts []*PointerExtension, err error) {
+	request := &pipeRequest{"clean", reader, fileName, exts}
+
+	response, err := pipeExtensions(request)
+	if err != nil {
+		return
+	}
+
+	tmp = response.file
+	oid = response.results[len(response.results)-1].oidOut
+
+	stat, err := os.Stat(tmp.Name())
+	if err != nil {
+		os.Remove(tmp.Name())
+		tmp = nil
+		return
+	}
+	size = stat.Size()
+
+	for _, result := range response.results {
+		if result.oidIn != result.oidOut {
+			pexts = append(pexts, NewPointerExtension(result.name, len(pexts), result.oidIn))
+		}
+	}
+	return
+}
+
+// smudgeExtensions undoes the extensions recorded in "ptr" on the object read
+// from "reader", by piping it through their smudge commands from "registered"
+// in reverse order. The output of each command must hash to the oid its
+// extension recorded on clean. It returns the temp file holding the smudged
+// content, which the caller removes.
+func smudgeExtensions(reader io.Reader, workingfile string, ptr *Pointer, registered map[string]config.Extension) (*os.File, error) {
+	ptrExts := make([]*PointerExtension, len(ptr.Extensions))
+	copy(ptrExts, ptr.Extensions)
+	sort.Sort(sort.Reverse(ByPriority(ptrExts)))
+
+	exts := make([]config.Extension, 0, len(ptrExts))
+	for _, ptrExt := range ptrExts {
+		ext, ok := registered[ptrExt.Name]
+		if !ok {
+			return nil, fmt.Errorf("Extension '%s' is not configured, but is needed to smudge %s.", ptrExt.Name, workingfile)
+		}
+		exts = append(exts, ext)
+	}
+
+	request := &pipeRequest{"smudge", reader, workingfile, exts}
+
+	response, err := pipeExtensions(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if oid := response.results[0].oidIn; oid != ptr.Oid {
+		os.Remove(response.file.Name())
+		return nil, fmt.Errorf("Actual oid %s during smudge does not match expected %s", oid, ptr.Oid)
+	}
+
+	// Check each stage in the order it ran, so that an extension which
+	// failed to undo its changes is named rather than the ones after it.
+	for i, result := range response.results {
+		expected := ptrExts[i]
+		if result.oidOut != expected.Oid {
+			os.Remove(response.file.Name())
+			return nil, fmt.Errorf("Actual oid %s for extension '%s' does not match expected %s", result.oidOut, expected.Name, expected.Oid)
+		}
+	}
+
+	return response.file, nil
+}
+
 func pipeExtensions(request *pipeRequest) (response pipeResponse, err error) {
+	if len(request.extensions) == 0 {
+		err = errors.New("No extensions to " + request.action + " with")
+		return
+	}
+
 	var extcmds []*extCommand
 	for _, e := range request.extensions {
 		var pieces []string
@@ -61,21 +145,32 @@ func pipeExtensions(request *pipeRequest) (response pipeResponse, err error) {
 		}
 		cmd := exec.Command(name, args...)
 		ec := &extCommand{cmd: cmd, result: &pipeExtResult{name: e.Name}}
+		ec.err = &bytes.Buffer{}
+		ec.cmd.Stderr = ec.err
 		extcmds = append(extcmds, ec)
 	}
 
+	// Writing to a pipe from StdinPipe fails once the first command has
+	// exited, rather than blocking.
 	hasher := sha256.New()
-	pipeReader, pipeWriter := io.Pipe()
-	multiWriter := io.MultiWriter(hasher, pipeWriter)
+	var stdin io.WriteCloser
+	if stdin, err = extcmds[0].cmd.StdinPipe(); err != nil {
+		return
+	}
+	multiWriter := io.MultiWriter(hasher, stdin)
 
 	var input io.Reader
 	var output io.WriteCloser
-	input = pipeReader
-	extcmds[0].cmd.Stdin = input
 	if response.file, err = TempFile(""); err != nil {
 		return
 	}
 	defer response.file.Close()
+	defer func() {
+		if err != nil {
+			os.Remove(response.file.Name())
+			response.file = nil
+		}
+	}()
 	output = response.file
 
 	last := len(extcmds) - 1
@@ -98,42 +193,61 @@ func pipeExtensions(request *pipeRequest) (response pipeResponse, err error) {
 			return
 		}
 
-		ec.cmd.Stdin = input
+		if input != nil {
+			ec.cmd.Stdin = input
+		}
 		ec.cmd.Stdout = io.MultiWriter(ec.hasher, nextStdin)
 		ec.out = nextStdin
 
 		input = stdout
-
-		var errBuff bytes.Buffer
-		ec.err = &errBuff
-		ec.cmd.Stderr = ec.err
 	}
 
-	for _, ec := range extcmds {
+	for i, ec := range extcmds {
 		if err = ec.cmd.Start(); err != nil {
+			err = fmt.Errorf("Extension '%s' failed to start: %s", ec.result.name, err)
+			for _, started := range extcmds[:i] {
+				started.cmd.Process.Kill()
+				started.cmd.Wait()
+			}
 			return
 		}
 	}
 
-	if _, err = io.Copy(multiWriter, request.reader); err != nil {
-		return
-	}
-	if err = pipeWriter.Close(); err != nil {
-		return
+	_, copyErr := io.Copy(multiWriter, request.reader)
+	if cerr := stdin.Close(); copyErr == nil {
+		copyErr = cerr
 	}
 
+	// Wait for every command, even after one fails, so that the ones after
+	// it see the end of their input and exit. A command which explained its
+	// failure on stderr is named over one which only failed to write to it.
+	explained := false
 	for _, ec := range extcmds {
-		if err = ec.cmd.Wait(); err != nil {
-			if ec.err != nil {
-				errStr := ec.err.String()
-				err = fmt.Errorf("Extension '%s' failed with: %s", ec.result.name, errStr)
-			}
-			return
+		werr := ec.cmd.Wait()
+		cerr := ec.out.Close()
+		if explained {
+			continue
 		}
-		if err = ec.out.Close(); err != nil {
-			return
+		if werr != nil {
+			msg := strings.TrimSpace(ec.err.String())
+			if len(msg) > 0 {
+				explained = true
+			} else if err != nil {
+				continue
+			} else {
+				msg = werr.Error()
+			}
+			err = fmt.Errorf("Extension '%s' failed with: %s", ec.result.name, msg)
+		} else if err == nil && cerr != nil {
+			err = cerr
 		}
 	}
+	if err == nil {
+		err = copyErr
+	}
+	if err != nil {
+		return
+	}
 
 	oid := hex.EncodeToString(hasher.Sum(nil))
 	for _, ec := range extcmds {
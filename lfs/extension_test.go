@@ -0,0 +1,174 @@
+package lfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/github/git-lfs/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	// rot13Ext and base64Ext are dummy extensions, which are stacked to test
+	// the order extensions are applied and undone in.
+	rot13Ext = config.Extension{
+		Name:   "rot13",
+		Clean:  "tr A-Za-z N-ZA-Mn-za-m",
+		Smudge: "tr A-Za-z N-ZA-Mn-za-m",
+	}
+	base64Ext = config.Extension{
+		Name:   "base64",
+		Clean:  "base64",
+		Smudge: "base64 -d",
+	}
+
+	extContent = []byte("Hello, stacked extensions.\n")
+)
+
+func extOid(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// cleanStacked cleans extContent with rot13Ext and base64Ext, in that order.
+func cleanStacked(t *testing.T) (*Pointer, *os.File) {
+	rot13, b64 := rot13Ext, base64Ext
+	rot13.Priority, b64.Priority = 0, 1
+
+	oid, size, tmp, exts, err := cleanExtensions(bytes.NewReader(extContent), "a.txt", []config.Extension{rot13, b64})
+	require.Nil(t, err)
+	return NewPointer(oid, size, exts), tmp
+}
+
+func TestCleanExtensionsAppliesInOrder(t *testing.T) {
+	defer useTempDir(t)()
+
+	ptr, tmp := cleanStacked(t)
+	defer os.Remove(tmp.Name())
+
+	rotated := []byte("Uryyb, fgnpxrq rkgrafvbaf.\n")
+	encoded := []byte(base64.StdEncoding.EncodeToString(rotated) + "\n")
+
+	stored, err := ioutil.ReadFile(tmp.Name())
+	require.Nil(t, err)
+	assert.Equal(t, string(encoded), string(stored))
+
+	assert.Equal(t, extOid(encoded), ptr.Oid)
+	assert.Equal(t, int64(len(encoded)), ptr.Size)
+	assert.Equal(t, []*PointerExtension{
+		NewPointerExtension("rot13", 0, extOid(extContent)),
+		NewPointerExtension("base64", 1, extOid(rotated)),
+	}, ptr.Extensions)
+}
+
+func TestCleanExtensionsSkipsPassThrough(t *testing.T) {
+	defer useTempDir(t)()
+
+	cat := config.Extension{Name: "cat", Clean: "cat", Smudge: "cat", Priority: 0}
+	b64 := base64Ext
+	b64.Priority = 1
+
+	_, _, tmp, exts, err := cleanExtensions(bytes.NewReader(extContent), "a.txt", []config.Extension{cat, b64})
+	require.Nil(t, err)
+	defer os.Remove(tmp.Name())
+
+	assert.Equal(t, []*PointerExtension{
+		NewPointerExtension("base64", 0, extOid(extContent)),
+	}, exts)
+}
+
+func TestSmudgeExtensionsRoundTrip(t *testing.T) {
+	defer useTempDir(t)()
+
+	ptr, tmp := cleanStacked(t)
+	defer os.Remove(tmp.Name())
+
+	object, err := os.Open(tmp.Name())
+	require.Nil(t, err)
+	defer object.Close()
+
+	smudged, err := smudgeExtensions(object, "a.txt", ptr, map[string]config.Extension{
+		"rot13":  rot13Ext,
+		"base64": base64Ext,
+	})
+	require.Nil(t, err)
+	defer os.Remove(smudged.Name())
+
+	content, err := ioutil.ReadFile(smudged.Name())
+	require.Nil(t, err)
+	assert.Equal(t, string(extContent), string(content))
+}
+
+func TestSmudgeExtensionsNamesMissingExtension(t *testing.T) {
+	defer useTempDir(t)()
+
+	ptr, tmp := cleanStacked(t)
+	defer os.Remove(tmp.Name())
+
+	object, err := os.Open(tmp.Name())
+	require.Nil(t, err)
+	defer object.Close()
+
+	_, err = smudgeExtensions(object, "a.txt", ptr, map[string]config.Extension{
+		"base64": base64Ext,
+	})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "Extension 'rot13' is not configured, but is needed to smudge a.txt.", err.Error())
+	}
+}
+
+func TestSmudgeExtensionsVerifiesEachStage(t *testing.T) {
+	defer useTempDir(t)()
+
+	ptr, tmp := cleanStacked(t)
+	defer os.Remove(tmp.Name())
+
+	object, err := os.Open(tmp.Name())
+	require.Nil(t, err)
+	defer object.Close()
+
+	// base64 runs first on smudge, so it is the one named when it doesn't
+	// undo its changes, even though rot13 can't match after it.
+	broken := base64Ext
+	broken.Smudge = "cat"
+
+	_, err = smudgeExtensions(object, "a.txt", ptr, map[string]config.Extension{
+		"rot13":  rot13Ext,
+		"base64": broken,
+	})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "for extension 'base64' does not match")
+	}
+}
+
+func TestPipeExtensionsNamesFailingExtension(t *testing.T) {
+	defer useTempDir(t)()
+
+	failing := config.Extension{Name: "failing", Clean: "base64 --no-such-option"}
+	missing := config.Extension{Name: "missing", Clean: "git-lfs-no-such-extension"}
+
+	for _, exts := range [][]config.Extension{
+		{rot13Ext, failing},
+		{failing, rot13Ext},
+		{missing},
+	} {
+		name := exts[len(exts)-1].Name
+		if exts[0].Name == "failing" {
+			name = "failing"
+		}
+
+		// Give more input than fits in a pipe, so that it can't all be
+		// written before the failing command exits.
+		input := bytes.Repeat(extContent, 1024*1024/len(extContent))
+		_, err := pipeExtensions(&pipeRequest{"clean", bytes.NewReader(input), "a.txt", exts})
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "Extension '"+name+"' failed")
+		}
+	}
+}
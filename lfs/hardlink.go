@@ -0,0 +1,97 @@
+package lfs
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/rubyist/tracerx"
+)
+
+var (
+	// hardLink creates dst as a hard link to src. It is a variable so that
+	// tests can simulate filesystems which do not support hard links.
+	hardLink = os.Link
+
+	// linkedFileMode is the mode given to working tree files which are hard
+	// linked to the object store. They are read-only, because writing to
+	// them would modify the stored object as well.
+	linkedFileMode os.FileMode = 0444
+)
+
+// linkWorkingFile populates the working tree file "filename" with the contents
+// of the object at "mediafile". When both are on the same filesystem the file
+// is hard linked and marked read-only, otherwise the contents are copied.
+// The returned bool reports whether a link was made.
+func linkWorkingFile(mediafile, filename string) (bool, error) {
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	if err := hardLink(mediafile, filename); err != nil {
+		tracerx.Printf("lfs: unable to hard link %q to %q, copying instead: %v", filename, mediafile, err)
+		return false, copyWorkingFile(mediafile, filename)
+	}
+
+	return true, os.Chmod(filename, linkedFileMode)
+}
+
+// copyWorkingFile writes a private copy of "src" to "dst".
+func copyWorkingFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// isHardLinked returns whether "filename" shares its storage with another
+// file, such as an object it was linked to by lfs.hardlinkcheckout, whichever
+// object that is.
+func isHardLinked(filename string) bool {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return false
+	}
+	return hasOtherLinks(fi)
+}
+
+// BreakHardLink replaces "filename" with a writable copy of itself, so that it
+// no longer shares storage with an object in the local store. Call this before
+// modifying a file which may have been checked out with lfs.hardlinkcheckout.
+func BreakHardLink(filename string) error {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	// Create the copy alongside the original so that it can be renamed over it.
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".lfs-hardlink")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := copyWorkingFile(filename, tmp.Name()); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), fi.Mode()|0200); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
@@ -0,0 +1,15 @@
+// +build !windows
+
+package lfs
+
+import (
+	"os"
+	"syscall"
+)
+
+// hasOtherLinks returns whether the file described by "fi" has more than one
+// hard link.
+func hasOtherLinks(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && st.Nlink > 1
+}
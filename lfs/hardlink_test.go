@@ -0,0 +1,94 @@
+package lfs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupHardLinkTest(t *testing.T) (dir, mediafile, filename string) {
+	dir, err := ioutil.TempDir("", "lfs-hardlink")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mediafile = filepath.Join(dir, "object")
+	if err := ioutil.WriteFile(mediafile, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	filename = filepath.Join(dir, "file.dat")
+	if err := ioutil.WriteFile(filename, []byte("pointer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, mediafile, filename
+}
+
+func TestLinkWorkingFileCreatesReadOnlyLink(t *testing.T) {
+	dir, mediafile, filename := setupHardLinkTest(t)
+	defer os.RemoveAll(dir)
+
+	linked, err := linkWorkingFile(mediafile, filename)
+	assert.Nil(t, err)
+	assert.True(t, linked)
+
+	fi, err := os.Stat(filename)
+	assert.Nil(t, err)
+	mi, err := os.Stat(mediafile)
+	assert.Nil(t, err)
+
+	assert.True(t, os.SameFile(fi, mi))
+	assert.Equal(t, linkedFileMode, fi.Mode().Perm())
+}
+
+func TestLinkWorkingFileFallsBackToCopy(t *testing.T) {
+	dir, mediafile, filename := setupHardLinkTest(t)
+	defer os.RemoveAll(dir)
+
+	hardLink = func(src, dst string) error {
+		return &os.LinkError{Op: "link", Old: src, New: dst, Err: errors.New("cross-device link")}
+	}
+	defer func() { hardLink = os.Link }()
+
+	linked, err := linkWorkingFile(mediafile, filename)
+	assert.Nil(t, err)
+	assert.False(t, linked)
+
+	fi, err := os.Stat(filename)
+	assert.Nil(t, err)
+	mi, err := os.Stat(mediafile)
+	assert.Nil(t, err)
+
+	assert.False(t, os.SameFile(fi, mi))
+	assert.NotEqual(t, 0, int(fi.Mode().Perm()&0200), "copied file should be writable")
+
+	by, err := ioutil.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, "content", string(by))
+}
+
+func TestBreakHardLink(t *testing.T) {
+	dir, mediafile, filename := setupHardLinkTest(t)
+	defer os.RemoveAll(dir)
+
+	_, err := linkWorkingFile(mediafile, filename)
+	assert.Nil(t, err)
+
+	assert.Nil(t, BreakHardLink(filename))
+	assert.Nil(t, ioutil.WriteFile(filename, []byte("edited"), 0644))
+
+	fi, err := os.Stat(filename)
+	assert.Nil(t, err)
+	mi, err := os.Stat(mediafile)
+	assert.Nil(t, err)
+	assert.False(t, os.SameFile(fi, mi))
+
+	by, err := ioutil.ReadFile(mediafile)
+	assert.Nil(t, err)
+	assert.Equal(t, "content", string(by))
+}
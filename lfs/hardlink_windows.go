@@ -0,0 +1,12 @@
+// +build windows
+
+package lfs
+
+import "os"
+
+// hasOtherLinks returns whether the file described by "fi" may have more than
+// one hard link. FileInfo doesn't carry the link count on Windows, so every
+// read-only file is assumed to be linked, as linkWorkingFile leaves them.
+func hasOtherLinks(fi os.FileInfo) bool {
+	return fi.Mode().Perm()&0200 == 0
+}
@@ -0,0 +1,119 @@
+package lfs
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/github/git-lfs/api"
+)
+
+// hostLimiter limits how many objects are transferred to or from each host at
+// once, as given by lfs.transfer.maxperhost, so that a batch whose actions
+// point at several storage hosts doesn't overwhelm any one of them. A nil
+// hostLimiter doesn't limit anything.
+type hostLimiter struct {
+	limit int
+
+	mu    sync.Mutex
+	slots map[string]chan struct{} // a semaphore for each host
+	held  map[string]string        // the host each OID holds a slot for
+}
+
+// newHostLimiter returns a hostLimiter allowing "limit" transfers for each
+// host, or nil if "limit" is zero or less.
+func newHostLimiter(limit int) *hostLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &hostLimiter{
+		limit: limit,
+		slots: make(map[string]chan struct{}),
+		held:  make(map[string]string),
+	}
+}
+
+// TryAcquire takes a slot on "host" for the object "oid" if one is free,
+// returning whether it did.
+func (l *hostLimiter) TryAcquire(oid, host string) bool {
+	if l == nil {
+		return true
+	}
+
+	select {
+	case l.semaphore(host) <- struct{}{}:
+		l.hold(oid, host)
+		return true
+	default:
+		return false
+	}
+}
+
+// Acquire waits for a slot on "host" for the object "oid", returning false
+// without one if "cancel" is closed first.
+func (l *hostLimiter) Acquire(oid, host string, cancel <-chan struct{}) bool {
+	if l == nil {
+		return true
+	}
+
+	select {
+	case l.semaphore(host) <- struct{}{}:
+		l.hold(oid, host)
+		return true
+	case <-cancel:
+		return false
+	}
+}
+
+// Release frees the slot held for the object "oid", if there is one, so it is
+// safe to call whenever a transfer of "oid" ends.
+func (l *hostLimiter) Release(oid string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	host, ok := l.held[oid]
+	delete(l.held, oid)
+	sem := l.slots[host]
+	l.mu.Unlock()
+
+	if ok {
+		<-sem
+	}
+}
+
+func (l *hostLimiter) semaphore(host string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sem, ok := l.slots[host]
+	if !ok {
+		sem = make(chan struct{}, l.limit)
+		l.slots[host] = sem
+	}
+	return sem
+}
+
+func (l *hostLimiter) hold(oid, host string) {
+	l.mu.Lock()
+	l.held[oid] = host
+	l.mu.Unlock()
+}
+
+// objectHost returns the host name of the "rel" action of "o", in lower case,
+// or an empty string if it has no such action or its URL can't be parsed.
+func objectHost(o *api.ObjectResource, rel string) string {
+	if o == nil {
+		return ""
+	}
+	link, ok := o.Rel(rel)
+	if !ok {
+		return ""
+	}
+	u, err := url.Parse(link.Href)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
@@ -0,0 +1,45 @@
+package lfs
+
+import (
+	"testing"
+
+	"github.com/github/git-lfs/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostLimiter(t *testing.T) {
+	l := newHostLimiter(1)
+
+	assert.True(t, l.TryAcquire(oidA, "a.example.com"))
+	assert.False(t, l.TryAcquire(oidB, "a.example.com"))
+	assert.True(t, l.TryAcquire(oidC, "c.example.com"))
+
+	cancel := make(chan struct{})
+	close(cancel)
+	assert.False(t, l.Acquire(oidB, "a.example.com", cancel))
+
+	l.Release(oidA)
+	l.Release(oidA)
+	assert.True(t, l.Acquire(oidB, "a.example.com", nil))
+	assert.False(t, l.TryAcquire(oidA, "a.example.com"))
+}
+
+func TestHostLimiterWithoutLimit(t *testing.T) {
+	l := newHostLimiter(0)
+	assert.Nil(t, l)
+
+	assert.True(t, l.TryAcquire(oidA, "a.example.com"))
+	assert.True(t, l.TryAcquire(oidB, "a.example.com"))
+	l.Release(oidA)
+}
+
+func TestObjectHost(t *testing.T) {
+	o := &api.ObjectResource{
+		Oid:     oidA,
+		Actions: map[string]*api.LinkRelation{"download": {Href: "https://Storage.Example.com:8443/" + oidA}},
+	}
+
+	assert.Equal(t, "storage.example.com", objectHost(o, "download"))
+	assert.Equal(t, "", objectHost(o, "upload"))
+	assert.Equal(t, "", objectHost(nil, "download"))
+}
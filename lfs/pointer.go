@@ -3,8 +3,11 @@ package lfs
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"regexp"
 	"sort"
@@ -121,6 +124,75 @@ func DecodeFrom(reader io.Reader) ([]byte, *Pointer, error) {
 	return output, p, err
 }
 
+// CheckPointer returns the pointer in "data" if it is a valid pointer written
+// in canonical form, as the clean filter writes it, or an error describing
+// the first problem found. Pointers using the versions of Git LFS's pre-release
+// specifications are valid too. An empty file is the pointer for an empty
+// file. If "strict" is false, Windows line endings and a missing newline at
+// the end are allowed.
+func CheckPointer(data []byte, strict bool) (*Pointer, error) {
+	if len(data) > blobSizeCutoff {
+		return nil, errors.NewNotAPointerError(errors.New("file size exceeds lfs pointer size cutoff"))
+	}
+	if len(data) == 0 {
+		return NewPointer(hex.EncodeToString(sha256.New().Sum(nil)), 0, nil), nil
+	}
+
+	if strict {
+		if bytes.Contains(data, []byte("\r")) {
+			return nil, errors.New("Windows line endings")
+		}
+		if data[len(data)-1] != '\n' {
+			return nil, errors.New("Missing newline at end of file")
+		}
+	} else {
+		data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+		if data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+	}
+
+	p, err := decodeKV(data)
+	if err != nil {
+		return nil, err
+	}
+	if !ValidOid(p.Oid) {
+		return nil, errors.New("Invalid Oid: " + p.Oid)
+	}
+
+	// The decoder allows extensions in any order, and a few other
+	// variations, so compare each line with the pointer as it is encoded.
+	// The first line is the version, which has been checked already.
+	lines := strings.SplitAfter(string(data), "\n")
+	expected := strings.SplitAfter(p.Encoded(), "\n")
+	if len(lines) != len(expected) {
+		return nil, fmt.Errorf("Expected %d lines, got %d", len(expected)-1, len(lines)-1)
+	}
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != expected[i] {
+			return nil, fmt.Errorf("Line %d is %q, expected %q", i+1, strings.TrimSuffix(lines[i], "\n"), strings.TrimSuffix(expected[i], "\n"))
+		}
+	}
+
+	return p, nil
+}
+
+// CheckPointerFile is CheckPointer for the contents of "file", without reading
+// more of it than a pointer could have.
+func CheckPointerFile(file string, strict bool) (*Pointer, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(f, blobSizeCutoff+1))
+	if err != nil {
+		return nil, err
+	}
+	return CheckPointer(data, strict)
+}
+
 func verifyVersion(version string) error {
 	if len(version) == 0 {
 		return errors.NewNotAPointerError(errors.New("Missing version"))
@@ -197,6 +269,20 @@ func parseOid(value string) (string, error) {
 	return oid, nil
 }
 
+// ValidOid returns whether "oid" is a SHA-256 in lowercase hex, as all of
+// the OIDs Git LFS transfers are.
+func ValidOid(oid string) bool {
+	if len(oid) != 64 {
+		return false
+	}
+	for _, c := range oid {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
 func parsePointerExtension(key string, value string) (*PointerExtension, error) {
 	keyParts := strings.SplitN(key, "-", 3)
 	if len(keyParts) != 3 || keyParts[0] != "ext" {
@@ -220,11 +306,17 @@ func parsePointerExtension(key string, value string) (*PointerExtension, error)
 
 func validatePointerExtensions(exts []*PointerExtension) error {
 	m := make(map[int]struct{})
+	names := make(map[string]struct{})
 	for _, ext := range exts {
 		if _, exist := m[ext.Priority]; exist {
 			return fmt.Errorf("Duplicate priority found: %d", ext.Priority)
 		}
 		m[ext.Priority] = struct{}{}
+
+		if _, exist := names[ext.Name]; exist {
+			return fmt.Errorf("Duplicate extension found: %s", ext.Name)
+		}
+		names[ext.Name] = struct{}{}
 	}
 	return nil
 }
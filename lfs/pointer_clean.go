@@ -9,15 +9,27 @@ import (
 
 	"github.com/github/git-lfs/config"
 	"github.com/github/git-lfs/errors"
+	"github.com/github/git-lfs/git"
 	"github.com/github/git-lfs/progress"
 	"github.com/github/git-lfs/tools"
+	"github.com/rubyist/tracerx"
 )
 
 type cleanedAsset struct {
+	// Filename is the temp file holding the cleaned content, or empty if
+	// the content matched an object which is already stored.
 	Filename string
 	*Pointer
 }
 
+// cleanCandidate is an object which is already stored, and which the content
+// being cleaned is expected to match.
+type cleanCandidate struct {
+	oid  string
+	size int64
+	path string
+}
+
 func PointerClean(reader io.Reader, fileName string, fileSize int64, cb progress.CopyCallback) (*cleanedAsset, error) {
 	extensions, err := config.Config.SortedExtensions()
 	if err != nil {
@@ -29,49 +41,61 @@ func PointerClean(reader io.Reader, fileName string, fileSize int64, cb progress
 	var tmp *os.File
 	var exts []*PointerExtension
 	if len(extensions) > 0 {
-		request := &pipeRequest{"clean", reader, fileName, extensions}
-
-		var response pipeResponse
-		if response, err = pipeExtensions(request); err != nil {
-			return nil, err
+		var by []byte
+		var ptr *Pointer
+		if by, ptr, err = DecodeFrom(reader); err == nil && len(by) < 512 {
+			return nil, errors.NewCleanPointerError(ptr, by)
 		}
 
-		oid = response.results[len(response.results)-1].oidOut
-		tmp = response.file
-		var stat os.FileInfo
-		if stat, err = os.Stat(tmp.Name()); err != nil {
+		multi := io.MultiReader(bytes.NewReader(by), reader)
+		oid, size, tmp, exts, err = cleanExtensions(multi, fileName, extensions)
+		if err != nil {
 			return nil, err
 		}
-		size = stat.Size()
-
-		for _, result := range response.results {
-			if result.oidIn != result.oidOut {
-				ext := NewPointerExtension(result.name, len(exts), result.oidIn)
-				exts = append(exts, ext)
-			}
-		}
 	} else {
-		oid, size, tmp, err = copyToTemp(reader, fileSize, cb)
+		oid, size, tmp, err = copyToTemp(reader, fileSize, cb, stagedCleanCandidate(fileName, fileSize))
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	pointer := NewPointer(oid, size, exts)
+	if tmp == nil {
+		return &cleanedAsset{"", pointer}, err
+	}
 	return &cleanedAsset{tmp.Name(), pointer}, err
 }
 
-func copyToTemp(reader io.Reader, fileSize int64, cb progress.CopyCallback) (oid string, size int64, tmp *os.File, err error) {
-	tmp, err = TempFile("")
-	if err != nil {
-		return
+// stagedCleanCandidate returns the object of the pointer staged for
+// "fileName", if the file is large and that object is stored with the same
+// size, so that re-adding an unchanged file doesn't copy it again.
+func stagedCleanCandidate(fileName string, fileSize int64) *cleanCandidate {
+	if len(fileName) == 0 || fileSize < int64(LargeSizeThreshold) {
+		return nil
 	}
 
-	defer tmp.Close()
+	by, err := git.StagedBlob(fileName, blobSizeCutoff)
+	if err != nil || by == nil {
+		return nil
+	}
 
-	oidHash := sha256.New()
-	writer := io.MultiWriter(oidHash, tmp)
+	ptr, err := DecodePointer(bytes.NewReader(by))
+	if err != nil || ptr.Size != fileSize || len(ptr.Extensions) > 0 {
+		return nil
+	}
 
+	if !ObjectExistsOfSize(ptr.Oid, ptr.Size) {
+		return nil
+	}
+
+	return &cleanCandidate{oid: ptr.Oid, size: ptr.Size, path: LocalMediaPathReadOnly(ptr.Oid)}
+}
+
+// copyToTemp hashes the content of "reader" while copying it to a temp file.
+// If the content matches "candidate" whole, nothing is copied and the temp
+// file is nil. Content which is a pointer isn't copied either, returning a
+// CleanPointerError.
+func copyToTemp(reader io.Reader, fileSize int64, cb progress.CopyCallback, candidate *cleanCandidate) (oid string, size int64, tmp *os.File, err error) {
 	if fileSize == 0 {
 		cb = nil
 	}
@@ -82,17 +106,155 @@ func copyToTemp(reader io.Reader, fileSize int64, cb progress.CopyCallback) (oid
 		return
 	}
 
+	oidHash := sha256.New()
+	openTemp := func() (io.Writer, error) {
+		var err error
+		if tmp, err = TempFile(""); err != nil {
+			return nil, err
+		}
+		return io.MultiWriter(oidHash, tmp), nil
+	}
+	defer func() {
+		if tmp != nil {
+			tmp.Close()
+		}
+	}()
+
+	var writer io.Writer
+	var matcher *objectMatcher
+	if candidate != nil {
+		if matcher, err = newObjectMatcher(candidate.path, candidate.size, openTemp); err != nil {
+			tracerx.Printf("clean: unable to compare with %s: %s", candidate.oid, err)
+			matcher = nil
+		}
+	}
+	if matcher != nil {
+		defer matcher.Close()
+		writer = matcher
+	} else if writer, err = openTemp(); err != nil {
+		return
+	}
+
 	multi := io.MultiReader(bytes.NewReader(by), reader)
 	size, err = tools.CopyWithCallback(writer, multi, fileSize, cb)
-
 	if err != nil {
 		return
 	}
 
+	if matcher != nil {
+		var matched bool
+		if matched, err = matcher.Finish(); err != nil {
+			return
+		}
+		if matched {
+			tracerx.Printf("clean: content matches %s", candidate.oid)
+			oid = candidate.oid
+			return
+		}
+	}
+
 	oid = hex.EncodeToString(oidHash.Sum(nil))
 	return
 }
 
 func (a *cleanedAsset) Teardown() error {
+	if len(a.Filename) == 0 {
+		return nil
+	}
 	return os.Remove(a.Filename)
 }
+
+// objectMatcher is an io.Writer which compares what is written to it with a
+// stored object, without hashing or copying it. Once they differ, it calls
+// diverge for the writer to copy to instead, writes the content which matched
+// so far to that, and passes everything else through.
+type objectMatcher struct {
+	object  *os.File
+	size    int64
+	matched int64
+	buf     []byte
+	diverge func() (io.Writer, error)
+	w       io.Writer
+}
+
+func newObjectMatcher(path string, size int64, diverge func() (io.Writer, error)) (*objectMatcher, error) {
+	object, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &objectMatcher{
+		object:  object,
+		size:    size,
+		buf:     make([]byte, 32*1024),
+		diverge: diverge,
+	}, nil
+}
+
+func (m *objectMatcher) Write(p []byte) (int, error) {
+	if m.w != nil {
+		return m.w.Write(p)
+	}
+
+	n := len(p)
+	for len(p) > 0 && m.matched < m.size {
+		chunk := p
+		if len(chunk) > len(m.buf) {
+			chunk = chunk[:len(m.buf)]
+		}
+		if left := m.size - m.matched; int64(len(chunk)) > left {
+			chunk = chunk[:left]
+		}
+
+		read, err := io.ReadFull(m.object, m.buf[:len(chunk)])
+		if err != nil || !bytes.Equal(m.buf[:read], chunk) {
+			break
+		}
+		m.matched += int64(len(chunk))
+		p = p[len(chunk):]
+	}
+
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	if err := m.divert(); err != nil {
+		return 0, err
+	}
+	if _, err := m.w.Write(p); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Finish returns whether everything written matched the whole object. If not,
+// it makes sure the content has been written to the diverged writer.
+func (m *objectMatcher) Finish() (bool, error) {
+	if m.w != nil {
+		return false, nil
+	}
+	if m.matched == m.size {
+		return true, nil
+	}
+	return false, m.divert()
+}
+
+func (m *objectMatcher) Close() error {
+	return m.object.Close()
+}
+
+func (m *objectMatcher) divert() error {
+	w, err := m.diverge()
+	if err != nil {
+		return err
+	}
+
+	if _, err := m.object.Seek(0, os.SEEK_SET); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, m.object, m.matched); err != nil {
+		return err
+	}
+
+	m.w = w
+	return nil
+}
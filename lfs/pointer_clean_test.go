@@ -0,0 +1,159 @@
+package lfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/github/git-lfs/errors"
+	"github.com/github/git-lfs/localstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTempDir makes TempFile create files in a new directory, rather than in
+// whichever repository the last test to resolve one used, which may have been
+// removed since. It returns a func which removes the directory again.
+func useTempDir(tb testing.TB) func() {
+	dir, err := ioutil.TempDir("", "lfs-tmp")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	old := localstorage.TempDir
+	localstorage.TempDir = dir
+	return func() {
+		localstorage.TempDir = old
+		os.RemoveAll(dir)
+	}
+}
+
+// cleanObject writes "content" to a file in "dir", returning it as a
+// candidate for copyToTemp.
+func cleanObject(t *testing.T, dir string, content []byte) *cleanCandidate {
+	sum := sha256.Sum256(content)
+	oid := hex.EncodeToString(sum[:])
+	path := filepath.Join(dir, oid)
+	require.Nil(t, ioutil.WriteFile(path, content, 0644))
+	return &cleanCandidate{oid: oid, size: int64(len(content)), path: path}
+}
+
+func cleanContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	return content
+}
+
+func TestCopyToTempSkipsMatchingObject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pointer-clean")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	content := cleanContent(100 * 1024)
+	candidate := cleanObject(t, dir, content)
+
+	oid, size, tmp, err := copyToTemp(bytes.NewReader(content), int64(len(content)), nil, candidate)
+	require.Nil(t, err)
+	assert.Nil(t, tmp)
+	assert.Equal(t, candidate.oid, oid)
+	assert.Equal(t, int64(len(content)), size)
+}
+
+func TestCopyToTempCopiesChangedContent(t *testing.T) {
+	defer useTempDir(t)()
+
+	dir, err := ioutil.TempDir("", "pointer-clean")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	content := cleanContent(100 * 1024)
+	candidate := cleanObject(t, dir, content)
+
+	changed := append([]byte{}, content...)
+	changed[70*1024] ^= 0xff
+
+	for desc, input := range map[string][]byte{
+		"changed": changed,
+		"longer":  append(append([]byte{}, content...), 'x'),
+		"shorter": content[:len(content)-1],
+	} {
+		expected := cleanObject(t, dir, input)
+
+		oid, size, tmp, err := copyToTemp(bytes.NewReader(input), int64(len(input)), nil, candidate)
+		require.Nil(t, err, desc)
+		require.NotNil(t, tmp, desc)
+		defer os.Remove(tmp.Name())
+
+		assert.Equal(t, expected.oid, oid, desc)
+		assert.Equal(t, int64(len(input)), size, desc)
+
+		copied, err := ioutil.ReadFile(tmp.Name())
+		require.Nil(t, err, desc)
+		assert.True(t, bytes.Equal(input, copied), desc)
+	}
+}
+
+func TestCopyToTempWithoutCandidate(t *testing.T) {
+	defer useTempDir(t)()
+
+	content := cleanContent(1024)
+
+	oid, size, tmp, err := copyToTemp(bytes.NewReader(content), int64(len(content)), nil, nil)
+	require.Nil(t, err)
+	require.NotNil(t, tmp)
+	defer os.Remove(tmp.Name())
+
+	sum := sha256.Sum256(content)
+	assert.Equal(t, hex.EncodeToString(sum[:]), oid)
+	assert.Equal(t, int64(len(content)), size)
+}
+
+func TestCopyToTempDoesNotCopyPointers(t *testing.T) {
+	ptr := NewPointer("4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393", 10, nil)
+
+	_, _, tmp, err := copyToTemp(bytes.NewReader([]byte(ptr.Encoded())), 0, nil, nil)
+	assert.True(t, errors.IsCleanPointerError(err))
+	assert.Nil(t, tmp)
+}
+
+func benchmarkCopyToTemp(b *testing.B, match bool) {
+	defer useTempDir(b)()
+
+	dir, err := ioutil.TempDir("", "pointer-clean")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := cleanContent(16 * 1024 * 1024)
+	path := filepath.Join(dir, "object")
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	var candidate *cleanCandidate
+	if match {
+		candidate = &cleanCandidate{oid: "object", size: int64(len(content)), path: path}
+	}
+
+	b.SetBytes(int64(len(content)))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_, _, tmp, err := copyToTemp(bytes.NewReader(content), int64(len(content)), nil, candidate)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if tmp != nil {
+			os.Remove(tmp.Name())
+		}
+	}
+}
+
+func BenchmarkCopyToTemp(b *testing.B)               { benchmarkCopyToTemp(b, false) }
+func BenchmarkCopyToTempMatchingObject(b *testing.B) { benchmarkCopyToTemp(b, true) }
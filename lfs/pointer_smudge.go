@@ -19,6 +19,27 @@ import (
 
 func PointerSmudgeToFile(filename string, ptr *Pointer, download bool, manifest *transfer.Manifest, cb progress.CopyCallback) error {
 	os.MkdirAll(filepath.Dir(filename), 0755)
+
+	if config.Config.HardLinkCheckout() && len(ptr.Extensions) == 0 {
+		LinkOrCopyFromReference(ptr.Oid, ptr.Size)
+		if ObjectExistsOfSize(ptr.Oid, ptr.Size) {
+			_, err := linkWorkingFile(LocalMediaPathReadOnly(ptr.Oid), filename)
+			if err != nil {
+				return fmt.Errorf("Could not write working directory file: %v", err)
+			}
+			return nil
+		}
+	}
+
+	// Truncating a file which is hard linked to an object, whether this one
+	// or the one it was checked out with before, would corrupt the object
+	// store, so remove the link first.
+	if isHardLinked(filename) {
+		if err := os.Remove(filename); err != nil {
+			return fmt.Errorf("Could not replace working directory file: %v", err)
+		}
+	}
+
 	file, err := os.Create(filename)
 	if err != nil {
 		return fmt.Errorf("Could not create working directory file: %v", err)
@@ -98,7 +119,7 @@ func downloadFile(writer io.Writer, ptr *Pointer, workingfile, mediafile string,
 	if err != nil {
 		return err
 	}
-	adapter.Add(transfer.NewTransfer(filepath.Base(workingfile), obj, mediafile))
+	adapter.Add(transfer.NewTransfer(filepath.Base(workingfile), obj, mediafile, transfer.ResumableDownloadOffset(obj)))
 	adapter.End()
 	res := <-adapterResultChan
 
@@ -123,62 +144,14 @@ func readLocalFile(writer io.Writer, ptr *Pointer, mediafile string, workingfile
 	}
 
 	if len(ptr.Extensions) > 0 {
-		registeredExts := config.Config.Extensions()
-		extensions := make(map[string]config.Extension)
-		for _, ptrExt := range ptr.Extensions {
-			ext, ok := registeredExts[ptrExt.Name]
-			if !ok {
-				err := fmt.Errorf("Extension '%s' is not configured.", ptrExt.Name)
-				return errors.Wrap(err, "smudge")
-			}
-			ext.Priority = ptrExt.Priority
-			extensions[ext.Name] = ext
-		}
-		exts, err := config.SortExtensions(extensions)
-		if err != nil {
-			return errors.Wrap(err, "smudge")
-		}
-
-		// pipe extensions in reverse order
-		var extsR []config.Extension
-		for i := range exts {
-			ext := exts[len(exts)-1-i]
-			extsR = append(extsR, ext)
-		}
-
-		request := &pipeRequest{"smudge", reader, workingfile, extsR}
-
-		response, err := pipeExtensions(request)
+		smudged, err := smudgeExtensions(reader, workingfile, ptr, config.Config.Extensions())
 		if err != nil {
 			return errors.Wrap(err, "smudge")
 		}
-
-		actualExts := make(map[string]*pipeExtResult)
-		for _, result := range response.results {
-			actualExts[result.name] = result
-		}
-
-		// verify name, order, and oids
-		oid := response.results[0].oidIn
-		if ptr.Oid != oid {
-			err = fmt.Errorf("Actual oid %s during smudge does not match expected %s", oid, ptr.Oid)
-			return errors.Wrap(err, "smudge")
-		}
-
-		for _, expected := range ptr.Extensions {
-			actual := actualExts[expected.Name]
-			if actual.name != expected.Name {
-				err = fmt.Errorf("Actual extension name '%s' does not match expected '%s'", actual.name, expected.Name)
-				return errors.Wrap(err, "smudge")
-			}
-			if actual.oidOut != expected.Oid {
-				err = fmt.Errorf("Actual oid %s for extension '%s' does not match expected %s", actual.oidOut, expected.Name, expected.Oid)
-				return errors.Wrap(err, "smudge")
-			}
-		}
+		defer os.Remove(smudged.Name())
 
 		// setup reader
-		reader, err = os.Open(response.file.Name())
+		reader, err = os.Open(smudged.Name())
 		if err != nil {
 			return errors.Wrapf(err, "Error opening smudged file: %s", err)
 		}
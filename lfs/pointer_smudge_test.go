@@ -0,0 +1,62 @@
+package lfs_test // avoid import cycle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/errors"
+	"github.com/github/git-lfs/lfs"
+	"github.com/github/git-lfs/test"
+	"github.com/github/git-lfs/transfer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPointerSmudgeToFileLeavesPreviousLinkedObject(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	cfg := config.Config
+	config.Config = config.NewFrom(config.Values{
+		Git: map[string]string{"lfs.hardlinkcheckout": "true"},
+	})
+	defer func() { config.Config = cfg }()
+
+	v1 := []byte("version one")
+	sum := sha256.Sum256(v1)
+	ptr1 := lfs.NewPointer(hex.EncodeToString(sum[:]), int64(len(v1)), nil)
+	mediafile, err := lfs.LocalMediaPath(ptr1.Oid)
+	require.Nil(t, err)
+	require.Nil(t, ioutil.WriteFile(mediafile, v1, 0644))
+
+	manifest := transfer.NewManifest()
+	require.Nil(t, lfs.PointerSmudgeToFile("a.dat", ptr1, false, manifest, nil))
+
+	fi, err := os.Stat("a.dat")
+	require.Nil(t, err)
+	mi, err := os.Stat(mediafile)
+	require.Nil(t, err)
+	require.True(t, os.SameFile(fi, mi), "expected a.dat to be linked to its object")
+
+	// The object of the next version isn't local, so the file is given its
+	// pointer instead, which must not be written through the link.
+	ptr2 := lfs.NewPointer("4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393", 9, nil)
+	err = lfs.PointerSmudgeToFile("a.dat", ptr2, false, manifest, nil)
+	assert.True(t, errors.IsDownloadDeclinedError(err), "unexpected error: %v", err)
+
+	stored, err := ioutil.ReadFile(mediafile)
+	require.Nil(t, err)
+	assert.Equal(t, v1, stored)
+
+	written, err := ioutil.ReadFile("a.dat")
+	require.Nil(t, err)
+	assert.Equal(t, ptr2.Encoded(), string(written))
+}
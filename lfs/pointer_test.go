@@ -260,6 +260,13 @@ size 12345`,
 ext-0-foo sha256:ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff
 ext-0-bar sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb
 oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
+size 12345`,
+
+		// duplicate ext name
+		`version https://git-lfs.github.com/spec/v1
+ext-0-foo sha256:ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff
+ext-1-foo sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb
+oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
 size 12345`,
 
 		// ext priority over 9
@@ -289,6 +296,97 @@ size 12345`,
 	}
 }
 
+const (
+	checkVersion = "version https://git-lfs.github.com/spec/v1\n"
+	checkOid     = "oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\n"
+	checkSize    = "size 12345\n"
+	checkExt0    = "ext-0-foo sha256:ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff\n"
+	checkExt1    = "ext-1-bar sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb\n"
+)
+
+func TestCheckPointer(t *testing.T) {
+	p, err := CheckPointer([]byte(checkVersion+checkOid+checkSize), true)
+	assert.Nil(t, err)
+	assert.Equal(t, "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393", p.Oid)
+	assert.Equal(t, int64(12345), p.Size)
+}
+
+func TestCheckPointerEmpty(t *testing.T) {
+	p, err := CheckPointer(nil, true)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), p.Size)
+}
+
+func TestCheckPointerWithExtensions(t *testing.T) {
+	p, err := CheckPointer([]byte(checkVersion+checkExt0+checkExt1+checkOid+checkSize), true)
+	assert.Nil(t, err)
+	if assert.Len(t, p.Extensions, 2) {
+		assert.Equal(t, "foo", p.Extensions[0].Name)
+		assert.Equal(t, "bar", p.Extensions[1].Name)
+	}
+
+	_, err = CheckPointer([]byte(checkVersion+checkExt1+checkExt0+checkOid+checkSize), true)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, `Line 2 is "`+strings.TrimSpace(checkExt1)+`", expected "`+strings.TrimSpace(checkExt0)+`"`, err.Error())
+	}
+
+	_, err = CheckPointer([]byte(checkVersion+checkOid+checkExt0+checkSize), true)
+	assert.NotNil(t, err)
+}
+
+func TestCheckPointerWrongKeyOrder(t *testing.T) {
+	for _, ex := range []string{
+		checkVersion + checkSize + checkOid,
+		checkOid + checkVersion + checkSize,
+	} {
+		_, err := CheckPointer([]byte(ex), false)
+		assert.NotNil(t, err, "Example:\n%s", ex)
+	}
+}
+
+func TestCheckPointerRejectsOtherVariations(t *testing.T) {
+	for _, ex := range []string{
+		// extra key
+		checkVersion + checkOid + checkSize + "foo bar\n",
+		// blank line
+		checkVersion + "\n" + checkOid + checkSize,
+		// uppercase oid
+		checkVersion + strings.ToUpper(checkOid) + checkSize,
+		// leading zero
+		checkVersion + checkOid + "size 012345\n",
+	} {
+		_, err := CheckPointer([]byte(ex), false)
+		assert.NotNil(t, err, "Example:\n%s", ex)
+	}
+}
+
+func TestCheckPointerOversize(t *testing.T) {
+	data := []byte(checkVersion + checkOid + checkSize + strings.Repeat("x", blobSizeCutoff))
+	_, err := CheckPointer(data, false)
+	if assert.NotNil(t, err) {
+		assert.True(t, errors.IsNotAPointerError(err))
+	}
+}
+
+func TestCheckPointerLineEndings(t *testing.T) {
+	crlf := strings.Replace(checkVersion+checkOid+checkSize, "\n", "\r\n", -1)
+	noNewline := strings.TrimSuffix(checkVersion+checkOid+checkSize, "\n")
+
+	_, err := CheckPointer([]byte(crlf), false)
+	assert.Nil(t, err)
+	_, err = CheckPointer([]byte(noNewline), false)
+	assert.Nil(t, err)
+
+	_, err = CheckPointer([]byte(crlf), true)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "Windows line endings", err.Error())
+	}
+	_, err = CheckPointer([]byte(noNewline), true)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "Missing newline at end of file", err.Error())
+	}
+}
+
 func assertEqualWithExample(t *testing.T, example string, expected, actual interface{}) {
 	assert.Equal(t, expected, actual, "Example:\n%s", strings.TrimSpace(example))
 }
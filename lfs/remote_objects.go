@@ -0,0 +1,55 @@
+package lfs
+
+import (
+	"github.com/github/git-lfs/api"
+	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/errors"
+	"github.com/github/git-lfs/tools"
+)
+
+// RemoteObjects asks the server of cfg.CurrentRemote which of the objects of
+// "pointers" it has, with download batch API requests of up to batchSize
+// objects each, and returns the set of their OIDs. Objects the server doesn't
+// have are left out; any other error fails the whole check.
+func RemoteObjects(cfg *config.Configuration, pointers []*WrappedPointer) (tools.StringSet, error) {
+	return remoteObjects(cfg, pointers, api.Batch)
+}
+
+func remoteObjects(cfg *config.Configuration, pointers []*WrappedPointer, batch batchFunc) (tools.StringSet, error) {
+	present := tools.NewStringSet()
+
+	seen := tools.NewStringSetWithCapacity(len(pointers))
+	objects := make([]*api.ObjectResource, 0, len(pointers))
+	for _, p := range pointers {
+		if seen.Add(p.Oid) {
+			objects = append(objects, &api.ObjectResource{Oid: p.Oid, Size: p.Size})
+		}
+	}
+
+	for len(objects) > 0 {
+		n := batchSize
+		if n > len(objects) {
+			n = len(objects)
+		}
+
+		objs, _, err := batch(cfg, objects[:n], "download", []string{"basic"})
+		if err != nil {
+			return nil, err
+		}
+		objects = objects[n:]
+
+		for _, o := range objs {
+			if o.Error != nil {
+				if o.Error.Code == 404 {
+					continue
+				}
+				return nil, errors.Wrapf(o.Error, "[%v] %v", o.Oid, o.Error.Message)
+			}
+			if _, ok := o.Rel("download"); ok {
+				present.Add(o.Oid)
+			}
+		}
+	}
+
+	return present, nil
+}
@@ -0,0 +1,75 @@
+package lfs
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/github/git-lfs/api"
+	"github.com/github/git-lfs/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func remoteTestPointer(oid string) *WrappedPointer {
+	return &WrappedPointer{Name: oid + ".dat", Pointer: NewPointer(oid, 1, nil)}
+}
+
+func TestRemoteObjects(t *testing.T) {
+	pointers := []*WrappedPointer{
+		remoteTestPointer(oidA),
+		remoteTestPointer(oidB),
+		remoteTestPointer(oidA),
+		remoteTestPointer(oidC),
+	}
+
+	var requested []string
+	present, err := remoteObjects(config.New(), pointers, func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		assert.Equal(t, "download", operation)
+		for _, o := range objects {
+			requested = append(requested, o.Oid)
+		}
+		return []*api.ObjectResource{
+			downloadable(oidA),
+			{Oid: oidB, Size: 1, Error: &api.ObjectError{Code: 404, Message: "Object does not exist"}},
+			{Oid: oidC, Size: 1},
+		}, "basic", nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{oidA, oidB, oidC}, requested)
+	assert.True(t, present.Contains(oidA))
+	assert.False(t, present.Contains(oidB))
+	assert.False(t, present.Contains(oidC))
+}
+
+func TestRemoteObjectsChunksRequests(t *testing.T) {
+	pointers := make([]*WrappedPointer, 0, batchSize*2+1)
+	for i := 0; i < cap(pointers); i++ {
+		pointers = append(pointers, remoteTestPointer(fmt.Sprintf("%064x", i)))
+	}
+
+	var sizes []int
+	present, err := remoteObjects(config.New(), pointers, func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		sizes = append(sizes, len(objects))
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			objs = append(objs, downloadable(o.Oid))
+		}
+		return objs, "basic", nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int{batchSize, batchSize, 1}, sizes)
+	assert.Equal(t, len(pointers), len(present))
+}
+
+func TestRemoteObjectsFailsOnObjectError(t *testing.T) {
+	_, err := remoteObjects(config.New(), []*WrappedPointer{remoteTestPointer(oidA)}, func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{
+			{Oid: oidA, Size: 1, Error: &api.ObjectError{Code: 403, Message: "Forbidden"}},
+		}, "basic", nil
+	})
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "Forbidden")
+	}
+}
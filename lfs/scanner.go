@@ -9,12 +9,14 @@ import (
 	"io/ioutil"
 	"os/exec"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/github/git-lfs/git"
+	"github.com/github/git-lfs/metrics"
 	"github.com/github/git-lfs/tools"
 	"github.com/rubyist/tracerx"
 )
@@ -52,6 +54,9 @@ type WrappedPointer struct {
 	SrcName string
 	Size    int64
 	Status  string
+	// Commit is a commit whose tree has the pointer, for pointers found by
+	// scanning diffs in the output of git log.
+	Commit string
 	*Pointer
 }
 
@@ -164,6 +169,7 @@ func ScanRefsToChan(refLeft, refRight string, opt *ScanRefsOptions) (*PointerCha
 		if err != nil {
 			errchan <- err
 		}
+		metrics.Since(metrics.Scan, start)
 		close(retchan)
 		close(errchan)
 	}()
@@ -201,6 +207,7 @@ func ScanIndex() ([]*WrappedPointer, error) {
 	start := time.Now()
 	defer func() {
 		tracerx.PerformanceSince("scan-staging", start)
+		metrics.Since(metrics.Scan, start)
 	}()
 
 	revs, err := revListIndex(false, indexMap)
@@ -648,10 +655,26 @@ type TreeBlob struct {
 // ScanTree takes a ref and returns a slice of WrappedPointer objects in the tree at that ref
 // Differs from ScanRefs in that multiple files in the tree with the same content are all reported
 func ScanTree(ref string) ([]*WrappedPointer, error) {
+	pointerc, err := ScanTreeToChan(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	pointers := make([]*WrappedPointer, 0)
+	for p := range pointerc.Results {
+		pointers = append(pointers, p)
+	}
+	err = pointerc.Wait()
+
+	return pointers, err
+}
+
+// ScanTreeToChan takes a ref and returns a channel of WrappedPointer objects
+// in the tree at that ref, in the order that git ls-tree lists them. Results
+// are sent as soon as they are found, so callers can start using them before
+// the whole tree has been scanned.
+func ScanTreeToChan(ref string) (*PointerChannelWrapper, error) {
 	start := time.Now()
-	defer func() {
-		tracerx.PerformanceSince("scan", start)
-	}()
 
 	// We don't use the nameMap approach here since that's imprecise when >1 file
 	// can be using the same content
@@ -665,13 +688,22 @@ func ScanTree(ref string) ([]*WrappedPointer, error) {
 		return nil, err
 	}
 
-	pointers := make([]*WrappedPointer, 0)
-	for p := range pointerc.Results {
-		pointers = append(pointers, p)
-	}
-	err = pointerc.Wait()
+	retchan := make(chan *WrappedPointer, chanBufSize)
+	errchan := make(chan error, 1)
+	go func() {
+		for p := range pointerc.Results {
+			retchan <- p
+		}
+		if err := pointerc.Wait(); err != nil {
+			errchan <- err
+		}
+		tracerx.PerformanceSince("scan", start)
+		metrics.Since(metrics.Scan, start)
+		close(retchan)
+		close(errchan)
+	}()
 
-	return pointers, err
+	return NewPointerChannelWrapper(retchan, errchan), nil
 }
 
 // catFileBatchTree uses git cat-file --batch to get the object contents
@@ -779,6 +811,16 @@ func lsTreeBlobs(ref string) (*TreeBlobChannelWrapper, error) {
 }
 
 func parseLsTree(reader io.Reader, output chan TreeBlob) {
+	parseLsTreeBlobs(reader, func(blob TreeBlob, size int64) {
+		if size < blobSizeCutoff {
+			output <- blob
+		}
+	})
+}
+
+// parseLsTreeBlobs calls "fn" with each blob, and its size, in the output of
+// git ls-tree -l -z.
+func parseLsTreeBlobs(reader io.Reader, fn func(blob TreeBlob, size int64)) {
 	scanner := bufio.NewScanner(reader)
 	scanner.Split(scanNullLines)
 	for scanner.Scan() {
@@ -802,14 +844,79 @@ func parseLsTree(reader io.Reader, output chan TreeBlob) {
 			continue
 		}
 
-		if sz < blobSizeCutoff {
-			sha1 := attrs[2]
-			filename := parts[1]
-			output <- TreeBlob{sha1, filename}
+		fn(TreeBlob{attrs[2], parts[1]}, sz)
+	}
+}
+
+// ScanTreeForNonPointers returns the blobs in the tree at "ref" which are not
+// Git LFS pointers, and whose paths, relative to the root of the repository,
+// are accepted by "filter". Files which were committed before they were
+// tracked are stored like this. The blobs are sorted by path.
+func ScanTreeForNonPointers(ref string, filter func(name string) bool) ([]TreeBlob, error) {
+	cmd, err := startCommand("git", "ls-tree", "-r", "-l", "-z", "--full-tree", ref)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin.Close()
+
+	// Blobs too big to be pointers can't be anything else, but the
+	// content of smaller ones has to be checked.
+	var blobs, small []TreeBlob
+	parseLsTreeBlobs(cmd.Stdout, func(blob TreeBlob, size int64) {
+		if !filter(blob.Filename) {
+			return
+		}
+		if size < blobSizeCutoff {
+			small = append(small, blob)
+		} else {
+			blobs = append(blobs, blob)
 		}
+	})
+
+	stderr, _ := ioutil.ReadAll(cmd.Stderr)
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("Error in git ls-tree: %v %v", err, string(stderr))
 	}
+
+	if len(small) > 0 {
+		smallc := make(chan TreeBlob, len(small))
+		for _, blob := range small {
+			smallc <- blob
+		}
+		close(smallc)
+		errc := make(chan error)
+		close(errc)
+
+		pointerc, err := catFileBatchTree(NewTreeBlobChannelWrapper(smallc, errc))
+		if err != nil {
+			return nil, err
+		}
+
+		pointers := make(map[string]bool)
+		for p := range pointerc.Results {
+			pointers[p.Name] = true
+		}
+		if err := pointerc.Wait(); err != nil {
+			return nil, err
+		}
+
+		for _, blob := range small {
+			if !pointers[blob.Filename] {
+				blobs = append(blobs, blob)
+			}
+		}
+	}
+
+	sort.Sort(treeBlobsByName(blobs))
+	return blobs, nil
 }
 
+type treeBlobsByName []TreeBlob
+
+func (b treeBlobsByName) Len() int           { return len(b) }
+func (b treeBlobsByName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b treeBlobsByName) Less(i, j int) bool { return b[i].Filename < b[j].Filename }
+
 func scanNullLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	if atEOF && len(data) == 0 {
 		return 0, nil, nil
@@ -836,6 +943,7 @@ func ScanUnpushed(remoteName string) ([]*WrappedPointer, error) {
 	start := time.Now()
 	defer func() {
 		tracerx.PerformanceSince("scan", start)
+		metrics.Since(metrics.Scan, start)
 	}()
 
 	pointerchan, err := ScanUnpushedToChan(remoteName)
@@ -857,6 +965,7 @@ func ScanPreviousVersions(ref string, since time.Time) ([]*WrappedPointer, error
 	start := time.Now()
 	defer func() {
 		tracerx.PerformanceSince("scan", start)
+		metrics.Since(metrics.Scan, start)
 	}()
 
 	pointerchan, err := ScanPreviousVersionsToChan(ref, since)
@@ -920,6 +1029,39 @@ func ScanUnpushedToChan(remoteName string) (*PointerChannelWrapper, error) {
 
 }
 
+// ScanHistoryToChan scans the history of every ref for the LFS pointers which
+// commits added, most recent first, with the commit which added each one, and
+// returns them progressively in a channel. A pointer is returned once for
+// every commit which added it.
+func ScanHistoryToChan() (*PointerChannelWrapper, error) {
+	logArgs := []string{"log", "--all"}
+	// Add standard search args to find lfs references
+	logArgs = append(logArgs, logLfsSearchArgs...)
+
+	cmd, err := startCommand("git", logArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Stdin.Close()
+
+	pchan := make(chan *WrappedPointer, chanBufSize)
+	errchan := make(chan error, 1)
+
+	go func() {
+		parseLogOutputToPointers(cmd.Stdout, LogDiffAdditions, nil, nil, pchan)
+		stderr, _ := ioutil.ReadAll(cmd.Stderr)
+		err := cmd.Wait()
+		if err != nil {
+			errchan <- fmt.Errorf("Error in git log: %v %v", err, string(stderr))
+		}
+		close(pchan)
+		close(errchan)
+	}()
+
+	return NewPointerChannelWrapper(pchan, errchan), nil
+}
+
 // logPreviousVersions scans history for all previous versions of LFS pointers
 // from 'since' up to (but not including) the final state at ref
 func logPreviousSHAs(ref string, since time.Time) (*PointerChannelWrapper, error) {
@@ -1000,6 +1142,7 @@ func parseLogOutputToPointers(log io.Reader, dir LogDiffDirection,
 	pointerDataRegex := regexp.MustCompile(`^([\+\- ])(version https://git-lfs|oid sha256|size|ext-).*$`)
 	var pointerData bytes.Buffer
 	var currentFilename string
+	var currentCommit string
 	currentFileIncluded := true
 
 	// Utility func used at several points below (keep in narrow scope)
@@ -1008,7 +1151,7 @@ func parseLogOutputToPointers(log io.Reader, dir LogDiffDirection,
 			if currentFileIncluded {
 				p, err := DecodePointer(&pointerData)
 				if err == nil {
-					results <- &WrappedPointer{Name: currentFilename, Size: p.Size, Pointer: p}
+					results <- &WrappedPointer{Name: currentFilename, Size: p.Size, Commit: currentCommit, Pointer: p}
 				} else {
 					tracerx.Printf("Unable to parse pointer from log: %v", err)
 				}
@@ -1021,9 +1164,16 @@ func parseLogOutputToPointers(log io.Reader, dir LogDiffDirection,
 	for scanner.Scan() {
 		line := scanner.Text()
 		if match := commitHeaderRegex.FindStringSubmatch(line); match != nil {
-			// Currently we're not pulling out commit groupings, but could if we wanted
-			// This just acts as a delimiter for finishing a multiline pointer
+			// This acts as a delimiter for finishing a multiline pointer
 			finishLastPointer()
+			// Removed pointers were in the tree of the parent, rather than
+			// the commit; git log shows no diffs for merges, so there is
+			// only one
+			if dir == LogDiffAdditions {
+				currentCommit = match[1]
+			} else {
+				currentCommit = match[2]
+			}
 
 		} else if match := fileHeaderRegex.FindStringSubmatch(line); match != nil {
 			// Finding a regular file header
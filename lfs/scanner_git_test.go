@@ -5,13 +5,19 @@ package lfs_test // to avoid import cycles
 // which avoids import cycles with testutils
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	. "github.com/github/git-lfs/lfs"
 	"github.com/github/git-lfs/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestScanUnpushed(t *testing.T) {
@@ -154,10 +160,11 @@ func TestScanPreviousVersions(t *testing.T) {
 	// folder/nested.txt [-diff at 4, ie 3, -diff at 3 ie 0]
 	// folder/nested2.txt [-diff at 3 ie 0]
 	// others are either on diff branches, before this window, or unchanged
+	// each with the parent of the commit which changed it, [1] for [3]
 	expected := []*WrappedPointer{
-		{Name: "folder/nested.txt", Size: outputs[3].Files[0].Size, Pointer: outputs[3].Files[0]},
-		{Name: "folder/nested.txt", Size: outputs[0].Files[2].Size, Pointer: outputs[0].Files[2]},
-		{Name: "folder/nested2.txt", Size: outputs[0].Files[3].Size, Pointer: outputs[0].Files[3]},
+		{Name: "folder/nested.txt", Size: outputs[3].Files[0].Size, Commit: outputs[3].Sha, Pointer: outputs[3].Files[0]},
+		{Name: "folder/nested.txt", Size: outputs[0].Files[2].Size, Commit: outputs[1].Sha, Pointer: outputs[0].Files[2]},
+		{Name: "folder/nested2.txt", Size: outputs[0].Files[3].Size, Commit: outputs[1].Sha, Pointer: outputs[0].Files[3]},
 	}
 	// Need to sort to compare equality
 	sort.Sort(test.WrappedPointersByOid(expected))
@@ -165,3 +172,166 @@ func TestScanPreviousVersions(t *testing.T) {
 	assert.Equal(t, expected, pointers)
 
 }
+
+func TestScanHistory(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	inputs := []*test.CommitInput{
+		{ // 0
+			Files: []*test.FileInput{
+				{Filename: "file1.txt", Size: 20},
+			},
+		},
+		{ // 1
+			NewBranch: "branch2",
+			Files: []*test.FileInput{
+				{Filename: "file1.txt", Size: 25},
+			},
+		},
+		{ // 2
+			ParentBranches: []string{"master"}, // back on master
+			Files: []*test.FileInput{
+				{Filename: "folder/file2.txt", Size: 30},
+			},
+		},
+	}
+	outputs := repo.AddCommits(inputs)
+
+	pointerchan, err := ScanHistoryToChan()
+	if !assert.Nil(t, err) {
+		return
+	}
+	var pointers []*WrappedPointer
+	for p := range pointerchan.Results {
+		pointers = append(pointers, p)
+	}
+	assert.Nil(t, pointerchan.Wait())
+
+	// Every commit on every branch, with the commit which added each pointer
+	expected := []*WrappedPointer{
+		{Name: "file1.txt", Size: outputs[0].Files[0].Size, Commit: outputs[0].Sha, Pointer: outputs[0].Files[0]},
+		{Name: "file1.txt", Size: outputs[1].Files[0].Size, Commit: outputs[1].Sha, Pointer: outputs[1].Files[0]},
+		{Name: "folder/file2.txt", Size: outputs[2].Files[0].Size, Commit: outputs[2].Sha, Pointer: outputs[2].Files[0]},
+	}
+	sort.Sort(test.WrappedPointersByOid(expected))
+	sort.Sort(test.WrappedPointersByOid(pointers))
+	assert.Equal(t, expected, pointers)
+}
+
+func TestScanTreeForNonPointers(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	// A pointer, which isn't reported.
+	repo.AddCommits([]*test.CommitInput{
+		{Files: []*test.FileInput{{Filename: "pointer.bin", Size: 20}}},
+	})
+
+	files := map[string]string{
+		"large.bin":     strings.Repeat("x", 2048),
+		"dir/small.bin": "not a pointer",
+		"other.txt":     "not matched",
+	}
+	for name, data := range files {
+		require.Nil(t, os.MkdirAll(filepath.Dir(name), 0755))
+		require.Nil(t, ioutil.WriteFile(name, []byte(data), 0644))
+	}
+	test.RunGitCommand(t, true, "add", "large.bin", "dir/small.bin", "other.txt")
+	test.RunGitCommand(t, true, "commit", "-m", "add files")
+
+	blobs, err := ScanTreeForNonPointers("HEAD", func(name string) bool {
+		return strings.HasSuffix(name, ".bin")
+	})
+	require.Nil(t, err)
+
+	var names []string
+	for _, blob := range blobs {
+		names = append(names, blob.Filename)
+	}
+	assert.Equal(t, []string{"dir/small.bin", "large.bin"}, names)
+}
+
+// newManyRefsRepo creates a repo with "n" branches, each adding a file of its
+// own to a history shared with the others.
+func newManyRefsRepo(b *testing.B, n int) *test.Repo {
+	repo := test.NewRepo(b)
+	repo.Pushd()
+
+	inputs := []*test.CommitInput{{
+		Files: []*test.FileInput{
+			{Filename: "shared.dat", Size: 100},
+		},
+	}}
+	for i := 0; i < n; i++ {
+		inputs = append(inputs, &test.CommitInput{
+			NewBranch:      fmt.Sprintf("branch%d", i),
+			ParentBranches: []string{"master"},
+			Files: []*test.FileInput{
+				{Filename: fmt.Sprintf("file%d.dat", i), Size: int64(100 + i)},
+			},
+		})
+	}
+	repo.AddCommits(inputs)
+
+	return repo
+}
+
+// BenchmarkScanAllRefs scans every ref with one rev-list traversal, as fetch
+// --all does, which lists each object once however many refs reach it.
+func BenchmarkScanAllRefs(b *testing.B) {
+	repo := newManyRefsRepo(b, 50)
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	opts := NewScanRefsOptions()
+	opts.ScanMode = ScanAllMode
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pointers, err := ScanRefs("", "", opts)
+		if err != nil || len(pointers) != 51 {
+			b.Fatalf("expected 51 pointers, got %d (%v)", len(pointers), err)
+		}
+	}
+}
+
+// BenchmarkScanEachRef scans every ref separately, which walks the history
+// they share again for each one, and finds the shared object every time.
+func BenchmarkScanEachRef(b *testing.B) {
+	repo := newManyRefsRepo(b, 50)
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	opts := NewScanRefsOptions()
+	opts.ScanMode = ScanRefsMode
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		oids := make(map[string]bool)
+		for n := 0; n < 50; n++ {
+			pointers, err := ScanRefs(fmt.Sprintf("branch%d", n), "", opts)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for _, p := range pointers {
+				oids[p.Oid] = true
+			}
+		}
+		if len(oids) != 51 {
+			b.Fatalf("expected 51 objects, got %d", len(oids))
+		}
+	}
+}
@@ -131,6 +131,13 @@ func TestParseLogOutputToPointersAdditions(t *testing.T) {
 	assert.Equal(t, "ebff26d6b557b1416a6fded097fd9b9102e2d8195532c377ac365c736c87d4bc", pointers[4].Oid)
 	assert.Equal(t, int64(127142413), pointers[4].Size)
 
+	// commits which added them
+	assert.Equal(t, "07d571b413957508679042e45508af5945b3f1e5", pointers[0].Commit)
+	assert.Equal(t, "07d571b413957508679042e45508af5945b3f1e5", pointers[1].Commit)
+	assert.Equal(t, "60fde3d23553e10a55e2a32ed18c20f65edd91e7", pointers[2].Commit)
+	assert.Equal(t, "60fde3d23553e10a55e2a32ed18c20f65edd91e7", pointers[3].Commit)
+	assert.Equal(t, "64b3372e108daaa593412d5e1d9df8169a9547ea", pointers[4].Commit)
+
 	// test filtered, include
 	r = strings.NewReader(pointerParseLogOutput)
 	pointers = pointers[:0]
@@ -198,6 +205,9 @@ func TestParseLogOutputToPointersDeletion(t *testing.T) {
 	assert.Equal(t, "flare_1.png", pointers[1].Name)
 	assert.Equal(t, "ea61c67cc5e8b3504d46de77212364045f31d9a023ad4448a1ace2a2fb4eed28", pointers[1].Oid)
 	assert.Equal(t, int64(72982), pointers[1].Size)
+	// parents of the commits which removed them
+	assert.Equal(t, "07d571b413957508679042e45508af5945b3f1e5", pointers[0].Commit)
+	assert.Equal(t, "8e5bd456b754f7d61c7157e82edc5ed124be4da6", pointers[1].Commit)
 	// modification, - side
 	assert.Equal(t, "radial_1.png", pointers[2].Name)
 	assert.Equal(t, "334c8a0a520cf9f58189dba5a9a26c7bff2769b4a3cc199650c00618bde5b9dd", pointers[2].Oid)
@@ -0,0 +1,82 @@
+package lfs
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/github/git-lfs/tools"
+)
+
+// TransferFilter decides whether a Transferable given to a TransferQueue
+// should be transferred. It returns false for objects which should be skipped.
+type TransferFilter func(t Transferable) bool
+
+// NewPathFilter returns a TransferFilter which passes objects whose names match
+// any of the "include" patterns (or all objects, if there are none) and none of
+// the "exclude" patterns.
+//
+// Patterns are matched the same way as in .gitignore files: see
+// tools.PathMatchesPattern. Within each list, a pattern prefixed with '!'
+// negates an earlier match, and the last matching pattern wins. For example
+// excluding "assets/**/*.psd" and "!assets/ui/*.psd" skips every PSD file under
+// assets except those in assets/ui.
+func NewPathFilter(include, exclude []string) TransferFilter {
+	return func(t Transferable) bool {
+		name := filepath.ToSlash(t.Name())
+
+		if len(include) > 0 && !matchesAnyPattern(name, include) {
+			return false
+		}
+		return !matchesAnyPattern(name, exclude)
+	}
+}
+
+// NewSizeFilter returns a TransferFilter which passes objects whose size is at
+// least "min" and at most "max" bytes. A bound of zero or less is not enforced.
+func NewSizeFilter(min, max int64) TransferFilter {
+	return func(t Transferable) bool {
+		if min > 0 && t.Size() < min {
+			return false
+		}
+		if max > 0 && t.Size() > max {
+			return false
+		}
+		return true
+	}
+}
+
+// NewFetchFilter combines a path filter for the given include and exclude
+// patterns with a size filter allowing objects up to "maxSize" bytes.
+func NewFetchFilter(include, exclude []string, maxSize int64) TransferFilter {
+	return AllFilters(NewPathFilter(include, exclude), NewSizeFilter(0, maxSize))
+}
+
+// AllFilters returns a TransferFilter which passes only objects passed by every
+// one of the given filters.
+func AllFilters(filters ...TransferFilter) TransferFilter {
+	return func(t Transferable) bool {
+		for _, f := range filters {
+			if f != nil && !f(t) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// matchesAnyPattern returns whether "name" is matched by the list of patterns,
+// where the last matching pattern wins and a '!' prefix negates a match.
+func matchesAnyPattern(name string, patterns []string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		if negated {
+			pattern = pattern[1:]
+		}
+
+		if tools.PathMatchesPattern(filepath.ToSlash(pattern), name) {
+			matched = !negated
+		}
+	}
+	return matched
+}
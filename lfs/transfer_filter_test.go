@@ -0,0 +1,116 @@
+package lfs
+
+import (
+	"testing"
+
+	"github.com/github/git-lfs/api"
+	"github.com/stretchr/testify/assert"
+)
+
+type filterTestTransferable struct {
+	oid, name string
+	size      int64
+}
+
+func (t *filterTestTransferable) Oid() string                               { return t.oid }
+func (t *filterTestTransferable) Size() int64                               { return t.size }
+func (t *filterTestTransferable) Name() string                              { return t.name }
+func (t *filterTestTransferable) Path() string                              { return "" }
+func (t *filterTestTransferable) Object() *api.ObjectResource               { return nil }
+func (t *filterTestTransferable) SetObject(*api.ObjectResource)             {}
+func (t *filterTestTransferable) LegacyCheck() (*api.ObjectResource, error) { return nil, nil }
+
+func named(name string) Transferable {
+	return &filterTestTransferable{oid: name, name: name}
+}
+
+func TestPathFilterIncludesRecursiveGlob(t *testing.T) {
+	f := NewPathFilter([]string{"assets/**/*.psd"}, nil)
+
+	assert.True(t, f(named("assets/image.psd")))
+	assert.True(t, f(named("assets/ui/buttons/image.psd")))
+	assert.False(t, f(named("assets/image.png")))
+	assert.False(t, f(named("other/image.psd")))
+}
+
+func TestPathFilterExcludeWithNegation(t *testing.T) {
+	f := NewPathFilter(nil, []string{"assets/**/*.psd", "!assets/ui/*.psd"})
+
+	assert.False(t, f(named("assets/image.psd")))
+	assert.False(t, f(named("assets/deep/image.psd")))
+	assert.True(t, f(named("assets/ui/image.psd")))
+	assert.True(t, f(named("assets/image.png")))
+}
+
+func TestPathFilterIncludeWithNegation(t *testing.T) {
+	f := NewPathFilter([]string{"*.psd", "!huge.psd"}, nil)
+
+	assert.True(t, f(named("small.psd")))
+	assert.True(t, f(named("dir/small.psd")))
+	assert.False(t, f(named("huge.psd")))
+	assert.False(t, f(named("dir/huge.psd")))
+}
+
+func TestPathFilterBracketsAndSpaces(t *testing.T) {
+	f := NewPathFilter(nil, []string{`raw/file\[1\].bin`, "my docs"})
+
+	assert.False(t, f(named("raw/file[1].bin")))
+	assert.True(t, f(named("raw/file1.bin")))
+	assert.False(t, f(named("my docs/notes.bin")))
+	assert.True(t, f(named("my-docs/notes.bin")))
+}
+
+func TestSizeFilter(t *testing.T) {
+	f := NewSizeFilter(10, 100)
+
+	assert.False(t, f(&filterTestTransferable{size: 9}))
+	assert.True(t, f(&filterTestTransferable{size: 10}))
+	assert.True(t, f(&filterTestTransferable{size: 100}))
+	assert.False(t, f(&filterTestTransferable{size: 101}))
+
+	assert.True(t, NewSizeFilter(0, 0)(&filterTestTransferable{size: 1 << 40}))
+}
+
+func TestFetchFilterCombinesPathAndSize(t *testing.T) {
+	f := NewFetchFilter([]string{"*.psd"}, nil, 100)
+
+	assert.True(t, f(&filterTestTransferable{name: "a.psd", size: 50}))
+	assert.False(t, f(&filterTestTransferable{name: "a.psd", size: 500}))
+	assert.False(t, f(&filterTestTransferable{name: "a.png", size: 50}))
+}
+
+func TestTransferQueueFilterSkipsInDryRun(t *testing.T) {
+	q := NewDownloadQueue(2, 20, true)
+	q.SetFilter(NewPathFilter(nil, []string{"*.psd"}))
+	skipped := q.WatchSkipped()
+	done := q.Watch()
+
+	q.Add(&filterTestTransferable{oid: "a", name: "a.psd", size: 10})
+	q.Add(&filterTestTransferable{oid: "b", name: "dir/b.psd", size: 10})
+	q.Wait()
+
+	var skippedOids []string
+	for oid := range skipped {
+		skippedOids = append(skippedOids, oid)
+	}
+	var doneOids []string
+	for oid := range done {
+		doneOids = append(doneOids, oid)
+	}
+
+	assert.Equal(t, []string{"a", "b"}, skippedOids)
+	assert.Empty(t, doneOids)
+	assert.Empty(t, q.Errors())
+}
+
+func TestTransferQueueFilterReportsSkips(t *testing.T) {
+	q := NewDownloadQueue(2, 2, true)
+	q.SetFilter(func(t Transferable) bool { return t.Oid() != oidB })
+
+	reasons := runSkippingQueue(q, []*api.ObjectResource{downloadable(oidA)}, oidA, oidB)
+
+	assert.Equal(t, map[string]string{
+		oidA: SkipDryRun,
+		oidB: SkipFiltered,
+	}, reasons)
+}
@@ -0,0 +1,158 @@
+package lfs
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/errors"
+	"github.com/github/git-lfs/transfer"
+	"github.com/rubyist/tracerx"
+)
+
+// TransferJournal records the OIDs of objects which a TransferQueue has
+// transferred and verified, so that if the command running it is interrupted,
+// the next run for the same direction, remote and ref can skip them without
+// asking the server about them again. It is removed once a queue using it
+// finishes without errors.
+//
+// Journals are files under .git/lfs/tq, holding one OID per line. Appends are
+// single writes to a file opened with O_APPEND, so several processes can safely
+// record to the same journal. A line which was only partly written, or which is
+// otherwise not an OID, is treated as the end of the journal and truncated.
+type TransferJournal struct {
+	path string
+	mu   sync.Mutex // mu guards f and completed
+	f    *os.File
+	// completed holds the OIDs recorded by earlier runs.
+	completed map[string]bool
+}
+
+// NewTransferJournal opens the journal for transfers in direction "dir" of the
+// given ref to or from the given remote, creating it if necessary.
+func NewTransferJournal(dir transfer.Direction, remote, ref string) (*TransferJournal, error) {
+	return OpenTransferJournal(transferJournalPath(dir, remote, ref))
+}
+
+// OpenTransferJournal opens the journal at "path", creating it if necessary,
+// for callers which choose where to keep it; see NewTransferJournal.
+func OpenTransferJournal(path string) (*TransferJournal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrap(err, "transfer journal")
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "transfer journal")
+	}
+
+	completed, size, garbage, err := readTransferJournal(f)
+	if err == nil && garbage {
+		tracerx.Printf("tq: truncating corrupt transfer journal %s to %d bytes", path, size)
+		err = f.Truncate(size)
+	}
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "transfer journal")
+	}
+
+	tracerx.Printf("tq: opened transfer journal %s with %d completed objects", path, len(completed))
+	return &TransferJournal{path: path, f: f, completed: completed}, nil
+}
+
+// transferJournalPath returns the path of the journal for transfers in
+// direction "dir" of the given ref to or from the given remote.
+func transferJournalPath(dir transfer.Direction, remote, ref string) string {
+	kind := "download"
+	if dir == transfer.Upload {
+		kind = "upload"
+	}
+
+	h := sha256.New()
+	io.WriteString(h, kind+"\x00"+remote+"\x00"+ref)
+	return filepath.Join(config.LocalGitStorageDir, "lfs", "tq", hex.EncodeToString(h.Sum(nil)))
+}
+
+// readTransferJournal returns the OIDs recorded in the journal "r", and the
+// length of the valid part of it, which ends at the first line which is not a
+// complete OID. "garbage" is true if there is anything after that.
+func readTransferJournal(r io.Reader) (completed map[string]bool, size int64, garbage bool, err error) {
+	completed = make(map[string]bool)
+	br := bufio.NewReader(r)
+
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			return completed, size, len(line) > 0, nil
+		}
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		oid := line[:len(line)-1]
+		if !ValidOid(oid) {
+			return completed, size, true, nil
+		}
+		completed[oid] = true
+		size += int64(len(line))
+	}
+}
+
+// Completed returns whether an earlier run recorded the object "oid" as
+// transferred.
+func (j *TransferJournal) Completed(oid string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.completed[oid]
+}
+
+// Discard forgets the OIDs recorded by earlier runs, so that their objects are
+// transferred again.
+func (j *TransferJournal) Discard() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.completed = make(map[string]bool)
+	return j.f.Truncate(0)
+}
+
+// Record records that the object "oid" has been transferred.
+func (j *TransferJournal) Record(oid string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return nil
+	}
+	_, err := j.f.Write([]byte(oid + "\n"))
+	return err
+}
+
+// Close closes the journal, keeping it for the next run.
+func (j *TransferJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
+
+// Remove closes and deletes the journal, once everything has been transferred.
+func (j *TransferJournal) Remove() error {
+	j.Close()
+	tracerx.Printf("tq: removing transfer journal %s", j.path)
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
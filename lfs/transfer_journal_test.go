@@ -0,0 +1,128 @@
+package lfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func journalOid(i int) string {
+	return fmt.Sprintf("%064x", i)
+}
+
+func tempJournalPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "lfs-transfer-journal")
+	require.Nil(t, err)
+	return filepath.Join(dir, "tq", "journal"), func() { os.RemoveAll(dir) }
+}
+
+func TestTransferJournalRecordsAcrossRuns(t *testing.T) {
+	path, cleanup := tempJournalPath(t)
+	defer cleanup()
+
+	j, err := OpenTransferJournal(path)
+	require.Nil(t, err)
+	assert.False(t, j.Completed(journalOid(1)))
+	require.Nil(t, j.Record(journalOid(1)))
+	require.Nil(t, j.Record(journalOid(2)))
+	// Only earlier runs count.
+	assert.False(t, j.Completed(journalOid(1)))
+	require.Nil(t, j.Close())
+
+	j, err = OpenTransferJournal(path)
+	require.Nil(t, err)
+	assert.True(t, j.Completed(journalOid(1)))
+	assert.True(t, j.Completed(journalOid(2)))
+	assert.False(t, j.Completed(journalOid(3)))
+
+	require.Nil(t, j.Remove())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTransferJournalTruncatesGarbage(t *testing.T) {
+	path, cleanup := tempJournalPath(t)
+	defer cleanup()
+
+	for _, garbage := range []string{journalOid(2)[:10], "not an oid\n" + journalOid(3) + "\n"} {
+		require.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.Nil(t, ioutil.WriteFile(path, []byte(journalOid(1)+"\n"+garbage), 0644))
+
+		j, err := OpenTransferJournal(path)
+		require.Nil(t, err)
+		assert.True(t, j.Completed(journalOid(1)))
+		assert.False(t, j.Completed(journalOid(3)))
+		require.Nil(t, j.Record(journalOid(4)))
+		require.Nil(t, j.Close())
+
+		by, err := ioutil.ReadFile(path)
+		require.Nil(t, err)
+		assert.Equal(t, journalOid(1)+"\n"+journalOid(4)+"\n", string(by))
+	}
+}
+
+func TestTransferJournalConcurrentRecords(t *testing.T) {
+	path, cleanup := tempJournalPath(t)
+	defer cleanup()
+
+	// Two journals stand in for two processes.
+	j1, err := OpenTransferJournal(path)
+	require.Nil(t, err)
+	j2, err := OpenTransferJournal(path)
+	require.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			j := j1
+			if i%2 == 1 {
+				j = j2
+			}
+			assert.Nil(t, j.Record(journalOid(i)))
+		}(i)
+	}
+	wg.Wait()
+	require.Nil(t, j1.Close())
+	require.Nil(t, j2.Close())
+
+	by, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, 100, strings.Count(string(by), "\n"))
+
+	j, err := OpenTransferJournal(path)
+	require.Nil(t, err)
+	defer j.Close()
+	for i := 0; i < 100; i++ {
+		assert.True(t, j.Completed(journalOid(i)), journalOid(i))
+	}
+}
+
+func TestTransferJournalDiscard(t *testing.T) {
+	path, cleanup := tempJournalPath(t)
+	defer cleanup()
+
+	j, err := OpenTransferJournal(path)
+	require.Nil(t, err)
+	require.Nil(t, j.Record(journalOid(1)))
+	require.Nil(t, j.Close())
+
+	j, err = OpenTransferJournal(path)
+	require.Nil(t, err)
+	require.Nil(t, j.Discard())
+	assert.False(t, j.Completed(journalOid(1)))
+	require.Nil(t, j.Record(journalOid(2)))
+	require.Nil(t, j.Close())
+
+	by, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, journalOid(2)+"\n", string(by))
+}
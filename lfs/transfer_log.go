@@ -0,0 +1,130 @@
+package lfs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/github/git-lfs/errors"
+	"github.com/github/git-lfs/transfer"
+)
+
+// Outcomes of a transfer recorded in the transfer log.
+const (
+	transferCompleted = "completed"
+	transferFailed    = "failed"
+	transferRetried   = "retried"
+)
+
+// transferLogEntry is a line of the transfer log, written as JSON.
+type transferLogEntry struct {
+	Time       string  `json:"time"`
+	Oid        string  `json:"oid"`
+	Size       int64   `json:"size"`
+	Name       string  `json:"name"`
+	Direction  string  `json:"direction"`
+	DurationMs float64 `json:"duration_ms"`
+	Outcome    string  `json:"outcome"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// transferLog appends a line to the file given by GIT_LFS_TRANSFER_LOG or
+// lfs.transfer.log for each transfer which completes, fails, or is retried, so
+// that intermittent failures can be looked into afterwards. A nil transferLog
+// records nothing.
+type transferLog struct {
+	mu      sync.Mutex
+	f       *os.File
+	started map[string]time.Time // when each OID was handed to the adapter
+}
+
+// newTransferLog opens the transfer log at "path", which must be absolute,
+// creating it if needed. It returns nil if "path" is empty.
+func newTransferLog(path string) (*transferLog, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	if !filepath.IsAbs(path) {
+		return nil, errors.Errorf("the transfer log must be an absolute path, not %q", path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transferLog{f: f, started: make(map[string]time.Time)}, nil
+}
+
+// Start notes that the object "oid" has been handed to the adapter, so that
+// its transfer can be timed.
+func (l *transferLog) Start(oid string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	l.started[oid] = time.Now()
+	l.mu.Unlock()
+}
+
+// Record writes a line for the transfer "t" in direction "dir", which ended
+// with "outcome", and the error "err" unless it completed.
+func (l *transferLog) Record(t *transfer.Transfer, dir, outcome string, err error) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	e := &transferLogEntry{
+		Time:      now.UTC().Format(time.RFC3339Nano),
+		Oid:       t.Object.Oid,
+		Size:      t.Object.Size,
+		Name:      t.Name,
+		Direction: dir,
+		Outcome:   outcome,
+	}
+	if started, ok := l.started[e.Oid]; ok {
+		e.DurationMs = float64(now.Sub(started)) / float64(time.Millisecond)
+		delete(l.started, e.Oid)
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	if l.f == nil {
+		// The log has been closed, since Wait returned after timing
+		// out before this transfer finished.
+		return
+	}
+
+	line, _ := json.Marshal(e)
+	// Each line is written at once, so that lines from processes which
+	// share the log, such as concurrent smudges, don't interleave.
+	l.f.Write(append(line, '\n'))
+}
+
+// Close closes the log file. Anything recorded afterwards is dropped.
+func (l *transferLog) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f := l.f
+	l.f = nil
+	if f == nil {
+		return nil
+	}
+	return f.Close()
+}
@@ -0,0 +1,133 @@
+package lfs
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/github/git-lfs/api"
+	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/errors"
+	"github.com/github/git-lfs/transfer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempTransferLogPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "lfs-transfer-log")
+	require.Nil(t, err)
+	return filepath.Join(dir, "logs", "transfers.log"), func() { os.RemoveAll(dir) }
+}
+
+func readTransferLog(t *testing.T, path string) []*transferLogEntry {
+	f, err := os.Open(path)
+	require.Nil(t, err)
+	defer f.Close()
+
+	var entries []*transferLogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		e := &transferLogEntry{}
+		require.Nil(t, json.Unmarshal(scanner.Bytes(), e))
+		entries = append(entries, e)
+	}
+	require.Nil(t, scanner.Err())
+	return entries
+}
+
+func TestTransferLogRecordsOutcomes(t *testing.T) {
+	path, cleanup := tempTransferLogPath(t)
+	defer cleanup()
+
+	l, err := newTransferLog(path)
+	require.Nil(t, err)
+
+	tr := transfer.NewTransfer("a.dat", &api.ObjectResource{Oid: oidA, Size: 3}, "", 0)
+	l.Start(oidA)
+	l.Record(tr, "download", transferRetried, errors.New("connection reset"))
+	l.Start(oidA)
+	l.Record(tr, "download", transferCompleted, nil)
+	require.Nil(t, l.Close())
+
+	// Nothing is written once the log is closed.
+	l.Record(tr, "download", transferFailed, errors.New("too late"))
+
+	entries := readTransferLog(t, path)
+	require.Len(t, entries, 2)
+	for _, e := range entries {
+		assert.Equal(t, oidA, e.Oid)
+		assert.EqualValues(t, 3, e.Size)
+		assert.Equal(t, "a.dat", e.Name)
+		assert.Equal(t, "download", e.Direction)
+		assert.NotEmpty(t, e.Time)
+		assert.True(t, e.DurationMs >= 0)
+	}
+	assert.Equal(t, transferRetried, entries[0].Outcome)
+	assert.Equal(t, "connection reset", entries[0].Error)
+	assert.Equal(t, transferCompleted, entries[1].Outcome)
+	assert.Empty(t, entries[1].Error)
+
+	// Later runs append to the log.
+	l, err = newTransferLog(path)
+	require.Nil(t, err)
+	l.Record(tr, "upload", transferFailed, errors.New("denied"))
+	require.Nil(t, l.Close())
+	assert.Len(t, readTransferLog(t, path), 3)
+}
+
+func TestTransferLogDisabled(t *testing.T) {
+	l, err := newTransferLog("")
+	assert.Nil(t, err)
+	assert.Nil(t, l)
+
+	// A nil log records nothing.
+	l.Start(oidA)
+	l.Record(transfer.NewTransfer("a.dat", &api.ObjectResource{Oid: oidA}, "", 0), "download", transferCompleted, nil)
+	assert.Nil(t, l.Close())
+
+	_, err = newTransferLog(filepath.Join("relative", "transfers.log"))
+	assert.NotNil(t, err)
+}
+
+func TestTransferQueueWritesTransferLog(t *testing.T) {
+	path, cleanup := tempTransferLogPath(t)
+	defer cleanup()
+
+	q := NewDownloadQueue(2, 2, false)
+	q.log, _ = newTransferLog(path)
+	q.manifest.RegisterNewTransferAdapterFunc("completing", transfer.Download, func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &completingAdapter{dir: dir, fail: map[string]bool{oidB: true}}
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		var objs []*api.ObjectResource
+		for _, o := range objects {
+			objs = append(objs, downloadable(o.Oid))
+		}
+		return objs, "completing", nil
+	}
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.Wait()
+
+	entries := readTransferLog(t, path)
+	require.Len(t, entries, 2)
+	sort.Sort(transferLogEntriesByOid(entries))
+
+	assert.Equal(t, oidA, entries[0].Oid)
+	assert.Equal(t, transferCompleted, entries[0].Outcome)
+	assert.Equal(t, "download", entries[0].Direction)
+	assert.Equal(t, oidB, entries[1].Oid)
+	assert.Equal(t, transferFailed, entries[1].Outcome)
+	assert.Equal(t, "failed", entries[1].Error)
+}
+
+type transferLogEntriesByOid []*transferLogEntry
+
+func (e transferLogEntriesByOid) Len() int           { return len(e) }
+func (e transferLogEntriesByOid) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e transferLogEntriesByOid) Less(i, j int) bool { return e[i].Oid < e[j].Oid }
@@ -0,0 +1,84 @@
+package lfs
+
+import (
+	"expvar"
+	"sync/atomic"
+
+	"github.com/github/git-lfs/errors"
+)
+
+// QueueMetrics is a snapshot of a TransferQueue's counters, as returned by
+// MetricsSnapshot. The counters cover the current run of the queue, and start
+// again from zero when it is Reset.
+type QueueMetrics struct {
+	// Added is the number of distinct objects added to the queue,
+	// excluding those which were filtered out or already transferred.
+	Added int64 `json:"added"`
+	// Completed is the number of objects which were transferred
+	// successfully.
+	Completed int64 `json:"completed"`
+	// Failed is the number of objects which failed, and won't be retried.
+	Failed int64 `json:"failed"`
+	// Retried is the number of times an object was queued again after
+	// an error.
+	Retried int64 `json:"retried"`
+	// Bytes is the number of bytes transferred so far, including those of
+	// transfers which are still in progress, failed or were retried.
+	Bytes int64 `json:"bytes"`
+	// InFlight is the number of objects being transferred right now; see
+	// InFlight.
+	InFlight int64 `json:"in_flight"`
+	// BatchDepth is the number of objects waiting to be sent to the API.
+	BatchDepth int64 `json:"batch_depth"`
+}
+
+// queueCounters holds the counters behind QueueMetrics, which are only read
+// and written atomically, so that updating them doesn't need a lock.
+type queueCounters struct {
+	added      int64
+	completed  int64
+	failed     int64
+	retried    int64
+	bytes      int64
+	batchDepth int64
+}
+
+// reset sets every counter back to zero.
+func (c *queueCounters) reset() {
+	atomic.StoreInt64(&c.added, 0)
+	atomic.StoreInt64(&c.completed, 0)
+	atomic.StoreInt64(&c.failed, 0)
+	atomic.StoreInt64(&c.retried, 0)
+	atomic.StoreInt64(&c.bytes, 0)
+	atomic.StoreInt64(&c.batchDepth, 0)
+}
+
+// MetricsSnapshot returns the current values of the queue's counters. It may
+// be called at any time, from any goroutine.
+func (q *TransferQueue) MetricsSnapshot() QueueMetrics {
+	c := q.counters
+	return QueueMetrics{
+		Added:      atomic.LoadInt64(&c.added),
+		Completed:  atomic.LoadInt64(&c.completed),
+		Failed:     atomic.LoadInt64(&c.failed),
+		Retried:    atomic.LoadInt64(&c.retried),
+		Bytes:      atomic.LoadInt64(&c.bytes),
+		InFlight:   int64(atomic.LoadInt32(&q.inFlight)),
+		BatchDepth: atomic.LoadInt64(&c.batchDepth),
+	}
+}
+
+// RegisterExpvar publishes the queue's MetricsSnapshot as the expvar variable
+// "name", so that it is served by expvar's HTTP handler with live values. It
+// returns an error if a variable with that name has already been published,
+// since expvar variables can't be removed or replaced.
+func (q *TransferQueue) RegisterExpvar(name string) error {
+	if expvar.Get(name) != nil {
+		return errors.Errorf("expvar %q is already published", name)
+	}
+
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return q.MetricsSnapshot()
+	}))
+	return nil
+}
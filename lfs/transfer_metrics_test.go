@@ -0,0 +1,93 @@
+package lfs
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"testing"
+
+	"github.com/github/git-lfs/api"
+	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/transfer"
+	"github.com/stretchr/testify/assert"
+)
+
+// reportingAdapter is a completingAdapter which reports each object's bytes
+// to the progress callback before finishing it.
+type reportingAdapter struct {
+	*completingAdapter
+	cb transfer.TransferProgressCallback
+}
+
+func (a *reportingAdapter) Begin(maxConcurrency int, cb transfer.TransferProgressCallback, completion chan transfer.TransferResult) error {
+	a.cb = cb
+	return a.completingAdapter.Begin(maxConcurrency, cb, completion)
+}
+
+func (a *reportingAdapter) Add(t *transfer.Transfer) {
+	a.cb(t.Name, t.Object.Size, t.Object.Size, int(t.Object.Size))
+	a.completingAdapter.Add(t)
+}
+
+func runMetricsQueue(t *testing.T) *TransferQueue {
+	q := NewUploadQueue(3, 6, false)
+	q.RegisterAdapter("completing", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &reportingAdapter{completingAdapter: &completingAdapter{dir: dir, fail: map[string]bool{oidB: true}}}
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			objs = append(objs, &api.ObjectResource{
+				Oid:     o.Oid,
+				Size:    o.Size,
+				Actions: map[string]*api.LinkRelation{"upload": {Href: "https://example.com/" + o.Oid}},
+			})
+		}
+		return objs, "completing", nil
+	}
+
+	assert.Equal(t, QueueMetrics{}, q.MetricsSnapshot())
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 2})
+	q.Add(&queueTestTransferable{oid: oidC, size: 3})
+	q.Wait()
+	return q
+}
+
+func TestTransferQueueMetricsSnapshot(t *testing.T) {
+	q := runMetricsQueue(t)
+
+	assert.Equal(t, QueueMetrics{
+		Added:     3,
+		Completed: 2,
+		Failed:    1,
+		Bytes:     6,
+	}, q.MetricsSnapshot())
+
+	assert.Nil(t, q.Reset(0, 0))
+	assert.Equal(t, QueueMetrics{}, q.MetricsSnapshot())
+}
+
+func TestTransferQueueMetricsCountRetries(t *testing.T) {
+	q, _ := runFailingQueue(networkErr())
+
+	m := q.MetricsSnapshot()
+	assert.Equal(t, int64(1), m.Added)
+	assert.Equal(t, int64(1), m.Retried)
+	assert.Equal(t, int64(0), m.Failed)
+	assert.Equal(t, int64(0), m.BatchDepth)
+}
+
+func TestTransferQueueRegisterExpvar(t *testing.T) {
+	q := runMetricsQueue(t)
+
+	// expvar variables can't be removed, so each run needs its own name.
+	name := fmt.Sprintf("lfs-test-queue-%p", q)
+	assert.Nil(t, q.RegisterExpvar(name))
+	assert.NotNil(t, q.RegisterExpvar(name))
+
+	var m QueueMetrics
+	assert.Nil(t, json.Unmarshal([]byte(expvar.Get(name).String()), &m))
+	assert.Equal(t, q.MetricsSnapshot(), m)
+}
@@ -0,0 +1,100 @@
+package lfs
+
+import (
+	"fmt"
+
+	"github.com/github/git-lfs/api"
+	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/errors"
+	"github.com/rubyist/tracerx"
+)
+
+// mirrorBatchFunc makes a batch API request to a mirror. It has the same
+// signature as api.BatchFrom.
+type mirrorBatchFunc func(cfg *config.Configuration, endpoint config.Endpoint, objects []*api.ObjectResource, operation string, transferAdapters []string) ([]*api.ObjectResource, string, error)
+
+// batchEndpoint is one of the endpoints which the queue sends batch API
+// requests to: a mirror, or the configured endpoint if mirror is nil.
+type batchEndpoint struct {
+	mirror *config.Mirror
+}
+
+// batchEndpoints returns the endpoints to send batch API requests for
+// "operation" to, in the order to try them. The configured endpoint has
+// config.EndpointPriority, and goes before mirrors with the same priority.
+func batchEndpoints(cfg *config.Configuration, operation string) []batchEndpoint {
+	mirrors := cfg.Mirrors(operation)
+	endpoints := make([]batchEndpoint, 0, len(mirrors)+1)
+
+	added := false
+	for i := range mirrors {
+		if !added && mirrors[i].Priority >= config.EndpointPriority {
+			endpoints = append(endpoints, batchEndpoint{})
+			added = true
+		}
+		endpoints = append(endpoints, batchEndpoint{mirror: &mirrors[i]})
+	}
+	if !added {
+		endpoints = append(endpoints, batchEndpoint{})
+	}
+
+	return endpoints
+}
+
+// describeEndpoint names "e" for traces, redacting any credentials in its URL.
+func (q *TransferQueue) describeEndpoint(e batchEndpoint) string {
+	if e.mirror == nil {
+		return fmt.Sprintf("the LFS endpoint (%s)", config.RedactURL(config.Config.Endpoint(q.transferKind()).Url))
+	}
+	return fmt.Sprintf("mirror %q (%s)", e.mirror.Name, config.RedactURL(e.mirror.Endpoint.Url))
+}
+
+// batch sends a batch API request for "transfers" to each of the queue's
+// endpoints in turn, until one answers, and returns its response, so that the
+// objects are transferred with the actions given by that endpoint. "label"
+// names the request in traces.
+//
+// Failing over to the next endpoint isn't a retry: the objects' retry counts
+// are untouched, and they are only retried, by the caller, once every endpoint
+// has failed. Client errors aren't failed over from, since they would fail
+// the same way elsewhere, and nor is the configured endpoint not implementing
+// the batch API, so that the caller can fall back to the legacy API.
+func (q *TransferQueue) batch(label string, transfers []*api.ObjectResource, transferAdapterNames []string) ([]*api.ObjectResource, string, error) {
+	if len(q.endpoints) < 2 {
+		return q.batchFunc(config.Config, transfers, q.transferKind(), transferAdapterNames)
+	}
+
+	var err error
+	for i, e := range q.endpoints {
+		var objs []*api.ObjectResource
+		var adapterName string
+		if e.mirror == nil {
+			objs, adapterName, err = q.batchFunc(config.Config, transfers, q.transferKind(), transferAdapterNames)
+		} else {
+			objs, adapterName, err = q.mirrorBatchFunc(config.Config, e.mirror.Endpoint, transfers, q.transferKind(), transferAdapterNames)
+		}
+
+		if err == nil {
+			tracerx.Printf("tq: %s served by %s", label, q.describeEndpoint(e))
+			return objs, adapterName, nil
+		}
+
+		if !canFailOver(e, err) || i == len(q.endpoints)-1 {
+			tracerx.Printf("tq: %s failed on %s: %s", label, q.describeEndpoint(e), err)
+			break
+		}
+
+		tracerx.Printf("tq: %s failed on %s, failing over to %s: %s", label, q.describeEndpoint(e), q.describeEndpoint(q.endpoints[i+1]), err)
+	}
+
+	return nil, "", err
+}
+
+// canFailOver returns whether a batch API request which failed on "e" with
+// "err" should be sent to the next endpoint.
+func canFailOver(e batchEndpoint, err error) bool {
+	if errors.IsNotImplementedError(err) {
+		return e.mirror != nil
+	}
+	return errors.CategoryOf(err) != errors.ClientCategory
+}
@@ -0,0 +1,175 @@
+package lfs
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/github/git-lfs/api"
+	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchEndpointsOrderedByPriority(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.mirror.cdn.url":         "https://cdn.example.com/repo",
+			"lfs.mirror.cdn.priority":    "-1",
+			"lfs.mirror.tie.url":         "https://tie.example.com/repo",
+			"lfs.mirror.tie.priority":    "0",
+			"lfs.mirror.spare.url":       "https://spare.example.com/repo",
+			"lfs.mirror.upload.url":      "https://upload.example.com/repo",
+			"lfs.mirror.upload.role":     "upload",
+			"lfs.mirror.upload.priority": "-5",
+		},
+	})
+
+	var names []string
+	for _, e := range batchEndpoints(cfg, "download") {
+		if e.mirror == nil {
+			names = append(names, "")
+		} else {
+			names = append(names, e.mirror.Name)
+		}
+	}
+	assert.Equal(t, []string{"cdn", "", "tie", "spare"}, names)
+}
+
+func TestBatchEndpointsWithoutMirrors(t *testing.T) {
+	endpoints := batchEndpoints(config.NewFrom(config.Values{}), "upload")
+	if assert.Len(t, endpoints, 1) {
+		assert.Nil(t, endpoints[0].mirror)
+	}
+}
+
+// mirroredQueue is a dry run download queue for the OID oidA, whose batch API
+// requests go to a mirror named "mirror" before the configured endpoint, each
+// answered by the given func. It records the download hrefs handed on.
+type mirroredQueue struct {
+	*TransferQueue
+
+	mu            sync.Mutex
+	mirrorCalls   int
+	endpointCalls int
+	hrefs         []string
+}
+
+func newMirroredQueue(mirror, endpoint func(calls int) ([]*api.ObjectResource, error)) *mirroredQueue {
+	m := &mirroredQueue{TransferQueue: NewDownloadQueue(1, 1, true)}
+	m.endpoints = []batchEndpoint{
+		{mirror: &config.Mirror{Name: "mirror", Endpoint: config.Endpoint{Url: "https://mirror.example.com"}}},
+		{},
+	}
+	m.mirrorBatchFunc = func(cfg *config.Configuration, e config.Endpoint, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		m.mu.Lock()
+		m.mirrorCalls++
+		calls := m.mirrorCalls
+		m.mu.Unlock()
+
+		objs, err := mirror(calls)
+		return objs, "basic", err
+	}
+	m.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		m.mu.Lock()
+		m.endpointCalls++
+		calls := m.endpointCalls
+		m.mu.Unlock()
+
+		objs, err := endpoint(calls)
+		return objs, "basic", err
+	}
+	m.SetObjectRewriter(func(o *api.ObjectResource) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.hrefs = append(m.hrefs, o.Actions["download"].Href)
+		return nil
+	})
+	return m
+}
+
+func (m *mirroredQueue) run() {
+	m.Add(&queueTestTransferable{oid: oidA, size: 1})
+	m.Wait()
+}
+
+func mirrored(href string) []*api.ObjectResource {
+	o := downloadable(oidA)
+	o.Actions["download"].Href = href
+	return []*api.ObjectResource{o}
+}
+
+func TestTransferQueueUsesTheFirstMirrorToAnswer(t *testing.T) {
+	q := newMirroredQueue(func(int) ([]*api.ObjectResource, error) {
+		return mirrored("https://mirror.example.com/a"), nil
+	}, func(int) ([]*api.ObjectResource, error) {
+		t.Error("expected the configured endpoint not to be asked")
+		return nil, statusErr(500)
+	})
+	q.run()
+
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, 1, q.mirrorCalls)
+	assert.Equal(t, 0, q.endpointCalls)
+	assert.Equal(t, []string{"https://mirror.example.com/a"}, q.hrefs)
+}
+
+func TestTransferQueueFailsOverWithoutUsingRetries(t *testing.T) {
+	q := newMirroredQueue(func(int) ([]*api.ObjectResource, error) {
+		return nil, networkErr()
+	}, func(int) ([]*api.ObjectResource, error) {
+		return mirrored("https://lfs.example.com/a"), nil
+	})
+	q.run()
+
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, 1, q.mirrorCalls)
+	assert.Equal(t, 1, q.endpointCalls)
+	assert.Equal(t, []string{"https://lfs.example.com/a"}, q.hrefs)
+	assert.Empty(t, q.retryCount[oidA])
+}
+
+func TestTransferQueueFailsOverFromMirrorsWithoutBatchAPI(t *testing.T) {
+	q := newMirroredQueue(func(int) ([]*api.ObjectResource, error) {
+		return nil, errors.NewNotImplementedError(errors.New("no batch endpoint"))
+	}, func(int) ([]*api.ObjectResource, error) {
+		return mirrored("https://lfs.example.com/a"), nil
+	})
+	q.run()
+
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, 1, q.endpointCalls)
+	assert.False(t, q.UsedLegacyFallback())
+}
+
+func TestTransferQueueDoesNotFailOverAfterClientErrors(t *testing.T) {
+	q := newMirroredQueue(func(int) ([]*api.ObjectResource, error) {
+		return nil, statusErr(403)
+	}, func(int) ([]*api.ObjectResource, error) {
+		t.Error("expected the configured endpoint not to be asked")
+		return mirrored("https://lfs.example.com/a"), nil
+	})
+	q.run()
+
+	assert.Len(t, q.Errors(), 1)
+	assert.Equal(t, 1, q.mirrorCalls)
+	assert.Equal(t, 0, q.endpointCalls)
+}
+
+func TestTransferQueueRetriesOnceEveryEndpointFails(t *testing.T) {
+	q := newMirroredQueue(func(int) ([]*api.ObjectResource, error) {
+		return nil, networkErr()
+	}, func(calls int) ([]*api.ObjectResource, error) {
+		if calls == 1 {
+			return nil, networkErr()
+		}
+		return mirrored("https://lfs.example.com/a"), nil
+	})
+	q.run()
+
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, 2, q.mirrorCalls)
+	assert.Equal(t, 2, q.endpointCalls)
+	// Both endpoints failing counts as one retry, not two.
+	assert.Equal(t, 1, q.retryCount[oidA][errors.NetworkCategory])
+}
@@ -1,20 +1,29 @@
 package lfs
 
 import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/github/git-lfs/api"
 	"github.com/github/git-lfs/config"
 	"github.com/github/git-lfs/errors"
 	"github.com/github/git-lfs/git"
+	"github.com/github/git-lfs/httputil"
+	"github.com/github/git-lfs/metrics"
 	"github.com/github/git-lfs/progress"
+	"github.com/github/git-lfs/tools"
 	"github.com/github/git-lfs/transfer"
 	"github.com/rubyist/tracerx"
 )
 
 const (
-	batchSize         = 100
-	defaultMaxRetries = 1
+	batchSize = 100
 )
 
 type Transferable interface {
@@ -28,6 +37,81 @@ type Transferable interface {
 	LegacyCheck() (*api.ObjectResource, error)
 }
 
+// MetadataTransferable is implemented by Transferables with extra fields for
+// their object in batch API requests, such as the ref or commit it belongs to,
+// for servers whose authorization policy needs them.
+type MetadataTransferable interface {
+	RequestMetadata() map[string]interface{}
+}
+
+// requestObject returns the object to send in a batch API request for "t".
+func requestObject(t Transferable) *api.ObjectResource {
+	obj := &api.ObjectResource{Oid: t.Oid(), Size: t.Size()}
+	if m, ok := t.(MetadataTransferable); ok {
+		obj.Metadata = m.RequestMetadata()
+	}
+	return obj
+}
+
+// DryRunEntry describes what a dry run TransferQueue would have done with a
+// single object, based on the server's response to the API request for it.
+type DryRunEntry struct {
+	Name      string `json:"name"`
+	Oid       string `json:"oid"`
+	Size      int64  `json:"size"`
+	Direction string `json:"direction"`
+	// Action is "upload" or "download" if the object would have been
+	// transferred, or "skip" if the server returned no action for it, for
+	// example because it already has an object being uploaded.
+	Action string `json:"action"`
+}
+
+// DryRunCallback receives a DryRunEntry for each object processed by a dry run
+// TransferQueue. It may be called from multiple goroutines.
+type DryRunCallback func(e *DryRunEntry)
+
+// Reasons given to a SkipCallback for not transferring an object.
+const (
+	// SkipAlreadyPresent means that the object is already where it would
+	// have been transferred to: the server returned no upload action for
+	// it, or an earlier run recorded it in the queue's journal.
+	SkipAlreadyPresent = "already-present"
+	// SkipDryRun means that the object would have been transferred, but
+	// the queue is a dry run.
+	SkipDryRun = "dry-run"
+	// SkipFiltered means that the filter given to SetFilter rejected the
+	// object, so the queue never asked the server about it.
+	SkipFiltered = "filtered"
+	// SkipNoAction means that the object couldn't be transferred: the
+	// server returned no download action for it, or the queue had already
+	// finished with it when the server's response arrived.
+	SkipNoAction = "no-action"
+	// SkipCancelled means that the object was given to CancelObject before
+	// it finished transferring.
+	SkipCancelled = "cancelled"
+)
+
+// SkipCallback is called with the OID and size of each object which a
+// TransferQueue finishes without transferring or failing to transfer it, and
+// one of the Skip* reasons. It may be called from multiple goroutines.
+type SkipCallback func(oid string, size int64, reason string)
+
+// ObjectRewriter is given each object returned by the batch API which needs to
+// be transferred, before the transfer starts, so that it can change the
+// object's actions, for example to sign their URLs or to send them through a
+// proxy. If it returns an error, the object fails with it. It may be called
+// from multiple goroutines.
+type ObjectRewriter func(o *api.ObjectResource) error
+
+// batchFunc makes a batch API request for the given objects, returning the
+// server's response for each and the name of the transfer adapter to use. It
+// has the same signature as api.Batch.
+type batchFunc func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, transferAdapters []string) ([]*api.ObjectResource, string, error)
+
+// refreshFunc requests fresh actions for an object whose actions have expired.
+// It is api.RefreshObject, except in tests.
+type refreshFunc func(cfg *config.Configuration, obj *api.ObjectResource, operation string, transferAdapters []string) (*api.ObjectResource, error)
+
 // TransferQueue organises the wider process of uploading and downloading,
 // including calling the API, passing the actual transfer request to transfer
 // adapters, and dealing with progress, errors and retries.
@@ -37,76 +121,455 @@ type TransferQueue struct {
 	adapterInProgress bool
 	adapterResultChan chan transfer.TransferResult
 	adapterInitMutex  sync.Mutex
+	adapterAdds       sync.WaitGroup // calls to the adapter's Add which haven't returned
+	adapterStopped    bool           // set once a timed out queue stops using the adapter
 	dryRun            bool
 	meter             *progress.ProgressMeter
 	errors            []error
-	transferables     map[string]Transferable
+	transferables     map[string]Transferable // unfinished, including retries; see finish
+	cancelled         map[string]bool         // given to CancelObject since last added; guarded by trMutex
 	batcher           *Batcher
+	batchFunc         batchFunc
+	refreshFunc       refreshFunc
+	expiryMargin      time.Duration     // refresh actions expiring within this
 	apic              chan Transferable // Channel for processing individual API requests
 	retriesc          chan Transferable // Channel for processing retries
-	errorc            chan error        // Channel for processing errors
-	watchers          []chan string
+	watchers          []*watcher
+	skipWatchers      []*watcher
+	presentWatchers   []*watcher
+	resultWatchers    []*watcher
+	filter            TransferFilter
+	dryRunCb          DryRunCallback
+	skipCb            SkipCallback
+	rewriter          ObjectRewriter
+	journal           *TransferJournal
+	log               *transferLog // see lfs.transfer.log
+	hosts             *hostLimiter // see lfs.transfer.maxperhost
 	trMutex           *sync.Mutex
-	errorwait         sync.WaitGroup
 	retrywait         sync.WaitGroup
+	apiwait           sync.WaitGroup // waits for the API routines to stop
 	// wait is used to keep track of pending transfers. It is incremented
 	// once per unique OID on Add(), and is decremented when that transfer
 	// is marked as completed or failed, but not retried.
 	wait          sync.WaitGroup
 	oldApiWorkers int // Number of non-batch API workers to spawn (deprecated)
-	manifest      *transfer.Manifest
-	rmu           sync.Mutex        // rmu guards retryCount
-	retryCount    map[string]uint32 // maps OIDs to number of retry attempts
-	// maxRetries is the maximum number of retries a single object can
-	// attempt to make before it will be dropped.
-	maxRetries uint32
+	// transferWorkers is the number of objects the adapter transfers at
+	// once, as configured for the queue's direction.
+	transferWorkers int
+	manifest        *transfer.Manifest
+	rmu             sync.Mutex                         // rmu guards retryCount, attempts and deadline
+	retryCount      map[string]map[errors.Category]int // maps OIDs to number of retry attempts by error category
+	attempts        map[string]time.Time               // maps OIDs to when their latest attempt began
+	deadline        time.Time                          // when the queue times out, if it has a time limit
+	// maxNetworkRetries is the maximum number of retries a single object
+	// can make after network errors before it will be dropped, and
+	// maxRetries is the maximum after any other errors. Client errors are
+	// never retried, unless retryAllErrors is set, which is
+	// lfs.transfer.retryallerrors: then any error may be retried up to
+	// maxRetries times.
+	maxRetries        int
+	maxNetworkRetries int
+	retryAllErrors    bool
+	// retriableStatuses holds the HTTP status codes given by
+	// lfs.transfer.retriablestatuses. Errors carrying a status are retried
+	// if and only if it's one of them, unless it's nil, when the
+	// classification in CanRetryTransfer is used.
+	retriableStatuses map[int]bool
+	// maxFailures is the number of errors after which the queue abandons
+	// transfers which haven't started yet, or zero for no limit. abortc is
+	// closed when that happens.
+	maxFailures int
+	abortc      chan struct{}
+	abortOnce   sync.Once
+	// expiredc is closed when lfs.transfer.timeout or the time given to
+	// WaitWithTimeout passes, after which Wait returns without waiting for
+	// transfers still in progress. expiredAfter is the time which passed,
+	// and expiryHint is added to the errors for unfinished transfers.
+	timeout      time.Duration
+	timer        *clockTimer // fires after lfs.transfer.timeout
+	expiredc     chan struct{}
+	expireOnce   sync.Once
+	expiredAfter time.Duration
+	expiryHint   string
+	// watchMu guards the watcher slices, and sends to watchers against
+	// them being closed by Wait, which may happen while transfers are
+	// still running if the queue times out. closed is set once they have
+	// been closed.
+	watchMu sync.RWMutex
+	closed  bool
+	errMu   sync.Mutex // errMu guards errors and failures
+	// failures is the number of errors recorded since the queue started,
+	// for lfs.transfer.maxfailures.
+	failures int
+	// usedLegacyFallback is set to 1, atomically, once the queue has
+	// fallen back to the legacy API.
+	usedLegacyFallback uint32
+	// inFlight is the number of objects which have been handed to the
+	// adapter and haven't finished, updated atomically.
+	inFlight int32
+	// presentCount and presentBytes total up the objects which were
+	// already present, updated atomically; see AlreadyPresent.
+	presentCount int64
+	presentBytes int64
+	// order is lfs.transfer.order. Unless it is "fifo", transferables are
+	// held until Wait is called, and then sorted. heldMu guards held, and
+	// released, which is set once they have been.
+	order    string
+	heldMu   sync.Mutex
+	held     []Transferable
+	released bool
+	// adapterErr is the error from the adapter failing to begin, which is
+	// returned without trying again. It is reported once, by
+	// adapterErrOnce.
+	adapterErr     error
+	adapterErrOnce sync.Once
+	// quiet is set by SetQuiet, so that the meters built by Reset are
+	// quiet too.
+	quiet bool
+	// prebatched holds the batch API responses requested ahead of time by
+	// PreBatch, by OID, until the batchApiRoutine reaches those objects.
+	// prebatchAdapter is the adapter the server chose for them. pbMu
+	// guards both.
+	prebatched      map[string]*api.ObjectResource
+	prebatchAdapter string
+	pbMu            sync.Mutex
+	// usedHTTP2 returns whether a host has answered over HTTP/2.
+	usedHTTP2 func(host string) bool
+	// maxPending is lfs.transfer.maxpending, the number of unfinished
+	// transferables at which Add blocks, or zero for no limit. pendingCond
+	// is signalled, with trMutex, when one finishes or the queue stops.
+	maxPending  int
+	pendingCond *sync.Cond
+	// verifyUploads is lfs.transfer.verifyupload, whether to hash each
+	// object before uploading it.
+	verifyUploads bool
+	// counters are the queue's counters for MetricsSnapshot.
+	counters *queueCounters
+	// clock is used for the queue's timeouts, deadlines and retries,
+	// rather than the time package, so that tests can replace it.
+	clock clock
+	// endpoints are the endpoints which batch API requests are sent to,
+	// in the order to try them, from lfs.mirror.<name>.* and the
+	// configured endpoint. Mirrors are asked with mirrorBatchFunc.
+	endpoints       []batchEndpoint
+	mirrorBatchFunc mirrorBatchFunc
 }
 
+// retryAllErrorsWarning warns that lfs.transfer.retryallerrors is set once,
+// however many queues are built, as retriableStatusesWarning does about
+// invalid entries in lfs.transfer.retriablestatuses.
+var (
+	retryAllErrorsWarning    sync.Once
+	retriableStatusesWarning sync.Once
+)
+
 // newTransferQueue builds a TransferQueue, direction and underlying mechanism determined by adapter
 func newTransferQueue(files int, size int64, dryRun bool, dir transfer.Direction) *TransferQueue {
+	q := &TransferQueue{
+		direction:         dir,
+		dryRun:            dryRun,
+		oldApiWorkers:     config.Config.TransferAPIConcurrency(),
+		trMutex:           &sync.Mutex{},
+		manifest:          transfer.ConfigureManifest(transfer.NewManifest(), config.Config),
+		maxRetries:        config.Config.TransferMaxRetries(),
+		maxNetworkRetries: config.Config.TransferMaxNetworkRetries(),
+		retryAllErrors:    config.Config.TransferRetryAllErrors(),
+		maxFailures:       config.Config.TransferMaxFailures(),
+		batchFunc:         api.Batch,
+		mirrorBatchFunc:   api.BatchFrom,
+		refreshFunc:       api.RefreshObject,
+		usedHTTP2:         httputil.UsedHTTP2,
+		expiryMargin:      config.Config.TransferExpiryMargin(),
+		order:             config.Config.TransferOrder(),
+		maxPending:        config.Config.TransferMaxPending(),
+		verifyUploads:     config.Config.TransferVerifyUploads(),
+		counters:          &queueCounters{},
+		clock:             realClock{},
+	}
+	q.pendingCond = sync.NewCond(q.trMutex)
+	q.transferWorkers = config.Config.DirectionalConcurrentTransfers(q.transferKind())
+	q.endpoints = batchEndpoints(config.Config, q.transferKind())
+	q.retriableStatuses = retriableStatuses(config.Config)
+
+	if q.retryAllErrors {
+		retryAllErrorsWarning.Do(func() {
+			fmt.Fprintf(os.Stderr, "WARNING: lfs.transfer.retryallerrors is set, so objects are retried after any error,\n")
+			fmt.Fprintf(os.Stderr, "including ones which will only fail again, and uploads which may have partly succeeded.\n")
+		})
+	}
+
+	q.start(files, size)
+
+	return q
+}
+
+// start sets up the state for a single run of the queue, expecting "files"
+// objects of "size" bytes in total, and starts its goroutines.
+func (q *TransferQueue) start(files int, size int64) {
 	logPath, _ := config.Config.Os.Get("GIT_LFS_PROGRESS")
 
-	q := &TransferQueue{
-		direction:     dir,
-		dryRun:        dryRun,
-		meter:         progress.NewProgressMeter(files, size, dryRun, logPath),
-		apic:          make(chan Transferable, batchSize),
-		retriesc:      make(chan Transferable, batchSize),
-		errorc:        make(chan error),
-		oldApiWorkers: config.Config.ConcurrentTransfers(),
-		transferables: make(map[string]Transferable),
-		trMutex:       &sync.Mutex{},
-		manifest:      transfer.ConfigureManifest(transfer.NewManifest(), config.Config),
-		retryCount:    make(map[string]uint32),
-		maxRetries:    defaultMaxRetries,
-	}
-
-	q.errorwait.Add(1)
+	q.meter = progress.NewProgressMeter(files, size, q.dryRun, q.quiet || quietProgress(), logPath)
+	q.apic = make(chan Transferable, batchSize)
+	q.retriesc = make(chan Transferable, batchSize)
+	q.transferables = make(map[string]Transferable)
+	q.cancelled = make(map[string]bool)
+	q.retryCount = make(map[string]map[errors.Category]int)
+	q.attempts = make(map[string]time.Time)
+	q.deadline = time.Time{}
+	q.failures = 0
+	q.prebatched = make(map[string]*api.ObjectResource)
+	q.abortc = make(chan struct{})
+	q.expiredc = make(chan struct{})
+
+	log, err := newTransferLog(config.Config.TransferLogPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening transfer log: %s\n", err)
+	}
+	q.log = log
+	q.hosts = newHostLimiter(config.Config.TransferMaxPerHost())
+
 	q.retrywait.Add(1)
 
 	q.run()
+	q.startTimeout(config.Config.TransferTimeout())
+}
 
-	return q
+// Reset prepares the queue to be used again, expecting "files" objects of
+// "size" bytes in total, rather than building a new one. It clears the
+// transferables, retry counts and errors from the last run, and starts the
+// queue's goroutines again. Its settings, such as the filter, callbacks and
+// registered adapters, are kept, but channels from Watch, WatchSkipped,
+// WatchAlreadyPresent and WatchResults have been closed, and must be asked for
+// again, as must the journal given to SetJournal.
+//
+// Reset may only be called once Wait has returned, and not at the same time as
+// any other method. It returns an error if Wait hasn't been called, or if the
+// queue timed out, since transfers which were abandoned may still be running.
+func (q *TransferQueue) Reset(files int, size int64) error {
+	q.watchMu.RLock()
+	closed := q.closed
+	q.watchMu.RUnlock()
+	if !closed {
+		return errors.New("Unable to reset a transfer queue before it has finished")
+	}
+
+	if q.timer != nil && !q.timer.Stop() {
+		// lfs.transfer.timeout has passed since Wait returned, so
+		// expire may still be running.
+		return errors.New("Unable to reset a transfer queue which has timed out")
+	}
+	if q.expired() {
+		return errors.New("Unable to reset a transfer queue which has timed out")
+	}
+
+	q.errMu.Lock()
+	q.errors = nil
+	q.errMu.Unlock()
+
+	q.watchMu.Lock()
+	q.watchers, q.skipWatchers, q.presentWatchers, q.resultWatchers = nil, nil, nil, nil
+	q.closed = false
+	q.watchMu.Unlock()
+
+	q.heldMu.Lock()
+	q.held = nil
+	q.released = false
+	q.heldMu.Unlock()
+
+	q.adapterInitMutex.Lock()
+	q.adapter = nil
+	q.adapterInProgress = false
+	q.adapterErr = nil
+	q.adapterInitMutex.Unlock()
+
+	q.abortOnce = sync.Once{}
+	q.expireOnce = sync.Once{}
+	q.adapterErrOnce = sync.Once{}
+	q.expiredAfter = 0
+	q.expiryHint = ""
+	q.journal = nil
+	q.batcher = nil
+	q.timer = nil
+	atomic.StoreInt32(&q.inFlight, 0)
+	q.counters.reset()
+	atomic.StoreInt64(&q.presentCount, 0)
+	atomic.StoreInt64(&q.presentBytes, 0)
+	atomic.StoreUint32(&q.usedLegacyFallback, 0)
+
+	q.start(files, size)
+
+	return nil
+}
+
+// quietProgress returns whether the progress meter should be quiet, either
+// because lfs.quiet is set or because there is no terminal to draw it on.
+func quietProgress() bool {
+	return config.Config.ProgressQuiet() || !progress.IsTerminal(os.Stderr)
+}
+
+// SetQuiet makes the queue's progress meter quiet, so that it prints a summary
+// line when the queue finishes rather than drawing a progress bar. SetQuiet
+// must be called before anything is added to the queue.
+func (q *TransferQueue) SetQuiet() {
+	q.quiet = true
+	q.meter.SetQuiet(true)
+}
+
+// RegisterAdapter registers a function for creating transfer adapters called
+// "name" in the queue's direction, overriding any adapter of that name which
+// is built in or configured with lfs.customtransfer.<name>. This lets programs
+// embedding the queue add adapters of their own, such as one which transfers
+// directly to a storage service. The server chooses an adapter from those
+// registered for each batch, so RegisterAdapter must be called before
+// anything is added to the queue.
+func (q *TransferQueue) RegisterAdapter(name string, f transfer.NewTransferAdapterFunc) {
+	q.manifest.RegisterNewTransferAdapterFunc(name, q.direction, f)
 }
 
 // Add adds a Transferable to the transfer queue. It only increments the amount
 // of waiting the TransferQueue has to do if the Transferable "t" is new.
+//
+// If a filter has been set with SetFilter and it rejects "t", the Transferable
+// is skipped instead of being transferred. If its OID is not a SHA-256 in
+// lowercase hex, for example because it came from a corrupt pointer, it is not
+// transferred, and an error naming it is reported instead.
+//
+// If lfs.transfer.maxpending is set, Add blocks while that many transferables
+// are unfinished, so that a producer adding objects faster than they can be
+// transferred doesn't fill memory with them. It doesn't block while
+// lfs.transfer.order holds transferables back until Wait is called.
 func (q *TransferQueue) Add(t Transferable) {
+	if q.filter != nil && !q.filter(t) {
+		tracerx.Printf("tq: skipping %q (%s), excluded by filter", t.Name(), t.Oid())
+		q.Skip(t.Size())
+		q.notify(&q.skipWatchers, t.Oid())
+		q.reportSkip(t.Oid(), t.Size(), SkipFiltered)
+		return
+	}
+
+	if !ValidOid(t.Oid()) {
+		q.addError(errors.Errorf("invalid object id %q for %q", t.Oid(), t.Name()))
+		atomic.AddInt64(&q.counters.failed, 1)
+		q.Skip(t.Size())
+		q.notifyResult(t.Oid(), false)
+		return
+	}
+
+	if q.journalCompleted(t) {
+		tracerx.Printf("tq: skipping %q (%s), already transferred by an earlier run", t.Name(), t.Oid())
+		q.Skip(t.Size())
+		q.reportDryRun(t, "skip")
+		q.notifyAlreadyPresent(t.Oid(), t.Size())
+		q.reportSkip(t.Oid(), t.Size(), SkipAlreadyPresent)
+		return
+	}
+
+	// Transferables held back to be sorted by size aren't transferred
+	// until Wait is called, so waiting for them to finish would never end.
+	bounded := q.maxPending > 0 && !q.holding()
+
 	q.trMutex.Lock()
-	if _, ok := q.transferables[t.Oid()]; !ok {
-		q.wait.Add(1)
-		q.transferables[t.Oid()] = t
+	_, seen := q.transferables[t.Oid()]
+	for bounded && !seen && len(q.transferables) >= q.maxPending && !q.aborted() {
+		// The pending transferables may be sitting in a partial batch,
+		// which nothing else would send while the flush interval is
+		// off, so flush it before waiting for them to finish.
+		if q.batcher != nil {
+			q.trMutex.Unlock()
+			q.batcher.Flush()
+			q.trMutex.Lock()
+			if _, seen = q.transferables[t.Oid()]; seen || len(q.transferables) < q.maxPending || q.aborted() {
+				break
+			}
+		}
+
+		q.pendingCond.Wait()
+		_, seen = q.transferables[t.Oid()]
 	}
+	q.transferables[t.Oid()] = t
+	delete(q.cancelled, t.Oid())
 	q.trMutex.Unlock()
 
+	if q.expired() {
+		// Wait reports everything unfinished as timed out.
+		return
+	}
+
+	if !seen {
+		q.wait.Add(1)
+		atomic.AddInt64(&q.counters.added, 1)
+	}
+
+	if q.hold(t) {
+		return
+	}
+
+	q.dispatch(t)
+}
+
+// dispatch hands "t" to the batcher, or to the individual API routines.
+func (q *TransferQueue) dispatch(t Transferable) {
+	if q.isCancelled(t.Oid()) {
+		return
+	}
+
 	if q.batcher != nil {
+		atomic.AddInt64(&q.counters.batchDepth, 1)
 		q.batcher.Add(t)
 		return
 	}
 
-	q.apic <- t
+	q.enqueue(t)
+}
+
+// holding returns whether hold keeps transferables back.
+func (q *TransferQueue) holding() bool {
+	q.heldMu.Lock()
+	defer q.heldMu.Unlock()
+	return q.order != "fifo" && !q.released
+}
+
+// hold keeps "t" back, and returns true, if lfs.transfer.order asks for
+// transferables to be sorted by size and Wait hasn't been called yet.
+func (q *TransferQueue) hold(t Transferable) bool {
+	q.heldMu.Lock()
+	defer q.heldMu.Unlock()
+
+	if q.order == "fifo" || q.released {
+		return false
+	}
+	q.held = append(q.held, t)
+	return true
+}
+
+// releaseHeld sorts the transferables kept back by hold in the order given by
+// lfs.transfer.order, and dispatches them. Anything added afterwards, such as
+// retries, is dispatched straight away.
+func (q *TransferQueue) releaseHeld() {
+	q.heldMu.Lock()
+	held := q.held
+	q.held = nil
+	q.released = true
+	q.heldMu.Unlock()
+
+	switch q.order {
+	case "size-asc":
+		sort.Stable(transferablesBySize(held))
+	case "size-desc":
+		sort.Stable(sort.Reverse(transferablesBySize(held)))
+	}
+
+	for _, t := range held {
+		q.dispatch(t)
+	}
 }
 
+type transferablesBySize []Transferable
+
+func (t transferablesBySize) Len() int           { return len(t) }
+func (t transferablesBySize) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t transferablesBySize) Less(i, j int) bool { return t[i].Size() < t[j].Size() }
+
 func (q *TransferQueue) useAdapter(name string) {
 	q.adapterInitMutex.Lock()
 	defer q.adapterInitMutex.Unlock()
@@ -123,6 +586,7 @@ func (q *TransferQueue) useAdapter(name string) {
 		q.finishAdapter()
 	}
 	q.adapter = q.manifest.NewAdapterOrDefault(name, q.direction)
+	q.adapterErr = nil
 }
 
 func (q *TransferQueue) finishAdapter() {
@@ -134,28 +598,484 @@ func (q *TransferQueue) finishAdapter() {
 }
 
 func (q *TransferQueue) addToAdapter(t Transferable) {
-	tr := transfer.NewTransfer(t.Name(), t.Object(), t.Path())
+	if q.isCancelled(t.Oid()) {
+		return
+	}
+
+	if q.aborted() {
+		q.abandon(t)
+		return
+	}
+
+	// If lfs.transfer.maxperhost transfers to the object's host are
+	// already running, wait for one to finish in the background, so that
+	// objects for other hosts aren't held up behind it.
+	if !q.dryRun {
+		host := objectHost(t.Object(), q.transferKind())
+		if !q.hosts.TryAcquire(t.Oid(), host) {
+			tracerx.Printf("tq: waiting for a transfer from %s to finish before starting %q", host, t.Name())
+			go func() {
+				if q.hosts.Acquire(t.Oid(), host, q.expiredc) {
+					q.startTransfer(t)
+				}
+			}()
+			return
+		}
+	}
+
+	q.startTransfer(t)
+}
+
+// startTransfer hands "t" to the adapter, once it has a slot on its host.
+func (q *TransferQueue) startTransfer(t Transferable) {
+	if q.isCancelled(t.Oid()) {
+		// It may have been cancelled while waiting for a slot on its
+		// host, after finish released the slots it held.
+		q.hosts.Release(t.Oid())
+		return
+	}
+
+	if q.aborted() {
+		q.abandon(t)
+		return
+	}
+
+	if !q.refreshIfExpired(t) {
+		return
+	}
+
+	var resumeFrom int64
+	if q.direction == transfer.Download && !q.dryRun {
+		resumeFrom = transfer.ResumableDownloadOffset(t.Object())
+		if resumeFrom > 0 {
+			tracerx.Printf("tq: resuming download of %q from byte %d", t.Oid(), resumeFrom)
+		}
+	}
+
+	tr := transfer.NewTransfer(t.Name(), t.Object(), t.Path(), resumeFrom)
 
 	if q.dryRun {
 		// Don't actually transfer
+		q.reportDryRun(t, q.transferKind())
 		res := transfer.TransferResult{tr, nil}
 		q.handleTransferResult(res)
 		return
 	}
-	err := q.ensureAdapterBegun()
+	if q.verifyUploads && q.direction == transfer.Upload {
+		if err := verifyUpload(tr); err != nil {
+			q.hosts.Release(t.Oid())
+			q.logTransfer(transfer.TransferResult{Transfer: tr, Error: err}, transferFailed)
+			q.addError(err)
+			q.Skip(t.Size())
+			q.fail(t.Oid())
+			return
+		}
+	}
+
+	err := q.ensureAdapterBegun(t)
 	if err != nil {
-		q.errorc <- err
+		// If the adapter can't begin, no other transfers can start
+		// either, so report it once and give up on the rest.
+		q.adapterErrOnce.Do(func() {
+			q.addError(err)
+			q.abort()
+		})
 		q.Skip(t.Size())
-		q.wait.Done()
+		q.fail(t.Oid())
 		return
 	}
-	q.adapter.Add(tr)
+
+	q.adapterInitMutex.Lock()
+	if q.adapterStopped {
+		// The queue has timed out, so leave "t" unfinished, to be
+		// reported as timed out.
+		q.adapterInitMutex.Unlock()
+		q.hosts.Release(t.Oid())
+		return
+	}
+	adapter := q.adapter
+	q.adapterAdds.Add(1)
+	q.adapterInitMutex.Unlock()
+
+	atomic.AddInt32(&q.inFlight, 1)
+	q.log.Start(t.Oid())
+
+	q.startAttempt(t.Oid())
+
+	// Add blocks while all of the adapter's workers are busy, so stop
+	// waiting for it if the queue times out.
+	added := make(chan struct{})
+	go func() {
+		defer q.adapterAdds.Done()
+		adapter.Add(tr)
+		close(added)
+	}()
+
+	select {
+	case <-added:
+	case <-q.expiredc:
+	}
+}
+
+// refreshIfExpired requests fresh actions for "t" if the ones it has expire
+// within q.expiryMargin, which happens when a large queue takes longer to
+// reach an object than the server allows. It returns false if "t" should not
+// be handed to the adapter, because the refresh failed or the server no longer
+// needs it to be transferred, in which case it has been retried or finished.
+func (q *TransferQueue) refreshIfExpired(t Transferable) bool {
+	obj := t.Object()
+	if obj == nil || !obj.IsExpired(q.clock.Now().Add(q.expiryMargin)) {
+		return true
+	}
+
+	tracerx.Printf("tq: refreshing expired actions for %q", t.Oid())
+	if m, ok := t.(MetadataTransferable); ok {
+		withMetadata := *obj
+		withMetadata.Metadata = m.RequestMetadata()
+		obj = &withMetadata
+	}
+	q.startAttempt(t.Oid())
+	fresh, err := q.refreshFunc(config.Config, obj, q.transferKind(), q.manifest.GetAdapterNames(q.direction))
+	if q.isCancelled(t.Oid()) {
+		return false
+	}
+	if err != nil {
+		if ok, err := q.canRetryObject(t.Oid(), err); ok {
+			// The retry acquires a slot on its host again, so give
+			// this one back, as finish does otherwise.
+			q.hosts.Release(t.Oid())
+			q.retry(t, err)
+		} else {
+			q.addError(err)
+			q.fail(t.Oid())
+		}
+		return false
+	}
+
+	if _, ok := fresh.Rel(q.transferKind()); !ok {
+		q.reportDryRun(t, "skip")
+		q.reportSkip(t.Oid(), t.Size(), q.noActionReason())
+		q.Skip(t.Size())
+		q.finishNotifying(t.Oid(), func() {
+			q.notifyAlreadyPresent(t.Oid(), t.Size())
+		})
+		return false
+	}
+
+	if !q.rewriteObject(t, fresh) {
+		return false
+	}
+
+	t.SetObject(fresh)
+	return true
 }
 
 func (q *TransferQueue) Skip(size int64) {
 	q.meter.Skip(size)
 }
 
+// aborted returns whether the queue has given up on transfers which haven't
+// started yet, because lfs.transfer.maxfailures errors have been collected.
+func (q *TransferQueue) aborted() bool {
+	select {
+	case <-q.abortc:
+		return true
+	default:
+		return false
+	}
+}
+
+// abandon skips a Transferable which won't be transferred because the queue
+// has been aborted. If the queue has timed out, it is left unfinished instead,
+// so that Wait reports it as timed out.
+func (q *TransferQueue) abandon(t Transferable) {
+	if q.expired() {
+		return
+	}
+
+	tracerx.Printf("tq: abandoning %q (%s)", t.Name(), t.Oid())
+	q.Skip(t.Size())
+	q.finish(t.Oid())
+}
+
+// CancelObject stops the object with the given OID from being transferred, for
+// example because it is no longer needed, without stopping the rest of the
+// queue. If the object hasn't reached the adapter yet, it never will, and if
+// it is being transferred, the adapter is told to stop, if it implements
+// transfer.Canceller. Either way, the object is finished straight away, as
+// skipped with the reason SkipCancelled and not transferred, and whatever
+// happens to it afterwards is ignored. Adding it again transfers it as if it
+// were new. CancelObject returns false if the queue has no unfinished object
+// with that OID.
+func (q *TransferQueue) CancelObject(oid string) bool {
+	q.trMutex.Lock()
+	t, ok := q.transferables[oid]
+	if ok {
+		q.cancelled[oid] = true
+	}
+	q.trMutex.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	tracerx.Printf("tq: cancelling %q (%s)", t.Name(), oid)
+	q.adapterInitMutex.Lock()
+	if c, ok := q.adapter.(transfer.Canceller); ok {
+		c.Cancel(oid)
+	}
+	q.adapterInitMutex.Unlock()
+
+	q.Skip(t.Size())
+	q.reportSkip(oid, t.Size(), SkipCancelled)
+	q.finishNotifying(oid, func() {
+		q.notifyResult(oid, false)
+	})
+	return true
+}
+
+// isCancelled returns whether the object with the given OID has been given to
+// CancelObject since it was last added.
+func (q *TransferQueue) isCancelled(oid string) bool {
+	q.trMutex.Lock()
+	defer q.trMutex.Unlock()
+
+	return q.cancelled[oid]
+}
+
+// abort stops the queue from starting any more transfers.
+func (q *TransferQueue) abort() {
+	q.abortOnce.Do(func() {
+		close(q.abortc)
+
+		// Let Adds blocked by lfs.transfer.maxpending through, so
+		// that their transferables are abandoned too.
+		q.trMutex.Lock()
+		q.pendingCond.Broadcast()
+		q.trMutex.Unlock()
+	})
+}
+
+// finish marks the transferable with the given OID as done with, whether it
+// was transferred, failed or skipped. Finishing one which has already been
+// finished, such as by CancelObject, doesn't count it as done again.
+func (q *TransferQueue) finish(oid string) {
+	q.finishNotifying(oid, func() {})
+}
+
+// finishNotifying is like finish, but calls "notify" to tell the watchers about
+// the transferable after forgetting it and before counting it as done. That
+// way Wait can't close the watchers first, and a watcher which adds it again
+// has it counted and waited for as a new transferable.
+func (q *TransferQueue) finishNotifying(oid string, notify func()) {
+	// Forget the transferable, so that huge queues don't hold on to every
+	// object they have transferred. If it is added again, it is counted and
+	// transferred again as if it were new.
+	q.trMutex.Lock()
+	_, unfinished := q.transferables[oid]
+	delete(q.transferables, oid)
+	q.pendingCond.Broadcast()
+	q.trMutex.Unlock()
+
+	q.rmu.Lock()
+	delete(q.attempts, oid)
+	q.rmu.Unlock()
+
+	q.pbMu.Lock()
+	delete(q.prebatched, oid)
+	q.pbMu.Unlock()
+
+	q.hosts.Release(oid)
+	notify()
+	if unfinished {
+		q.wait.Done()
+	}
+}
+
+// startTimeout aborts the queue and lets Wait return once "timeout" has
+// passed. A timeout of zero means there is no time limit.
+func (q *TransferQueue) startTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+
+	q.timeout = timeout
+	q.setDeadline(q.clock.Now().Add(timeout))
+	q.timer = afterFunc(q.clock, timeout, func() {
+		q.expire(timeout, ", see lfs.transfer.timeout")
+	})
+}
+
+// setDeadline records that the queue times out at "deadline", unless it
+// already times out sooner, so that canRetryObject can refuse retries which
+// wouldn't finish in time.
+func (q *TransferQueue) setDeadline(deadline time.Time) {
+	q.rmu.Lock()
+	defer q.rmu.Unlock()
+
+	if q.deadline.IsZero() || deadline.Before(q.deadline) {
+		q.deadline = deadline
+	}
+}
+
+// expire times the queue out after "after" has passed: it stops starting
+// transfers, and lets Wait return without waiting for those still running.
+// "hint" is added to the error reported for each unfinished transfer.
+func (q *TransferQueue) expire(after time.Duration, hint string) {
+	q.expireOnce.Do(func() {
+		tracerx.Printf("tq: timed out after %s", after)
+		q.expiredAfter = after
+		q.expiryHint = hint
+		close(q.expiredc)
+	})
+	q.abort()
+}
+
+// expired returns whether the queue has timed out.
+func (q *TransferQueue) expired() bool {
+	select {
+	case <-q.expiredc:
+		return true
+	default:
+		return false
+	}
+}
+
+// notify sends "oid" to each of the given watchers, unless Wait has already
+// closed them. It does not wait for the watchers to read it.
+func (q *TransferQueue) notify(watchers *[]*watcher, oid string) {
+	q.watchMu.RLock()
+	defer q.watchMu.RUnlock()
+
+	if q.closed {
+		return
+	}
+
+	for _, w := range *watchers {
+		w.send(WatchResult{Oid: oid, Success: true})
+	}
+}
+
+// notifyResult tells the watchers from WatchResults whether the object with
+// the given OID was transferred.
+func (q *TransferQueue) notifyResult(oid string, success bool) {
+	q.watchMu.RLock()
+	defer q.watchMu.RUnlock()
+
+	if q.closed {
+		return
+	}
+
+	for _, w := range q.resultWatchers {
+		w.send(WatchResult{Oid: oid, Success: success})
+	}
+}
+
+// fail finishes the object with the given OID once it has failed for good,
+// after its error has been added.
+func (q *TransferQueue) fail(oid string) {
+	atomic.AddInt64(&q.counters.failed, 1)
+	q.finishNotifying(oid, func() {
+		q.notifyResult(oid, false)
+	})
+}
+
+// closeWatchers closes all of the channels returned by Watch, WatchSkipped,
+// WatchAlreadyPresent and WatchResults.
+func (q *TransferQueue) closeWatchers() {
+	q.watchMu.Lock()
+	defer q.watchMu.Unlock()
+
+	q.closed = true
+	for _, w := range q.watchers {
+		w.close()
+	}
+	for _, w := range q.skipWatchers {
+		w.close()
+	}
+	for _, w := range q.presentWatchers {
+		w.close()
+	}
+	for _, w := range q.resultWatchers {
+		w.close()
+	}
+}
+
+// SetDryRunCallback sets a callback which is given a DryRunEntry for each
+// object a dry run queue processes, describing whether it would have been
+// transferred. It has no effect unless the queue was created as a dry run, and
+// must be called before the first call to Add.
+func (q *TransferQueue) SetDryRunCallback(cb DryRunCallback) {
+	q.dryRunCb = cb
+}
+
+// SetSkipCallback sets a callback which is told about each object the queue
+// finishes with without transferring it, and why, so that callers can tell
+// those apart from objects which were transferred or failed. It must be called
+// before the first call to Add.
+func (q *TransferQueue) SetSkipCallback(cb SkipCallback) {
+	q.skipCb = cb
+}
+
+// SetObjectRewriter sets a function which may change the actions of each object
+// which needs to be transferred, once they have been returned by the batch API
+// or refreshed, and before the transfer starts. It must be called before the
+// first call to Add.
+func (q *TransferQueue) SetObjectRewriter(r ObjectRewriter) {
+	q.rewriter = r
+}
+
+// rewriteObject passes "o", the object for "t", to the rewriter set by
+// SetObjectRewriter, if there is one. If it fails, "t" fails with its error,
+// and rewriteObject returns false.
+func (q *TransferQueue) rewriteObject(t Transferable, o *api.ObjectResource) bool {
+	if q.rewriter == nil {
+		return true
+	}
+
+	if err := q.rewriter(o); err != nil {
+		q.addError(errors.Wrapf(err, "Error rewriting actions for %s (%s)", t.Name(), t.Oid()))
+		q.Skip(t.Size())
+		q.fail(t.Oid())
+		return false
+	}
+	return true
+}
+
+// reportSkip passes the object with the given OID and size to the skip
+// callback, if there is one.
+func (q *TransferQueue) reportSkip(oid string, size int64, reason string) {
+	if q.skipCb != nil {
+		q.skipCb(oid, size, reason)
+	}
+}
+
+// noActionReason returns the reason to give the skip callback for an object
+// which the server returned no action for. For uploads this means that the
+// server already has it.
+func (q *TransferQueue) noActionReason() string {
+	if q.direction == transfer.Upload {
+		return SkipAlreadyPresent
+	}
+	return SkipNoAction
+}
+
+// reportDryRun passes a DryRunEntry for the given Transferable to the dry run
+// callback, if there is one.
+func (q *TransferQueue) reportDryRun(t Transferable, action string) {
+	if !q.dryRun || q.dryRunCb == nil {
+		return
+	}
+
+	q.dryRunCb(&DryRunEntry{
+		Name:      t.Name(),
+		Oid:       t.Oid(),
+		Size:      t.Size(),
+		Direction: q.transferKind(),
+		Action:    action,
+	})
+}
+
 func (q *TransferQueue) transferKind() string {
 	if q.direction == transfer.Download {
 		return "download"
@@ -164,110 +1084,514 @@ func (q *TransferQueue) transferKind() string {
 	}
 }
 
-func (q *TransferQueue) ensureAdapterBegun() error {
+// adapterConcurrency returns the number of objects the adapter transfers at
+// once. Transfers with a host which answers over HTTP/2 share one connection,
+// so lfs.transfer.http2concurrency is used for them instead. Only the hosts
+// of "t" and the API have been heard from before the adapter begins.
+func (q *TransferQueue) adapterConcurrency(t Transferable) int {
+	hosts := []string{objectHost(t.Object(), q.transferKind())}
+	if u, err := url.Parse(config.Config.Endpoint(q.transferKind()).Url); err == nil {
+		hosts = append(hosts, u.Hostname())
+	}
+
+	for _, host := range hosts {
+		if len(host) > 0 && q.usedHTTP2(host) {
+			n := config.Config.TransferHTTP2Concurrency()
+			tracerx.Printf("tq: %s uses HTTP/2, transferring %d objects at once", host, n)
+			return n
+		}
+	}
+	return q.transferWorkers
+}
+
+// ensureAdapterBegun begins the adapter for "t", the first object to be
+// transferred, unless it already has. If it fails to, the error is returned
+// for every later object without trying again.
+func (q *TransferQueue) ensureAdapterBegun(t Transferable) error {
+	q.adapterInitMutex.Lock()
+	defer q.adapterInitMutex.Unlock()
+
+	if q.adapterInProgress {
+		return nil
+	}
+	if q.adapterErr != nil {
+		return q.adapterErr
+	}
+
+	adapterResultChan := make(chan transfer.TransferResult, 20)
+
+	// Progress callback - receives byte updates
+	cb := func(name string, total, read int64, current int) error {
+		q.meter.TransferBytes(q.transferKind(), name, read, total, current)
+		atomic.AddInt64(&q.counters.bytes, int64(current))
+		return nil
+	}
+
+	tracerx.Printf("tq: starting transfer adapter %q", q.adapter.Name())
+	err := q.adapter.Begin(q.adapterConcurrency(t), cb, adapterResultChan)
+	if err != nil {
+		tracerx.Printf("tq: transfer adapter %q failed to begin: %s", q.adapter.Name(), err)
+		q.adapterErr = errors.Wrapf(err, "Unable to start the %s transfer adapter, giving up on all transfers", q.adapter.Name())
+		return q.adapterErr
+	}
+	q.adapterInProgress = true
+
+	// Downloads from adapters which don't check them are hashed here, in
+	// parallel, since they are read back in full.
+	verify := q.direction == transfer.Download && !verifiesDownloads(q.adapter)
+
+	// Collector for completed transfers
+	// q.finish() in handleTransferResult is enough to know when this is complete for all transfers
+	go func() {
+		for res := range adapterResultChan {
+			if !verify || res.Error != nil {
+				q.handleTransferResult(res)
+				continue
+			}
+
+			go func(res transfer.TransferResult) {
+				res.Error = verifyDownload(res.Transfer)
+				q.handleTransferResult(res)
+			}(res)
+		}
+	}()
+
+	return nil
+}
+
+// verifiesDownloads returns whether "adapter" checks that downloads hash to
+// their OIDs itself.
+func verifiesDownloads(adapter transfer.TransferAdapter) bool {
+	v, ok := adapter.(transfer.DownloadVerifier)
+	return ok && v.VerifiesDownloads()
+}
+
+// verifyDownload checks that the content downloaded for "t" hashes to its OID.
+// If it doesn't, the corrupt file is removed, and a retriable error returned.
+func verifyDownload(t *transfer.Transfer) error {
+	err := tools.VerifyFileHash(t.Object.Oid, t.Path)
+	if err == nil {
+		return nil
+	}
+
+	tracerx.Printf("tq: download of %q (%s) failed verification: %s", t.Name, t.Object.Oid, err)
+	os.Remove(t.Path)
+	return errors.NewRetriableError(errors.Wrapf(err, "Error verifying download of %s (%s)", t.Name, t.Object.Oid))
+}
+
+// verifyUpload checks that the content to be uploaded for "t" still hashes to
+// its OID, so that a file which was corrupted after it was cleaned isn't sent to
+// the server. Uploading it again won't help, so the error isn't retriable.
+func verifyUpload(t *transfer.Transfer) error {
+	err := tools.VerifyFileHash(t.Object.Oid, t.Path)
+	if err == nil {
+		return nil
+	}
+
+	tracerx.Printf("tq: upload of %q (%s) failed verification: %s", t.Name, t.Object.Oid, err)
+	return errors.Wrapf(err, "Error verifying %s (%s) before uploading it", t.Name, t.Object.Oid)
+}
+
+// handleTransferResult is responsible for dealing with the result of a
+// successful or failed transfer.
+//
+// If there was an error assosicated with the given transfer, "res.Error", and
+// it is retriable (see: `q.canRetryObject`), it will be placed in the next
+// batch and be retried. If that error is not retriable for any reason, the
+// transfer will be marked as having failed, and the error will be reported.
+//
+// If the transfer was successful, the watchers of this transfer queue will be
+// notified, and the transfer will be marked as having been completed.
+func (q *TransferQueue) handleTransferResult(res transfer.TransferResult) {
+	oid := res.Transfer.Object.Oid
+
+	if !q.dryRun {
+		atomic.AddInt32(&q.inFlight, -1)
+		q.hosts.Release(oid)
+	}
+
+	if q.isCancelled(oid) {
+		// CancelObject has already finished it.
+		tracerx.Printf("tq: ignoring the result of cancelled transfer %q", oid)
+		return
+	}
+
+	if res.Error != nil {
+		ok, err := q.canRetryObject(oid, res.Error)
+		if ok {
+			tracerx.Printf("tq: retrying object %s", oid)
+			q.trMutex.Lock()
+			t, ok := q.transferables[oid]
+			q.trMutex.Unlock()
+			if ok {
+				q.logTransfer(res, transferRetried)
+				q.retry(t, res.Error)
+			} else {
+				q.logTransfer(res, transferFailed)
+				q.addError(res.Error)
+			}
+		} else {
+			q.logTransfer(res, transferFailed)
+			q.addError(err)
+			q.fail(oid)
+		}
+	} else {
+		atomic.AddInt64(&q.counters.completed, 1)
+		q.logTransfer(res, transferCompleted)
+
+		if q.dryRun {
+			q.reportSkip(oid, res.Transfer.Object.Size, SkipDryRun)
+		} else {
+			metrics.Add(metrics.Objects, 1)
+			metrics.Add(metrics.Bytes, res.Transfer.Object.Size)
+			q.recordInJournal(oid)
+		}
+
+		q.meter.FinishTransfer(res.Transfer.Name)
+		q.finishNotifying(oid, func() {
+			q.notify(&q.watchers, oid)
+			q.notifyResult(oid, true)
+		})
+	}
+}
+
+// logTransfer records the result of a transfer in the transfer log, unless the
+// queue is a dry run, which doesn't transfer anything.
+func (q *TransferQueue) logTransfer(res transfer.TransferResult, outcome string) {
+	if q.dryRun {
+		return
+	}
+	q.log.Record(res.Transfer, q.transferKind(), outcome, res.Error)
+}
+
+// Wait waits for the queue to finish processing all transfers. Once Wait is
+// called, Add will no longer add transferables to the queue. Any failed
+// transfers will be automatically retried once.
+//
+// If lfs.transfer.timeout passes first, Wait returns straight away, with a
+// timeout error for each object which hasn't finished. Transfers which are
+// still running are cancelled, if the adapter can cancel them, and the adapter
+// is ended in the background once they have stopped.
+func (q *TransferQueue) Wait() {
+	q.releaseHeld()
+
+	if q.batcher != nil {
+		q.batcher.Exit()
+	}
+
+	if !q.waitForTransfers() {
+		// The retry collector stops once the queue times out, rather
+		// than waiting for its channel to be closed.
+		q.retrywait.Wait()
+
+		q.failUnfinished()
+		q.stopAdapter()
+		q.closeWatchers()
+		q.meter.Finish()
+		q.closeJournal()
+		q.log.Close()
+		return
+	}
+
+	// Handle any retries
+	close(q.retriesc)
+	q.retrywait.Wait()
+
+	// Nothing else can be added, so the API routines can stop.
+	if q.batcher != nil {
+		q.batcher.Close()
+	}
+	close(q.apic)
+	q.apiwait.Wait()
+	q.finishAdapter()
+
+	q.closeWatchers()
+
+	q.meter.Finish()
+	q.closeJournal()
+	q.log.Close()
+}
+
+// WaitWithTimeout is like Wait, but gives up once "timeout" has passed, in
+// the same way as when lfs.transfer.timeout passes: transfers which haven't
+// started are abandoned, and a timeout error is reported for each object which
+// hasn't finished. It returns an error if the queue timed out, either way.
+//
+// The queue can't be used again afterwards. Transfers which are still running
+// are abandoned, and their results are discarded when they finish.
+func (q *TransferQueue) WaitWithTimeout(timeout time.Duration) error {
+	q.setDeadline(q.clock.Now().Add(timeout))
+	timer := afterFunc(q.clock, timeout, func() {
+		q.expire(timeout, "")
+	})
+	defer timer.Stop()
+
+	q.Wait()
+
+	if q.expired() {
+		return errors.Errorf("Timed out after %s waiting for transfers", q.expiredAfter)
+	}
+	return nil
+}
+
+// recordInJournal records that the object "oid" has been transferred in the
+// journal set by SetJournal, if there is one.
+func (q *TransferQueue) recordInJournal(oid string) {
+	if q.journal == nil {
+		return
+	}
+	if err := q.journal.Record(oid); err != nil {
+		tracerx.Printf("tq: error recording %q in transfer journal: %s", oid, err)
+	}
+}
+
+// journalCompleted returns whether an earlier run recorded "t" as transferred
+// in the journal set by SetJournal. A download only counts while its object is
+// still in the local media directory, since it may have been pruned since.
+func (q *TransferQueue) journalCompleted(t Transferable) bool {
+	if q.journal == nil || !q.journal.Completed(t.Oid()) {
+		return false
+	}
+	if q.direction == transfer.Download && !ObjectExistsOfSize(t.Oid(), t.Size()) {
+		tracerx.Printf("tq: downloading %q (%s) again, its object is no longer local", t.Name(), t.Oid())
+		return false
+	}
+	return true
+}
+
+// closeJournal removes the journal set by SetJournal once everything has been
+// transferred, or otherwise keeps it for the next run.
+func (q *TransferQueue) closeJournal() {
+	if q.journal == nil {
+		return
+	}
+
+	var err error
+	if len(q.Errors()) == 0 && !q.expired() {
+		err = q.journal.Remove()
+	} else {
+		err = q.journal.Close()
+	}
+	if err != nil {
+		tracerx.Printf("tq: error closing transfer journal: %s", err)
+	}
+}
+
+// waitForTransfers waits for every transferable to finish, returning false if
+// the queue times out first.
+func (q *TransferQueue) waitForTransfers() bool {
+	done := make(chan struct{})
+	go func() {
+		q.wait.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-q.expiredc:
+		return false
+	}
+}
+
+// stopAdapter stops a timed out queue from handing the adapter any more
+// transfers, and cancels those it has, if it implements transfer.Canceller.
+// The adapter is then ended in the background, once the transfers have
+// stopped, since an adapter which can't cancel them may take as long as they
+// do. Their results are ignored, as Wait has already reported them.
+func (q *TransferQueue) stopAdapter() {
 	q.adapterInitMutex.Lock()
-	defer q.adapterInitMutex.Unlock()
+	q.adapterStopped = true
+	adapter := q.adapter
+	inProgress := q.adapterInProgress
+	q.adapterInitMutex.Unlock()
 
-	if q.adapterInProgress {
-		return nil
+	if !inProgress {
+		return
 	}
 
-	adapterResultChan := make(chan transfer.TransferResult, 20)
+	cancel := func() {
+		c, ok := adapter.(transfer.Canceller)
+		if !ok {
+			return
+		}
 
-	// Progress callback - receives byte updates
-	cb := func(name string, total, read int64, current int) error {
-		q.meter.TransferBytes(q.transferKind(), name, read, total, current)
-		return nil
-	}
+		q.trMutex.Lock()
+		oids := make([]string, 0, len(q.transferables))
+		for oid := range q.transferables {
+			oids = append(oids, oid)
+		}
+		q.trMutex.Unlock()
 
-	tracerx.Printf("tq: starting transfer adapter %q", q.adapter.Name())
-	err := q.adapter.Begin(config.Config.ConcurrentTransfers(), cb, adapterResultChan)
-	if err != nil {
-		return err
+		for _, oid := range oids {
+			c.Cancel(oid)
+		}
 	}
-	q.adapterInProgress = true
 
-	// Collector for completed transfers
-	// q.wait.Done() in handleTransferResult is enough to know when this is complete for all transfers
+	tracerx.Printf("tq: stopping transfer adapter %q", adapter.Name())
+	cancel()
 	go func() {
-		for res := range adapterResultChan {
-			q.handleTransferResult(res)
-		}
+		// Calls to Add which were still blocked may have handed the
+		// adapter more transfers, so cancel those too before ending
+		// it, which waits for every transfer to stop.
+		q.adapterAdds.Wait()
+		cancel()
+		adapter.End()
 	}()
+}
 
-	return nil
+// failUnfinished adds a timeout error for each transferable which hasn't
+// finished.
+func (q *TransferQueue) failUnfinished() {
+	q.trMutex.Lock()
+	unfinished := make([]Transferable, 0, len(q.transferables))
+	for _, t := range q.transferables {
+		unfinished = append(unfinished, t)
+	}
+	q.trMutex.Unlock()
+
+	for _, t := range unfinished {
+		q.notifyResult(t.Oid(), false)
+	}
+
+	q.errMu.Lock()
+	defer q.errMu.Unlock()
+	for _, t := range unfinished {
+		q.errors = append(q.errors, errors.Errorf("Timed out after %s transferring %s (%s)%s", q.expiredAfter, t.Name(), t.Oid(), q.expiryHint))
+	}
 }
 
-// handleTransferResult is responsible for dealing with the result of a
-// successful or failed transfer.
-//
-// If there was an error assosicated with the given transfer, "res.Error", and
-// it is retriable (see: `q.canRetryObject`), it will be placed in the next
-// batch and be retried. If that error is not retriable for any reason, the
-// transfer will be marked as having failed, and the error will be reported.
+// Watch returns a channel where the queue will write the OID of each transfer
+// as it completes. The channel will be closed when the queue finishes processing.
 //
-// If the transfer was successful, the watchers of this transfer queue will be
-// notified, and the transfer will be marked as having been completed.
-func (q *TransferQueue) handleTransferResult(res transfer.TransferResult) {
-	oid := res.Transfer.Object.Oid
+// The queue never waits for a watcher to read: OIDs are held in an unbounded
+// buffer for each watcher until they are read, so a slow or blocked reader
+// costs memory rather than stalling transfers, and no OID is ever dropped. A
+// reader which stops early should call Unwatch to release its buffer.
+func (q *TransferQueue) Watch() chan string {
+	return q.addWatcher(&q.watchers)
+}
 
-	if res.Error != nil {
-		if q.canRetryObject(oid, res.Error) {
-			tracerx.Printf("tq: retrying object %s", oid)
-			q.trMutex.Lock()
-			t, ok := q.transferables[oid]
-			q.trMutex.Unlock()
-			if ok {
-				q.retry(t)
-			} else {
-				q.errorc <- res.Error
-			}
-		} else {
-			q.errorc <- res.Error
-			q.wait.Done()
-		}
-	} else {
-		for _, c := range q.watchers {
-			c <- oid
-		}
+// WatchSkipped returns a channel where the queue will write the OID of each
+// Transferable which is skipped because it was rejected by the filter given to
+// SetFilter. The channel will be closed when the queue finishes processing, and
+// is buffered in the same way as those returned by Watch.
+func (q *TransferQueue) WatchSkipped() chan string {
+	return q.addWatcher(&q.skipWatchers)
+}
 
-		q.meter.FinishTransfer(res.Transfer.Name)
-		q.wait.Done()
+// WatchAlreadyPresent returns a channel where the queue will write the OID of
+// each Transferable which it did not transfer because the API returned no
+// action for it, which for uploads means that the server already has it. The
+// channel will be closed when the queue finishes processing, and is buffered in
+// the same way as those returned by Watch.
+func (q *TransferQueue) WatchAlreadyPresent() chan string {
+	return q.addWatcher(&q.presentWatchers)
+}
+
+// WatchResults returns a channel where the queue will write a WatchResult for
+// each object once it has finished trying to transfer it: a successful one for
+// each OID written to the channels from Watch, and a failed one for each object
+// which failed for good, after its retries, or which hadn't finished when the
+// queue timed out. Objects which are skipped or already present aren't
+// included. The channel will be closed when the queue finishes processing, and
+// is buffered in the same way as those returned by Watch.
+func (q *TransferQueue) WatchResults() chan WatchResult {
+	w := newResultWatcher()
+
+	q.watchMu.Lock()
+	defer q.watchMu.Unlock()
+
+	if q.closed {
+		w.close()
+	} else {
+		q.resultWatchers = append(q.resultWatchers, w)
 	}
+	return w.rc
 }
 
-// Wait waits for the queue to finish processing all transfers. Once Wait is
-// called, Add will no longer add transferables to the queue. Any failed
-// transfers will be automatically retried once.
-func (q *TransferQueue) Wait() {
-	if q.batcher != nil {
-		q.batcher.Exit()
+// UnwatchResults is Unwatch for a channel returned by WatchResults.
+func (q *TransferQueue) UnwatchResults(c chan WatchResult) {
+	q.watchMu.Lock()
+	defer q.watchMu.Unlock()
+
+	for i, w := range q.resultWatchers {
+		if w.rc == c {
+			q.resultWatchers = append(q.resultWatchers[:i], q.resultWatchers[i+1:]...)
+			w.stop()
+			return
+		}
 	}
+}
 
-	q.wait.Wait()
+// Unwatch stops the queue from writing to a channel returned by Watch,
+// WatchSkipped or WatchAlreadyPresent, and closes it. OIDs which have not been
+// read from it yet are discarded. Callers should use this when they stop
+// reading from a channel before the queue has finished.
+func (q *TransferQueue) Unwatch(c chan string) {
+	q.watchMu.Lock()
+	defer q.watchMu.Unlock()
+
+	for _, watchers := range []*[]*watcher{&q.watchers, &q.skipWatchers, &q.presentWatchers} {
+		for i, w := range *watchers {
+			if w.c == c {
+				*watchers = append((*watchers)[:i], (*watchers)[i+1:]...)
+				w.stop()
+				return
+			}
+		}
+	}
+}
 
-	// Handle any retries
-	close(q.retriesc)
-	q.retrywait.Wait()
+func (q *TransferQueue) addWatcher(watchers *[]*watcher) chan string {
+	w := newWatcher()
 
-	close(q.apic)
-	q.finishAdapter()
-	close(q.errorc)
+	q.watchMu.Lock()
+	defer q.watchMu.Unlock()
 
-	for _, watcher := range q.watchers {
-		close(watcher)
+	if q.closed {
+		w.close()
+	} else {
+		*watchers = append(*watchers, w)
 	}
+	return w.c
+}
 
-	q.meter.Finish()
-	q.errorwait.Wait()
+// notifyAlreadyPresent tells the watchers from WatchAlreadyPresent that the
+// object with the given OID does not need to be transferred, and counts it
+// and its size for AlreadyPresent.
+func (q *TransferQueue) notifyAlreadyPresent(oid string, size int64) {
+	atomic.AddInt64(&q.presentCount, 1)
+	atomic.AddInt64(&q.presentBytes, size)
+	q.notify(&q.presentWatchers, oid)
 }
 
-// Watch returns a channel where the queue will write the OID of each transfer
-// as it completes. The channel will be closed when the queue finishes processing.
-func (q *TransferQueue) Watch() chan string {
-	c := make(chan string, batchSize)
-	q.watchers = append(q.watchers, c)
-	return c
+// AlreadyPresent returns the number of objects, and their total size, which
+// the queue did not transfer because they were already present, as reported
+// to the channels from WatchAlreadyPresent. For uploads, these are the objects
+// which the server already has, so that pushing them again would only have
+// deduplicated them. They are counted apart from objects which were skipped
+// for any other reason, such as by the filter given to SetFilter.
+func (q *TransferQueue) AlreadyPresent() (int, int64) {
+	return int(atomic.LoadInt64(&q.presentCount)), atomic.LoadInt64(&q.presentBytes)
+}
+
+// SetJournal sets a journal in which the queue records the objects it
+// transfers, and skips any recorded by an earlier run, as those which it would
+// skip because the server already has them are. The journal is removed when
+// Wait returns if every object was transferred, and closed otherwise.
+// SetJournal must be called before the first call to Add.
+func (q *TransferQueue) SetJournal(j *TransferJournal) {
+	q.journal = j
+}
+
+// SetFilter sets a filter which decides whether each Transferable given to Add
+// should be transferred, before the queue asks the server about it. Rejected
+// objects are counted as skipped by the progress meter, reported to watchers
+// from WatchSkipped, and given to the skip callback with SkipFiltered. SetFilter
+// must be called before the first call to Add.
+func (q *TransferQueue) SetFilter(f TransferFilter) {
+	q.filter = f
 }
 
 // individualApiRoutine processes the queue of transfers one at a time by making
@@ -276,14 +1600,38 @@ func (q *TransferQueue) Watch() chan string {
 // sequential nature here is only for the meta POST calls.
 // TODO LEGACY API: remove when legacy API removed
 func (q *TransferQueue) individualApiRoutine(apiWaiter chan interface{}) {
-	for t := range q.apic {
+	defer q.apiwait.Done()
+
+	for {
+		var t Transferable
+		select {
+		case a, ok := <-q.apic:
+			if !ok {
+				return
+			}
+			atomic.AddInt64(&q.counters.batchDepth, -1)
+			t = a
+		case <-q.expiredc:
+			return
+		}
+
+		if q.isCancelled(t.Oid()) {
+			continue
+		}
+
+		if q.aborted() {
+			q.abandon(t)
+			continue
+		}
+
+		q.startAttempt(t.Oid())
 		obj, err := t.LegacyCheck()
 		if err != nil {
-			if q.canRetryObject(obj.Oid, err) {
-				q.retry(t)
+			if ok, err := q.canRetryObject(obj.Oid, err); ok {
+				q.retry(t, err)
 			} else {
-				q.errorc <- err
-				q.wait.Done()
+				q.addError(err)
+				q.fail(t.Oid())
 			}
 			continue
 		}
@@ -299,12 +1647,19 @@ func (q *TransferQueue) individualApiRoutine(apiWaiter chan interface{}) {
 		// Legacy API has no support for anything but basic transfer adapter
 		q.useAdapter(transfer.BasicAdapterName)
 		if obj != nil {
+			if !q.rewriteObject(t, obj) {
+				continue
+			}
 			t.SetObject(obj)
 			q.meter.Add(t.Name())
 			q.addToAdapter(t)
 		} else {
+			q.reportDryRun(t, "skip")
+			q.reportSkip(t.Oid(), t.Size(), q.noActionReason())
 			q.Skip(t.Size())
-			q.wait.Done()
+			q.finishNotifying(t.Oid(), func() {
+				q.notifyAlreadyPresent(t.Oid(), t.Size())
+			})
 		}
 	}
 }
@@ -314,12 +1669,15 @@ func (q *TransferQueue) individualApiRoutine(apiWaiter chan interface{}) {
 // fed from the batcher into apic to be processed individually.
 // TODO LEGACY API: remove when legacy API removed
 func (q *TransferQueue) legacyFallback(failedBatch []interface{}) {
+	defer q.apiwait.Done()
+
 	tracerx.Printf("tq: batch api not implemented, falling back to individual")
+	atomic.StoreUint32(&q.usedLegacyFallback, 1)
 
 	q.launchIndividualApiRoutines()
 
 	for _, t := range failedBatch {
-		q.apic <- t.(Transferable)
+		q.enqueue(t.(Transferable))
 	}
 
 	for {
@@ -327,56 +1685,204 @@ func (q *TransferQueue) legacyFallback(failedBatch []interface{}) {
 		if batch == nil {
 			break
 		}
+		atomic.AddInt64(&q.counters.batchDepth, -int64(len(batch)))
 
 		for _, t := range batch {
-			q.apic <- t.(Transferable)
+			q.enqueue(t.(Transferable))
+		}
+	}
+}
+
+// InFlight returns the number of objects which are being transferred right
+// now: those which have been handed to the transfer adapter, and haven't
+// finished or failed yet. Unlike the objects Wait is waiting for, it doesn't
+// include those still waiting to be sent in a batch, or to be retried.
+func (q *TransferQueue) InFlight() int {
+	return int(atomic.LoadInt32(&q.inFlight))
+}
+
+// UsedLegacyFallback returns whether the queue fell back to the deprecated
+// legacy API, one request per object, because the server does not support the
+// batch API. When it does, lfs.batch is also set to false in the local Git
+// config, so later queues in this repository start with the legacy API and
+// do not report a fallback.
+func (q *TransferQueue) UsedLegacyFallback() bool {
+	return atomic.LoadUint32(&q.usedLegacyFallback) == 1
+}
+
+// PreBatch sends the batch API requests for the objects which have been added
+// but not transferred yet, and keeps the responses, so that the objects can go
+// straight to the adapter when the queue reaches them, rather than waiting for
+// the request then. It returns once every response has been received, and can
+// be called while objects are still being added; those added afterwards are
+// requested as usual. It does nothing unless the queue uses the batch API.
+func (q *TransferQueue) PreBatch() error {
+	if q.batcher == nil || q.aborted() {
+		return nil
+	}
+
+	q.trMutex.Lock()
+	q.pbMu.Lock()
+	transfers := make([]*api.ObjectResource, 0, len(q.transferables))
+	for oid, t := range q.transferables {
+		if _, ok := q.prebatched[oid]; !ok {
+			transfers = append(transfers, requestObject(t))
+		}
+	}
+	q.pbMu.Unlock()
+	q.trMutex.Unlock()
+
+	for len(transfers) > 0 {
+		n := batchSize
+		if n > len(transfers) {
+			n = len(transfers)
+		}
+
+		tracerx.Printf("tq: prebatching %d objects", n)
+		objs, adapterName, err := q.batch("prebatch", transfers[:n], q.manifest.GetAdapterNames(q.direction))
+		if err != nil {
+			return err
 		}
+		transfers = transfers[n:]
+
+		q.storePrebatched(objs, adapterName)
+	}
+	return nil
+}
+
+// storePrebatched keeps the objects of a batch API response made by PreBatch
+// for the batchApiRoutine, apart from those which have finished meanwhile. If
+// the server chose a different adapter than for earlier responses, those are
+// dropped, and requested again as usual.
+func (q *TransferQueue) storePrebatched(objs []*api.ObjectResource, adapterName string) {
+	q.trMutex.Lock()
+	defer q.trMutex.Unlock()
+	q.pbMu.Lock()
+	defer q.pbMu.Unlock()
+
+	if adapterName != q.prebatchAdapter {
+		q.prebatched = make(map[string]*api.ObjectResource)
+		q.prebatchAdapter = adapterName
+	}
+
+	for _, o := range objs {
+		if _, ok := q.transferables[o.Oid]; ok {
+			q.prebatched[o.Oid] = o
+		}
+	}
+}
+
+// takePrebatched splits "batch" into the responses PreBatch kept for some of
+// its objects, with the adapter the server chose for them, and the rest.
+func (q *TransferQueue) takePrebatched(batch []interface{}) ([]*api.ObjectResource, string, []Transferable) {
+	q.pbMu.Lock()
+	defer q.pbMu.Unlock()
+
+	var cached []*api.ObjectResource
+	pending := make([]Transferable, 0, len(batch))
+	for _, i := range batch {
+		t := i.(Transferable)
+		if o, ok := q.prebatched[t.Oid()]; ok {
+			delete(q.prebatched, t.Oid())
+			cached = append(cached, o)
+			continue
+		}
+		pending = append(pending, t)
+	}
+	return cached, q.prebatchAdapter, pending
+}
+
+func transferablesToBatch(ts []Transferable) []interface{} {
+	batch := make([]interface{}, 0, len(ts))
+	for _, t := range ts {
+		batch = append(batch, t)
 	}
+	return batch
 }
 
 // batchApiRoutine processes the queue of transfers using the batch endpoint,
 // making only one POST call for all objects. The results are then handed
 // off to the transfer workers.
 func (q *TransferQueue) batchApiRoutine() {
-	var startProgress sync.Once
+	defer q.apiwait.Done()
 
-	transferAdapterNames := q.manifest.GetAdapterNames(q.direction)
+	var startProgress sync.Once
+	// seq numbers the batches sent to the API, starting from 1, so that
+	// errors can be matched up with the batch which they came from.
+	var seq int
 
 	for {
 		batch := q.batcher.Next()
 		if batch == nil {
 			break
 		}
+		if len(batch) == 0 {
+			// The batcher doesn't return empty batches, but if
+			// it did, there would be nothing to send.
+			continue
+		}
+		atomic.AddInt64(&q.counters.batchDepth, -int64(len(batch)))
+
+		if q.aborted() {
+			for _, i := range batch {
+				q.abandon(i.(Transferable))
+			}
+			continue
+		}
 
-		tracerx.Printf("tq: sending batch of size %d", len(batch))
+		// Objects which PreBatch has already asked the server about can
+		// go straight to the adapter.
+		cached, cachedAdapter, pending := q.takePrebatched(batch)
+		if len(cached) > 0 {
+			tracerx.Printf("tq: using %d prebatched objects", len(cached))
+			q.useAdapter(cachedAdapter)
+			startProgress.Do(q.meter.Start)
+			q.handleBatchObjects(cached)
+		}
 
-		transfers := make([]*api.ObjectResource, 0, len(batch))
-		for _, i := range batch {
-			t := i.(Transferable)
-			transfers = append(transfers, &api.ObjectResource{Oid: t.Oid(), Size: t.Size()})
+		transfers := make([]*api.ObjectResource, 0, len(pending))
+		for _, t := range pending {
+			if !q.isCancelled(t.Oid()) {
+				transfers = append(transfers, requestObject(t))
+				q.startAttempt(t.Oid())
+			}
 		}
 
 		if len(transfers) == 0 {
 			continue
 		}
 
-		objs, adapterName, err := api.Batch(config.Config, transfers, q.transferKind(), transferAdapterNames)
+		seq++
+		tracerx.Printf("tq: sending batch of size %d (batch #%d)", len(transfers), seq)
+
+		batchStart := time.Now()
+		// Look the adapters up for each batch, rather than once when the
+		// routine starts, so that ones registered with RegisterAdapter
+		// after the queue was built are offered to the server.
+		transferAdapterNames := q.manifest.GetAdapterNames(q.direction)
+		objs, adapterName, err := q.batch(fmt.Sprintf("batch #%d", seq), transfers, transferAdapterNames)
+		metrics.Since(metrics.Batch, batchStart)
 		if err != nil {
 			if errors.IsNotImplementedError(err) {
 				git.Config.SetLocal("", "lfs.batch", "false")
-				go q.legacyFallback(batch)
+				q.apiwait.Add(1)
+				go q.legacyFallback(transferablesToBatch(pending))
 				return
 			}
 
-			var errOnce sync.Once
-			for _, o := range batch {
-				t := o.(Transferable)
+			tracerx.Printf("tq: batch #%d failed: %s", seq, err)
+			err = errors.Wrapf(err, "batch #%d", seq)
 
-				if q.canRetryObject(t.Oid(), err) {
-					q.retry(t)
+			var errOnce sync.Once
+			for _, t := range pending {
+				if q.isCancelled(t.Oid()) {
+					continue
+				}
+				if ok, err := q.canRetryObject(t.Oid(), err); ok {
+					q.retry(t, err)
 				} else {
-					q.wait.Done()
-					errOnce.Do(func() { q.errorc <- err })
+					errOnce.Do(func() { q.addError(err) })
+					q.fail(t.Oid())
 				}
 			}
 
@@ -385,43 +1891,58 @@ func (q *TransferQueue) batchApiRoutine() {
 
 		q.useAdapter(adapterName)
 		startProgress.Do(q.meter.Start)
+		q.handleBatchObjects(objs)
+	}
+}
 
-		for _, o := range objs {
-			if o.Error != nil {
-				q.errorc <- errors.Wrapf(o.Error, "[%v] %v", o.Oid, o.Error.Message)
-				q.Skip(o.Size)
-				q.wait.Done()
-				continue
-			}
+// handleBatchObjects hands each object in a batch API response which needs to
+// be transferred to the adapter, and finishes the rest.
+func (q *TransferQueue) handleBatchObjects(objs []*api.ObjectResource) {
+	for _, o := range objs {
+		if q.isCancelled(o.Oid) {
+			continue
+		}
+
+		if o.Error != nil {
+			q.addError(errors.Wrapf(o.Error, "[%v] %v", o.Oid, o.Error.Message))
+			q.Skip(o.Size)
+			q.fail(o.Oid)
+			continue
+		}
 
-			if _, ok := o.Rel(q.transferKind()); ok {
-				// This object needs to be transferred
-				q.trMutex.Lock()
-				transfer, ok := q.transferables[o.Oid]
-				q.trMutex.Unlock()
+		if _, ok := o.Rel(q.transferKind()); ok {
+			// This object needs to be transferred
+			q.trMutex.Lock()
+			transfer, ok := q.transferables[o.Oid]
+			q.trMutex.Unlock()
 
-				if ok {
-					transfer.SetObject(o)
-					q.meter.Add(transfer.Name())
-					q.addToAdapter(transfer)
-				} else {
-					q.Skip(transfer.Size())
-					q.wait.Done()
+			if ok {
+				if !q.rewriteObject(transfer, o) {
+					continue
 				}
+				transfer.SetObject(o)
+				q.meter.Add(transfer.Name())
+				q.addToAdapter(transfer)
 			} else {
+				q.reportSkip(o.Oid, o.Size, SkipNoAction)
 				q.Skip(o.Size)
-				q.wait.Done()
+				q.finish(o.Oid)
 			}
-		}
-	}
-}
+		} else {
+			q.trMutex.Lock()
+			t, ok := q.transferables[o.Oid]
+			q.trMutex.Unlock()
+			if ok {
+				q.reportDryRun(t, "skip")
+			}
+			q.reportSkip(o.Oid, o.Size, q.noActionReason())
 
-// This goroutine collects errors returned from transfers
-func (q *TransferQueue) errorCollector() {
-	for err := range q.errorc {
-		q.errors = append(q.errors, err)
+			q.Skip(o.Size)
+			q.finishNotifying(o.Oid, func() {
+				q.notifyAlreadyPresent(o.Oid, o.Size)
+			})
+		}
 	}
-	q.errorwait.Done()
 }
 
 // retryCollector collects objects to retry, increments the number of times that
@@ -431,35 +1952,74 @@ func (q *TransferQueue) errorCollector() {
 //
 // retryCollector runs in its own goroutine.
 func (q *TransferQueue) retryCollector() {
-	for t := range q.retriesc {
+	defer q.retrywait.Done()
+
+	for {
+		var t Transferable
+		select {
+		case r, ok := <-q.retriesc:
+			if !ok {
+				return
+			}
+			t = r
+		case <-q.expiredc:
+			return
+		}
+
+		if q.isCancelled(t.Oid()) {
+			continue
+		}
+
 		q.rmu.Lock()
-		q.retryCount[t.Oid()]++
-		count := q.retryCount[t.Oid()]
+		count := 0
+		for _, n := range q.retryCount[t.Oid()] {
+			count += n
+		}
 		q.rmu.Unlock()
 
 		tracerx.Printf("tq: enqueue retry #%d for %q (size: %d)", count, t.Oid(), t.Size())
+		metrics.Add(metrics.Retries, 1)
+		atomic.AddInt64(&q.counters.retried, 1)
 
 		q.Add(t)
+		if q.expired() {
+			// Add didn't add it to the batcher, which Wait has
+			// closed, so there is nothing to flush.
+			continue
+		}
 		if q.batcher != nil {
 			tracerx.Printf("tq: flushing batch in response to retry #%d for %q", count, t.Oid(), t.Size())
 			q.batcher.Flush()
 		}
 	}
-	q.retrywait.Done()
 }
 
 // launchIndividualApiRoutines first launches a single api worker. When it
 // receives the first successful api request it launches workers - 1 more
 // workers. This prevents being prompted for credentials multiple times at once
 // when they're needed.
+//
+// If the first worker stops before any request succeeds, no more are launched.
 func (q *TransferQueue) launchIndividualApiRoutines() {
+	q.apiwait.Add(2)
 	go func() {
-		apiWaiter := make(chan interface{})
-		go q.individualApiRoutine(apiWaiter)
+		defer q.apiwait.Done()
 
-		<-apiWaiter
+		apiWaiter := make(chan interface{})
+		stopped := make(chan struct{})
+		go func() {
+			q.individualApiRoutine(apiWaiter)
+			close(stopped)
+		}()
+
+		select {
+		case <-apiWaiter:
+		case <-stopped:
+			return
+		}
 
 		for i := 0; i < q.oldApiWorkers-1; i++ {
+			q.apiwait.Add(1)
 			go q.individualApiRoutine(nil)
 		}
 	}()
@@ -467,14 +2027,16 @@ func (q *TransferQueue) launchIndividualApiRoutines() {
 
 // run starts the transfer queue, doing individual or batch transfers depending
 // on the Config.BatchTransfer() value. run will transfer files sequentially or
-// concurrently depending on the Config.ConcurrentTransfers() value.
+// concurrently depending on the Config.ConcurrentTransfers() value, and make
+// individual API requests concurrently depending on the
+// Config.TransferAPIConcurrency() value.
 func (q *TransferQueue) run() {
-	go q.errorCollector()
 	go q.retryCollector()
 
 	if config.Config.BatchTransfer() {
 		tracerx.Printf("tq: running as batched queue, batch size of %d", batchSize)
-		q.batcher = NewBatcher(batchSize)
+		q.batcher = NewBatcher(batchSize, config.Config.BatchFlushInterval())
+		q.apiwait.Add(1)
 		go q.batchApiRoutine()
 	} else {
 		tracerx.Printf("tq: running as individual queue")
@@ -482,33 +2044,217 @@ func (q *TransferQueue) run() {
 	}
 }
 
-func (q *TransferQueue) retry(t Transferable) {
-	q.retriesc <- t
+// addError records "err", to be returned by Errors. Once
+// lfs.transfer.maxfailures errors have been recorded, it aborts the queue so
+// that no more transfers are started.
+//
+// Errors are recorded straight away, so callers must add the error for an
+// object before finishing it: Wait returns once every object has finished,
+// and Errors must include all of their errors by then. Once the queue has
+// timed out, errors are dropped instead, as Wait reports every unfinished
+// transfer as timed out.
+func (q *TransferQueue) addError(err error) {
+	q.errMu.Lock()
+	defer q.errMu.Unlock()
+
+	if q.expired() {
+		tracerx.Printf("tq: dropping error after timeout: %s", err)
+		return
+	}
+
+	q.errors = append(q.errors, err)
+
+	q.failures++
+	if q.maxFailures > 0 && q.failures == q.maxFailures {
+		tracerx.Printf("tq: aborting after %d failures", q.failures)
+		q.errors = append(q.errors, errors.Errorf("Giving up on remaining transfers after %d failures (see lfs.transfer.maxfailures)", q.failures))
+		q.abort()
+	}
+}
+
+// enqueue hands "t" to the individual API routines, unless the queue has
+// timed out and they have stopped.
+// TODO LEGACY API: remove when legacy API removed
+func (q *TransferQueue) enqueue(t Transferable) {
+	atomic.AddInt64(&q.counters.batchDepth, 1)
+	select {
+	case q.apic <- t:
+	case <-q.expiredc:
+	}
+}
+
+// retry counts a retry of "t" against the category of the error "err" which
+// made it fail, and hands it to the retryCollector.
+func (q *TransferQueue) retry(t Transferable, err error) {
+	q.rmu.Lock()
+	counts := q.retryCount[t.Oid()]
+	if counts == nil {
+		counts = make(map[errors.Category]int)
+		q.retryCount[t.Oid()] = counts
+	}
+	counts[errors.CategoryOf(err)]++
+	q.rmu.Unlock()
+
+	// Ask the server again, rather than reusing a response from PreBatch.
+	q.pbMu.Lock()
+	delete(q.prebatched, t.Oid())
+	q.pbMu.Unlock()
+
+	select {
+	case q.retriesc <- t:
+	case <-q.expiredc:
+		// Wait has returned, so the retry would never be collected.
+	}
 }
 
-// canRetry returns whether or not the given error "err" is retriable.
+// canRetry returns whether or not the given error "err" is retriable for
+// transfers in this queue's direction, or, if it carries an HTTP status and
+// lfs.transfer.retriablestatuses is set, whether that lists the status. Every
+// error is if lfs.transfer.retryallerrors is set.
 func (q *TransferQueue) canRetry(err error) bool {
+	if retriable, classified := q.retriableStatus(err); classified {
+		if retriable {
+			return true
+		}
+	} else if CanRetryTransfer(q.direction, err) {
+		return true
+	}
+	if q.retryAllErrors {
+		tracerx.Printf("tq: retrying after an error which isn't retriable, since lfs.transfer.retryallerrors is set: %s", err)
+		return true
+	}
+	return false
+}
+
+// retriableStatuses returns the status codes given by
+// lfs.transfer.retriablestatuses, by code, or nil if it isn't set, warning
+// about any invalid entries.
+func retriableStatuses(cfg *config.Configuration) map[int]bool {
+	codes, invalid := cfg.TransferRetriableStatuses()
+	if len(invalid) > 0 {
+		retriableStatusesWarning.Do(func() {
+			fmt.Fprintf(os.Stderr, "WARNING: ignoring invalid HTTP status codes in lfs.transfer.retriablestatuses: %s\n", strings.Join(invalid, ", "))
+		})
+	}
+	if codes == nil {
+		return nil
+	}
+
+	statuses := make(map[int]bool, len(codes))
+	for _, code := range codes {
+		statuses[code] = true
+	}
+	return statuses
+}
+
+// retriableStatus returns whether "err" was caused by an HTTP response whose
+// status is one of those in lfs.transfer.retriablestatuses, and whether that
+// decides if it is retried: if the option is set and "err" has a status.
+func (q *TransferQueue) retriableStatus(err error) (retriable, classified bool) {
+	if q.retriableStatuses == nil {
+		return false, false
+	}
+	code := errors.StatusCodeOf(err)
+	if code == 0 {
+		return false, false
+	}
+	return q.retriableStatuses[code], true
+}
+
+// CanRetryTransfer returns whether a transfer in direction "dir" which failed
+// with "err" may be retried.
+//
+// Downloads may be retried after any retriable error, since repeating them is
+// harmless. Uploads are not idempotent with every server: retrying after a
+// partial upload can corrupt the stored object or be charged twice. So they
+// are only retried after errors which are known to be safe, such as those that
+// happened before any content was sent (see errors.IsSafeRetriableError).
+func CanRetryTransfer(dir transfer.Direction, err error) bool {
+	if dir == transfer.Upload {
+		return errors.IsSafeRetriableError(err)
+	}
 	return errors.IsRetriableError(err)
 }
 
+// startAttempt records that an attempt to transfer the object with the given
+// OID begins now, as its batch API request is sent or it is handed to the
+// adapter, so that canRetryObject can tell how long another would take. The
+// time it spends waiting in the queue beforehand doesn't count.
+func (q *TransferQueue) startAttempt(oid string) {
+	q.rmu.Lock()
+	q.attempts[oid] = q.clock.Now()
+	q.rmu.Unlock()
+}
+
 // canRetryObject returns whether the given error is retriable for the object
-// given by "oid". If the an OID has met its retry limit, then it will not be
-// able to be retried again. If so, canRetryObject returns whether or not that
-// given error "err" is retriable.
-func (q *TransferQueue) canRetryObject(oid string, err error) bool {
+// given by "oid", and the error to report for it if not. Retries are counted
+// separately for each category of error (see errors.CategoryOf), and if the
+// OID has met the retry limit for the category of "err", then it will not be
+// able to be retried again. Client errors are never retried, unless
+// lfs.transfer.retryallerrors is set, or lfs.transfer.retriablestatuses lists
+// their status, when they may be retried up to maxRetries times. Nor are objects
+// whose retry couldn't finish before the queue times out, going by how long
+// their last attempt took; those fail with a "deadline too close for retry"
+// error instead. Otherwise, canRetryObject returns whether or not that given
+// error "err" is retriable.
+func (q *TransferQueue) canRetryObject(oid string, err error) (bool, error) {
+	category := errors.CategoryOf(err)
+	statusRetriable, _ := q.retriableStatus(err)
+	if category == errors.ClientCategory && !q.retryAllErrors && !statusRetriable {
+		tracerx.Printf("tq: not retrying %q after client error", oid)
+		return false, err
+	}
+
 	q.rmu.Lock()
-	count := q.retryCount[oid]
+	count := q.retryCount[oid][category]
+	started, attempted := q.attempts[oid]
+	deadline := q.deadline
 	q.rmu.Unlock()
 
-	if count > q.maxRetries {
-		tracerx.Printf("tq: refusing to retry %q, too many retries (%d)", oid, count)
-		return false
+	limit := q.retryLimit(category)
+	if category == errors.ClientCategory && statusRetriable {
+		limit = q.maxRetries
+	}
+
+	if count >= limit {
+		tracerx.Printf("tq: refusing to retry %q, too many retries after %s errors (%d)", oid, category, count)
+		return false, err
+	}
+
+	if !q.canRetry(err) {
+		return false, err
 	}
 
-	return q.canRetry(err)
+	if attempted && !deadline.IsZero() {
+		now := q.clock.Now()
+		if took := now.Sub(started); now.Add(took).After(deadline) {
+			tracerx.Printf("tq: refusing to retry %q, the last attempt took %s but only %s remain", oid, took, deadline.Sub(now))
+			return false, errors.Wrap(err, "deadline too close for retry")
+		}
+	}
+
+	return true, err
+}
+
+// retryLimit returns the number of times an object may be retried after errors
+// in the given category.
+func (q *TransferQueue) retryLimit(category errors.Category) int {
+	switch category {
+	case errors.NetworkCategory:
+		return q.maxNetworkRetries
+	case errors.ClientCategory:
+		if q.retryAllErrors {
+			return q.maxRetries
+		}
+		return 0
+	}
+	return q.maxRetries
 }
 
 // Errors returns any errors encountered during transfer.
 func (q *TransferQueue) Errors() []error {
+	q.errMu.Lock()
+	defer q.errMu.Unlock()
+
 	return q.errors
 }
@@ -0,0 +1,2173 @@
+package lfs
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/github/git-lfs/api"
+	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/errors"
+	"github.com/github/git-lfs/transfer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanRetryTransferDownloads(t *testing.T) {
+	assert.True(t, CanRetryTransfer(transfer.Download, errors.NewRetriableError(errors.New("reset"))))
+	assert.True(t, CanRetryTransfer(transfer.Download, errors.NewSafeRetriableError(errors.New("reset"))))
+	assert.False(t, CanRetryTransfer(transfer.Download, errors.New("not found")))
+}
+
+func TestCanRetryTransferUploadsAreConservative(t *testing.T) {
+	assert.False(t, CanRetryTransfer(transfer.Upload, errors.NewRetriableError(errors.New("reset mid-upload"))))
+	assert.True(t, CanRetryTransfer(transfer.Upload, errors.NewSafeRetriableError(errors.New("reset before upload"))))
+	assert.False(t, CanRetryTransfer(transfer.Upload, errors.New("not found")))
+}
+
+// canRetryObject returns whether "q" would retry "oid" after "err".
+func canRetryObject(q *TransferQueue, oid string, err error) bool {
+	ok, _ := q.canRetryObject(oid, err)
+	return ok
+}
+
+func TestCanRetryObjectAfterNetworkErrors(t *testing.T) {
+	dnsErr := &url.Error{Op: "Post", URL: "https://example.com", Err: &net.OpError{
+		Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "example.com"},
+	}}
+	timeoutErr := &url.Error{Op: "Post", URL: "https://example.com", Err: &net.OpError{
+		Op: "read", Net: "tcp", Err: timeoutError{},
+	}}
+	certErr := &url.Error{Op: "Post", URL: "https://example.com", Err: x509.UnknownAuthorityError{}}
+
+	for _, dir := range []transfer.Direction{transfer.Download, transfer.Upload} {
+		q := newTransferQueue(1, 1, true, dir)
+
+		assert.True(t, canRetryObject(q, oidA, errors.NewRetriableNetworkError(errors.Wrap(dnsErr, "http"), false)))
+		assert.True(t, canRetryObject(q, oidA, errors.NewRetriableNetworkError(errors.Wrap(timeoutErr, "http"), true)))
+		assert.False(t, canRetryObject(q, oidA, errors.NewRetriableNetworkError(errors.Wrap(certErr, "http"), true)))
+	}
+
+	// Mid-request timeouts are only retried for downloads.
+	assert.True(t, canRetryObject(NewDownloadQueue(1, 1, true), oidA, errors.NewRetriableNetworkError(timeoutErr, false)))
+	assert.False(t, canRetryObject(NewUploadQueue(1, 1, true), oidA, errors.NewRetriableNetworkError(timeoutErr, false)))
+
+	// Retries are still capped, however transient the error.
+	q := NewDownloadQueue(1, 1, true)
+	q.retryCount[oidA] = map[errors.Category]int{errors.NetworkCategory: q.maxNetworkRetries}
+	assert.False(t, canRetryObject(q, oidA, errors.NewRetriableNetworkError(dnsErr, false)))
+}
+
+func TestCanRetryObjectBeforeDeadline(t *testing.T) {
+	q := NewDownloadQueue(1, 1, true)
+	q.clock = newFakeClock()
+	now := q.clock.Now()
+	q.setDeadline(now.Add(time.Minute))
+
+	// The last attempt took a few seconds, so a retry has time to finish.
+	q.attempts[oidA] = now.Add(-5 * time.Second)
+	ok, err := q.canRetryObject(oidA, networkErr())
+	assert.True(t, ok)
+	assert.Equal(t, networkErr().Error(), err.Error())
+
+	// The last attempt took longer than the time which is left.
+	q.attempts[oidA] = now.Add(-2 * time.Minute)
+	ok, err = q.canRetryObject(oidA, networkErr())
+	assert.False(t, ok)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "deadline too close for retry")
+		assert.Contains(t, err.Error(), "no such host")
+	}
+
+	// A later deadline doesn't replace an earlier one.
+	q.setDeadline(now.Add(time.Hour))
+	assert.False(t, canRetryObject(q, oidA, networkErr()))
+}
+
+func TestCanRetryObjectWithoutDeadline(t *testing.T) {
+	q := NewDownloadQueue(1, 1, true)
+	q.attempts[oidA] = time.Now().Add(-time.Hour)
+	assert.True(t, canRetryObject(q, oidA, networkErr()))
+}
+
+func statusErr(code int) error {
+	err := errors.Errorf("api: received status %d", code)
+	return errors.NewRetriableNetworkError(errors.NewStatusError(err, code), true)
+}
+
+func networkErr() error {
+	return errors.NewRetriableNetworkError(&url.Error{Op: "Post", URL: "https://example.com", Err: &net.OpError{
+		Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "example.com"},
+	}}, false)
+}
+
+// runFailingQueue runs a dry run download queue for the OID oidA, whose batch
+// API requests fail with each of "errs" in turn, and then succeed.
+func runFailingQueue(errs ...error) (q *TransferQueue, calls int) {
+	return runFailing(NewDownloadQueue(1, 1, true), errs...)
+}
+
+// runFailing is runFailingQueue for a given dry run download queue "q".
+func runFailing(q *TransferQueue, errs ...error) (*TransferQueue, int) {
+	var mu sync.Mutex
+	var calls int
+
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+		if calls <= len(errs) {
+			return nil, "", errs[calls-1]
+		}
+		return []*api.ObjectResource{downloadable(oidA)}, "basic", nil
+	}
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Wait()
+	return q, calls
+}
+
+func TestTransferQueueCountsRetriesByErrorCategory(t *testing.T) {
+	q, calls := runFailingQueue(networkErr(), statusErr(503), networkErr(), statusErr(429), networkErr())
+
+	// Together that's more retries than either limit allows, but neither
+	// limit was reached.
+	assert.Equal(t, 2, q.maxRetries)
+	assert.Equal(t, 3, q.maxNetworkRetries)
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, 6, calls)
+	assert.Equal(t, map[errors.Category]int{
+		errors.NetworkCategory: 3,
+		errors.ServerCategory:  2,
+	}, q.retryCount[oidA])
+}
+
+func TestTransferQueueStopsRetryingAtCategoryLimit(t *testing.T) {
+	q, calls := runFailingQueue(statusErr(500), networkErr(), statusErr(502), statusErr(503))
+
+	assert.Len(t, q.Errors(), 1)
+	assert.Equal(t, 4, calls)
+	assert.Equal(t, map[errors.Category]int{
+		errors.NetworkCategory: 1,
+		errors.ServerCategory:  2,
+	}, q.retryCount[oidA])
+}
+
+func TestTransferQueueNeverRetriesClientErrors(t *testing.T) {
+	q, calls := runFailingQueue(networkErr(), statusErr(404))
+
+	assert.Len(t, q.Errors(), 1)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, map[errors.Category]int{errors.NetworkCategory: 1}, q.retryCount[oidA])
+}
+
+func TestTransferQueueRetriesClientErrorsWithRetryAllErrors(t *testing.T) {
+	q := NewDownloadQueue(1, 1, true)
+	q.retryAllErrors = true
+	q, calls := runFailing(q, statusErr(404), errors.New("not retriable"))
+
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 1, q.retryCount[oidA][errors.ClientCategory])
+}
+
+func TestTransferQueueRetriesConfiguredStatuses(t *testing.T) {
+	q := NewDownloadQueue(1, 1, true)
+	q.retriableStatuses = map[int]bool{404: true, 503: true}
+	q, calls := runFailing(q, statusErr(404), statusErr(503), networkErr())
+
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, 4, calls)
+	assert.Equal(t, map[errors.Category]int{
+		errors.ClientCategory:  1,
+		errors.ServerCategory:  1,
+		errors.NetworkCategory: 1,
+	}, q.retryCount[oidA])
+}
+
+func TestTransferQueueOnlyRetriesConfiguredStatuses(t *testing.T) {
+	q := NewDownloadQueue(1, 1, true)
+	q.retriableStatuses = map[int]bool{429: true}
+	q, calls := runFailing(q, statusErr(503))
+
+	assert.Len(t, q.Errors(), 1)
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, q.retryCount[oidA])
+}
+
+func TestTransferQueueRetryAllErrorsKeepsRetryLimit(t *testing.T) {
+	q := NewDownloadQueue(1, 1, true)
+	q.retryAllErrors = true
+	q.maxRetries = 2
+	q, calls := runFailing(q, statusErr(400), statusErr(400), statusErr(400), statusErr(400))
+
+	assert.Len(t, q.Errors(), 1)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 2, q.retryCount[oidA][errors.ClientCategory])
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// OIDs for test objects, which sort in the same order as their names.
+var (
+	oidA = strings.Repeat("a", 64)
+	oidB = strings.Repeat("b", 64)
+	oidC = strings.Repeat("c", 64)
+)
+
+type queueTestTransferable struct {
+	oid    string
+	size   int64
+	path   string
+	obj    *api.ObjectResource
+	legacy *api.ObjectResource
+}
+
+func (t *queueTestTransferable) Oid() string                     { return t.oid }
+func (t *queueTestTransferable) Size() int64                     { return t.size }
+func (t *queueTestTransferable) Name() string                    { return t.oid + ".dat" }
+func (t *queueTestTransferable) Path() string                    { return t.path }
+func (t *queueTestTransferable) Object() *api.ObjectResource     { return t.obj }
+func (t *queueTestTransferable) SetObject(o *api.ObjectResource) { t.obj = o }
+func (t *queueTestTransferable) LegacyCheck() (*api.ObjectResource, error) {
+	return t.legacy, nil
+}
+
+func downloadable(oid string) *api.ObjectResource {
+	return &api.ObjectResource{
+		Oid:     oid,
+		Size:    1,
+		Actions: map[string]*api.LinkRelation{"download": {Href: "https://example.com/" + oid}},
+	}
+}
+
+// runStubbedQueue runs a dry run download queue for the given OIDs, with batch
+// API requests answered by "batch". It returns the OIDs which the queue would
+// have transferred, and the errors it collected.
+func runStubbedQueue(batch batchFunc, oids ...string) ([]string, []error) {
+	q := NewDownloadQueue(len(oids), int64(len(oids)), true)
+	q.batchFunc = batch
+	watcher := q.Watch()
+
+	for _, oid := range oids {
+		q.Add(&queueTestTransferable{oid: oid, size: 1})
+	}
+	q.Wait()
+
+	var done []string
+	for oid := range watcher {
+		done = append(done, oid)
+	}
+	sort.Strings(done)
+
+	return done, q.Errors()
+}
+
+// runOrderedQueue runs a dry run download queue with lfs.transfer.order set to
+// "order", adding objects of the given sizes, and returns the sizes in the
+// order the queue sent them to the batch API.
+func runOrderedQueue(order string, sizes ...int64) []int64 {
+	q := NewDownloadQueue(len(sizes), int64(len(sizes)), true)
+	q.order = order
+
+	var batched []int64
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		for _, o := range objects {
+			batched = append(batched, o.Size)
+		}
+		return objects, "basic", nil
+	}
+
+	for i, size := range sizes {
+		q.Add(&queueTestTransferable{oid: fmt.Sprintf("%064d", i), size: size})
+	}
+	q.Wait()
+
+	return batched
+}
+
+func TestTransferQueueOrdersBySize(t *testing.T) {
+	assert.Equal(t, []int64{3, 1, 4, 1, 5}, runOrderedQueue("fifo", 3, 1, 4, 1, 5))
+	assert.Equal(t, []int64{1, 1, 3, 4, 5}, runOrderedQueue("size-asc", 3, 1, 4, 1, 5))
+	assert.Equal(t, []int64{5, 4, 3, 1, 1}, runOrderedQueue("size-desc", 3, 1, 4, 1, 5))
+}
+
+func TestTransferQueueSkipsObjectsWithoutActions(t *testing.T) {
+	var mu sync.Mutex
+	actions := make(map[string]string)
+
+	q := NewDownloadQueue(2, 2, true)
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		assert.Equal(t, "download", operation)
+		return []*api.ObjectResource{downloadable(oidA), {Oid: oidB, Size: 1}}, "basic", nil
+	}
+	q.SetDryRunCallback(func(e *DryRunEntry) {
+		mu.Lock()
+		actions[e.Oid] = e.Action
+		mu.Unlock()
+	})
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.Wait()
+
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, map[string]string{oidA: "download", oidB: "skip"}, actions)
+}
+
+func TestTransferQueueRewritesObjects(t *testing.T) {
+	q := NewDownloadQueue(2, 2, true)
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{downloadable(oidA), downloadable(oidB)}, "basic", nil
+	}
+	q.SetObjectRewriter(func(o *api.ObjectResource) error {
+		if o.Oid == oidB {
+			return errors.New("no signing key")
+		}
+		o.Actions["download"].Href += "?signature=abc"
+		return nil
+	})
+	watcher := q.Watch()
+
+	a := &queueTestTransferable{oid: oidA, size: 1}
+	q.Add(a)
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.Wait()
+
+	var done []string
+	for oid := range watcher {
+		done = append(done, oid)
+	}
+	assert.Equal(t, []string{oidA}, done)
+
+	if assert.NotNil(t, a.Object()) {
+		rel, _ := a.Object().Rel("download")
+		assert.Equal(t, "https://example.com/"+oidA+"?signature=abc", rel.Href)
+	}
+
+	errs := q.Errors()
+	if assert.Len(t, errs, 1) {
+		assert.Contains(t, errs[0].Error(), "Error rewriting actions for "+oidB+".dat")
+		assert.Contains(t, errs[0].Error(), "no signing key")
+	}
+}
+
+func TestTransferQueueRejectsInvalidOids(t *testing.T) {
+	var batched []string
+	done, errs := runStubbedQueue(func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			batched = append(batched, o.Oid)
+			objs = append(objs, downloadable(o.Oid))
+		}
+		return objs, "basic", nil
+	}, oidA, "", "not-an-oid", strings.ToUpper(oidB), oidC[1:])
+
+	assert.Equal(t, []string{oidA}, batched)
+	assert.Equal(t, []string{oidA}, done)
+
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	sort.Strings(msgs)
+	assert.Equal(t, []string{
+		`invalid object id "" for ".dat"`,
+		fmt.Sprintf("invalid object id %q for %q", strings.ToUpper(oidB), strings.ToUpper(oidB)+".dat"),
+		fmt.Sprintf("invalid object id %q for %q", oidC[1:], oidC[1:]+".dat"),
+		`invalid object id "not-an-oid" for "not-an-oid.dat"`,
+	}, msgs)
+}
+
+func TestTransferQueueWatchAlreadyPresent(t *testing.T) {
+	q := NewUploadQueue(2, 2, true)
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		uploadable := &api.ObjectResource{
+			Oid:     oidA,
+			Size:    1,
+			Actions: map[string]*api.LinkRelation{"upload": {Href: "https://example.com/a"}},
+		}
+		return []*api.ObjectResource{uploadable, {Oid: oidB, Size: 1}}, "basic", nil
+	}
+	presentc := q.WatchAlreadyPresent()
+	transferredc := q.Watch()
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.Wait()
+
+	var present, transferred []string
+	for oid := range presentc {
+		present = append(present, oid)
+	}
+	for oid := range transferredc {
+		transferred = append(transferred, oid)
+	}
+
+	assert.Equal(t, []string{oidB}, present)
+	assert.Equal(t, []string{oidA}, transferred)
+}
+
+func TestTransferQueueAlreadyPresent(t *testing.T) {
+	q := NewUploadQueue(3, 12, true)
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		uploadable := &api.ObjectResource{
+			Oid:     oidA,
+			Size:    1,
+			Actions: map[string]*api.LinkRelation{"upload": {Href: "https://example.com/a"}},
+		}
+		return []*api.ObjectResource{uploadable, {Oid: oidB, Size: 4}, {Oid: oidC, Size: 7}}, "basic", nil
+	}
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 4})
+	q.Add(&queueTestTransferable{oid: oidC, size: 7})
+	q.Wait()
+
+	count, size := q.AlreadyPresent()
+	assert.Equal(t, 2, count)
+	assert.Equal(t, int64(11), size)
+
+	assert.Nil(t, q.Reset(0, 0))
+	q.Wait()
+
+	count, size = q.AlreadyPresent()
+	assert.Equal(t, 0, count)
+	assert.Equal(t, int64(0), size)
+}
+
+// runSkippingQueue adds the given OIDs to the dry run queue "q", whose batch
+// API requests are answered with "objs", and returns the reasons given to its
+// skip callback for each of them.
+func runSkippingQueue(q *TransferQueue, objs []*api.ObjectResource, oids ...string) map[string]string {
+	var mu sync.Mutex
+	reasons := make(map[string]string)
+
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return objs, "basic", nil
+	}
+	q.SetSkipCallback(func(oid string, size int64, reason string) {
+		mu.Lock()
+		defer mu.Unlock()
+		reasons[oid] = reason
+	})
+
+	for _, oid := range oids {
+		q.Add(&queueTestTransferable{oid: oid, size: 1})
+	}
+	q.Wait()
+	return reasons
+}
+
+func TestTransferQueueReportsSkippedDownloads(t *testing.T) {
+	objs := []*api.ObjectResource{
+		downloadable(oidA),
+		{Oid: oidB, Size: 1},
+		{Oid: oidC, Size: 1, Error: &api.ObjectError{Code: 404, Message: "not found"}},
+	}
+	reasons := runSkippingQueue(NewDownloadQueue(3, 3, true), objs, oidA, oidB, oidC)
+
+	// c failed, so it wasn't skipped.
+	assert.Equal(t, map[string]string{
+		oidA: SkipDryRun,
+		oidB: SkipNoAction,
+	}, reasons)
+}
+
+func TestTransferQueueReportsSkippedUploads(t *testing.T) {
+	objs := []*api.ObjectResource{
+		{
+			Oid:     oidA,
+			Size:    1,
+			Actions: map[string]*api.LinkRelation{"upload": {Href: "https://example.com/a"}},
+		},
+		{Oid: oidB, Size: 1},
+	}
+	reasons := runSkippingQueue(NewUploadQueue(2, 2, true), objs, oidA, oidB)
+
+	assert.Equal(t, map[string]string{
+		oidA: SkipDryRun,
+		oidB: SkipAlreadyPresent,
+	}, reasons)
+}
+
+// expiring returns a downloadable object whose action expires now.
+func expiring(oid string) *api.ObjectResource {
+	o := downloadable(oid)
+	o.Actions["download"].ExpiresAt = time.Now()
+	return o
+}
+
+func TestTransferQueueRefreshesExpiredActions(t *testing.T) {
+	var mu sync.Mutex
+	var refreshed []string
+
+	q := NewDownloadQueue(2, 2, true)
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{expiring(oidA), downloadable(oidB)}, "basic", nil
+	}
+	q.refreshFunc = func(cfg *config.Configuration, obj *api.ObjectResource, operation string, adapters []string) (*api.ObjectResource, error) {
+		assert.Equal(t, "download", operation)
+		mu.Lock()
+		refreshed = append(refreshed, obj.Oid)
+		mu.Unlock()
+
+		fresh := downloadable(obj.Oid)
+		fresh.Actions["download"].Href += "?fresh"
+		fresh.Actions["download"].ExpiresAt = time.Now().Add(time.Hour)
+		return fresh, nil
+	}
+	watcher := q.Watch()
+
+	a := &queueTestTransferable{oid: oidA, size: 1}
+	b := &queueTestTransferable{oid: oidB, size: 1}
+	q.Add(a)
+	q.Add(b)
+	q.Wait()
+
+	var done []string
+	for oid := range watcher {
+		done = append(done, oid)
+	}
+	sort.Strings(done)
+
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, []string{oidA, oidB}, done)
+	assert.Equal(t, []string{oidA}, refreshed)
+	assert.Equal(t, "https://example.com/"+oidA+"?fresh", a.obj.Actions["download"].Href)
+	assert.Equal(t, "https://example.com/"+oidB, b.obj.Actions["download"].Href)
+}
+
+// metadataTransferable is a queueTestTransferable with request metadata.
+type metadataTransferable struct {
+	*queueTestTransferable
+	metadata map[string]interface{}
+}
+
+func (t *metadataTransferable) RequestMetadata() map[string]interface{} { return t.metadata }
+
+func TestTransferQueueSendsRequestMetadata(t *testing.T) {
+	var mu sync.Mutex
+	batched := make(map[string]map[string]interface{})
+	var refreshed map[string]interface{}
+
+	q := NewDownloadQueue(2, 2, true)
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		mu.Lock()
+		for _, o := range objects {
+			batched[o.Oid] = o.Metadata
+		}
+		mu.Unlock()
+		return []*api.ObjectResource{expiring(oidA), downloadable(oidB)}, "basic", nil
+	}
+	q.refreshFunc = func(cfg *config.Configuration, obj *api.ObjectResource, operation string, adapters []string) (*api.ObjectResource, error) {
+		mu.Lock()
+		refreshed = obj.Metadata
+		mu.Unlock()
+
+		fresh := downloadable(obj.Oid)
+		fresh.Actions["download"].ExpiresAt = time.Now().Add(time.Hour)
+		return fresh, nil
+	}
+
+	metadata := map[string]interface{}{"ref": "refs/heads/master"}
+	q.Add(&metadataTransferable{&queueTestTransferable{oid: oidA, size: 1}, metadata})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.Wait()
+
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, metadata, batched[oidA])
+	assert.Nil(t, batched[oidB])
+	assert.Equal(t, metadata, refreshed)
+}
+
+func TestTransferQueueRefreshingExpiredActionsCanSkipOrFail(t *testing.T) {
+	q := NewDownloadQueue(2, 2, true)
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{expiring(oidA), expiring(oidB)}, "basic", nil
+	}
+	q.refreshFunc = func(cfg *config.Configuration, obj *api.ObjectResource, operation string, adapters []string) (*api.ObjectResource, error) {
+		if obj.Oid == oidA {
+			// the server no longer has anything to transfer
+			return &api.ObjectResource{Oid: obj.Oid, Size: obj.Size}, nil
+		}
+		return nil, errors.New("not found")
+	}
+	presentc := q.WatchAlreadyPresent()
+	transferredc := q.Watch()
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.Wait()
+
+	var present, transferred []string
+	for oid := range presentc {
+		present = append(present, oid)
+	}
+	for oid := range transferredc {
+		transferred = append(transferred, oid)
+	}
+
+	assert.Equal(t, []string{oidA}, present)
+	assert.Empty(t, transferred)
+	if assert.Len(t, q.Errors(), 1) {
+		assert.Equal(t, "not found", q.Errors()[0].Error())
+	}
+}
+
+func TestTransferQueueForgetsFinishedTransferables(t *testing.T) {
+	q := NewDownloadQueue(3, 3, true)
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			if o.Oid == oidC {
+				objs = append(objs, &api.ObjectResource{Oid: oidC, Size: 1, Error: &api.ObjectError{Code: 404, Message: "not found"}})
+			} else {
+				objs = append(objs, downloadable(o.Oid))
+			}
+		}
+		return objs, "basic", nil
+	}
+	watcher := q.Watch()
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.batcher.Flush()
+	assert.Equal(t, oidA, <-watcher)
+
+	// Adding a finished object again transfers it again.
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.Add(&queueTestTransferable{oid: oidC, size: 1})
+	q.Wait()
+
+	var done []string
+	for oid := range watcher {
+		done = append(done, oid)
+	}
+	sort.Strings(done)
+
+	assert.Equal(t, []string{oidA, oidB}, done)
+	assert.Len(t, q.Errors(), 1)
+	assert.Empty(t, q.transferables)
+}
+
+func TestTransferQueueUnwatch(t *testing.T) {
+	q := NewDownloadQueue(3, 3, true)
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		res := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			res = append(res, downloadable(o.Oid))
+		}
+		return res, "basic", nil
+	}
+	abandoned := q.Watch()
+	watched := q.Watch()
+	q.Unwatch(abandoned)
+
+	_, open := <-abandoned
+	assert.False(t, open, "expected channel to be closed by Unwatch")
+
+	for _, oid := range []string{oidA, oidB, oidC} {
+		q.Add(&queueTestTransferable{oid: oid, size: 1})
+	}
+	q.Wait()
+
+	var done []string
+	for oid := range watched {
+		done = append(done, oid)
+	}
+	sort.Strings(done)
+
+	assert.Equal(t, []string{oidA, oidB, oidC}, done)
+}
+
+func TestTransferQueueDoesNotWaitForSlowWatchers(t *testing.T) {
+	oids := make([]string, 0, 3*batchSize)
+	for i := 0; i < cap(oids); i++ {
+		oids = append(oids, fmt.Sprintf("%064d", i))
+	}
+
+	// runStubbedQueue only reads from its watcher after Wait returns, by
+	// which time there are more OIDs than fit in the channel's buffer.
+	done, errs := runStubbedQueue(func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		res := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			res = append(res, downloadable(o.Oid))
+		}
+		return res, "basic", nil
+	}, oids...)
+
+	assert.Empty(t, errs)
+	assert.Equal(t, oids, done)
+}
+
+func TestTransferQueueBlockedWatcherDoesNotStallOthers(t *testing.T) {
+	q := NewDownloadQueue(2*batchSize, 2*batchSize, true)
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		res := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			res = append(res, downloadable(o.Oid))
+		}
+		return res, "basic", nil
+	}
+	q.Watch() // never read from
+	watched := q.Watch()
+
+	var done []string
+	read := make(chan struct{})
+	go func() {
+		for oid := range watched {
+			done = append(done, oid)
+		}
+		close(read)
+	}()
+
+	for i := 0; i < 2*batchSize; i++ {
+		q.Add(&queueTestTransferable{oid: fmt.Sprintf("%064d", i), size: 1})
+	}
+	q.Wait()
+	<-read
+
+	assert.Len(t, done, 2*batchSize)
+}
+
+func TestTransferQueueRetriesRetriableBatchErrors(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+
+	done, errs := runStubbedQueue(func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+		if calls == 1 {
+			return nil, "", errors.NewRetriableError(errors.New("connection reset"))
+		}
+		return []*api.ObjectResource{downloadable(oidA)}, "basic", nil
+	}, oidA)
+
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{oidA}, done)
+	assert.Equal(t, 2, calls)
+}
+
+func TestTransferQueueReportsFatalBatchErrors(t *testing.T) {
+	done, errs := runStubbedQueue(func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return nil, "", errors.New("bad credentials")
+	}, oidA, oidB)
+
+	assert.Empty(t, done)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "batch #1: bad credentials", errs[0].Error())
+	}
+}
+
+func TestTransferQueueNumbersFailedBatches(t *testing.T) {
+	q, calls := runFailingQueue(networkErr(), errors.New("bad credentials"))
+
+	assert.Equal(t, 2, calls)
+	if assert.Len(t, q.Errors(), 1) {
+		assert.Equal(t, "batch #2: bad credentials", q.Errors()[0].Error())
+	}
+}
+
+func TestTransferQueueFallsBackToLegacyApi(t *testing.T) {
+	// Falling back sets lfs.batch=false in the local repository, so make
+	// sure that isn't this one.
+	dir, err := ioutil.TempDir("", "lfs-transfer-queue")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, exec.Command("git", "init", dir).Run())
+
+	wd, err := os.Getwd()
+	require.Nil(t, err)
+	require.Nil(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	q := NewDownloadQueue(1, 1, true)
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return nil, "", errors.NewNotImplementedError(errors.New("no batch endpoint"))
+	}
+	watcher := q.Watch()
+	assert.False(t, q.UsedLegacyFallback())
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1, legacy: downloadable(oidA)})
+	q.Wait()
+
+	var done []string
+	for oid := range watcher {
+		done = append(done, oid)
+	}
+
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, []string{oidA}, done)
+	assert.True(t, q.UsedLegacyFallback())
+}
+
+func TestTransferQueueAbortsAfterMaxFailures(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+
+	q := NewDownloadQueue(150, 150, true)
+	q.maxFailures = 1
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			objs = append(objs, &api.ObjectResource{
+				Oid:   o.Oid,
+				Size:  o.Size,
+				Error: &api.ObjectError{Code: 401, Message: "bad credentials"},
+			})
+		}
+		return objs, "basic", nil
+	}
+
+	// The first batch of 100 objects fails, so the remaining 50 are never
+	// sent to the API.
+	for i := 0; i < 150; i++ {
+		q.Add(&queueTestTransferable{oid: fmt.Sprintf("%064d", i), size: 1})
+	}
+	q.Wait()
+
+	assert.Equal(t, 1, calls)
+	if assert.Len(t, q.Errors(), batchSize+1) {
+		assert.Contains(t, q.Errors()[1].Error(), "Giving up on remaining transfers after 1 failures")
+	}
+}
+
+func TestTransferQueueWithoutMaxFailuresTriesEverything(t *testing.T) {
+	done, errs := runStubbedQueue(func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			if o.Oid == oidA {
+				objs = append(objs, &api.ObjectResource{Oid: oidA, Size: 1, Error: &api.ObjectError{Code: 404, Message: "not found"}})
+			} else {
+				objs = append(objs, downloadable(o.Oid))
+			}
+		}
+		return objs, "basic", nil
+	}, oidA, oidB)
+
+	assert.Len(t, errs, 1)
+	assert.Equal(t, []string{oidB}, done)
+}
+
+// hangingAdapter is a transfer adapter whose transfers never finish, like one
+// stuck on a dead connection.
+type hangingAdapter struct {
+	dir transfer.Direction
+}
+
+func (a *hangingAdapter) Name() string                  { return "hanging" }
+func (a *hangingAdapter) Direction() transfer.Direction { return a.dir }
+func (a *hangingAdapter) Add(t *transfer.Transfer)      { select {} }
+func (a *hangingAdapter) End()                          { select {} }
+func (a *hangingAdapter) ClearTempStorage() error       { return nil }
+func (a *hangingAdapter) Begin(maxConcurrency int, cb transfer.TransferProgressCallback, completion chan transfer.TransferResult) error {
+	return nil
+}
+
+func TestTransferQueueTimesOut(t *testing.T) {
+	q := NewDownloadQueue(2, 2, false)
+	q.manifest.RegisterNewTransferAdapterFunc("hanging", transfer.Download, func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &hangingAdapter{dir: dir}
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{downloadable(oidA), downloadable(oidB)}, "hanging", nil
+	}
+	q.startTimeout(100 * time.Millisecond)
+	watcher := q.Watch()
+
+	start := time.Now()
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.Wait()
+	elapsed := time.Since(start)
+
+	assert.True(t, elapsed >= 100*time.Millisecond, "returned after %s", elapsed)
+	assert.True(t, elapsed < 2*time.Second, "returned after %s", elapsed)
+
+	var done []string
+	for oid := range watcher {
+		done = append(done, oid)
+	}
+	assert.Empty(t, done)
+
+	errs := q.Errors()
+	if assert.Len(t, errs, 2) {
+		for _, err := range errs {
+			assert.Contains(t, err.Error(), "Timed out after 100ms transferring")
+		}
+	}
+}
+
+// endingAdapter is a cancellableAdapter which closes "ended" once it has been
+// ended.
+type endingAdapter struct {
+	*cancellableAdapter
+	ended chan struct{}
+}
+
+func (a *endingAdapter) End() {
+	a.cancellableAdapter.End()
+	close(a.ended)
+}
+
+func TestTransferQueueTimeoutCancelsRunningTransfers(t *testing.T) {
+	adapter := &endingAdapter{
+		cancellableAdapter: &cancellableAdapter{
+			gatedAdapter: gatedAdapter{
+				started: make(chan string, 2),
+				release: make(chan struct{}),
+			},
+			cancelled: make(map[string]chan struct{}),
+		},
+		ended: make(chan struct{}),
+	}
+
+	q := NewDownloadQueue(2, 2, false)
+	q.RegisterAdapter("cancellable", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		adapter.dir = dir
+		return adapter
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{downloadable(oidA), downloadable(oidB)}, "cancellable", nil
+	}
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	assert.NotNil(t, q.WaitWithTimeout(100*time.Millisecond))
+
+	// The transfers never finish unless they are cancelled, so the adapter
+	// is only ended once they have been.
+	select {
+	case <-adapter.ended:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the running transfers to be cancelled")
+	}
+
+	// Either transfer may not have reached the adapter before the queue
+	// timed out, but every one which did has been cancelled.
+	adapter.mu.Lock()
+	assert.Empty(t, adapter.cancelled)
+	adapter.mu.Unlock()
+
+	errs := q.Errors()
+	if assert.Len(t, errs, 2) {
+		for _, err := range errs {
+			assert.Contains(t, err.Error(), "Timed out after 100ms transferring")
+		}
+	}
+}
+
+func TestTransferQueueTimesOutByItsClock(t *testing.T) {
+	c := newFakeClock()
+	q := NewDownloadQueue(2, 2, false)
+	q.clock = c
+	q.RegisterAdapter("hanging", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &hangingAdapter{dir: dir}
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{downloadable(oidA), downloadable(oidB)}, "hanging", nil
+	}
+	q.startTimeout(time.Hour)
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+
+	go func() {
+		c.BlockUntilWaiting(1)
+		c.Advance(time.Hour)
+	}()
+	q.Wait()
+
+	errs := q.Errors()
+	if assert.Len(t, errs, 2) {
+		for _, err := range errs {
+			assert.Contains(t, err.Error(), "Timed out after 1h0m0s transferring")
+		}
+	}
+	assert.NotNil(t, q.Reset(0, 0))
+}
+
+func TestTransferQueueWaitWithTimeoutGivesUp(t *testing.T) {
+	q := NewDownloadQueue(2, 2, false)
+	q.RegisterAdapter("hanging", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &hangingAdapter{dir: dir}
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{downloadable(oidA), downloadable(oidB)}, "hanging", nil
+	}
+	watcher := q.Watch()
+
+	start := time.Now()
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	err := q.WaitWithTimeout(100 * time.Millisecond)
+	elapsed := time.Since(start)
+
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "Timed out after 100ms waiting for transfers", err.Error())
+	}
+	assert.True(t, elapsed >= 100*time.Millisecond, "returned after %s", elapsed)
+	assert.True(t, elapsed < 2*time.Second, "returned after %s", elapsed)
+
+	// The watchers are closed, and anything added afterwards is ignored.
+	for _ = range watcher {
+	}
+	q.Add(&queueTestTransferable{oid: oidC, size: 1})
+
+	errs := q.Errors()
+	if assert.Len(t, errs, 2) {
+		for _, err := range errs {
+			assert.Contains(t, err.Error(), "Timed out after 100ms transferring")
+			assert.NotContains(t, err.Error(), "lfs.transfer.timeout")
+		}
+	}
+}
+
+func TestTransferQueueWaitWithTimeoutFinishesInTime(t *testing.T) {
+	q := NewUploadQueue(2, 2, false)
+	q.RegisterAdapter("completing", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &completingAdapter{dir: dir}
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			objs = append(objs, &api.ObjectResource{
+				Oid:     o.Oid,
+				Size:    o.Size,
+				Actions: map[string]*api.LinkRelation{"upload": {Href: "https://example.com/" + o.Oid}},
+			})
+		}
+		return objs, "completing", nil
+	}
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+
+	assert.Nil(t, q.WaitWithTimeout(time.Minute))
+	assert.Empty(t, q.Errors())
+}
+
+// gatedAdapter is a transfer adapter which signals "started" when each transfer
+// is added, and finishes it once "release" is signalled.
+type gatedAdapter struct {
+	dir        transfer.Direction
+	started    chan string
+	release    chan struct{}
+	completion chan transfer.TransferResult
+	wg         sync.WaitGroup
+}
+
+func (a *gatedAdapter) Name() string                  { return "gated" }
+func (a *gatedAdapter) Direction() transfer.Direction { return a.dir }
+func (a *gatedAdapter) ClearTempStorage() error       { return nil }
+func (a *gatedAdapter) VerifiesDownloads() bool       { return true }
+func (a *gatedAdapter) Begin(maxConcurrency int, cb transfer.TransferProgressCallback, completion chan transfer.TransferResult) error {
+	a.completion = completion
+	return nil
+}
+func (a *gatedAdapter) Add(t *transfer.Transfer) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		<-a.release
+		a.completion <- transfer.TransferResult{Transfer: t}
+	}()
+	a.started <- t.Object.Oid
+}
+func (a *gatedAdapter) End() {
+	a.wg.Wait()
+	close(a.completion)
+}
+
+func TestTransferQueueCountsInFlightTransfers(t *testing.T) {
+	adapter := &gatedAdapter{
+		started: make(chan string, 2),
+		release: make(chan struct{}),
+	}
+
+	q := NewDownloadQueue(2, 2, false)
+	q.RegisterAdapter("gated", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		adapter.dir = dir
+		return adapter
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			objs = append(objs, downloadable(o.Oid))
+		}
+		return objs, "gated", nil
+	}
+	watcher := q.Watch()
+
+	assert.Equal(t, 0, q.InFlight())
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.batcher.Flush()
+	<-adapter.started
+	<-adapter.started
+	assert.Equal(t, 2, q.InFlight())
+
+	adapter.release <- struct{}{}
+	<-watcher
+	assert.Equal(t, 1, q.InFlight())
+
+	adapter.release <- struct{}{}
+	q.Wait()
+	assert.Equal(t, 0, q.InFlight())
+	assert.Empty(t, q.Errors())
+}
+
+func TestTransferQueueTimesAttemptsFromTheAdapter(t *testing.T) {
+	adapter := &gatedAdapter{
+		started: make(chan string, 1),
+		release: make(chan struct{}),
+	}
+
+	c := newFakeClock()
+	q := NewDownloadQueue(1, 1, false)
+	q.clock = c
+	q.RegisterAdapter("gated", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		adapter.dir = dir
+		return adapter
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{downloadable(oidA)}, "gated", nil
+	}
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	added := c.Now()
+	c.Advance(time.Minute)
+
+	q.rmu.Lock()
+	_, attempted := q.attempts[oidA]
+	q.rmu.Unlock()
+	assert.False(t, attempted, "expected no attempt before the adapter has the transfer")
+
+	q.batcher.Flush()
+	<-adapter.started
+
+	q.rmu.Lock()
+	started := q.attempts[oidA]
+	q.rmu.Unlock()
+	assert.Equal(t, added.Add(time.Minute), started)
+
+	adapter.release <- struct{}{}
+	q.Wait()
+	assert.Empty(t, q.Errors())
+}
+
+func TestTransferQueueAddBlocksAtMaxPending(t *testing.T) {
+	adapter := &gatedAdapter{
+		started: make(chan string, 3),
+		release: make(chan struct{}),
+	}
+
+	q := NewDownloadQueue(3, 3, false)
+	q.maxPending = 2
+	q.RegisterAdapter("gated", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		adapter.dir = dir
+		return adapter
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			objs = append(objs, downloadable(o.Oid))
+		}
+		return objs, "gated", nil
+	}
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	<-adapter.started
+	<-adapter.started
+
+	added := make(chan struct{})
+	go func() {
+		q.Add(&queueTestTransferable{oid: oidC, size: 1})
+		close(added)
+	}()
+
+	select {
+	case <-added:
+		t.Fatal("Add should block while 2 objects are unfinished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	adapter.release <- struct{}{}
+	<-added
+
+	adapter.release <- struct{}{}
+	adapter.release <- struct{}{}
+	q.Wait()
+	assert.Empty(t, q.Errors())
+}
+
+func TestTransferQueueAddFlushesBatchesAtMaxPending(t *testing.T) {
+	// Without a flush interval, partial batches are only sent once they
+	// are flushed, which Add has to do before blocking.
+	cfg := config.Config
+	config.Config = config.NewFrom(config.Values{
+		Git: map[string]string{"lfs.batchflushinterval": "0"},
+	})
+	q := NewDownloadQueue(3, 3, false)
+	config.Config = cfg
+
+	q.maxPending = 2
+	q.RegisterAdapter("completing", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &completingAdapter{dir: dir}
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			objs = append(objs, downloadable(o.Oid))
+		}
+		return objs, "completing", nil
+	}
+
+	added := make(chan struct{})
+	go func() {
+		for _, oid := range []string{oidA, oidB, oidC} {
+			q.Add(&queueTestTransferable{oid: oid, size: 1})
+		}
+		close(added)
+	}()
+
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Add should flush the pending batch rather than block")
+	}
+	q.Wait()
+	assert.Empty(t, q.Errors())
+}
+
+func TestTransferQueueTimeoutReleasesBlockedAdd(t *testing.T) {
+	q := NewDownloadQueue(2, 2, false)
+	q.maxPending = 1
+	q.RegisterAdapter("hanging", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &hangingAdapter{dir: dir}
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{downloadable(oidA)}, "hanging", nil
+	}
+	q.startTimeout(100 * time.Millisecond)
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+
+	added := make(chan struct{})
+	go func() {
+		q.Add(&queueTestTransferable{oid: oidB, size: 1})
+		close(added)
+	}()
+
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Add should return once the queue times out")
+	}
+	q.Wait()
+
+	// Both are reported as timed out, including the one which was never
+	// transferred.
+	errs := q.Errors()
+	if assert.Len(t, errs, 2) {
+		for _, err := range errs {
+			assert.Contains(t, err.Error(), "Timed out after 100ms transferring")
+		}
+	}
+}
+
+// completingAdapter is a transfer adapter which finishes each transfer as soon
+// as it is added, failing those for the OIDs in "fail".
+type completingAdapter struct {
+	dir        transfer.Direction
+	fail       map[string]bool
+	completion chan transfer.TransferResult
+}
+
+func (a *completingAdapter) Name() string                  { return "completing" }
+func (a *completingAdapter) Direction() transfer.Direction { return a.dir }
+func (a *completingAdapter) End()                          { close(a.completion) }
+func (a *completingAdapter) ClearTempStorage() error       { return nil }
+func (a *completingAdapter) VerifiesDownloads() bool       { return true }
+func (a *completingAdapter) Begin(maxConcurrency int, cb transfer.TransferProgressCallback, completion chan transfer.TransferResult) error {
+	a.completion = completion
+	return nil
+}
+func (a *completingAdapter) Add(t *transfer.Transfer) {
+	var err error
+	if a.fail[t.Object.Oid] {
+		err = errors.New("failed")
+	}
+	a.completion <- transfer.TransferResult{Transfer: t, Error: err}
+}
+
+type failingAdapter struct {
+	dir    transfer.Direction
+	begins int32
+}
+
+func (a *failingAdapter) Name() string                  { return "failing" }
+func (a *failingAdapter) Direction() transfer.Direction { return a.dir }
+func (a *failingAdapter) Add(t *transfer.Transfer)      {}
+func (a *failingAdapter) End()                          {}
+func (a *failingAdapter) ClearTempStorage() error       { return nil }
+func (a *failingAdapter) Begin(maxConcurrency int, cb transfer.TransferProgressCallback, completion chan transfer.TransferResult) error {
+	atomic.AddInt32(&a.begins, 1)
+	return errors.New("bad adapter configuration")
+}
+
+func TestTransferQueueReportsAdapterFailureOnce(t *testing.T) {
+	adapter := &failingAdapter{dir: transfer.Download}
+	q := NewDownloadQueue(3, 3, false)
+	q.manifest.RegisterNewTransferAdapterFunc("failing", transfer.Download, func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return adapter
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		var objs []*api.ObjectResource
+		for _, o := range objects {
+			objs = append(objs, downloadable(o.Oid))
+		}
+		return objs, "failing", nil
+	}
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.Add(&queueTestTransferable{oid: oidC, size: 1})
+	q.Wait()
+
+	errs := q.Errors()
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "Unable to start the failing transfer adapter")
+	assert.Contains(t, errs[0].Error(), "bad adapter configuration")
+	assert.EqualValues(t, 1, atomic.LoadInt32(&adapter.begins))
+}
+
+// writingAdapter downloads objects by writing the next of "contents" to their
+// paths, repeating the last one once they run out.
+type writingAdapter struct {
+	dir        transfer.Direction
+	contents   []string
+	attempts   int32
+	completion chan transfer.TransferResult
+}
+
+func (a *writingAdapter) Name() string                  { return "writing" }
+func (a *writingAdapter) Direction() transfer.Direction { return a.dir }
+func (a *writingAdapter) End()                          { close(a.completion) }
+func (a *writingAdapter) ClearTempStorage() error       { return nil }
+func (a *writingAdapter) Begin(maxConcurrency int, cb transfer.TransferProgressCallback, completion chan transfer.TransferResult) error {
+	a.completion = completion
+	return nil
+}
+func (a *writingAdapter) Add(t *transfer.Transfer) {
+	n := int(atomic.AddInt32(&a.attempts, 1))
+	if n > len(a.contents) {
+		n = len(a.contents)
+	}
+	err := ioutil.WriteFile(t.Path, []byte(a.contents[n-1]), 0644)
+	a.completion <- transfer.TransferResult{Transfer: t, Error: err}
+}
+
+// runWritingQueue downloads an object with the content "hello" to a
+// temporary file using "adapter", and returns the file, which the caller
+// must remove, and the errors the queue collected.
+func runWritingQueue(t *testing.T, adapter *writingAdapter) (string, []error) {
+	f, err := ioutil.TempFile("", "verify-download")
+	require.Nil(t, err)
+	f.Close()
+	os.Remove(f.Name())
+
+	h := sha256.Sum256([]byte("hello"))
+	oid := hex.EncodeToString(h[:])
+
+	q := NewDownloadQueue(1, 5, false)
+	q.manifest.RegisterNewTransferAdapterFunc("writing", transfer.Download, func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return adapter
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{downloadable(oid)}, "writing", nil
+	}
+
+	q.Add(&queueTestTransferable{oid: oid, size: 5, path: f.Name()})
+	q.Wait()
+
+	return f.Name(), q.Errors()
+}
+
+func TestTransferQueueRetriesCorruptDownloads(t *testing.T) {
+	adapter := &writingAdapter{dir: transfer.Download, contents: []string{"jello", "hello"}}
+	path, errs := runWritingQueue(t, adapter)
+	defer os.Remove(path)
+
+	assert.Empty(t, errs)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&adapter.attempts))
+
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestTransferQueueRemovesCorruptDownloads(t *testing.T) {
+	adapter := &writingAdapter{dir: transfer.Download, contents: []string{"jello"}}
+	path, errs := runWritingQueue(t, adapter)
+	defer os.Remove(path)
+
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "Error verifying download")
+	assert.True(t, atomic.LoadInt32(&adapter.attempts) > 1)
+
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "corrupt download not removed: %v", err)
+}
+
+// runVerifiedUploadQueue uploads a file with the content "jello" as the
+// object of "hello", with lfs.transfer.verifyupload set to "verify".
+func runVerifiedUploadQueue(t *testing.T, verify bool) *TransferQueue {
+	f, err := ioutil.TempFile("", "verify-upload")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("jello")
+	f.Close()
+	require.Nil(t, err)
+
+	h := sha256.Sum256([]byte("hello"))
+	oid := hex.EncodeToString(h[:])
+
+	q := NewUploadQueue(1, 5, false)
+	q.verifyUploads = verify
+	q.RegisterAdapter("completing", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &reportingAdapter{completingAdapter: &completingAdapter{dir: dir}}
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{{
+			Oid:     oid,
+			Size:    5,
+			Actions: map[string]*api.LinkRelation{"upload": {Href: "https://example.com/" + oid}},
+		}}, "completing", nil
+	}
+
+	q.Add(&queueTestTransferable{oid: oid, size: 5, path: f.Name()})
+	q.Wait()
+	return q
+}
+
+func TestTransferQueueVerifiesUploads(t *testing.T) {
+	q := runVerifiedUploadQueue(t, true)
+
+	errs := q.Errors()
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "before uploading it")
+	assert.False(t, errors.IsRetriableError(errs[0]))
+
+	m := q.MetricsSnapshot()
+	assert.Equal(t, int64(1), m.Failed)
+	assert.Equal(t, int64(0), m.Retried)
+	assert.Equal(t, int64(0), m.Bytes, "corrupt object was uploaded")
+}
+
+func TestTransferQueueUploadsWithoutVerifying(t *testing.T) {
+	q := runVerifiedUploadQueue(t, false)
+
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, int64(1), q.MetricsSnapshot().Completed)
+}
+
+func TestTransferQueueOffersRegisteredAdapters(t *testing.T) {
+	q := NewUploadQueue(2, 2, false)
+	q.RegisterAdapter("completing", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &completingAdapter{dir: dir}
+	})
+
+	var offered []string
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		offered = adapters
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			objs = append(objs, &api.ObjectResource{
+				Oid:     o.Oid,
+				Size:    o.Size,
+				Actions: map[string]*api.LinkRelation{"upload": {Href: "https://example.com/" + o.Oid}},
+			})
+		}
+		return objs, "completing", nil
+	}
+	watcher := q.Watch()
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.Wait()
+
+	var done []string
+	for oid := range watcher {
+		done = append(done, oid)
+	}
+	sort.Strings(done)
+
+	assert.Contains(t, offered, "completing")
+	assert.Equal(t, []string{oidA, oidB}, done)
+	assert.Empty(t, q.Errors())
+}
+
+// runJournaledQueue uploads the given OIDs through a completingAdapter which
+// fails those in "fail", using the journal at "path". It returns the OIDs in
+// each batch request, and the OIDs reported as already present.
+func runJournaledQueue(t *testing.T, path string, fail map[string]bool, oids ...string) (batched, present []string) {
+	j, err := OpenTransferJournal(path)
+	require.Nil(t, err)
+
+	q := NewUploadQueue(len(oids), int64(len(oids)), false)
+	q.manifest.RegisterNewTransferAdapterFunc("completing", transfer.Upload, func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &completingAdapter{dir: dir, fail: fail}
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			batched = append(batched, o.Oid)
+			objs = append(objs, &api.ObjectResource{
+				Oid:     o.Oid,
+				Size:    o.Size,
+				Actions: map[string]*api.LinkRelation{"upload": {Href: "https://example.com/" + o.Oid}},
+			})
+		}
+		return objs, "completing", nil
+	}
+	q.SetJournal(j)
+	presentc := q.WatchAlreadyPresent()
+
+	for _, oid := range oids {
+		q.Add(&queueTestTransferable{oid: oid, size: 1})
+	}
+	q.Wait()
+
+	for oid := range presentc {
+		present = append(present, oid)
+	}
+	sort.Strings(batched)
+	sort.Strings(present)
+	return batched, present
+}
+
+func TestTransferQueueResumesFromJournal(t *testing.T) {
+	path, cleanup := tempJournalPath(t)
+	defer cleanup()
+	a, b, c := journalOid(1), journalOid(2), journalOid(3)
+
+	batched, present := runJournaledQueue(t, path, map[string]bool{c: true}, a, b, c)
+	assert.Equal(t, []string{a, b, c}, batched)
+	assert.Empty(t, present)
+
+	// The failed run leaves the journal behind, without the failed object.
+	by, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(by)), "\n")
+	sort.Strings(lines)
+	assert.Equal(t, []string{a, b}, lines)
+
+	batched, present = runJournaledQueue(t, path, nil, a, b, c)
+	assert.Equal(t, []string{c}, batched)
+	assert.Equal(t, []string{a, b}, present)
+
+	// The successful run removes it.
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTransferQueueReset(t *testing.T) {
+	q := NewDownloadQueue(2, 2, false)
+	q.manifest.RegisterNewTransferAdapterFunc("completing", transfer.Download, func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &completingAdapter{dir: dir, fail: map[string]bool{oidB: true}}
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		var objs []*api.ObjectResource
+		for _, o := range objects {
+			objs = append(objs, downloadable(o.Oid))
+		}
+		return objs, "completing", nil
+	}
+
+	assert.NotNil(t, q.Reset(1, 1), "reset before Wait")
+
+	watcher := q.Watch()
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.Wait()
+
+	assert.Equal(t, []string{oidA}, drain(watcher))
+	require.Len(t, q.Errors(), 1)
+
+	require.Nil(t, q.Reset(2, 2))
+	assert.Empty(t, q.Errors())
+
+	watcher = q.Watch()
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidC, size: 1})
+	q.Wait()
+
+	done := drain(watcher)
+	sort.Strings(done)
+	assert.Equal(t, []string{oidA, oidC}, done)
+	assert.Empty(t, q.Errors())
+}
+
+func TestTransferQueueResetAfterTimeout(t *testing.T) {
+	q := NewDownloadQueue(1, 1, false)
+	q.RegisterAdapter("hanging", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &hangingAdapter{dir: dir}
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{downloadable(oidA)}, "hanging", nil
+	}
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	assert.NotNil(t, q.WaitWithTimeout(50*time.Millisecond))
+
+	err := q.Reset(1, 1)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "timed out")
+	}
+}
+
+// drain reads from "c" until it is closed, returning what it read.
+func drain(c chan string) []string {
+	var read []string
+	for s := range c {
+		read = append(read, s)
+	}
+	return read
+}
+
+func TestTransferQueueLimitsTransfersPerHost(t *testing.T) {
+	adapter := &gatedAdapter{
+		started: make(chan string, 3),
+		release: make(chan struct{}),
+	}
+
+	q := NewDownloadQueue(3, 3, false)
+	q.hosts = newHostLimiter(1)
+	q.RegisterAdapter("gated", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		adapter.dir = dir
+		return adapter
+	})
+	hosts := map[string]string{oidA: "a.example.com", oidB: "A.example.com", oidC: "c.example.com"}
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			obj := downloadable(o.Oid)
+			obj.Actions["download"].Href = "https://" + hosts[o.Oid] + "/" + o.Oid
+			objs = append(objs, obj)
+		}
+		return objs, "gated", nil
+	}
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.Add(&queueTestTransferable{oid: oidC, size: 1})
+	q.batcher.Flush()
+
+	started := []string{<-adapter.started, <-adapter.started}
+	sort.Strings(started)
+	assert.Contains(t, started, oidC)
+
+	select {
+	case oid := <-adapter.started:
+		t.Fatalf("expected %s to wait for its host, but it started", oid)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	adapter.release <- struct{}{}
+	adapter.release <- struct{}{}
+	started = append(started, <-adapter.started)
+	sort.Strings(started)
+	assert.Equal(t, []string{oidA, oidB, oidC}, started)
+
+	adapter.release <- struct{}{}
+	q.Wait()
+	assert.Empty(t, q.Errors())
+}
+
+func TestTransferQueueReleasesHostWhenRetryingFailedRefresh(t *testing.T) {
+	var refreshes int32
+
+	q := NewDownloadQueue(2, 2, false)
+	q.hosts = newHostLimiter(1)
+	q.RegisterAdapter("completing", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &completingAdapter{dir: dir}
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			objs = append(objs, expiring(o.Oid))
+		}
+		return objs, "completing", nil
+	}
+	q.refreshFunc = func(cfg *config.Configuration, obj *api.ObjectResource, operation string, adapters []string) (*api.ObjectResource, error) {
+		if atomic.AddInt32(&refreshes, 1) <= 2 {
+			return nil, networkErr()
+		}
+
+		fresh := downloadable(obj.Oid)
+		fresh.Actions["download"].ExpiresAt = time.Now().Add(time.Hour)
+		return fresh, nil
+	}
+	watcher := q.Watch()
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+
+	waited := make(chan struct{})
+	go func() {
+		q.Wait()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the retried objects to reacquire their host")
+	}
+
+	var done []string
+	for oid := range watcher {
+		done = append(done, oid)
+	}
+	sort.Strings(done)
+
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, []string{oidA, oidB}, done)
+}
+
+func TestTransferQueueFailsRetriesTooCloseToDeadline(t *testing.T) {
+	var calls int32
+	c := newFakeClock()
+	q := NewDownloadQueue(1, 1, true)
+	q.clock = c
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		atomic.AddInt32(&calls, 1)
+
+		// Take 400ms once WaitWithTimeout has set its deadline.
+		c.BlockUntilWaiting(1)
+		c.Advance(400 * time.Millisecond)
+		return nil, "", networkErr()
+	}
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	assert.Nil(t, q.WaitWithTimeout(700*time.Millisecond))
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	if assert.Len(t, q.Errors(), 1) {
+		assert.Contains(t, q.Errors()[0].Error(), "deadline too close for retry")
+	}
+}
+
+// prebatchingQueue returns a dry run download queue which holds the objects
+// added to it until Wait is called, and whose batch API requests, whose OIDs
+// it records in "requests", fail with each of "errs" in turn.
+func prebatchingQueue(requests *[][]string, errs ...error) *TransferQueue {
+	var mu sync.Mutex
+
+	q := NewDownloadQueue(3, 3, true)
+	q.order = "size-asc"
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		oids := make([]string, 0, len(objects))
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			oids = append(oids, o.Oid)
+			objs = append(objs, downloadable(o.Oid))
+		}
+		sort.Strings(oids)
+		*requests = append(*requests, oids)
+
+		if len(*requests) <= len(errs) {
+			return nil, "", errs[len(*requests)-1]
+		}
+		return objs, "basic", nil
+	}
+	return q
+}
+
+func TestTransferQueuePreBatch(t *testing.T) {
+	var requests [][]string
+	q := prebatchingQueue(&requests)
+	watcher := q.Watch()
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	assert.Nil(t, q.PreBatch())
+	assert.Equal(t, [][]string{{oidA, oidB}}, requests)
+
+	// Only the object added since is requested once the queue runs.
+	q.Add(&queueTestTransferable{oid: oidC, size: 1})
+	q.Wait()
+
+	var done []string
+	for oid := range watcher {
+		done = append(done, oid)
+	}
+	sort.Strings(done)
+
+	assert.Equal(t, []string{oidA, oidB, oidC}, done)
+	assert.Equal(t, [][]string{{oidA, oidB}, {oidC}}, requests)
+	assert.Empty(t, q.Errors())
+}
+
+func TestTransferQueuePreBatchFailureIsRequestedAgain(t *testing.T) {
+	var requests [][]string
+	q := prebatchingQueue(&requests, errors.New("server unavailable"))
+	watcher := q.Watch()
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	assert.NotNil(t, q.PreBatch())
+	q.Wait()
+
+	var done []string
+	for oid := range watcher {
+		done = append(done, oid)
+	}
+
+	assert.Equal(t, []string{oidA}, done)
+	assert.Equal(t, [][]string{{oidA}, {oidA}}, requests)
+	assert.Empty(t, q.Errors())
+}
+
+func TestTransferQueueAdapterConcurrencyForHTTP2Hosts(t *testing.T) {
+	q := NewDownloadQueue(0, 0, true)
+	q.Wait()
+	q.transferWorkers = 8
+	q.usedHTTP2 = func(host string) bool {
+		return host == "example.com"
+	}
+
+	h2 := &queueTestTransferable{oid: oidA, size: 1, obj: downloadable(oidA)}
+	assert.Equal(t, config.Config.TransferHTTP2Concurrency(), q.adapterConcurrency(h2))
+
+	h1 := &queueTestTransferable{oid: oidB, size: 1, obj: downloadable(oidB)}
+	h1.obj.Actions["download"].Href = "https://h1.example.com/" + oidB
+	assert.Equal(t, 8, q.adapterConcurrency(h1))
+}
+
+func TestTransferQueueRecordsEveryFailureBeforeWaitReturns(t *testing.T) {
+	const objects = 50
+
+	fail := make(map[string]bool)
+	for i := 0; i < objects; i++ {
+		fail[fmt.Sprintf("%064d", i)] = true
+	}
+
+	q := NewUploadQueue(objects, objects, false)
+	q.maxRetries = 0
+	q.maxFailures = 0
+	q.RegisterAdapter("completing", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &completingAdapter{dir: dir, fail: fail}
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			objs = append(objs, &api.ObjectResource{
+				Oid:     o.Oid,
+				Size:    o.Size,
+				Actions: map[string]*api.LinkRelation{"upload": {Href: "https://example.com/" + o.Oid}},
+			})
+		}
+		return objs, "completing", nil
+	}
+
+	for oid := range fail {
+		q.Add(&queueTestTransferable{oid: oid, size: 1})
+	}
+	q.Wait()
+
+	assert.Len(t, q.Errors(), objects)
+}
+
+func TestTransferQueueRecordsBatchErrorBeforeWaitReturns(t *testing.T) {
+	// The last object to fail the batch request finishes the queue, so
+	// its error must already have been recorded.
+	for i := 0; i < 20; i++ {
+		_, errs := runStubbedQueue(func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+			return nil, "", statusErr(404)
+		}, oidA, oidB, oidC)
+
+		assert.Len(t, errs, 1)
+	}
+}
+
+func TestTransferQueueWatchResults(t *testing.T) {
+	q := NewDownloadQueue(3, 3, true)
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{
+			downloadable(oidA),
+			{Oid: oidB, Size: 1, Error: &api.ObjectError{Code: 404, Message: "not found"}},
+		}, "basic", nil
+	}
+	watcher := q.Watch()
+	results := q.WatchResults()
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.Add(&queueTestTransferable{oid: "invalid", size: 1})
+	q.Wait()
+
+	var done []string
+	for oid := range watcher {
+		done = append(done, oid)
+	}
+	assert.Equal(t, []string{oidA}, done)
+
+	got := make(map[string]bool)
+	for res := range results {
+		got[res.Oid] = res.Success
+	}
+	assert.Equal(t, map[string]bool{oidA: true, oidB: false, "invalid": false}, got)
+}
+
+func TestTransferQueueWatchResultsAfterTimeout(t *testing.T) {
+	q := NewDownloadQueue(1, 1, false)
+	q.manifest.RegisterNewTransferAdapterFunc("hanging", transfer.Download, func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		return &hangingAdapter{dir: dir}
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{downloadable(oidA)}, "hanging", nil
+	}
+	q.startTimeout(100 * time.Millisecond)
+	results := q.WatchResults()
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Wait()
+
+	var got []WatchResult
+	for res := range results {
+		got = append(got, res)
+	}
+	assert.Equal(t, []WatchResult{{Oid: oidA, Success: false}}, got)
+}
+
+func TestTransferQueueUnwatchResults(t *testing.T) {
+	q := NewDownloadQueue(1, 1, true)
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		return []*api.ObjectResource{downloadable(oidA)}, "basic", nil
+	}
+	results := q.WatchResults()
+	q.UnwatchResults(results)
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Wait()
+
+	_, ok := <-results
+	assert.False(t, ok)
+}
+
+func TestTransferQueueCancelsQueuedObject(t *testing.T) {
+	var mu sync.Mutex
+	var batched []string
+	skipped := make(map[string]string)
+
+	q := NewDownloadQueue(2, 2, true)
+	// Hold the objects until Wait, so that A is still queued when it's
+	// cancelled.
+	q.order = "size-asc"
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			mu.Lock()
+			batched = append(batched, o.Oid)
+			mu.Unlock()
+			objs = append(objs, downloadable(o.Oid))
+		}
+		return objs, "basic", nil
+	}
+	q.SetSkipCallback(func(oid string, size int64, reason string) {
+		mu.Lock()
+		skipped[oid] = reason
+		mu.Unlock()
+	})
+	watcher := q.Watch()
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	assert.True(t, q.CancelObject(oidA))
+	assert.False(t, q.CancelObject(oidA))
+	assert.False(t, q.CancelObject(strings.Repeat("c", 64)))
+	q.Wait()
+
+	var done []string
+	for oid := range watcher {
+		done = append(done, oid)
+	}
+
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, []string{oidB}, done)
+	assert.Equal(t, []string{oidB}, batched)
+	assert.Equal(t, SkipCancelled, skipped[oidA])
+}
+
+// cancellableAdapter is a gatedAdapter whose transfers can also be cancelled,
+// which finishes them with a cancelled error straight away. Cancel returns once
+// the transfer has stopped, so that it can't take a release meant for another.
+type cancellableAdapter struct {
+	gatedAdapter
+	mu        sync.Mutex
+	cancelled map[string]chan struct{}
+	stopped   map[string]chan struct{}
+}
+
+func (a *cancellableAdapter) Name() string { return "cancellable" }
+func (a *cancellableAdapter) Add(t *transfer.Transfer) {
+	cancelled := make(chan struct{})
+	stopped := make(chan struct{})
+	a.mu.Lock()
+	if a.stopped == nil {
+		a.stopped = make(map[string]chan struct{})
+	}
+	a.cancelled[t.Object.Oid] = cancelled
+	a.stopped[t.Object.Oid] = stopped
+	a.mu.Unlock()
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		defer close(stopped)
+		select {
+		case <-a.release:
+			a.completion <- transfer.TransferResult{Transfer: t}
+		case <-cancelled:
+			a.completion <- transfer.TransferResult{Transfer: t, Error: errors.NewCancelledError(errors.New("cancelled"))}
+		}
+	}()
+	a.started <- t.Object.Oid
+}
+func (a *cancellableAdapter) Cancel(oid string) bool {
+	a.mu.Lock()
+	c, ok := a.cancelled[oid]
+	stopped := a.stopped[oid]
+	if ok {
+		close(c)
+		delete(a.cancelled, oid)
+	}
+	a.mu.Unlock()
+
+	if ok {
+		<-stopped
+	}
+	return ok
+}
+
+func TestTransferQueueCancelsObjectInFlight(t *testing.T) {
+	adapter := &cancellableAdapter{
+		gatedAdapter: gatedAdapter{
+			started: make(chan string, 2),
+			release: make(chan struct{}),
+		},
+		cancelled: make(map[string]chan struct{}),
+	}
+
+	q := NewDownloadQueue(2, 2, false)
+	q.RegisterAdapter("cancellable", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		adapter.dir = dir
+		return adapter
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			objs = append(objs, downloadable(o.Oid))
+		}
+		return objs, "cancellable", nil
+	}
+	watcher := q.Watch()
+	results := q.WatchResults()
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.batcher.Flush()
+	<-adapter.started
+	<-adapter.started
+
+	assert.True(t, q.CancelObject(oidA))
+	adapter.release <- struct{}{}
+	q.Wait()
+
+	var done []string
+	for oid := range watcher {
+		done = append(done, oid)
+	}
+	success := make(map[string]bool)
+	for r := range results {
+		success[r.Oid] = r.Success
+	}
+
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, []string{oidB}, done)
+	assert.Equal(t, map[string]bool{oidA: false, oidB: true}, success)
+	assert.Equal(t, 0, q.InFlight())
+}
+
+func TestTransferQueueIgnoresResultOfCancelledTransfer(t *testing.T) {
+	// gatedAdapter can't cancel transfers, so A still completes, after
+	// CancelObject has already finished it.
+	adapter := &gatedAdapter{
+		started: make(chan string, 2),
+		release: make(chan struct{}),
+	}
+
+	q := NewDownloadQueue(2, 2, false)
+	q.RegisterAdapter("gated", func(name string, dir transfer.Direction) transfer.TransferAdapter {
+		adapter.dir = dir
+		return adapter
+	})
+	q.batchFunc = func(cfg *config.Configuration, objects []*api.ObjectResource, operation string, adapters []string) ([]*api.ObjectResource, string, error) {
+		objs := make([]*api.ObjectResource, 0, len(objects))
+		for _, o := range objects {
+			objs = append(objs, downloadable(o.Oid))
+		}
+		return objs, "gated", nil
+	}
+	watcher := q.Watch()
+
+	q.Add(&queueTestTransferable{oid: oidA, size: 1})
+	q.Add(&queueTestTransferable{oid: oidB, size: 1})
+	q.batcher.Flush()
+	<-adapter.started
+	<-adapter.started
+
+	assert.True(t, q.CancelObject(oidA))
+	adapter.release <- struct{}{}
+	adapter.release <- struct{}{}
+	q.Wait()
+
+	var done []string
+	for oid := range watcher {
+		done = append(done, oid)
+	}
+
+	assert.Empty(t, q.Errors())
+	assert.Equal(t, []string{oidB}, done)
+	assert.Equal(t, 0, q.InFlight())
+}
@@ -0,0 +1,100 @@
+package lfs
+
+// WatchResult is written to the channels returned by WatchResults, for each
+// object which the queue has finished trying to transfer.
+type WatchResult struct {
+	Oid string
+	// Success is whether the object was transferred. If it is false, the
+	// error which made it fail is among the queue's Errors.
+	Success bool
+}
+
+// watcher forwards OIDs from a TransferQueue to a channel returned by Watch,
+// WatchSkipped or WatchAlreadyPresent, or results to a channel returned by
+// WatchResults. It buffers as many as necessary, so that a slow or abandoned
+// reader never blocks the queue.
+type watcher struct {
+	c    chan string      // set for watchers of OIDs
+	rc   chan WatchResult // set for watchers of results
+	in   chan WatchResult
+	done chan struct{}
+}
+
+func newWatcher() *watcher {
+	w := &watcher{
+		c:    make(chan string, batchSize),
+		in:   make(chan WatchResult),
+		done: make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func newResultWatcher() *watcher {
+	w := &watcher{
+		rc:   make(chan WatchResult, batchSize),
+		in:   make(chan WatchResult),
+		done: make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// send queues "res" to be written to the watcher's channel, or just its OID
+// for watchers of OIDs. It does not wait for the reader, and does nothing once
+// the watcher has been stopped.
+func (w *watcher) send(res WatchResult) {
+	select {
+	case w.in <- res:
+	case <-w.done:
+	}
+}
+
+// close closes the watcher's channel once everything queued by send has been
+// read. send must not be called afterwards.
+func (w *watcher) close() {
+	close(w.in)
+}
+
+// stop closes the watcher's channel straight away, discarding anything which
+// has not been read yet.
+func (w *watcher) stop() {
+	close(w.done)
+}
+
+func (w *watcher) run() {
+	if w.c != nil {
+		defer close(w.c)
+	} else {
+		defer close(w.rc)
+	}
+
+	in := w.in
+	var pending []WatchResult
+	for in != nil || len(pending) > 0 {
+		// Only one of out and rout is set, and neither when there is
+		// nothing to write.
+		var out chan string
+		var rout chan WatchResult
+		var next WatchResult
+		if len(pending) > 0 {
+			out, rout = w.c, w.rc
+			next = pending[0]
+		}
+
+		select {
+		case res, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			pending = append(pending, res)
+		case out <- next.Oid:
+			pending = pending[1:]
+		case rout <- next:
+			pending = pending[1:]
+		case <-w.done:
+			return
+		}
+	}
+}
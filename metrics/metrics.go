@@ -0,0 +1,244 @@
+// Package metrics records phase timings and counters for a single git-lfs
+// command, and writes them as a JSON document when the command exits. Nothing
+// is recorded unless Start has been called, so the hooks elsewhere in git-lfs
+// cost no more than an uncontended lock and a nil check in normal use.
+// NOTE: Subject to change, do not rely on this package from outside git-lfs source
+package metrics
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DocumentVersion is the version of the JSON document written by Finish. It
+// is incremented whenever a field is removed or changes meaning.
+const DocumentVersion = 1
+
+// Phase names used by the git-lfs instrumentation.
+const (
+	// Scan is time spent walking Git history or trees for LFS pointers.
+	Scan = "scan"
+	// Batch is time spent waiting for individual batch API calls.
+	Batch = "batch"
+	// Transfer is time between a transfer adapter's Begin() and End().
+	Transfer = "transfer"
+	// Checkout is time spent writing LFS files to the working copy.
+	Checkout = "checkout"
+)
+
+// Counter names used by the git-lfs instrumentation.
+const (
+	// Objects counts objects which were transferred successfully.
+	Objects = "objects"
+	// Bytes counts the size of objects which were transferred successfully.
+	Bytes = "bytes"
+	// Retries counts transfers which were queued again after an error.
+	Retries = "retries"
+)
+
+// Document is the JSON document written to the metrics file.
+type Document struct {
+	Version       int                    `json:"version"`
+	Command       string                 `json:"command"`
+	GitLFSVersion string                 `json:"git_lfs_version"`
+	StartedAt     time.Time              `json:"started_at"`
+	TotalMs       float64                `json:"total_ms"`
+	Phases        map[string]*PhaseStats `json:"phases"`
+	Counters      map[string]int64       `json:"counters"`
+	Settings      map[string]interface{} `json:"settings"`
+}
+
+// PhaseStats summarises the durations recorded for a single phase.
+type PhaseStats struct {
+	Count   int     `json:"count"`
+	TotalMs float64 `json:"total_ms"`
+	P50Ms   float64 `json:"p50_ms"`
+	P90Ms   float64 `json:"p90_ms"`
+	P99Ms   float64 `json:"p99_ms"`
+	MaxMs   float64 `json:"max_ms"`
+}
+
+type recorder struct {
+	path          string
+	command       string
+	gitLFSVersion string
+	start         time.Time
+
+	mu        sync.Mutex
+	durations map[string][]time.Duration
+	counters  map[string]int64
+	settings  map[string]interface{}
+}
+
+var (
+	// current is the recorder for this process, or nil if metrics are
+	// disabled. It is set by Start, and cleared by Finish, which may be
+	// called from any goroutine that exits the process.
+	current   *recorder
+	currentMu sync.Mutex
+)
+
+// recording returns the current recorder, or nil if metrics are disabled.
+func recording() *recorder {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+
+	return current
+}
+
+// Start begins recording metrics for "command", to be written to the file at
+// "path" by Finish. It does nothing if "path" is empty.
+func Start(path, command, gitLFSVersion string) {
+	if len(path) == 0 {
+		return
+	}
+
+	currentMu.Lock()
+	defer currentMu.Unlock()
+
+	current = &recorder{
+		path:          path,
+		command:       command,
+		gitLFSVersion: gitLFSVersion,
+		start:         time.Now(),
+		durations:     make(map[string][]time.Duration),
+		counters:      make(map[string]int64),
+		settings:      make(map[string]interface{}),
+	}
+}
+
+// Enabled returns whether metrics are being recorded. Callers only need to
+// check this when gathering a value is expensive in itself.
+func Enabled() bool {
+	return recording() != nil
+}
+
+// Since records the time elapsed since "start" against the given phase.
+func Since(phase string, start time.Time) {
+	r := recording()
+	if r == nil {
+		return
+	}
+
+	d := time.Since(start)
+	r.mu.Lock()
+	r.durations[phase] = append(r.durations[phase], d)
+	r.mu.Unlock()
+}
+
+// Add adds "n" to the named counter.
+func Add(counter string, n int64) {
+	r := recording()
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.counters[counter] += n
+	r.mu.Unlock()
+}
+
+// Set records a setting which affected the command, such as the number of
+// concurrent transfers.
+func Set(setting string, value interface{}) {
+	r := recording()
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.settings[setting] = value
+	r.mu.Unlock()
+}
+
+// Finish writes the metrics recorded so far to the file given to Start, and
+// stops recording. It does nothing if metrics are disabled.
+func Finish() error {
+	currentMu.Lock()
+	r := current
+	current = nil
+	currentMu.Unlock()
+
+	if r == nil {
+		return nil
+	}
+
+	f, err := os.Create(r.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(r.document(time.Since(r.start)))
+}
+
+func (r *recorder) document(total time.Duration) *Document {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	doc := &Document{
+		Version:       DocumentVersion,
+		Command:       r.command,
+		GitLFSVersion: r.gitLFSVersion,
+		StartedAt:     r.start.UTC(),
+		TotalMs:       millis(total),
+		Phases:        make(map[string]*PhaseStats, len(r.durations)),
+		Counters:      make(map[string]int64, len(r.counters)),
+		Settings:      make(map[string]interface{}, len(r.settings)),
+	}
+
+	for phase, durations := range r.durations {
+		doc.Phases[phase] = summarise(durations)
+	}
+	for counter, n := range r.counters {
+		doc.Counters[counter] = n
+	}
+	for setting, value := range r.settings {
+		doc.Settings[setting] = value
+	}
+
+	return doc
+}
+
+// summarise returns the total, maximum and percentiles of the given durations,
+// using the nearest-rank method.
+func summarise(durations []time.Duration) *PhaseStats {
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Sort(durationSlice(sorted))
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	return &PhaseStats{
+		Count:   len(sorted),
+		TotalMs: millis(total),
+		P50Ms:   millis(percentile(sorted, 50)),
+		P90Ms:   millis(percentile(sorted, 90)),
+		P99Ms:   millis(percentile(sorted, 99)),
+		MaxMs:   millis(sorted[len(sorted)-1]),
+	}
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type durationSlice []time.Duration
+
+func (s durationSlice) Len() int           { return len(s) }
+func (s durationSlice) Less(i, j int) bool { return s[i] < s[j] }
+func (s durationSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+func TestDisabledMetricsAreNoops(t *testing.T) {
+	Start("", "push", "1.0.0")
+
+	assert.False(t, Enabled())
+	Since(Scan, time.Now())
+	Add(Objects, 1)
+	Set("concurrent_transfers", 3)
+	assert.Nil(t, Finish())
+}
+
+func TestFinishWritesValidDocument(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lfs-metrics")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metrics.json")
+	Start(path, "push", "1.0.0")
+	require.True(t, Enabled())
+
+	scanStart := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	Since(Scan, scanStart)
+
+	transferStart := time.Now()
+	for i := 0; i < 3; i++ {
+		batchStart := time.Now()
+		time.Sleep(time.Millisecond)
+		Since(Batch, batchStart)
+	}
+	Since(Transfer, transferStart)
+
+	Add(Objects, 2)
+	Add(Objects, 1)
+	Add(Bytes, 300)
+	Set("concurrent_transfers", 3)
+
+	require.Nil(t, Finish())
+	assert.False(t, Enabled())
+
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+
+	schema, err := filepath.Abs(filepath.Join("..", "docs", "metrics-schema.json"))
+	require.Nil(t, err)
+	result, err := gojsonschema.Validate(
+		gojsonschema.NewReferenceLoader(fmt.Sprintf("file:///%s", filepath.ToSlash(schema))),
+		gojsonschema.NewStringLoader(string(data)),
+	)
+	require.Nil(t, err)
+	for _, e := range result.Errors() {
+		t.Logf("Validation error: %s", e.Description())
+	}
+	assert.True(t, result.Valid())
+
+	var doc Document
+	require.Nil(t, json.Unmarshal(data, &doc))
+
+	assert.Equal(t, DocumentVersion, doc.Version)
+	assert.Equal(t, "push", doc.Command)
+	assert.Equal(t, int64(3), doc.Counters[Objects])
+	assert.Equal(t, int64(300), doc.Counters[Bytes])
+	assert.Equal(t, float64(3), doc.Settings["concurrent_transfers"])
+
+	require.Len(t, doc.Phases, 3)
+	assert.Equal(t, 3, doc.Phases[Batch].Count)
+	assert.True(t, doc.Phases[Scan].TotalMs+doc.Phases[Transfer].TotalMs <= doc.TotalMs)
+	assert.True(t, doc.Phases[Batch].TotalMs <= doc.Phases[Transfer].TotalMs)
+
+	for name, p := range doc.Phases {
+		assert.True(t, p.P50Ms <= p.P90Ms, name)
+		assert.True(t, p.P90Ms <= p.P99Ms, name)
+		assert.True(t, p.P99Ms <= p.MaxMs, name)
+		assert.True(t, p.MaxMs <= p.TotalMs, name)
+	}
+}
+
+func TestSummarisePercentiles(t *testing.T) {
+	durations := make([]time.Duration, 0, 100)
+	for i := 100; i > 0; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+
+	p := summarise(durations)
+	assert.Equal(t, 100, p.Count)
+	assert.Equal(t, float64(5050), p.TotalMs)
+	assert.Equal(t, float64(50), p.P50Ms)
+	assert.Equal(t, float64(90), p.P90Ms)
+	assert.Equal(t, float64(99), p.P99Ms)
+	assert.Equal(t, float64(100), p.MaxMs)
+
+	single := summarise([]time.Duration{7 * time.Millisecond})
+	assert.Equal(t, float64(7), single.P50Ms)
+	assert.Equal(t, float64(7), single.P99Ms)
+}
+
+func TestFinishAlongsideRecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lfs-metrics")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metrics.json")
+	Start(path, "push", "1.0.0")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			Add(Objects, 1)
+			Since(Transfer, time.Now())
+		}()
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, Finish())
+		}()
+	}
+	wg.Wait()
+
+	assert.False(t, Enabled())
+	_, err = os.Stat(path)
+	assert.Nil(t, err)
+}
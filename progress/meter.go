@@ -30,11 +30,19 @@ type ProgressMeter struct {
 	fileIndex         map[string]int64 // Maps a file name to its transfer number
 	fileIndexMutex    *sync.Mutex
 	dryRun            bool
+	quiet             bool
+	showRate          bool
 }
 
 // NewProgressMeter creates a new ProgressMeter for the number and size of
 // files given.
-func NewProgressMeter(estFiles int, estBytes int64, dryRun bool, logPath string) *ProgressMeter {
+//
+// If quiet is true the meter does not draw its interactive progress bar, and
+// instead writes a single summary line when it finishes. This is meant for
+// output which isn't read from a terminal, such as CI logs, where the control
+// characters used to redraw the bar garble the output. Dry runs write nothing,
+// quiet or not.
+func NewProgressMeter(estFiles int, estBytes int64, dryRun, quiet bool, logPath string) *ProgressMeter {
 	logger, err := newProgressLogger(logPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating progress logger: %s\n", err)
@@ -49,9 +57,22 @@ func NewProgressMeter(estFiles int, estBytes int64, dryRun bool, logPath string)
 		estimatedFiles: int32(estFiles),
 		estimatedBytes: estBytes,
 		dryRun:         dryRun,
+		quiet:          quiet,
 	}
 }
 
+// SetQuiet turns quiet mode on or off, as described in NewProgressMeter. It
+// must be called before Start.
+func (p *ProgressMeter) SetQuiet(quiet bool) {
+	p.quiet = quiet
+}
+
+// SetShowRate turns on showing the number of files finished per second, for
+// meters whose files are each finished quickly. It must be called before Start.
+func (p *ProgressMeter) SetShowRate(showRate bool) {
+	p.showRate = showRate
+}
+
 func (p *ProgressMeter) Start() {
 	if atomic.SwapInt32(&p.started, 1) == 0 {
 		go p.writer()
@@ -68,7 +89,8 @@ func (p *ProgressMeter) Add(name string) {
 }
 
 // Skip tells the progress meter that a file of size `size` is being skipped
-// because the transfer is unnecessary.
+// because the transfer is unnecessary. Like the meter's other methods, it may be
+// called from multiple goroutines at once.
 func (p *ProgressMeter) Skip(size int64) {
 	atomic.AddInt64(&p.skippedFiles, 1)
 	atomic.AddInt64(&p.skippedBytes, size)
@@ -95,9 +117,16 @@ func (p *ProgressMeter) FinishTransfer(name string) {
 // Finish shuts down the ProgressMeter
 func (p *ProgressMeter) Finish() {
 	close(p.finished)
-	p.update()
 	p.logger.Close()
-	if !p.dryRun && p.estimatedBytes > 0 {
+	if p.quiet {
+		if p.hasOutput() {
+			fmt.Fprintf(os.Stdout, "%s\n", p.summary())
+		}
+		return
+	}
+
+	p.update()
+	if !p.dryRun && atomic.LoadInt64(&p.estimatedBytes) > 0 {
 		fmt.Fprintf(os.Stdout, "\n")
 	}
 }
@@ -106,7 +135,7 @@ func (p *ProgressMeter) logBytes(direction, name string, read, total int64) {
 	p.fileIndexMutex.Lock()
 	idx := p.fileIndex[name]
 	p.fileIndexMutex.Unlock()
-	line := fmt.Sprintf("%s %d/%d %d/%d %s\n", direction, idx, p.estimatedFiles, read, total, name)
+	line := fmt.Sprintf("%s %d/%d %d/%d %s\n", direction, idx, atomic.LoadInt32(&p.estimatedFiles), read, total, name)
 	if err := p.logger.Write([]byte(line)); err != nil {
 		p.logger.Shutdown()
 	}
@@ -125,7 +154,7 @@ func (p *ProgressMeter) writer() {
 }
 
 func (p *ProgressMeter) update() {
-	if p.dryRun || (p.estimatedFiles == 0 && p.skippedFiles == 0) {
+	if p.quiet || !p.hasOutput() {
 		return
 	}
 
@@ -135,18 +164,7 @@ func (p *ProgressMeter) update() {
 		width = size.Col()
 	}
 
-	// (%d of %d files, %d skipped) %f B / %f B, %f B skipped
-	// skipped counts only show when > 0
-
-	out := fmt.Sprintf("\rGit LFS: (%d of %d files", p.finishedFiles, p.estimatedFiles)
-	if p.skippedFiles > 0 {
-		out += fmt.Sprintf(", %d skipped", p.skippedFiles)
-	}
-	out += fmt.Sprintf(") %s / %s", formatBytes(p.currentBytes), formatBytes(p.estimatedBytes))
-	if p.skippedBytes > 0 {
-		out += fmt.Sprintf(", %s skipped", formatBytes(p.skippedBytes))
-	}
-
+	out := "\r" + p.summary()
 	padlen := width - len(out)
 	if 0 < padlen {
 		out += strings.Repeat(" ", padlen)
@@ -155,6 +173,56 @@ func (p *ProgressMeter) update() {
 	fmt.Fprintf(os.Stdout, out)
 }
 
+// hasOutput returns whether there is any progress to show.
+func (p *ProgressMeter) hasOutput() bool {
+	return !p.dryRun && (atomic.LoadInt32(&p.estimatedFiles) != 0 || atomic.LoadInt64(&p.skippedFiles) != 0)
+}
+
+// meterCounts is a copy of a ProgressMeter's counts at one moment.
+type meterCounts struct {
+	finishedFiles  int64
+	skippedFiles   int64
+	estimatedFiles int32
+	currentBytes   int64
+	estimatedBytes int64
+	skippedBytes   int64
+}
+
+// counts returns the meter's counts. They are updated atomically from many
+// goroutines, and so are read atomically too.
+func (p *ProgressMeter) counts() meterCounts {
+	return meterCounts{
+		finishedFiles:  atomic.LoadInt64(&p.finishedFiles),
+		skippedFiles:   atomic.LoadInt64(&p.skippedFiles),
+		estimatedFiles: atomic.LoadInt32(&p.estimatedFiles),
+		currentBytes:   atomic.LoadInt64(&p.currentBytes),
+		estimatedBytes: atomic.LoadInt64(&p.estimatedBytes),
+		skippedBytes:   atomic.LoadInt64(&p.skippedBytes),
+	}
+}
+
+// summary returns a line describing the progress so far.
+func (p *ProgressMeter) summary() string {
+	// (%d of %d files, %d skipped) %f B / %f B, %f B skipped
+	// skipped counts only show when > 0
+	c := p.counts()
+
+	out := fmt.Sprintf("Git LFS: (%d of %d files", c.finishedFiles, c.estimatedFiles)
+	if c.skippedFiles > 0 {
+		out += fmt.Sprintf(", %d skipped", c.skippedFiles)
+	}
+	out += fmt.Sprintf(") %s / %s", formatBytes(c.currentBytes), formatBytes(c.estimatedBytes))
+	if c.skippedBytes > 0 {
+		out += fmt.Sprintf(", %s skipped", formatBytes(c.skippedBytes))
+	}
+	if p.showRate {
+		if elapsed := time.Since(p.startTime).Seconds(); elapsed > 0 {
+			out += fmt.Sprintf(", %.1f files/s", float64(c.finishedFiles)/elapsed)
+		}
+	}
+	return out
+}
+
 func formatBytes(i int64) string {
 	switch {
 	case i > 1099511627776:
@@ -0,0 +1,73 @@
+package progress
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressMeterConcurrentSkips(t *testing.T) {
+	const workers, skips = 8, 250
+
+	p := NewProgressMeter(workers*skips+1, workers*skips*10+100, false, true, "")
+	p.Add("a.dat")
+
+	done := make(chan struct{})
+	var reads sync.WaitGroup
+	reads.Add(1)
+	go func() {
+		// Read the counts while they are being updated, as the
+		// meter's writer does.
+		defer reads.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				p.summary()
+				p.hasOutput()
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < skips; j++ {
+				p.Skip(10)
+			}
+		}()
+	}
+	p.TransferBytes("download", "a.dat", 100, 100, 100)
+	p.FinishTransfer("a.dat")
+	wg.Wait()
+	close(done)
+	reads.Wait()
+
+	c := p.counts()
+	assert.EqualValues(t, workers*skips, c.skippedFiles)
+	assert.EqualValues(t, workers*skips*10, c.skippedBytes)
+	assert.EqualValues(t, 1, c.estimatedFiles)
+	assert.EqualValues(t, 100, c.estimatedBytes)
+	assert.EqualValues(t, 1, c.finishedFiles)
+	assert.EqualValues(t, 100, c.currentBytes)
+	assert.Equal(t, "Git LFS: (1 of 1 files, 2000 skipped) 100 B / 100 B, 19.53 KB skipped", p.summary())
+}
+
+func TestProgressMeterShowsRate(t *testing.T) {
+	p := NewProgressMeter(4, 40, false, true, "")
+	p.SetShowRate(true)
+	p.startTime = time.Now().Add(-2 * time.Second)
+
+	for _, name := range []string{"a.dat", "b.dat"} {
+		p.Add(name)
+		p.TransferBytes("checkout", name, 10, 10, 10)
+		p.FinishTransfer(name)
+	}
+
+	assert.Equal(t, "Git LFS: (2 of 4 files) 20 B / 40 B, 1.0 files/s", p.summary())
+}
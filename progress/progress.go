@@ -1,3 +1,15 @@
 // Package progress provides common progress monitoring / display features
 // NOTE: Subject to change, do not rely on this package from outside git-lfs source
 package progress
+
+import "os"
+
+// IsTerminal returns whether f is a terminal, as opposed to a file or pipe such
+// as those through which a CI system collects logs.
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
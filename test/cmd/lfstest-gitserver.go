@@ -5,6 +5,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
@@ -15,7 +16,6 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
-	"math"
 	"net/http"
 	"net/http/httptest"
 	"net/textproto"
@@ -27,6 +27,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/github/git-lfs/delta"
 )
 
 var (
@@ -50,7 +52,7 @@ var (
 		"status-storage-403", "status-storage-404", "status-storage-410", "status-storage-422", "status-storage-500", "status-storage-503",
 		"status-legacy-404", "status-legacy-410", "status-legacy-422", "status-legacy-403", "status-legacy-500",
 		"status-batch-resume-206", "batch-resume-fail-fallback", "return-expired-action", "return-invalid-size",
-		"object-authenticated",
+		"object-authenticated", "status-storage-500-once",
 	}
 )
 
@@ -132,6 +134,7 @@ type lfsObject struct {
 	Authenticated bool               `json:"authenticated,omitempty"`
 	Actions       map[string]lfsLink `json:"actions,omitempty"`
 	Err           *lfsError          `json:"error,omitempty"`
+	DeltaBase     string             `json:"delta_base,omitempty"`
 }
 
 type lfsLink struct {
@@ -328,12 +331,15 @@ func lfsBatchHandler(w http.ResponseWriter, r *http.Request, id, repo string) {
 	testingTus := testingTusUploadInBatchReq(r)
 	testingTusInterrupt := testingTusUploadInterruptedInBatchReq(r)
 	testingCustomTransfer := testingCustomTransfer(r)
+	testingDelta := testingDeltaUploadInBatchReq(r)
 	var transferChoice string
 	var searchForTransfer string
 	if testingTus {
 		searchForTransfer = "tus"
 	} else if testingCustomTransfer {
 		searchForTransfer = "testcustom"
+	} else if testingDelta {
+		searchForTransfer = "delta"
 	}
 	if len(searchForTransfer) > 0 {
 		for _, t := range objs.Transfers {
@@ -400,12 +406,27 @@ func lfsBatchHandler(w http.ResponseWriter, r *http.Request, id, repo string) {
 				}
 
 				o.Actions = map[string]lfsLink{action: a}
+
+				// Offer any other object in the repository as
+				// the base for a patch.
+				if action == "upload" && transferChoice == "delta" {
+					if base, ok := largeObjects.AnyOtherThan(repo, obj.Oid); ok {
+						o.DeltaBase = base
+						o.Actions["delta"] = lfsLink{
+							Href:   lfsUrl(repo, obj.Oid) + "&base=" + base,
+							Header: map[string]string{},
+						}
+					}
+				}
 			}
 		}
 
 		if testingChunked {
 			o.Actions[action].Header["Transfer-Encoding"] = "chunked"
 		}
+		if _, ok := o.Actions[action]; ok && testingCompression(repo) {
+			o.Actions[action].Header["Lfs-Compress"] = "gzip"
+		}
 		if testingTusInterrupt {
 			o.Actions[action].Header["Lfs-Tus-Interrupt"] = "true"
 		}
@@ -453,6 +474,26 @@ func serveExpired(repo string) {
 	expiredRepos[repo] = true
 }
 
+// fmu guards failedRepos
+var fmu sync.Mutex
+
+// failedRepos is a map keyed by repository name, valuing to whether or not it
+// has already failed an upload of a "status-storage-500-once" object.
+var failedRepos = map[string]bool{}
+
+// failOnce returns true the first time it is called for the given repo, so that
+// an upload to it fails, and false afterwards.
+func failOnce(repo string) bool {
+	fmu.Lock()
+	defer fmu.Unlock()
+
+	if failedRepos[repo] {
+		return false
+	}
+	failedRepos[repo] = true
+	return true
+}
+
 // Persistent state across requests
 var batchResumeFailFallbackStorageAttempts = 0
 var tusStorageAttempts = 0
@@ -490,6 +531,11 @@ func storageHandler(w http.ResponseWriter, r *http.Request) {
 		case "status-storage-500":
 			w.WriteHeader(500)
 			return
+		case "status-storage-500-once":
+			if failOnce(repo) {
+				w.WriteHeader(500)
+				return
+			}
 		case "status-storage-503":
 			w.Header().Set("Content-Type", "application/vnd.git-lfs+json")
 			w.WriteHeader(503)
@@ -523,7 +569,37 @@ func storageHandler(w http.ResponseWriter, r *http.Request) {
 		hash := sha256.New()
 		buf := &bytes.Buffer{}
 
-		io.Copy(io.MultiWriter(hash, buf), r.Body)
+		var body io.Reader = r.Body
+		if encoding := r.Header.Get("Content-Encoding"); len(encoding) > 0 {
+			if encoding != "gzip" || !testingCompression(repo) {
+				debug(id, "Unsupported Content-Encoding %q", encoding)
+				w.WriteHeader(415)
+				return
+			}
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(400)
+				return
+			}
+			body = gz
+		}
+
+		if baseOid := r.URL.Query().Get("base"); len(baseOid) > 0 {
+			// The body is a patch against another object.
+			base, ok := largeObjects.Get(repo, baseOid)
+			if !ok || r.Header.Get("Content-Type") != "application/vnd.git-lfs.delta" {
+				w.WriteHeader(422)
+				return
+			}
+			if err := delta.Apply(bytes.NewReader(base), body, io.MultiWriter(hash, buf)); err != nil {
+				debug(id, "Invalid patch: %s", err)
+				w.WriteHeader(422)
+				return
+			}
+			debug(id, "Applied patch for %s against %s", oid, baseOid)
+		} else {
+			io.Copy(io.MultiWriter(hash, buf), body)
+		}
 		oid := hex.EncodeToString(hash.Sum(nil))
 		if !strings.HasSuffix(r.URL.Path, "/"+oid) {
 			w.WriteHeader(403)
@@ -567,6 +643,16 @@ func storageHandler(w http.ResponseWriter, r *http.Request) {
 					batchResumeFailFallbackStorageAttempts++
 				}
 			}
+			if testingCompression(repo) && statusCode == 200 && byteLimit == 0 &&
+				strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+				w.Header().Set("Content-Encoding", "gzip")
+				w.WriteHeader(statusCode)
+				gz := gzip.NewWriter(w)
+				gz.Write(by)
+				gz.Close()
+				return
+			}
+
 			w.WriteHeader(statusCode)
 			if byteLimit > 0 {
 				w.Write(by[0:byteLimit])
@@ -762,6 +848,10 @@ type Lock struct {
 	CommitSHA  string    `json:"commit_sha"`
 	LockedAt   time.Time `json:"locked_at"`
 	UnlockedAt time.Time `json:"unlocked_at,omitempty"`
+
+	// owner is the name of the user who authenticated the request which
+	// created the lock, used to tell "ours" and "theirs" apart.
+	owner string
 }
 
 type LockRequest struct {
@@ -792,6 +882,23 @@ type LockList struct {
 	Err        string `json:"error,omitempty"`
 }
 
+type Ref struct {
+	Name string `json:"name"`
+}
+
+type VerifiableLockRequest struct {
+	Ref    *Ref   `json:"ref,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+type VerifiableLockList struct {
+	Ours       []Lock `json:"ours"`
+	Theirs     []Lock `json:"theirs"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Err        string `json:"error,omitempty"`
+}
+
 var (
 	lmu   sync.RWMutex
 	locks = []Lock{}
@@ -813,6 +920,21 @@ func getLocks() []Lock {
 	return locks
 }
 
+// delLock removes the lock with the given ID, and returns it, or nil if there
+// is no such lock. Locks may be removed by concurrent requests.
+func delLock(id string) *Lock {
+	lmu.Lock()
+	defer lmu.Unlock()
+
+	for i, l := range locks {
+		if l.Id == id {
+			locks = append(locks[:i:i], locks[i+1:]...)
+			return &l
+		}
+	}
+	return nil
+}
+
 type LocksByCreatedAt []Lock
 
 func (c LocksByCreatedAt) Len() int           { return len(c) }
@@ -853,6 +975,7 @@ func locksHandler(w http.ResponseWriter, r *http.Request) {
 					enc.Encode(&LockList{
 						Err: fmt.Sprintf("cursor (%s) not found", cursor),
 					})
+					return
 				}
 			}
 
@@ -867,23 +990,25 @@ func locksHandler(w http.ResponseWriter, r *http.Request) {
 				locks = filtered
 			}
 
+			// When the client asks for a limited number of locks, the
+			// server returns, at most, three at a time, or fewer if the
+			// client asks for fewer. The cursor for the next page is the
+			// ID of the first lock on it.
 			if limit := r.FormValue("limit"); limit != "" {
-				size, err := strconv.Atoi(r.FormValue("limit"))
+				size, err := strconv.Atoi(limit)
 				if err != nil {
 					enc.Encode(&LockList{
 						Err: "unable to parse limit amount",
 					})
-				} else {
-					size = int(math.Min(float64(len(locks)), 3))
-					if size < 0 {
-						locks = []Lock{}
-					} else {
-						locks = locks[:size]
-						if size+1 < len(locks) {
-							ll.NextCursor = locks[size+1].Id
-						}
-					}
+					return
+				}
+				if size <= 0 || size > 3 {
+					size = 3
+				}
 
+				if size < len(locks) {
+					ll.NextCursor = locks[size].Id
+					locks = locks[:size]
 				}
 			}
 
@@ -892,7 +1017,9 @@ func locksHandler(w http.ResponseWriter, r *http.Request) {
 			enc.Encode(ll)
 		}
 	case "POST":
-		if strings.HasSuffix(r.URL.Path, "unlock") {
+		if strings.HasSuffix(r.URL.Path, "/locks/verify") {
+			verifyLocksHandler(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "unlock") {
 			var unlockRequest UnlockRequest
 			if err := dec.Decode(&unlockRequest); err != nil {
 				enc.Encode(&UnlockResponse{
@@ -900,20 +1027,10 @@ func locksHandler(w http.ResponseWriter, r *http.Request) {
 				})
 			}
 
-			lockIndex := -1
-			for i, l := range locks {
-				if l.Id == unlockRequest.Id {
-					lockIndex = i
-					break
-				}
-			}
-
-			if lockIndex > -1 {
+			if lock := delLock(unlockRequest.Id); lock != nil {
 				enc.Encode(&UnlockResponse{
-					Lock: &locks[lockIndex],
+					Lock: lock,
 				})
-
-				locks = append(locks[:lockIndex], locks[lockIndex+1:]...)
 			} else {
 				enc.Encode(&UnlockResponse{
 					Err: "unable to find lock",
@@ -945,6 +1062,7 @@ func locksHandler(w http.ResponseWriter, r *http.Request) {
 				Committer: lockRequest.Committer,
 				CommitSHA: lockRequest.LatestRemoteCommit,
 				LockedAt:  time.Now(),
+				owner:     authUser(r),
 			}
 
 			addLocks(*lock)
@@ -961,6 +1079,43 @@ func locksHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// verifyLocksHandler splits the locks into those created by the user who
+// authenticated the request ("ours"), and everyone else's ("theirs"). Pushes of
+// refs whose names contain "unverifiable" get a 404, like servers which don't
+// support lock verification.
+func verifyLocksHandler(w http.ResponseWriter, r *http.Request) {
+	enc := json.NewEncoder(w)
+
+	var req VerifiableLockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		enc.Encode(&VerifiableLockList{Err: err.Error()})
+		return
+	}
+
+	if req.Ref != nil && strings.Contains(req.Ref.Name, "unverifiable") {
+		http.NotFound(w, r)
+		return
+	}
+
+	user := authUser(r)
+	res := &VerifiableLockList{Ours: []Lock{}, Theirs: []Lock{}}
+	for _, l := range getLocks() {
+		if l.owner == user {
+			res.Ours = append(res.Ours, l)
+		} else {
+			res.Theirs = append(res.Theirs, l)
+		}
+	}
+
+	enc.Encode(res)
+}
+
+// authUser returns the name of the user who authenticated "r", if any.
+func authUser(r *http.Request) string {
+	user, _, _ := extractAuth(r.Header.Get("Authorization"))
+	return user
+}
+
 func missingRequiredCreds(w http.ResponseWriter, r *http.Request, repo string) bool {
 	if repo != "requirecreds" {
 		return false
@@ -994,6 +1149,12 @@ func testingTusUploadInBatchReq(r *http.Request) bool {
 func testingTusUploadInterruptedInBatchReq(r *http.Request) bool {
 	return strings.HasPrefix(r.URL.String(), "/test-tus-upload-interrupt")
 }
+func testingDeltaUploadInBatchReq(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.String(), "/test-delta-upload")
+}
+func testingCompression(repo string) bool {
+	return strings.HasPrefix(repo, "test-compression")
+}
 func testingCustomTransfer(r *http.Request) bool {
 	return strings.HasPrefix(r.URL.String(), "/test-custom-transfer")
 }
@@ -1054,6 +1215,21 @@ func (s *lfsStorage) Set(repo, oid string, by []byte) {
 	repoObjects[oid] = by
 }
 
+// AnyOtherThan returns the OID of an object in the repository other than the
+// one given, choosing the lowest OID so that the result is predictable.
+func (s *lfsStorage) AnyOtherThan(repo, oid string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var found string
+	for other := range s.objects[repo] {
+		if other != oid && (len(found) == 0 || other < found) {
+			found = other
+		}
+	}
+	return found, len(found) > 0
+}
+
 func (s *lfsStorage) Delete(repo, oid string) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
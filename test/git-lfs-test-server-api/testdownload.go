@@ -51,7 +51,7 @@ func downloadAllMissing(oidsExist, oidsMissing []TestObject) error {
 	for _, o := range retobjs {
 		link, ok := o.Rel("download")
 		if ok {
-			errbuf.WriteString(fmt.Sprintf("Download link should not exist for %s, was %s\n", o.Oid, link))
+			errbuf.WriteString(fmt.Sprintf("Download link should not exist for %s, was %v\n", o.Oid, link))
 		}
 		if o.Error == nil {
 			errbuf.WriteString(fmt.Sprintf("Download should include an error for missing object %s, was %s\n", o.Oid))
@@ -96,7 +96,7 @@ func downloadMixed(oidsExist, oidsMissing []TestObject) error {
 		link, ok := o.Rel("download")
 		if missingSet.Contains(o.Oid) {
 			if ok {
-				errbuf.WriteString(fmt.Sprintf("Download link should not exist for %s, was %s\n", o.Oid, link))
+				errbuf.WriteString(fmt.Sprintf("Download link should not exist for %s, was %v\n", o.Oid, link))
 			}
 			if o.Error == nil {
 				errbuf.WriteString(fmt.Sprintf("Download should include an error for missing object %s", o.Oid))
@@ -52,7 +52,7 @@ func uploadAllExists(oidsExist, oidsMissing []TestObject) error {
 	for _, o := range retobjs {
 		link, ok := o.Rel("upload")
 		if ok {
-			errbuf.WriteString(fmt.Sprintf("Upload link should not exist for %s, was %s\n", o.Oid, link))
+			errbuf.WriteString(fmt.Sprintf("Upload link should not exist for %s, was %v\n", o.Oid, link))
 		}
 	}
 
@@ -92,7 +92,7 @@ func uploadMixed(oidsExist, oidsMissing []TestObject) error {
 		link, ok := o.Rel("upload")
 		if existSet.Contains(o.Oid) {
 			if ok {
-				errbuf.WriteString(fmt.Sprintf("Upload link should not exist for %s, was %s\n", o.Oid, link))
+				errbuf.WriteString(fmt.Sprintf("Upload link should not exist for %s, was %v\n", o.Oid, link))
 			}
 		}
 		if missingSet.Contains(o.Oid) && !ok {
@@ -166,7 +166,7 @@ func uploadEdgeCases(oidsExist, oidsMissing []TestObject) error {
 		if code, iserror := errorCodeMap[o.Oid]; iserror {
 			reason, _ := errorReasonMap[o.Oid]
 			if ok {
-				errbuf.WriteString(fmt.Sprintf("Upload link should not exist for %s, was %s, reason %s\n", o.Oid, link, reason))
+				errbuf.WriteString(fmt.Sprintf("Upload link should not exist for %s, was %v, reason %s\n", o.Oid, link, reason))
 			}
 			if o.Error == nil {
 				errbuf.WriteString(fmt.Sprintf("Upload should include an error for invalid object %s, reason %s", o.Oid, reason))
@@ -46,6 +46,7 @@ begin_test "batch transfer unsupported on server"
   git push origin master 2>&1 | tee push.log
   grep "(1 of 1 files)" push.log
   grep "master -> master" push.log
+  grep "warning: the Git LFS server does not support the batch API" push.log
 
   assert_server_object "$reponame" "$contents_oid"
 
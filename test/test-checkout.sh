@@ -104,6 +104,52 @@ begin_test "checkout"
 )
 end_test
 
+begin_test "checkout: in parallel"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-parallel"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  for i in 1 2 3 4 5 6 7 8; do
+    printf "contents $i" > "file$i.dat"
+    printf "same" > "same$i.dat"
+  done
+  mkdir real
+  printf "real" > real/file.dat
+  printf "readonly" > readonly.dat
+  git add .gitattributes *.dat real/file.dat
+  git commit -m "add files"
+
+  rm *.dat real/file.dat
+  git checkout -- readonly.dat
+  chmod a-w readonly.dat
+
+  # Pointers beyond symbolic links are left alone, as git does
+  rmdir real
+  mkdir elsewhere
+  ln -s elsewhere real
+
+  git config lfs.concurrentcheckouts 4
+  git lfs checkout 2>&1 | tee checkout.log
+  grep "(18 of 18 files) .*, [0-9.]* files/s" checkout.log
+  grep "Skipped checkout for real/file.dat, its path is beyond a symbolic link." checkout.log
+
+  for i in 1 2 3 4 5 6 7 8; do
+    [ "contents $i" = "$(cat "file$i.dat")" ]
+    [ "same" = "$(cat "same$i.dat")" ]
+  done
+  [ ! -e elsewhere/file.dat ]
+
+  [ "readonly" = "$(cat readonly.dat)" ]
+  [ "-r--r--r--" = "$(ls -l readonly.dat | cut -c 1-10)" ]
+
+  [ -z "$(git status --porcelain -- file*.dat same*.dat readonly.dat)" ]
+)
+end_test
+
 begin_test "checkout: outside git repository"
 (
   set +e
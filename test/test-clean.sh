@@ -56,3 +56,27 @@ This is my test pointer.  There are many like it, but this one is mine.\n" | git
   [ "$(pointer c2f909f6961bf85a92e2942ef3ed80c938a3d0ebaee6e72940692581052333be 586)" = "$(cat clean.log)" ]
 )
 end_test
+
+begin_test "clean an unchanged large file"
+(
+  set -e
+  clean_setup "unchanged-large"
+
+  git lfs track "*.dat"
+  awk 'BEGIN { for (i = 0; i < 6 * 1024 * 1024; i += 64) printf "%063d\n", i }' > large.dat
+  oid="$(shasum -a 256 large.dat | cut -f 1 -d " ")"
+  git add .gitattributes large.dat
+
+  GIT_TRACE=1 git lfs clean large.dat < large.dat > clean.log 2> trace.log
+  [ "$(pointer "$oid" 6291456)" = "$(cat clean.log)" ]
+  grep "clean: content matches $oid" trace.log
+  assert_local_object "$oid" 6291456
+
+  printf "changed" >> large.dat
+  changed="$(shasum -a 256 large.dat | cut -f 1 -d " ")"
+  GIT_TRACE=1 git lfs clean large.dat < large.dat > clean.log 2> trace.log
+  [ "$(pointer "$changed" 6291463)" = "$(cat clean.log)" ]
+  grep "clean: content matches" trace.log && exit 1
+  assert_local_object "$changed" 6291463
+)
+end_test
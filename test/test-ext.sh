@@ -60,3 +60,49 @@ begin_test "ext"
   [ "$actual" = "$expected" ]
 )
 end_test
+
+begin_test "ext: stacked extensions round trip"
+(
+  set -e
+
+  mkdir ext-stacked
+  cd ext-stacked
+  git init
+  git lfs track "*.txt"
+
+  git config lfs.extension.rot13.clean "tr A-Za-z N-ZA-Mn-za-m"
+  git config lfs.extension.rot13.smudge "tr A-Za-z N-ZA-Mn-za-m"
+  git config lfs.extension.rot13.priority 0
+
+  git config lfs.extension.base64.clean "base64"
+  git config lfs.extension.base64.smudge "base64 -d"
+  git config lfs.extension.base64.priority 1
+
+  contents="Hello, stacked extensions."
+  printf "$contents" > a.txt
+  git add .gitattributes a.txt
+  git commit -m "add a.txt"
+
+  rotated="Uryyb, fgnpxrq rkgrafvbaf."
+  encoded="$(printf "$rotated" | base64)"
+  expected="version https://git-lfs.github.com/spec/v1
+ext-0-rot13 sha256:$(calc_oid "$contents")
+ext-1-base64 sha256:$(calc_oid "$rotated")
+oid sha256:$(calc_oid "$encoded\n")
+size $(( ${#encoded} + 1 ))"
+  [ "$expected" = "$(git cat-file -p :a.txt)" ]
+  [ "$encoded" = "$(cat .git/lfs/objects/*/*/$(calc_oid "$encoded\n"))" ]
+
+  rm a.txt
+  git checkout -- a.txt
+  [ "$contents" = "$(cat a.txt)" ]
+
+  git config --remove-section lfs.extension.rot13
+  git cat-file -p :a.txt > pointer.txt
+  if git lfs smudge a.txt < pointer.txt > smudged.txt; then
+    exit 1
+  fi
+  [ "$expected" = "$(cat smudged.txt)" ]
+  git lfs logs last | grep "Extension 'rot13' is not configured, but is needed to smudge a.txt."
+)
+end_test
@@ -197,3 +197,95 @@ begin_test "fetch-recent remote refs"
   refute_local_object "$oid1"
 )
 end_test
+
+begin_test "fetch-recent --since"
+(
+  set -e
+
+  cd clone
+  git config lfs.fetchrecentrefsdays 0
+  git config lfs.fetchrecentremoterefs false
+  git config lfs.fetchrecentcommitsdays 0
+
+  # --since implies --recent, and fetches previous versions back to the date
+  # given instead of for lfs.fetchrecentcommitsdays.
+  rm -rf .git/lfs/objects
+  git lfs fetch --since="10.days.ago" origin 2>&1 | tee fetch.log
+  grep "Fetching changes since" fetch.log
+  assert_local_object "$oid2" "${#content2}"
+  assert_local_object "$oid3" "${#content3}"
+  assert_local_object "$oid1" "${#content1}"
+  refute_local_object "$oid0"
+  refute_local_object "$oid4"
+
+  rm -rf .git/lfs/objects
+  git lfs fetch --recent --since="$(get_date -16d)" origin
+  assert_local_object "$oid1" "${#content1}"
+  assert_local_object "$oid0" "${#content0}"
+  refute_local_object "$oid4"
+)
+end_test
+
+begin_test "fetch-recent --recent-refs-days"
+(
+  set -e
+
+  cd clone
+  git config lfs.fetchrecentrefsdays 0
+  git config lfs.fetchrecentremoterefs true
+  git config lfs.fetchrecentcommitsdays 0
+
+  rm -rf .git/lfs/objects
+  git lfs fetch --recent origin
+  refute_local_object "$oid4"
+
+  # origin/other_branch was last changed 5 days ago
+  git lfs fetch --recent-refs-days=4 origin
+  refute_local_object "$oid4"
+  git lfs fetch --recent-refs-days=6 origin
+  assert_local_object "$oid4" "${#content4}"
+  refute_local_object "$oid1"
+)
+end_test
+
+begin_test "fetch-recent days per ref"
+(
+  set -e
+
+  cd clone
+  git config lfs.fetchrecentrefsdays 0
+  git config lfs.fetchrecentremoterefs false
+  git config lfs.fetchrecentcommitsdays 0
+
+  # Patterns which don't match master leave it with lfs.fetchrecentcommitsdays.
+  git config lfs.fetchrecent.other*.days 30
+  rm -rf .git/lfs/objects
+  git lfs fetch --recent origin
+  assert_local_object "$oid2" "${#content2}"
+  refute_local_object "$oid1"
+
+  git config lfs.fetchrecent.mast*.days 7
+  git lfs fetch --recent origin 2>&1 | tee fetch.log
+  grep "Fetching changes within 7 days of master" fetch.log
+  assert_local_object "$oid1" "${#content1}"
+  refute_local_object "$oid0"
+
+  # The longest matching pattern wins, and remote branches are matched
+  # without the name of their remote.
+  git config lfs.fetchrecent.master.days 20
+  git config lfs.fetchrecentrefsdays 6
+  git config lfs.fetchrecentremoterefs true
+  git config lfs.fetchrecent.other_branch.days 0
+  rm -rf .git/lfs/objects
+  git lfs fetch --recent origin 2>&1 | tee fetch.log
+  grep "Fetching changes within 20 days of master" fetch.log
+  [ "0" -eq "$(grep -c "days of origin/other_branch" fetch.log)" ]
+  assert_local_object "$oid0" "${#content0}"
+  assert_local_object "$oid4" "${#content4}"
+
+  git config --remove-section lfs.fetchrecent.other*
+  git config --remove-section lfs.fetchrecent.mast*
+  git config --remove-section lfs.fetchrecent.master
+  git config --remove-section lfs.fetchrecent.other_branch
+)
+end_test
@@ -534,3 +534,127 @@ begin_test "fetch with invalid remote"
   grep "Invalid remote name" fetch.log
 )
 end_test
+
+begin_test "fetch with --endpoint"
+(
+  set -e
+  cp -r clone endpoint-clone
+  cd endpoint-clone
+  rm -rf .git/lfs/objects
+
+  # origin points nowhere, so only the endpoint can have the objects.
+  git remote set-url origin "http://127.0.0.1:1/nowhere"
+
+  git lfs fetch --endpoint "$GITSERVER/$reponame.git/info/lfs" 2>&1 | tee fetch.log
+  grep "(1 of 1 files)" fetch.log
+  assert_local_object "$contents_oid" 1
+)
+end_test
+
+begin_test "fetch with an unsupported --endpoint"
+(
+  set -e
+  cd clone
+
+  set +e
+  git lfs fetch --endpoint "file:///tmp/lfs" > fetch.log 2>&1
+  res=$?
+  set -e
+
+  cat fetch.log
+  [ "2" = "$res" ]
+  grep "Invalid endpoint \"file:///tmp/lfs\": only http, https and ssh URLs are supported" fetch.log
+)
+end_test
+
+begin_test "fetch fails over from a mirror"
+(
+  set -e
+  cp -r clone mirror-clone
+  cd mirror-clone
+  rm -rf .git/lfs/objects
+
+  # The mirror is asked first, but points nowhere.
+  git config lfs.mirror.down.url "http://127.0.0.1:1/nowhere"
+  git config lfs.mirror.down.priority -1
+
+  GIT_TRACE=1 git lfs fetch 2>&1 | tee fetch.log
+  grep "(1 of 1 files)" fetch.log
+  grep "failed on mirror \"down\" (http://127.0.0.1:1/nowhere), failing over to the LFS endpoint" fetch.log
+  grep "served by the LFS endpoint ($GITSERVER/$reponame.git/info/lfs)" fetch.log
+  assert_local_object "$contents_oid" 1
+)
+end_test
+
+begin_test "fetch from a mirror"
+(
+  set -e
+  cp -r clone mirror-only-clone
+  cd mirror-only-clone
+  rm -rf .git/lfs/objects
+
+  # origin points nowhere, so only the mirror can have the objects.
+  git remote set-url origin "http://127.0.0.1:1/nowhere"
+  git config lfs.mirror.up.url "$GITSERVER/$reponame.git/info/lfs"
+  git config lfs.mirror.up.role download
+  git config lfs.mirror.up.priority -1
+
+  GIT_TRACE=1 git lfs fetch 2>&1 | tee fetch.log
+  grep "(1 of 1 files)" fetch.log
+  grep "served by mirror \"up\"" fetch.log
+  assert_local_object "$contents_oid" 1
+)
+end_test
+
+begin_test "fetch with lfs.transfer.statefile"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-statefile"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" statefile
+
+  git lfs track "*.dat"
+  printf "statefile a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  # b.dat points to an object which the server doesn't have, so fetching it
+  # fails, and the fetch has to be run again.
+  pointer "$(calc_oid "statefile b")" 11 > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+  git push --no-verify origin master
+
+  a_oid="$(calc_oid "statefile a")"
+  rm -rf .git/lfs/objects
+  git config lfs.transfer.statefile lfs/fetch-state
+
+  set +e
+  git lfs fetch 2>&1 | tee fetch.log
+  fetch_exit="${PIPESTATUS[0]}"
+  set -e
+  [ "$fetch_exit" != "0" ]
+
+  assert_local_object "$a_oid" 11
+  [ "$a_oid" = "$(cat .git/lfs/fetch-state)" ]
+
+  # A recorded object which is no longer local is downloaded again.
+  rm -rf .git/lfs/objects
+
+  set +e
+  GIT_TRACE=1 git lfs fetch 2>&1 | tee fetch.log
+  set -e
+  grep "downloading \"a.dat\" ($a_oid) again, its object is no longer local" fetch.log
+  assert_local_object "$a_oid" 11
+
+  # Once a fetch finishes, the state file is removed.
+  git rm b.dat
+  git commit -m "remove b.dat"
+  rm -rf .git/lfs/objects
+  git lfs fetch
+  assert_local_object "$a_oid" 11
+  [ ! -e .git/lfs/fetch-state ]
+)
+end_test
@@ -37,11 +37,17 @@ begin_test "fsck default"
 
 
   echo "CORRUPTION" >> .git/lfs/objects/$aOid12/$aOid34/$aOid
+  actualOid=$(shasum -a 256 .git/lfs/objects/$aOid12/$aOid34/$aOid | cut -d " " -f 1)
 
   moved=$(native_path "$TRASHDIR/$reponame/.git/lfs/bad/$aOid")
-  expected="$(printf 'Object a.dat (%s) is corrupt
-  moved to %s' "$aOid" "$moved")"
-  [ "$expected" = "$(git lfs fsck)" ]
+  expected="$(printf 'Object a.dat (%s) is corrupt, its content has OID %s
+  moved to %s' "$aOid" "$actualOid" "$moved")"
+  set +e
+  actual="$(git lfs fsck)"
+  res=$?
+  set -e
+  [ "$expected" = "$actual" ]
+  [ "$res" = "2" ]
 
   if [ -e .git/lfs/objects/$aOid12/$aOid34/$aOid ]; then
     echo "Expected a.dat to be cleared for being corrupt"
@@ -89,8 +95,9 @@ begin_test "fsck dry run"
   fi
 
   echo "CORRUPTION" >> .git/lfs/objects/$aOid12/$aOid34/$aOid
+  actualOid=$(shasum -a 256 .git/lfs/objects/$aOid12/$aOid34/$aOid | cut -d " " -f 1)
 
-  [ "Object a.dat ($aOid) is corrupt" = "$(git lfs fsck --dry-run)" ]
+  [ "Object a.dat ($aOid) is corrupt, its content has OID $actualOid" = "$(git lfs fsck --dry-run)" ]
 
   if [ "$aOid" = "$(shasum -a 256 .git/lfs/objects/$aOid12/$aOid34/$aOid | cut -d " " -f 1)" ]; then
     echo "oid for a.dat still matches match"
@@ -104,6 +111,152 @@ begin_test "fsck dry run"
 )
 end_test
 
+begin_test "fsck: unreferenced objects"
+(
+  set -e
+
+  reponame="fsck-unreferenced"
+  git init $reponame
+  cd $reponame
+
+  git lfs track "*.dat"
+  echo "test data" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "first commit"
+
+  contents="unreferenced"
+  oid=$(calc_oid "$contents")
+  printf "$contents" | git lfs clean > /dev/null
+
+  assert_local_object "$oid" 12
+  [ "Git LFS fsck OK" = "$(git lfs fsck)" ]
+
+  echo "CORRUPTION" >> .git/lfs/objects/${oid:0:2}/${oid:2:2}/$oid
+  actualOid=$(shasum -a 256 .git/lfs/objects/${oid:0:2}/${oid:2:2}/$oid | cut -d " " -f 1)
+
+  [ "Git LFS fsck OK" = "$(git lfs fsck --pointers-only)" ]
+  [ "Object $oid is corrupt, its content has OID $actualOid" = "$(git lfs fsck --objects-only --dry-run)" ]
+
+  set +e
+  git lfs fsck --objects-only --pointers-only > fsck.log 2>&1
+  res=$?
+  set -e
+  [ "$res" = "2" ]
+  grep "Cannot use --objects-only with --pointers-only." fsck.log
+)
+end_test
+
+begin_test "fsck: missing objects"
+(
+  set -e
+
+  reponame="fsck-missing"
+  git init $reponame
+  cd $reponame
+
+  git lfs track "*.dat"
+  echo "test data" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "first commit"
+
+  aOid=$(calc_oid "test data\n")
+  rm .git/lfs/objects/${aOid:0:2}/${aOid:2:2}/$aOid
+
+  # Remove a.dat too, so that scanning the index doesn't clean it again.
+  rm a.dat
+
+  set +e
+  actual="$(git lfs fsck)"
+  res=$?
+  set -e
+  [ "Object a.dat ($aOid) could not be checked: file does not exist" = "$actual" ]
+  [ "$res" = "2" ]
+
+  [ "Git LFS fsck OK" = "$(git lfs fsck --objects-only)" ]
+)
+end_test
+
+begin_test "fsck: fix"
+(
+  set -e
+
+  reponame="fsck-fix"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  printf "b" > b.dat
+  git add .gitattributes a.dat b.dat
+  git commit -m "first commit"
+  git push origin master
+
+  aOid=$(calc_oid "a")
+  bOid=$(calc_oid "b")
+  assert_server_object "$reponame" "$aOid"
+  assert_server_object "$reponame" "$bOid"
+
+  printf "CORRUPTION" >> .git/lfs/objects/${aOid:0:2}/${aOid:2:2}/$aOid
+  rm .git/lfs/objects/${bOid:0:2}/${bOid:2:2}/$bOid
+
+  set +e
+  git lfs fsck --fix > fsck.log 2>&1
+  res=$?
+  set -e
+  cat fsck.log
+  [ "$res" = "1" ]
+  grep "Object a.dat ($aOid) is corrupt" fsck.log
+  grep "Object b.dat ($bOid) could not be checked" fsck.log
+  grep "Object $aOid was downloaded again" fsck.log
+  grep "Object $bOid was downloaded again" fsck.log
+  [ -f ".git/lfs/bad/$aOid" ]
+
+  assert_local_object "$aOid" 1
+  assert_local_object "$bOid" 1
+
+  set +e
+  git lfs fsck > fsck.log 2>&1
+  res=$?
+  set -e
+  [ "$res" = "0" ]
+  [ "Git LFS fsck OK" = "$(cat fsck.log)" ]
+
+  set +e
+  git lfs fsck --fix --dry-run > fsck.log 2>&1
+  res=$?
+  set -e
+  [ "$res" = "2" ]
+  grep "Cannot use --fix with --dry-run." fsck.log
+)
+end_test
+
+begin_test "fsck: fix without the objects on the server"
+(
+  set -e
+
+  reponame="fsck-fix-unrepaired"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "first commit"
+
+  aOid=$(calc_oid "a")
+  printf "CORRUPTION" >> .git/lfs/objects/${aOid:0:2}/${aOid:2:2}/$aOid
+
+  set +e
+  git lfs fsck --fix > fsck.log 2>&1
+  res=$?
+  set -e
+  cat fsck.log
+  [ "$res" = "2" ]
+  grep "Object a.dat ($aOid) is corrupt" fsck.log
+  refute_local_object "$aOid"
+)
+end_test
+
 begin_test "fsck: outside git repository"
 (
   set +e
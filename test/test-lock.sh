@@ -59,3 +59,43 @@ begin_test "locking a directory"
   grep "cannot lock directory" lock.log
 )
 end_test
+
+begin_test "locking multiple files"
+(
+  set -e
+
+  reponame="lock_multiple_files"
+  setup_remote_repo "remote_$reponame"
+  clone_repo "remote_$reponame" "clone_$reponame"
+
+  git lfs track "*.png"
+  mkdir -p textures/boss textures/hero
+  for f in textures/boss/a.png textures/boss/b.png textures/boss/c.png textures/hero/d.png; do
+    printf "$f" > "$f"
+  done
+  printf "untracked" > textures/boss/untracked.png
+  git add .gitattributes textures/boss/a.png textures/boss/b.png textures/boss/c.png textures/hero/d.png
+  git commit -m "add textures"
+  git push origin master
+
+  # The server already has a lock on b.png, so it rejects that one.
+  GITLFSLOCKSENABLED=1 git lfs lock textures/boss/b.png
+
+  set +e
+  GITLFSLOCKSENABLED=1 git lfs lock textures/hero/d.png --glob "textures/boss/*.png" > lock.log 2>&1
+  res=$?
+  set -e
+  cat lock.log
+  [ "2" = "$res" ]
+
+  grep "'textures/hero/d.png' was locked" lock.log
+  grep "'textures/boss/a.png' was locked" lock.log
+  grep "'textures/boss/c.png' was locked" lock.log
+  grep "Unable to lock 'textures/boss/b.png': lock already created" lock.log
+  [ "0" -eq "$(grep -c "untracked.png" lock.log)" ]
+
+  for id in $(grep -oh "\((.*)\)" lock.log | tr -d "()"); do
+    assert_server_lock "$id"
+  done
+)
+end_test
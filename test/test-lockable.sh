@@ -0,0 +1,120 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "lockable files are read-only until locked"
+(
+  set -e
+
+  reponame="lockable_read_only"
+  setup_remote_repo "remote_$reponame"
+  clone_repo "remote_$reponame" "clone_$reponame"
+
+  git lfs track --lockable "*.dat"
+  for f in a.dat b.dat c.dat; do
+    printf "$f" > "$f"
+  done
+  git add .gitattributes a.dat b.dat c.dat
+  git commit -m "add lockable files"
+  git push origin master
+
+  # c.dat is still tracked, so it's lockable, but there's nothing to chmod.
+  rm c.dat
+  GITLFSLOCKSENABLED=1 git lfs checkout a.dat 2>&1 | tee checkout.log
+  [ "0" -eq "$(grep -c "Unable" checkout.log)" ]
+
+  refute_file_writable a.dat
+  refute_file_writable b.dat
+  [ ! -e c.dat ]
+
+  GITLFSLOCKSENABLED=1 git lfs lock a.dat | tee lock.log
+  grep "'a.dat' was locked" lock.log
+  assert_file_writable a.dat
+  refute_file_writable b.dat
+
+  GITLFSLOCKSENABLED=1 git lfs unlock a.dat 2>&1 | tee unlock.log
+  grep "'a.dat' was unlocked" unlock.log
+  refute_file_writable a.dat
+)
+end_test
+
+begin_test "lockable files stay writable while locked after checkout"
+(
+  set -e
+
+  reponame="lockable_checkout_locked"
+  setup_remote_repo "remote_$reponame"
+  clone_repo "remote_$reponame" "clone_$reponame"
+
+  git lfs track --lockable "*.dat"
+  printf "a" > locked.dat
+  printf "b" > unlocked.dat
+  git add .gitattributes locked.dat unlocked.dat
+  git commit -m "add lockable files"
+  git push origin master
+
+  GITLFSLOCKSENABLED=1 git lfs lock locked.dat | tee lock.log
+  assert_file_writable locked.dat
+
+  rm locked.dat unlocked.dat
+  GITLFSLOCKSENABLED=1 git lfs checkout
+  [ "a" = "$(cat locked.dat)" ]
+  assert_file_writable locked.dat
+  refute_file_writable unlocked.dat
+)
+end_test
+
+begin_test "lockable files are read-only after clone"
+(
+  set -e
+
+  reponame="lockable_clone"
+  setup_remote_repo_with_file "$reponame" "a.dat"
+  git lfs track --lockable "*.dat"
+  git add .gitattributes
+  git commit -m "make *.dat lockable"
+  git push origin master
+
+  cd "$TRASHDIR"
+  GITLFSLOCKSENABLED=1 git lfs clone "$GITSERVER/remote_$reponame" "lfs_clone_$reponame"
+  cd "lfs_clone_$reponame"
+
+  [ "a.dat" = "$(cat a.dat)" ]
+  refute_file_writable a.dat
+)
+end_test
+
+begin_test "lockable-status"
+(
+  set -e
+
+  reponame="lockable_status"
+  setup_remote_repo "remote_$reponame"
+  clone_repo "remote_$reponame" "clone_$reponame"
+
+  git lfs track --lockable "*.dat"
+  printf "a" > status_a.dat
+  printf "b" > status_b.dat
+  git add .gitattributes status_a.dat status_b.dat
+  git commit -m "add lockable files"
+  git push origin master
+
+  GITLFSLOCKSENABLED=1 git lfs checkout
+  GITLFSLOCKSENABLED=1 git lfs lockable-status | tee status.log
+  grep "All 2 lockable file(s) have the expected permissions." status.log
+
+  GITLFSLOCKSENABLED=1 git lfs lock status_a.dat
+  chmod u-w status_a.dat
+  chmod u+w status_b.dat
+
+  GITLFSLOCKSENABLED=1 git lfs lockable-status | tee status.log
+  grep "status_a.dat: read-only, but locked by you" status.log
+  grep "status_b.dat: writable, but not locked by you" status.log
+
+  GITLFSLOCKSENABLED=1 git lfs checkout
+  GITLFSLOCKSENABLED=1 git lfs lockable-status | tee status.log
+  grep "All 2 lockable file(s) have the expected permissions." status.log
+  assert_file_writable status_a.dat
+  refute_file_writable status_b.dat
+)
+end_test
@@ -88,3 +88,87 @@ begin_test "list locks with pagination"
   grep "4 lock(s) matched query" locks.log
 )
 end_test
+
+begin_test "list locks across pages without a limit"
+(
+  set -e
+
+  reponame="locks_list_all_pages"
+  setup_remote_repo "remote_$reponame"
+  clone_repo "remote_$reponame" "clone_$reponame"
+
+  git lfs track "*.dat"
+  for i in $(seq 1 7); do
+    echo "$i" > "all_$i.dat"
+  done
+
+  git add *.dat ".gitattributes"
+  git commit -m "add files"
+  git push origin master 2>&1 | tee push.log
+  grep "master -> master" push.log
+
+  for i in $(seq 1 7); do
+    GITLFSLOCKSENABLED=1 git lfs lock "all_$i.dat" | tee lock.log
+    assert_server_lock "$(grep -oh "\((.*)\)" lock.log | tr -d "()")"
+  done
+
+  # The server returns three locks at a time, so this takes at least three
+  # pages, and more with the locks from other tests.
+  GITLFSLOCKSENABLED=1 GIT_TRACE=1 git lfs locks --path "all_" 2>&1 | tee locks.log
+  grep "7 lock(s) matched query" locks.log
+  [ "$(grep -c "HTTP: GET .*/locks" locks.log)" -ge 3 ]
+)
+end_test
+
+begin_test "list locks by path prefix, id and as json"
+(
+  set -e
+
+  reponame="locks_list_filters"
+  setup_remote_repo "remote_$reponame"
+  clone_repo "remote_$reponame" "clone_$reponame"
+
+  git lfs track "*.dat"
+  mkdir -p prefix_dir
+  echo "a" > prefix_dir/a.dat
+  echo "b" > prefix_dir/b.dat
+  echo "c" > prefix_other.dat
+
+  git add prefix_dir prefix_other.dat ".gitattributes"
+  git commit -m "add files"
+  git push origin master 2>&1 | tee push.log
+  grep "master -> master" push.log
+
+  GITLFSLOCKSENABLED=1 git lfs lock "prefix_dir/a.dat" | tee lock.log
+  id=$(grep -oh "\((.*)\)" lock.log | tr -d "()")
+  assert_server_lock "$id"
+  GITLFSLOCKSENABLED=1 git lfs lock "prefix_dir/b.dat"
+  GITLFSLOCKSENABLED=1 git lfs lock "prefix_other.dat"
+
+  GITLFSLOCKSENABLED=1 git lfs locks --path "prefix_dir/" | tee locks.log
+  grep "2 lock(s) matched query" locks.log
+  [ "0" -eq "$(grep -c "prefix_other.dat" locks.log)" ]
+
+  GITLFSLOCKSENABLED=1 git lfs locks --path "prefix_" | tee locks.log
+  grep "3 lock(s) matched query" locks.log
+
+  # The path is relative to the current directory.
+  pushd prefix_dir > /dev/null
+    GITLFSLOCKSENABLED=1 git lfs locks --path "b.dat" | tee locks.log
+    grep "1 lock(s) matched query" locks.log
+    grep "prefix_dir/b.dat" locks.log
+  popd > /dev/null
+
+  GITLFSLOCKSENABLED=1 git lfs locks --id "$id" | tee locks.log
+  grep "1 lock(s) matched query" locks.log
+  grep "prefix_dir/a.dat" locks.log
+
+  GITLFSLOCKSENABLED=1 git lfs locks --json --path "prefix_dir/a.dat" | tee locks.json
+  [ "1" -eq "$(grep -o '"id":' locks.json | wc -l | tr -d ' ')" ]
+  grep "\"id\":\"$id\"" locks.json
+  grep '"path":"prefix_dir/a.dat"' locks.json
+  grep '"locked_at":' locks.json
+
+  [ "[]" = "$(GITLFSLOCKSENABLED=1 git lfs locks --json --path "missing/")" ]
+)
+end_test
@@ -109,3 +109,95 @@ a1fff0ffefb9eace7230c24e50731f0a91c62f9cefdfe77121c2f607125dffae * two.tgz")"
   [ "$expected" = "$(git lfs ls-files --long)" ]
 )
 end_test
+
+begin_test "ls-files: piped to a reader that exits early"
+(
+  set -e
+
+  mkdir pipeRepo
+  cd pipeRepo
+  git init
+
+  git lfs track "*.dat" | grep "Tracking \*.dat"
+  for i in $(seq 1 200); do
+    echo "content $i" > "file$i.dat"
+  done
+  git add .gitattributes *.dat
+  git commit -m "add many files"
+
+  git lfs ls-files 2> ls-files.log | head -n 3 > head.log
+  [ "3" -eq "$(wc -l < head.log)" ]
+  [ ! -s ls-files.log ]
+
+  # Without SIGPIPE, git lfs sees the closed pipe as a write error instead.
+  (trap "" PIPE; git lfs ls-files 2> ls-files.log | head -n 3 > head.log)
+  [ "3" -eq "$(wc -l < head.log)" ]
+  [ ! -s ls-files.log ]
+
+  if [ -w /dev/full ]; then
+    echo "other write errors are reported"
+    set +e
+    git lfs ls-files > /dev/full 2> ls-files.log
+    res=$?
+    set -e
+
+    [ "2" = "$res" ]
+    grep "Error writing output" ls-files.log
+  fi
+)
+end_test
+
+begin_test "ls-files: filtering, sorting and sizes"
+(
+  set -e
+
+  mkdir repo-filter
+  cd repo-filter
+  git init
+  git lfs track "*.dat" "*.bin"
+
+  mkdir -p assets/images docs
+  printf "%2048s" "" > assets/images/large.dat
+  printf "%1024s" "" > assets/medium.bin
+  printf "small" > docs/small.dat
+  printf "%100s" "" > top.dat
+  git add .gitattributes assets docs top.dat
+  git commit -m "add files"
+
+  git lfs ls-files --size | tee ls.log
+  grep "assets/images/large.dat (2.0 KB)" ls.log
+  grep "docs/small.dat (5 B)" ls.log
+
+  [ "assets/images/large.dat
+top.dat" = "$(git lfs ls-files --include="*.dat" --exclude="docs" | cut -d " " -f 3 | sort)" ]
+
+  [ "assets/images/large.dat
+assets/medium.bin" = "$(git lfs ls-files --include="assets" | cut -d " " -f 3 | sort)" ]
+
+  # --larger-than is strict, and takes units in powers of 1024.
+  [ "assets/images/large.dat" = "$(git lfs ls-files --larger-than=1KB | cut -d " " -f 3)" ]
+  [ "assets/images/large.dat
+assets/medium.bin" = "$(git lfs ls-files --larger-than=100 --sort=name | cut -d " " -f 3)" ]
+
+  [ "assets/images/large.dat
+assets/medium.bin
+top.dat
+docs/small.dat" = "$(git lfs ls-files --sort=size | cut -d " " -f 3)" ]
+
+  [ "assets/images/large.dat
+assets/medium.bin
+docs/small.dat
+top.dat" = "$(git lfs ls-files --sort=name | cut -d " " -f 3)" ]
+
+  large_oid="$(calc_oid "$(cat assets/images/large.dat)")"
+  medium_oid="$(calc_oid "$(cat assets/medium.bin)")"
+  expected="[{\"name\":\"large.dat\",\"oid\":\"$large_oid\",\"size\":2048,\"pointer_path\":\"assets/images/large.dat\"},{\"name\":\"medium.bin\",\"oid\":\"$medium_oid\",\"size\":1024,\"pointer_path\":\"assets/medium.bin\"}]"
+  [ "$expected" = "$(git lfs ls-files --json --larger-than=1000 --sort=size)" ]
+  [ "[]" = "$(git lfs ls-files --json --larger-than=1GB)" ]
+
+  git lfs ls-files --sort=date 2>&1 | tee ls.log
+  grep "Invalid --sort value \"date\": must be \"name\" or \"size\"" ls.log
+  git lfs ls-files --larger-than=lots 2>&1 | tee ls.log
+  grep "Invalid --larger-than value" ls.log
+)
+end_test
@@ -300,3 +300,50 @@ begin_test "pointer to console"
   grep "oid sha256:e96ec1bd71eea8df78b24c64a7ab9d42dd7f821c4e503f0e2288273b9bff6c16" pointer.txt
 )
 end_test
+
+begin_test "pointer --check --stdin"
+(
+  set -e
+
+  printf "version https://git-lfs.github.com/spec/v1
+oid sha256:6c17f2007cbe934aee6e309b28b2dba3c119c5dff2ef813ed124699efe319868
+size 7
+" > valid.dat
+  printf "version https://git-lfs.github.com/spec/v1\r
+oid sha256:6c17f2007cbe934aee6e309b28b2dba3c119c5dff2ef813ed124699efe319868\r
+size 7\r
+" > "crlf file.dat"
+  printf "version https://git-lfs.github.com/spec/v1
+size 7
+oid sha256:6c17f2007cbe934aee6e309b28b2dba3c119c5dff2ef813ed124699efe319868
+" > order.dat
+
+  printf "valid.dat\ncrlf file.dat\n" | git lfs pointer --check --stdin > check.log 2> summary.log
+  [ "ok valid.dat
+ok crlf file.dat" = "$(cat check.log)" ]
+  [ "2 checked, 0 invalid" = "$(cat summary.log)" ]
+
+  set +e
+  printf "valid.dat\0crlf file.dat\0order.dat\0missing.dat\0" |
+    git lfs pointer --check --strict --stdin > check.log 2> summary.log
+  status=$?
+  set -e
+  cat check.log
+  [ "1" = "$status" ]
+  grep "^ok valid.dat$" check.log
+  grep "^invalid crlf file.dat: Windows line endings$" check.log
+  grep "^invalid order.dat: " check.log
+  grep "^invalid missing.dat: " check.log
+  [ "4 checked, 3 invalid" = "$(cat summary.log)" ]
+
+  set +e
+  printf "valid.dat\norder.dat\n" | git lfs pointer --check --json --stdin > check.json
+  status=$?
+  set -e
+  cat check.json
+  [ "1" = "$status" ]
+  grep '"path":"valid.dat","valid":true,"oid":"6c17f2007cbe934aee6e309b28b2dba3c119c5dff2ef813ed124699efe319868","size":7' check.json
+  grep '"path":"order.dat","valid":false' check.json
+  grep '"checked":2,"invalid":1' check.json
+)
+end_test
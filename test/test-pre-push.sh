@@ -146,6 +146,12 @@ begin_test "pre-push with existing file"
 
   # now the file exists
   assert_server_object "$reponame" 7aa7a5359173d05b63cfd682e3c38487f3cb4f7f1d60659fe59fab1505977d4c
+
+  # pushing again skips the object the server already has
+  echo "refs/heads/master master refs/heads/master 0000000000000000000000000000000000000000" |
+    git lfs pre-push origin "$GITSERVER/$reponame" 2>&1 |
+    tee push.log
+  grep "1 objects already on server (4 B) skipped" push.log
 )
 end_test
 
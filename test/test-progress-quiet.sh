@@ -0,0 +1,76 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "progress: quiet push and fetch print a summary without redrawing"
+(
+  set -e
+
+  reponame="progress-quiet"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  printf "b" > b.dat
+  git add .gitattributes a.dat b.dat
+  git commit -m "add files"
+
+  git lfs push --quiet origin master > push.log 2>&1
+  grep "Git LFS: (2 of 2 files)" push.log
+  [ "$(grep -c $'\r' push.log)" -eq 0 ]
+
+  rm -rf .git/lfs/objects
+  git lfs fetch --quiet > fetch.log 2>&1
+  grep "Git LFS: (2 of 2 files)" fetch.log
+  [ "$(grep -c $'\r' fetch.log)" -eq 0 ]
+
+  rm -rf .git/lfs/objects
+  git lfs fetch --all --quiet > fetchall.log 2>&1
+  grep "2 objects found" fetchall.log
+  [ "$(grep -c $'\r' fetchall.log)" -eq 0 ]
+)
+end_test
+
+begin_test "progress: lfs.quiet applies to pull"
+(
+  set -e
+
+  reponame="progress-quiet-config"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  rm -rf .git/lfs/objects a.dat
+  git config lfs.quiet true
+  git lfs pull > pull.log 2>&1
+  grep "Git LFS: (1 of 1 files)" pull.log
+  [ "$(grep -c $'\r' pull.log)" -eq 0 ]
+  [ "a" = "$(cat a.dat)" ]
+)
+end_test
+
+begin_test "progress: quiet dry runs print no progress"
+(
+  set -e
+
+  reponame="progress-quiet-dry-run"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  git lfs push --quiet --dry-run origin master > push.log 2>&1
+  grep "push .* => a.dat" push.log
+  [ "$(grep -c "Git LFS:" push.log)" -eq 0 ]
+  [ "$(grep -c $'\r' push.log)" -eq 0 ]
+)
+end_test
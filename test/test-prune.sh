@@ -537,4 +537,109 @@ begin_test "prune verify"
   refute_local_object "$oid_commit3"
 
 )
-end_test
\ No newline at end of file
+end_test
+begin_test "prune dry-run-verbose and keep-pattern"
+(
+  set -e
+
+  reponame="prune_dry_run_verbose"
+  setup_remote_repo "remote_$reponame"
+
+  clone_repo "remote_$reponame" "clone_$reponame"
+
+  git lfs track "*.dat" 2>&1 | tee track.log
+  grep "Tracking \*.dat" track.log
+
+  content_old="To delete: pushed and replaced"
+  content_keep="Kept by pattern: pushed and replaced"
+  content_current="Keep: current"
+  content_keep2="Keep: current in keep dir"
+  content_unpushed_old="Keep: unpushed and replaced"
+  content_unpushed="Keep: unpushed and current"
+  content_stashed="Keep: stashed"
+  oid_old=$(calc_oid "$content_old")
+  oid_keep=$(calc_oid "$content_keep")
+  oid_current=$(calc_oid "$content_current")
+  oid_unpushed_old=$(calc_oid "$content_unpushed_old")
+  oid_unpushed=$(calc_oid "$content_unpushed")
+  oid_stashed=$(calc_oid "$content_stashed")
+
+  echo "[
+  {
+    \"CommitDate\":\"$(get_date -20d)\",
+    \"Files\":[
+      {\"Filename\":\"old.dat\",\"Size\":${#content_old}, \"Data\":\"$content_old\"},
+      {\"Filename\":\"keep/asset.dat\",\"Size\":${#content_keep}, \"Data\":\"$content_keep\"}]
+  },
+  {
+    \"CommitDate\":\"$(get_date -10d)\",
+    \"Files\":[
+      {\"Filename\":\"old.dat\",\"Size\":${#content_current}, \"Data\":\"$content_current\"},
+      {\"Filename\":\"keep/asset.dat\",\"Size\":${#content_keep2}, \"Data\":\"$content_keep2\"}]
+  }
+  ]" | lfstest-testutils addcommits
+  oldcommit=$(git rev-parse master~1)
+
+  git push origin master
+
+  echo "[
+  {
+    \"CommitDate\":\"$(get_date -5d)\",
+    \"NewBranch\":\"feature\",
+    \"Files\":[
+      {\"Filename\":\"unpushed.dat\",\"Size\":${#content_unpushed_old}, \"Data\":\"$content_unpushed_old\"}]
+  },
+  {
+    \"CommitDate\":\"$(get_date -1d)\",
+    \"Files\":[
+      {\"Filename\":\"unpushed.dat\",\"Size\":${#content_unpushed}, \"Data\":\"$content_unpushed\"}]
+  }
+  ]" | lfstest-testutils addcommits
+  unpushedcommit=$(git rev-parse feature~1)
+  headcommit=$(git rev-parse HEAD)
+
+  printf "$content_stashed" > stashed.dat
+  git add stashed.dat
+  git stash
+  [ ! -e stashed.dat ]
+  stashcommit=$(git rev-parse stash@{0})
+
+  git config lfs.fetchrecentrefsdays 0
+  git config lfs.fetchrecentcommitsdays 0
+  git config lfs.pruneoffsetdays 0
+
+  git lfs prune --dry-run-verbose 2>&1 | tee prune.log
+  grep "7 local objects, 5 retained" prune.log
+  grep "2 files would be pruned" prune.log
+  grep " \* $oid_old (${#content_old} B), last added in commit ${oldcommit:0:7}" prune.log
+  grep " \* $oid_keep (${#content_keep} B), last added in commit ${oldcommit:0:7}" prune.log
+  grep "5 files would be retained" prune.log
+  grep " \* $oid_current (${#content_current} B): current checkout (${headcommit:0:7})" prune.log
+  grep " \* $oid_unpushed_old (${#content_unpushed_old} B): unpushed commit ${unpushedcommit:0:7}" prune.log
+  # the stash has the rest of the working copy too
+  grep " \* $oid_unpushed (${#content_unpushed} B): current checkout (${headcommit:0:7}); stashed in stash@{0} (${stashcommit:0:7}); unpushed commit ${headcommit:0:7}" prune.log
+  grep " \* $oid_stashed (${#content_stashed} B): stashed in stash@{0} (${stashcommit:0:7})" prune.log
+  assert_local_object "$oid_old" "${#content_old}"
+  assert_local_object "$oid_keep" "${#content_keep}"
+
+  git lfs prune --dry-run-verbose --keep-pattern keep 2>&1 | tee prune.log
+  grep "1 files would be pruned" prune.log
+  grep " \* $oid_old" prune.log
+  grep " \* $oid_keep (${#content_keep} B): --keep-pattern matches keep/asset.dat" prune.log
+
+  # Patterns without a slash match at any depth, as with fetch --include.
+  git lfs prune --dry-run-verbose --keep-pattern "asset.dat" 2>&1 | tee prune.log
+  grep "1 files would be pruned" prune.log
+  grep " \* $oid_keep (${#content_keep} B): --keep-pattern matches keep/asset.dat" prune.log
+
+  git lfs prune --keep-pattern "keep/*" 2>&1 | tee prune.log
+  grep "Pruning 1 files" prune.log
+  refute_local_object "$oid_old"
+  assert_local_object "$oid_keep" "${#content_keep}"
+  assert_local_object "$oid_unpushed_old" "${#content_unpushed_old}"
+  assert_local_object "$oid_stashed" "${#content_stashed}"
+
+  git stash pop
+  [ "$content_stashed" = "$(cat stashed.dat)" ]
+)
+end_test
@@ -139,6 +139,79 @@ begin_test "pull with raw remote url"
 )
 end_test
 
+begin_test "pull with --endpoint"
+(
+  set -e
+  mkdir endpoint
+  cd endpoint
+  git init
+  git lfs install --local --skip-smudge
+
+  git remote add origin $GITSERVER/test-pull
+  git pull origin master
+
+  contents="a"
+  contents_oid=$(calc_oid "$contents")
+  refute_local_object "$contents_oid"
+
+  # origin points nowhere, so only the endpoint can have the objects.
+  git remote set-url origin "http://127.0.0.1:1/nowhere"
+
+  git lfs pull --endpoint "$GITSERVER/test-pull.git/info/lfs"
+
+  assert_local_object "$contents_oid" 1
+  [ "a" = "$(cat a.dat)" ]
+)
+end_test
+
+begin_test "pull: nested files matched by include pattern"
+(
+  set -e
+
+  reponame="pull-nested-include"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.psd" "*.dat"
+
+  mkdir -p a/b
+  printf "nested" > a/b/x.psd
+  printf "top" > top.psd
+  printf "data" > a/b/y.dat
+  nested_oid="$(calc_oid "nested")"
+  data_oid="$(calc_oid "data")"
+
+  git add .gitattributes a top.psd
+  git commit -m "add nested files"
+  git push origin master
+
+  export GIT_LFS_SKIP_SMUDGE=1
+  clone_repo "$reponame" "$reponame-clone"
+  unset GIT_LFS_SKIP_SMUDGE
+  refute_local_object "$nested_oid"
+
+  git lfs pull -I "*.psd"
+
+  assert_local_object "$nested_oid" 6
+  [ "nested" = "$(cat a/b/x.psd)" ]
+  [ "top" = "$(cat top.psd)" ]
+  refute_local_object "$data_oid"
+  grep "$data_oid" a/b/y.dat
+
+  echo "smudge skips objects over lfs.fetchmaxsize"
+  rm -rf .git/lfs/objects a/b/x.psd
+  git config lfs.fetchmaxsize 5
+  git checkout -- a/b/x.psd
+  refute_local_object "$nested_oid"
+  grep "$nested_oid" a/b/x.psd
+
+  git config --unset lfs.fetchmaxsize
+  rm a/b/x.psd
+  git checkout -- a/b/x.psd
+  [ "nested" = "$(cat a/b/x.psd)" ]
+)
+end_test
+
 begin_test "pull: outside git repository"
 (
   set +e
@@ -0,0 +1,93 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "push: delta upload"
+(
+  set -e
+
+  # this repo name is the indicator to the server to use delta uploads
+  reponame="test-delta-upload"
+  setup_remote_repo "$reponame"
+
+  clone_repo "$reponame" "$reponame"
+  git config lfs.deltatransfers true
+
+  git lfs track "*.dat"
+  head -c 262144 /dev/urandom > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  # the server has nothing to offer as a base yet
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  grep "xfer: no local delta base" push.log
+  assert_server_object "$reponame" "$(shasum -a 256 a.dat | cut -f 1 -d " ")"
+
+  printf "a small change" >> a.dat
+  git add a.dat
+  git commit -m "change a.dat"
+
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  grep "xfer: uploading \".*\" as a .* byte delta against" push.log
+  # the server only stores the object if the patched content has the right oid
+  assert_server_object "$reponame" "$(shasum -a 256 a.dat | cut -f 1 -d " ")"
+)
+end_test
+
+begin_test "push: delta upload falls back when the patch is too large"
+(
+  set -e
+
+  reponame="test-delta-upload-too-large"
+  setup_remote_repo "$reponame"
+
+  clone_repo "$reponame" "$reponame"
+  git config lfs.deltatransfers true
+
+  git lfs track "*.dat"
+  head -c 65536 /dev/urandom > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  head -c 65536 /dev/urandom > a.dat
+  git add a.dat
+  git commit -m "replace a.dat"
+
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  grep "xfer: delta for \".*\" is too large, uploading whole object" push.log
+  assert_server_object "$reponame" "$(shasum -a 256 a.dat | cut -f 1 -d " ")"
+)
+end_test
+
+begin_test "push: delta upload ignores a corrupt local base"
+(
+  set -e
+
+  reponame="test-delta-upload-corrupt-base"
+  setup_remote_repo "$reponame"
+
+  clone_repo "$reponame" "$reponame"
+  git config lfs.deltatransfers true
+
+  git lfs track "*.dat"
+  head -c 65536 /dev/urandom > a.dat
+  base_oid="$(shasum -a 256 a.dat | cut -f 1 -d " ")"
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  base=".git/lfs/objects/${base_oid:0:2}/${base_oid:2:2}/$base_oid"
+  chmod u+w "$base"
+  head -c 65536 /dev/urandom > "$base"
+
+  printf "a small change" >> a.dat
+  git add a.dat
+  git commit -m "change a.dat"
+
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  grep "xfer: not using delta base \"$base_oid\": expected OID $base_oid" push.log
+  grep "xfer: no local delta base" push.log
+  assert_server_object "$reponame" "$(shasum -a 256 a.dat | cut -f 1 -d " ")"
+)
+end_test
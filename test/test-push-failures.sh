@@ -128,3 +128,33 @@ begin_test "push: upload file with api 500"
   push_fail_test "status-batch-500"
 )
 end_test
+
+begin_test "push: retries statuses in lfs.transfer.retriablestatuses"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-retriablestatuses"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "status-storage-422" > bad.dat
+  git add .gitattributes bad.dat
+  git commit -m "add bad.dat"
+  oid="$(calc_oid "status-storage-422")"
+
+  git config lfs.transfer.retriablestatuses "422, 50x"
+  git config lfs.transfer.maxretries 1
+
+  set +e
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  res="${PIPESTATUS[0]}"
+  set -e
+
+  [ "$res" != "0" ]
+  grep "WARNING: ignoring invalid HTTP status codes in lfs.transfer.retriablestatuses: 50x" push.log
+  grep "tq: enqueue retry #1 for \"$oid\"" push.log
+  grep "tq: refusing to retry \"$oid\", too many retries after client errors (1)" push.log
+  refute_server_object "$reponame" "$oid"
+)
+end_test
@@ -0,0 +1,65 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "push: resume an interrupted push"
+(
+  set -e
+
+  reponame="push-resume"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  printf "b" > b.dat
+  # this string tells the server to fail the first upload of this object
+  printf "status-storage-500-once" > c.dat
+  git add .gitattributes a.dat b.dat c.dat
+  git commit -m "add files"
+
+  set +e
+  GIT_TRACE=1 git lfs push origin master > push.log 2>&1
+  res=$?
+  set -e
+  cat push.log
+  [ "$res" = "2" ]
+  grep "tq: sending batch of size 3" push.log
+  [ "1" -eq "$(ls .git/lfs/tq | wc -l)" ]
+
+  GIT_TRACE=1 git lfs push origin master 2>&1 | tee push.log
+  [ "2" -eq "$(grep -c "already transferred by an earlier run" push.log)" ]
+  grep "tq: sending batch of size 1" push.log
+  grep "(1 of 1 files, 2 skipped)" push.log
+  assert_server_object "$reponame" "$(calc_oid "status-storage-500-once")"
+
+  # the journal is removed once everything has been pushed
+  [ "0" -eq "$(ls .git/lfs/tq | wc -l)" ]
+)
+end_test
+
+begin_test "push: --no-resume pushes everything again"
+(
+  set -e
+
+  reponame="push-no-resume"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  printf "status-storage-500-once" > c.dat
+  git add .gitattributes a.dat c.dat
+  git commit -m "add files"
+
+  set +e
+  git lfs push origin master 2>&1 | tee push.log
+  set -e
+  [ "1" -eq "$(ls .git/lfs/tq | wc -l)" ]
+
+  GIT_TRACE=1 git lfs push --no-resume origin master 2>&1 | tee push.log
+  [ "0" -eq "$(grep -c "already transferred by an earlier run" push.log)" ]
+  grep "tq: sending batch of size 2" push.log
+  [ "0" -eq "$(ls .git/lfs/tq | wc -l)" ]
+)
+end_test
@@ -357,6 +357,52 @@ begin_test "push object id(s)"
 )
 end_test
 
+begin_test "push --object-id from stdin"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-object-id-stdin"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "stdin a" > a.dat
+  echo "stdin b" > b.dat
+  git add .gitattributes a.dat b.dat
+  git commit -m "add a.dat and b.dat"
+
+  oida="$(calc_oid "stdin a\n")"
+  oidb="$(calc_oid "stdin b\n")"
+  missing="$(calc_oid "not stored locally")"
+
+  printf "%s\n\n%s 8 b.dat\n" "$oida" "$oidb" |
+    git lfs push --object-id origin - 2>&1 | tee push.log
+  grep "(2 of 2 files)" push.log
+  assert_server_object "$reponame" "$oida"
+  assert_server_object "$reponame" "$oidb"
+
+  set +e
+  printf "%s\n%s\n" "$missing" "$oida" |
+    git lfs push --object-id origin - 2>&1 | tee push.log
+  res=${PIPESTATUS[1]}
+  set -e
+  if [ "$res" = "0" ]; then
+    echo "push with a missing object should fail"
+    exit 1
+  fi
+  grep "Unable to push 1 object missing from .git/lfs/objects:" push.log
+  grep "$missing" push.log
+  refute_server_object "$reponame" "$missing"
+
+  set +e
+  echo "not-an-oid" | git lfs push --object-id origin - 2>&1 | tee push.log
+  res=${PIPESTATUS[1]}
+  set -e
+  [ "$res" = "2" ]
+  grep 'invalid object ID on line 1: "not-an-oid"' push.log
+)
+end_test
+
 begin_test "push modified files"
 (
   set -e
@@ -487,7 +533,7 @@ begin_test "push ambiguous branch name"
 )
 end_test
 
-begin_test "push (retry with expired actions)"
+begin_test "push (refresh expired actions)"
 (
   set -e
 
@@ -507,7 +553,9 @@ begin_test "push (retry with expired actions)"
 
   GIT_TRACE=1 git push origin master 2>&1 | tee push.log
 
-  [ "1" -eq "$(grep -c "expired, retrying..." push.log)" ]
+  # the queue asks for fresh actions before the adapter sees expired ones
+  [ "1" -eq "$(grep -c "tq: refreshing expired actions" push.log)" ]
+  [ "0" -eq "$(grep -c "expired, retrying..." push.log)" ]
   grep "(1 of 1 files)" push.log
 )
 end_test
@@ -572,3 +620,273 @@ begin_test "push (with invalid object size)"
   refute_server_object "$reponame" "$(calc_oid "$contents")"
 )
 end_test
+
+begin_test "push with metrics"
+(
+  set -e
+
+  reponame="push-with-metrics"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "metrics a" > a.dat
+  echo "metrics bb" > b.dat
+  git add .gitattributes a.dat b.dat
+  git commit -m "add dat files"
+
+  GIT_LFS_METRICS_FILE="$TRASHDIR/push-metrics.json" git lfs push origin master 2>&1 | tee push.log
+  grep "(2 of 2 files)" push.log
+
+  cat "$TRASHDIR/push-metrics.json"
+  grep '"version":1' "$TRASHDIR/push-metrics.json"
+  grep '"command":"push"' "$TRASHDIR/push-metrics.json"
+  grep '"scan":{"count":' "$TRASHDIR/push-metrics.json"
+  grep '"batch":{"count":1,' "$TRASHDIR/push-metrics.json"
+  grep '"transfer":{"count":1,' "$TRASHDIR/push-metrics.json"
+  grep '"objects":2' "$TRASHDIR/push-metrics.json"
+  grep '"bytes":21' "$TRASHDIR/push-metrics.json"
+  grep '"concurrent_transfers":' "$TRASHDIR/push-metrics.json"
+
+  # commands which exit with an error still write their metrics
+  rm "$TRASHDIR/push-metrics.json"
+  set +e
+  GIT_LFS_METRICS_FILE="$TRASHDIR/push-metrics.json" git lfs push not-a-remote master 2>&1 | tee push.log
+  res="${PIPESTATUS[0]}"
+  set -e
+  [ "$res" = "2" ]
+  grep "Invalid remote name" push.log
+  grep '"command":"push"' "$TRASHDIR/push-metrics.json"
+
+  # no metrics without the environment variable
+  rm "$TRASHDIR/push-metrics.json"
+  git lfs push origin master
+  [ ! -e "$TRASHDIR/push-metrics.json" ]
+)
+end_test
+
+begin_test "push reports missing objects together"
+(
+  set -e
+
+  reponame="push-missing-objects"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "missing a" > a.dat
+  printf "present" > c.dat
+  git add .gitattributes a.dat c.dat
+  git commit -m "add a.dat"
+  commita="$(git rev-parse HEAD)"
+
+  printf "missing b" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+  commitb="$(git rev-parse HEAD)"
+
+  oida="$(calc_oid "missing a")"
+  oidb="$(calc_oid "missing b")"
+  rm a.dat b.dat
+  rm ".git/lfs/objects/${oida:0:2}/${oida:2:2}/$oida"
+  rm ".git/lfs/objects/${oidb:0:2}/${oidb:2:2}/$oidb"
+
+  set +e
+  git lfs push origin master > push.log 2>&1
+  res=$?
+  set -e
+  cat push.log
+  [ "2" = "$res" ]
+
+  [ "1" -eq "$(grep -c "Unable to push" push.log)" ]
+  grep "Unable to push 2 objects missing from .git/lfs/objects:" push.log
+  grep "  a.dat ($oida)" push.log
+  grep "referenced by commit $commita" push.log
+  grep "  b.dat ($oidb)" push.log
+  grep "referenced by commit $commitb" push.log
+  grep "git lfs fetch --all <remote>" push.log
+
+  # everything else is still pushed
+  assert_server_object "$reponame" "$(calc_oid "present")"
+  refute_server_object "$reponame" "$oida"
+)
+end_test
+
+begin_test "push writes the transfer log"
+(
+  set -e
+
+  reponame="push-transfer-log"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "transfer log" > a.dat
+  oid="$(calc_oid "transfer log")"
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  GIT_LFS_TRANSFER_LOG="$TRASHDIR/transfer.log" git lfs push origin master
+  cat "$TRASHDIR/transfer.log"
+  [ "1" -eq "$(grep -c "\"oid\":\"$oid\"" "$TRASHDIR/transfer.log")" ]
+  grep "\"size\":12," "$TRASHDIR/transfer.log"
+  grep "\"direction\":\"upload\"" "$TRASHDIR/transfer.log"
+  grep "\"outcome\":\"completed\"" "$TRASHDIR/transfer.log"
+
+  # lfs.transfer.log does the same, and the log is appended to.
+  rm -rf .git/lfs/objects
+  git config lfs.transfer.log "$TRASHDIR/transfer.log"
+  git lfs fetch origin master
+  cat "$TRASHDIR/transfer.log"
+  [ "2" -eq "$(grep -c "\"oid\":\"$oid\"" "$TRASHDIR/transfer.log")" ]
+  grep "\"direction\":\"download\"" "$TRASHDIR/transfer.log"
+)
+end_test
+
+begin_test "push refuses files locked by someone else"
+(
+  set -e
+
+  reponame="push-locked-by-other"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  git add .gitattributes
+  git commit -m "initial commit"
+  git push origin master
+
+  printf "theirs" > theirs_locked.dat
+  printf "ours" > ours_locked.dat
+  oid="$(calc_oid "theirs")"
+
+  mkdir "$TRASHDIR/other-creds"
+  printf "other:pass" > "$TRASHDIR/other-creds/127.0.0.1"
+  CREDSDIR="$TRASHDIR/other-creds" GITLFSLOCKSENABLED=1 \
+    git -c user.name="Other User" -c user.email="other@example.com" \
+    lfs lock theirs_locked.dat
+  GITLFSLOCKSENABLED=1 git lfs lock ours_locked.dat
+
+  git add theirs_locked.dat ours_locked.dat
+  git commit -m "add locked files"
+
+  set +e
+  GITLFSLOCKSENABLED=1 git lfs push origin master > push.log 2>&1
+  res=$?
+  set -e
+  cat push.log
+  [ "2" = "$res" ]
+
+  grep "Unable to push 1 file locked by other users:" push.log
+  grep "theirs_locked.dat  *Other User <other@example.com>  *just now" push.log
+  [ "0" -eq "$(grep -c "ours_locked.dat" push.log)" ]
+  grep "push again with --force-push-locked" push.log
+  refute_server_object "$reponame" "$oid"
+
+  GITLFSLOCKSENABLED=1 git lfs push --force-push-locked origin master 2>&1 | tee push.log
+  grep "theirs_locked.dat" push.log
+  grep "Pushing anyway, because of --force-push-locked." push.log
+  assert_server_object "$reponame" "$oid"
+)
+end_test
+
+begin_test "push --all verifies locks once"
+(
+  set -e
+
+  reponame="push-all-verify-locks"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  git checkout -b other
+  printf "b" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+
+  GIT_TRACE=1 GITLFSLOCKSENABLED=1 git lfs push --all origin master other 2>&1 | tee push.log
+  [ "1" -eq "$(grep -c "HTTP: POST .*/locks/verify" push.log)" ]
+  assert_server_object "$reponame" "$(calc_oid "b")"
+)
+end_test
+
+begin_test "push skips lock verification on servers without it"
+(
+  set -e
+
+  reponame="push-unverifiable-locks"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git checkout -b unverifiable
+  git lfs track "*.dat"
+  printf "unverifiable" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  GIT_TRACE=1 GITLFSLOCKSENABLED=1 git lfs push origin unverifiable 2>&1 | tee push.log
+  grep "doesn't support lock verification, skipping it" push.log
+  assert_server_object "$reponame" "$(calc_oid "unverifiable")"
+)
+end_test
+
+begin_test "push with lfs.transfer.verifyupload refuses corrupt objects"
+(
+  set -e
+
+  reponame="push-verify-upload"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "hello" > a.dat
+  oid="$(calc_oid "hello")"
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  # corrupt the object, keeping its size
+  path=".git/lfs/objects/${oid:0:2}/${oid:2:2}/$oid"
+  chmod u+w "$path"
+  printf "jello" > "$path"
+
+  git config lfs.transfer.verifyupload true
+
+  set +e
+  git lfs push origin master > push.log 2>&1
+  res=$?
+  set -e
+  cat push.log
+  [ "2" = "$res" ]
+
+  grep "Error verifying a.dat ($oid) before uploading it" push.log
+  refute_server_object "$reponame" "$oid"
+)
+end_test
+
+begin_test "push with --endpoint"
+(
+  set -e
+
+  reponame="push-with-endpoint"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  contents="push with endpoint"
+  contents_oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  # origin points nowhere, so the objects can only reach the endpoint.
+  git remote set-url origin "http://127.0.0.1:1/nowhere"
+
+  git lfs push --endpoint "$GITSERVER/$reponame.git/info/lfs" origin master 2>&1 | tee push.log
+  grep "(1 of 1 files)" push.log
+  assert_server_object "$reponame" "$contents_oid"
+)
+end_test
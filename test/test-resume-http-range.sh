@@ -37,6 +37,7 @@ begin_test "resume-http-range"
   # now fetch again, this should try to resume and server should send remainder
   # this time (it does not cut short when Range is requested)
   GIT_TRACE=1 git lfs fetch 2>&1 | tee fetchresume.log
+  grep "tq: resuming download of \"$contents_oid\" from byte" fetchresume.log
   grep "xfer: server accepted resume" fetchresume.log
   assert_local_object "$contents_oid" "${#contents}"
 
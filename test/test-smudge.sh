@@ -233,3 +233,107 @@ begin_test "smudge skip download failure"
 
 )
 end_test
+
+begin_test "smudge with lfs.smudge.onerror"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-onerror"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" smudge-onerror
+
+  git lfs track "*.dat"
+  echo "smudge a" > a.dat
+  echo "smudge b" > b.dat
+  git add .gitattributes a.dat b.dat
+  git commit -m "add a.dat and b.dat"
+  git push origin master
+
+  url="$(git config remote.origin.url)"
+  a_oid="$(calc_oid "smudge a\n")"
+  b_oid="$(calc_oid "smudge b\n")"
+  a_pointer="$(pointer "$a_oid" 9)"
+
+  # the endpoint is dead, and the objects aren't local
+  rm -rf .git/lfs/objects a.dat b.dat
+  git remote set-url origin httpnope://nope.com/nope
+
+  git config lfs.smudge.onerror pointer
+  git checkout -- a.dat b.dat
+
+  [ "$a_pointer" = "$(cat a.dat)" ]
+  [ "$(pointer "$b_oid" 9)" = "$(cat b.dat)" ]
+  grep "^$a_oid 9 a.dat$" .git/lfs/incomplete
+  grep "^$b_oid 9 b.dat$" .git/lfs/incomplete
+
+  git lfs status | tee status.log
+  grep "Git LFS files not downloaded:" status.log
+  grep "a.dat (9 B, missing)" status.log
+  grep "b.dat (9 B, missing)" status.log
+
+  rm a.dat
+  git config lfs.smudge.onerror placeholder
+  git checkout -- a.dat
+
+  grep "placeholder for a Git LFS object" a.dat
+  grep "oid sha256:$a_oid" a.dat
+
+  # the placeholder cleans back to its pointer, so it isn't a change
+  [ "$a_pointer" = "$(git lfs clean a.dat < a.dat)" ]
+  [ -z "$(git status --porcelain a.dat)" ]
+
+  # the objects are downloaded once the endpoint is back, and replace the
+  # pointer and the placeholder
+  git remote set-url origin "$url"
+  git lfs pull
+
+  [ "smudge a" = "$(cat a.dat)" ]
+  [ "smudge b" = "$(cat b.dat)" ]
+  [ ! -e .git/lfs/incomplete ]
+
+  git lfs status | tee status.log
+  [ "0" = "$(grep -c "not downloaded" status.log)" ]
+
+  # the default still fails the checkout
+  rm -rf .git/lfs/objects a.dat
+  git remote set-url origin httpnope://nope.com/nope
+  git config --unset lfs.smudge.onerror
+
+  set +e
+  git checkout -- a.dat 2>&1 | tee checkout.log
+  checkout_exit="${PIPESTATUS[0]}"
+  set -e
+  [ "$checkout_exit" != "0" ]
+  [ ! -e .git/lfs/incomplete ]
+)
+end_test
+
+begin_test "checkout replaces placeholders left by smudge"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-onerror-checkout"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" smudge-onerror-checkout
+
+  git lfs track "*.dat"
+  echo "checkout a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  url="$(git config remote.origin.url)"
+  rm -rf .git/lfs/objects a.dat
+  git remote set-url origin httpnope://nope.com/nope
+  git -c lfs.smudge.onerror=placeholder checkout -- a.dat
+  grep "placeholder for a Git LFS object" a.dat
+
+  git remote set-url origin "$url"
+  git lfs fetch
+  git lfs checkout
+
+  [ "checkout a" = "$(cat a.dat)" ]
+  [ ! -e .git/lfs/incomplete ]
+  [ -z "$(git status --porcelain a.dat)" ]
+)
+end_test
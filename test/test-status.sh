@@ -25,6 +25,10 @@ begin_test "status"
 
   expected="On branch master
 
+Git LFS objects in master:
+
+	file1.dat (10 B)
+
 Git LFS objects to be committed:
 
 	file2.dat (11 B)
@@ -32,7 +36,7 @@ Git LFS objects to be committed:
 
 Git LFS objects not staged for commit:
 
-	file1.dat"
+	file1.dat (11 B, missing)"
 
   [ "$expected" = "$(git lfs status)" ]
 )
@@ -67,6 +71,88 @@ A  file3.dat 11"
 )
 end_test
 
+begin_test "status --remote"
+(
+  set -e
+
+  reponame="status-remote"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "pushed" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  # Upload the object of b.dat, but not the commit which adds it.
+  printf "uploaded" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+  git lfs push origin master
+
+  printf "unpushed" > c.dat
+  git add c.dat
+  git commit -m "add c.dat"
+
+  # Backdate d.dat, so that Git doesn't clean it again, recreating its object.
+  printf "staged" > d.dat
+  touch -t 200001010000 d.dat
+  git add d.dat
+  oid="$(calc_oid "staged")"
+  rm ".git/lfs/objects/${oid:0:2}/${oid:2:2}/$oid"
+
+  # Stage a change to a.dat, then undo it in the working tree, so that the
+  # working tree's a.dat is stored as the uploaded object again.
+  printf "changed" > a.dat
+  git add a.dat
+  printf "pushed" > a.dat
+
+  git lfs status --remote | tee status.log
+  grep "^Git LFS objects in master:$" status.log
+  [ "2" -eq "$(grep -c "^	a.dat (6 B, uploaded)$" status.log)" ]
+  [ "2" -eq "$(grep -c "^	b.dat (8 B, uploaded)$" status.log)" ]
+  [ "2" -eq "$(grep -c "^	c.dat (8 B, local-only)$" status.log)" ]
+  grep "^	d.dat (6 B, missing)$" status.log
+
+  git lfs status --remote --json | tee status.json
+  grep "{\"section\":\"head\",\"name\":\"b.dat\",\"oid\":\"$(calc_oid "uploaded")\",\"size\":8,\"state\":\"uploaded\"}" status.json
+
+  # Without --remote, only the missing object is called out.
+  git lfs status | tee status.log
+  grep "^	b.dat (8 B)$" status.log
+  grep "^	c.dat (8 B)$" status.log
+  grep "^	d.dat (6 B, missing)$" status.log
+)
+end_test
+
+begin_test "status --json"
+(
+  set -e
+
+  mkdir repo-json
+  cd repo-json
+  git init
+  git lfs track "*.dat"
+  printf "some data" > file1.dat
+  git add file1.dat
+  git commit -m "file1.dat"
+
+  printf "other data" > file1.dat
+  printf "file2 data" > file2.dat
+  git add file2.dat
+
+  oid1="$(calc_oid "some data")"
+  oid2="$(calc_oid "file2 data")"
+  oid3="$(calc_oid "other data")"
+  expected="[{\"section\":\"head\",\"name\":\"file1.dat\",\"oid\":\"$oid1\",\"size\":9,\"state\":\"local\"},{\"section\":\"staged\",\"status\":\"A\",\"name\":\"file2.dat\",\"oid\":\"$oid2\",\"size\":10,\"state\":\"local\"},{\"section\":\"unstaged\",\"status\":\"M\",\"name\":\"file1.dat\",\"oid\":\"$oid3\",\"size\":10,\"state\":\"missing\"}]"
+  [ "$expected" = "$(git lfs status --json)" ]
+
+  git lfs status --json --porcelain 2>&1 | tee status.log
+  grep "Cannot use --porcelain and --json together." status.log
+)
+end_test
+
 
 begin_test "status: outside git repository"
 (
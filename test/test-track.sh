@@ -45,6 +45,31 @@ begin_test "track"
 )
 end_test
 
+begin_test "track --json and --porcelain"
+(
+  set -e
+
+  reponame="track-list-formats"
+  git init $reponame
+  cd $reponame
+
+  mkdir -p a/b
+  printf "*.txt text\n*.jpg filter=lfs diff=lfs merge=lfs -text\n*.psd filter=lfs diff=lfs merge=lfs -text lockable\n" > .gitattributes
+  echo "*.gif filter=lfs -text" > a/.gitattributes
+  printf "# pngs\n*.png filter=lfs -text\n" > a/b/.gitattributes
+
+  git lfs track --porcelain > porcelain.log
+  cat porcelain.log
+  printf "*.jpg\t.gitattributes\t2\tfalse\n*.psd\t.gitattributes\t3\ttrue\na/*.gif\ta/.gitattributes\t1\tfalse\na/b/*.png\ta/b/.gitattributes\t2\tfalse\n" > expected
+  diff -u expected porcelain.log
+
+  git lfs track --json > json.log
+  cat json.log
+  expected='[{"pattern":"*.jpg","source":".gitattributes","line":2,"lockable":false},{"pattern":"*.psd","source":".gitattributes","line":3,"lockable":true},{"pattern":"a/*.gif","source":"a/.gitattributes","line":1,"lockable":false},{"pattern":"a/b/*.png","source":"a/b/.gitattributes","line":2,"lockable":false}]'
+  [ "$expected" = "$(cat json.log)" ]
+)
+end_test
+
 begin_test "track --verbose"
 (
   set -e
@@ -75,14 +100,199 @@ begin_test "track --dry-run"
   git add foo.dat
 
   git lfs track --dry-run "foo.dat" 2>&1 > track.log
-  grep "Tracking foo.dat" track.log
-  grep "Git LFS: touching foo.dat" track.log
+  cat track.log
+  grep "Would track foo.dat" track.log
+  grep "    foo.dat filter=lfs diff=lfs merge=lfs -text" track.log
+  grep -A1 "Mark as modified:" track.log | grep "    foo.dat"
+  [ ! -e .gitattributes ]
 
   git status --porcelain 2>&1 > status.log
   grep "A  foo.dat" status.log
 )
 end_test
 
+begin_test "track --dry-run with forbidden files"
+(
+  set -e
+
+  reponame="track_dry_run_forbidden"
+  mkdir "$reponame"
+  cd "$reponame"
+  git init
+
+  touch .gitignore foo.dat
+  git add .gitignore foo.dat
+
+  git lfs track --dry-run "*" 2>&1 > track.log
+  cat track.log
+  grep "Would track \*" track.log
+  grep "    \* filter=lfs diff=lfs merge=lfs -text" track.log
+  grep "    /.gitignore !filter !diff !merge !text" track.log
+  grep "    /.gitattributes !filter !diff !merge !text" track.log
+  grep "  Exclude forbidden files:" track.log
+  grep "  Mark as modified:" track.log
+  grep "    foo.dat" track.log
+  [ "1" -eq "$(grep -c "^    .gitignore" track.log)" ]
+  [ ! -e .gitattributes ]
+
+  git lfs track --dry-run ".gitig*" 2>&1 > track.log
+  cat track.log
+  grep "Would not track .gitig\*, it matches forbidden files:" track.log
+  grep "    .gitignore" track.log
+  grep "To track these files, modify .gitattributes manually." track.log
+  [ ! -e .gitattributes ]
+)
+end_test
+
+begin_test "track --lockable"
+(
+  set -e
+
+  reponame="track_lockable"
+  mkdir "$reponame"
+  cd "$reponame"
+  git init
+
+  git lfs track --lockable "*.psd" | grep "Tracking \*.psd"
+  grep "^\*.psd filter=lfs diff=lfs merge=lfs lockable -text$" .gitattributes
+
+  git lfs track --lockable "*.psd" | grep "*.psd already supported"
+  [ "1" -eq "$(grep -c "\*.psd" .gitattributes)" ]
+
+  # tracking an existing pattern as lockable updates its line in place
+  git lfs track "*.png" "*.jpg"
+  git lfs track --lockable "*.png" | grep "Made \*.png lockable"
+  grep "^\*.png filter=lfs diff=lfs merge=lfs lockable -text$" .gitattributes
+  [ "1" -eq "$(grep -c "\*.png" .gitattributes)" ]
+  grep "^\*.jpg filter=lfs diff=lfs merge=lfs -text$" .gitattributes
+
+  out=$(git lfs track)
+  echo "$out" | grep "    \*.psd \[lockable\] (.gitattributes)"
+  echo "$out" | grep "    \*.png \[lockable\] (.gitattributes)"
+  echo "$out" | grep "    \*.jpg (.gitattributes)"
+
+  git lfs track --not-lockable "*.psd" | grep "Made \*.psd not lockable"
+  grep "^\*.psd filter=lfs diff=lfs merge=lfs -text$" .gitattributes
+  git lfs track --not-lockable "*.psd" | grep "*.psd already supported"
+  git lfs track | grep "    \*.psd (.gitattributes)"
+
+  git lfs track --dry-run --lockable "*.jpg" | grep "Would make \*.jpg lockable in .gitattributes"
+  grep "^\*.jpg filter=lfs diff=lfs merge=lfs -text$" .gitattributes
+)
+end_test
+
+begin_test "track --filename"
+(
+  set -e
+
+  reponame="track_filename"
+  mkdir "$reponame"
+  cd "$reponame"
+  git init
+
+  # "weird f.bin" would match "weird [file]*.bin" as a pattern.
+  touch "weird [file]*.bin" "weird f.bin"
+  git add "weird [file]*.bin" "weird f.bin"
+
+  git lfs track --verbose --filename "weird [file]*.bin" > track.log
+  cat track.log
+  grep -F 'Tracking weird \[file\]\*.bin' track.log
+  grep -F 'touching weird [file]*.bin' track.log
+  [ "0" -eq "$(grep -c "touching weird f.bin" track.log)" ]
+
+  grep -F 'weird[[:space:]]\[file\]\*.bin filter=lfs diff=lfs merge=lfs -text' .gitattributes
+  [ "1" -eq "$(grep -c "filter=lfs" .gitattributes)" ]
+
+  git check-attr filter -- "weird [file]*.bin" | grep "filter: lfs"
+  git check-attr filter -- "weird f.bin" | grep "filter: unspecified"
+
+  git lfs track --filename "weird [file]*.bin" | grep "already supported"
+  [ "1" -eq "$(grep -c "filter=lfs" .gitattributes)" ]
+
+  git lfs track --filename "#comment.bin" "!negated.bin"
+  grep -F '\#comment.bin filter=lfs' .gitattributes
+  grep -F '\!negated.bin filter=lfs' .gitattributes
+  git check-attr filter -- "#comment.bin" | grep "filter: lfs"
+  git check-attr filter -- "!negated.bin" | grep "filter: lfs"
+)
+end_test
+
+begin_test "track --stdin and --from-file"
+(
+  set -e
+
+  reponame="track_stdin"
+  mkdir "$reponame"
+  cd "$reponame"
+  git init
+
+  touch a.dat .gitignore
+  git add a.dat .gitignore
+
+  printf "# images\n*.jpg\n\n  *.png\n*.dat\n" | git lfs track --stdin --verbose > track.log
+  cat track.log
+  grep "Tracking \*.jpg" track.log
+  grep "Tracking \*.png" track.log
+  grep "touching a.dat" track.log
+  [ "3" -eq "$(grep -c "filter=lfs" .gitattributes)" ]
+  [ "0" -eq "$(grep -c "images" .gitattributes)" ]
+
+  printf "*.jpg\n*.gif\n.gitig*\n" > patterns
+  git lfs track --from-file patterns > track.log
+  cat track.log
+  grep "*.jpg already supported" track.log
+  grep "Tracking \*.gif" track.log
+  grep "Pattern .gitig\* matches forbidden file .gitignore" track.log
+  [ "4" -eq "$(grep -c "filter=lfs" .gitattributes)" ]
+
+  # no patterns means nothing to track, rather than listing them
+  printf "# nothing\n" | git lfs track --stdin > track.log
+  [ "0" -eq "$(grep -c "Listing tracked paths" track.log)" ]
+
+  git lfs track --from-file missing 2>&1 | tee track.log
+  grep "Error opening missing" track.log
+)
+end_test
+
+begin_test "track --patterns-from with duplicates"
+(
+  set -e
+
+  reponame="track_patterns_from"
+  mkdir "$reponame"
+  cd "$reponame"
+  git init
+
+  touch a.dat b.bin
+  git add a.dat b.bin
+
+  printf "*.dat\n*.bin\n*.dat\n" > patterns
+
+  git lfs track --dry-run --patterns-from=patterns > track.log
+  cat track.log
+  grep -A1 "Would track \*.dat" track.log | grep "Add to .gitattributes"
+  grep -A1 "Mark as modified:" track.log | grep "    a.dat"
+  grep -A1 "Mark as modified:" track.log | grep "    b.bin"
+  [ "1" -eq "$(grep -c "Would track \*.dat" track.log)" ]
+  [ "1" -eq "$(grep -c "*.dat already supported" track.log)" ]
+  [ ! -e .gitattributes ]
+
+  git lfs track --patterns-from=patterns > track.log
+  cat track.log
+  [ "1" -eq "$(grep -c "Tracking \*.dat" track.log)" ]
+  [ "1" -eq "$(grep -c "*.dat already supported" track.log)" ]
+  [ "1" -eq "$(grep -c "\*.dat" .gitattributes)" ]
+  [ "2" -eq "$(grep -c "filter=lfs" .gitattributes)" ]
+
+  # --patterns-from is another name for --from-file, so they can't disagree.
+  git lfs track --from-file=patterns --patterns-from=patterns > track.log
+  grep "*.dat already supported" track.log
+
+  git lfs track --from-file=patterns --patterns-from=other 2>&1 | tee track.log
+  grep "Cannot use --from-file and --patterns-from with different files." track.log
+)
+end_test
+
 begin_test "track directory"
 (
   set -e
@@ -102,6 +312,53 @@ begin_test "track directory"
   assert_pointer "master" "foo bar/b" "0263829989b6fd954f72baaf2fc64bc2e2f01d692d4de72986ea808f6e99813f" 2
 )
 
+begin_test "track skips ignored and excluded directories"
+(
+  set -e
+
+  reponame="track-skip-dirs"
+  git init $reponame
+  cd $reponame
+
+  mkdir -p a node_modules/pkg build
+  echo "*.gif filter=lfs -text" > a/.gitattributes
+  echo "*.png filter=lfs -text" > node_modules/pkg/.gitattributes
+  echo "*.mov filter=lfs -text" > build/.gitattributes
+  echo "build/" > .gitignore
+
+  out=$(git lfs track)
+  echo "$out"
+  echo "$out" | grep "*.gif ($(native_path_escaped "a/.gitattributes"))"
+  echo "$out" | grep "*.png ($(native_path_escaped "node_modules/pkg/.gitattributes"))"
+  [ "0" -eq "$(echo "$out" | grep -c "\*.mov")" ]
+
+  git config lfs.attributesexclude "node_modules"
+  out=$(git lfs track)
+  echo "$out"
+  echo "$out" | grep "*.gif ($(native_path_escaped "a/.gitattributes"))"
+  [ "0" -eq "$(echo "$out" | grep -c "\*.png")" ]
+)
+end_test
+
+begin_test "track skips submodules"
+(
+  set -e
+
+  reponame="track-skip-submodules"
+  git init $reponame
+  cd $reponame
+
+  git init sub
+  echo "*.sub filter=lfs -text" > sub/.gitattributes
+  echo "*.dat filter=lfs -text" > .gitattributes
+
+  out=$(git lfs track)
+  echo "$out"
+  echo "$out" | grep "*.dat (.gitattributes)"
+  [ "0" -eq "$(echo "$out" | grep -c "\*.sub")" ]
+)
+end_test
+
 begin_test "track without trailing linebreak"
 (
   set -e
@@ -122,6 +379,48 @@ begin_test "track without trailing linebreak"
 )
 end_test
 
+begin_test "track with CRLF line endings and a byte order mark"
+(
+  set -e
+
+  mkdir crlf-bom
+  cd crlf-bom
+  git init
+  printf "\xef\xbb\xbf*.mov filter=lfs -text\r\n*.txt text\r\n" > .gitattributes
+
+  git lfs track | grep "    \*.mov (.gitattributes)"
+  git lfs track "*.mov" | grep "*.mov already supported"
+
+  git lfs track "*.gif"
+  printf "\xef\xbb\xbf*.mov filter=lfs -text\r\n*.txt text\r\n*.gif filter=lfs diff=lfs merge=lfs -text\r\n" > expected
+  cmp expected .gitattributes
+
+  git lfs track --lockable "*.mov" | grep "Made \*.mov lockable"
+  printf "\xef\xbb\xbf*.mov filter=lfs lockable -text\r\n*.txt text\r\n*.gif filter=lfs diff=lfs merge=lfs -text\r\n" > expected
+  cmp expected .gitattributes
+)
+end_test
+
+begin_test "track with CRLF line endings and no final line ending"
+(
+  set -e
+
+  mkdir crlf-unterminated
+  cd crlf-unterminated
+  git init
+
+  printf "*.mov filter=lfs -text\r\n*.txt text" > .gitattributes
+  git lfs track "*.gif"
+  printf "*.mov filter=lfs -text\r\n*.txt text\r\n*.gif filter=lfs diff=lfs merge=lfs -text\r\n" > expected
+  cmp expected .gitattributes
+
+  # A final line ending cut in half is finished, not doubled.
+  printf "*.mov filter=lfs -text\r\n*.txt text\r" > .gitattributes
+  git lfs track "*.gif"
+  cmp expected .gitattributes
+)
+end_test
+
 begin_test "track outside git repo"
 (
   set -e
@@ -293,3 +592,461 @@ begin_test "track blocklisted files with glob"
 )
 end_test
 
+
+begin_test "track from subdirectory"
+(
+  set -e
+
+  reponame="track-from-subdirectory"
+  git init "$reponame"
+  cd "$reponame"
+
+  mkdir -p a/b
+  printf "x" > a/x.bin
+  printf "y" > a/b/y.bin
+  printf "z" > z.bin
+  git add a z.bin
+
+  cd a
+  git lfs track --dry-run "*.bin" 2>&1 | tee track.log
+  grep "Add to .gitattributes:" track.log
+  grep "^    a/\*.bin filter=lfs diff=lfs merge=lfs -text$" track.log
+  grep "^    x.bin$" track.log
+  [ "0" -eq "$(grep -c "y.bin" track.log)" ]
+
+  git lfs track "*.bin" | grep "Tracking \*.bin"
+  [ ! -e .gitattributes ]
+  grep "^a/\*.bin filter=lfs diff=lfs merge=lfs -text$" ../.gitattributes
+
+  [ "lfs" = "$(git check-attr filter x.bin | cut -d' ' -f3)" ]
+  [ "unspecified" = "$(git check-attr filter b/y.bin | cut -d' ' -f3)" ]
+  [ "unspecified" = "$(git check-attr filter ../z.bin | cut -d' ' -f3)" ]
+
+  cd b
+  [ "../*.bin already supported" = "$(git lfs track "../*.bin")" ]
+  cd ../..
+  [ "a/*.bin already supported" = "$(git lfs track "a/*.bin")" ]
+  [ "1" -eq "$(grep -c "bin" .gitattributes)" ]
+)
+end_test
+
+begin_test "track --local"
+(
+  set -e
+
+  reponame="track-local"
+  git init "$reponame"
+  cd "$reponame"
+
+  mkdir -p a/b
+  printf "x" > a/x.bin
+  printf "y" > a/b/y.bin
+  printf "z" > z.bin
+  git add a z.bin
+
+  cd a
+  git lfs track --local --dry-run "*.bin" 2>&1 | tee track.log
+  grep "Add to a/.gitattributes:" track.log
+  grep "^    \*.bin filter=lfs diff=lfs merge=lfs -text$" track.log
+  grep "^    x.bin$" track.log
+  grep "^    b/y.bin$" track.log
+
+  git lfs track --local "*.bin" | grep "Tracking \*.bin"
+  [ ! -e ../.gitattributes ]
+  grep "^\*.bin filter=lfs diff=lfs merge=lfs -text$" .gitattributes
+
+  [ "lfs" = "$(git check-attr filter x.bin | cut -d' ' -f3)" ]
+  [ "lfs" = "$(git check-attr filter b/y.bin | cut -d' ' -f3)" ]
+  [ "unspecified" = "$(git check-attr filter ../z.bin | cut -d' ' -f3)" ]
+
+  [ "*.bin already supported" = "$(git lfs track --local "*.bin")" ]
+  cd ..
+  [ "a/*.bin already supported" = "$(git lfs track "a/*.bin")" ]
+)
+end_test
+
+begin_test "track --touch and --no-touch"
+(
+  set -e
+
+  reponame="track-touch"
+  git init "$reponame"
+  cd "$reponame"
+
+  printf "a" > a.dat
+  printf "b" > b.bin
+  printf "c" > c.txt
+  touch -t 200001010000 a.dat b.bin c.txt
+  touch -t 200101010000 reference
+  git add a.dat b.bin c.txt
+
+  git lfs track --no-touch "*.dat" | grep "Tracking \*.dat"
+  [ -z "$(find a.dat -newer reference)" ]
+
+  git lfs track --dry-run --no-touch "*.bin" 2>&1 | tee track.log
+  grep "No files to mark as modified." track.log
+  [ -z "$(find b.bin -newer reference)" ]
+
+  git lfs track --touch "*.bin" | grep "Tracking \*.bin"
+  [ "b.bin" = "$(find b.bin -newer reference)" ]
+
+  git lfs track "*.txt" | grep "Tracking \*.txt"
+  [ "c.txt" = "$(find c.txt -newer reference)" ]
+
+  git lfs track --touch --no-touch "*.png" 2>&1 | tee track.log
+  grep "Cannot use --touch and --no-touch together." track.log
+  [ "0" -eq "$(grep -c "png" .gitattributes)" ]
+)
+end_test
+
+begin_test "track --verbose with many files"
+(
+  set -e
+
+  reponame="track-verbose-many-files"
+  git init "$reponame"
+  cd "$reponame"
+
+  for i in $(seq 1 1001); do
+    printf "$i" > "$i.dat"
+  done
+  git add *.dat
+
+  git lfs track --verbose "*.dat" 2>&1 | tee track.log
+  grep "Git LFS: touched 1,001 files in" track.log
+  [ "0" -eq "$(grep -c "touching" track.log)" ]
+)
+end_test
+
+begin_test "track notes files already committed without Git LFS"
+(
+  set -e
+
+  reponame="track-committed-files"
+  git init "$reponame"
+  cd "$reponame"
+
+  mkdir videos
+  printf "a" > videos/a.mp4
+  printf "b" > videos/b.mp4
+  printf "c" > c.mp4
+  printf "d" > d.mp4
+  printf "e" > e.mov
+  printf "clip" > Clip.MP4
+  git add videos c.mp4 d.mp4 e.mov Clip.MP4
+  git commit -m "add videos"
+
+  # Files renamed since they were committed are still noted.
+  git mv d.mp4 renamed.mov
+
+  git lfs track "*.mp4" 2>track.err | tee track.log
+  cat track.err
+  grep "Tracking \*.mp4" track.log
+  [ "0" -eq "$(grep -c "Note:" track.log)" ]
+  grep "Note: \*.mp4 matches 4 files already committed to Git without Git LFS:" track.err
+  grep "^    c.mp4$" track.err
+  grep "^    d.mp4$" track.err
+  grep "^    videos/a.mp4$" track.err
+  grep "^    ... and 1 more$" track.err
+  [ "0" -eq "$(grep -c "Clip.MP4" track.err)" ]
+
+  # Files which are already stored in Git LFS are not.
+  git lfs track "*.bin"
+  printf "pointer" > f.bin
+  git add .gitattributes f.bin
+  git commit -m "add f.bin"
+  git lfs track --dry-run "f.bin" 2>&1 | tee track.log
+  [ "0" -eq "$(grep -c "Note:" track.log)" ]
+
+  # Nor are files which only match the pattern in another directory.
+  cd videos
+  git lfs track "c.mp4" 2>&1 | tee track.log
+  [ "0" -eq "$(grep -c "Note:" track.log)" ]
+  cd ..
+
+  # core.ignorecase is followed, as git does for attributes. The rename of
+  # d.mp4 has been committed by now.
+  git config core.ignorecase true
+  git lfs track --dry-run "*.mp4x" "*.MP4" 2>&1 | tee track.log
+  [ "0" -eq "$(grep -c "Note: \*.mp4x" track.log)" ]
+  grep "Note: \*.MP4 matches 4 files already committed to Git without Git LFS:" track.log
+  grep "^    Clip.MP4$" track.log
+
+  # Listing doesn't look for committed files.
+  GIT_TRACE=1 git lfs track 2>&1 | tee track.log
+  [ "0" -eq "$(grep -c "ls-tree" track.log)" ]
+)
+end_test
+
+begin_test "track in a repository without commits"
+(
+  set -e
+
+  reponame="track-without-commits"
+  git init "$reponame"
+  cd "$reponame"
+
+  git lfs track "*.mp4" 2>&1 | tee track.log
+  grep "Tracking \*.mp4" track.log
+  [ "0" -eq "$(grep -c "Note:\|ls-tree\|fatal" track.log)" ]
+)
+end_test
+
+begin_test "track rejects absolute paths and paths outside the repository"
+(
+  set -e
+
+  reponame="track-invalid-paths"
+  git init "$reponame"
+  cd "$reponame"
+
+  git lfs track "$(pwd)/*.png" 2>&1 | tee track.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected track to fail for an absolute path"
+    exit 1
+  fi
+  grep "is an absolute path. Give paths relative to the repository instead, such as \*.png." track.log
+
+  git lfs track "../*.png" 2>&1 | tee track.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected track to fail outside the repository"
+    exit 1
+  fi
+  grep "../\*.png is outside of the repository." track.log
+
+  mkdir a
+  cd a
+  git lfs track --local "../*.png" 2>&1 | tee track.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected track --local to fail outside the directory"
+    exit 1
+  fi
+  grep "outside of the current directory" track.log
+  cd ..
+
+  # Nothing is added if any of the patterns is invalid.
+  git lfs track "*.jpg" "../*.png" 2>&1 | tee track.log || true
+  [ ! -e .gitattributes ] || [ "0" -eq "$(grep -c "\*.jpg" .gitattributes)" ]
+)
+end_test
+
+begin_test "track normalizes patterns"
+(
+  set -e
+
+  reponame="track-normalize-patterns"
+  git init "$reponame"
+  cd "$reponame"
+
+  git lfs track "./images/../*.png" 2>&1 | tee track.log
+  grep "Tracking \*.png" track.log
+  grep "^\*.png filter=lfs" .gitattributes
+
+  git lfs track "/*.bin" 2>&1 | tee track.log
+  grep "Note: the leading slash in /\*.bin anchors it to the root of the repository" track.log
+  grep "^/\*.bin filter=lfs" .gitattributes
+)
+end_test
+
+begin_test "track skips patterns covered by a broader pattern"
+(
+  set -e
+
+  reponame="track-covered-patterns"
+  git init "$reponame"
+  cd "$reponame"
+
+  git lfs track "*.png"
+  git lfs track "images/*.png" | tee track.log
+  grep "images/\*.png already supported by \*.png (.gitattributes)" track.log
+  [ "0" -eq "$(grep -c "images" .gitattributes)" ]
+
+  mkdir -p sub/dir
+  cd sub/dir
+  git lfs track "*.png" | tee track.log
+  grep "already supported by \*.png" track.log
+  cd ../..
+  [ "1" -eq "$(grep -c "png" .gitattributes)" ]
+
+  # A lockable pattern isn't covered by one which isn't lockable.
+  git lfs track --lockable "images/*.png" | tee track.log
+  grep "Tracking images/\*.png" track.log
+  grep "^images/\*.png filter=lfs diff=lfs merge=lfs lockable -text" .gitattributes
+)
+end_test
+
+begin_test "track --info"
+(
+  set -e
+
+  reponame="track-info"
+  git init "$reponame"
+  cd "$reponame"
+
+  rm -rf .git/info
+  mkdir -p fixtures
+  git lfs track --info "*.bin" | tee track.log
+  grep "Tracking \*.bin" track.log
+  grep "^\*.bin filter=lfs diff=lfs merge=lfs -text$" .git/info/attributes
+  [ ! -e .gitattributes ]
+
+  # Patterns given in subdirectories are relative to the root.
+  cd fixtures
+  git lfs track --info "*.dat" | tee track.log
+  grep "Tracking \*.dat" track.log
+  cd ..
+  grep "^fixtures/\*.dat filter=lfs" .git/info/attributes
+
+  git lfs track --info "*.bin" | tee track.log
+  grep "\*.bin already supported" track.log
+
+  git lfs track --porcelain | tee track.log
+  grep "^\*.bin	$(native_path_escaped ".git/info/attributes")	1	false" track.log
+  grep "^fixtures/\*.dat	" track.log
+
+  echo "fixture" > fixtures/a.dat
+  [ "lfs" = "$(git check-attr filter fixtures/a.dat | cut -d" " -f3)" ]
+
+  git lfs untrack "*.bin" | tee untrack.log
+  grep "Untracking \*.bin" untrack.log
+  [ "0" -eq "$(grep -c "bin" .git/info/attributes)" ]
+  grep "^fixtures/\*.dat filter=lfs" .git/info/attributes
+
+  git lfs track --info --local "*.zip" 2>&1 | tee track.log
+  grep "Cannot use --local and --info together." track.log
+)
+end_test
+
+begin_test "track --info in a worktree"
+(
+  set -e
+
+  ensure_git_version_isnt $VERSION_LOWER "2.5.0"
+
+  reponame="track-info-worktree"
+  git init "$reponame"
+  cd "$reponame"
+  echo "a" > a.txt
+  git add a.txt
+  git commit -m "initial commit"
+
+  git worktree add "$TRASHDIR/$reponame-worktree"
+  cd "$TRASHDIR/$reponame-worktree"
+
+  git lfs track --info "*.bin" | tee track.log
+  grep "Tracking \*.bin" track.log
+  grep "^\*.bin filter=lfs" "$TRASHDIR/$reponame/.git/info/attributes"
+  [ ! -e "$TRASHDIR/$reponame/.git/worktrees/$reponame-worktree/info/attributes" ]
+
+  echo "data" > a.bin
+  [ "lfs" = "$(git check-attr filter a.bin | cut -d" " -f3)" ]
+
+  git lfs track | tee track.log
+  grep "    \*.bin ($(native_path_escaped "../$reponame/.git/info/attributes"))" track.log
+
+  git lfs untrack "*.bin"
+  [ "0" -eq "$(grep -c "bin" "$TRASHDIR/$reponame/.git/info/attributes")" ]
+)
+end_test
+
+begin_test "track files which only look like forbidden files"
+(
+  set -e
+
+  reponame="track-similar-to-forbidden"
+  git init "$reponame"
+  cd "$reponame"
+
+  echo "book" > .gitbook.yaml
+  echo "config" > config.yaml
+  echo "sample" > .lfsconfig-sample
+  git add .gitbook.yaml config.yaml .lfsconfig-sample
+  git commit -m "initial commit"
+
+  git lfs track --verbose "*.yaml" 2>&1 | tee track.log
+  grep "Tracking \*.yaml" track.log
+  grep "touching .gitbook.yaml" track.log
+  grep "touching config.yaml" track.log
+  [ "0" -eq "$(grep -c "forbidden" track.log)" ]
+
+  git lfs track ".lfsconfig-*" 2>&1 | tee track.log
+  grep "Tracking .lfsconfig-\*" track.log
+  [ "0" -eq "$(grep -c "forbidden" track.log)" ]
+)
+end_test
+
+begin_test "track excludes forbidden files from patterns"
+(
+  set -e
+
+  reponame="track-excludes-forbidden"
+  git init "$reponame"
+  cd "$reponame"
+
+  mkdir sub
+  printf "*.txt text\n" > sub/.gitattributes
+  echo "ignored" > .gitignore
+  echo "data" > a.dat
+  echo "data" > sub/b.dat
+  git add .gitignore a.dat sub
+  git commit -m "initial commit"
+
+  git lfs track --verbose "*" 2>&1 | tee track.log
+  grep "Tracking \*" track.log
+  grep "  Excluded forbidden file .gitignore, which can't be stored in Git LFS" track.log
+  grep "  Excluded forbidden file sub/.gitattributes, which can't be stored in Git LFS" track.log
+  grep "touching a.dat" track.log
+  grep "touching sub/b.dat" track.log
+  [ "0" -eq "$(grep -c "touching .gitignore" track.log)" ]
+
+  grep "^\* filter=lfs diff=lfs merge=lfs -text$" .gitattributes
+  grep "^/.gitignore !filter !diff !merge !text$" .gitattributes
+  grep "^/sub/.gitattributes !filter !diff !merge !text$" .gitattributes
+  # .gitattributes isn't committed yet, but is excluded too.
+  grep "  Excluded forbidden file .gitattributes, which can't be stored in Git LFS" track.log
+  grep "^/.gitattributes !filter !diff !merge !text$" .gitattributes
+  [ "unspecified" = "$(git check-attr filter .gitattributes | cut -d" " -f3)" ]
+
+  [ "lfs" = "$(git check-attr filter a.dat | cut -d" " -f3)" ]
+  [ "unspecified" = "$(git check-attr filter .gitignore | cut -d" " -f3)" ]
+  [ "unspecified" = "$(git check-attr filter sub/.gitattributes | cut -d" " -f3)" ]
+)
+end_test
+
+begin_test "track warns about patterns in ignored directories"
+(
+  set -e
+
+  reponame="track-ignored-directory"
+  git init "$reponame"
+  cd "$reponame"
+
+  printf "build/\n*.log\n" > .gitignore
+  mkdir -p build src
+
+  git lfs track "build/*.bin" 2>&1 | tee track.log
+  grep "Tracking build/\*.bin" track.log
+  grep "Warning: build/ is ignored by .gitignore:1 (build/), so files matching build/\*.bin won't be added to Git, or stored in Git LFS." track.log
+  grep "^build/\*.bin filter=lfs diff=lfs merge=lfs -text$" .gitattributes
+
+  git lfs track --dry-run "/build/out/*.bin" 2>&1 | tee track.log
+  grep "Warning: build/out/ is ignored by .gitignore:1 (build/)" track.log
+
+  cd src
+  git lfs track "../build/*.dat" 2>&1 | tee track.log
+  grep "Warning: build/ is ignored by .gitignore:1 (build/)" track.log
+  cd ..
+
+  # Patterns which can match files elsewhere, or whose directories aren't
+  # ignored, aren't warned about.
+  git lfs track "*.bin" "src/*.bin" "*.log" 2>&1 | tee track.log
+  [ "0" -eq "$(grep -c "Warning" track.log)" ]
+
+  # Neither are patterns matching files which were added before they were
+  # ignored, since changes to them are still added.
+  printf "data" > build/a.iso
+  git add -f build/a.iso
+  git lfs track "build/*.iso" 2>&1 | tee track.log
+  [ "0" -eq "$(grep -c "Warning" track.log)" ]
+)
+end_test
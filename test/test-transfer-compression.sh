@@ -0,0 +1,65 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "transfer compression: server supports gzip"
+(
+  set -e
+
+  # this repo name is the indicator to the server to accept and send gzip
+  reponame="test-compression"
+  setup_remote_repo "$reponame"
+
+  clone_repo "$reponame" "$reponame"
+  git config lfs.transfer.compression gzip
+
+  git lfs track "*.dat"
+  for i in $(seq 1 2000); do echo "line $i of a very compressible export"; done > a.dat
+  oid="$(shasum -a 256 a.dat | cut -f 1 -d " ")"
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  grep "xfer: compressing upload of \"$oid\" with gzip" push.log
+  # the server checks the oid of the decompressed content
+  assert_server_object "$reponame" "$oid"
+
+  cd ..
+  GIT_TRACE=1 git clone -c lfs.transfer.compression=gzip "$GITSERVER/$reponame" "$reponame-clone" 2>&1 | tee clone.log
+  grep "xfer: decompressing download of \"$oid\" with gzip" clone.log
+
+  cd "$reponame-clone"
+  [ "$(shasum -a 256 a.dat | cut -f 1 -d " ")" = "$oid" ]
+  assert_local_object "$oid" "$(wc -c < a.dat | tr -d " ")"
+)
+end_test
+
+begin_test "transfer compression: server does not support compression"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-unsupported"
+  setup_remote_repo "$reponame"
+
+  clone_repo "$reponame" "$reponame"
+  git config lfs.transfer.compression gzip
+
+  git lfs track "*.dat"
+  for i in $(seq 1 2000); do echo "line $i of a very compressible export"; done > a.dat
+  oid="$(shasum -a 256 a.dat | cut -f 1 -d " ")"
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  # the server rejects compressed uploads
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  [ "0" -eq "$(grep -c "xfer: compressing upload" push.log)" ]
+  assert_server_object "$reponame" "$oid"
+
+  cd ..
+  GIT_TRACE=1 git clone -c lfs.transfer.compression=gzip "$GITSERVER/$reponame" "$reponame-clone" 2>&1 | tee clone.log
+  [ "0" -eq "$(grep -c "xfer: decompressing download" clone.log)" ]
+
+  cd "$reponame-clone"
+  [ "$(shasum -a 256 a.dat | cut -f 1 -d " ")" = "$oid" ]
+)
+end_test
@@ -50,3 +50,42 @@ begin_test "unlocking a lock without sufficient info"
   assert_server_lock $id
 )
 end_test
+
+begin_test "unlocking multiple files"
+(
+  set -e
+
+  reponame="unlock_multiple_files"
+  setup_remote_repo "remote_$reponame"
+  clone_repo "remote_$reponame" "clone_$reponame"
+
+  git lfs track "*.dat"
+  mkdir dir
+  for f in dir/f.dat dir/g.dat h.dat i.dat; do
+    printf "$f" > "$f"
+  done
+  git add .gitattributes dir h.dat i.dat
+  git commit -m "add files"
+  git push origin master
+
+  GITLFSLOCKSENABLED=1 git lfs lock --glob "dir/*.dat" h.dat | tee lock.log
+  [ "3" -eq "$(grep -c "was locked" lock.log)" ]
+
+  # i.dat isn't locked, so the server can't unlock it.
+  set +e
+  GITLFSLOCKSENABLED=1 git lfs unlock i.dat h.dat --glob "dir/*.dat" --force > unlock.log 2>&1
+  res=$?
+  set -e
+  cat unlock.log
+  [ "2" = "$res" ]
+
+  grep "Unable to unlock 'i.dat'" unlock.log
+  grep "'h.dat' was unlocked" unlock.log
+  grep "'dir/f.dat' was unlocked" unlock.log
+  grep "'dir/g.dat' was unlocked" unlock.log
+
+  for id in $(grep -oh "\((.*)\)" lock.log | tr -d "()"); do
+    refute_server_lock "$id"
+  done
+)
+end_test
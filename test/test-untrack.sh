@@ -23,6 +23,61 @@ begin_test "untrack"
 )
 end_test
 
+begin_test "untrack from nested attributes files"
+(
+  set -e
+
+  reponame="untrack-nested"
+  git init $reponame
+  cd $reponame
+
+  mkdir -p a/b
+  echo "*.png filter=lfs -text" > a/.gitattributes
+  printf "*.gif filter=lfs diff=lfs merge=lfs -text eol=lf\n*.bin filter=lfs diff=lfs merge=lfs -text\n" > a/b/.gitattributes
+  touch a/x.png a/b/y.gif a/b/z.bin
+  git add a
+  touch -t 200001010000 a/x.png a/b/y.gif a/b/z.bin
+  touch -t 200101010000 reference
+
+  git lfs untrack "a/*.png" | grep "Untracking a/\*.png"
+  [ "*.png -text" = "$(cat a/.gitattributes)" ]
+  [ a/x.png -nt reference ]
+  [ ! a/b/y.gif -nt reference ]
+
+  cd a/b
+  git lfs untrack "*.gif" | grep "Untracking \*.gif"
+  [ "*.gif eol=lf
+*.bin filter=lfs diff=lfs merge=lfs -text" = "$(cat .gitattributes)" ]
+  [ y.gif -nt ../../reference ]
+  [ ! z.bin -nt ../../reference ]
+
+  git check-attr filter -- y.gif | grep "filter: unspecified"
+  git check-attr filter -- z.bin | grep "filter: lfs"
+)
+end_test
+
+begin_test "untrack --dry-run"
+(
+  set -e
+
+  reponame="untrack-dry-run"
+  git init $reponame
+  cd $reponame
+
+  git lfs track "*.jpg"
+  touch a.jpg
+  git add a.jpg
+
+  git lfs untrack --dry-run "*.jpg" > untrack.log
+  cat untrack.log
+  grep "Would untrack \*.jpg" untrack.log
+  grep "  Remove from .gitattributes" untrack.log
+  grep -A1 "Mark as modified:" untrack.log | grep "    a.jpg"
+
+  grep "\*.jpg filter=lfs diff=lfs merge=lfs -text" .gitattributes
+)
+end_test
+
 begin_test "untrack outside git repo"
 (
   set -e
@@ -141,6 +141,28 @@ refute_server_lock() {
   [ $(grep -c "$id" http.json) -eq 0 ]
 }
 
+# assert_file_writable asserts that the owner of a file may write to it,
+# judging by its mode, since "test -w" always passes for root.
+assert_file_writable() {
+  local file="$1"
+
+  [ "w" = "$(ls -l "$file" | cut -c3)" ] || {
+    echo >&2 "expected '$file' to be writable: $(ls -l "$file")"
+    exit 1
+  }
+}
+
+# refute_file_writable asserts that no one may write to a file, judging by its
+# mode.
+refute_file_writable() {
+  local file="$1"
+
+  ls -l "$file" | cut -c1-10 | grep -v "w" || {
+    echo >&2 "expected '$file' to be read-only: $(ls -l "$file")"
+    exit 1
+  }
+}
+
 # pointer returns a string Git LFS pointer file.
 #
 #   $ pointer abc-some-oid 123
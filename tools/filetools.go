@@ -78,6 +78,32 @@ func RenameFileCopyPermissions(srcfile, destfile string) error {
 	return nil
 }
 
+// SetFileWriteFlag makes the file at "path" writable by its owner, or
+// read-only for everyone, keeping the rest of its mode. It returns whether the
+// mode had to be changed. On Windows, os.Chmod only sets or clears the file's
+// FILE_ATTRIBUTE_READONLY attribute, which is what this does there.
+func SetFileWriteFlag(path string, writable bool) (bool, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	mode := fi.Mode().Perm()
+	if writable {
+		if mode&0200 != 0 {
+			return false, nil
+		}
+		mode |= 0200
+	} else {
+		if mode&0222 == 0 {
+			return false, nil
+		}
+		mode &^= 0222
+	}
+
+	return true, os.Chmod(path, mode)
+}
+
 // CleanPaths splits the given `paths` argument by the delimiter argument, and
 // then "cleans" that path according to the path.Clean function (see
 // https://golang.org/pkg/path#Clean).
@@ -1,10 +1,14 @@
 package tools_test
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/github/git-lfs/tools"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCleanPathsCleansPaths(t *testing.T) {
@@ -18,3 +22,41 @@ func TestCleanPathsReturnsNoResultsWhenGivenNoPaths(t *testing.T) {
 
 	assert.Empty(t, cleaned)
 }
+
+func TestSetFileWriteFlag(t *testing.T) {
+	f, err := ioutil.TempFile("", "write-flag")
+	require.Nil(t, err)
+	f.Close()
+	defer os.Remove(f.Name())
+	require.Nil(t, os.Chmod(f.Name(), 0644))
+
+	changed, err := tools.SetFileWriteFlag(f.Name(), false)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assertFileWritable(t, f.Name(), false)
+
+	changed, err = tools.SetFileWriteFlag(f.Name(), false)
+	assert.Nil(t, err)
+	assert.False(t, changed)
+
+	changed, err = tools.SetFileWriteFlag(f.Name(), true)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assertFileWritable(t, f.Name(), true)
+
+	changed, err = tools.SetFileWriteFlag(f.Name(), true)
+	assert.Nil(t, err)
+	assert.False(t, changed)
+}
+
+func TestSetFileWriteFlagOfMissingFile(t *testing.T) {
+	changed, err := tools.SetFileWriteFlag(filepath.Join(os.TempDir(), "no-such-write-flag-file"), false)
+	assert.True(t, os.IsNotExist(err))
+	assert.False(t, changed)
+}
+
+func assertFileWritable(t *testing.T, path string, writable bool) {
+	fi, err := os.Stat(path)
+	require.Nil(t, err)
+	assert.Equal(t, writable, fi.Mode().Perm()&0200 != 0, "%s has mode %s", path, fi.Mode())
+}
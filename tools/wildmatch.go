@@ -0,0 +1,190 @@
+package tools
+
+import "strings"
+
+// Wildmatch reports whether "name" matches the shell glob "pattern", using the
+// same rules as Git's wildmatch() with the WM_PATHNAME flag:
+//
+//   - '*' matches any sequence of characters except '/'
+//   - '?' matches any single character except '/'
+//   - '[...]' matches one character from a class, which may be negated with
+//     '!' or '^' and may contain ranges such as 'a-z'
+//   - '**' matches any number of directories when it makes up a whole path
+//     component ("**/foo", "foo/**", "foo/**/bar"), otherwise it behaves
+//     like '*'
+//   - '\' escapes the character that follows it
+//
+// Both "pattern" and "name" must use '/' as the path separator.
+func Wildmatch(pattern, name string) bool {
+	return wildmatch(pattern, 0, name)
+}
+
+func wildmatch(pattern string, pi int, name string) bool {
+	for pi < len(pattern) {
+		switch c := pattern[pi]; c {
+		case '?':
+			if len(name) == 0 || name[0] == '/' {
+				return false
+			}
+			pi++
+			name = name[1:]
+
+		case '*':
+			start := pi
+			for pi < len(pattern) && pattern[pi] == '*' {
+				pi++
+			}
+
+			// '**' is only special when it makes up a whole path
+			// component.
+			doubleStar := pi-start > 1 &&
+				(start == 0 || pattern[start-1] == '/') &&
+				(pi == len(pattern) || pattern[pi] == '/')
+
+			if !doubleStar {
+				for i := 0; i <= len(name); i++ {
+					if wildmatch(pattern, pi, name[i:]) {
+						return true
+					}
+					if i < len(name) && name[i] == '/' {
+						return false
+					}
+				}
+				return false
+			}
+
+			if pi == len(pattern) {
+				// Trailing "**" matches everything that remains.
+				return true
+			}
+
+			// "**/" matches zero or more leading directories.
+			pi++
+			if wildmatch(pattern, pi, name) {
+				return true
+			}
+			for i := 0; i < len(name); i++ {
+				if name[i] == '/' && wildmatch(pattern, pi, name[i+1:]) {
+					return true
+				}
+			}
+			return false
+
+		case '[':
+			if len(name) == 0 || name[0] == '/' {
+				return false
+			}
+
+			matched, next, ok := matchClass(pattern, pi+1, name[0])
+			if !ok {
+				// An unterminated class is matched literally.
+				if name[0] != '[' {
+					return false
+				}
+				pi++
+				name = name[1:]
+				continue
+			}
+			if !matched {
+				return false
+			}
+			pi = next
+			name = name[1:]
+
+		case '\\':
+			if pi+1 < len(pattern) {
+				pi++
+				c = pattern[pi]
+			}
+			fallthrough
+
+		default:
+			if len(name) == 0 || name[0] != c {
+				return false
+			}
+			pi++
+			name = name[1:]
+		}
+	}
+
+	return len(name) == 0
+}
+
+// matchClass matches the character "c" against the bracket expression which
+// starts at pattern[pi], immediately after the opening '['. It returns whether
+// the character matched, the index following the closing ']' and whether the
+// class was terminated at all.
+func matchClass(pattern string, pi int, c byte) (matched bool, next int, ok bool) {
+	negate := false
+	if pi < len(pattern) && (pattern[pi] == '!' || pattern[pi] == '^') {
+		negate = true
+		pi++
+	}
+
+	for first := true; pi < len(pattern); first = false {
+		lo := pattern[pi]
+		if lo == ']' && !first {
+			return matched != negate, pi + 1, true
+		}
+
+		if lo == '\\' && pi+1 < len(pattern) {
+			pi++
+			lo = pattern[pi]
+		}
+		pi++
+
+		hi := lo
+		if pi+1 < len(pattern) && pattern[pi] == '-' && pattern[pi+1] != ']' {
+			hi = pattern[pi+1]
+			pi += 2
+			if hi == '\\' && pi < len(pattern) {
+				hi = pattern[pi]
+				pi++
+			}
+		}
+
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+
+	return false, pi, false
+}
+
+// PathMatchesPattern reports whether "path" is matched by "pattern", following
+// the rules Git uses for .gitignore and attribute patterns:
+//
+//   - a pattern without a '/' matches a file or directory of that name at
+//     any depth
+//   - a pattern containing a '/' is matched relative to the repository root;
+//     a leading '/' is optional
+//   - a pattern which matches a directory also matches everything under it
+//   - "." matches every path
+//
+// Both "pattern" and "path" must use '/' as the path separator.
+func PathMatchesPattern(pattern, path string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if pattern == "." || pattern == "" {
+		return true
+	}
+
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	path = strings.TrimPrefix(path, "/")
+
+	parts := strings.Split(path, "/")
+	for i := range parts {
+		var candidate string
+		if anchored {
+			candidate = strings.Join(parts[:i+1], "/")
+		} else {
+			candidate = parts[i]
+		}
+
+		if Wildmatch(pattern, candidate) {
+			return true
+		}
+	}
+
+	return false
+}
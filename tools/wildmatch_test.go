@@ -0,0 +1,63 @@
+package tools_test
+
+import (
+	"testing"
+
+	"github.com/github/git-lfs/tools"
+	"github.com/stretchr/testify/assert"
+)
+
+type WildmatchTestCase struct {
+	Pattern, Name string
+	Expected      bool
+}
+
+func TestWildmatch(t *testing.T) {
+	for _, c := range []WildmatchTestCase{
+		{"foo", "foo", true},
+		{"foo", "bar", false},
+		{"*.psd", "image.psd", true},
+		{"*.psd", "dir/image.psd", false},
+		{"?.psd", "a.psd", true},
+		{"?.psd", "/.psd", false},
+		{"assets/**/*.psd", "assets/image.psd", true},
+		{"assets/**/*.psd", "assets/a/b/image.psd", true},
+		{"assets/**/*.psd", "other/image.psd", false},
+		{"**/*.psd", "image.psd", true},
+		{"**/*.psd", "a/b/image.psd", true},
+		{"assets/**", "assets/a/b/c", true},
+		{"a/**b", "a/x/b", false},
+		{"a/**b", "a/xb", true},
+		{"file[0-9].bin", "file7.bin", true},
+		{"file[0-9].bin", "filex.bin", false},
+		{"file[!0-9].bin", "filex.bin", true},
+		{"file[^0-9].bin", "file7.bin", false},
+		{"file[]].bin", "file].bin", true},
+		{`file\[1\].bin`, "file[1].bin", true},
+		{`file\[1\].bin`, "file1.bin", false},
+		{"file[1.bin", "file[1.bin", true},
+		{"my file.bin", "my file.bin", true},
+		{"my *.bin", "my file.bin", true},
+	} {
+		assert.Equal(t, c.Expected, tools.Wildmatch(c.Pattern, c.Name), "%q ~ %q", c.Pattern, c.Name)
+	}
+}
+
+func TestPathMatchesPattern(t *testing.T) {
+	for _, c := range []WildmatchTestCase{
+		{"*.psd", "image.psd", true},
+		{"*.psd", "assets/deep/image.psd", true},
+		{"assets", "assets/image.psd", true},
+		{"assets", "other/assets/image.psd", true},
+		{"/assets", "other/assets/image.psd", false},
+		{"assets/", "assets/image.psd", true},
+		{"assets/*.psd", "assets/image.psd", true},
+		{"assets/*.psd", "assets/deep/image.psd", false},
+		{"assets/**/*.psd", "assets/deep/image.psd", true},
+		{"test/filename.dat", "test/filename.dat", true},
+		{"test/filename.dat", "other/test/filename.dat", false},
+		{".", "anything/at/all", true},
+	} {
+		assert.Equal(t, c.Expected, tools.PathMatchesPattern(c.Pattern, c.Name), "%q ~ %q", c.Pattern, c.Name)
+	}
+}
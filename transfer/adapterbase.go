@@ -5,7 +5,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/github/git-lfs/config"
 	"github.com/github/git-lfs/errors"
+	"github.com/github/git-lfs/metrics"
 	"github.com/rubyist/tracerx"
 )
 
@@ -25,10 +27,19 @@ type adapterBase struct {
 	jobChan      chan *Transfer
 	cb           TransferProgressCallback
 	outChan      chan TransferResult
+	// limiter caps the combined throughput of all workers, if configured
+	limiter *bandwidthLimiter
+	// begun is when Begin() was called, for metrics
+	begun time.Time
 	// WaitGroup to sync the completion of all workers
 	workerWait sync.WaitGroup
 	// WaitGroup to serialise the first transfer response to perform login if needed
 	authWait sync.WaitGroup
+	// active holds the OIDs of the transfers which have been added and
+	// haven't finished, and whether each has been cancelled. activeMu
+	// guards it.
+	active   map[string]bool
+	activeMu sync.Mutex
 }
 
 // transferImplementation must be implemented to provide the actual upload/download
@@ -65,6 +76,9 @@ func (a *adapterBase) Begin(maxConcurrency int, cb TransferProgressCallback, com
 	a.cb = cb
 	a.outChan = completion
 	a.jobChan = make(chan *Transfer, 100)
+	a.limiter = newBandwidthLimiter(config.Config.TransferMaxBandwidth())
+	a.begun = time.Now()
+	a.active = make(map[string]bool)
 
 	tracerx.Printf("xfer: adapter %q Begin() with %d workers", a.Name(), maxConcurrency)
 
@@ -83,9 +97,58 @@ func (a *adapterBase) Begin(maxConcurrency int, cb TransferProgressCallback, com
 
 func (a *adapterBase) Add(t *Transfer) {
 	tracerx.Printf("xfer: adapter %q Add() for %q", a.Name(), t.Object.Oid)
+	a.activeMu.Lock()
+	a.active[t.Object.Oid] = false
+	a.activeMu.Unlock()
+
 	a.jobChan <- t
 }
 
+// Cancel implements Canceller. A transfer which is waiting for a worker isn't
+// started, and one in progress fails the next time it reports progress.
+func (a *adapterBase) Cancel(oid string) bool {
+	a.activeMu.Lock()
+	defer a.activeMu.Unlock()
+
+	if _, ok := a.active[oid]; !ok {
+		return false
+	}
+
+	tracerx.Printf("xfer: adapter %q cancelling %q", a.Name(), oid)
+	a.active[oid] = true
+	return true
+}
+
+// cancelled returns whether the transfer of the object with the given OID has
+// been cancelled.
+func (a *adapterBase) cancelled(oid string) bool {
+	a.activeMu.Lock()
+	defer a.activeMu.Unlock()
+
+	return a.active[oid]
+}
+
+// cancelledError returns the error which a cancelled transfer of "t" completes
+// with.
+func cancelledError(t *Transfer) error {
+	return errors.NewCancelledError(errors.Errorf("lfs/transfer: transfer of %q cancelled", t.Object.Oid))
+}
+
+// progressCallback returns the callback which the transfer of "t" reports its
+// progress to: the one given to Begin, unless the transfer has been cancelled,
+// in which case it returns an error, to stop the transfer.
+func (a *adapterBase) progressCallback(t *Transfer) TransferProgressCallback {
+	return func(name string, totalSize, readSoFar int64, readSinceLast int) error {
+		if a.cancelled(t.Object.Oid) {
+			return cancelledError(t)
+		}
+		if a.cb != nil {
+			return a.cb(name, totalSize, readSoFar, readSinceLast)
+		}
+		return nil
+	}
+}
+
 func (a *adapterBase) End() {
 	tracerx.Printf("xfer: adapter %q End()", a.Name())
 	close(a.jobChan)
@@ -94,6 +157,7 @@ func (a *adapterBase) End() {
 	if a.outChan != nil {
 		close(a.outChan)
 	}
+	metrics.Since(metrics.Transfer, a.begun)
 	tracerx.Printf("xfer: adapter %q stopped", a.Name())
 }
 
@@ -126,16 +190,26 @@ func (a *adapterBase) worker(workerNum int, ctx interface{}) {
 
 		// Actual transfer happens here
 		var err error
-		if t.Object.IsExpired(time.Now().Add(objectExpirationGracePeriod)) {
+		if a.cancelled(t.Object.Oid) {
+			tracerx.Printf("xfer: adapter %q worker %d found job for %q cancelled", a.Name(), workerNum, t.Object.Oid)
+			err = cancelledError(t)
+		} else if t.Object.IsExpired(time.Now().Add(objectExpirationGracePeriod)) {
 			tracerx.Printf("xfer: adapter %q worker %d found job for %q expired, retrying...", a.Name(), workerNum, t.Object.Oid)
-			err = errors.NewRetriableError(errors.Errorf("lfs/transfer: object %q has expired", t.Object.Oid))
+			err = errors.NewSafeRetriableError(errors.Errorf("lfs/transfer: object %q has expired", t.Object.Oid))
 		} else if t.Object.Size < 0 {
 			tracerx.Printf("xfer: adapter %q worker %d found invalid size for %q (got: %d), retrying...", a.Name(), workerNum, t.Object.Oid, t.Object.Size)
 			err = fmt.Errorf("Git LFS: object %q has invalid size (got: %d)", t.Object.Oid, t.Object.Size)
 		} else {
-			err = a.transferImpl.DoTransfer(ctx, t, a.cb, authCallback)
+			err = a.transferImpl.DoTransfer(ctx, t, a.progressCallback(t), authCallback)
+			if err != nil && a.cancelled(t.Object.Oid) {
+				err = cancelledError(t)
+			}
 		}
 
+		a.activeMu.Lock()
+		delete(a.active, t.Object.Oid)
+		a.activeMu.Unlock()
+
 		if a.outChan != nil {
 			res := TransferResult{t, err}
 			a.outChan <- res
@@ -0,0 +1,57 @@
+package transfer
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/github/git-lfs/api"
+	"github.com/github/git-lfs/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// progressingTransfer is a transferImplementation whose transfers report
+// progress until the callback returns an error, signalling "started" with the
+// OID of each transfer it starts.
+type progressingTransfer struct {
+	started chan string
+	mu      sync.Mutex
+	oids    []string
+}
+
+func (p *progressingTransfer) WorkerStarting(workerNum int) (interface{}, error) { return nil, nil }
+func (p *progressingTransfer) WorkerEnding(workerNum int, ctx interface{})       {}
+func (p *progressingTransfer) DoTransfer(ctx interface{}, t *Transfer, cb TransferProgressCallback, authOkFunc func()) error {
+	p.mu.Lock()
+	p.oids = append(p.oids, t.Object.Oid)
+	p.mu.Unlock()
+
+	p.started <- t.Object.Oid
+	for read := int64(1); ; read++ {
+		if err := cb(t.Name, t.Object.Size, read, 1); err != nil {
+			return err
+		}
+	}
+}
+
+func TestAdapterBaseCancelsTransfers(t *testing.T) {
+	impl := &progressingTransfer{started: make(chan string, 2)}
+	a := newAdapterBase("progressing", Download, impl)
+	completion := make(chan TransferResult, 2)
+	assert.Nil(t, a.Begin(1, nil, completion))
+
+	a.Add(NewTransfer("a.dat", &api.ObjectResource{Oid: "a", Size: 10}, "", 0))
+	a.Add(NewTransfer("b.dat", &api.ObjectResource{Oid: "b", Size: 10}, "", 0))
+	assert.Equal(t, "a", <-impl.started)
+
+	// "b" is still waiting for the only worker.
+	assert.True(t, a.Cancel("b"))
+	assert.True(t, a.Cancel("a"))
+	assert.False(t, a.Cancel("c"))
+	a.End()
+
+	for res := range completion {
+		assert.True(t, errors.IsCancelledError(res.Error), "expected %q to be cancelled, got %v", res.Transfer.Object.Oid, res.Error)
+	}
+	assert.Equal(t, []string{"a"}, impl.oids)
+	assert.False(t, a.Cancel("a"))
+}
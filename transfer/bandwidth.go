@@ -0,0 +1,66 @@
+package transfer
+
+import (
+	"sync"
+	"time"
+)
+
+// bandwidthLimiter is a token bucket which caps the combined throughput of
+// every transfer sharing it. Each byte transferred consumes a token, tokens are
+// replenished at the configured rate, and at most one second's worth of tokens
+// can be saved up for bursts.
+type bandwidthLimiter struct {
+	rate   float64 // bytes per second
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+
+	// now and sleep are replaced in tests
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// newBandwidthLimiter returns a limiter allowing "bytesPerSecond" bytes to be
+// transferred each second, or nil (meaning no limit) if it is zero or less.
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return &bandwidthLimiter{
+		rate:  float64(bytesPerSecond),
+		now:   time.Now,
+		sleep: time.Sleep,
+	}
+}
+
+// Wait blocks until "n" more bytes may be transferred without exceeding the
+// limit. It is safe to call from multiple goroutines, and does nothing when
+// called on a nil limiter.
+func (l *bandwidthLimiter) Wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	if l.last.IsZero() {
+		l.tokens = l.rate
+	} else {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.rate {
+			l.tokens = l.rate
+		}
+	}
+	l.last = now
+
+	// Take the tokens now, even if that leaves a deficit, so that concurrent
+	// callers queue up behind each other rather than all waking together.
+	l.tokens -= float64(n)
+	deficit := -l.tokens
+	l.mu.Unlock()
+
+	if deficit > 0 {
+		l.sleep(time.Duration(deficit / l.rate * float64(time.Second)))
+	}
+}
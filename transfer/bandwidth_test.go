@@ -0,0 +1,79 @@
+package transfer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestBandwidthLimiter(rate int64) (*bandwidthLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	l := newBandwidthLimiter(rate)
+	l.now = clock.Now
+	l.sleep = clock.Sleep
+	return l, clock
+}
+
+func TestBandwidthLimiterDisabledWhenUnset(t *testing.T) {
+	assert.Nil(t, newBandwidthLimiter(0))
+	assert.Nil(t, newBandwidthLimiter(-1))
+
+	var l *bandwidthLimiter
+	l.Wait(1024) // must not panic
+}
+
+func TestBandwidthLimiterAllowsInitialBurst(t *testing.T) {
+	l, clock := newTestBandwidthLimiter(1000)
+
+	l.Wait(1000)
+	assert.Equal(t, time.Unix(0, 0), clock.Now())
+}
+
+func TestBandwidthLimiterCapsThroughput(t *testing.T) {
+	l, clock := newTestBandwidthLimiter(1000)
+
+	for i := 0; i < 10; i++ {
+		l.Wait(500)
+	}
+
+	// 5000 bytes at 1000 bytes/sec, less the initial one second burst.
+	assert.Equal(t, 4*time.Second, clock.Now().Sub(time.Unix(0, 0)))
+}
+
+func TestBandwidthLimiterSharedAcrossWorkers(t *testing.T) {
+	l, clock := newTestBandwidthLimiter(1000)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				l.Wait(100)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 2000 bytes in total, the first 1000 of which are the burst.
+	assert.True(t, clock.Now().Sub(time.Unix(0, 0)) >= time.Second)
+}
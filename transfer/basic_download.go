@@ -1,6 +1,7 @@
 package transfer
 
 import (
+	"compress/gzip"
 	"fmt"
 	"hash"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"regexp"
 	"strconv"
 
+	"github.com/github/git-lfs/api"
 	"github.com/github/git-lfs/config"
 	"github.com/github/git-lfs/errors"
 	"github.com/github/git-lfs/httputil"
@@ -26,10 +28,22 @@ func (a *basicDownloadAdapter) ClearTempStorage() error {
 	return os.RemoveAll(a.tempDir())
 }
 
+// VerifiesDownloads returns true, since downloads are hashed as they are
+// written.
+func (a *basicDownloadAdapter) VerifiesDownloads() bool {
+	return true
+}
+
 func (a *basicDownloadAdapter) tempDir() string {
-	// Must be dedicated to this adapter as deleted by ClearTempStorage
-	// Also make local to this repo not global, and separate to localstorage temp,
-	// which gets cleared at the end of every invocation
+	return incompleteDownloadDir()
+}
+
+// incompleteDownloadDir returns the directory holding incomplete downloads.
+// It must be dedicated to them, as it is deleted by ClearTempStorage. It is
+// local to this repo not global, and separate to localstorage temp, which gets
+// cleared at the end of every invocation, so that downloads can be resumed by
+// later commands.
+func incompleteDownloadDir() string {
 	d := filepath.Join(localstorage.Objects().RootDir, "incomplete")
 	if err := os.MkdirAll(d, 0755); err != nil {
 		return os.TempDir()
@@ -37,6 +51,21 @@ func (a *basicDownloadAdapter) tempDir() string {
 	return d
 }
 
+// ResumableDownloadOffset returns the number of bytes of the given object
+// which an earlier, interrupted download left in its incomplete download file,
+// or 0 if there are none to resume from.
+func ResumableDownloadOffset(obj *api.ObjectResource) int64 {
+	if localstorage.Objects() == nil {
+		return 0
+	}
+
+	fi, err := os.Stat(filepath.Join(incompleteDownloadDir(), obj.Oid+".tmp"))
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() >= obj.Size {
+		return 0
+	}
+	return fi.Size()
+}
+
 func (a *basicDownloadAdapter) WorkerStarting(workerNum int) (interface{}, error) {
 	return nil, nil
 }
@@ -52,22 +81,29 @@ func (a *basicDownloadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb Trans
 	return a.download(t, cb, authOkFunc, f, fromByte, hashSoFar)
 }
 
-// Checks to see if a download can be resumed, and if so returns a non-nil locked file, byte start and hash
+// Checks to see if a download can be resumed from t.ResumeFrom, and if so
+// returns a non-nil locked file, byte start and hash
 func (a *basicDownloadAdapter) checkResumeDownload(t *Transfer) (outFile *os.File, fromByte int64, hashSoFar hash.Hash, e error) {
+	if t.ResumeFrom <= 0 {
+		// Nothing worth resuming, so discard anything left over and
+		// create a new file, which must not already exist or error
+		// (permissions / race condition)
+		os.Remove(a.downloadFilename(t))
+		newfile, err := os.OpenFile(a.downloadFilename(t), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+		return newfile, 0, nil, err
+	}
+
 	// lock the file by opening it for read/write, rather than checking Stat() etc
 	// which could be subject to race conditions by other processes
 	f, err := os.OpenFile(a.downloadFilename(t), os.O_RDWR, 0644)
-
 	if err != nil {
-		// Create a new file instead, must not already exist or error (permissions / race condition)
-		newfile, err := os.OpenFile(a.downloadFilename(t), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
-		return newfile, 0, nil, err
+		return a.checkResumeDownload(NewTransfer(t.Name, t.Object, t.Path, 0))
 	}
 
 	// Successfully opened an existing file at this point
-	// Read any existing data into hash then return file handle at end
+	// Read the data to resume from into hash then return file handle there
 	hash := tools.NewLfsContentHash()
-	n, err := io.Copy(hash, f)
+	n, err := io.CopyN(hash, f, t.ResumeFrom)
 	if err != nil {
 		f.Close()
 		return nil, 0, nil, err
@@ -101,6 +137,12 @@ func (a *basicDownloadAdapter) download(t *Transfer, cb TransferProgressCallback
 		return err
 	}
 
+	// Resumed downloads are not compressed, since the range would apply to
+	// the compressed content rather than the object.
+	if compression := compressionFor(config.Config, rel, req); len(compression) > 0 && fromByte == 0 {
+		req.Header.Set("Accept-Encoding", compression)
+	}
+
 	if fromByte > 0 {
 		if dlFile == nil || hash == nil {
 			return fmt.Errorf("Cannot restart %v from %d without a file & hash", t.Object.Oid, fromByte)
@@ -118,7 +160,7 @@ func (a *basicDownloadAdapter) download(t *Transfer, cb TransferProgressCallback
 			os.Remove(dlFile.Name())
 			return a.download(t, cb, authOkFunc, nil, 0, nil)
 		}
-		return errors.NewRetriableError(err)
+		return errors.NewRetriableNetworkError(err, false)
 	}
 	httputil.LogTransfer(config.Config, "lfs.data.download", res)
 	defer res.Body.Close()
@@ -177,7 +219,25 @@ func (a *basicDownloadAdapter) download(t *Transfer, cb TransferProgressCallback
 	}
 
 	var hasher *tools.HashingReader
-	httpReader := tools.NewRetriableReader(res.Body)
+	var httpReader io.Reader = tools.NewRetriableReader(res.Body)
+	contentLength := res.ContentLength
+
+	// The object is hashed and the progress meter is updated after the
+	// content has been decompressed.
+	if encoding := res.Header.Get("Content-Encoding"); len(encoding) > 0 && len(req.Header.Get("Accept-Encoding")) > 0 {
+		if encoding != "gzip" {
+			return errors.Errorf("Unexpected Content-Encoding %q downloading %s", encoding, t.Object.Oid)
+		}
+
+		tracerx.Printf("xfer: decompressing download of %q with %s", t.Object.Oid, encoding)
+		gz, err := gzip.NewReader(httpReader)
+		if err != nil {
+			return errors.NewRetriableError(errors.Wrapf(err, "cannot decompress %s", t.Object.Oid))
+		}
+		defer gz.Close()
+		httpReader = gz
+		contentLength = t.Object.Size
+	}
 
 	if fromByte > 0 && hash != nil {
 		// pre-load hashing reader with previous content
@@ -197,12 +257,13 @@ func (a *basicDownloadAdapter) download(t *Transfer, cb TransferProgressCallback
 	dlfilename := dlFile.Name()
 	// Wrap callback to give name context
 	ccb := func(totalSize int64, readSoFar int64, readSinceLast int) error {
+		a.limiter.Wait(readSinceLast)
 		if cb != nil {
 			return cb(t.Name, totalSize, readSoFar+fromByte, readSinceLast)
 		}
 		return nil
 	}
-	written, err := tools.CopyWithCallback(dlFile, hasher, res.ContentLength, ccb)
+	written, err := tools.CopyWithCallback(dlFile, hasher, contentLength, ccb)
 	if err != nil {
 		return errors.Wrapf(err, "cannot write data to tempfile %q", dlfilename)
 	}
@@ -211,7 +272,16 @@ func (a *basicDownloadAdapter) download(t *Transfer, cb TransferProgressCallback
 	}
 
 	if actual := hasher.Hash(); actual != t.Object.Oid {
-		return fmt.Errorf("Expected OID %s, got %s after %d bytes written", t.Object.Oid, actual, written)
+		err := fmt.Errorf("Expected OID %s, got %s after %d bytes written", t.Object.Oid, actual, written)
+		if fromByte+written < t.Object.Size {
+			// The download was cut short, so leave it to be resumed.
+			return err
+		}
+
+		// The whole object was downloaded, but is corrupt, so it is
+		// downloaded again from the start.
+		os.Remove(dlfilename)
+		return errors.NewRetriableError(err)
 	}
 
 	return tools.RenameFileCopyPermissions(dlfilename, t.Path)
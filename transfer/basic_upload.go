@@ -7,12 +7,14 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/github/git-lfs/api"
 	"github.com/github/git-lfs/config"
 	"github.com/github/git-lfs/errors"
 	"github.com/github/git-lfs/httputil"
 	"github.com/github/git-lfs/progress"
+	"github.com/rubyist/tracerx"
 )
 
 const (
@@ -54,18 +56,26 @@ func (a *basicUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb Transfe
 	if err != nil {
 		return err
 	}
+	compression := compressionFor(config.Config, rel, req)
 
 	if len(req.Header.Get("Content-Type")) == 0 {
 		req.Header.Set("Content-Type", "application/octet-stream")
 	}
 
-	if req.Header.Get("Transfer-Encoding") == "chunked" {
+	if len(compression) > 0 {
+		// The compressed size isn't known until it has been sent.
+		req.Header.Set("Content-Encoding", compression)
 		req.TransferEncoding = []string{"chunked"}
+		req.ContentLength = -1
 	} else {
-		req.Header.Set("Content-Length", strconv.FormatInt(t.Object.Size, 10))
-	}
+		if req.Header.Get("Transfer-Encoding") == "chunked" {
+			req.TransferEncoding = []string{"chunked"}
+		} else {
+			req.Header.Set("Content-Length", strconv.FormatInt(t.Object.Size, 10))
+		}
 
-	req.ContentLength = t.Object.Size
+		req.ContentLength = t.Object.Size
+	}
 
 	f, err := os.OpenFile(t.Path, os.O_RDONLY, 0644)
 	if err != nil {
@@ -75,7 +85,10 @@ func (a *basicUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb Transfe
 
 	// Ensure progress callbacks made while uploading
 	// Wrap callback to give name context
+	var sent int64 // bytes read from the file so far, accessed atomically
 	ccb := func(totalSize int64, readSoFar int64, readSinceLast int) error {
+		atomic.StoreInt64(&sent, readSoFar)
+		a.limiter.Wait(readSinceLast)
 		if cb != nil {
 			return cb(t.Name, totalSize, readSoFar, readSinceLast)
 		}
@@ -88,6 +101,14 @@ func (a *basicUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb Transfe
 		Reader:    f,
 	}
 
+	// Progress is still reported in uncompressed bytes read from the file.
+	if len(compression) > 0 {
+		tracerx.Printf("xfer: compressing upload of %q with %s", t.Object.Oid, compression)
+		compressed := newGzipReader(reader)
+		defer compressed.Close()
+		reader = compressed
+	}
+
 	// Signal auth was ok on first read; this frees up other workers to start
 	if authOkFunc != nil {
 		reader = newStartCallbackReader(reader, func(*startCallbackReader) {
@@ -99,7 +120,8 @@ func (a *basicUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb Transfe
 
 	res, err := httputil.DoHttpRequest(config.Config, req, t.Object.NeedsAuth())
 	if err != nil {
-		return errors.NewRetriableError(err)
+		// If nothing reached the server, this is safe to retry.
+		return errors.NewRetriableNetworkError(err, atomic.LoadInt64(&sent) == 0)
 	}
 	httputil.LogTransfer(config.Config, "lfs.data.upload", res)
 
@@ -107,11 +129,19 @@ func (a *basicUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb Transfe
 	// upload has expired. This can be safely retried.
 	if res.StatusCode == 403 {
 		err = errors.New("http: received status 403")
-		return errors.NewRetriableError(err)
+		return errors.NewSafeRetriableError(err)
+	}
+
+	// A server error before any content was sent cannot have stored a
+	// partial object, so this can be retried too.
+	if res.StatusCode > 499 && atomic.LoadInt64(&sent) == 0 {
+		err = errors.Errorf("http: received status %d before upload started", res.StatusCode)
+		return errors.NewStatusError(errors.NewSafeRetriableError(err), res.StatusCode)
 	}
 
 	if res.StatusCode > 299 {
-		return errors.Wrapf(nil, "Invalid status for %s: %d", httputil.TraceHttpReq(req), res.StatusCode)
+		err = errors.Errorf("Invalid status for %s: %d", httputil.TraceHttpReq(req), res.StatusCode)
+		return errors.NewStatusError(err, res.StatusCode)
 	}
 
 	io.Copy(ioutil.Discard, res.Body)
@@ -0,0 +1,55 @@
+package transfer
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/github/git-lfs/api"
+	"github.com/github/git-lfs/config"
+)
+
+// CompressHeader is the action header in which a server lists the content
+// encodings it accepts for uploads and can send for downloads, e.g. "gzip".
+// It is a hint to the client, and is not sent on to the server.
+const CompressHeader = "Lfs-Compress"
+
+// compressionFor returns the content encoding to use with the given action,
+// which is "gzip" if both lfs.transfer.compression and the server allow it, or
+// an empty string for none. It also removes the hint from the request's headers.
+func compressionFor(cfg *config.Configuration, rel *api.LinkRelation, req *http.Request) string {
+	req.Header.Del(CompressHeader)
+
+	want := cfg.TransferCompression()
+	if len(want) == 0 {
+		return ""
+	}
+
+	for key, value := range rel.Header {
+		if !strings.EqualFold(key, CompressHeader) {
+			continue
+		}
+		for _, encoding := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(encoding), want) {
+				return want
+			}
+		}
+	}
+	return ""
+}
+
+// newGzipReader returns a reader of the gzip compressed contents of "r". Close
+// must be called on it if it is not read to the end.
+func newGzipReader(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, r)
+		if err == nil {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
@@ -0,0 +1,58 @@
+package transfer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/github/git-lfs/api"
+	"github.com/github/git-lfs/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionForSupportingServer(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{"lfs.transfer.compression": "gzip"},
+	})
+	rel := &api.LinkRelation{Header: map[string]string{"Lfs-Compress": "zstd, gzip"}}
+	req, _ := http.NewRequest("GET", "https://example.com", nil)
+	req.Header.Set("Lfs-Compress", "zstd, gzip")
+
+	assert.Equal(t, "gzip", compressionFor(cfg, rel, req))
+	assert.Empty(t, req.Header.Get("Lfs-Compress"))
+}
+
+func TestCompressionForNonSupportingServer(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{"lfs.transfer.compression": "gzip"},
+	})
+	req, _ := http.NewRequest("GET", "https://example.com", nil)
+
+	assert.Empty(t, compressionFor(cfg, &api.LinkRelation{}, req))
+	assert.Empty(t, compressionFor(cfg, &api.LinkRelation{Header: map[string]string{"Lfs-Compress": "zstd"}}, req))
+}
+
+func TestCompressionForDisabled(t *testing.T) {
+	cfg := config.NewFrom(config.Values{})
+	rel := &api.LinkRelation{Header: map[string]string{"Lfs-Compress": "gzip"}}
+	req, _ := http.NewRequest("GET", "https://example.com", nil)
+
+	assert.Empty(t, compressionFor(cfg, rel, req))
+}
+
+func TestGzipReader(t *testing.T) {
+	content := bytes.Repeat([]byte("compressible "), 1000)
+
+	compressed, err := ioutil.ReadAll(newGzipReader(bytes.NewReader(content)))
+	require.Nil(t, err)
+	assert.True(t, len(compressed) < len(content)/10)
+
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.Nil(t, err)
+	decompressed, err := ioutil.ReadAll(gz)
+	require.Nil(t, err)
+	assert.Equal(t, content, decompressed)
+}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"os/exec"
@@ -16,6 +15,7 @@ import (
 	"github.com/github/git-lfs/tools"
 
 	"github.com/github/git-lfs/api"
+	"github.com/github/git-lfs/errors"
 	"github.com/github/git-lfs/subprocess"
 	"github.com/rubyist/tracerx"
 
@@ -120,6 +120,12 @@ func (a *customAdapter) Begin(maxConcurrency int, cb TransferProgressCallback, c
 	return a.adapterBase.Begin(useConcurrency, cb, completion)
 }
 
+// VerifiesDownloads returns true, since the content of each download is
+// hashed before it is moved into place.
+func (a *customAdapter) VerifiesDownloads() bool {
+	return true
+}
+
 func (a *customAdapter) ClearTempStorage() error {
 	// no action requred
 	return nil
@@ -312,7 +318,7 @@ func (a *customAdapter) DoTransfer(ctx interface{}, t *Transfer, cb TransferProg
 			if a.direction == Download {
 				// So we don't have to blindly trust external providers, check SHA
 				if err = tools.VerifyFileHash(t.Object.Oid, resp.Path); err != nil {
-					return fmt.Errorf("Downloaded file failed checks: %v", err)
+					return errors.NewRetriableError(errors.Errorf("Downloaded file failed checks: %v", err))
 				}
 				// Move file to final location
 				if err = tools.RenameFileCopyPermissions(resp.Path, t.Path); err != nil {
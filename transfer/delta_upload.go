@@ -0,0 +1,257 @@
+package transfer
+
+import (
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/github/git-lfs/api"
+	"github.com/github/git-lfs/config"
+	"github.com/github/git-lfs/delta"
+	"github.com/github/git-lfs/errors"
+	"github.com/github/git-lfs/httputil"
+	"github.com/github/git-lfs/localstorage"
+	"github.com/github/git-lfs/progress"
+	"github.com/github/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	DeltaAdapterName = "delta"
+	// DeltaContentType is the Content-Type of patches uploaded by the delta
+	// adapter.
+	DeltaContentType = "application/vnd.git-lfs.delta"
+)
+
+// errPatchTooLarge stops a patch being computed once it is too large to be
+// worth uploading.
+var errPatchTooLarge = errors.New("delta: patch is too large")
+
+// Adapter for delta uploads. If the server offers a base object for a patch
+// through the object's "delta_base" field and "delta" action, and that object
+// is also present locally, only a patch against it is uploaded. Otherwise, or
+// if the patch would be larger than lfs.transfer.deltamaxratio of the object,
+// the whole object is uploaded through the "upload" action, as with the basic
+// adapter.
+type deltaUploadAdapter struct {
+	*basicUploadAdapter
+	maxRatio float64
+}
+
+func (a *deltaUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb TransferProgressCallback, authOkFunc func()) error {
+	rel, ok := t.Object.Rel("delta")
+	basePath, baseSize := a.localBase(t.Object.DeltaBase)
+	if !ok || len(basePath) == 0 {
+		tracerx.Printf("xfer: no local delta base for %q, uploading whole object", t.Object.Oid)
+		return a.basicUploadAdapter.DoTransfer(ctx, t, cb, authOkFunc)
+	}
+
+	patch, err := a.diff(t, basePath, baseSize)
+	if err == errPatchTooLarge {
+		tracerx.Printf("xfer: delta for %q is too large, uploading whole object", t.Object.Oid)
+		return a.basicUploadAdapter.DoTransfer(ctx, t, cb, authOkFunc)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		patch.Close()
+		os.Remove(patch.Name())
+	}()
+
+	fi, err := patch.Stat()
+	if err != nil {
+		return errors.Wrap(err, "delta upload")
+	}
+	patchSize := fi.Size()
+	tracerx.Printf("xfer: uploading %q as a %d byte delta against %q", t.Object.Oid, patchSize, t.Object.DeltaBase)
+
+	req, err := httputil.NewHttpRequest("PUT", rel.Href, rel.Header)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", DeltaContentType)
+	req.Header.Set("Content-Length", strconv.FormatInt(patchSize, 10))
+	req.ContentLength = patchSize
+
+	var sent int64 // bytes read from the patch so far, accessed atomically
+	var reader io.Reader
+	reader = &progress.CallbackReader{
+		C: func(totalSize int64, readSoFar int64, readSinceLast int) error {
+			atomic.StoreInt64(&sent, readSoFar)
+			a.limiter.Wait(readSinceLast)
+			return nil
+		},
+		TotalSize: patchSize,
+		Reader:    patch,
+	}
+
+	// Signal auth was ok on first read; this frees up other workers to start
+	if authOkFunc != nil {
+		reader = newStartCallbackReader(reader, func(*startCallbackReader) {
+			authOkFunc()
+		})
+	}
+
+	req.Body = ioutil.NopCloser(reader)
+
+	res, err := httputil.DoHttpRequest(config.Config, req, t.Object.NeedsAuth())
+	if err != nil {
+		// If nothing reached the server, this is safe to retry.
+		return errors.NewRetriableNetworkError(err, atomic.LoadInt64(&sent) == 0)
+	}
+	httputil.LogTransfer(config.Config, "lfs.data.delta", res)
+
+	// A status code of 403 likely means that an authentication token for the
+	// upload has expired. This can be safely retried.
+	if res.StatusCode == 403 {
+		err = errors.New("http: received status 403")
+		return errors.NewSafeRetriableError(err)
+	}
+
+	if res.StatusCode > 299 {
+		err = errors.Errorf("Invalid status for %s: %d", httputil.TraceHttpReq(req), res.StatusCode)
+		return errors.NewStatusError(err, res.StatusCode)
+	}
+
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+
+	// The patch stands in for the whole object, so report it all as sent.
+	advanceCallbackProgress(cb, t, t.Object.Size)
+
+	return api.VerifyUpload(config.Config, t.Object)
+}
+
+// localBase returns the path and size of the local copy of the object with the
+// given OID, or an empty path if there isn't one. A copy whose content doesn't
+// hash to the OID isn't used, since the server would apply the patch to a
+// different base.
+func (a *deltaUploadAdapter) localBase(oid string) (string, int64) {
+	if !validOid(oid) || localstorage.Objects() == nil {
+		return "", 0
+	}
+
+	path := localstorage.Objects().ObjectPath(oid)
+	fi, err := os.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return "", 0
+	}
+
+	if err := verifyBase(path, oid); err != nil {
+		tracerx.Printf("xfer: not using delta base %q: %s", oid, err)
+		return "", 0
+	}
+	return path, fi.Size()
+}
+
+// verifyBase returns an error if the content of the file at "path" doesn't
+// hash to "oid".
+func verifyBase(path, oid string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := tools.NewLfsContentHash()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != oid {
+		return errors.Errorf("expected OID %s, got %s", oid, actual)
+	}
+	return nil
+}
+
+// validOid returns whether "oid" is a lowercase hex encoded SHA-256, as
+// lfs.ValidOid does, so that a base named by the server can't reach outside
+// the object directory.
+func validOid(oid string) bool {
+	if len(oid) != 64 {
+		return false
+	}
+	for _, c := range oid {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// diff writes a patch from the object at "basePath" to the object being
+// uploaded to a temporary file, and returns it opened at the start. It returns
+// errPatchTooLarge if the patch would be larger than allowed.
+func (a *deltaUploadAdapter) diff(t *Transfer, basePath string, baseSize int64) (*os.File, error) {
+	base, err := os.Open(basePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "delta upload")
+	}
+	defer base.Close()
+
+	target, err := os.Open(t.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "delta upload")
+	}
+	defer target.Close()
+
+	patch, err := ioutil.TempFile(a.tempDir(), t.Object.Oid)
+	if err != nil {
+		return nil, errors.Wrap(err, "delta upload")
+	}
+
+	w := &limitedWriter{W: patch, N: int64(a.maxRatio * float64(t.Object.Size))}
+	_, err = delta.Diff(base, baseSize, target, w)
+	if err == nil {
+		_, err = patch.Seek(0, os.SEEK_SET)
+	}
+	if err != nil {
+		patch.Close()
+		os.Remove(patch.Name())
+		if w.Exceeded {
+			return nil, errPatchTooLarge
+		}
+		return nil, errors.Wrap(err, "delta upload")
+	}
+	return patch, nil
+}
+
+// limitedWriter writes to W until more than N bytes have been written in
+// total, after which it sets Exceeded and returns errPatchTooLarge.
+type limitedWriter struct {
+	W        io.Writer
+	N        int64
+	Exceeded bool
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.N {
+		l.Exceeded = true
+		return 0, errPatchTooLarge
+	}
+	n, err := l.W.Write(p)
+	l.N -= int64(n)
+	return n, err
+}
+
+func configureDeltaAdapter(m *Manifest) {
+	m.RegisterNewTransferAdapterFunc(DeltaAdapterName, Upload, func(name string, dir Direction) TransferAdapter {
+		switch dir {
+		case Upload:
+			du := &deltaUploadAdapter{
+				basicUploadAdapter: &basicUploadAdapter{newAdapterBase(name, dir, nil)},
+				maxRatio:           config.Config.DeltaTransferMaxRatio(),
+			}
+			// self implements impl
+			du.transferImpl = du
+			return du
+		case Download:
+			panic("Should never ask delta adapter to download")
+		}
+		return nil
+	})
+}
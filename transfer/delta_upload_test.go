@@ -0,0 +1,48 @@
+package transfer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deltaBaseOid is the OID of the content "base".
+const deltaBaseOid = "cae662172fd450bb0cd710a769079c05bfc5d8e35efa6576edc7d0377afdd4a2"
+
+func TestValidOid(t *testing.T) {
+	assert.True(t, validOid(deltaBaseOid))
+
+	for _, oid := range []string{
+		"",
+		"cae66",
+		"../../../../etc/passwd",
+		strings.ToUpper(deltaBaseOid),
+		deltaBaseOid + "0",
+		deltaBaseOid[:63] + "g",
+		deltaBaseOid[:60] + "/../",
+	} {
+		assert.False(t, validOid(oid), oid)
+	}
+}
+
+func TestVerifyBase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delta-base")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, deltaBaseOid)
+	require.Nil(t, ioutil.WriteFile(path, []byte("base"), 0644))
+	assert.Nil(t, verifyBase(path, deltaBaseOid))
+
+	require.Nil(t, ioutil.WriteFile(path, []byte("corrupt"), 0644))
+	if err := verifyBase(path, deltaBaseOid); assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "expected OID "+deltaBaseOid)
+	}
+
+	assert.NotNil(t, verifyBase(filepath.Join(dir, "missing"), deltaBaseOid))
+}
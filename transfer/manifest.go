@@ -29,6 +29,9 @@ func ConfigureManifest(m *Manifest, cfg *config.Configuration) *Manifest {
 	if cfg.TusTransfersAllowed() {
 		configureTusAdapter(m)
 	}
+	if cfg.DeltaTransfersAllowed() {
+		configureDeltaAdapter(m)
+	}
 	configureCustomAdapters(cfg, m)
 	return m
 }
@@ -57,6 +57,24 @@ type TransferAdapter interface {
 	ClearTempStorage() error
 }
 
+// DownloadVerifier is implemented by adapters which check that the content
+// they download hashes to the object's OID before reporting the transfer as
+// complete, so that the transfer queue doesn't need to read it again.
+type DownloadVerifier interface {
+	VerifiesDownloads() bool
+}
+
+// Canceller is implemented by adapters which can stop a transfer they have
+// been given before it finishes, so that the transfer queue can cancel a
+// single object. A cancelled transfer still completes, with an error for
+// which errors.IsCancelledError is true.
+type Canceller interface {
+	// Cancel stops the transfer of the object with the given OID, whether
+	// it is waiting for a worker or in progress. It returns false if the
+	// adapter has no unfinished transfer of that object.
+	Cancel(oid string) bool
+}
+
 // General struct for both uploads and downloads
 type Transfer struct {
 	// Name of the file that triggered this transfer
@@ -66,11 +84,17 @@ type Transfer struct {
 	// Path for uploads is the source of data to send, for downloads is the
 	// location to place the final result
 	Path string
+	// ResumeFrom is, for downloads, the number of bytes of the object which
+	// an earlier attempt left in its incomplete download file (see
+	// ResumableDownloadOffset). Adapters which support it should continue
+	// from there, and count those bytes as done in their progress. Zero
+	// means the download starts from the beginning.
+	ResumeFrom int64
 }
 
 // NewTransfer creates a new Transfer instance
-func NewTransfer(name string, obj *api.ObjectResource, path string) *Transfer {
-	return &Transfer{name, obj, path}
+func NewTransfer(name string, obj *api.ObjectResource, path string, resumeFrom int64) *Transfer {
+	return &Transfer{name, obj, path, resumeFrom}
 }
 
 // Result of a transfer returned through CompletionChannel()
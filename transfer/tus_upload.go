@@ -20,7 +20,9 @@ const (
 	TusVersion     = "1.0.0"
 )
 
-// Adapter for tus.io protocol resumaable uploads
+// Adapter for tus.io protocol resumaable uploads. Since tus.io uploads resume
+// from the offset reported by the server, failed uploads are always safe to
+// retry.
 type tusUploadAdapter struct {
 	*adapterBase
 }
@@ -55,7 +57,7 @@ func (a *tusUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb TransferP
 	req.Header.Set("Tus-Resumable", TusVersion)
 	res, err := httputil.DoHttpRequest(config.Config, req, false)
 	if err != nil {
-		return errors.NewRetriableError(err)
+		return errors.NewRetriableNetworkError(err, true)
 	}
 
 	//    Response will contain Upload-Offset if supported
@@ -113,6 +115,7 @@ func (a *tusUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb TransferP
 	// Ensure progress callbacks made while uploading
 	// Wrap callback to give name context
 	ccb := func(totalSize int64, readSoFar int64, readSinceLast int) error {
+		a.limiter.Wait(readSinceLast)
 		if cb != nil {
 			return cb(t.Name, totalSize, readSoFar, readSinceLast)
 		}
@@ -136,7 +139,7 @@ func (a *tusUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb TransferP
 
 	res, err = httputil.DoHttpRequest(config.Config, req, false)
 	if err != nil {
-		return errors.NewRetriableError(err)
+		return errors.NewRetriableNetworkError(err, true)
 	}
 	httputil.LogTransfer(config.Config, "lfs.data.upload", res)
 
@@ -144,11 +147,12 @@ func (a *tusUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb TransferP
 	// upload has expired. This can be safely retried.
 	if res.StatusCode == 403 {
 		err = errors.New("http: received status 403")
-		return errors.NewRetriableError(err)
+		return errors.NewSafeRetriableError(err)
 	}
 
 	if res.StatusCode > 299 {
-		return errors.Wrapf(nil, "Invalid status for %s: %d", httputil.TraceHttpReq(req), res.StatusCode)
+		err = errors.Errorf("Invalid status for %s: %d", httputil.TraceHttpReq(req), res.StatusCode)
+		return errors.NewStatusError(err, res.StatusCode)
 	}
 
 	io.Copy(ioutil.Discard, res.Body)